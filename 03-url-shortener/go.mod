@@ -4,4 +4,12 @@ go 1.24
 
 require (
 	github.com/lib/pq v1.10.9 // PostgreSQL driver
+	github.com/redis/go-redis/v9 v9.16.0 // Redis client for the cache layer
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e // QR Code encoder (pure Go)
+	golang.org/x/crypto v0.40.0 // bcrypt for link passwords
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 )
@@ -0,0 +1,172 @@
+// Package analytics 實現點擊分析管道
+//
+// 架構：
+//
+//	redirect ──Track()──▶ [buffered chan] ──▶ worker（聚合）──flush──▶ Store（小時匯總）
+//	                      非阻塞，滿了就丟        內存 map            PostgreSQL UPSERT
+//
+// 系統設計考量：
+//
+//  1. 為什麼不在重定向路徑上直接寫資料庫？
+//     - 重定向是最高頻操作（目標 p99 < 10ms）
+//     - 每次點擊一條 INSERT，10K QPS 就是 10K 寫入/秒
+//     - 資料庫抖動會直接反映到用戶體驗上
+//
+//  2. 為什麼按小時匯總（rollup）而不是存明細？
+//     - 明細：每次點擊一行，1 億點擊/天 = 1 億行/天
+//     - 匯總：(域名, 短碼, 小時, 來源, 國家, 設備, 變體) 一行，行數與點擊量無關
+//     - 代價：失去秒級精度和單次點擊的追溯能力
+//
+//  3. 一致性取捨：
+//     - 進程崩潰會丟失未 flush 的點擊（最多一個 flush 週期）
+//     - 緩衝區滿時丟棄事件（保護重定向延遲優先於統計精確）
+//     - 需要精確計數時：改用 Kafka 等持久化隊列
+package analytics
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ClickEvent 一次點擊事件（原始數據）
+//
+// 為什麼存原始字段（UA、IP）而不是分類結果？
+//   - 分類（UA 解析、GeoIP 查詢）放到後台 worker 做
+//   - 重定向路徑只做字段拷貝，不增加延遲
+type ClickEvent struct {
+	Domain    string // 自定義域名（空表示默認域名）
+	ShortCode string
+	Timestamp time.Time
+	Referrer  string // HTTP Referer header（原始值）
+	UserAgent string // User-Agent header（原始值）
+	IP        string // 客戶端 IP
+	Variant   string // 命中的路由規則 / 分流變體（重定向時已確定）
+}
+
+// Rollup 小時匯總記錄
+//
+// 主鍵：(Domain, ShortCode, Hour, Referrer, Country, Device, Variant)
+//
+// 為什麼主鍵要包含域名？不同域名下可以有相同的短碼，它們是不同的鏈接
+type Rollup struct {
+	Domain    string // 自定義域名（空表示默認域名）
+	ShortCode string
+	Hour      time.Time // 截斷到整點（UTC）
+	Referrer  string    // 來源域名（如 "twitter.com"，直接訪問為 "direct"）
+	Country   string    // ISO 國家代碼（未知為 "unknown"）
+	Device    string    // desktop / mobile / tablet / bot / unknown
+	Variant   string    // 路由變體（無規則命中為 "default"）
+	Clicks    int64
+}
+
+// Store 匯總數據存儲接口
+type Store interface {
+	// SaveRollups 累加匯總數據
+	//
+	// 必須是累加語義（UPSERT clicks = clicks + N）：
+	//   - 同一小時會被多次 flush
+	//   - 多個副本會寫入同一行
+	SaveRollups(ctx context.Context, rollups []Rollup) error
+
+	// LoadRollups 讀取時間範圍內的匯總數據 [from, to)
+	LoadRollups(ctx context.Context, domain, shortCode string, from, to time.Time) ([]Rollup, error)
+}
+
+// Breakdown 點擊分布統計
+type Breakdown struct {
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Total     int64            `json:"total"`
+	Timeline  []HourlyClicks   `json:"timeline"`
+	Referrers map[string]int64 `json:"referrers"`
+	Countries map[string]int64 `json:"countries"`
+	Devices   map[string]int64 `json:"devices"`
+	Variants  map[string]int64 `json:"variants"` // 各路由規則 / A/B 變體的點擊數
+}
+
+// HourlyClicks 時間線上的一個點
+type HourlyClicks struct {
+	Hour   time.Time `json:"hour"`
+	Clicks int64     `json:"clicks"`
+}
+
+// Summarize 將匯總記錄彙整為各維度的分布
+//
+// 為什麼在應用層彙整而不是 SQL GROUP BY？
+//   - 一次查詢拿到所有維度（否則需要 5 次 GROUP BY）
+//   - 匯總表的行數已經很小（小時粒度）
+//   - Memory 與 Postgres 實現共用同一邏輯
+func Summarize(rollups []Rollup, from, to time.Time) *Breakdown {
+	b := &Breakdown{
+		From:      from,
+		To:        to,
+		Timeline:  []HourlyClicks{},
+		Referrers: make(map[string]int64),
+		Countries: make(map[string]int64),
+		Devices:   make(map[string]int64),
+		Variants:  make(map[string]int64),
+	}
+
+	hourly := make(map[time.Time]int64)
+	for _, r := range rollups {
+		b.Total += r.Clicks
+		hourly[r.Hour] += r.Clicks
+		b.Referrers[r.Referrer] += r.Clicks
+		b.Countries[r.Country] += r.Clicks
+		b.Devices[r.Device] += r.Clicks
+		b.Variants[r.Variant] += r.Clicks
+	}
+
+	for hour, clicks := range hourly {
+		b.Timeline = append(b.Timeline, HourlyClicks{Hour: hour, Clicks: clicks})
+	}
+	sort.Slice(b.Timeline, func(i, j int) bool {
+		return b.Timeline[i].Hour.Before(b.Timeline[j].Hour)
+	})
+
+	return b
+}
+
+// Query 查詢短碼在時間範圍內的點擊分布
+func Query(ctx context.Context, store Store, domain, shortCode string, from, to time.Time) (*Breakdown, error) {
+	rollups, err := store.LoadRollups(ctx, domain, shortCode, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return Summarize(rollups, from, to), nil
+}
+
+// normalizeReferrer 將 Referer header 正規化為域名
+//
+// 範例：
+//
+//	""                                   → "direct"
+//	"https://www.twitter.com/some/post"  → "twitter.com"
+//	"android-app://com.slack/"           → "com.slack"
+//
+// 為什麼只保留域名？
+//   - 完整 URL 的基數（cardinality）太高，匯總表會膨脹
+//   - 路徑可能包含敏感信息（搜索詞、token）
+//
+// Referer 由客戶端任意填寫：超過域名上限（253）的主機名不是合法域名，
+// 歸為 "unknown"，否則寫入 click_rollups.referrer（VARCHAR(255)）會讓整批 flush 失敗
+func normalizeReferrer(ref string) string {
+	if ref == "" {
+		return "direct"
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(host) > maxReferrerLength {
+		return "unknown"
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// maxReferrerLength 來源域名最大長度（DNS 域名上限）
+const maxReferrerLength = 253
@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	h0 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	h1 := h0.Add(time.Hour)
+	rollups := []Rollup{
+		{ShortCode: "abc", Hour: h1, Referrer: "direct", Country: "TW", Device: "mobile", Variant: "ios", Clicks: 5},
+		{ShortCode: "abc", Hour: h0, Referrer: "twitter.com", Country: "TW", Device: "desktop", Variant: "default", Clicks: 2},
+		{ShortCode: "abc", Hour: h0, Referrer: "direct", Country: "US", Device: "mobile", Variant: "default", Clicks: 3},
+	}
+
+	b := Summarize(rollups, h0, h1.Add(time.Hour))
+
+	if b.Total != 10 {
+		t.Errorf("Total = %d, want 10", b.Total)
+	}
+	wantTimeline := []HourlyClicks{{h0, 5}, {h1, 5}}
+	if len(b.Timeline) != len(wantTimeline) {
+		t.Fatalf("Timeline = %v, want %v", b.Timeline, wantTimeline)
+	}
+	for i, p := range wantTimeline {
+		if b.Timeline[i] != p {
+			t.Errorf("Timeline[%d] = %v, want %v (sorted by hour)", i, b.Timeline[i], p)
+		}
+	}
+
+	checks := []struct {
+		name string
+		got  map[string]int64
+		want map[string]int64
+	}{
+		{"Referrers", b.Referrers, map[string]int64{"direct": 8, "twitter.com": 2}},
+		{"Countries", b.Countries, map[string]int64{"TW": 7, "US": 3}},
+		{"Devices", b.Devices, map[string]int64{"mobile": 8, "desktop": 2}},
+		{"Variants", b.Variants, map[string]int64{"ios": 5, "default": 5}},
+	}
+	for _, c := range checks {
+		if len(c.got) != len(c.want) {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+			continue
+		}
+		for k, v := range c.want {
+			if c.got[k] != v {
+				t.Errorf("%s[%q] = %d, want %d", c.name, k, c.got[k], v)
+			}
+		}
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	b := Summarize(nil, time.Time{}, time.Time{})
+	// JSON 輸出 [] 與 {} 而不是 null
+	if b.Total != 0 || b.Timeline == nil || b.Referrers == nil || b.Variants == nil {
+		t.Errorf("Summarize(nil) = %+v", b)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	store := &memStore{}
+	store.SaveRollups(context.Background(), []Rollup{{ShortCode: "abc", Clicks: 4}})
+
+	b, err := Query(context.Background(), store, "", "abc", time.Time{}, time.Now())
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if b.Total != 4 {
+		t.Errorf("Total = %d, want 4", b.Total)
+	}
+}
+
+func TestNormalizeReferrer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "direct"},
+		{"https://www.twitter.com/some/post", "twitter.com"},
+		{"https://News.Ycombinator.com/item?id=1", "news.ycombinator.com"},
+		{"android-app://com.slack/", "com.slack"},
+		{"not a url", "unknown"},
+		// 域名上限 253：剛好 253 保留，超過歸為 unknown（匯總表的列寬 255）
+		{"https://" + strings.Repeat("a", 249) + ".com/", strings.Repeat("a", 249) + ".com"},
+		{"https://" + strings.Repeat("a", 250) + ".com/", "unknown"},
+		{"https://" + strings.Repeat("a", 4096) + "/", "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeReferrer(tt.input); got != tt.expected {
+			t.Errorf("normalizeReferrer(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
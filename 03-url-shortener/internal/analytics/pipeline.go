@@ -0,0 +1,267 @@
+package analytics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/pkg/useragent"
+)
+
+// GeoLocator IP → 國家代碼查詢接口
+//
+// *geoip.DB 實現了此接口；測試或未配置 GeoIP 時可傳 nil
+type GeoLocator interface {
+	Country(ip string) string
+}
+
+// PipelineConfig 管道配置
+type PipelineConfig struct {
+	BufferSize    int           // 事件緩衝區大小（默認 10000）
+	FlushInterval time.Duration // flush 間隔（默認 10 秒）
+	MaxPending    int           // 內存中最多累積的匯總行數，超過立即 flush（默認 5000）
+}
+
+// PipelineStats 管道運行統計（用於監控）
+type PipelineStats struct {
+	Tracked int64 `json:"tracked"` // 成功入隊的事件數
+	Dropped int64 `json:"dropped"` // 緩衝區滿被丟棄的事件數
+	Flushed int64 `json:"flushed"` // 已寫入存儲的點擊數
+	Failed  int64 `json:"failed"`  // flush 失敗丟失的點擊數
+}
+
+// Pipeline 異步點擊分析管道
+//
+// 生命週期：
+//
+//	p := NewPipeline(store, geo, logger, cfg)
+//	p.Start()
+//	defer p.Close(ctx) // 優雅關閉：排空緩衝區並最後一次 flush
+type Pipeline struct {
+	store  Store
+	geo    GeoLocator
+	logger *slog.Logger
+	cfg    PipelineConfig
+
+	events chan ClickEvent
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	// mu 保護 closed：Track 持讀鎖完成「檢查 + 入隊」，Close 持寫鎖設置 closed
+	// 否則 Track 可能在檢查之後、入隊之前被 Close 超車，事件留在已無人讀取的 channel 中
+	mu     sync.RWMutex
+	closed bool
+
+	tracked atomic.Int64
+	dropped atomic.Int64
+	flushed atomic.Int64
+	failed  atomic.Int64
+}
+
+// rollupKey 聚合鍵（匯總表的主鍵）
+type rollupKey struct {
+	domain    string
+	shortCode string
+	hour      time.Time
+	referrer  string
+	country   string
+	device    string
+	variant   string
+}
+
+// NewPipeline 創建點擊分析管道
+func NewPipeline(store Store, geo GeoLocator, logger *slog.Logger, cfg PipelineConfig) *Pipeline {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 10 * time.Second
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 5000
+	}
+
+	return &Pipeline{
+		store:  store,
+		geo:    geo,
+		logger: logger,
+		cfg:    cfg,
+		events: make(chan ClickEvent, cfg.BufferSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start 啟動後台聚合 worker
+func (p *Pipeline) Start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+// Track 提交一次點擊事件（非阻塞）
+//
+// 返回 false 表示事件被丟棄（緩衝區滿或管道已關閉），兩種情況都計入 Dropped
+//
+// 系統設計考量：
+//   - 使用 select + default：緩衝區滿時立即返回，絕不阻塞重定向
+//   - 丟棄計數暴露給監控：持續丟棄說明需要擴大緩衝區或加快 flush
+//   - 讀鎖只與 Close 互斥，Track 之間不互相阻塞
+func (p *Pipeline) Track(e ClickEvent) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case p.events <- e:
+		p.tracked.Add(1)
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Close 停止管道並 flush 剩餘數據
+//
+// ctx 控制最後一次 flush 的超時
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	// 持有寫鎖時設置：之後的 Track 必定看到 closed，已入隊的事件都會被 worker 排空
+	p.closed = true
+	p.mu.Unlock()
+	close(p.done)
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 返回管道運行統計
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		Tracked: p.tracked.Load(),
+		Dropped: p.dropped.Load(),
+		Flushed: p.flushed.Load(),
+		Failed:  p.failed.Load(),
+	}
+}
+
+// run worker 主循環
+//
+// 單一 goroutine 持有聚合 map，無需加鎖
+func (p *Pipeline) run() {
+	defer p.wg.Done()
+
+	pending := make(map[rollupKey]int64)
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-p.events:
+			p.aggregate(pending, e)
+			if len(pending) >= p.cfg.MaxPending {
+				pending = p.flush(pending)
+			}
+
+		case <-ticker.C:
+			pending = p.flush(pending)
+
+		case <-p.done:
+			// 排空緩衝區中剩餘的事件
+			for {
+				select {
+				case e := <-p.events:
+					p.aggregate(pending, e)
+				default:
+					p.flush(pending)
+					return
+				}
+			}
+		}
+	}
+}
+
+// aggregate 將事件分類後累加到聚合 map
+func (p *Pipeline) aggregate(pending map[rollupKey]int64, e ClickEvent) {
+	country := ""
+	if p.geo != nil {
+		country = p.geo.Country(e.IP)
+	}
+	if country == "" {
+		country = "unknown"
+	}
+
+	variant := e.Variant
+	if variant == "" {
+		variant = "default"
+	}
+
+	key := rollupKey{
+		domain:    e.Domain,
+		shortCode: e.ShortCode,
+		hour:      e.Timestamp.UTC().Truncate(time.Hour),
+		referrer:  normalizeReferrer(e.Referrer),
+		country:   country,
+		device:    string(useragent.Classify(e.UserAgent)),
+		variant:   variant,
+	}
+	pending[key]++
+}
+
+// flush 將聚合結果寫入存儲，返回新的空 map
+//
+// 失敗處理：
+//   - 記錄日誌並丟棄（統計允許不精確）
+//   - 為什麼不重試？重試期間新事件持續累積，容易雪崩
+func (p *Pipeline) flush(pending map[rollupKey]int64) map[rollupKey]int64 {
+	if len(pending) == 0 {
+		return pending
+	}
+
+	rollups := make([]Rollup, 0, len(pending))
+	var clicks int64
+	for k, n := range pending {
+		rollups = append(rollups, Rollup{
+			Domain:    k.domain,
+			ShortCode: k.shortCode,
+			Hour:      k.hour,
+			Referrer:  k.referrer,
+			Country:   k.country,
+			Device:    k.device,
+			Variant:   k.variant,
+			Clicks:    n,
+		})
+		clicks += n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.store.SaveRollups(ctx, rollups); err != nil {
+		p.failed.Add(clicks)
+		p.logger.Error("flush click rollups failed", "rows", len(rollups), "clicks", clicks, "error", err)
+	} else {
+		p.flushed.Add(clicks)
+	}
+
+	return make(map[rollupKey]int64)
+}
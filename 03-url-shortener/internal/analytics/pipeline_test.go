@@ -0,0 +1,194 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore 記錄每次 SaveRollups 的測試用存儲
+type memStore struct {
+	mu      sync.Mutex
+	batches [][]Rollup
+	err     error
+}
+
+func (s *memStore) SaveRollups(ctx context.Context, rollups []Rollup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, rollups)
+	return nil
+}
+
+func (s *memStore) LoadRollups(ctx context.Context, domain, shortCode string, from, to time.Time) ([]Rollup, error) {
+	return s.rollups(), nil
+}
+
+func (s *memStore) rollups() []Rollup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var all []Rollup
+	for _, b := range s.batches {
+		all = append(all, b...)
+	}
+	return all
+}
+
+type staticGeo map[string]string
+
+func (g staticGeo) Country(ip string) string { return g[ip] }
+
+func newTestPipeline(store Store, cfg PipelineConfig) *Pipeline {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewPipeline(store, staticGeo{"203.0.113.7": "TW"}, logger, cfg)
+}
+
+func TestPipelineFlushOnClose(t *testing.T) {
+	store := &memStore{}
+	p := newTestPipeline(store, PipelineConfig{FlushInterval: time.Hour})
+	p.Start()
+
+	hour := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	iphone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148"
+	for i := range 3 {
+		p.Track(ClickEvent{ShortCode: "abc", Timestamp: hour.Add(time.Duration(i) * time.Minute), Referrer: "https://www.twitter.com/x", UserAgent: iphone, IP: "203.0.113.7"})
+	}
+	p.Track(ClickEvent{ShortCode: "abc", Timestamp: hour.Add(90 * time.Minute), Variant: "ios"})
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	rollups := store.rollups()
+	if len(rollups) != 2 {
+		t.Fatalf("got %d rollup rows, want 2: %+v", len(rollups), rollups)
+	}
+	for _, r := range rollups {
+		switch r.Hour {
+		case hour:
+			want := Rollup{ShortCode: "abc", Hour: hour, Referrer: "twitter.com", Country: "TW", Device: "mobile", Variant: "default", Clicks: 3}
+			if r != want {
+				t.Errorf("first hour rollup = %+v, want %+v", r, want)
+			}
+		case hour.Add(time.Hour):
+			if r.Clicks != 1 || r.Referrer != "direct" || r.Country != "unknown" || r.Variant != "ios" {
+				t.Errorf("second hour rollup = %+v", r)
+			}
+		default:
+			t.Errorf("unexpected hour %v", r.Hour)
+		}
+	}
+
+	stats := p.Stats()
+	if stats.Tracked != 4 || stats.Flushed != 4 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestPipelineDropOnFull(t *testing.T) {
+	// 不啟動 worker：緩衝區填滿後 Track 必須立即返回 false，而不是阻塞
+	p := newTestPipeline(&memStore{}, PipelineConfig{BufferSize: 2})
+
+	for i := range 2 {
+		if !p.Track(ClickEvent{ShortCode: "abc", Timestamp: time.Now()}) {
+			t.Fatalf("Track #%d dropped with free buffer", i)
+		}
+	}
+	if p.Track(ClickEvent{ShortCode: "abc", Timestamp: time.Now()}) {
+		t.Fatal("Track on full buffer = true, want false")
+	}
+
+	if stats := p.Stats(); stats.Tracked != 2 || stats.Dropped != 1 {
+		t.Errorf("Stats() = %+v, want tracked=2 dropped=1", stats)
+	}
+}
+
+func TestPipelineTrackAfterClose(t *testing.T) {
+	store := &memStore{}
+	p := newTestPipeline(store, PipelineConfig{})
+	p.Start()
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if p.Track(ClickEvent{ShortCode: "abc", Timestamp: time.Now()}) {
+		t.Fatal("Track after Close = true, want false")
+	}
+	if stats := p.Stats(); stats.Dropped != 1 {
+		t.Errorf("Dropped = %d, want 1", stats.Dropped)
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+// 並發 Track 與 Close：每個事件要麼被寫入存儲，要麼計入 Dropped，不能憑空消失
+func TestPipelineCloseRace(t *testing.T) {
+	store := &memStore{}
+	p := newTestPipeline(store, PipelineConfig{BufferSize: 64, FlushInterval: time.Hour})
+	p.Start()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				p.Track(ClickEvent{ShortCode: "abc", Timestamp: time.Now()})
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	wg.Wait()
+
+	var saved int64
+	for _, r := range store.rollups() {
+		saved += r.Clicks
+	}
+	stats := p.Stats()
+	if saved != stats.Tracked || stats.Tracked+stats.Dropped != 8*500 {
+		t.Errorf("saved=%d stats=%+v, want saved == tracked and tracked+dropped == 4000", saved, stats)
+	}
+}
+
+func TestPipelineMaxPending(t *testing.T) {
+	store := &memStore{}
+	p := newTestPipeline(store, PipelineConfig{FlushInterval: time.Hour, MaxPending: 2})
+	p.Start()
+	defer p.Close(context.Background())
+
+	// 兩個不同短碼 = 兩個聚合行，達到 MaxPending 立即 flush，不等 ticker
+	p.Track(ClickEvent{ShortCode: "a", Timestamp: time.Now()})
+	p.Track(ClickEvent{ShortCode: "b", Timestamp: time.Now()})
+
+	deadline := time.Now().Add(time.Second)
+	for len(store.rollups()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("rollups were not flushed after reaching MaxPending")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPipelineFlushFailure(t *testing.T) {
+	store := &memStore{err: errors.New("db down")}
+	p := newTestPipeline(store, PipelineConfig{})
+	p.Start()
+	p.Track(ClickEvent{ShortCode: "abc", Timestamp: time.Now()})
+	p.Track(ClickEvent{ShortCode: "abc", Timestamp: time.Now()})
+	p.Close(context.Background())
+
+	if stats := p.Stats(); stats.Failed != 2 || stats.Flushed != 0 {
+		t.Errorf("Stats() = %+v, want failed=2 flushed=0", stats)
+	}
+}
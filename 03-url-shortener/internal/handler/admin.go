@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin 管理員認證中間件
+//
+// 認證方式：Authorization: Bearer <ADMIN_TOKEN>
+//
+// 設計考量：
+//   - 未配置 ADMIN_TOKEN 時管理接口一律 404（默認關閉，而不是默認開放）
+//   - 常數時間比較（subtle.ConstantTimeCompare），防止計時攻擊逐字節猜測 token
+func (h *Handler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			h.errorJSON(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// flagged 列出被篩查標記的鏈接
+//
+// API: GET /api/v1/admin/flagged（需要管理員 token）
+// Response: {"flagged": [{"short_code": "...", "verdict": {...}, "hits": 3, ...}]}
+//
+// 限制：只包含本副本在重定向時攔截過的鏈接（見 screening.Registry），
+// 不是存儲中所有命中黑名單的鏈接
+func (h *Handler) flagged(w http.ResponseWriter, r *http.Request) {
+	if h.flags == nil {
+		h.writeJSON(w, map[string]any{"flagged": []any{}}, http.StatusOK)
+		return
+	}
+	h.writeJSON(w, map[string]any{"flagged": h.flags.List()}, http.StatusOK)
+}
+
+// lifecycleStats 過期清理任務的運行統計
+//
+// API: GET /api/v1/admin/lifecycle（需要管理員 token）
+// Response: {"enabled": true, "stats": {"runs": 10, "skipped": 3, "expired": 120, ...}}
+//
+// 注意：統計是本副本視角
+//   - 多副本部署時只有持鎖的副本在清理，其他副本的 skipped 持續增長
+//   - 全局視圖需要匯總各副本（或導出到 Prometheus 後聚合）
+func (h *Handler) lifecycleStats(w http.ResponseWriter, r *http.Request) {
+	if h.sweeper == nil {
+		h.writeJSON(w, map[string]any{"enabled": false}, http.StatusOK)
+		return
+	}
+	h.writeJSON(w, map[string]any{"enabled": true, "stats": h.sweeper.Stats()}, http.StatusOK)
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// maxBatchBody 批量請求體上限
+//
+// 1000 條 × 每條約 2KB（長 URL + 字段）≈ 2MB，留出餘量
+const maxBatchBody = 4 << 20
+
+// batchItem 批量創建的單個條目（JSON 請求格式）
+type batchItem struct {
+	LongURL    string  `json:"long_url"`
+	CustomCode string  `json:"custom_code,omitempty"`
+	Domain     string  `json:"domain,omitempty"`     // 自定義域名（可選，必須已驗證）
+	ExpiresAt  *string `json:"expires_at,omitempty"` // RFC3339 格式
+
+	Rules     []shortener.Rule `json:"rules,omitempty"`      // 條件路由規則（僅 JSON 格式支持）
+	MaxClicks int64            `json:"max_clicks,omitempty"` // 點擊上限（僅 JSON 格式支持）
+
+	// 不支持密碼：bcrypt 每條約 50-100ms，1000 條會超出請求超時
+	// 需要密碼保護的鏈接通過單條創建接口生成
+}
+
+// createBatch 批量創建短網址
+//
+// API: POST /api/v1/urls/batch
+//
+// 請求格式（二選一，按 Content-Type 區分）：
+//
+//	application/json：{"items": [{"long_url": "...", "custom_code": "...", "expires_at": "..."}]}
+//	text/csv：首行為表頭，列名 long_url（必填）、custom_code、domain、expires_at（可選，順序任意）
+//
+// Response（200，逐條結果與請求順序一致）：
+//
+//	{"results": [{"index": 0, "short_url": "...", ...}, {"index": 1, "error": "...", "status": 409}],
+//	 "succeeded": 1, "failed": 1}
+//
+// 設計考量：
+//   - 部分成功：單條失敗以 error + status 記錄在對應位置，不影響其他條目
+//   - 整體狀態碼 200：請求本身被成功處理；整批無效（格式錯誤、超過上限）才返回 4xx
+//   - CSV 導入：營銷團隊通常直接從表格導出，省去客戶端轉換
+func (h *Handler) createBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBody)
+
+	// 1. 解析請求（JSON 或 CSV）
+	var items []batchItem
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		items, err = parseBatchCSV(r.Body)
+	} else {
+		var body struct {
+			Items []batchItem `json:"items"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&body)
+		items = body.Items
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.errorJSON(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.errorJSON(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(items) == 0 {
+		h.errorJSON(w, "items is required", http.StatusBadRequest)
+		return
+	}
+	if len(items) > shortener.MaxBatchSize {
+		h.errorJSON(w, fmt.Sprintf("too many items (max %d)", shortener.MaxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	// 2. 轉換為業務請求
+	//
+	// 字段級錯誤（缺少 long_url、時間格式錯誤）只影響該條目
+	ctx := r.Context()
+	ownerID := userFromContext(ctx).ID
+
+	results := make([]map[string]any, len(items))
+	reqs := make([]shortener.ShortenRequest, 0, len(items))
+	positions := make([]int, 0, len(items)) // reqs[j] 對應 items[positions[j]]
+	for i, item := range items {
+		if item.LongURL == "" {
+			results[i] = batchError(i, "long_url is required", http.StatusBadRequest)
+			continue
+		}
+		var expiresAt *time.Time
+		if item.ExpiresAt != nil && *item.ExpiresAt != "" {
+			t, err := time.Parse(time.RFC3339, *item.ExpiresAt)
+			if err != nil {
+				results[i] = batchError(i, "invalid expires_at format (use RFC3339)", http.StatusBadRequest)
+				continue
+			}
+			expiresAt = &t
+		}
+		reqs = append(reqs, shortener.ShortenRequest{
+			LongURL:    item.LongURL,
+			CustomCode: item.CustomCode,
+			Domain:     item.Domain,
+			ExpiresAt:  expiresAt,
+			OwnerID:    ownerID,
+			Rules:      item.Rules,
+			MaxClicks:  item.MaxClicks,
+		})
+		positions = append(positions, i)
+	}
+
+	// 3. 批量創建
+	batch, err := shortener.ShortenBatch(ctx, h.store, h.idgen, h.screener, reqs)
+	if err != nil {
+		h.logger.Error("batch create short urls failed", "items", len(reqs), "error", err)
+		h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// 4. 合併結果
+	for j, res := range batch {
+		i := positions[j]
+		if res.Err != nil {
+			msg, status := createError(res.Err)
+			if status == http.StatusInternalServerError {
+				h.logger.Error("batch item failed", "index", i, "error", res.Err)
+			}
+			results[i] = batchError(i, msg, status)
+			continue
+		}
+		resp := h.urlResponse(r, res.URL)
+		resp["index"] = i
+		results[i] = resp
+	}
+
+	failed := 0
+	for _, res := range results {
+		if _, ok := res["error"]; ok {
+			failed++
+		}
+	}
+
+	h.writeJSON(w, map[string]any{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	}, http.StatusOK)
+}
+
+// batchError 構建單條失敗結果
+func batchError(index int, msg string, status int) map[string]any {
+	return map[string]any{
+		"index":  index,
+		"error":  msg,
+		"status": status,
+	}
+}
+
+// parseBatchCSV 解析 CSV 導入文件
+//
+// 格式：
+//
+//	long_url,custom_code,domain,expires_at
+//	https://example.com/a,spring24,go.ourbrand.com,2025-06-01T00:00:00Z
+//	https://example.com/b,,,
+//
+// 設計考量：
+//   - 按表頭名稱定位列：允許省略可選列、調整列順序
+//   - 讀取超過 MaxBatchSize 行即停止：不為注定被拒絕的請求解析整個文件
+func parseBatchCSV(r io.Reader) ([]batchItem, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // 允許行尾省略空的可選列
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	columns := map[string]int{"long_url": -1, "custom_code": -1, "domain": -1, "expires_at": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) // Excel 導出可能帶 BOM
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+	}
+	if columns["long_url"] < 0 {
+		return nil, errors.New("csv header must contain long_url")
+	}
+
+	field := func(record []string, name string) string {
+		i := columns[name]
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var items []batchItem
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		item := batchItem{
+			LongURL:    field(record, "long_url"),
+			CustomCode: field(record, "custom_code"),
+			Domain:     field(record, "domain"),
+		}
+		if v := field(record, "expires_at"); v != "" {
+			item.ExpiresAt = &v
+		}
+		items = append(items, item)
+
+		if len(items) > shortener.MaxBatchSize {
+			break
+		}
+	}
+
+	return items, nil
+}
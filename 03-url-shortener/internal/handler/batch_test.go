@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+func TestParseBatchCSV(t *testing.T) {
+	input := "\ufeffExpires_At, long_url ,custom_code\n" + // BOM、大小寫、空白、列順序任意
+		"2025-06-01T00:00:00Z,https://example.com/a,spring24\n" +
+		",https://example.com/b\n" + // 行尾省略可選列
+		"\"\",\" https://example.com/c \",\n"
+
+	items, err := parseBatchCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseBatchCSV() error = %v", err)
+	}
+
+	want := []struct {
+		longURL, code, expires string
+	}{
+		{"https://example.com/a", "spring24", "2025-06-01T00:00:00Z"},
+		{"https://example.com/b", "", ""},
+		{"https://example.com/c", "", ""},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("parseBatchCSV() = %d items, want %d", len(items), len(want))
+	}
+	for i, w := range want {
+		got := items[i]
+		expires := ""
+		if got.ExpiresAt != nil {
+			expires = *got.ExpiresAt
+		}
+		if got.LongURL != w.longURL || got.CustomCode != w.code || got.Domain != "" || expires != w.expires {
+			t.Errorf("items[%d] = %+v (expires %q), want %+v", i, got, expires, w)
+		}
+	}
+}
+
+func TestParseBatchCSVErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing long_url column", "custom_code,domain\nabc,\n"},
+		{"unterminated quote", "long_url\n\"https://example.com/a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if items, err := parseBatchCSV(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("parseBatchCSV(%q) = %+v, want error", tt.input, items)
+			}
+		})
+	}
+}
+
+func TestParseBatchCSVLimits(t *testing.T) {
+	// 空文件：沒有條目（由 createBatch 返回 400）
+	items, err := parseBatchCSV(strings.NewReader(""))
+	if err != nil || len(items) != 0 {
+		t.Errorf("parseBatchCSV(empty) = %v, %v, want no items", items, err)
+	}
+
+	// 超過上限：讀到 MaxBatchSize+1 行即停止
+	var b strings.Builder
+	b.WriteString("long_url\n")
+	for range shortener.MaxBatchSize + 50 {
+		b.WriteString("https://example.com/x\n")
+	}
+	items, err = parseBatchCSV(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("parseBatchCSV() error = %v", err)
+	}
+	if len(items) != shortener.MaxBatchSize+1 {
+		t.Errorf("parseBatchCSV() = %d items, want %d", len(items), shortener.MaxBatchSize+1)
+	}
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// addDomain 註冊自定義域名
+//
+// API: POST /api/v1/domains
+// Body: {"name": "go.ourbrand.com"}
+// Response: {"name": "...", "verified": false, "verification": {"type": "TXT", "name": "_shortener.go.ourbrand.com", "value": "shortener-verification=..."}}
+//
+// 註冊後需添加 verification 中的 TXT 記錄，再調用 verify 接口完成驗證
+func (h *Handler) addDomain(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.errorJSON(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	d, err := shortener.AddDomain(r.Context(), h.store, userFromContext(r.Context()), req.Name)
+	if err != nil {
+		h.domainError(w, req.Name, err)
+		return
+	}
+
+	h.writeJSON(w, domainResponse(d), http.StatusCreated)
+}
+
+// listDomains 列出當前用戶的自定義域名
+//
+// API: GET /api/v1/domains
+// Response: {"domains": [...]}
+func (h *Handler) listDomains(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	domains, err := shortener.ListDomains(r.Context(), h.store, user)
+	if err != nil {
+		h.logger.Error("list domains failed", "owner_id", user.ID, "error", err)
+		h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]map[string]any, 0, len(domains))
+	for _, d := range domains {
+		items = append(items, domainResponse(d))
+	}
+	h.writeJSON(w, map[string]any{"domains": items}, http.StatusOK)
+}
+
+// verifyDomain 檢查 DNS TXT 記錄，完成域名所有權驗證
+//
+// API: POST /api/v1/domains/{name}/verify
+// Response: 200 + 域名信息；TXT 記錄未生效時 422，可稍後重試
+func (h *Handler) verifyDomain(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	d, err := shortener.VerifyDomain(r.Context(), h.store, h.verifier, userFromContext(r.Context()), name)
+	if err != nil {
+		h.domainError(w, name, err)
+		return
+	}
+
+	// 驗證前該 Host 可能已被快取為默認域名，立即失效
+	h.hosts.forget(d.Name)
+
+	h.writeJSON(w, domainResponse(d), http.StatusOK)
+}
+
+// domainError 域名操作的錯誤映射
+//
+// 與 manageError 相同，他人的域名返回 404，避免枚舉
+func (h *Handler) domainError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidDomain):
+		h.errorJSON(w, "invalid domain name", http.StatusBadRequest)
+	case errors.Is(err, shortener.ErrDomainExists):
+		h.errorJSON(w, "domain already registered", http.StatusConflict)
+	case errors.Is(err, shortener.ErrTooManyDomains):
+		h.errorJSON(w, "too many domains", http.StatusConflict)
+	case errors.Is(err, shortener.ErrDomainNotFound):
+		h.errorJSON(w, "domain not found", http.StatusNotFound)
+	case errors.Is(err, shortener.ErrDomainUnverified):
+		h.errorJSON(w, "verification TXT record not found, check DNS and retry", http.StatusUnprocessableEntity)
+	default:
+		h.logger.Error("domain operation failed", "domain", name, "error", err)
+		h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// domainResponse 構建域名的響應體
+func domainResponse(d *shortener.Domain) map[string]any {
+	resp := map[string]any{
+		"name":       d.Name,
+		"verified":   d.IsVerified(),
+		"created_at": d.CreatedAt.Format(time.RFC3339),
+	}
+	if d.VerifiedAt != nil {
+		resp["verified_at"] = d.VerifiedAt.Format(time.RFC3339)
+	} else {
+		resp["verification"] = map[string]string{
+			"type":  "TXT",
+			"name":  d.ChallengeName(),
+			"value": d.ChallengeValue(),
+		}
+	}
+	return resp
+}
+
+// domainParam 讀取管理接口的 ?domain= 參數
+//
+// 未提供時為默認域名（""）；提供但格式錯誤時返回 ErrInvalidDomain
+func domainParam(r *http.Request) (string, error) {
+	v := r.URL.Query().Get("domain")
+	if v == "" {
+		return "", nil
+	}
+	return shortener.NormalizeDomain(v)
+}
+
+// domainFor 按請求的 Host 確定短碼所屬的域名
+//
+// 每次重定向都要調用，結果經 hostCache 快取，避免每次訪問多一次存儲查詢
+func (h *Handler) domainFor(r *http.Request) (string, error) {
+	name, err := shortener.NormalizeDomain(r.Host)
+	if err != nil {
+		return "", nil // IP、localhost 等：默認域名
+	}
+
+	if domain, ok := h.hosts.get(name); ok {
+		return domain, nil
+	}
+	domain, err := shortener.HostDomain(r.Context(), h.store, name)
+	if err != nil {
+		return "", err
+	}
+	h.hosts.set(name, domain)
+	return domain, nil
+}
+
+// hostCache 配置
+const (
+	hostCacheTTL  = time.Minute // 域名驗證狀態變化後最多延遲這麼久生效（本實例內驗證會立即失效）
+	hostCacheSize = 1024        // 上限：Host header 由客戶端控制，不設上限會被隨機 Host 撐爆
+)
+
+// hostCache Host → 域名的進程內快取（LRU + TTL）
+//
+// 系統設計考量：
+//   - 同時快取「不是自定義域名」的結果（值為 ""），默認域名的流量不打存儲
+//   - 滿了淘汰最久未使用的條目：隨機 Host 只用一次就沉到隊尾，
+//     持續有流量的真實域名留在前面，不會被一批垃圾 Host 整體清空
+//   - 多實例部署時，其他實例的快取要等 TTL 過期才能看到新驗證的域名
+type hostCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	capacity int
+	ll       *list.List               // 最近使用的在前
+	entries  map[string]*list.Element // Host → 鏈表節點
+}
+
+type hostEntry struct {
+	host      string
+	domain    string
+	expiresAt time.Time
+}
+
+func newHostCache(ttl time.Duration, capacity int) *hostCache {
+	return &hostCache{ttl: ttl, capacity: capacity, ll: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *hostCache) get(host string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[host]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*hostEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.ll.Remove(e)
+		delete(c.entries, host)
+		return "", false
+	}
+	c.ll.MoveToFront(e)
+	return entry.domain, true
+}
+
+func (c *hostCache) set(host, domain string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &hostEntry{host: host, domain: domain, expiresAt: time.Now().Add(c.ttl)}
+	if e, ok := c.entries[host]; ok {
+		e.Value = entry
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.entries[host] = c.ll.PushFront(entry)
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*hostEntry).host)
+	}
+}
+
+func (c *hostCache) forget(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[host]; ok {
+		c.ll.Remove(e)
+		delete(c.entries, host)
+	}
+}
+
+func (c *hostCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+func TestHostRouting(t *testing.T) {
+	srv := newTestServer(t, WithDomainVerifier(shortener.StubVerifier{}))
+	owner, apiKey := srv.register(t, "owner@example.com")
+	ctx := context.Background()
+
+	verified := time.Now()
+	for _, d := range []*shortener.Domain{
+		{Name: "go.brand.com", OwnerID: owner.ID, Token: "t1", CreatedAt: time.Now(), VerifiedAt: &verified},
+		{Name: "pending.brand.com", OwnerID: owner.ID, Token: "t2", CreatedAt: time.Now()},
+	} {
+		if err := srv.store.SaveDomain(ctx, d); err != nil {
+			t.Fatalf("SaveDomain(%s) error = %v", d.Name, err)
+		}
+	}
+	srv.save(t, "launch", nil)
+	for _, domain := range []string{"go.brand.com", "pending.brand.com"} {
+		srv.save(t, "launch", func(u *shortener.URL) {
+			u.Domain = domain
+			u.LongURL = "https://93.184.216.34/" + domain
+		})
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"go.brand.com", "https://93.184.216.34/go.brand.com"},
+		{"GO.Brand.com:8443", "https://93.184.216.34/go.brand.com"},
+		{"sho.rt", "https://93.184.216.34/launch"},            // 未註冊：默認域名
+		{"pending.brand.com", "https://93.184.216.34/launch"}, // 未驗證：默認域名
+		{"127.0.0.1:8080", "https://93.184.216.34/launch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			rec := srv.do("GET", "http://"+tt.host+"/launch", "")
+			if got := rec.Header().Get("Location"); got != tt.want {
+				t.Errorf("GET %s/launch Location = %q (status %d), want %q", tt.host, got, rec.Code, tt.want)
+			}
+		})
+	}
+
+	// 驗證通過後立即生效：本實例快取的「默認域名」結果被清除
+	rec := srv.do("POST", "/api/v1/domains/pending.brand.com/verify", apiKey)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST verify = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	rec = srv.do("GET", "http://pending.brand.com/launch", "")
+	if got := rec.Header().Get("Location"); got != "https://93.184.216.34/pending.brand.com" {
+		t.Errorf("GET pending.brand.com/launch after verify Location = %q, want the domain's link", got)
+	}
+}
+
+func TestHostCache(t *testing.T) {
+	c := newHostCache(time.Minute, 2)
+	c.set("a.example.com", "a.example.com")
+	c.set("b.example.com", "")
+	c.get("a.example.com")                  // a 變為最近使用
+	c.set("c.example.com", "c.example.com") // 淘汰最久未使用的 b
+
+	if _, ok := c.get("b.example.com"); ok {
+		t.Error("get(b) hit, want b evicted as least recently used")
+	}
+	if got, ok := c.get("a.example.com"); !ok || got != "a.example.com" {
+		t.Errorf("get(a) = %q, %v, want a kept", got, ok)
+	}
+
+	// 隨機 Host 洪水：條目數不超過上限，持續訪問的真實域名不被清空
+	c = newHostCache(time.Minute, 16)
+	c.set("go.brand.com", "go.brand.com")
+	for i := range 1000 {
+		c.set(fmt.Sprintf("random-%d.example.com", i), "")
+		c.get("go.brand.com")
+	}
+	if c.len() != 16 {
+		t.Errorf("len() = %d, want 16", c.len())
+	}
+	if _, ok := c.get("go.brand.com"); !ok {
+		t.Error("get(go.brand.com) missed after a flood of random hosts")
+	}
+
+	c.forget("go.brand.com")
+	if _, ok := c.get("go.brand.com"); ok {
+		t.Error("get() hit after forget()")
+	}
+
+	c = newHostCache(time.Millisecond, 16)
+	c.set("go.brand.com", "go.brand.com")
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.get("go.brand.com"); ok || c.len() != 0 {
+		t.Errorf("get() after TTL: len() = %d, want the entry expired and removed", c.len())
+	}
+}
@@ -25,11 +25,19 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/koopa0/system-design/03-url-shortener/internal/analytics"
+	"github.com/koopa0/system-design/03-url-shortener/internal/lifecycle"
+	"github.com/koopa0/system-design/03-url-shortener/internal/screening"
 	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/qr"
 	"github.com/koopa0/system-design/03-url-shortener/pkg/snowflake"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/useragent"
 )
 
 // Handler HTTP 處理器
@@ -42,15 +50,114 @@ type Handler struct {
 	store  shortener.Store
 	idgen  *snowflake.Generator
 	logger *slog.Logger
+
+	// 可選組件（通過 Option 注入）
+	clicks     *analytics.Pipeline  // 點擊事件管道
+	analytics  analytics.Store      // 點擊匯總查詢
+	screener   shortener.Screener   // 惡意 URL 篩查
+	flags      *screening.Registry  // 被標記鏈接的登記處
+	sweeper    *lifecycle.Sweeper   // 過期鏈接清理任務
+	cache      CacheReporter        // 快取層（健康檢查暴露命中統計）
+	geo        analytics.GeoLocator // 條件路由的國家查詢
+	adminToken string               // 管理接口 token（空則關閉管理接口）
+
+	verifier shortener.DomainVerifier // 自定義域名的所有權驗證（默認 DNS TXT）
+
+	qrCache *qr.Cache  // QR Code 渲染結果快取
+	hosts   *hostCache // Host → 域名映射快取
+}
+
+// Option 可選配置
+//
+// Go 慣用法（Functional Options）：
+//   - 必要依賴放在 New 的參數中
+//   - 可選組件通過 Option 注入，新增功能不破壞現有調用方
+type Option func(*Handler)
+
+// WithAnalytics 啟用點擊分析
+//
+//   - pipeline：重定向時提交點擊事件（異步）
+//   - store：統計接口查詢小時匯總
+func WithAnalytics(pipeline *analytics.Pipeline, store analytics.Store) Option {
+	return func(h *Handler) {
+		h.clicks = pipeline
+		h.analytics = store
+	}
+}
+
+// WithScreening 啟用惡意 URL 篩查
+//
+//   - screener：創建、修改、重定向時篩查目標
+//   - flags：記錄重定向時被攔截的鏈接（供管理接口查看）
+func WithScreening(screener shortener.Screener, flags *screening.Registry) Option {
+	return func(h *Handler) {
+		h.screener = screener
+		h.flags = flags
+	}
+}
+
+// WithAdminToken 設置管理接口 token
+func WithAdminToken(token string) Option {
+	return func(h *Handler) {
+		h.adminToken = token
+	}
+}
+
+// WithLifecycle 暴露過期清理任務的運行統計（管理接口）
+func WithLifecycle(sweeper *lifecycle.Sweeper) Option {
+	return func(h *Handler) {
+		h.sweeper = sweeper
+	}
+}
+
+// WithGeoIP 啟用按國家的條件路由
+//
+// 未配置時訪客國家未知，只有不限國家的規則會命中
+func WithGeoIP(geo analytics.GeoLocator) Option {
+	return func(h *Handler) {
+		h.geo = geo
+	}
+}
+
+// CacheReporter 快取運行統計的來源（*storage.RedisCache 實現）
+//
+// 只依賴 Stats：Handler 的讀寫都通過 shortener.Store，快取層對它透明
+type CacheReporter interface {
+	Stats() storage.CacheStats
+}
+
+// WithCache 在健康檢查中暴露快取統計（命中、未命中、空結果、請求合併）
+//
+// 快取層本身要作為 New 的 store 傳入，這裡只接入統計
+func WithCache(cache CacheReporter) Option {
+	return func(h *Handler) {
+		h.cache = cache
+	}
+}
+
+// WithDomainVerifier 替換自定義域名的驗證方式
+//
+// 本地開發沒有可控的公網 DNS 時，傳入 shortener.StubVerifier{} 跳過 TXT 查詢
+func WithDomainVerifier(verifier shortener.DomainVerifier) Option {
+	return func(h *Handler) {
+		h.verifier = verifier
+	}
 }
 
 // New 創建 Handler 實例
-func New(store shortener.Store, idgen *snowflake.Generator, logger *slog.Logger) *Handler {
-	return &Handler{
-		store:  store,
-		idgen:  idgen,
-		logger: logger,
+func New(store shortener.Store, idgen *snowflake.Generator, logger *slog.Logger, opts ...Option) *Handler {
+	h := &Handler{
+		store:    store,
+		idgen:    idgen,
+		logger:   logger,
+		verifier: shortener.DNSVerifier{},
+		qrCache:  qr.NewCache(0),
+		hosts:    newHostCache(hostCacheTTL, hostCacheSize),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // Routes 設置路由
@@ -65,16 +172,48 @@ func New(store shortener.Store, idgen *snowflake.Generator, logger *slog.Logger)
 func (h *Handler) Routes() http.Handler {
 	mux := http.NewServeMux()
 
-	// 創建短網址
-	mux.HandleFunc("POST /api/v1/urls", h.withMiddleware(h.create))
+	// 用戶註冊（返回 API Key）
+	mux.HandleFunc("POST /api/v1/users", h.withMiddleware(h.register))
+
+	// 創建短網址（需要 API Key）
+	mux.HandleFunc("POST /api/v1/urls", h.withMiddleware(h.requireAuth(h.create)))
+
+	// 批量創建短網址（JSON 或 CSV，需要 API Key）
+	mux.HandleFunc("POST /api/v1/urls/batch", h.withMiddleware(h.requireAuth(h.createBatch)))
+
+	// 列出當前用戶的短網址（需要 API Key）
+	mux.HandleFunc("GET /api/v1/urls", h.withMiddleware(h.requireAuth(h.listURLs)))
+
+	// 自定義域名：註冊、列表、DNS TXT 驗證（需要 API Key）
+	mux.HandleFunc("POST /api/v1/domains", h.withMiddleware(h.requireAuth(h.addDomain)))
+	mux.HandleFunc("GET /api/v1/domains", h.withMiddleware(h.requireAuth(h.listDomains)))
+	mux.HandleFunc("POST /api/v1/domains/{name}/verify", h.withMiddleware(h.requireAuth(h.verifyDomain)))
+
+	// 修改、停用、啟用、刪除（需要 API Key，只能操作自己的鏈接）
+	// 以下 /api/v1/urls/{shortCode}/... 接口用 ?domain= 指定自定義域名下的短碼
+	mux.HandleFunc("PATCH /api/v1/urls/{shortCode}", h.withMiddleware(h.requireAuth(h.update)))
+	mux.HandleFunc("POST /api/v1/urls/{shortCode}/disable", h.withMiddleware(h.requireAuth(h.disable)))
+	mux.HandleFunc("POST /api/v1/urls/{shortCode}/enable", h.withMiddleware(h.requireAuth(h.enable)))
+	mux.HandleFunc("DELETE /api/v1/urls/{shortCode}", h.withMiddleware(h.requireAuth(h.remove)))
 
 	// 重定向（核心功能）
 	// 注意：這裡不用 /api/v1 前綴，短網址應該儘量短
+	// 短碼所屬的域名由 Host header 決定（見 domainFor）
 	mux.HandleFunc("GET /{shortCode}", h.withMiddleware(h.redirect))
 
+	// 受密碼保護鏈接的密碼提交（表單）
+	mux.HandleFunc("POST /{shortCode}", h.withMiddleware(h.unlock))
+
 	// 獲取統計信息（可選）
 	mux.HandleFunc("GET /api/v1/urls/{shortCode}/stats", h.withMiddleware(h.stats))
 
+	// QR Code（印刷物料）
+	mux.HandleFunc("GET /api/v1/urls/{shortCode}/qr", h.withMiddleware(h.qrCode))
+
+	// 管理接口（需要管理員 token）
+	mux.HandleFunc("GET /api/v1/admin/flagged", h.withMiddleware(h.requireAdmin(h.flagged)))
+	mux.HandleFunc("GET /api/v1/admin/lifecycle", h.withMiddleware(h.requireAdmin(h.lifecycleStats)))
+
 	// 健康檢查
 	mux.HandleFunc("GET /health", h.health)
 
@@ -96,15 +235,30 @@ func (h *Handler) withMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 // create 創建短網址
 //
-// API: POST /api/v1/urls
-// Body: {"long_url": "https://...", "custom_code": "optional", "expires_at": "2024-12-31T..."}
+// API: POST /api/v1/urls（需要 API Key，創建的鏈接歸屬當前用戶）
+// Body: {"long_url": "https://...", "custom_code": "optional", "domain": "optional", "expires_at": "2024-12-31T..."}
+//
+// "domain"：在已驗證的自定義域名下創建（如 go.ourbrand.com/launch），短碼只需在該域名內唯一
+//
+// 可選的訪問限制：
+//   - "password"：訪問前需輸入密碼（服務端只保存 bcrypt 哈希）
+//   - "max_clicks"：點擊上限，用完後返回 410
+//   - "one_time": true：等同 "max_clicks": 1
+//
 // Response: {"short_url": "https://short.url/abc123", "short_code": "abc123", ...}
 func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 	// 1. 解析請求
 	var req struct {
 		LongURL    string  `json:"long_url"`
 		CustomCode string  `json:"custom_code,omitempty"`
+		Domain     string  `json:"domain,omitempty"`     // 自定義域名（可選）
 		ExpiresAt  *string `json:"expires_at,omitempty"` // RFC3339 格式
+
+		Rules []shortener.Rule `json:"rules,omitempty"` // 條件路由規則（可選）
+
+		Password  string `json:"password,omitempty"`   // 訪問密碼（可選）
+		MaxClicks int64  `json:"max_clicks,omitempty"` // 點擊上限（可選）
+		OneTime   bool   `json:"one_time,omitempty"`   // 一次性鏈接（可選）
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -118,6 +272,14 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.OneTime {
+		if req.MaxClicks != 0 && req.MaxClicks != 1 {
+			h.errorJSON(w, "one_time conflicts with max_clicks", http.StatusBadRequest)
+			return
+		}
+		req.MaxClicks = 1
+	}
+
 	// 3. 解析過期時間（如果有）
 	var expiresAt *time.Time
 	if req.ExpiresAt != nil {
@@ -133,18 +295,23 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 	//
 	// 注意：直接調用包級別函數，傳入依賴（store、idgen）
 	ctx := r.Context()
-	url, err := shortener.Shorten(ctx, h.store, h.idgen, req.LongURL, req.CustomCode, expiresAt)
+	url, err := shortener.Shorten(ctx, h.store, h.idgen, h.screener, shortener.ShortenRequest{
+		LongURL:    req.LongURL,
+		CustomCode: req.CustomCode,
+		Domain:     req.Domain,
+		ExpiresAt:  expiresAt,
+		OwnerID:    userFromContext(ctx).ID,
+		Rules:      req.Rules,
+		Password:   req.Password,
+		MaxClicks:  req.MaxClicks,
+	})
 	if err != nil {
 		// 錯誤處理：根據錯誤類型返回不同狀態碼
-		switch {
-		case errors.Is(err, shortener.ErrInvalidURL):
-			h.errorJSON(w, "invalid url format", http.StatusBadRequest)
-		case errors.Is(err, shortener.ErrCodeExists):
-			h.errorJSON(w, "custom code already exists", http.StatusConflict)
-		default:
+		msg, status := createError(err)
+		if status == http.StatusInternalServerError {
 			h.logger.Error("create short url failed", "error", err)
-			h.errorJSON(w, "internal server error", http.StatusInternalServerError)
 		}
+		h.errorJSON(w, msg, status)
 		return
 	}
 
@@ -153,17 +320,68 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 	// 系統設計考量：
 	//   - 返回完整的短網址（方便客戶端直接使用）
 	//   - 同時返回短碼（方便後續查詢統計）
+	h.writeJSON(w, h.urlResponse(r, url), http.StatusCreated)
+}
+
+// createError 創建短網址的錯誤映射（單條創建與批量創建共用）
+func createError(err error) (string, int) {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidURL):
+		return "invalid url format", http.StatusBadRequest
+	case errors.Is(err, shortener.ErrBlocked):
+		return "url is blocked by screening rules", http.StatusBadRequest
+	case errors.Is(err, shortener.ErrInvalidRules),
+		errors.Is(err, shortener.ErrInvalidPassword),
+		errors.Is(err, shortener.ErrInvalidMaxClicks),
+		errors.Is(err, shortener.ErrInvalidDomain),
+		errors.Is(err, shortener.ErrDomainNotFound),
+		errors.Is(err, shortener.ErrDomainUnverified):
+		return err.Error(), http.StatusBadRequest
+	case errors.Is(err, shortener.ErrCodeExists):
+		return "custom code already exists", http.StatusConflict
+	case errors.Is(err, shortener.ErrCodeReserved):
+		return "custom code was recently deleted and is reserved", http.StatusConflict
+	case errors.Is(err, shortener.ErrDuplicateInBatch):
+		return "custom code appears more than once in batch", http.StatusConflict
+	default:
+		return "internal server error", http.StatusInternalServerError
+	}
+}
+
+// urlResponse 構建短網址的 JSON 響應（創建與列表共用）
+func (h *Handler) urlResponse(r *http.Request, url *shortener.URL) map[string]any {
 	resp := map[string]any{
-		"short_url":  buildShortURL(r, url.ShortCode),
+		"short_url":  buildShortURL(r, url.Domain, url.ShortCode),
 		"short_code": url.ShortCode,
 		"long_url":   url.LongURL,
+		"clicks":     url.Clicks,
 		"created_at": url.CreatedAt.Format(time.RFC3339),
 	}
+	if url.Domain != "" {
+		resp["domain"] = url.Domain
+	}
 	if url.ExpiresAt != nil {
 		resp["expires_at"] = url.ExpiresAt.Format(time.RFC3339)
 	}
+	if url.Disabled {
+		resp["disabled"] = true
+	}
+	if len(url.Rules) > 0 {
+		resp["rules"] = url.Rules
+	}
+	addAccessFields(resp, url)
+	return resp
+}
 
-	h.writeJSON(w, resp, http.StatusCreated)
+// addAccessFields 添加訪問限制字段（密碼哈希本身從不返回）
+func addAccessFields(resp map[string]any, url *shortener.URL) {
+	if url.IsProtected() {
+		resp["password_protected"] = true
+	}
+	if url.MaxClicks > 0 {
+		resp["max_clicks"] = url.MaxClicks
+		resp["remaining_clicks"] = max(url.MaxClicks-url.Clicks, 0)
+	}
 }
 
 // redirect 重定向到長網址
@@ -175,6 +393,7 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 //   - 使用 302（臨時重定向）而非 301（永久重定向）
 //   - 為什麼？302 每次都經過服務器，可以統計點擊
 //   - 301 會被瀏覽器快取，後續訪問不經過服務器
+//   - 條件路由同理：同一短碼對不同訪客有不同目標，更不能被快取
 func (h *Handler) redirect(w http.ResponseWriter, r *http.Request) {
 	// 1. 獲取路徑參數（Go 1.22+ 功能）
 	shortCode := r.PathValue("shortCode")
@@ -183,26 +402,28 @@ func (h *Handler) redirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 2. 調用 shortener 包解析短碼
+	// 2. 按 Host 確定域名，調用 shortener 包解析短碼（按訪客特徵選擇目標）
 	ctx := r.Context()
-	longURL, err := shortener.Resolve(ctx, h.store, shortCode)
+	domain, err := h.domainFor(r)
 	if err != nil {
-		switch {
-		case errors.Is(err, shortener.ErrNotFound):
-			// 404 Not Found（短碼不存在）
-			h.errorJSON(w, "short code not found", http.StatusNotFound)
-		case errors.Is(err, shortener.ErrExpired):
-			// 410 Gone（URL 已過期）
-			// 使用 410 而非 404，語義更準確
-			h.errorJSON(w, "url expired", http.StatusGone)
-		default:
-			h.logger.Error("resolve short code failed", "short_code", shortCode, "error", err)
-			h.errorJSON(w, "internal server error", http.StatusInternalServerError)
-		}
+		h.resolveError(w, shortCode, err)
+		return
+	}
+	dest, err := shortener.Resolve(ctx, h.store, h.screener, domain, shortCode, h.visitor(r))
+	if err != nil {
+		h.resolveError(w, shortener.QualifiedCode(domain, shortCode), err)
 		return
 	}
 
-	// 3. 執行重定向
+	// 3. 提交點擊事件（非阻塞）
+	//
+	// 系統設計考量：
+	//   - 只拷貝 header 字段，UA 解析與 GeoIP 查詢在後台 worker 完成
+	//   - Track 在緩衝區滿時直接丟棄，不增加重定向延遲
+	//   - 記錄命中的變體，統計接口可比較各變體的點擊
+	h.trackClick(r, domain, shortCode, dest.Variant)
+
+	// 4. 執行重定向
 	//
 	// HTTP 狀態碼說明：
 	//   - 301 Moved Permanently：永久重定向（瀏覽器快取）
@@ -210,13 +431,83 @@ func (h *Handler) redirect(w http.ResponseWriter, r *http.Request) {
 	//   - 307 Temporary Redirect：臨時（保持 HTTP 方法）
 	//
 	// 我們選擇 302，因為需要統計每次點擊
-	http.Redirect(w, r, longURL, http.StatusFound) // 302
+	http.Redirect(w, r, dest.URL, http.StatusFound) // 302
+}
+
+// resolveError 解析短碼的錯誤映射（重定向與密碼提交共用）
+//
+// shortCode 用於日誌與標記登記，自定義域名下為帶域名的形式（見 shortener.QualifiedCode）
+func (h *Handler) resolveError(w http.ResponseWriter, shortCode string, err error) {
+	var flagged *shortener.FlaggedError
+	switch {
+	case errors.As(err, &flagged):
+		// 目標在創建後被標記
+		//   - warn：顯示警告頁，由訪客決定是否繼續
+		//   - block：451 Unavailable For Legal Reasons
+		h.flags.Record(shortCode, flagged.LongURL, flagged.Verdict)
+		h.logger.Warn("flagged link accessed", "short_code", shortCode, "rule", flagged.Verdict.Rule, "action", flagged.Verdict.Action)
+		if flagged.Verdict.Action == shortener.ActionWarn {
+			h.renderWarning(w, flagged.LongURL, flagged.Verdict.Reason)
+			return
+		}
+		h.errorJSON(w, "url blocked: "+flagged.Verdict.Reason, http.StatusUnavailableForLegalReasons)
+	case errors.Is(err, shortener.ErrPasswordRequired):
+		// 受密碼保護：顯示密碼輸入頁（提交到 POST /{shortCode}）
+		h.renderPassword(w, "", http.StatusOK)
+	case errors.Is(err, shortener.ErrWrongPassword):
+		h.renderPassword(w, "Incorrect password, please try again.", http.StatusUnauthorized)
+	case errors.Is(err, shortener.ErrNotFound):
+		// 404 Not Found（短碼不存在）
+		h.errorJSON(w, "short code not found", http.StatusNotFound)
+	case errors.Is(err, shortener.ErrExpired):
+		// 410 Gone（URL 已過期）
+		// 使用 410 而非 404，語義更準確
+		h.errorJSON(w, "url expired", http.StatusGone)
+	case errors.Is(err, shortener.ErrDisabled):
+		// 410 Gone（URL 已被擁有者停用）
+		h.errorJSON(w, "url disabled", http.StatusGone)
+	case errors.Is(err, shortener.ErrClickLimitReached):
+		// 410 Gone（點擊次數已用完，如一次性鏈接已被打開）
+		h.errorJSON(w, "url has reached its click limit", http.StatusGone)
+	default:
+		h.logger.Error("resolve short code failed", "short_code", shortCode, "error", err)
+		h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// visitor 從請求中提取條件路由所需的訪客特徵
+//
+// 系統設計考量：
+//   - 平台由 User-Agent 判斷（純字符串匹配，微秒級）
+//   - 國家由本地 GeoIP 資料庫查詢（內存二分查找，不發網絡請求）
+//   - 分流黏性鍵 = IP + User-Agent：無 Cookie 也能讓同一訪客落在同一變體
+//   - 只有命中需要國家條件的鏈接才真正用到查詢結果，但查詢足夠便宜，不做延遲計算
+func (h *Handler) visitor(r *http.Request) shortener.Visitor {
+	ip := clientIP(r)
+	v := shortener.Visitor{
+		Platform: useragent.DetectPlatform(r.UserAgent()),
+		Key:      ip + "|" + r.UserAgent(),
+	}
+	if h.geo != nil {
+		v.Country = h.geo.Country(ip)
+	}
+	return v
 }
 
 // stats 獲取統計信息
 //
-// API: GET /api/v1/urls/{shortCode}/stats
-// Response: {"short_code": "abc123", "long_url": "...", "clicks": 123, ...}
+// API: GET /api/v1/urls/{shortCode}/stats?from=2024-01-01T00:00:00Z&to=2024-01-08T00:00:00Z&domain=go.ourbrand.com
+// Response: {"short_code": "abc123", "long_url": "...", "clicks": 123, "breakdown": {...}, ...}
+//
+// breakdown（啟用點擊分析時）：
+//   - timeline：按小時的點擊數
+//   - referrers / countries / devices：各維度分布
+//   - variants：各路由規則 / A/B 變體的點擊數（無規則命中計入 "default"）
+//   - 默認時間範圍：最近 7 天；最長 90 天
+//
+// 統計接口無需認證：受密碼保護的鏈接不返回 long_url 與 rules
+//   - 否則任何人都能繞過密碼直接拿到目標
+//   - 所有者可通過 GET /api/v1/urls（需要 API Key）查看完整記錄
 func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
 	// 獲取路徑參數
 	shortCode := r.PathValue("shortCode")
@@ -225,9 +516,21 @@ func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 解析時間範圍與域名（先驗證參數，避免無效請求打到存儲層）
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	domain, err := domainParam(r)
+	if err != nil {
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 調用 shortener 包查詢統計信息
 	ctx := r.Context()
-	url, err := shortener.Stats(ctx, h.store, shortCode)
+	url, err := shortener.Stats(ctx, h.store, domain, shortCode)
 	if err != nil {
 		if errors.Is(err, shortener.ErrNotFound) {
 			h.errorJSON(w, "short code not found", http.StatusNotFound)
@@ -241,20 +544,99 @@ func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
 	// 構建響應
 	resp := map[string]any{
 		"short_code": url.ShortCode,
-		"long_url":   url.LongURL,
 		"clicks":     url.Clicks,
 		"created_at": url.CreatedAt.Format(time.RFC3339),
 	}
+	if !url.IsProtected() {
+		resp["long_url"] = url.LongURL
+		if len(url.Rules) > 0 {
+			resp["rules"] = url.Rules
+		}
+	}
+	if url.Domain != "" {
+		resp["domain"] = url.Domain
+	}
 	if url.ExpiresAt != nil {
 		resp["expires_at"] = url.ExpiresAt.Format(time.RFC3339)
 	}
+	addAccessFields(resp, url)
+
+	// 點擊分布（可選）
+	//
+	// 注意：clicks（總數）與 breakdown.total 可能不一致
+	//   - clicks：IncrementClicks 實時累加
+	//   - breakdown：管道每個 flush 週期寫入一次，且緩衝區滿時會丟棄
+	if h.analytics != nil {
+		breakdown, err := analytics.Query(ctx, h.analytics, domain, shortCode, from, to)
+		if err != nil {
+			h.logger.Error("query click breakdown failed", "short_code", shortCode, "error", err)
+			h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		resp["breakdown"] = breakdown
+	}
 
 	h.writeJSON(w, resp, http.StatusOK)
 }
 
+// maxStatsRange 統計查詢的最大時間範圍
+//
+// 防止一次查詢掃描過多匯總行（90 天 × 24 小時 × 維度組合）
+const maxStatsRange = 90 * 24 * time.Hour
+
+// parseTimeRange 解析統計查詢的時間範圍
+//
+// 參數（RFC3339，均可選）：
+//   - from：默認 to - 7 天
+//   - to：默認當前時間
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to format (use RFC3339)")
+		}
+		to = t.UTC()
+	}
+
+	from := to.Add(-7 * 24 * time.Hour)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from format (use RFC3339)")
+		}
+		from = t.UTC()
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	if to.Sub(from) > maxStatsRange {
+		return time.Time{}, time.Time{}, errors.New("time range exceeds 90 days")
+	}
+
+	// 匯總粒度為小時：from 向下取整，包含起始小時
+	return from.Truncate(time.Hour), to, nil
+}
+
 // health 健康檢查
+//
+// 啟用快取層 / 點擊分析時附帶各自的統計：
+//
+//	{"status": "ok", "cache": {"local_hits": 1200, "redis_hits": 300, "misses": 20, ...},
+//	 "analytics": {"tracked": 5000, "dropped": 0, "flushed": 4980, "failed": 0}}
+//
+// 統計是進程內計數（每個副本各自的值），重啟後清零；
+// dropped / failed 持續增長表示點擊數據在丟失（緩衝區太小或存儲寫入失敗）
 func (h *Handler) health(w http.ResponseWriter, r *http.Request) {
-	h.writeJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
+	resp := map[string]any{"status": "ok"}
+	if h.cache != nil {
+		resp["cache"] = h.cache.Stats()
+	}
+	if h.clicks != nil {
+		resp["analytics"] = h.clicks.Stats()
+	}
+	h.writeJSON(w, resp, http.StatusOK)
 }
 
 // === 工具函數 ===
@@ -280,19 +662,15 @@ func (h *Handler) errorJSON(w http.ResponseWriter, message string, status int) {
 // buildShortURL 構建完整的短網址
 //
 // 系統設計考量：
-//   - 生產環境應使用配置的域名（如 short.url）
-//   - 這裡簡化處理：使用請求的 Host
-//
-// buildShortURL 構建完整的短網址
-//
-// 系統設計考量：
+//   - 自定義域名的鏈接使用該域名（go.ourbrand.com/launch），與請求從哪個 Host 進來無關
+//   - 默認域名：生產環境應使用配置的域名（如 short.url），這裡簡化處理為請求的 Host
 //   - Scheme 檢測：支持反向代理場景
 //     → 優先檢查 X-Forwarded-Proto（代理轉發的原始協議）
 //     → 回退到 r.TLS（直連場景）
 //   - 部署場景：
 //     → 開發環境：直連（http://localhost:8080）
 //     → 生產環境：代理（nginx → https → 服務）
-func buildShortURL(r *http.Request, shortCode string) string {
+func buildShortURL(r *http.Request, domain, shortCode string) string {
 	// 檢查代理轉發的原始協議（常見於生產環境）
 	//
 	// 為什麼優先檢查 X-Forwarded-Proto？
@@ -307,7 +685,47 @@ func buildShortURL(r *http.Request, shortCode string) string {
 			scheme = "https"
 		}
 	}
-	return scheme + "://" + r.Host + "/" + shortCode
+	host := r.Host
+	if domain != "" {
+		host = domain
+	}
+	return scheme + "://" + host + "/" + shortCode
+}
+
+// trackClick 提交點擊事件到分析管道
+func (h *Handler) trackClick(r *http.Request, domain, shortCode, variant string) {
+	if h.clicks == nil {
+		return
+	}
+	h.clicks.Track(analytics.ClickEvent{
+		Domain:    domain,
+		ShortCode: shortCode,
+		Timestamp: time.Now(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Variant:   variant,
+	})
+}
+
+// clientIP 獲取客戶端 IP
+//
+// 系統設計考量：
+//   - 反向代理後 RemoteAddr 是代理的 IP，真實 IP 在 X-Forwarded-For
+//   - X-Forwarded-For 格式："client, proxy1, proxy2"，取第一個
+//   - ⚠️ 安全：X-Forwarded-For 可被客戶端偽造
+//     → 這裡只用於統計（偽造影響有限）
+//     → 用於限流、鑑權時必須只信任已知代理添加的部分
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // === 中間件 ===
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/analytics"
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/useragent"
+)
+
+func TestStatsProtected(t *testing.T) {
+	srv := newTestServer(t)
+	rules := func(u *shortener.URL) {
+		u.Rules = []shortener.Rule{{Name: "ios", Platforms: []useragent.Platform{useragent.IOS}, Target: "https://93.184.216.34/ios"}}
+	}
+	srv.save(t, "public", rules)
+	srv.save(t, "secret", func(u *shortener.URL) { rules(u); u.PasswordHash = "$2a$10$hash" })
+
+	tests := []struct {
+		code       string
+		wantTarget bool
+	}{
+		{"public", true},
+		{"secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			rec := srv.do("GET", "/api/v1/urls/"+tt.code+"/stats", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET stats = %d, want 200", rec.Code)
+			}
+			var body map[string]any
+			json.Unmarshal(rec.Body.Bytes(), &body)
+
+			_, hasURL := body["long_url"]
+			_, hasRules := body["rules"]
+			if hasURL != tt.wantTarget || hasRules != tt.wantTarget {
+				t.Errorf("stats = %v, want long_url and rules present = %v", body, tt.wantTarget)
+			}
+			if strings.Contains(rec.Body.String(), "$2a$") {
+				t.Errorf("stats leaks the password hash: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	_, err := shortener.Shorten(ctx, srv.store, srv.idgen, nil, shortener.ShortenRequest{LongURL: "https://93.184.216.34/doc", CustomCode: "secret", Password: "hunter22"})
+	if err != nil {
+		t.Fatalf("Shorten() error = %v", err)
+	}
+
+	// GET 顯示密碼輸入頁，不重定向
+	rec := srv.do("GET", "/secret", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+		t.Errorf("GET /secret = %d (Location %q), want the password page", rec.Code, rec.Header().Get("Location"))
+	}
+
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"", http.StatusOK},
+		{"wrong", http.StatusUnauthorized},
+		{"hunter22", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"password": {tt.password}}
+		req := httptest.NewRequest("POST", "/secret", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("POST /secret password=%q = %d, want %d", tt.password, rec.Code, tt.want)
+		}
+		if tt.want == http.StatusSeeOther && rec.Header().Get("Location") != "https://93.184.216.34/doc" {
+			t.Errorf("Location = %q", rec.Header().Get("Location"))
+		}
+	}
+}
+
+// stubCache 固定返回統計的 CacheReporter
+type stubCache storage.CacheStats
+
+func (c stubCache) Stats() storage.CacheStats { return storage.CacheStats(c) }
+
+func TestHealthCacheStats(t *testing.T) {
+	rec := newTestServer(t).do("GET", "/health", "")
+	if strings.Contains(rec.Body.String(), "cache") {
+		t.Errorf("health without cache = %s, want no cache stats", rec.Body.String())
+	}
+
+	rec = newTestServer(t, WithCache(stubCache{RedisHits: 3, Misses: 1})).do("GET", "/health", "")
+	var body struct {
+		Status string             `json:"status"`
+		Cache  storage.CacheStats `json:"cache"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body.Status != "ok" || body.Cache.RedisHits != 3 || body.Cache.Misses != 1 {
+		t.Errorf("health = %s, want cache stats", rec.Body.String())
+	}
+}
+
+func TestHealthAnalyticsStats(t *testing.T) {
+	store := storage.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pipeline := analytics.NewPipeline(store, nil, logger, analytics.PipelineConfig{BufferSize: 1})
+	pipeline.Track(analytics.ClickEvent{ShortCode: "abc"})
+	pipeline.Track(analytics.ClickEvent{ShortCode: "abc"}) // 未啟動 worker：緩衝區滿，丟棄
+
+	rec := newTestServer(t, WithAnalytics(pipeline, store)).do("GET", "/health", "")
+	var body struct {
+		Analytics analytics.PipelineStats `json:"analytics"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body.Analytics != (analytics.PipelineStats{Tracked: 1, Dropped: 1}) {
+		t.Errorf("health = %s, want tracked 1 and dropped 1", rec.Body.String())
+	}
+}
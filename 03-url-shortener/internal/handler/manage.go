@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// update 修改短網址的目標、過期時間或路由規則
+//
+// API: PATCH /api/v1/urls/{shortCode}（自定義域名下的短碼：?domain=go.ourbrand.com）
+// Body: {"long_url": "https://...", "expires_at": "2025-01-01T00:00:00Z", "rules": [...]}
+//
+// PATCH 語義（JSON Merge Patch 風格）：
+//   - 字段缺失：不修改
+//   - "expires_at": null：移除過期時間（永不過期）
+//   - "rules": null 或 []：清除所有路由規則；非空數組整體替換（不做逐條合併）
+//   - "password": null 或 ""：移除密碼；"max_clicks": null 或 0：取消點擊上限
+func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
+	shortCode := r.PathValue("shortCode")
+	domain, err := domainParam(r)
+	if err != nil {
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 解析為 RawMessage，以區分「缺失」與「null」
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.errorJSON(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var req shortener.UpdateRequest
+	if raw, ok := body["long_url"]; ok {
+		var longURL string
+		if err := json.Unmarshal(raw, &longURL); err != nil || longURL == "" {
+			h.errorJSON(w, "long_url must be a non-empty string", http.StatusBadRequest)
+			return
+		}
+		req.LongURL = &longURL
+	}
+	if raw, ok := body["expires_at"]; ok {
+		if bytes.Equal(raw, []byte("null")) {
+			req.ClearExpiry = true
+		} else {
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				h.errorJSON(w, "invalid expires_at format (use RFC3339)", http.StatusBadRequest)
+				return
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				h.errorJSON(w, "invalid expires_at format (use RFC3339)", http.StatusBadRequest)
+				return
+			}
+			req.ExpiresAt = &t
+		}
+	}
+	if raw, ok := body["rules"]; ok {
+		var rules []shortener.Rule
+		if err := json.Unmarshal(raw, &rules); err != nil {
+			h.errorJSON(w, "rules must be an array of routing rules", http.StatusBadRequest)
+			return
+		}
+		if rules == nil {
+			rules = []shortener.Rule{}
+		}
+		req.Rules = &rules
+	}
+	if raw, ok := body["password"]; ok {
+		var password string
+		if !bytes.Equal(raw, []byte("null")) {
+			if err := json.Unmarshal(raw, &password); err != nil {
+				h.errorJSON(w, "password must be a string", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Password = &password
+	}
+	if raw, ok := body["max_clicks"]; ok {
+		var maxClicks int64
+		if !bytes.Equal(raw, []byte("null")) {
+			if err := json.Unmarshal(raw, &maxClicks); err != nil {
+				h.errorJSON(w, "max_clicks must be an integer", http.StatusBadRequest)
+				return
+			}
+		}
+		req.MaxClicks = &maxClicks
+	}
+	if req.LongURL == nil && req.ExpiresAt == nil && !req.ClearExpiry && req.Rules == nil &&
+		req.Password == nil && req.MaxClicks == nil {
+		h.errorJSON(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	url, err := shortener.Update(r.Context(), h.store, h.screener, userFromContext(r.Context()), domain, shortCode, req)
+	if err != nil {
+		h.manageError(w, shortCode, err)
+		return
+	}
+
+	h.writeJSON(w, h.urlResponse(r, url), http.StatusOK)
+}
+
+// disable 停用短網址
+//
+// API: POST /api/v1/urls/{shortCode}/disable
+func (h *Handler) disable(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// enable 重新啟用短網址
+//
+// API: POST /api/v1/urls/{shortCode}/enable
+func (h *Handler) enable(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	shortCode := r.PathValue("shortCode")
+	domain, err := domainParam(r)
+	if err != nil {
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	url, err := shortener.SetDisabled(r.Context(), h.store, userFromContext(r.Context()), domain, shortCode, disabled)
+	if err != nil {
+		h.manageError(w, shortCode, err)
+		return
+	}
+
+	h.writeJSON(w, h.urlResponse(r, url), http.StatusOK)
+}
+
+// remove 刪除短網址
+//
+// API: DELETE /api/v1/urls/{shortCode}
+// Response: 204 No Content
+//
+// 刪除後短碼進入冷卻期（shortener.TombstoneCooldown），期間不可被重新註冊
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request) {
+	shortCode := r.PathValue("shortCode")
+	domain, err := domainParam(r)
+	if err != nil {
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := shortener.Delete(r.Context(), h.store, userFromContext(r.Context()), domain, shortCode); err != nil {
+		h.manageError(w, shortCode, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// manageError 管理操作的錯誤映射
+//
+// 為什麼 ErrForbidden 返回 404 而不是 403？
+//   - 返回 403 等於告訴攻擊者「這個短碼存在，只是不屬於你」
+//   - 返回 404 避免通過管理接口枚舉他人的短碼
+func (h *Handler) manageError(w http.ResponseWriter, shortCode string, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrNotFound), errors.Is(err, shortener.ErrForbidden):
+		h.errorJSON(w, "short code not found", http.StatusNotFound)
+	case errors.Is(err, shortener.ErrInvalidURL):
+		h.errorJSON(w, "invalid url format", http.StatusBadRequest)
+	case errors.Is(err, shortener.ErrBlocked):
+		h.errorJSON(w, "url is blocked by screening rules", http.StatusBadRequest)
+	case errors.Is(err, shortener.ErrInvalidRules),
+		errors.Is(err, shortener.ErrInvalidPassword),
+		errors.Is(err, shortener.ErrInvalidMaxClicks):
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error("manage short url failed", "short_code", shortCode, "error", err)
+		h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// 面向訪客的 HTML 頁面
+//
+// 為什麼用 html/template 而不是 text/template？
+//   - 自動按上下文轉義（HTML、屬性、URL）
+//   - 目標 URL 來自用戶輸入，必須防止 XSS（如 "javascript:" 或注入標籤）
+
+// warningPage 可疑鏈接的警告頁（interstitial）
+//
+// 設計考量：
+//   - 不自動跳轉：由訪客明確點擊「繼續」
+//   - rel="noreferrer"：不把短鏈信息洩漏給可疑目標
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Warning: suspicious link</title>
+</head>
+<body>
+<h1>This link may be unsafe</h1>
+<p>The destination has been flagged: {{.Reason}}.</p>
+<p>Destination: <code>{{.LongURL}}</code></p>
+<p><a href="{{.LongURL}}" rel="noreferrer noopener">Continue anyway</a></p>
+</body>
+</html>
+`))
+
+// passwordPage 受密碼保護鏈接的密碼輸入頁
+//
+// 設計考量：
+//   - 表單提交到當前地址（POST /{shortCode}），密碼不出現在 URL 和訪問日誌中
+//   - 目標 URL 不出現在頁面上：未驗證的訪客不應得知目標
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<h1>This link is password protected</h1>
+{{if .Message}}<p role="alert">{{.Message}}</p>{{end}}
+<form method="post">
+<label>Password <input type="password" name="password" autocomplete="current-password" required autofocus></label>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// renderPassword 渲染密碼輸入頁
+//
+// 狀態碼：首次訪問 200；密碼錯誤 401
+// X-Frame-Options: DENY：防止密碼表單被嵌入第三方頁面（點擊劫持）
+func (h *Handler) renderPassword(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	data := struct{ Message string }{message}
+	if err := passwordPage.Execute(w, data); err != nil {
+		h.logger.Error("render password page failed", "error", err)
+	}
+}
+
+// renderWarning 渲染警告頁
+//
+// 狀態碼 200：這是正常的頁面響應，不是錯誤
+// Cache-Control: no-store：黑名單可能很快更新，不應被快取
+func (h *Handler) renderWarning(w http.ResponseWriter, longURL, reason string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	data := struct{ LongURL, Reason string }{longURL, reason}
+	if err := warningPage.Execute(w, data); err != nil {
+		h.logger.Error("render warning page failed", "error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/qr"
+)
+
+// qrCode 生成短網址的 QR Code
+//
+// API: GET /api/v1/urls/{shortCode}/qr?size=256&format=png&level=M&margin=4&fg=000000&bg=ffffff&domain=go.ourbrand.com
+//
+// 參數（均可選）：
+//   - size：邊長像素（64-2048，默認 256）
+//   - format：png | svg（默認 png）
+//   - level：容錯等級 L | M | Q | H（默認 M；印刷品建議 Q）
+//   - margin：靜區寬度，單位為模塊（0-16，默認 4）
+//   - fg / bg：前景、背景顏色（RRGGBB）
+//   - domain：自定義域名下的短碼（編碼內容使用該域名）
+//
+// 系統設計考量：
+//   - 編碼內容是 buildShortURL 的結果：掃碼也經過重定向，點擊照常統計
+//   - 可用性與重定向一致（shortener.CheckAvailable）：不為已過期、停用、用完次數或被標記的鏈接生成圖片
+//   - 受密碼保護的鏈接只對所有者生成（需要 API Key）：密碼頁不應被印刷物料公開分發
+//   - 快取鍵 = 短網址 + 渲染參數；渲染結果只受 LRU 淘汰（圖片本身不隨鏈接狀態變化）
+//   - HTTP 快取見 qrCacheControl：鏈接隨時可能被停用或刪除，瀏覽器與 CDN 只快取很短時間
+func (h *Handler) qrCode(w http.ResponseWriter, r *http.Request) {
+	shortCode := r.PathValue("shortCode")
+
+	// 1. 解析參數（先驗證，避免無效請求打到存儲層）
+	opts, err := parseQROptions(r.URL.Query())
+	if err != nil {
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	domain, err := domainParam(r)
+	if err != nil {
+		h.errorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 2. 確認鏈接存在且可訪問（與重定向使用同一檢查）
+	ctx := r.Context()
+	qualified := shortener.QualifiedCode(domain, shortCode)
+	url, err := h.store.Load(ctx, domain, shortCode)
+	if err == nil {
+		err = shortener.CheckAvailable(url)
+	}
+	if err != nil {
+		h.resolveError(w, qualified, err)
+		return
+	}
+
+	// 目標在創建後被標記：不再生成新的印刷物料（warn 同樣拒絕，圖片無法承載警告頁）
+	if h.screener != nil {
+		verdict, err := h.screener.Screen(ctx, url.LongURL)
+		if err != nil {
+			h.logger.Error("screen url for qr failed", "short_code", qualified, "error", err)
+			h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if verdict.Action != shortener.ActionAllow {
+			h.errorJSON(w, "url blocked: "+verdict.Reason, http.StatusUnavailableForLegalReasons)
+			return
+		}
+	}
+
+	if url.IsProtected() {
+		h.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			// 非所有者返回 404（同 manageError：不暴露短碼是否存在）
+			if userFromContext(r.Context()).ID != url.OwnerID {
+				h.errorJSON(w, "short code not found", http.StatusNotFound)
+				return
+			}
+			h.writeQR(w, r, url, opts)
+		})(w, r)
+		return
+	}
+	h.writeQR(w, r, url, opts)
+}
+
+// qrMaxAge 可公開快取的 QR Code 在瀏覽器與 CDN 中的最長快取時間
+//
+// 為什麼不是一天？
+//   - 所有者隨時可以停用或刪除鏈接，之後不應再分發它的 QR Code
+//   - 伺服器端有渲染快取，重新請求的代價只是一次存儲查詢
+const qrMaxAge = 5 * time.Minute
+
+// writeQR 渲染（或從快取取出）QR Code 並寫入響應
+func (h *Handler) writeQR(w http.ResponseWriter, r *http.Request, url *shortener.URL, opts qr.Options) {
+	content := buildShortURL(r, url.Domain, url.ShortCode)
+	key := content + "|" + opts.Key()
+
+	data, ok := h.qrCache.Get(key)
+	if !ok {
+		var err error
+		data, err = qr.Render(content, opts)
+		if err != nil {
+			if errors.Is(err, qr.ErrInvalidSize) {
+				h.errorJSON(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.logger.Error("render qr code failed", "short_code", url.ShortCode, "error", err)
+			h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		h.qrCache.Add(key, data)
+	}
+
+	w.Header().Set("Content-Type", opts.Format.ContentType())
+	w.Header().Set("Content-Disposition", `inline; filename="`+url.ShortCode+"."+string(opts.Format)+`"`)
+	w.Header().Set("Cache-Control", qrCacheControl(url))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// qrCacheControl QR Code 響應的 Cache-Control
+//
+//   - 受密碼保護：private, no-store（按所有者認證返回，共享快取不能保存）
+//   - 限次鏈接：no-store（何時用完無法預測）
+//   - 其餘：public，max-age 取 qrMaxAge 與剩餘有效期的較小值
+func qrCacheControl(url *shortener.URL) string {
+	switch {
+	case url.IsProtected():
+		return "private, no-store"
+	case url.MaxClicks > 0:
+		return "no-store"
+	}
+
+	maxAge := qrMaxAge
+	if url.ExpiresAt != nil {
+		maxAge = min(maxAge, time.Until(*url.ExpiresAt))
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+}
+
+// parseQROptions 解析 QR Code 查詢參數（缺失的參數使用默認值）
+func parseQROptions(query url.Values) (qr.Options, error) {
+	opts := qr.DefaultOptions()
+
+	if v := query.Get("format"); v != "" {
+		opts.Format = qr.Format(v)
+	}
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, qr.ErrInvalidSize
+		}
+		opts.Size = size
+	}
+	if v := query.Get("level"); v != "" {
+		level, err := qr.ParseLevel(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Level = level
+	}
+	if v := query.Get("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, qr.ErrInvalidMargin
+		}
+		opts.Margin = margin
+	}
+	if v := query.Get("fg"); v != "" {
+		c, err := qr.ParseColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Foreground = c
+	}
+	if v := query.Get("bg"); v != "" {
+		c, err := qr.ParseColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Background = c
+	}
+
+	return opts, opts.Validate()
+}
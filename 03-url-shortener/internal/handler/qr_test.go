@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/snowflake"
+)
+
+// testServer 基於內存存儲的 Handler（直接寫存儲準備數據）
+type testServer struct {
+	store   *storage.Memory
+	handler http.Handler
+	idgen   *snowflake.Generator
+}
+
+func newTestServer(t *testing.T, opts ...Option) *testServer {
+	t.Helper()
+	idgen, err := snowflake.NewGenerator(1)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	store := storage.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &testServer{store: store, handler: New(store, idgen, logger, opts...).Routes(), idgen: idgen}
+}
+
+// save 寫入一條短網址，modify 可修改默認字段
+func (s *testServer) save(t *testing.T, code string, modify func(*shortener.URL)) {
+	t.Helper()
+	url := &shortener.URL{ID: time.Now().UnixNano(), ShortCode: code, LongURL: "https://93.184.216.34/" + code, CreatedAt: time.Now()}
+	if modify != nil {
+		modify(url)
+	}
+	if err := s.store.Save(context.Background(), url); err != nil {
+		t.Fatalf("Save(%s) error = %v", code, err)
+	}
+}
+
+// register 創建用戶，返回用戶與 API Key
+func (s *testServer) register(t *testing.T, email string) (*shortener.User, string) {
+	t.Helper()
+	user, apiKey, err := shortener.Register(context.Background(), s.store, s.idgen, email)
+	if err != nil {
+		t.Fatalf("Register(%s) error = %v", email, err)
+	}
+	return user, apiKey
+}
+
+// do 發送請求；apiKey 非空時帶上 Authorization
+func (s *testServer) do(method, target, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestQRCodeAvailability(t *testing.T) {
+	srv := newTestServer(t, WithScreening(blockScreener{"93.184.216.34/flagged"}, nil))
+	past := time.Now().Add(-time.Hour)
+
+	srv.save(t, "live", nil)
+	srv.save(t, "expired", func(u *shortener.URL) { u.ExpiresAt = &past })
+	srv.save(t, "disabled", func(u *shortener.URL) { u.Disabled = true })
+	srv.save(t, "used", func(u *shortener.URL) { u.MaxClicks = 1; u.Clicks = 1 })
+	srv.save(t, "flagged", nil)
+
+	tests := []struct {
+		code string
+		want int
+	}{
+		{"live", http.StatusOK},
+		{"missing", http.StatusNotFound},
+		{"expired", http.StatusGone},
+		{"disabled", http.StatusGone},
+		{"used", http.StatusGone},
+		{"flagged", http.StatusUnavailableForLegalReasons},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			rec := srv.do("GET", "/api/v1/urls/"+tt.code+"/qr?format=svg", "")
+			if rec.Code != tt.want {
+				t.Errorf("GET qr for %s = %d, want %d", tt.code, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestQRCodeProtected(t *testing.T) {
+	srv := newTestServer(t)
+	owner, ownerKey := srv.register(t, "owner@example.com")
+	_, otherKey := srv.register(t, "other@example.com")
+	srv.save(t, "secret", func(u *shortener.URL) { u.OwnerID = owner.ID; u.PasswordHash = "$2a$10$hash" })
+
+	tests := []struct {
+		name   string
+		apiKey string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"other user", otherKey, http.StatusNotFound},
+		{"owner", ownerKey, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := srv.do("GET", "/api/v1/urls/secret/qr?format=svg", tt.apiKey)
+			if rec.Code != tt.want {
+				t.Fatalf("GET qr = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && rec.Header().Get("Cache-Control") != "private, no-store" {
+				t.Errorf("Cache-Control = %q, want private, no-store", rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestQRCacheControl(t *testing.T) {
+	soon := time.Now().Add(time.Minute)
+	later := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name string
+		url  shortener.URL
+		want string
+	}{
+		{"permanent", shortener.URL{}, "public, max-age=300"},
+		{"expires later", shortener.URL{ExpiresAt: &later}, "public, max-age=300"},
+		{"expires soon", shortener.URL{ExpiresAt: &soon}, "public, max-age=59"},
+		{"click limit", shortener.URL{MaxClicks: 10}, "no-store"},
+		{"protected", shortener.URL{PasswordHash: "x", MaxClicks: 10}, "private, no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := qrCacheControl(&tt.url); got != tt.want {
+				t.Errorf("qrCacheControl() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// blockScreener 攔截包含指定子串的目標
+type blockScreener []string
+
+func (s blockScreener) Screen(ctx context.Context, rawURL string) (shortener.Verdict, error) {
+	for _, pattern := range s {
+		if strings.Contains(rawURL, pattern) {
+			return shortener.Verdict{Action: shortener.ActionBlock, Rule: "test:" + pattern, Reason: "test"}, nil
+		}
+	}
+	return shortener.Verdict{}, nil
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// maxUnlockBody 密碼表單的最大請求體（密碼最長 72 字節，留足表單編碼餘量）
+const maxUnlockBody = 4 << 10
+
+// unlock 提交密碼並重定向
+//
+// API: POST /{shortCode}
+// Body: application/x-www-form-urlencoded，password=...
+// Response: 303 See Other, Location: https://...（密碼錯誤時返回 401 與密碼輸入頁）
+//
+// 系統設計考量：
+//   - 303 而非 302：明確要求瀏覽器用 GET 訪問目標（不重放表單）
+//   - 每次提交都執行一次 bcrypt 比較（約 50-100ms），天然限制暴力破解速度
+//   - 驗證通過後不發 Cookie：限次鏈接每次打開都要重新驗證並計數，語義最簡單
+//   - 生產環境應再按 IP + 短碼限流（如每分鐘 10 次），防止分布式猜測
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request) {
+	shortCode := r.PathValue("shortCode")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockBody)
+	if err := r.ParseForm(); err != nil {
+		h.errorJSON(w, "invalid form body", http.StatusBadRequest)
+		return
+	}
+
+	domain, err := h.domainFor(r)
+	if err != nil {
+		h.resolveError(w, shortCode, err)
+		return
+	}
+
+	visitor := h.visitor(r)
+	visitor.Password = r.PostForm.Get("password")
+
+	dest, err := shortener.Resolve(r.Context(), h.store, h.screener, domain, shortCode, visitor)
+	if err != nil {
+		h.resolveError(w, shortener.QualifiedCode(domain, shortCode), err)
+		return
+	}
+
+	h.trackClick(r, domain, shortCode, dest.Variant)
+	http.Redirect(w, r, dest.URL, http.StatusSeeOther) // 303
+}
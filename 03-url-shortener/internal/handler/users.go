@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// userContextKey context 中存放已認證用戶的鍵
+//
+// Go 慣用法：使用未導出的類型作為 key，避免與其他包衝突
+type userContextKey struct{}
+
+// userFromContext 取出已認證的用戶（由 requireAuth 設置）
+func userFromContext(ctx context.Context) *shortener.User {
+	user, _ := ctx.Value(userContextKey{}).(*shortener.User)
+	return user
+}
+
+// requireAuth 認證中間件
+//
+// 支持兩種傳遞方式：
+//   - Authorization: Bearer sk_xxx（標準方式）
+//   - X-API-Key: sk_xxx（便於 curl 測試）
+//
+// 認證成功後將用戶放入 context，下游 handler 用 userFromContext 取出
+func (h *Handler) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			apiKey, _ = strings.CutPrefix(auth, "Bearer ")
+		}
+		if apiKey == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			h.errorJSON(w, "api key required", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := shortener.Authenticate(r.Context(), h.store, apiKey)
+		if err != nil {
+			if errors.Is(err, shortener.ErrUnauthorized) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				h.errorJSON(w, "invalid api key", http.StatusUnauthorized)
+				return
+			}
+			h.logger.Error("authenticate failed", "error", err)
+			h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey{}, user)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// register 註冊用戶
+//
+// API: POST /api/v1/users
+// Body: {"email": "team@example.com"}
+// Response: {"id": "...", "email": "...", "api_key": "sk_..."}
+//
+// 注意：api_key 只在這裡返回一次，服務端只保存哈希
+func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.errorJSON(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, apiKey, err := shortener.Register(r.Context(), h.store, h.idgen, req.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, shortener.ErrInvalidEmail):
+			h.errorJSON(w, "invalid email format", http.StatusBadRequest)
+		case errors.Is(err, shortener.ErrUserExists):
+			h.errorJSON(w, "user already exists", http.StatusConflict)
+		default:
+			h.logger.Error("register user failed", "error", err)
+			h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// ID 以字符串返回：Snowflake ID 超過 JavaScript Number 的安全整數範圍（2^53）
+	h.writeJSON(w, map[string]any{
+		"id":         strconv.FormatInt(user.ID, 10),
+		"email":      user.Email,
+		"api_key":    apiKey,
+		"created_at": user.CreatedAt.Format(time.RFC3339),
+	}, http.StatusCreated)
+}
+
+// 分頁參數
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// listURLs 列出當前用戶的短網址
+//
+// API: GET /api/v1/urls?limit=20&cursor=...
+// Response: {"urls": [...], "next_cursor": "..."}
+//
+// next_cursor 為空表示沒有更多數據
+func (h *Handler) listURLs(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	limit := defaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			h.errorJSON(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var cursor int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			h.errorJSON(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = n
+	}
+
+	urls, next, err := shortener.ListLinks(r.Context(), h.store, user.ID, cursor, limit)
+	if err != nil {
+		h.logger.Error("list urls failed", "owner_id", user.ID, "error", err)
+		h.errorJSON(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]map[string]any, 0, len(urls))
+	for _, url := range urls {
+		items = append(items, h.urlResponse(r, url))
+	}
+
+	resp := map[string]any{"urls": items, "next_cursor": ""}
+	if next != 0 {
+		resp["next_cursor"] = strconv.FormatInt(next, 10)
+	}
+	h.writeJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+func TestRegisterHandler(t *testing.T) {
+	srv := newTestServer(t)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/users", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"email": "team@example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/users = %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		ID     string `json:"id"`
+		Email  string `json:"email"`
+		APIKey string `json:"api_key"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if _, err := strconv.ParseInt(body.ID, 10, 64); err != nil || body.Email != "team@example.com" {
+		t.Errorf("register = %s, want a string ID and the email", rec.Body.String())
+	}
+	// 返回的 Key 可以直接用於認證
+	if rec := srv.do("GET", "/api/v1/urls", body.APIKey); rec.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/urls with the new key = %d, want 200", rec.Code)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"duplicate", `{"email": "team@example.com"}`, http.StatusConflict},
+		{"invalid email", `{"email": "team"}`, http.StatusBadRequest},
+		{"invalid body", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.body); rec.Code != tt.want {
+				t.Errorf("POST %s = %d, want %d", tt.body, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	srv := newTestServer(t)
+	_, apiKey := srv.register(t, "team@example.com")
+	other, err := shortener.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		want      int
+		challenge string
+	}{
+		{"missing", "", "", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"unknown key", "Authorization", "Bearer " + other, http.StatusUnauthorized, `Bearer realm="api", error="invalid_token"`},
+		{"not a bearer token", "Authorization", "Basic " + apiKey, http.StatusUnauthorized, `Bearer realm="api", error="invalid_token"`},
+		{"bearer", "Authorization", "Bearer " + apiKey, http.StatusOK, ""},
+		{"x-api-key", "X-API-Key", apiKey, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/urls", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			srv.handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("GET /api/v1/urls = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+		})
+	}
+}
+
+// TestListURLs 按 next_cursor 翻頁，只列出當前用戶的短網址。
+func TestListURLs(t *testing.T) {
+	srv := newTestServer(t)
+	user, apiKey := srv.register(t, "team@example.com")
+	other, _ := srv.register(t, "other@example.com")
+	for i, code := range []string{"a", "b", "c"} {
+		srv.save(t, code, func(u *shortener.URL) { u.ID, u.OwnerID = int64(100+i), user.ID })
+	}
+	srv.save(t, "theirs", func(u *shortener.URL) { u.OwnerID = other.ID })
+
+	type page struct {
+		URLs []struct {
+			ShortCode string `json:"short_code"`
+		} `json:"urls"`
+		NextCursor string `json:"next_cursor"`
+	}
+	list := func(query string) page {
+		t.Helper()
+		rec := srv.do("GET", "/api/v1/urls"+query, apiKey)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/v1/urls%s = %d, want 200", query, rec.Code)
+		}
+		var p page
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		return p
+	}
+	codes := func(p page) []string {
+		var codes []string
+		for _, u := range p.URLs {
+			codes = append(codes, u.ShortCode)
+		}
+		return codes
+	}
+
+	first := list("?limit=2")
+	if got := codes(first); !slices.Equal(got, []string{"c", "b"}) || first.NextCursor != "101" {
+		t.Fatalf("first page = %v, next %q; want [c b] and next 101", got, first.NextCursor)
+	}
+	second := list("?limit=2&cursor=" + first.NextCursor)
+	if got := codes(second); !slices.Equal(got, []string{"a"}) || second.NextCursor != "" {
+		t.Errorf("second page = %v, next %q; want [a] and no next page", got, second.NextCursor)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?limit=x", "?cursor=0", "?cursor=-1", "?cursor=x"} {
+		if rec := srv.do("GET", "/api/v1/urls"+query, apiKey); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/v1/urls%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
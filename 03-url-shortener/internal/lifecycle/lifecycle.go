@@ -0,0 +1,66 @@
+// Package lifecycle 實現短網址的生命週期管理（過期清理、短碼回收）
+//
+// 為什麼需要主動清理？
+//   - Resolve 只做惰性檢查：過期鏈接返回 410，但記錄永遠留在 PostgreSQL 和 Redis
+//   - 表越大，索引越大，熱數據命中率越低
+//   - 過期鏈接佔用的短碼永遠無法被重新使用
+//
+// 生命週期：
+//
+//	活躍 ──(expires_at)──▶ 過期（惰性 410，寬限期內可被所有者延期）
+//	     ──(寬限期結束)──▶ 清理：刪除或歸檔 + 寫墓碑 + 清快取
+//	     ──(墓碑到期)────▶ 短碼可被重新註冊
+package lifecycle
+
+import (
+	"context"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// AdvisoryLockKey 清理任務使用的 PostgreSQL advisory lock 鍵
+//
+// 任意 64 位整數，只需在同一資料庫內不與其他任務衝突
+const AdvisoryLockKey int64 = 0x75726c5f73776565 // "url_swee"
+
+// Expired 待清理的過期鏈接
+type Expired struct {
+	Domain        string // 自定義域名（空表示默認域名）
+	ShortCode     string
+	ReservedUntil time.Time // 墓碑保留截止時間（之後短碼可被重新註冊）
+}
+
+// Store 生命週期任務需要的存儲操作
+//
+// 與 shortener.Store 分開定義：
+//   - 只有後台任務需要，請求路徑不依賴
+//   - 快取層（RedisCache）無需實現：清理直接作用於主存儲，快取通過 Purger 清除
+type Store interface {
+	// ListExpired 列出 expires_at 早於 before 的鏈接（按過期時間升序，最多 limit 條）
+	ListExpired(ctx context.Context, before time.Time, limit int) ([]*shortener.URL, error)
+
+	// RemoveExpired 刪除（或歸檔）過期鏈接並寫入墓碑
+	//
+	// 刪除條件必須再次檢查 expires_at < before：
+	//   - List 與 Remove 之間所有者可能延長了過期時間
+	//   - 返回實際被刪除的條目
+	RemoveExpired(ctx context.Context, items []Expired, before time.Time, archive bool) ([]Expired, error)
+
+	// PurgeTombstones 清除已到期的墓碑（最多 limit 條），返回清除數量
+	PurgeTombstones(ctx context.Context, now time.Time, limit int) (int64, error)
+}
+
+// Locker 分布式互斥（多副本部署時只讓一個副本執行清理）
+//
+// TryLock 非阻塞：
+//   - ok = false 表示其他副本正在執行，本輪跳過
+//   - ok = true 時必須調用 release 釋放
+type Locker interface {
+	TryLock(ctx context.Context) (release func(), ok bool, err error)
+}
+
+// Purger 快取清除接口（*storage.RedisCache 實現）
+type Purger interface {
+	Purge(ctx context.Context, items []Expired) error
+}
@@ -0,0 +1,245 @@
+package lifecycle
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// reservedForever 永久保留（墓碑永不到期）
+var reservedForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// SweeperConfig 清理任務配置
+type SweeperConfig struct {
+	Interval   time.Duration // 執行間隔（默認 1 分鐘）
+	BatchSize  int           // 每批處理條數（默認 500）
+	MaxBatches int           // 每輪最多批次數（默認 20），限制單輪持鎖時間
+	Grace      time.Duration // 過期後的寬限期（默認 24 小時，負數表示不設寬限期），期間所有者仍可延期
+	Archive    bool          // 歸檔到 urls_archive 而不是直接刪除
+
+	// ReuseAutoCodes 是否回收自動生成的短碼
+	//
+	//   - false（默認）：自動短碼的墓碑永不到期
+	//   - true：隔離期（Quarantine）後墓碑到期，短碼可被註冊為自定義短碼
+	//
+	// 自定義短碼始終按 shortener.TombstoneCooldown 保留（與手動刪除一致）
+	ReuseAutoCodes bool
+	Quarantine     time.Duration // 自動短碼隔離期（默認 90 天）
+}
+
+// SweeperStats 清理任務運行統計（本副本視角）
+type SweeperStats struct {
+	Runs             int64     `json:"runs"`              // 執行輪數
+	Skipped          int64     `json:"skipped"`           // 因其他副本持鎖而跳過的輪數
+	Expired          int64     `json:"expired"`           // 已清理的過期鏈接數
+	Archived         int64     `json:"archived"`          // 其中被歸檔的數量
+	TombstonesPurged int64     `json:"tombstones_purged"` // 已清除的到期墓碑數
+	Errors           int64     `json:"errors"`            // 失敗的輪數
+	LastRunAt        time.Time `json:"last_run_at,omitzero"`
+	LastDurationMs   int64     `json:"last_duration_ms"`
+	LastExpired      int64     `json:"last_expired"` // 最近一輪清理的鏈接數
+	LastError        string    `json:"last_error,omitempty"`
+}
+
+// Sweeper 過期鏈接清理任務
+//
+// 生命週期：
+//
+//	s := NewSweeper(store, locker, purger, logger, cfg)
+//	go s.Run(ctx) // ctx 取消時退出
+//
+// 系統設計考量：
+//
+//  1. 多副本安全：
+//     - 每輪開始時 TryLock（PostgreSQL advisory lock），拿不到就跳過
+//     - 鎖按輪獲取而不是常駐：持鎖副本宕機後，其他副本下一輪自動接管
+//     - 即使鎖失效兩個副本同時執行，RemoveExpired 也是冪等的（只是重複工作）
+//
+//  2. 分批處理：
+//     - 每批 BatchSize 條，單條語句完成刪除/歸檔/墓碑
+//     - 小事務：不長時間持有行鎖，不產生巨大的 WAL 突刺
+//     - 每輪最多 MaxBatches 批：積壓很大時分多輪消化，不長期佔用連接
+//
+//  3. 快取清除：
+//     - 刪除成功後清除 Redis 條目（否則快取中的過期記錄要等 TTL 到期）
+//     - 清除失敗只記錄日誌：Resolve 仍會惰性檢查過期時間
+type Sweeper struct {
+	store  Store
+	locker Locker // 可選，nil 時總是執行（單副本）
+	purger Purger // 可選，nil 時不清除快取
+	logger *slog.Logger
+	cfg    SweeperConfig
+
+	mu    sync.Mutex
+	stats SweeperStats
+}
+
+// NewSweeper 創建清理任務
+func NewSweeper(store Store, locker Locker, purger Purger, logger *slog.Logger, cfg SweeperConfig) *Sweeper {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.MaxBatches <= 0 {
+		cfg.MaxBatches = 20
+	}
+	if cfg.Grace < 0 {
+		cfg.Grace = 0
+	} else if cfg.Grace == 0 {
+		cfg.Grace = 24 * time.Hour
+	}
+	if cfg.Quarantine <= 0 {
+		cfg.Quarantine = 90 * 24 * time.Hour
+	}
+
+	return &Sweeper{
+		store:  store,
+		locker: locker,
+		purger: purger,
+		logger: logger,
+		cfg:    cfg,
+	}
+}
+
+// Run 定期執行清理（阻塞，直到 ctx 取消）
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunOnce(ctx)
+		}
+	}
+}
+
+// RunOnce 執行一輪清理
+func (s *Sweeper) RunOnce(ctx context.Context) {
+	if s.locker != nil {
+		release, ok, err := s.locker.TryLock(ctx)
+		if err != nil {
+			s.logger.Error("sweeper lock failed", "error", err)
+			s.record(func(st *SweeperStats) {
+				st.Errors++
+				st.LastError = err.Error()
+			})
+			return
+		}
+		if !ok {
+			s.record(func(st *SweeperStats) { st.Skipped++ })
+			return
+		}
+		defer release()
+	}
+
+	start := time.Now()
+	expired, archived, purged, err := s.sweep(ctx, start)
+	duration := time.Since(start)
+
+	s.record(func(st *SweeperStats) {
+		st.Runs++
+		st.Expired += expired
+		st.Archived += archived
+		st.TombstonesPurged += purged
+		st.LastRunAt = start
+		st.LastDurationMs = duration.Milliseconds()
+		st.LastExpired = expired
+		st.LastError = ""
+		if err != nil {
+			st.Errors++
+			st.LastError = err.Error()
+		}
+	})
+
+	if err != nil {
+		s.logger.Error("sweep failed", "expired", expired, "error", err)
+		return
+	}
+	if expired > 0 || purged > 0 {
+		s.logger.Info("sweep completed",
+			"expired", expired,
+			"archived", archived,
+			"tombstones_purged", purged,
+			"duration", duration,
+		)
+	}
+}
+
+// sweep 清理過期鏈接與到期墓碑
+func (s *Sweeper) sweep(ctx context.Context, now time.Time) (expired, archived, purged int64, err error) {
+	cutoff := now.Add(-s.cfg.Grace)
+
+	for range s.cfg.MaxBatches {
+		urls, err := s.store.ListExpired(ctx, cutoff, s.cfg.BatchSize)
+		if err != nil {
+			return expired, archived, purged, err
+		}
+		if len(urls) == 0 {
+			break
+		}
+
+		items := make([]Expired, len(urls))
+		for i, url := range urls {
+			items[i] = Expired{Domain: url.Domain, ShortCode: url.ShortCode, ReservedUntil: s.reservedUntil(url, now)}
+		}
+
+		removed, err := s.store.RemoveExpired(ctx, items, cutoff, s.cfg.Archive)
+		if err != nil {
+			return expired, archived, purged, err
+		}
+		expired += int64(len(removed))
+		if s.cfg.Archive {
+			archived += int64(len(removed))
+		}
+
+		if s.purger != nil && len(removed) > 0 {
+			if err := s.purger.Purge(ctx, removed); err != nil {
+				s.logger.Warn("purge expired links from cache failed", "count", len(removed), "error", err)
+			}
+		}
+
+		if len(urls) < s.cfg.BatchSize {
+			break
+		}
+	}
+
+	purged, err = s.store.PurgeTombstones(ctx, now, s.cfg.BatchSize*s.cfg.MaxBatches)
+	return expired, archived, purged, err
+}
+
+// reservedUntil 計算過期短碼的墓碑截止時間
+//
+// 為什麼區分自定義短碼與自動短碼？
+//   - 自定義短碼（如 /spring-sale）有品牌含義，與手動刪除一樣冷卻後釋放
+//   - 自動短碼由 Snowflake ID 推導，系統永遠不會再生成同一個；
+//     回收的意義只是允許被註冊為自定義短碼，默認永久保留更安全
+func (s *Sweeper) reservedUntil(url *shortener.URL, now time.Time) time.Time {
+	if url.IsCustomCode() {
+		return now.Add(shortener.TombstoneCooldown)
+	}
+	if s.cfg.ReuseAutoCodes {
+		return now.Add(s.cfg.Quarantine)
+	}
+	return reservedForever
+}
+
+// Stats 返回運行統計
+func (s *Sweeper) Stats() SweeperStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *Sweeper) record(update func(*SweeperStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
@@ -0,0 +1,221 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/base62"
+)
+
+// fakeStore 記錄 RemoveExpired 調用的測試用存儲
+type fakeStore struct {
+	mu      sync.Mutex
+	urls    map[string]*shortener.URL
+	removed []Expired
+	lists   int   // ListExpired 調用次數
+	purged  int64 // PurgeTombstones 返回值
+	err     error
+}
+
+func newFakeStore(urls ...*shortener.URL) *fakeStore {
+	s := &fakeStore{urls: make(map[string]*shortener.URL)}
+	for _, u := range urls {
+		s.urls[shortener.QualifiedCode(u.Domain, u.ShortCode)] = u
+	}
+	return s
+}
+
+func (s *fakeStore) ListExpired(ctx context.Context, before time.Time, limit int) ([]*shortener.URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists++
+	if s.err != nil {
+		return nil, s.err
+	}
+	var result []*shortener.URL
+	for _, u := range s.urls {
+		if len(result) == limit {
+			break
+		}
+		if u.ExpiresAt != nil && u.ExpiresAt.Before(before) {
+			result = append(result, u)
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeStore) RemoveExpired(ctx context.Context, items []Expired, before time.Time, archive bool) ([]Expired, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		delete(s.urls, shortener.QualifiedCode(item.Domain, item.ShortCode))
+	}
+	s.removed = append(s.removed, items...)
+	return items, nil
+}
+
+func (s *fakeStore) PurgeTombstones(ctx context.Context, now time.Time, limit int) (int64, error) {
+	return s.purged, nil
+}
+
+type fakeLocker struct {
+	held     bool
+	err      error
+	released int
+}
+
+func (l *fakeLocker) TryLock(ctx context.Context) (func(), bool, error) {
+	if l.err != nil || l.held {
+		return nil, false, l.err
+	}
+	return func() { l.released++ }, true, nil
+}
+
+type fakePurger struct{ purged []Expired }
+
+func (p *fakePurger) Purge(ctx context.Context, items []Expired) error {
+	p.purged = append(p.purged, items...)
+	return errors.New("redis down") // 清除失敗不影響清理結果
+}
+
+func newTestSweeper(store Store, locker Locker, purger Purger, cfg SweeperConfig) *Sweeper {
+	return NewSweeper(store, locker, purger, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+}
+
+// expiredURL 構建 ago 之前過期的鏈接；code 為空時短碼由 ID 推導（自動短碼）
+func expiredURL(id int64, code string, ago time.Duration) *shortener.URL {
+	expires := time.Now().Add(-ago)
+	if code == "" {
+		code = base62.Encode(uint64(id))
+	}
+	return &shortener.URL{ID: id, ShortCode: code, ExpiresAt: &expires}
+}
+
+func TestSweeperGrace(t *testing.T) {
+	store := newFakeStore(
+		expiredURL(1, "old", 48*time.Hour),       // 寬限期已過
+		expiredURL(2, "recent", time.Hour),       // 寬限期內：所有者仍可延期
+		&shortener.URL{ID: 3, ShortCode: "live"}, // 永不過期
+	)
+	purger := &fakePurger{}
+	s := newTestSweeper(store, nil, purger, SweeperConfig{Archive: true})
+	s.RunOnce(context.Background())
+
+	if len(store.removed) != 1 || store.removed[0].ShortCode != "old" {
+		t.Fatalf("removed = %+v, want only \"old\"", store.removed)
+	}
+	if len(purger.purged) != 1 {
+		t.Errorf("purged from cache = %+v, want the removed link", purger.purged)
+	}
+
+	stats := s.Stats()
+	if stats.Runs != 1 || stats.Expired != 1 || stats.Archived != 1 || stats.Errors != 0 || stats.LastExpired != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestSweeperReservedUntil(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   *shortener.URL
+		reuse bool
+		want  time.Duration // 相對 now；0 表示永久保留
+	}{
+		{"custom code", expiredURL(1, "spring", time.Hour), false, shortener.TombstoneCooldown},
+		{"auto code", expiredURL(2, "", time.Hour), false, 0},
+		{"auto code reused", expiredURL(3, "", time.Hour), true, 7 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore(tt.url)
+			s := newTestSweeper(store, nil, nil, SweeperConfig{Grace: -1, ReuseAutoCodes: tt.reuse, Quarantine: 7 * 24 * time.Hour})
+			start := time.Now()
+			s.RunOnce(context.Background())
+
+			if len(store.removed) != 1 {
+				t.Fatalf("removed = %+v, want 1 item", store.removed)
+			}
+			got := store.removed[0].ReservedUntil
+			if tt.want == 0 {
+				if !got.Equal(reservedForever) {
+					t.Errorf("ReservedUntil = %v, want forever", got)
+				}
+				return
+			}
+			if d := got.Sub(start); d < tt.want || d > tt.want+time.Second {
+				t.Errorf("ReservedUntil = now+%v, want now+%v", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweeperBatches(t *testing.T) {
+	var urls []*shortener.URL
+	for i := range 25 {
+		urls = append(urls, expiredURL(int64(i+1), "", 48*time.Hour))
+	}
+	store := newFakeStore(urls...)
+	store.purged = 3
+
+	// 每輪最多 2 批 × 10 條：剩餘 5 條留到下一輪
+	s := newTestSweeper(store, nil, nil, SweeperConfig{BatchSize: 10, MaxBatches: 2})
+	s.RunOnce(context.Background())
+	if len(store.removed) != 20 || store.lists != 2 {
+		t.Fatalf("first run removed %d in %d batches, want 20 in 2", len(store.removed), store.lists)
+	}
+
+	// 最後一批不足 BatchSize：不再多查一次
+	s.RunOnce(context.Background())
+	if len(store.removed) != 25 || store.lists != 3 {
+		t.Errorf("second run: removed %d after %d batches, want 25 after 3", len(store.removed), store.lists)
+	}
+	if stats := s.Stats(); stats.Expired != 25 || stats.TombstonesPurged != 6 || stats.Archived != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestSweeperLock(t *testing.T) {
+	store := newFakeStore(expiredURL(1, "old", 48*time.Hour))
+
+	held := &fakeLocker{held: true}
+	s := newTestSweeper(store, held, nil, SweeperConfig{})
+	s.RunOnce(context.Background())
+	if store.lists != 0 {
+		t.Fatal("sweeper ran while another replica held the lock")
+	}
+	if stats := s.Stats(); stats.Skipped != 1 || stats.Runs != 0 {
+		t.Errorf("Stats() = %+v, want skipped=1", stats)
+	}
+
+	failing := &fakeLocker{err: errors.New("db down")}
+	s = newTestSweeper(store, failing, nil, SweeperConfig{})
+	s.RunOnce(context.Background())
+	if stats := s.Stats(); stats.Errors != 1 || stats.LastError != "db down" {
+		t.Errorf("Stats() = %+v, want errors=1", stats)
+	}
+
+	free := &fakeLocker{}
+	s = newTestSweeper(store, free, nil, SweeperConfig{})
+	s.RunOnce(context.Background())
+	if len(store.removed) != 1 || free.released != 1 {
+		t.Errorf("removed = %+v, released = %d, want 1 removed and the lock released", store.removed, free.released)
+	}
+}
+
+func TestSweeperStoreError(t *testing.T) {
+	store := newFakeStore()
+	store.err = errors.New("db down")
+	s := newTestSweeper(store, nil, nil, SweeperConfig{})
+	s.RunOnce(context.Background())
+
+	if stats := s.Stats(); stats.Runs != 1 || stats.Errors != 1 || stats.LastError != "db down" {
+		t.Errorf("Stats() = %+v, want runs=1 errors=1", stats)
+	}
+}
@@ -0,0 +1,213 @@
+// Package screening 實現基於本地黑名單的惡意 URL 篩查
+//
+// 黑名單文件格式（每行一條規則）：
+//
+//	# 類型     值                              處置（可選，默認 block）
+//	domain    evil.example                    block
+//	domain    suspicious.example              warn
+//	pattern   ^https?://[^/]+/wp-admin/.*\.php$  warn
+//	hash      3f2a9c1b                        block
+//
+// 規則類型：
+//   - domain：域名及其所有子域名（a.b.evil.example 命中 evil.example）
+//   - pattern：正則表達式，匹配完整 URL
+//   - hash：SHA-256 哈希前綴（十六進制，至少 8 位）
+//
+// 為什麼支持哈希前綴？
+//   - 參考 Google Safe Browsing 的設計
+//   - 威脅情報源通常只提供哈希（不洩漏惡意 URL 本身，也不洩漏查詢的 URL）
+//   - 哈希對象：正規化後的 "host/path" 與 "host/"（整站）
+package screening
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// ErrInvalidRule 當黑名單規則格式錯誤時返回
+var ErrInvalidRule = errors.New("invalid blocklist rule")
+
+// minHashPrefix 哈希前綴最短長度（十六進制字符）
+//
+// 8 個十六進制字符 = 32 bit，誤命中概率約 1/40 億
+const minHashPrefix = 8
+
+// Blocklist 已編譯的黑名單（不可變，併發安全）
+//
+// 數據結構選擇：
+//   - domains：map 精確查詢，按域名層級逐級向上查，O(層級數)
+//   - hashes：按前綴長度分組的 map，O(前綴長度種類數)
+//   - patterns：逐條正則匹配，O(規則數)，應保持少量
+type Blocklist struct {
+	domains  map[string]rule
+	hashes   map[int]map[string]rule // 前綴長度 → 前綴 → 規則
+	patterns []patternRule
+	size     int
+}
+
+type rule struct {
+	action shortener.Action
+	name   string // 用於報告（如 "domain:evil.example"）
+}
+
+type patternRule struct {
+	re *regexp.Regexp
+	rule
+}
+
+// Parse 解析黑名單
+//
+// 任何一行格式錯誤都會導致整體失敗：
+//   - 熱更新時調用方保留舊黑名單，避免半份規則生效
+func Parse(r io.Reader) (*Blocklist, error) {
+	bl := &Blocklist{
+		domains: make(map[string]rule),
+		hashes:  make(map[int]map[string]rule),
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%w: line %d: expected \"<type> <value> [action]\"", ErrInvalidRule, lineNo)
+		}
+
+		action := shortener.ActionBlock
+		if len(fields) == 3 {
+			switch shortener.Action(fields[2]) {
+			case shortener.ActionBlock, shortener.ActionWarn:
+				action = shortener.Action(fields[2])
+			default:
+				return nil, fmt.Errorf("%w: line %d: unknown action %q", ErrInvalidRule, lineNo, fields[2])
+			}
+		}
+
+		kind, value := fields[0], fields[1]
+		r := rule{action: action, name: kind + ":" + value}
+
+		switch kind {
+		case "domain":
+			bl.domains[strings.ToLower(strings.TrimSuffix(value, "."))] = r
+
+		case "pattern":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidRule, lineNo, err)
+			}
+			bl.patterns = append(bl.patterns, patternRule{re: re, rule: r})
+
+		case "hash":
+			prefix := strings.ToLower(value)
+			if len(prefix) < minHashPrefix || len(prefix) > sha256.Size*2 {
+				return nil, fmt.Errorf("%w: line %d: hash prefix must be %d-64 hex chars", ErrInvalidRule, lineNo, minHashPrefix)
+			}
+			// 逐字符檢查（前綴可以是奇數長度，hex.DecodeString 會漏掉最後一個字符）
+			if strings.IndexFunc(prefix, isNotHex) >= 0 {
+				return nil, fmt.Errorf("%w: line %d: hash prefix must be hex", ErrInvalidRule, lineNo)
+			}
+			if bl.hashes[len(prefix)] == nil {
+				bl.hashes[len(prefix)] = make(map[string]rule)
+			}
+			bl.hashes[len(prefix)][prefix] = r
+
+		default:
+			return nil, fmt.Errorf("%w: line %d: unknown type %q", ErrInvalidRule, lineNo, kind)
+		}
+		bl.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return bl, nil
+}
+
+// ParseFile 從文件解析黑名單
+func ParseFile(path string) (*Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Len 返回規則數量
+func (bl *Blocklist) Len() int {
+	return bl.size
+}
+
+// Screen 篩查 URL（實現 shortener.Screener）
+//
+// 檢查順序：域名 → 哈希 → 正則（由快到慢）
+// 同一 URL 命中多條規則時，返回第一條命中的規則
+func (bl *Blocklist) Screen(ctx context.Context, rawURL string) (shortener.Verdict, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// 無法解析的 URL 在創建時已被 isValidURL 拒絕
+		return shortener.Verdict{}, nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+
+	// 1. 域名（逐級向上：a.b.evil.example → b.evil.example → evil.example）
+	for d := host; d != ""; {
+		if r, ok := bl.domains[d]; ok {
+			return r.verdict("domain is on the blocklist"), nil
+		}
+		_, parent, found := strings.Cut(d, ".")
+		if !found {
+			break
+		}
+		d = parent
+	}
+
+	// 2. 哈希前綴（整站 "host/" 與具體頁面 "host/path"）
+	if len(bl.hashes) > 0 {
+		for _, expr := range []string{host + "/", host + u.EscapedPath()} {
+			sum := sha256.Sum256([]byte(expr))
+			digest := hex.EncodeToString(sum[:])
+			for n, prefixes := range bl.hashes {
+				if r, ok := prefixes[digest[:n]]; ok {
+					return r.verdict("url hash matches a known threat"), nil
+				}
+			}
+		}
+	}
+
+	// 3. 正則
+	for _, p := range bl.patterns {
+		if p.re.MatchString(rawURL) {
+			return p.verdict("url matches a suspicious pattern"), nil
+		}
+	}
+
+	return shortener.Verdict{}, nil
+}
+
+// isNotHex 是否為非十六進制字符（前綴已轉為小寫）
+func isNotHex(c rune) bool {
+	return !('0' <= c && c <= '9' || 'a' <= c && c <= 'f')
+}
+
+func (r rule) verdict(reason string) shortener.Verdict {
+	return shortener.Verdict{Action: r.action, Rule: r.name, Reason: reason}
+}
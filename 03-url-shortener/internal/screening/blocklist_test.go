@@ -0,0 +1,129 @@
+package screening
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// hashPrefix 計算 "host/path" 的 SHA-256 前綴（與 Screen 的哈希對象一致）
+func hashPrefix(expr string, n int) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+func TestParse(t *testing.T) {
+	input := `
+# 註釋與空行會被忽略
+
+domain   evil.example
+domain   Suspicious.Example.   warn
+pattern  ^https?://[^/]+/wp-admin/.*\.php$  warn
+hash     ` + hashPrefix("bad.example/", 9) + `
+`
+	bl, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if bl.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", bl.Len())
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"missing value", "domain"},
+		{"too many fields", "domain evil.example block extra"},
+		{"unknown type", "ip 1.2.3.4"},
+		{"unknown action", "domain evil.example allow"},
+		{"bad regexp", "pattern ([a-z"},
+		{"hash too short", "hash abc123"},
+		{"hash too long", "hash " + strings.Repeat("a", 65)},
+		{"hash not hex", "hash zzzzzzzz"},
+		{"odd-length hash with bad last char", "hash abcdef12z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader("domain ok.example\n" + tt.line + "\n"))
+			if !errors.Is(err, ErrInvalidRule) {
+				t.Fatalf("Parse(%q) error = %v, want ErrInvalidRule", tt.line, err)
+			}
+			if !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("error %q should report the line number", err)
+			}
+		})
+	}
+}
+
+func TestScreen(t *testing.T) {
+	input := strings.Join([]string{
+		"domain evil.example",
+		"domain suspicious.example warn",
+		`pattern ^https?://[^/]+/wp-admin/.*\.php$ warn`,
+		"hash " + hashPrefix("bad.example/", 9),                       // 整站，奇數長度前綴
+		"hash " + hashPrefix("cdn.example/malware.exe", 64) + " warn", // 單一頁面，完整哈希
+	}, "\n")
+	bl, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		url    string
+		action shortener.Action
+		rule   string
+	}{
+		{"https://evil.example/login", shortener.ActionBlock, "domain:evil.example"},
+		{"https://a.b.EVIL.example./x", shortener.ActionBlock, "domain:evil.example"},
+		{"https://notevil.example/", shortener.ActionAllow, ""},
+		{"https://suspicious.example/", shortener.ActionWarn, "domain:suspicious.example"},
+		{"https://blog.example/wp-admin/shell.php", shortener.ActionWarn, `pattern:^https?://[^/]+/wp-admin/.*\.php$`},
+		{"https://blog.example/wp-admin/", shortener.ActionAllow, ""},
+		{"https://bad.example/any/page", shortener.ActionBlock, "hash:" + hashPrefix("bad.example/", 9)},
+		{"https://cdn.example/malware.exe", shortener.ActionWarn, "hash:" + hashPrefix("cdn.example/malware.exe", 64)},
+		{"https://cdn.example/other.exe", shortener.ActionAllow, ""},
+		{"https://good.example/", shortener.ActionAllow, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			v, err := bl.Screen(context.Background(), tt.url)
+			if err != nil {
+				t.Fatalf("Screen() error = %v", err)
+			}
+			if v.Action != tt.action || v.Rule != tt.rule {
+				t.Errorf("Screen(%q) = %+v, want action=%q rule=%q", tt.url, v, tt.action, tt.rule)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(2)
+	verdict := shortener.Verdict{Action: shortener.ActionBlock, Rule: "domain:evil.example"}
+
+	r.Record("a", "https://evil.example/1", verdict)
+	r.Record("b", "https://evil.example/2", verdict)
+	r.Record("a", "https://evil.example/1", verdict)
+	r.Record("c", "https://evil.example/3", verdict) // 容量滿：淘汰最久未訪問的 b
+
+	flags := r.List()
+	if len(flags) != 2 {
+		t.Fatalf("List() = %+v, want 2 entries", flags)
+	}
+	if flags[0].ShortCode != "c" || flags[1].ShortCode != "a" || flags[1].Hits != 2 {
+		t.Errorf("List() = %+v, want [c, a(hits=2)]", flags)
+	}
+
+	var nilRegistry *Registry
+	nilRegistry.Record("x", "https://evil.example", verdict) // 不應 panic
+}
@@ -0,0 +1,106 @@
+package screening
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// Flag 一條被標記的鏈接記錄
+type Flag struct {
+	ShortCode string            `json:"short_code"`
+	LongURL   string            `json:"long_url"`
+	Verdict   shortener.Verdict `json:"verdict"`
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+	Hits      int64             `json:"hits"` // 被攔截的訪問次數
+}
+
+// Registry 被標記鏈接的登記處（供管理後台查看）
+//
+// 記錄的是「重定向時被攔截」的鏈接，而不是「存儲中命中黑名單」的鏈接：
+//   - 沒有被訪問的鏈接不會出現在列表中（即使目標已被列入黑名單）
+//   - 要回答「哪些已存在的鏈接命中新黑名單」，需要離線掃描存儲（教學簡化，未實現）
+//
+// 系統設計考量：
+//   - 進程內存儲：每個副本只看到自己攔截的訪問，重啟後清空
+//   - 有界容量：超過上限時淘汰最久未被訪問的記錄，防止內存無限增長
+//   - 生產環境：應寫入共享存儲（資料庫表或 Redis Hash），並觸發告警
+type Registry struct {
+	mu       sync.Mutex
+	flags    map[string]*Flag
+	capacity int
+}
+
+// NewRegistry 創建登記處（capacity <= 0 時默認 10000）
+func NewRegistry(capacity int) *Registry {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &Registry{
+		flags:    make(map[string]*Flag),
+		capacity: capacity,
+	}
+}
+
+// Record 記錄一次攔截（nil Registry 時忽略）
+func (r *Registry) Record(shortCode, longURL string, verdict shortener.Verdict) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if f, ok := r.flags[shortCode]; ok {
+		f.LongURL = longURL
+		f.Verdict = verdict
+		f.LastSeen = now
+		f.Hits++
+		return
+	}
+
+	if len(r.flags) >= r.capacity {
+		r.evictOldest()
+	}
+	r.flags[shortCode] = &Flag{
+		ShortCode: shortCode,
+		LongURL:   longURL,
+		Verdict:   verdict,
+		FirstSeen: now,
+		LastSeen:  now,
+		Hits:      1,
+	}
+}
+
+// List 返回所有被標記的鏈接（按最近訪問時間倒序）
+func (r *Registry) List() []Flag {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]Flag, 0, len(r.flags))
+	for _, f := range r.flags {
+		result = append(result, *f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
+
+// evictOldest 淘汰最久未被訪問的記錄
+//
+// O(n) 掃描：只在容量滿時觸發，且登記處規模有限
+func (r *Registry) evictOldest() {
+	var oldest string
+	var oldestTime time.Time
+	for code, f := range r.flags {
+		if oldest == "" || f.LastSeen.Before(oldestTime) {
+			oldest, oldestTime = code, f.LastSeen
+		}
+	}
+	delete(r.flags, oldest)
+}
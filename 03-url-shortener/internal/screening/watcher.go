@@ -0,0 +1,99 @@
+package screening
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// FileScreener 從本地文件載入黑名單，並支持熱更新
+//
+// 熱更新設計：
+//
+//	watcher goroutine ──(檢測到 mtime/size 變化)──▶ ParseFile ──成功──▶ atomic.Pointer.Store
+//	                                                          └─失敗──▶ 記錄日誌，保留舊黑名單
+//
+// 為什麼用輪詢而不是 inotify（fsnotify）？
+//   - 零依賴、跨平台
+//   - Kubernetes ConfigMap 通過 symlink 替換更新，inotify 容易漏事件
+//   - 黑名單更新頻率低（分鐘級），輪詢開銷可忽略
+//
+// 為什麼用 atomic.Pointer 而不是 RWMutex？
+//   - Screen 在重定向熱路徑上，原子讀取無鎖競爭
+//   - Blocklist 不可變，替換指針即完成切換（Copy-on-Write）
+type FileScreener struct {
+	path    string
+	logger  *slog.Logger
+	current atomic.Pointer[Blocklist]
+
+	modTime time.Time
+	size    int64
+}
+
+// NewFileScreener 創建文件黑名單篩查器並立即載入一次
+//
+// 首次載入失敗直接返回錯誤（Fail-Fast：啟動時配置錯誤應立即暴露）
+func NewFileScreener(path string, logger *slog.Logger) (*FileScreener, error) {
+	s := &FileScreener{path: path, logger: logger}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Screen 篩查 URL（實現 shortener.Screener）
+func (s *FileScreener) Screen(ctx context.Context, rawURL string) (shortener.Verdict, error) {
+	bl := s.current.Load()
+	if bl == nil {
+		return shortener.Verdict{}, nil
+	}
+	return bl.Screen(ctx, rawURL)
+}
+
+// Reload 檢查文件是否變化，變化則重新載入
+//
+// 返回 true 表示黑名單已替換
+// 解析失敗時保留舊黑名單並返回錯誤
+func (s *FileScreener) Reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return false, nil
+	}
+
+	bl, err := ParseFile(s.path)
+	if err != nil {
+		return false, err
+	}
+
+	s.current.Store(bl)
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.logger.Info("blocklist loaded", "path", s.path, "rules", bl.Len())
+	return true, nil
+}
+
+// Watch 定期檢查文件變化（阻塞，直到 ctx 取消）
+//
+// 只有 Watch 所在的 goroutine 調用 Reload，modTime/size 無需加鎖
+func (s *FileScreener) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Reload(); err != nil {
+				s.logger.Error("blocklist reload failed, keeping previous rules", "path", s.path, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/pkg/base62"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/snowflake"
+)
+
+// MaxBatchSize 單次批量創建的最大條目數
+//
+// 為什麼要上限？
+//   - 單個請求的處理時間、內存佔用可控（避免拖垮整個副本）
+//   - 單條 SQL 的參數數量有上限（PostgreSQL 65535）
+//   - 更大的導入應由客戶端分批提交
+const MaxBatchSize = 1000
+
+// ErrBatchTooLarge 批量條目數超過 MaxBatchSize
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// ErrDuplicateInBatch 同一批次內出現重複的自定義短碼（同一域名下）
+var ErrDuplicateInBatch = errors.New("duplicate custom code in batch")
+
+// BatchResult 批量創建中單個條目的結果
+//
+// URL 與 Err 二者恰有一個非 nil
+type BatchResult struct {
+	URL *URL
+	Err error
+}
+
+// ShortenBatch 批量創建短網址
+//
+// 返回：
+//   - results[i] 對應 reqs[i]
+//   - 錯誤：只有整批無法處理時才返回（如超過上限、ID 生成失敗、存儲不可用）
+//
+// 算法流程：
+//  1. 逐條校驗（格式、篩查、自定義短碼、域名），失敗的條目直接記錄錯誤
+//  2. 批內去重：同一域名下的同一自定義短碼只保留第一次出現
+//  3. 一次性分配 Snowflake ID（GenerateN：一次加鎖）
+//  4. 一次性寫入存儲（SaveBatch：單條多行 INSERT）
+//
+// 系統設計考量：
+//   - 部分成功語義：一條短碼衝突不應讓營銷活動的其餘 999 條失敗
+//   - 往返次數：N 條記錄 1 次資料庫往返，而不是 N 次
+//   - 權衡：整批共享一個超時（ctx），單條慢不會被單獨重試
+func ShortenBatch(ctx context.Context, store Store, idgen *snowflake.Generator, screener Screener, reqs []ShortenRequest) ([]BatchResult, error) {
+	if len(reqs) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]BatchResult, len(reqs))
+
+	// 1-2. 校驗與批內去重
+	pending := make([]int, 0, len(reqs)) // 通過校驗的條目下標
+	seen := make(map[string]bool)
+	reqs = slices.Clone(reqs) // checkRequest 會替換 Rules，不修改調用方的切片
+
+	// 同一域名（與所有者）只查詢一次
+	domains := make(map[domainCheckKey]domainCheck)
+	for i := range reqs {
+		req := &reqs[i]
+		err := checkRequest(ctx, screener, req)
+		if err == nil {
+			key := domainCheckKey{req.Domain, req.OwnerID}
+			check, ok := domains[key]
+			if !ok {
+				check.name, check.err = checkDomain(ctx, store, req.Domain, req.OwnerID)
+				domains[key] = check
+			}
+			req.Domain, err = check.name, check.err
+		}
+		if err != nil {
+			// 篩查服務、存儲本身的錯誤（非判定結果）讓整批失敗，與單條創建一致
+			if !isRequestError(err) {
+				return nil, err
+			}
+			results[i].Err = err
+			continue
+		}
+		if req.CustomCode != "" {
+			code := QualifiedCode(req.Domain, req.CustomCode)
+			if seen[code] {
+				results[i].Err = ErrDuplicateInBatch
+				continue
+			}
+			seen[code] = true
+		}
+		pending = append(pending, i)
+	}
+
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	// 3. 批量分配 ID
+	ids, err := idgen.GenerateN(len(pending))
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 構建記錄並批量寫入
+	now := time.Now()
+	urls := make([]*URL, len(pending))
+	for j, i := range pending {
+		req := reqs[i]
+
+		shortCode := req.CustomCode
+		if shortCode == "" {
+			shortCode = base62.Encode(uint64(ids[j]))
+		}
+
+		// 深拷貝 ExpiresAt（同 Shorten）
+		var expiresAt *time.Time
+		if req.ExpiresAt != nil {
+			t := *req.ExpiresAt
+			expiresAt = &t
+		}
+
+		urls[j] = &URL{
+			ID:        ids[j],
+			ShortCode: shortCode,
+			Domain:    req.Domain,
+			LongURL:   req.LongURL,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+			OwnerID:   req.OwnerID,
+			Rules:     req.Rules,
+
+			PasswordHash: req.passwordHash,
+			MaxClicks:    req.MaxClicks,
+		}
+	}
+
+	errs, err := store.SaveBatch(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range pending {
+		if errs[j] != nil {
+			results[i].Err = errs[j]
+			continue
+		}
+		results[i].URL = urls[j]
+	}
+
+	return results, nil
+}
+
+// domainCheckKey、domainCheck 批內域名檢查的結果快取
+type domainCheckKey struct {
+	name    string
+	ownerID int64
+}
+
+type domainCheck struct {
+	name string
+	err  error
+}
+
+// isRequestError 檢查是否為單條請求本身的錯誤（而非依賴服務的故障）
+func isRequestError(err error) bool {
+	return errors.Is(err, ErrInvalidURL) ||
+		errors.Is(err, ErrInvalidDomain) ||
+		errors.Is(err, ErrDomainNotFound) ||
+		errors.Is(err, ErrDomainUnverified) ||
+		errors.Is(err, ErrBlocked) ||
+		errors.Is(err, ErrInvalidRules) ||
+		errors.Is(err, ErrInvalidPassword) ||
+		errors.Is(err, ErrInvalidMaxClicks)
+}
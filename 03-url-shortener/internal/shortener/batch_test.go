@@ -0,0 +1,116 @@
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/snowflake"
+)
+
+// screenerFunc 測試用篩查器
+type screenerFunc func(rawURL string) (shortener.Verdict, error)
+
+func (f screenerFunc) Screen(ctx context.Context, rawURL string) (shortener.Verdict, error) {
+	return f(rawURL)
+}
+
+func newGenerator(t *testing.T) *snowflake.Generator {
+	t.Helper()
+	idgen, err := snowflake.NewGenerator(1)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	return idgen
+}
+
+func TestShortenBatch(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	seed(t, store, 0, "taken")
+
+	blockEvil := screenerFunc(func(rawURL string) (shortener.Verdict, error) {
+		if strings.Contains(rawURL, "93.184.216.66") {
+			return shortener.Verdict{Action: shortener.ActionBlock, Rule: "domain:93.184.216.66"}, nil
+		}
+		return shortener.Verdict{}, nil
+	})
+
+	reqs := []shortener.ShortenRequest{
+		{LongURL: target},                                      // 0：自動生成短碼
+		{LongURL: target, CustomCode: "spring"},                // 1：自定義短碼
+		{LongURL: target, CustomCode: "spring"},                // 2：批內重複
+		{LongURL: target, CustomCode: "taken"},                 // 3：與存量衝突
+		{LongURL: "javascript:alert(1)"},                       // 4：格式錯誤
+		{LongURL: "https://93.184.216.66/phish"},               // 5：被篩查攔截
+		{LongURL: target, CustomCode: "spring", MaxClicks: -1}, // 6：字段錯誤優先於批內去重
+	}
+	results, err := shortener.ShortenBatch(ctx, store, newGenerator(t), blockEvil, reqs)
+	if err != nil {
+		t.Fatalf("ShortenBatch() error = %v", err)
+	}
+	if len(results) != len(reqs) {
+		t.Fatalf("len(results) = %d, want %d", len(results), len(reqs))
+	}
+
+	want := []error{nil, nil, shortener.ErrDuplicateInBatch, shortener.ErrCodeExists, shortener.ErrInvalidURL, shortener.ErrBlocked, shortener.ErrInvalidMaxClicks}
+	for i, w := range want {
+		r := results[i]
+		if w == nil {
+			if r.Err != nil || r.URL == nil {
+				t.Errorf("results[%d] = %+v, want success", i, r)
+			}
+			continue
+		}
+		if !errors.Is(r.Err, w) || r.URL != nil {
+			t.Errorf("results[%d] = %+v, want %v", i, r, w)
+		}
+	}
+
+	// 成功的條目已寫入存儲
+	for _, i := range []int{0, 1} {
+		if _, err := store.Load(ctx, "", results[i].URL.ShortCode); err != nil {
+			t.Errorf("Load(results[%d]) error = %v", i, err)
+		}
+	}
+	if results[0].URL.ShortCode == "" || results[0].URL.ID == results[1].URL.ID {
+		t.Errorf("generated URLs must have distinct IDs and a short code: %+v, %+v", results[0].URL, results[1].URL)
+	}
+}
+
+func TestShortenBatchTooLarge(t *testing.T) {
+	reqs := make([]shortener.ShortenRequest, shortener.MaxBatchSize+1)
+	if _, err := shortener.ShortenBatch(context.Background(), storage.NewMemory(), newGenerator(t), nil, reqs); !errors.Is(err, shortener.ErrBatchTooLarge) {
+		t.Errorf("ShortenBatch(%d items) error = %v, want ErrBatchTooLarge", len(reqs), err)
+	}
+}
+
+func TestShortenBatchScreenerFailure(t *testing.T) {
+	// 篩查服務故障不是單條請求的錯誤：整批失敗，什麼都不寫入
+	store := storage.NewMemory()
+	down := screenerFunc(func(string) (shortener.Verdict, error) {
+		return shortener.Verdict{}, errors.New("screening unavailable")
+	})
+
+	results, err := shortener.ShortenBatch(context.Background(), store, newGenerator(t), down, []shortener.ShortenRequest{{LongURL: target, CustomCode: "spring"}})
+	if err == nil {
+		t.Fatalf("ShortenBatch() = %+v, want error", results)
+	}
+	if _, err := store.Load(context.Background(), "", "spring"); !errors.Is(err, shortener.ErrNotFound) {
+		t.Errorf("Load after failed batch error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestShortenBatchAllInvalid(t *testing.T) {
+	// 沒有通過校驗的條目：不分配 ID、不寫存儲
+	results, err := shortener.ShortenBatch(context.Background(), storage.NewMemory(), nil, nil, []shortener.ShortenRequest{{LongURL: "ftp://x"}})
+	if err != nil {
+		t.Fatalf("ShortenBatch() error = %v", err)
+	}
+	if !errors.Is(results[0].Err, shortener.ErrInvalidURL) {
+		t.Errorf("results[0].Err = %v, want ErrInvalidURL", results[0].Err)
+	}
+}
@@ -0,0 +1,361 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 自定義域名（Custom Domains）
+//
+// 品牌短鏈：go.ourbrand.com/launch 比 short.url/8M0kX 更可信、點擊率更高
+//
+// 設計要點：
+//   - 短碼唯一性按域名劃分：(domain, short_code) 唯一
+//     → 每個品牌都可以擁有自己的 /launch，互不衝突
+//     → 默認域名用空字符串表示（歷史數據無需遷移）
+//   - 路由：按請求的 Host header 選擇域名，未註冊或未驗證的 Host 落到默認域名
+//   - 所有權驗證：DNS TXT 記錄
+//     → 能修改域名 DNS 的人才是域名的所有者
+//     → 未驗證的域名不能創建鏈接，否則任何人都可以「註冊」別人的品牌域名
+//
+// 驗證流程：
+//
+//	POST /api/v1/domains {"name": "go.ourbrand.com"}
+//	  → 返回 TXT 記錄：_shortener.go.ourbrand.com  "shortener-verification=<token>"
+//	用戶在 DNS 服務商添加記錄
+//	POST /api/v1/domains/go.ourbrand.com/verify
+//	  → 查詢 TXT 記錄，匹配則標記為已驗證
+
+// ChallengePrefix 驗證記錄的子域名前綴
+//
+// 為什麼不直接在域名本身放 TXT 記錄？
+//   - 根域名的 TXT 記錄常被 SPF 等用途佔用
+//   - 獨立的子域名不影響現有配置，驗證完成後可以刪除
+const ChallengePrefix = "_shortener."
+
+// challengeValuePrefix 驗證記錄的值前綴
+const challengeValuePrefix = "shortener-verification="
+
+// MaxDomainsPerOwner 每個用戶可註冊的域名數上限
+const MaxDomainsPerOwner = 20
+
+// DomainClaimTTL 未驗證註冊的有效期
+//
+// 為什麼需要？
+//   - 域名全局唯一，任何人都可以先註冊別人的品牌域名（無需證明所有權）
+//   - 註冊超過此時間仍未驗證，其他用戶可以重新註冊，真正的所有者不會被永久擋在門外
+//   - 已驗證的域名不受影響
+const DomainClaimTTL = 7 * 24 * time.Hour
+
+// Domain 表示一個自定義域名
+//
+// Workspace 即用戶：域名歸屬註冊它的用戶，只有該用戶能在此域名下創建鏈接
+type Domain struct {
+	Name       string     `json:"name"`                  // 小寫主機名（不含端口）
+	OwnerID    int64      `json:"owner_id"`              // 所屬用戶 ID
+	Token      string     `json:"token"`                 // 驗證令牌（寫入 TXT 記錄）
+	CreatedAt  time.Time  `json:"created_at"`            // 註冊時間
+	VerifiedAt *time.Time `json:"verified_at,omitempty"` // 驗證通過時間（nil 表示未驗證）
+}
+
+// IsVerified 檢查域名是否已通過驗證
+func (d *Domain) IsVerified() bool {
+	return d.VerifiedAt != nil
+}
+
+// ChallengeName 驗證記錄的完整名稱（如 "_shortener.go.ourbrand.com"）
+func (d *Domain) ChallengeName() string {
+	return ChallengePrefix + d.Name
+}
+
+// ChallengeValue 驗證記錄的期望值
+func (d *Domain) ChallengeValue() string {
+	return challengeValuePrefix + d.Token
+}
+
+// 域名相關錯誤
+//
+// HTTP 狀態碼映射：
+//   - ErrInvalidDomain    → 400 Bad Request
+//   - ErrDomainExists     → 409 Conflict
+//   - ErrDomainNotFound   → 404 Not Found（創建鏈接時為 400）
+//   - ErrDomainUnverified → 422 Unprocessable Entity（創建鏈接時為 400）
+//   - ErrTooManyDomains   → 409 Conflict
+var (
+	// ErrInvalidDomain 當域名格式無效時返回
+	ErrInvalidDomain = errors.New("invalid domain name")
+
+	// ErrDomainExists 當域名已被註冊時返回（無論是否屬於當前用戶）
+	ErrDomainExists = errors.New("domain already registered")
+
+	// ErrDomainNotFound 當域名不存在或不屬於當前用戶時返回
+	ErrDomainNotFound = errors.New("domain not found")
+
+	// ErrDomainUnverified 當域名尚未通過 DNS 驗證時返回
+	ErrDomainUnverified = errors.New("domain is not verified")
+
+	// ErrTooManyDomains 當用戶的域名數達到上限時返回
+	ErrTooManyDomains = errors.New("too many domains")
+)
+
+// DomainVerifier 域名所有權驗證接口
+//
+// 為什麼抽象成接口？
+//   - 本地開發沒有可控的公網 DNS，需要一個總是通過的替身（StubVerifier）
+//   - 測試不依賴網絡
+type DomainVerifier interface {
+	// Verify 檢查驗證記錄，記錄不存在或不匹配時返回 ErrDomainUnverified
+	Verify(ctx context.Context, d *Domain) error
+}
+
+// DNSVerifier 通過 DNS TXT 記錄驗證域名所有權
+type DNSVerifier struct {
+	Resolver *net.Resolver // nil 時使用 net.DefaultResolver
+}
+
+// Verify 查詢 ChallengeName 的 TXT 記錄，任一條等於 ChallengeValue 即通過
+//
+// 錯誤區分：
+//   - 記錄不存在（NXDOMAIN）或值不匹配 → ErrDomainUnverified（用戶還沒配置好）
+//   - 其他 DNS 錯誤（超時等）→ 原樣返回（服務端問題，用戶可重試）
+func (v DNSVerifier) Verify(ctx context.Context, d *Domain) error {
+	resolver := v.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	records, err := resolver.LookupTXT(ctx, d.ChallengeName())
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return ErrDomainUnverified
+		}
+		return err
+	}
+
+	if !slices.Contains(records, d.ChallengeValue()) {
+		return ErrDomainUnverified
+	}
+	return nil
+}
+
+// StubVerifier 總是通過的驗證器（僅用於本地開發與測試）
+type StubVerifier struct{}
+
+// Verify 不做任何檢查
+func (StubVerifier) Verify(ctx context.Context, d *Domain) error {
+	return nil
+}
+
+// AddDomain 註冊自定義域名（未驗證狀態）
+//
+// 返回的 Domain 包含驗證令牌，調用方據此提示用戶添加 TXT 記錄
+//
+// 為什麼域名全局唯一，而不是每個用戶各自註冊？
+//   - 同一 Host 只能路由到一個用戶的鏈接
+//   - 先註冊者在驗證前佔住域名的問題：未驗證的域名不參與路由，
+//     且超過 DomainClaimTTL 仍未驗證時可被其他用戶重新註冊
+func AddDomain(ctx context.Context, store Store, user *User, name string) (*Domain, error) {
+	name, err := NormalizeDomain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := store.ListDomains(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(owned) >= MaxDomainsPerOwner {
+		return nil, ErrTooManyDomains
+	}
+
+	token, err := generateDomainToken()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Domain{
+		Name:      name,
+		OwnerID:   user.ID,
+		Token:     token,
+		CreatedAt: time.Now(),
+	}
+	if err := store.SaveDomain(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// VerifyDomain 驗證域名所有權
+//
+// 已驗證的域名直接返回（冪等）
+// 驗證失敗返回 ErrDomainUnverified，用戶可在 DNS 生效後重試
+func VerifyDomain(ctx context.Context, store Store, verifier DomainVerifier, user *User, name string) (*Domain, error) {
+	d, err := loadOwnedDomain(ctx, store, user, name)
+	if err != nil {
+		return nil, err
+	}
+	if d.IsVerified() {
+		return d, nil
+	}
+
+	if err := verifier.Verify(ctx, d); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := store.MarkDomainVerified(ctx, d.Name, d.Token, now); err != nil {
+		return nil, err
+	}
+	d.VerifiedAt = &now
+	return d, nil
+}
+
+// ListDomains 列出用戶註冊的域名
+func ListDomains(ctx context.Context, store Store, user *User) ([]*Domain, error) {
+	return store.ListDomains(ctx, user.ID)
+}
+
+// HostDomain 將請求的 Host 映射為鏈接所屬的域名
+//
+// 返回：
+//   - 已驗證的自定義域名：域名本身
+//   - 其他（默認域名、未註冊、未驗證、IP 地址）：""（默認域名）
+//
+// 調用頻率與重定向相同，調用方應快取結果（見 handler 的 hostCache）
+func HostDomain(ctx context.Context, store Store, host string) (string, error) {
+	name, err := NormalizeDomain(host)
+	if err != nil {
+		return "", nil
+	}
+
+	d, err := store.LoadDomain(ctx, name)
+	if err != nil {
+		if errors.Is(err, ErrDomainNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !d.IsVerified() {
+		return "", nil
+	}
+	return d.Name, nil
+}
+
+// NormalizeDomain 校驗並規範化域名
+//
+// 規則：
+//   - 去掉端口、結尾的點，轉小寫
+//   - 至少兩段，每段 1-63 字符，只含字母、數字、連字符，且不以連字符開頭或結尾
+//   - 總長度不超過 253
+//   - 不接受 IP 地址（無法做 DNS 驗證，也沒有品牌價值）
+func NormalizeDomain(name string) (string, error) {
+	if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+
+	if len(name) == 0 || len(name) > 253 || net.ParseIP(name) != nil {
+		return "", ErrInvalidDomain
+	}
+
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return "", ErrInvalidDomain
+	}
+	for _, label := range labels {
+		if !isValidLabel(label) {
+			return "", ErrInvalidDomain
+		}
+	}
+	return name, nil
+}
+
+// isValidLabel 檢查域名的單個標籤（LDH 規則）
+func isValidLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 {
+		return false
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// QualifiedCode 帶域名的短碼標識（如 "go.ourbrand.com/launch"，默認域名時即短碼本身）
+//
+// 用於快取鍵、日誌、標記登記等需要全局唯一字符串的場合
+func QualifiedCode(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+// checkDomain 檢查創建鏈接時指定的域名（必須屬於創建者且已驗證）
+//
+// 返回規範化後的域名；空字符串表示默認域名
+//
+// 不屬於創建者的域名返回 ErrDomainNotFound：不透露其他用戶註冊了哪些域名
+func checkDomain(ctx context.Context, store Store, name string, ownerID int64) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	name, err := NormalizeDomain(name)
+	if err != nil {
+		return "", err
+	}
+
+	d, err := store.LoadDomain(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if ownerID == 0 || d.OwnerID != ownerID {
+		return "", ErrDomainNotFound
+	}
+	if !d.IsVerified() {
+		return "", ErrDomainUnverified
+	}
+	return d.Name, nil
+}
+
+// loadOwnedDomain 加載域名並檢查歸屬（不屬於當前用戶時返回 ErrDomainNotFound）
+func loadOwnedDomain(ctx context.Context, store Store, user *User, name string) (*Domain, error) {
+	name, err := NormalizeDomain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := store.LoadDomain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if d.OwnerID != user.ID {
+		return nil, ErrDomainNotFound
+	}
+	return d, nil
+}
+
+// generateDomainToken 生成驗證令牌（128 bit 隨機數，十六進制）
+//
+// 令牌不是秘密（會公開在 DNS 中），只需不可預測：
+// 防止攻擊者提前猜到並在自己控制的域名上「預驗證」
+func generateDomainToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
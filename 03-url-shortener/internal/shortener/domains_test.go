@@ -0,0 +1,250 @@
+package shortener_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"go.ourbrand.com", "go.ourbrand.com"},
+		{"Go.OurBrand.COM", "go.ourbrand.com"},
+		{"go.ourbrand.com:8080", "go.ourbrand.com"},
+		{"go.ourbrand.com.", "go.ourbrand.com"},
+		{"  my-brand.io ", "my-brand.io"},
+		{"a1.b2.c3", "a1.b2.c3"},
+		{"", ""},
+		{"localhost", ""},
+		{"localhost:8080", ""},
+		{"127.0.0.1", ""},
+		{"[::1]:8080", ""},
+		{"-brand.com", ""},
+		{"brand-.com", ""},
+		{"go..brand.com", ""},
+		{"go_brand.com", ""},
+		{"brand.com/path", ""},
+		{strings.Repeat("a", 64) + ".com", ""},
+		{strings.Repeat("a.", 127) + "com", ""}, // 257 字符
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := shortener.NormalizeDomain(tt.input)
+			if tt.want == "" {
+				if !errors.Is(err, shortener.ErrInvalidDomain) {
+					t.Errorf("NormalizeDomain(%q) = %q, %v, want ErrInvalidDomain", tt.input, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizeDomain(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// fakeResolver 返回固定 TXT 記錄的解析器
+//
+// 通過 net.Pipe 應答 DNS 查詢（TCP 報文格式），不訪問網絡；不在 records 中的名稱返回 NXDOMAIN
+func fakeResolver(records map[string][]string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveDNS(server, records)
+			return client, nil
+		},
+	}
+}
+
+// serveDNS 應答一個 DNS 查詢
+func serveDNS(conn net.Conn, records map[string][]string) {
+	defer conn.Close()
+
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return
+	}
+	query := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, query); err != nil {
+		return
+	}
+
+	// 問題段：長度前綴的標籤序列，以 0 結尾，後跟 QTYPE、QCLASS
+	var labels []string
+	end := 12
+	for query[end] != 0 {
+		n := int(query[end])
+		labels = append(labels, string(query[end+1:end+1+n]))
+		end += 1 + n
+	}
+	end += 5
+	txts, found := records[strings.Join(labels, ".")]
+
+	flags := uint16(0x8180) // QR + RD + RA
+	if !found {
+		flags |= 3 // NXDOMAIN
+	}
+	resp := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	resp = binary.BigEndian.AppendUint16(resp, flags)
+	resp = binary.BigEndian.AppendUint16(resp, 1)                 // QDCOUNT
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(txts))) // ANCOUNT
+	resp = binary.BigEndian.AppendUint32(resp, 0)                 // NSCOUNT + ARCOUNT
+	resp = append(resp, query[12:end]...)
+	for _, txt := range txts {
+		resp = append(resp, 0xC0, 12)                 // 名稱指針 → 問題段
+		resp = append(resp, 0, 16, 0, 1, 0, 0, 0, 60) // TXT, IN, TTL 60
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(txt)+1))
+		resp = append(resp, byte(len(txt)))
+		resp = append(resp, txt...)
+	}
+
+	conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(resp))))
+	conn.Write(resp)
+}
+
+func TestDNSVerifier(t *testing.T) {
+	d := &shortener.Domain{Name: "go.ourbrand.com", Token: "0123456789abcdef0123456789abcdef"}
+
+	tests := []struct {
+		name    string
+		records map[string][]string
+		want    error
+	}{
+		{"match", map[string][]string{d.ChallengeName(): {"v=spf1 -all", d.ChallengeValue()}}, nil},
+		{"wrong token", map[string][]string{d.ChallengeName(): {"shortener-verification=other"}}, shortener.ErrDomainUnverified},
+		{"record on the domain itself", map[string][]string{d.Name: {d.ChallengeValue()}}, shortener.ErrDomainUnverified},
+		{"no record", nil, shortener.ErrDomainUnverified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := shortener.DNSVerifier{Resolver: fakeResolver(tt.records)}
+			if err := v.Verify(context.Background(), d); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// DNS 服務不可用：返回原始錯誤（可重試），而不是「未驗證」
+	v := shortener.DNSVerifier{Resolver: &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}}
+	if err := v.Verify(context.Background(), d); err == nil || errors.Is(err, shortener.ErrDomainUnverified) {
+		t.Errorf("Verify() with DNS down error = %v, want a DNS error", err)
+	}
+}
+
+// verifierFunc 測試用驗證器
+type verifierFunc func(d *shortener.Domain) error
+
+func (f verifierFunc) Verify(ctx context.Context, d *shortener.Domain) error {
+	return f(d)
+}
+
+func TestVerifyDomain(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	idgen := newGenerator(t)
+	owner, _, _ := shortener.Register(ctx, store, idgen, "owner@example.com")
+	other, _, _ := shortener.Register(ctx, store, idgen, "other@example.com")
+
+	d, err := shortener.AddDomain(ctx, store, owner, "Go.OurBrand.com")
+	if err != nil {
+		t.Fatalf("AddDomain() error = %v", err)
+	}
+	if d.Name != "go.ourbrand.com" || d.IsVerified() || len(d.Token) != 32 {
+		t.Fatalf("AddDomain() = %+v, want an unverified normalized domain with a token", d)
+	}
+
+	// 未驗證：不參與 Host 路由
+	if got, _ := shortener.HostDomain(ctx, store, "go.ourbrand.com"); got != "" {
+		t.Errorf("HostDomain() before verification = %q, want default domain", got)
+	}
+
+	if _, err := shortener.VerifyDomain(ctx, store, shortener.StubVerifier{}, other, d.Name); !errors.Is(err, shortener.ErrDomainNotFound) {
+		t.Errorf("VerifyDomain() by another user error = %v, want ErrDomainNotFound", err)
+	}
+	failing := verifierFunc(func(*shortener.Domain) error { return shortener.ErrDomainUnverified })
+	if _, err := shortener.VerifyDomain(ctx, store, failing, owner, d.Name); !errors.Is(err, shortener.ErrDomainUnverified) {
+		t.Errorf("VerifyDomain() without record error = %v, want ErrDomainUnverified", err)
+	}
+
+	var checked string
+	verifier := verifierFunc(func(d *shortener.Domain) error { checked = d.ChallengeValue(); return nil })
+	got, err := shortener.VerifyDomain(ctx, store, verifier, owner, "go.ourbrand.com:443")
+	if err != nil || !got.IsVerified() {
+		t.Fatalf("VerifyDomain() = %+v, %v, want verified", got, err)
+	}
+	if checked != d.ChallengeValue() {
+		t.Errorf("verifier checked %q, want %q", checked, d.ChallengeValue())
+	}
+	if got, _ := shortener.HostDomain(ctx, store, "GO.ourbrand.com:8080"); got != "go.ourbrand.com" {
+		t.Errorf("HostDomain() after verification = %q, want go.ourbrand.com", got)
+	}
+
+	// 已驗證的域名不能被重新註冊
+	if _, err := shortener.AddDomain(ctx, store, other, d.Name); !errors.Is(err, shortener.ErrDomainExists) {
+		t.Errorf("AddDomain() of a verified domain error = %v, want ErrDomainExists", err)
+	}
+}
+
+func TestAddDomainStaleClaim(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	idgen := newGenerator(t)
+	squatter, _, _ := shortener.Register(ctx, store, idgen, "squatter@example.com")
+	owner, _, _ := shortener.Register(ctx, store, idgen, "owner@example.com")
+
+	fresh, err := shortener.AddDomain(ctx, store, squatter, "fresh.example.com")
+	if err != nil {
+		t.Fatalf("AddDomain() error = %v", err)
+	}
+	if _, err := shortener.AddDomain(ctx, store, owner, fresh.Name); !errors.Is(err, shortener.ErrDomainExists) {
+		t.Errorf("AddDomain() over a fresh claim error = %v, want ErrDomainExists", err)
+	}
+
+	// 超過 DomainClaimTTL 仍未驗證：真正的所有者可以重新認領
+	stale := &shortener.Domain{
+		Name:      "stale.example.com",
+		OwnerID:   squatter.ID,
+		Token:     "0123456789abcdef0123456789abcdef",
+		CreatedAt: time.Now().Add(-shortener.DomainClaimTTL - time.Hour),
+	}
+	if err := store.SaveDomain(ctx, stale); err != nil {
+		t.Fatalf("SaveDomain() error = %v", err)
+	}
+	claimed, err := shortener.AddDomain(ctx, store, owner, stale.Name)
+	if err != nil {
+		t.Fatalf("AddDomain() over a stale claim error = %v", err)
+	}
+	if claimed.Token == stale.Token {
+		t.Error("reclaimed domain kept the previous token")
+	}
+
+	// 原註冊者不再擁有該域名，舊令牌也不能驗證新記錄
+	if _, err := shortener.VerifyDomain(ctx, store, shortener.StubVerifier{}, squatter, stale.Name); !errors.Is(err, shortener.ErrDomainNotFound) {
+		t.Errorf("VerifyDomain() by the previous claimant error = %v, want ErrDomainNotFound", err)
+	}
+	if err := store.MarkDomainVerified(ctx, stale.Name, stale.Token, time.Now()); !errors.Is(err, shortener.ErrDomainNotFound) {
+		t.Errorf("MarkDomainVerified() with the old token error = %v, want ErrDomainNotFound", err)
+	}
+	if d, _ := store.LoadDomain(ctx, stale.Name); d.OwnerID != owner.ID || d.IsVerified() {
+		t.Errorf("LoadDomain() = %+v, want owned by the new claimant and unverified", d)
+	}
+}
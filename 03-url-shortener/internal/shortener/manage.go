@@ -0,0 +1,129 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TombstoneCooldown 刪除後短碼的保留期
+//
+// 系統設計考量：
+//   - 太短：舊鏈接的訪客被導向搶註者的目標
+//   - 太長：用戶誤刪後無法重新創建同名短碼
+//   - 折衷：30 天（大部分分享流量在幾天內衰減）
+const TombstoneCooldown = 30 * 24 * time.Hour
+
+// UpdateRequest 更新短網址的參數（PATCH 語義：nil 表示不修改）
+type UpdateRequest struct {
+	LongURL     *string    // 新目標 URL
+	ExpiresAt   *time.Time // 新過期時間
+	ClearExpiry bool       // 移除過期時間（改為永不過期）
+	Rules       *[]Rule    // 新路由規則（指向空切片表示清除所有規則）
+	Password    *string    // 新訪問密碼（指向空字符串表示移除密碼）
+	MaxClicks   *int64     // 新點擊上限（指向 0 表示不限）
+}
+
+// Update 修改短網址的目標、過期時間、路由規則、密碼或點擊上限
+//
+// 流程：
+//  1. 加載並檢查歸屬
+//  2. 驗證新目標（與創建時相同的規則，包括 SSRF 防護與惡意篩查）
+//  3. 只寫入修改的字段（快取層負責失效），返回存儲層中更新後的記錄
+//
+// 加載的記錄只用於檢查歸屬（OwnerID 創建後不變，來自快取也可靠），
+// 不作為寫回的基礎：併發的修改不會被這裡讀到的舊值覆蓋（見 URLChanges）
+func Update(ctx context.Context, store Store, screener Screener, user *User, domain, shortCode string, req UpdateRequest) (*URL, error) {
+	if _, err := loadOwned(ctx, store, user, domain, shortCode); err != nil {
+		return nil, err
+	}
+
+	changes := URLChanges{
+		ExpiresAt:   req.ExpiresAt,
+		ClearExpiry: req.ClearExpiry,
+		MaxClicks:   req.MaxClicks,
+	}
+
+	if req.LongURL != nil {
+		if !isValidURL(*req.LongURL) {
+			return nil, ErrInvalidURL
+		}
+
+		// 修改目標是常見的繞過手法（先縮短正常頁面再換成惡意目標）
+		verdict, err := screen(ctx, screener, *req.LongURL)
+		if err != nil {
+			return nil, err
+		}
+		if verdict.Action != ActionAllow {
+			return nil, fmt.Errorf("%w: %s", ErrBlocked, verdict.Rule)
+		}
+		changes.LongURL = req.LongURL
+	}
+
+	if req.Rules != nil {
+		rules, err := checkRules(ctx, screener, *req.Rules)
+		if err != nil {
+			return nil, err
+		}
+		changes.Rules = &rules
+	}
+
+	if req.MaxClicks != nil {
+		if err := checkMaxClicks(*req.MaxClicks); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Password != nil {
+		var hash string
+		if *req.Password != "" {
+			var err error
+			if hash, err = hashPassword(*req.Password); err != nil {
+				return nil, err
+			}
+		}
+		changes.PasswordHash = &hash
+	}
+
+	return store.Update(ctx, domain, shortCode, changes)
+}
+
+// SetDisabled 停用或啟用短網址
+//
+// 停用與刪除的區別：
+//   - 停用：可逆，保留統計數據，短碼仍被佔用
+//   - 刪除：不可逆，短碼進入冷卻期後可被重新註冊
+//
+// 冪等：重複停用結果相同；不以讀到的狀態跳過寫入（可能是快取中的舊值）
+func SetDisabled(ctx context.Context, store Store, user *User, domain, shortCode string, disabled bool) (*URL, error) {
+	if _, err := loadOwned(ctx, store, user, domain, shortCode); err != nil {
+		return nil, err
+	}
+	return store.Update(ctx, domain, shortCode, URLChanges{Disabled: &disabled})
+}
+
+// Delete 刪除短網址
+//
+// 刪除後短碼在 TombstoneCooldown 內不可在同一域名下被重新註冊
+func Delete(ctx context.Context, store Store, user *User, domain, shortCode string) error {
+	if _, err := loadOwned(ctx, store, user, domain, shortCode); err != nil {
+		return err
+	}
+	return store.Delete(ctx, domain, shortCode, time.Now().Add(TombstoneCooldown))
+}
+
+// loadOwned 加載短網址並檢查歸屬
+//
+// 為什麼匿名鏈接（OwnerID = 0）也返回 ErrForbidden？
+//   - 匿名鏈接沒有可驗證的擁有者，任何人都不能修改
+//   - 需要下架時由管理員直接操作資料庫
+func loadOwned(ctx context.Context, store Store, user *User, domain, shortCode string) (*URL, error) {
+	url, err := store.Load(ctx, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if url.OwnerID == 0 || url.OwnerID != user.ID {
+		return nil, ErrForbidden
+	}
+	return url, nil
+}
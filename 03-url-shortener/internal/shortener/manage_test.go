@@ -0,0 +1,200 @@
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+)
+
+// 使用 IP 字面量作為目標：isValidURL 對域名會做 DNS 查詢
+const target = "https://93.184.216.34/page"
+
+func seed(t *testing.T, store shortener.Store, owner int64, code string) {
+	t.Helper()
+	url := &shortener.URL{ID: time.Now().UnixNano(), ShortCode: code, LongURL: target, OwnerID: owner, CreatedAt: time.Now()}
+	if err := store.Save(context.Background(), url); err != nil {
+		t.Fatalf("Save(%s) error = %v", code, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	owner := &shortener.User{ID: 1}
+	seed(t, store, owner.ID, "promo")
+
+	newTarget := "https://93.184.216.34/new"
+	expires := time.Now().Add(24 * time.Hour)
+	url, err := shortener.Update(ctx, store, nil, owner, "", "promo", shortener.UpdateRequest{LongURL: &newTarget, ExpiresAt: &expires})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if url.LongURL != newTarget || url.ExpiresAt == nil {
+		t.Errorf("Update() = %+v", url)
+	}
+
+	url, err = shortener.Update(ctx, store, nil, owner, "", "promo", shortener.UpdateRequest{ClearExpiry: true})
+	if err != nil || url.ExpiresAt != nil {
+		t.Errorf("Update(ClearExpiry) = %+v, %v, want no expiry", url, err)
+	}
+
+	// 沒有修改的字段保持不變
+	stored, _ := store.Load(ctx, "", "promo")
+	if stored.LongURL != newTarget || stored.ExpiresAt != nil {
+		t.Errorf("stored = %+v", stored)
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	owner := &shortener.User{ID: 1}
+	seed(t, store, owner.ID, "promo")
+	seed(t, store, 0, "anon")
+
+	private := "http://192.168.1.1/admin"
+	tests := []struct {
+		name string
+		user *shortener.User
+		code string
+		req  shortener.UpdateRequest
+		want error
+	}{
+		{"other user", &shortener.User{ID: 2}, "promo", shortener.UpdateRequest{}, shortener.ErrForbidden},
+		{"anonymous link", owner, "anon", shortener.UpdateRequest{}, shortener.ErrForbidden},
+		{"missing", owner, "nope", shortener.UpdateRequest{}, shortener.ErrNotFound},
+		{"private target", owner, "promo", shortener.UpdateRequest{LongURL: &private}, shortener.ErrInvalidURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := shortener.Update(ctx, store, nil, tt.user, "", tt.code, tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("Update() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// staleStore Load 返回固定快照的存儲（模擬其他副本尚未失效的快取）
+type staleStore struct {
+	shortener.Store
+	snapshot *shortener.URL
+}
+
+func (s staleStore) Load(ctx context.Context, domain, shortCode string) (*shortener.URL, error) {
+	url := *s.snapshot
+	return &url, nil
+}
+
+// TestUpdateStaleRead 讀到舊記錄時，修改一個字段不會把其他字段寫回舊值。
+func TestUpdateStaleRead(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	owner := &shortener.User{ID: 1}
+	seed(t, store, owner.ID, "promo")
+	snapshot, _ := store.Load(ctx, "", "promo")
+
+	// 快照之後，另一個請求停用了鏈接
+	if _, err := shortener.SetDisabled(ctx, store, owner, "", "promo", true); err != nil {
+		t.Fatalf("SetDisabled() error = %v", err)
+	}
+
+	stale := staleStore{Store: store, snapshot: snapshot}
+	newTarget := "https://93.184.216.34/new"
+	url, err := shortener.Update(ctx, stale, nil, owner, "", "promo", shortener.UpdateRequest{LongURL: &newTarget})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if url.LongURL != newTarget || !url.Disabled {
+		t.Errorf("Update() = %+v, want the new target and the link still disabled", url)
+	}
+
+	// 快照中是啟用狀態：SetDisabled 不能因此跳過寫入
+	snapshot.Disabled = true
+	if _, err := shortener.SetDisabled(ctx, staleStore{Store: store, snapshot: snapshot}, owner, "", "promo", false); err != nil {
+		t.Fatalf("SetDisabled(false) error = %v", err)
+	}
+	if stored, _ := store.Load(ctx, "", "promo"); stored.Disabled || stored.LongURL != newTarget {
+		t.Errorf("stored = %+v, want enabled with the new target", stored)
+	}
+}
+
+// TestUpdateConcurrentFields 併發修改不同字段，兩個修改都保留。
+func TestUpdateConcurrentFields(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	owner := &shortener.User{ID: 1}
+	seed(t, store, owner.ID, "promo")
+
+	newTarget := "https://93.184.216.34/new"
+	maxClicks := int64(100)
+	var wg sync.WaitGroup
+	for _, req := range []shortener.UpdateRequest{{LongURL: &newTarget}, {MaxClicks: &maxClicks}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := shortener.Update(ctx, store, nil, owner, "", "promo", req); err != nil {
+				t.Errorf("Update() error = %v", err)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := shortener.SetDisabled(ctx, store, owner, "", "promo", true); err != nil {
+			t.Errorf("SetDisabled() error = %v", err)
+		}
+	}()
+	wg.Wait()
+
+	stored, _ := store.Load(ctx, "", "promo")
+	if stored.LongURL != newTarget || stored.MaxClicks != maxClicks || !stored.Disabled {
+		t.Errorf("stored = %+v, want all three changes", stored)
+	}
+}
+
+func TestSetDisabled(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	owner := &shortener.User{ID: 1}
+	seed(t, store, owner.ID, "promo")
+
+	for _, disabled := range []bool{true, true, false} {
+		url, err := shortener.SetDisabled(ctx, store, owner, "", "promo", disabled)
+		if err != nil {
+			t.Fatalf("SetDisabled(%v) error = %v", disabled, err)
+		}
+		if url.Disabled != disabled {
+			t.Errorf("SetDisabled(%v) = %v", disabled, url.Disabled)
+		}
+	}
+
+	if _, err := shortener.SetDisabled(ctx, store, &shortener.User{ID: 2}, "", "promo", true); !errors.Is(err, shortener.ErrForbidden) {
+		t.Errorf("SetDisabled by other user error = %v, want ErrForbidden", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	owner := &shortener.User{ID: 1}
+	seed(t, store, owner.ID, "promo")
+
+	if err := shortener.Delete(ctx, store, &shortener.User{ID: 2}, "", "promo"); !errors.Is(err, shortener.ErrForbidden) {
+		t.Fatalf("Delete by other user error = %v, want ErrForbidden", err)
+	}
+	if err := shortener.Delete(ctx, store, owner, "", "promo"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	// 刪除後短碼進入冷卻期
+	err := store.Save(ctx, &shortener.URL{ID: 99, ShortCode: "promo", LongURL: target, CreatedAt: time.Now()})
+	if !errors.Is(err, shortener.ErrCodeReserved) {
+		t.Errorf("Save after Delete error = %v, want ErrCodeReserved", err)
+	}
+}
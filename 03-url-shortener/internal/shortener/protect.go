@@ -0,0 +1,66 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 鏈接密碼限制
+//
+// 為什麼上限是 72 字節？bcrypt 只使用前 72 字節，更長的部分會被靜默忽略
+const (
+	MinPasswordLength = 4
+	MaxPasswordLength = 72
+)
+
+// passwordCost bcrypt 的計算成本（2^cost 輪）
+//
+// 系統設計考量：
+//   - 默認 10：單次驗證約 50-100ms
+//   - 對訪客：只在提交密碼時付出一次，可接受
+//   - 對攻擊者：每秒每核只能嘗試約 10-20 次，配合限流使暴力破解不可行
+//   - 權衡：成本過高時，大量並發的密碼提交本身就能耗盡 CPU
+var passwordCost = bcrypt.DefaultCost
+
+// hashPassword 校驗並哈希鏈接密碼
+//
+// 為什麼用 bcrypt 而不是 SHA-256（API Key 用的是後者）？
+//   - 鏈接密碼由人設定，熵很低，常見密碼可被字典攻擊
+//   - bcrypt 自帶隨機鹽且故意緩慢，資料庫洩漏後也難以批量還原
+//   - API Key 是高熵隨機數，不存在這個問題（見 User 的說明）
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return "", fmt.Errorf("%w: must be %d-%d bytes", ErrInvalidPassword, MinPasswordLength, MaxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword 驗證訪客提交的密碼
+//
+// 返回 ErrPasswordRequired（未提交）或 ErrWrongPassword（不匹配）
+//
+// bcrypt.CompareHashAndPassword 內部使用常數時間比較，不洩漏時序信息
+func checkPassword(hash, password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrWrongPassword
+	}
+	return err
+}
+
+// checkMaxClicks 校驗點擊上限（0 表示不限）
+func checkMaxClicks(maxClicks int64) error {
+	if maxClicks < 0 {
+		return fmt.Errorf("%w: must not be negative", ErrInvalidMaxClicks)
+	}
+	return nil
+}
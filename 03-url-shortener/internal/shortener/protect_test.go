@@ -0,0 +1,92 @@
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+)
+
+func TestShortenPassword(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+
+	url, err := shortener.Shorten(ctx, store, newGenerator(t), nil, shortener.ShortenRequest{LongURL: target, CustomCode: "secret", Password: "hunter22"})
+	if err != nil {
+		t.Fatalf("Shorten() error = %v", err)
+	}
+	if !url.IsProtected() || strings.Contains(url.PasswordHash, "hunter22") {
+		t.Errorf("PasswordHash = %q, want a bcrypt hash of the password", url.PasswordHash)
+	}
+
+	for _, password := range []string{"abc", strings.Repeat("x", shortener.MaxPasswordLength+1)} {
+		_, err := shortener.Shorten(ctx, store, newGenerator(t), nil, shortener.ShortenRequest{LongURL: target, Password: password})
+		if !errors.Is(err, shortener.ErrInvalidPassword) {
+			t.Errorf("Shorten(password of %d bytes) error = %v, want ErrInvalidPassword", len(password), err)
+		}
+	}
+}
+
+func TestResolveProtected(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	_, err := shortener.Shorten(ctx, store, newGenerator(t), nil, shortener.ShortenRequest{LongURL: target, CustomCode: "secret", Password: "hunter22", MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("Shorten() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"no password", "", shortener.ErrPasswordRequired},
+		{"wrong password", "hunter2", shortener.ErrWrongPassword},
+		{"unlock", "hunter22", nil},
+		{"used up", "hunter22", shortener.ErrClickLimitReached},
+	}
+
+	// 按順序執行：密碼錯誤不消耗點擊次數，正確密碼用掉唯一的一次
+	for _, tt := range tests {
+		dest, err := shortener.Resolve(ctx, store, nil, "", "secret", shortener.Visitor{Password: tt.password})
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s: Resolve() error = %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want == nil && dest.URL != target {
+			t.Errorf("%s: Resolve() = %+v, want %s", tt.name, dest, target)
+		}
+	}
+}
+
+func TestResolveMaxClicks(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	_, err := shortener.Shorten(ctx, store, newGenerator(t), nil, shortener.ShortenRequest{LongURL: target, CustomCode: "limited", MaxClicks: 3})
+	if err != nil {
+		t.Fatalf("Shorten() error = %v", err)
+	}
+
+	// 併發打開：條件遞增保證恰好 MaxClicks 次重定向成功
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make(map[error]int)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := shortener.Resolve(ctx, store, nil, "", "limited", shortener.Visitor{})
+			mu.Lock()
+			results[err]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if results[nil] != 3 || results[shortener.ErrClickLimitReached] != 17 {
+		t.Errorf("Resolve results = %v, want 3 successes and 17 ErrClickLimitReached", results)
+	}
+}
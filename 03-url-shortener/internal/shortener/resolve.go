@@ -5,22 +5,26 @@ import (
 	"time"
 )
 
-// Resolve 將短碼解析為長 URL
+// Resolve 將短碼解析為重定向目標
 //
 // 參數：
 //   - ctx：上下文（用於超時控制）
 //   - store：存儲接口
+//   - domain：請求的域名（由 Host 映射，見 HostDomain；空字符串為默認域名）
 //   - shortCode：短碼（如 "8M0kX"）
+//   - visitor：訪客特徵（平台、國家、分流黏性鍵、提交的密碼），用於評估路由規則
 //
 // 返回：
-//   - 長 URL（如 "https://example.com/very/long/url"）
-//   - 錯誤（ErrNotFound、ErrExpired 或存儲錯誤）
+//   - 目標 URL 與命中的變體名（無規則時為長 URL 與 DefaultVariant）
+//   - 錯誤（ErrNotFound、ErrExpired、ErrDisabled、ErrPasswordRequired、
+//     ErrWrongPassword、ErrClickLimitReached 或存儲錯誤）
 //
 // 算法流程：
 //  1. 從存儲層加載 URL 記錄
-//  2. 檢查是否過期
-//  3. 異步增加點擊計數（不阻塞重定向）
-//  4. 返回長 URL
+//  2. 檢查是否過期、是否停用、密碼是否正確
+//  3. 按順序評估路由規則，選出目標
+//  4. 增加點擊計數（限次鏈接同步、原子；其餘異步，不阻塞重定向）
+//  5. 返回目標
 //
 // 系統設計考量：
 //   - 性能優化：這是最高頻的操作（每次點擊短鏈都會調用）
@@ -35,16 +39,16 @@ import (
 //     1. Redis 快取（熱點數據）
 //     2. 異步統計（點擊計數）
 //     3. 連接池（資料庫）
-func Resolve(ctx context.Context, store Store, shortCode string) (string, error) {
+func Resolve(ctx context.Context, store Store, screener Screener, domain, shortCode string, visitor Visitor) (Destination, error) {
 	// 1. 從存儲層加載 URL 記錄
 	//
 	// 系統設計考量：
 	//   - 這裡會先查 Redis 快取（由存儲層實現）
 	//   - Cache Miss 時查資料庫
 	//   - 使用 Cache-Aside 模式（詳見 storage 實現）
-	urlRecord, err := store.Load(ctx, shortCode)
+	urlRecord, err := store.Load(ctx, domain, shortCode)
 	if err != nil {
-		return "", err
+		return Destination{}, err
 	}
 
 	// 2. 檢查過期
@@ -53,11 +57,59 @@ func Resolve(ctx context.Context, store Store, shortCode string) (string, error)
 	//   - 業務邏輯應該在業務層
 	//   - 存儲層只負責數據的 CRUD
 	//   - 過期檢查是業務規則，不是存儲規則
-	if urlRecord.IsExpired() {
-		return "", ErrExpired
+	//
+	// 同時檢查停用與點擊上限（見 CheckAvailable）
+	if err := CheckAvailable(urlRecord); err != nil {
+		return Destination{}, err
+	}
+
+	// 密碼檢查
+	//
+	// 放在計數之前：輸入密碼頁、密碼錯誤都不消耗點擊次數
+	if urlRecord.IsProtected() {
+		if err := checkPassword(urlRecord.PasswordHash, visitor.Password); err != nil {
+			return Destination{}, err
+		}
+	}
+
+	// 3. 評估路由規則
+	//
+	// 規則隨 URL 記錄一起快取，評估是純內存操作（無額外 I/O）
+	dest := route(urlRecord, visitor)
+
+	// 重新篩查目標（實際要跳轉的目標，而不只是 LongURL）
+	//
+	// 為什麼每次重定向都要檢查？
+	//   - 黑名單持續更新，創建時乾淨的目標之後可能被標記
+	//   - 攻擊者常見手法：先縮短正常頁面，再把目標頁換成釣魚內容
+	//   - 本地黑名單是內存查詢（微秒級），不影響延遲目標
+	//
+	// 命中時不計點擊：訪客尚未被重定向
+	verdict, err := screen(ctx, screener, dest.URL)
+	if err != nil {
+		return Destination{}, err
+	}
+	if verdict.Action != ActionAllow {
+		return Destination{}, &FlaggedError{
+			ShortCode: QualifiedCode(domain, shortCode),
+			LongURL:   dest.URL,
+			Verdict:   verdict,
+		}
+	}
+
+	// 4. 增加點擊計數
+	//
+	// 限次鏈接：計數即訪問權，必須同步完成
+	//   - 條件遞增成功才允許重定向（最後一次之後的併發點擊都會拿到 ErrClickLimitReached）
+	//   - 代價：多一次同步寫入，但這類鏈接（敏感文檔、一次性邀請）流量很低
+	if urlRecord.MaxClicks > 0 {
+		if _, err := store.IncrementClicks(ctx, domain, shortCode, urlRecord.MaxClicks); err != nil {
+			return Destination{}, err
+		}
+		return dest, nil
 	}
 
-	// 3. 增加點擊計數
+	// 不限次數的鏈接
 	//
 	// 系統設計考量：
 	//   - 異步操作：使用 goroutine，不阻塞重定向
@@ -83,11 +135,34 @@ func Resolve(ctx context.Context, store Store, shortCode string) (string, error)
 		clickCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		_ = store.IncrementClicks(clickCtx, shortCode)
+		_, _ = store.IncrementClicks(clickCtx, domain, shortCode, 0)
 		// 忽略錯誤（統計失敗不影響重定向）
 		// 生產環境應該：記錄錯誤日誌、監控失敗率
 	}()
 
-	// 4. 返回長 URL
-	return urlRecord.LongURL, nil
+	// 5. 返回目標
+	return dest, nil
+}
+
+// CheckAvailable 檢查鏈接當前是否可訪問（重定向與 QR Code 共用）
+//
+// 返回：
+//   - ErrExpired：已過期
+//   - ErrDisabled：已被所有者停用（可逆下架）
+//   - ErrClickLimitReached：點擊次數已用完
+//
+// 不檢查密碼與篩查：前者需要訪客輸入，後者需要先選出實際目標（見 Resolve）
+//
+// 點擊上限基於讀到的 Clicks，可能已過時，只用於提前拒絕：
+// 避免已失效的一次性鏈接還要求訪客輸入密碼
+func CheckAvailable(u *URL) error {
+	switch {
+	case u.IsExpired():
+		return ErrExpired
+	case u.Disabled:
+		return ErrDisabled
+	case u.IsExhausted():
+		return ErrClickLimitReached
+	}
+	return nil
 }
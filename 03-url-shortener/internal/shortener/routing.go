@@ -0,0 +1,247 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"github.com/koopa0/system-design/03-url-shortener/pkg/useragent"
+)
+
+// 路由規則限制
+const (
+	MaxRules       = 20   // 每個短碼最多規則數
+	MaxVariants    = 10   // 每條分流規則最多變體數
+	maxVariantName = 32   // 規則 / 變體名稱最大長度
+	maxWeight      = 1000 // 單個變體最大權重
+
+	// maxVariantLabel 統計中變體標籤的最大長度（與 click_rollups.variant 的 VARCHAR(64) 一致）
+	//
+	// 分流規則的標籤是「規則名/變體名」：兩者各自不超過 32 時合計可達 65，
+	// 因此另外檢查總長度，而非把單個名稱縮短到 31（已保存的規則仍然有效）
+	maxVariantLabel = 64
+)
+
+// DefaultVariant 沒有規則命中時的變體名（目標為 URL.LongURL）
+const DefaultVariant = "default"
+
+// ErrInvalidRules 路由規則格式錯誤
+var ErrInvalidRules = errors.New("invalid routing rules")
+
+// Rule 條件路由規則
+//
+// 規則按順序評估，第一條命中的規則決定目標；都不命中時使用 LongURL
+//
+// 命中條件（同一規則內為 AND，列表內為 OR；空列表表示不限）：
+//   - Platforms：訪客平台（ios / android / desktop / other）
+//   - Countries：訪客國家（ISO 3166-1 alpha-2，由本地 GeoIP 資料庫查詢）
+//
+// 目標（二選一）：
+//   - Target：固定目標
+//   - Split：按權重分流（A/B 測試），同一訪客總是落在同一變體
+//
+// 範例（link-in-bio）：
+//
+//	[
+//	  {"name": "ios", "platforms": ["ios"], "target": "https://apps.apple.com/app/id123"},
+//	  {"name": "android", "platforms": ["android"], "target": "https://play.google.com/store/apps/details?id=com.example"},
+//	  {"name": "tw", "countries": ["TW"], "target": "https://example.com/zh-tw"},
+//	  {"name": "landing", "split": [
+//	    {"name": "a", "target": "https://example.com/a", "weight": 50},
+//	    {"name": "b", "target": "https://example.com/b", "weight": 50}
+//	  ]}
+//	]
+type Rule struct {
+	Name      string               `json:"name"`
+	Platforms []useragent.Platform `json:"platforms,omitempty"`
+	Countries []string             `json:"countries,omitempty"`
+	Target    string               `json:"target,omitempty"`
+	Split     []Variant            `json:"split,omitempty"`
+}
+
+// Variant 分流變體
+type Variant struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Weight int    `json:"weight"` // 相對權重（1-1000），佔比 = weight / 所有權重之和
+}
+
+// Visitor 訪客特徵（由 HTTP 層從請求中提取）
+type Visitor struct {
+	Platform useragent.Platform
+	Country  string // 大寫 ISO 國家代碼，未知為空
+	Key      string // 分流黏性鍵（如 IP + User-Agent）
+	Password string // 訪客提交的密碼（僅受密碼保護的鏈接使用）
+}
+
+// Destination 解析結果
+type Destination struct {
+	URL     string // 重定向目標
+	Variant string // 命中的規則或變體名（無規則命中時為 DefaultVariant）
+}
+
+// route 按規則選擇目標
+//
+// 變體命名：
+//   - 固定目標規則：規則名（如 "ios"）
+//   - 分流規則：規則名/變體名（如 "landing/a"），統計時可區分同名變體
+func route(url *URL, v Visitor) Destination {
+	for _, rule := range url.Rules {
+		if !rule.matches(v) {
+			continue
+		}
+		if len(rule.Split) == 0 {
+			return Destination{URL: rule.Target, Variant: rule.Name}
+		}
+		variant := rule.pick(url.ShortCode, v.Key)
+		return Destination{URL: variant.Target, Variant: rule.Name + "/" + variant.Name}
+	}
+	return Destination{URL: url.LongURL, Variant: DefaultVariant}
+}
+
+// matches 檢查訪客是否命中規則
+func (r Rule) matches(v Visitor) bool {
+	if len(r.Platforms) > 0 && !slices.Contains(r.Platforms, v.Platform) {
+		return false
+	}
+	if len(r.Countries) > 0 && !slices.Contains(r.Countries, v.Country) {
+		return false
+	}
+	return true
+}
+
+// pick 按權重選擇變體
+//
+// 黏性分流（Sticky Assignment）：
+//   - bucket = FNV-1a(shortCode + key) mod 總權重
+//   - 同一訪客多次點擊落在同一變體（體驗一致，轉化率統計才有意義）
+//   - 加入 shortCode：同一訪客在不同實驗中的分組相互獨立
+//   - 無狀態：不需要 Cookie 或存儲分組結果，任意副本計算結果相同
+//
+// 權衡：key 基於 IP + UA，換網絡或換瀏覽器會重新分組
+func (r Rule) pick(shortCode, key string) Variant {
+	total := 0
+	for _, v := range r.Split {
+		total += v.Weight
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(shortCode))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	bucket := int(h.Sum32() % uint32(total))
+
+	for _, v := range r.Split {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return r.Split[len(r.Split)-1]
+}
+
+// checkRules 校驗路由規則，返回規範化後的副本（國家代碼轉大寫、補全規則名）
+//
+// 所有目標與 LongURL 一樣需要通過格式校驗與惡意 URL 篩查
+//
+// 為什麼返回副本？與 ExpiresAt 深拷貝同理，調用方之後修改切片不影響已保存的記錄
+func checkRules(ctx context.Context, screener Screener, in []Rule) ([]Rule, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	if len(in) > MaxRules {
+		return nil, fmt.Errorf("%w: at most %d rules", ErrInvalidRules, MaxRules)
+	}
+
+	rules := make([]Rule, len(in))
+	for i, r := range in {
+		r.Platforms = slices.Clone(r.Platforms)
+		r.Countries = slices.Clone(r.Countries)
+		r.Split = slices.Clone(r.Split)
+		rules[i] = r
+	}
+
+	names := make(map[string]bool)
+	checkName := func(name string) error {
+		if name == "" || len(name) > maxVariantName || strings.ContainsAny(name, "/ ") {
+			return fmt.Errorf("%w: name %q must be 1-%d characters without spaces or slashes", ErrInvalidRules, name, maxVariantName)
+		}
+		if name == DefaultVariant || names[name] {
+			return fmt.Errorf("%w: duplicate or reserved name %q", ErrInvalidRules, name)
+		}
+		names[name] = true
+		return nil
+	}
+	checkTarget := func(target string) error {
+		if !isValidURL(target) {
+			return fmt.Errorf("%w: %q", ErrInvalidURL, target)
+		}
+		verdict, err := screen(ctx, screener, target)
+		if err != nil {
+			return err
+		}
+		if verdict.Action != ActionAllow {
+			return fmt.Errorf("%w: %s", ErrBlocked, verdict.Rule)
+		}
+		return nil
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule%d", i+1)
+		}
+		if err := checkName(rule.Name); err != nil {
+			return nil, err
+		}
+
+		for _, p := range rule.Platforms {
+			switch p {
+			case useragent.IOS, useragent.Android, useragent.DesktopOS, useragent.OtherOS:
+			default:
+				return nil, fmt.Errorf("%w: unknown platform %q", ErrInvalidRules, p)
+			}
+		}
+		for j, c := range rule.Countries {
+			if len(c) != 2 {
+				return nil, fmt.Errorf("%w: country %q must be a 2-letter ISO code", ErrInvalidRules, c)
+			}
+			rule.Countries[j] = strings.ToUpper(c)
+		}
+
+		if (rule.Target == "") == (len(rule.Split) == 0) {
+			return nil, fmt.Errorf("%w: rule %q must have exactly one of target or split", ErrInvalidRules, rule.Name)
+		}
+		if rule.Target != "" {
+			if err := checkTarget(rule.Target); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if len(rule.Split) > MaxVariants {
+			return nil, fmt.Errorf("%w: rule %q has more than %d variants", ErrInvalidRules, rule.Name, MaxVariants)
+		}
+		variantNames := make(map[string]bool)
+		for _, v := range rule.Split {
+			if v.Name == "" || len(v.Name) > maxVariantName || strings.ContainsAny(v.Name, "/ ") || variantNames[v.Name] {
+				return nil, fmt.Errorf("%w: invalid or duplicate variant name %q in rule %q", ErrInvalidRules, v.Name, rule.Name)
+			}
+			variantNames[v.Name] = true
+			if label := rule.Name + "/" + v.Name; len(label) > maxVariantLabel {
+				return nil, fmt.Errorf("%w: variant label %q exceeds %d characters", ErrInvalidRules, label, maxVariantLabel)
+			}
+			if v.Weight < 1 || v.Weight > maxWeight {
+				return nil, fmt.Errorf("%w: variant %q weight must be 1-%d", ErrInvalidRules, v.Name, maxWeight)
+			}
+			if err := checkTarget(v.Target); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rules, nil
+}
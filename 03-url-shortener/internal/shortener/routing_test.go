@@ -0,0 +1,221 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/koopa0/system-design/03-url-shortener/pkg/useragent"
+)
+
+// 使用 IP 字面量作為目標：isValidURL 對域名會做 DNS 查詢
+const (
+	iosTarget     = "https://93.184.216.34/ios"
+	androidTarget = "https://93.184.216.34/android"
+	twTarget      = "https://93.184.216.34/tw"
+	targetA       = "https://93.184.216.34/a"
+	targetB       = "https://93.184.216.34/b"
+	fallback      = "https://93.184.216.34/"
+)
+
+func TestRoute(t *testing.T) {
+	url := &URL{
+		ShortCode: "launch",
+		LongURL:   fallback,
+		Rules: []Rule{
+			{Name: "ios", Platforms: []useragent.Platform{useragent.IOS}, Target: iosTarget},
+			{Name: "android-tw", Platforms: []useragent.Platform{useragent.Android}, Countries: []string{"TW"}, Target: androidTarget},
+			{Name: "tw", Countries: []string{"TW", "HK"}, Target: twTarget},
+			{Name: "landing", Countries: []string{"US"}, Split: []Variant{{Name: "only", Target: targetA, Weight: 1}}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		visitor Visitor
+		want    Destination
+	}{
+		{"platform", Visitor{Platform: useragent.IOS, Country: "TW"}, Destination{iosTarget, "ios"}},
+		{"platform and country", Visitor{Platform: useragent.Android, Country: "TW"}, Destination{androidTarget, "android-tw"}},
+		{"country only", Visitor{Platform: useragent.Android, Country: "HK"}, Destination{twTarget, "tw"}},
+		{"split", Visitor{Platform: useragent.DesktopOS, Country: "US"}, Destination{targetA, "landing/only"}},
+		{"no match", Visitor{Platform: useragent.DesktopOS, Country: "JP"}, Destination{fallback, DefaultVariant}},
+		{"unknown country", Visitor{Platform: useragent.Android}, Destination{fallback, DefaultVariant}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := route(url, tt.visitor); got != tt.want {
+				t.Errorf("route(%+v) = %+v, want %+v", tt.visitor, got, tt.want)
+			}
+		})
+	}
+
+	if got := route(&URL{LongURL: fallback}, Visitor{}); got != (Destination{fallback, DefaultVariant}) {
+		t.Errorf("route(no rules) = %+v", got)
+	}
+}
+
+func TestPickSticky(t *testing.T) {
+	rule := Rule{Name: "landing", Split: []Variant{
+		{Name: "a", Target: targetA, Weight: 50},
+		{Name: "b", Target: targetB, Weight: 50},
+	}}
+
+	// 同一訪客在同一短碼下總是落在同一變體
+	for i := range 100 {
+		key := fmt.Sprintf("203.0.113.%d|Mozilla/5.0", i)
+		first := rule.pick("launch", key)
+		for range 3 {
+			if got := rule.pick("launch", key); got != first {
+				t.Fatalf("pick(%q) = %q then %q, want a stable assignment", key, first.Name, got.Name)
+			}
+		}
+	}
+
+	// 分組與短碼相關：同一批訪客在兩個實驗中的分組不應完全相同
+	same := 0
+	for i := range 100 {
+		key := fmt.Sprintf("203.0.113.%d|Mozilla/5.0", i)
+		if rule.pick("launch", key) == rule.pick("other", key) {
+			same++
+		}
+	}
+	if same == 100 {
+		t.Error("assignments are identical across short codes, want independent experiments")
+	}
+}
+
+func TestPickWeights(t *testing.T) {
+	tests := []struct {
+		name  string
+		split []Variant
+	}{
+		{"even", []Variant{{Name: "a", Weight: 50}, {Name: "b", Weight: 50}}},
+		{"skewed", []Variant{{Name: "a", Weight: 90}, {Name: "b", Weight: 10}}},
+		{"three way", []Variant{{Name: "a", Weight: 1}, {Name: "b", Weight: 2}, {Name: "c", Weight: 1}}},
+		{"single", []Variant{{Name: "a", Weight: 7}}},
+	}
+
+	const visitors = 20000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{Name: "exp", Split: tt.split}
+			total := 0
+			for _, v := range tt.split {
+				total += v.Weight
+			}
+
+			counts := make(map[string]int)
+			for i := range visitors {
+				counts[rule.pick("launch", fmt.Sprintf("visitor-%d", i)).Name]++
+			}
+
+			// FNV 分桶近似均勻：各變體佔比與權重佔比相差不超過 2 個百分點
+			for _, v := range tt.split {
+				want := float64(v.Weight) / float64(total)
+				got := float64(counts[v.Name]) / visitors
+				if math.Abs(got-want) > 0.02 {
+					t.Errorf("variant %s share = %.3f, want %.3f ± 0.02", v.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	in := []Rule{
+		{Platforms: []useragent.Platform{useragent.IOS}, Target: iosTarget},
+		{Name: "tw", Countries: []string{"tw"}, Target: twTarget},
+		{Name: "landing", Split: []Variant{{Name: "a", Target: targetA, Weight: 1}, {Name: "b", Target: targetB, Weight: 1000}}},
+	}
+
+	rules, err := checkRules(context.Background(), nil, in)
+	if err != nil {
+		t.Fatalf("checkRules() error = %v", err)
+	}
+	if rules[0].Name != "rule1" {
+		t.Errorf("rules[0].Name = %q, want generated name rule1", rules[0].Name)
+	}
+	if rules[1].Countries[0] != "TW" {
+		t.Errorf("rules[1].Countries = %v, want upper-case", rules[1].Countries)
+	}
+	if in[1].Countries[0] != "tw" {
+		t.Error("checkRules modified the caller's rules")
+	}
+
+	if rules, err := checkRules(context.Background(), nil, nil); rules != nil || err != nil {
+		t.Errorf("checkRules(nil) = %v, %v, want nil, nil", rules, err)
+	}
+
+	// 標籤長度的邊界：32 + 1 + 31 = 64，剛好放得進 click_rollups.variant
+	long := []Rule{{Name: strings.Repeat("r", 32), Split: []Variant{{Name: strings.Repeat("v", 31), Target: targetA, Weight: 1}}}}
+	rules, err = checkRules(context.Background(), nil, long)
+	if err != nil {
+		t.Fatalf("checkRules(64-character label) error = %v", err)
+	}
+	if d := route(&URL{ShortCode: "abc", Rules: rules}, Visitor{Key: "v"}); len(d.Variant) != maxVariantLabel {
+		t.Errorf("route() variant = %q (%d characters), want %d", d.Variant, len(d.Variant), maxVariantLabel)
+	}
+}
+
+func TestCheckRulesInvalid(t *testing.T) {
+	tooMany := make([]Rule, MaxRules+1)
+	for i := range tooMany {
+		tooMany[i] = Rule{Target: targetA}
+	}
+	tooManyVariants := make([]Variant, MaxVariants+1)
+	for i := range tooManyVariants {
+		tooManyVariants[i] = Variant{Name: fmt.Sprintf("v%d", i), Target: targetA, Weight: 1}
+	}
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  error
+	}{
+		{"too many rules", tooMany, ErrInvalidRules},
+		{"reserved name", []Rule{{Name: DefaultVariant, Target: targetA}}, ErrInvalidRules},
+		{"duplicate name", []Rule{{Name: "x", Target: targetA}, {Name: "x", Target: targetB}}, ErrInvalidRules},
+		{"name with slash", []Rule{{Name: "a/b", Target: targetA}}, ErrInvalidRules},
+		{"name too long", []Rule{{Name: strings.Repeat("x", 33), Target: targetA}}, ErrInvalidRules},
+		{"unknown platform", []Rule{{Platforms: []useragent.Platform{"windows-phone"}, Target: targetA}}, ErrInvalidRules},
+		{"bad country", []Rule{{Countries: []string{"TWN"}, Target: targetA}}, ErrInvalidRules},
+		{"no target", []Rule{{Name: "x"}}, ErrInvalidRules},
+		{"target and split", []Rule{{Target: targetA, Split: []Variant{{Name: "a", Target: targetA, Weight: 1}}}}, ErrInvalidRules},
+		{"too many variants", []Rule{{Split: tooManyVariants}}, ErrInvalidRules},
+		{"duplicate variant", []Rule{{Split: []Variant{{Name: "a", Target: targetA, Weight: 1}, {Name: "a", Target: targetB, Weight: 1}}}}, ErrInvalidRules},
+		// 32 + 1 + 32 = 65：超過 click_rollups.variant 的長度
+		{"variant label too long", []Rule{{Name: strings.Repeat("r", 32), Split: []Variant{{Name: strings.Repeat("v", 32), Target: targetA, Weight: 1}}}}, ErrInvalidRules},
+		{"zero weight", []Rule{{Split: []Variant{{Name: "a", Target: targetA, Weight: 0}}}}, ErrInvalidRules},
+		{"weight too large", []Rule{{Split: []Variant{{Name: "a", Target: targetA, Weight: 1001}}}}, ErrInvalidRules},
+		{"invalid target", []Rule{{Target: "javascript:alert(1)"}}, ErrInvalidURL},
+		{"private variant target", []Rule{{Split: []Variant{{Name: "a", Target: "http://10.0.0.1/", Weight: 1}}}}, ErrInvalidURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := checkRules(context.Background(), nil, tt.rules); !errors.Is(err, tt.want) {
+				t.Errorf("checkRules() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRulesScreening(t *testing.T) {
+	screener := staticScreener{Action: ActionWarn, Rule: "pattern:x"}
+	_, err := checkRules(context.Background(), screener, []Rule{{Target: targetA}})
+	if !errors.Is(err, ErrBlocked) {
+		t.Errorf("checkRules() error = %v, want ErrBlocked (warn is rejected at creation)", err)
+	}
+}
+
+// staticScreener 對所有目標返回同一判定
+type staticScreener Verdict
+
+func (s staticScreener) Screen(ctx context.Context, rawURL string) (Verdict, error) {
+	return Verdict(s), nil
+}
@@ -0,0 +1,78 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+)
+
+// Action 篩查結果的處置方式
+type Action string
+
+const (
+	// ActionAllow 放行
+	ActionAllow Action = ""
+
+	// ActionWarn 可疑：重定向前顯示警告頁，由訪客決定是否繼續
+	ActionWarn Action = "warn"
+
+	// ActionBlock 惡意：拒絕重定向（451 Unavailable For Legal Reasons）
+	ActionBlock Action = "block"
+)
+
+// Verdict 篩查結果
+type Verdict struct {
+	Action Action `json:"action"`
+	Rule   string `json:"rule"`   // 命中的規則（如 "domain:evil.example"）
+	Reason string `json:"reason"` // 人類可讀的說明
+}
+
+// Screener 惡意 URL 篩查接口（可插拔）
+//
+// 系統設計考量：
+//
+//  1. 為什麼是接口？
+//     - 本地黑名單（零延遲、離線可用）
+//     - 第三方信譽服務（Google Safe Browsing、VirusTotal）
+//     - 可以組合：先查本地，未命中再查遠端
+//
+//  2. 兩個檢查點：
+//     - 創建時（Shorten）：拒絕已知惡意目標
+//     - 重定向時（Resolve）：黑名單會持續更新，創建時乾淨的鏈接之後可能被標記
+//
+//  3. 性能要求：
+//     - Resolve 是熱路徑，實現必須是內存查詢（微秒級）
+//     - 需要網絡請求的實現應自帶快取
+type Screener interface {
+	Screen(ctx context.Context, rawURL string) (Verdict, error)
+}
+
+// FlaggedError 重定向時目標被篩查命中
+//
+// 攜帶 Verdict，讓 handler 決定顯示警告頁（warn）還是返回 451（block）
+//
+// 使用方式：
+//
+//	var flagged *shortener.FlaggedError
+//	if errors.As(err, &flagged) { ... flagged.Verdict.Action ... }
+type FlaggedError struct {
+	ShortCode string // 帶域名的短碼（見 QualifiedCode）
+	LongURL   string
+	Verdict   Verdict
+}
+
+func (e *FlaggedError) Error() string {
+	return fmt.Sprintf("url flagged by %s: %s", e.Verdict.Rule, e.Verdict.Action)
+}
+
+// Is 讓 errors.Is(err, ErrFlagged) 成立
+func (e *FlaggedError) Is(target error) bool {
+	return target == ErrFlagged
+}
+
+// screen 執行篩查（screener 為 nil 時放行）
+func screen(ctx context.Context, screener Screener, rawURL string) (Verdict, error) {
+	if screener == nil {
+		return Verdict{}, nil
+	}
+	return screener.Screen(ctx, rawURL)
+}
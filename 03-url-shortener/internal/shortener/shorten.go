@@ -2,6 +2,7 @@ package shortener
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/url"
 	"strings"
@@ -11,22 +12,39 @@ import (
 	"github.com/koopa0/system-design/03-url-shortener/pkg/snowflake"
 )
 
+// ShortenRequest 創建短網址的參數
+//
+// 為什麼用結構體而不是函數參數？
+//   - 可選字段越來越多（自定義短碼、過期時間、所屬用戶…）
+//   - 新增字段不破壞現有調用方
+type ShortenRequest struct {
+	LongURL    string     // 原始完整 URL
+	CustomCode string     // 自定義短碼（可選，空字符串則自動生成）
+	Domain     string     // 自定義域名（可選，必須屬於 OwnerID 且已驗證；空字符串為默認域名）
+	ExpiresAt  *time.Time // 過期時間（可選，nil 則永不過期）
+	OwnerID    int64      // 所屬用戶 ID（0 表示匿名）
+	Rules      []Rule     // 條件路由規則（可選）
+	Password   string     // 訪問密碼（可選，明文，只在創建時經過內存）
+	MaxClicks  int64      // 點擊上限（可選，0 表示不限，1 即一次性鏈接）
+
+	passwordHash string // 由 checkRequest 計算
+}
+
 // Shorten 將長 URL 轉換為短網址
 //
 // 參數：
 //   - ctx：上下文（用於超時控制）
 //   - store：存儲接口
 //   - idgen：Snowflake ID 生成器
-//   - longURL：原始完整 URL
-//   - customCode：自定義短碼（可選，傳空字符串則自動生成）
-//   - expiresAt：過期時間（可選，傳 nil 則永不過期）
+//   - screener：惡意 URL 篩查（可選，nil 則跳過）
+//   - req：創建參數（長 URL、自定義短碼、域名、過期時間、所屬用戶）
 //
 // 返回：
 //   - URL 記錄
-//   - 錯誤（ErrInvalidURL、ErrCodeExists 或存儲錯誤）
+//   - 錯誤（ErrInvalidURL、ErrBlocked、ErrDomainNotFound、ErrDomainUnverified、ErrCodeExists 或存儲錯誤）
 //
 // 算法流程：
-//  1. 驗證 URL 格式
+//  1. 驗證 URL 格式、篩查惡意目標、檢查域名歸屬
 //  2. 生成短碼：
 //     - 如果提供 customCode，使用自定義碼（需驗證有效性）
 //     - 否則，生成 Snowflake ID → Base62 編碼
@@ -38,14 +56,17 @@ import (
 //   - 短碼編碼：使用 Base62（URL 友好、比 Base64 更安全）
 //   - 衝突處理：依賴存儲層的原子性（如 PostgreSQL UNIQUE 約束）
 //   - 自定義短碼：允許用戶自定義（如品牌短鏈 bit.ly/google-io）
-func Shorten(ctx context.Context, store Store, idgen *snowflake.Generator, longURL string, customCode string, expiresAt *time.Time) (*URL, error) {
-	// 1. 驗證 URL 格式
-	//
-	// 系統設計考量：
-	//   - 防止無效 URL（如 "javascript:alert(1)"）
-	//   - 要求完整的 scheme（http:// 或 https://）
-	if !isValidURL(longURL) {
-		return nil, ErrInvalidURL
+//   - 自定義域名：短碼只需在域名內唯一（go.ourbrand.com/launch 與 short.url/launch 互不衝突）
+func Shorten(ctx context.Context, store Store, idgen *snowflake.Generator, screener Screener, req ShortenRequest) (*URL, error) {
+	longURL, customCode, expiresAt := req.LongURL, req.CustomCode, req.ExpiresAt
+
+	// 1. 驗證 URL 格式、篩查惡意目標、校驗自定義短碼
+	if err := checkRequest(ctx, screener, &req); err != nil {
+		return nil, err
+	}
+	domain, err := checkDomain(ctx, store, req.Domain, req.OwnerID)
+	if err != nil {
+		return nil, err
 	}
 
 	// 2. 生成短碼
@@ -53,22 +74,10 @@ func Shorten(ctx context.Context, store Store, idgen *snowflake.Generator, longU
 	var id int64
 
 	if customCode != "" {
-		// 使用自定義短碼
-		//
-		// 驗證：
-		//   - 長度限制：4-12 字符（平衡可讀性與容量）
-		//   - 僅允許 Base62 字符（0-9, A-Z, a-z）
-		//   - 防止注入攻擊（如 "../admin"）
-		if len(customCode) < 4 || len(customCode) > 12 {
-			return nil, ErrInvalidURL
-		}
-		if !base62.IsValid(customCode) {
-			return nil, ErrInvalidURL
-		}
+		// 使用自定義短碼（已在 checkRequest 中校驗）
 		shortCode = customCode
 
 		// 仍然生成 ID（用於資料庫主鍵）
-		var err error
 		id, err = idgen.Generate()
 		if err != nil {
 			return nil, err
@@ -88,7 +97,6 @@ func Shorten(ctx context.Context, store Store, idgen *snowflake.Generator, longU
 		// 容量計算：
 		//   - 7 位 Base62：62^7 = 3.5 兆（3.5 trillion）
 		//   - 足夠使用數十年
-		var err error
 		id, err = idgen.Generate()
 		if err != nil {
 			return nil, err
@@ -118,10 +126,16 @@ func Shorten(ctx context.Context, store Store, idgen *snowflake.Generator, longU
 	urlRecord := &URL{
 		ID:        id,
 		ShortCode: shortCode,
+		Domain:    domain,
 		LongURL:   longURL,
 		Clicks:    0,
 		CreatedAt: now,
 		ExpiresAt: expiresAtCopy,
+		OwnerID:   req.OwnerID,
+		Rules:     req.Rules,
+
+		PasswordHash: req.passwordHash,
+		MaxClicks:    req.MaxClicks,
 	}
 
 	// 4. 保存到存儲層
@@ -137,6 +151,72 @@ func Shorten(ctx context.Context, store Store, idgen *snowflake.Generator, longU
 	return urlRecord, nil
 }
 
+// checkRequest 校驗創建參數（Shorten 與 ShortenBatch 共用）
+//
+// 返回 ErrInvalidURL、ErrBlocked、ErrInvalidRules、ErrInvalidPassword、ErrInvalidMaxClicks 或篩查錯誤
+// 校驗通過時 req.Rules 被替換為規範化後的副本，密碼被哈希到 req.passwordHash
+func checkRequest(ctx context.Context, screener Screener, req *ShortenRequest) error {
+	// 驗證 URL 格式
+	//
+	// 系統設計考量：
+	//   - 防止無效 URL（如 "javascript:alert(1)"）
+	//   - 要求完整的 scheme（http:// 或 https://）
+	if !isValidURL(req.LongURL) {
+		return ErrInvalidURL
+	}
+
+	// 篩查惡意目標（釣魚、惡意軟件）
+	//
+	// 創建時 warn 與 block 都拒絕：
+	//   - 已知可疑的目標沒有理由被縮短
+	//   - 警告頁只用於「創建後才被標記」的存量鏈接
+	verdict, err := screen(ctx, screener, req.LongURL)
+	if err != nil {
+		return err
+	}
+	if verdict.Action != ActionAllow {
+		return fmt.Errorf("%w: %s", ErrBlocked, verdict.Rule)
+	}
+
+	// 自定義短碼
+	//
+	// 驗證：
+	//   - 長度限制：4-12 字符（平衡可讀性與容量）
+	//   - 僅允許 Base62 字符（0-9, A-Z, a-z）
+	//   - 防止注入攻擊（如 "../admin"）
+	if req.CustomCode != "" {
+		if len(req.CustomCode) < 4 || len(req.CustomCode) > 12 {
+			return ErrInvalidURL
+		}
+		if !base62.IsValid(req.CustomCode) {
+			return ErrInvalidURL
+		}
+	}
+
+	// 條件路由規則（各目標同樣需要校驗與篩查）
+	rules, err := checkRules(ctx, screener, req.Rules)
+	if err != nil {
+		return err
+	}
+	req.Rules = rules
+
+	// 點擊上限與訪問密碼
+	//
+	// 哈希放在最後：bcrypt 是整個校驗中最貴的一步，前面的校驗失敗時不必付出
+	if err := checkMaxClicks(req.MaxClicks); err != nil {
+		return err
+	}
+	if req.Password != "" {
+		hash, err := hashPassword(req.Password)
+		if err != nil {
+			return err
+		}
+		req.passwordHash = hash
+	}
+
+	return nil
+}
+
 // isValidURL 驗證 URL 格式
 //
 // 驗證規則：
@@ -9,6 +9,7 @@ import (
 // 參數：
 //   - ctx：上下文（用於超時控制）
 //   - store：存儲接口
+//   - domain：短碼所屬域名（空字符串為默認域名）
 //   - shortCode：短碼（如 "8M0kX"）
 //
 // 返回：
@@ -25,18 +26,16 @@ import (
 //   - 管理後台（分析熱門鏈接）
 //   - API 調用（第三方集成）
 //
-// 擴展功能（本示例未實現）：
-//   - 點擊明細（時間、來源 IP、User-Agent）
-//   - 地理分布（根據 IP 定位）
-//   - 設備統計（PC/Mobile）
-//   - 來源分析（Referer）
-func Stats(ctx context.Context, store Store, shortCode string) (*URL, error) {
+// 點擊分布（時間線、來源、國家、設備）：
+//   - 由 analytics 包的異步管道匯總，見 analytics.Query
+//   - 這裡只返回 URL 記錄本身的總點擊數
+func Stats(ctx context.Context, store Store, domain, shortCode string) (*URL, error) {
 	// 直接從存儲層加載
 	//
 	// 注意：
 	//   - 不檢查過期（即使過期也返回統計）
 	//   - 返回完整的 URL 記錄（包含所有字段）
-	urlRecord, err := store.Load(ctx, shortCode)
+	urlRecord, err := store.Load(ctx, domain, shortCode)
 	if err != nil {
 		return nil, err
 	}
@@ -2,6 +2,7 @@ package shortener
 
 import (
 	"context"
+	"time"
 )
 
 // Store 定義存儲接口
@@ -22,34 +23,114 @@ import (
 //   - 點擊統計：最終一致性（允許延遲）
 //
 // 4. 擴展性考量：
-//   - 水平擴展：資料庫分片（按 short_code 哈希）
+//   - 水平擴展：資料庫分片（按 (domain, short_code) 哈希）
 //   - 快取擴展：Redis Cluster
 //   - 讀擴展：主從複製（Replicas）
 type Store interface {
 	// Save 保存短網址
 	//
 	// 設計考量：
-	//   - 冪等性：重複保存相同短碼應返回錯誤（ErrCodeExists）
-	//   - 原子性：需要資料庫層面保證（UNIQUE 約束）
+	//   - 冪等性：同一域名下重複保存相同短碼應返回錯誤（ErrCodeExists）
+	//   - 原子性：需要資料庫層面保證（UNIQUE (domain, short_code) 約束）
 	//   - 性能：寫入頻率低，可接受稍高延遲（< 100ms）
+	//   - 墓碑：短碼處於刪除冷卻期時返回 ErrCodeReserved
 	Save(ctx context.Context, url *URL) error
 
-	// Load 加載短網址
+	// SaveBatch 批量保存短網址
+	//
+	// 返回值：
+	//   - errs[i] 對應 urls[i]：nil、ErrCodeExists 或 ErrCodeReserved
+	//   - err：整批失敗（如資料庫連接錯誤）
+	//
+	// 設計考量：
+	//   - 單個短碼衝突不中止整批（部分成功語義）
+	//   - 一次網絡往返：PostgreSQL 使用單條多行 INSERT
+	//   - 調用方保證同一批次內 (domain, short_code) 不重複
+	SaveBatch(ctx context.Context, urls []*URL) ([]error, error)
+
+	// Load 加載短網址（domain 為空表示默認域名）
 	//
 	// 設計考量：
 	//   - 高頻操作：需要快取支持（目標：< 10ms）
 	//   - 快取策略：Cache-Aside（先查快取，Miss 時查 DB）
 	//   - 熱點數據：80/20 法則（20% 的短碼占 80% 的流量）
 	//   - TTL 設置：快取 1 小時（平衡命中率與過期處理）
-	Load(ctx context.Context, shortCode string) (*URL, error)
+	Load(ctx context.Context, domain, shortCode string) (*URL, error)
 
-	// IncrementClicks 增加點擊計數
+	// IncrementClicks 增加點擊計數，返回遞增後的點擊數
+	//
+	// maxClicks > 0 時為條件遞增：
+	//   - 只有 clicks < maxClicks 才遞增，否則返回 ErrClickLimitReached
+	//   - 「檢查 + 遞增」必須是一個原子操作（多副本併發點擊不能超發）
+	//   - 先讀 clicks 再寫回的實現是錯誤的：兩個副本可能同時讀到 N-1
 	//
 	// 設計考量：
-	//   - 性能優先：不能阻塞重定向（異步調用）
-	//   - 一致性取捨：允許延遲、丟失（統計允許不精確）
+	//   - 不限次數的鏈接：不能阻塞重定向（異步調用），允許延遲、丟失
+	//   - 限次鏈接：同步調用，計數即訪問權，必須精確
 	//   - 優化方案：
 	//     → 短期：Redis INCR（快速原子操作）
 	//     → 長期：消息隊列 + 批量更新（降低 DB 壓力）
-	IncrementClicks(ctx context.Context, shortCode string) error
+	IncrementClicks(ctx context.Context, domain, shortCode string, maxClicks int64) (int64, error)
+
+	// Update 部分更新短網址的可變字段，返回更新後的記錄
+	//
+	// 設計考量：
+	//   - 只寫入 changes 中設置的字段（見 URLChanges）：併發修改不同字段互不覆蓋
+	//   - 返回值來自主存儲（而非快取），是寫入後的最新記錄
+	//   - 快取一致性：快取層必須失效或覆蓋舊條目，否則舊目標會繼續被重定向
+	//   - 按 (domain, shortCode) 定位，不存在時返回 ErrNotFound
+	Update(ctx context.Context, domain, shortCode string, changes URLChanges) (*URL, error)
+
+	// Delete 刪除短網址並寫入墓碑（Tombstone）
+	//
+	// 設計考量：
+	//   - 墓碑在 reservedUntil 之前阻止同一域名下的同一短碼被重新註冊
+	//   - 為什麼需要冷卻期？
+	//     → 舊短碼可能仍印在海報、郵件中
+	//     → 立即被他人搶註會把舊訪客導向新目標（釣魚風險）
+	//   - 不存在時返回 ErrNotFound
+	Delete(ctx context.Context, domain, shortCode string, reservedUntil time.Time) error
+
+	// ListByOwner 列出用戶的短網址（按 ID 倒序，即最新優先）
+	//
+	// 分頁方式：Keyset Pagination（游標分頁）
+	//   - cursor：上一頁最後一條的 ID（0 表示第一頁）
+	//   - 查詢：WHERE owner_id = ? AND id < cursor ORDER BY id DESC LIMIT n
+	//
+	// 為什麼不用 OFFSET？
+	//   - OFFSET 100000 需要掃描並丟棄 10 萬行（越往後越慢）
+	//   - 游標分頁每頁都是索引範圍掃描 O(log n + limit)
+	//   - 翻頁期間有新增數據時，OFFSET 會出現重複或遺漏
+	ListByOwner(ctx context.Context, ownerID int64, cursor int64, limit int) ([]*URL, error)
+
+	// SaveUser 保存用戶
+	//
+	// 郵箱或 API Key 哈希重複時返回 ErrUserExists
+	SaveUser(ctx context.Context, user *User) error
+
+	// LoadUserByAPIKey 根據 API Key 哈希查詢用戶
+	//
+	// 不存在時返回 ErrUnauthorized
+	LoadUserByAPIKey(ctx context.Context, keyHash string) (*User, error)
+
+	// SaveDomain 註冊自定義域名
+	//
+	// 域名已被任何用戶註冊時返回 ErrDomainExists
+	// 例外：未驗證且註冊時間早於 domain.CreatedAt - DomainClaimTTL 的舊記錄被覆蓋（原子地）
+	SaveDomain(ctx context.Context, domain *Domain) error
+
+	// LoadDomain 按名稱查詢域名（名稱已規範化）
+	//
+	// 不存在時返回 ErrDomainNotFound
+	// 每個重定向都可能用到（Host 路由），調用方應在進程內快取
+	LoadDomain(ctx context.Context, name string) (*Domain, error)
+
+	// ListDomains 列出用戶註冊的域名（按名稱排序）
+	ListDomains(ctx context.Context, ownerID int64) ([]*Domain, error)
+
+	// MarkDomainVerified 標記域名已通過驗證
+	//
+	// 只更新 token 匹配的記錄：驗證期間域名被他人重新註冊時，舊令牌不能驗證新記錄
+	// 不存在或 token 不匹配時返回 ErrDomainNotFound
+	MarkDomainVerified(ctx context.Context, name, token string, verifiedAt time.Time) error
 }
@@ -4,6 +4,8 @@ package shortener
 import (
 	"errors"
 	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/pkg/base62"
 )
 
 // URL 表示一個短網址記錄
@@ -18,6 +20,10 @@ import (
 //     → Base62 編碼（URL 安全，無需轉義）
 //     → 長度 6-8 字符（平衡可讀性與容量）
 //
+//   - Domain：短鏈所屬的自定義域名（如 "go.ourbrand.com"）
+//     → 空字符串表示默認域名
+//     → (Domain, ShortCode) 唯一：不同域名下可以有相同的短碼
+//
 //   - Clicks：點擊統計
 //     → 設計問題：精確統計 vs 性能？
 //     → 選擇：允許最終一致性（異步更新）
@@ -25,13 +31,97 @@ import (
 //   - ExpiresAt：過期機制
 //     → 設計問題：主動刪除 vs 惰性刪除？
 //     → 選擇：惰性刪除（訪問時檢查）+ 定期清理
+//
+//   - OwnerID：所屬用戶
+//     → 0 表示匿名創建（歷史數據）
+//     → 列表查詢按 (owner_id, id DESC) 索引分頁
+//
+//   - Disabled：停用標記
+//     → 停用是可逆的（與刪除不同），用於臨時下架可疑鏈接
+//
+//   - Rules：條件路由規則（可選）
+//     → 按設備、國家或權重分流到不同目標，都不命中時使用 LongURL
+//
+//   - PasswordHash：訪問密碼的 bcrypt 哈希（可選）
+//     → 空字符串表示公開鏈接；明文密碼從不存儲
+//     → json:"-"（同 User.APIKeyHash）：任何序列化都不帶出哈希，需要它的快取層顯式寫入
+//
+//   - MaxClicks：點擊上限（可選，1 即一次性鏈接）
+//     → 0 表示不限；達到上限後鏈接失效（410）
+//     → 上限由存儲層的條件遞增原子保證（多副本併發也不會超發）
 type URL struct {
 	ID        int64      `json:"id"`                   // Snowflake ID
 	ShortCode string     `json:"short_code"`           // Base62 短碼（如 "8M0kX"）
+	Domain    string     `json:"domain,omitempty"`     // 自定義域名（空表示默認域名）
 	LongURL   string     `json:"long_url"`             // 原始 URL
 	Clicks    int64      `json:"clicks"`               // 點擊次數
 	CreatedAt time.Time  `json:"created_at"`           // 創建時間
 	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 過期時間（可選）
+	OwnerID   int64      `json:"owner_id,omitempty"`   // 所屬用戶 ID
+	Disabled  bool       `json:"disabled,omitempty"`   // 是否停用
+	Rules     []Rule     `json:"rules,omitempty"`      // 條件路由規則
+
+	PasswordHash string `json:"-"`                    // 訪問密碼（bcrypt）
+	MaxClicks    int64  `json:"max_clicks,omitempty"` // 點擊上限（0 表示不限）
+}
+
+// URLChanges 短網址的部分更新（nil 表示不修改）
+//
+// 為什麼只寫入修改的字段，而不是整條記錄寫回？
+//   - 「讀取 → 修改 → 寫回」在兩個請求之間沒有保護：
+//     A 改目標、B 同時停用，後寫入的一方會用它讀到的舊值覆蓋另一方的修改
+//   - 讀取可能來自快取（其他副本的 L1 最多落後數秒），寫回等於把舊值寫進資料庫
+//   - 只更新修改的列：不同字段的併發修改互不覆蓋，同一字段為後寫者勝（與 PATCH 語義一致）
+type URLChanges struct {
+	LongURL      *string    // 新目標 URL
+	ExpiresAt    *time.Time // 新過期時間
+	ClearExpiry  bool       // 移除過期時間（優先於 ExpiresAt）
+	Disabled     *bool      // 停用 / 啟用
+	Rules        *[]Rule    // 新路由規則（指向空切片表示清除）
+	PasswordHash *string    // 新密碼哈希（指向空字符串表示移除密碼）
+	MaxClicks    *int64     // 新點擊上限（指向 0 表示不限）
+}
+
+// Apply 將修改應用到 url（內存實現與測試使用）
+func (c URLChanges) Apply(url *URL) {
+	if c.LongURL != nil {
+		url.LongURL = *c.LongURL
+	}
+	switch {
+	case c.ClearExpiry:
+		url.ExpiresAt = nil
+	case c.ExpiresAt != nil:
+		t := *c.ExpiresAt
+		url.ExpiresAt = &t
+	}
+	if c.Disabled != nil {
+		url.Disabled = *c.Disabled
+	}
+	if c.Rules != nil {
+		url.Rules = *c.Rules
+	}
+	if c.PasswordHash != nil {
+		url.PasswordHash = *c.PasswordHash
+	}
+	if c.MaxClicks != nil {
+		url.MaxClicks = *c.MaxClicks
+	}
+}
+
+// User 表示一個 API 用戶
+//
+// 認證設計：
+//   - API Key 只在創建時返回一次明文
+//   - 存儲層只保存 SHA-256 哈希（APIKeyHash）
+//   - 為什麼不用 bcrypt？
+//     → API Key 是 256 bit 隨機數，不存在字典攻擊問題
+//     → 每個請求都要驗證，bcrypt（~100ms）代價太高
+//     → SHA-256 哈希可直接作為唯一索引查詢（O(1)）
+type User struct {
+	ID         int64     `json:"id"`         // Snowflake ID
+	Email      string    `json:"email"`      // 郵箱（唯一）
+	APIKeyHash string    `json:"-"`          // API Key 的 SHA-256（十六進制）
+	CreatedAt  time.Time `json:"created_at"` // 創建時間
 }
 
 // IsExpired 檢查 URL 是否已過期
@@ -42,13 +132,46 @@ func (u *URL) IsExpired() bool {
 	return time.Now().After(*u.ExpiresAt)
 }
 
+// IsProtected 檢查 URL 是否需要密碼訪問
+func (u *URL) IsProtected() bool {
+	return u.PasswordHash != ""
+}
+
+// IsExhausted 檢查 URL 是否已用完點擊次數
+//
+// 注意：基於讀取時的 Clicks，可能已過時（快取、併發點擊）
+// 只用於提前拒絕；真正的上限判斷在存儲層的條件遞增中
+func (u *URL) IsExhausted() bool {
+	return u.MaxClicks > 0 && u.Clicks >= u.MaxClicks
+}
+
+// IsCustomCode 檢查短碼是否為用戶自定義
+//
+// 自動生成的短碼恰好是 Base62(ID)，無需額外存儲標記
+func (u *URL) IsCustomCode() bool {
+	return u.ShortCode != base62.Encode(uint64(u.ID))
+}
+
 // 錯誤定義
 //
 // HTTP 狀態碼映射：
 //   - ErrInvalidURL   → 400 Bad Request
+//   - ErrBlocked      → 400 Bad Request
+//   - ErrFlagged      → 451 Unavailable For Legal Reasons / 警告頁
 //   - ErrNotFound     → 404 Not Found
 //   - ErrExpired      → 410 Gone（更精確的語義）
+//   - ErrDisabled     → 410 Gone
+//   - ErrClickLimitReached → 410 Gone
+//   - ErrPasswordRequired  → 密碼輸入頁
+//   - ErrWrongPassword     → 密碼輸入頁（401）
+//   - ErrInvalidPassword   → 400 Bad Request
+//   - ErrInvalidMaxClicks  → 400 Bad Request
 //   - ErrCodeExists   → 409 Conflict
+//   - ErrCodeReserved → 409 Conflict
+//   - ErrForbidden    → 403 Forbidden
+//   - ErrUserExists   → 409 Conflict
+//   - ErrInvalidEmail → 400 Bad Request
+//   - ErrUnauthorized → 401 Unauthorized
 //
 // 設計考量：
 //   - 區分不存在（404）和已過期（410）
@@ -57,12 +180,51 @@ var (
 	// ErrInvalidURL 當 URL 格式無效時返回
 	ErrInvalidURL = errors.New("invalid url format")
 
+	// ErrBlocked 當目標 URL 被篩查規則拒絕時返回（創建時）
+	ErrBlocked = errors.New("url is blocked by screening rules")
+
+	// ErrFlagged 當已存在的鏈接在重定向時被篩查命中（實際返回 *FlaggedError）
+	ErrFlagged = errors.New("url has been flagged")
+
 	// ErrNotFound 當短碼不存在時返回
 	ErrNotFound = errors.New("short code not found")
 
 	// ErrExpired 當 URL 已過期時返回
 	ErrExpired = errors.New("url has expired")
 
+	// ErrDisabled 當 URL 已被停用時返回
+	ErrDisabled = errors.New("url has been disabled")
+
 	// ErrCodeExists 當自定義短碼已存在時返回
 	ErrCodeExists = errors.New("custom short code already exists")
+
+	// ErrCodeReserved 當短碼剛被刪除、仍處於冷卻期時返回
+	ErrCodeReserved = errors.New("short code is reserved after deletion")
+
+	// ErrForbidden 當用戶操作不屬於自己的短網址時返回
+	ErrForbidden = errors.New("url belongs to another user")
+
+	// ErrUserExists 當郵箱已被註冊時返回
+	ErrUserExists = errors.New("user already exists")
+
+	// ErrInvalidEmail 當郵箱格式無效時返回
+	ErrInvalidEmail = errors.New("invalid email format")
+
+	// ErrUnauthorized 當 API Key 無效或缺失時返回
+	ErrUnauthorized = errors.New("invalid or missing api key")
+
+	// ErrClickLimitReached 當鏈接已達到點擊上限時返回
+	ErrClickLimitReached = errors.New("url has reached its click limit")
+
+	// ErrPasswordRequired 當訪問受密碼保護的鏈接但未提交密碼時返回
+	ErrPasswordRequired = errors.New("password required")
+
+	// ErrWrongPassword 當提交的密碼不正確時返回
+	ErrWrongPassword = errors.New("wrong password")
+
+	// ErrInvalidPassword 當設置的鏈接密碼不符合長度要求時返回
+	ErrInvalidPassword = errors.New("invalid password")
+
+	// ErrInvalidMaxClicks 當點擊上限為負數時返回
+	ErrInvalidMaxClicks = errors.New("invalid max clicks")
 )
@@ -0,0 +1,121 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/pkg/base62"
+	"github.com/koopa0/system-design/03-url-shortener/pkg/snowflake"
+)
+
+// apiKeyPrefix API Key 前綴
+//
+// 為什麼加前綴？
+//   - 一眼可辨認（日誌、配置文件中）
+//   - GitHub Secret Scanning 等工具可按前綴偵測洩漏的密鑰
+const apiKeyPrefix = "sk_"
+
+// Register 註冊新用戶並生成 API Key
+//
+// 返回：
+//   - 用戶記錄
+//   - API Key 明文（只返回這一次，服務端不保存）
+//   - 錯誤（ErrInvalidEmail、ErrUserExists 或存儲錯誤）
+func Register(ctx context.Context, store Store, idgen *snowflake.Generator, email string) (*User, string, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return nil, "", ErrInvalidEmail
+	}
+
+	id, err := idgen.Generate()
+	if err != nil {
+		return nil, "", err
+	}
+
+	apiKey, err := GenerateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	user := &User{
+		ID:         id,
+		Email:      strings.ToLower(email),
+		APIKeyHash: HashAPIKey(apiKey),
+		CreatedAt:  time.Now(),
+	}
+
+	if err := store.SaveUser(ctx, user); err != nil {
+		return nil, "", err
+	}
+
+	return user, apiKey, nil
+}
+
+// Authenticate 驗證 API Key 並返回對應用戶
+//
+// 流程：哈希 → 按哈希查詢（唯一索引）
+//
+// 安全考量：
+//   - 存儲層只有哈希，資料庫洩漏不會直接洩漏可用的 Key
+//   - 按哈希等值查詢，不需要常數時間比較（攻擊者無法控制哈希前綴）
+func Authenticate(ctx context.Context, store Store, apiKey string) (*User, error) {
+	if !strings.HasPrefix(apiKey, apiKeyPrefix) {
+		return nil, ErrUnauthorized
+	}
+	return store.LoadUserByAPIKey(ctx, HashAPIKey(apiKey))
+}
+
+// ListLinks 列出用戶的短網址（游標分頁）
+//
+// 返回：
+//   - 當前頁的 URL 列表
+//   - 下一頁游標（0 表示沒有更多數據）
+//
+// 技巧：多查一條（limit + 1）判斷是否還有下一頁，避免額外的 COUNT 查詢
+func ListLinks(ctx context.Context, store Store, ownerID int64, cursor int64, limit int) ([]*URL, int64, error) {
+	urls, err := store.ListByOwner(ctx, ownerID, cursor, limit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var next int64
+	if len(urls) > limit {
+		urls = urls[:limit]
+		next = urls[limit-1].ID
+	}
+	return urls, next, nil
+}
+
+// GenerateAPIKey 生成隨機 API Key
+//
+// 格式：sk_ + 4 段 Base62（每段 8 字節隨機數，補齊到 11 字符）
+//
+// 熵：256 bit（crypto/rand），暴力猜測不可行
+//
+// 為什麼分段編碼？
+//   - base62.EncodeBytes 只能容納 64 bit（uint64）
+//   - 分段後每段定長，整體長度固定（3 + 44 字符）
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(apiKeyPrefix)
+	for i := 0; i < len(buf); i += 8 {
+		sb.WriteString(base62.Pad(base62.EncodeBytes(buf[i:i+8]), 11))
+	}
+	return sb.String(), nil
+}
+
+// HashAPIKey 計算 API Key 的 SHA-256 哈希（十六進制）
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
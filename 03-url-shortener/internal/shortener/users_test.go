@@ -0,0 +1,119 @@
+package shortener_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+	"github.com/koopa0/system-design/03-url-shortener/internal/storage"
+)
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	idgen := newGenerator(t)
+
+	user, apiKey, err := shortener.Register(ctx, store, idgen, "Team@Example.com")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if user.Email != "team@example.com" || user.ID == 0 {
+		t.Errorf("Register() = %+v, want a lower-case email and an ID", user)
+	}
+	// 只保存哈希，明文 Key 不出現在用戶記錄中
+	if !strings.HasPrefix(apiKey, "sk_") || len(apiKey) != 3+44 || user.APIKeyHash != shortener.HashAPIKey(apiKey) {
+		t.Errorf("api key = %q, hash = %q", apiKey, user.APIKeyHash)
+	}
+
+	tests := []struct {
+		name  string
+		email string
+		want  error
+	}{
+		{"same email in another case", "TEAM@example.com", shortener.ErrUserExists},
+		{"display name", "Team <team@example.com>", shortener.ErrInvalidEmail},
+		{"missing domain", "team", shortener.ErrInvalidEmail},
+		{"empty", "", shortener.ErrInvalidEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := shortener.Register(ctx, store, idgen, tt.email); !errors.Is(err, tt.want) {
+				t.Errorf("Register(%q) error = %v, want %v", tt.email, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	user, apiKey, err := shortener.Register(ctx, store, newGenerator(t), "team@example.com")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	got, err := shortener.Authenticate(ctx, store, apiKey)
+	if err != nil || got.ID != user.ID {
+		t.Fatalf("Authenticate() = %+v, %v, want user %d", got, err, user.ID)
+	}
+
+	other, err := shortener.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v", err)
+	}
+	for _, key := range []string{other, strings.TrimPrefix(apiKey, "sk_"), apiKey + "x", ""} {
+		if _, err := shortener.Authenticate(ctx, store, key); !errors.Is(err, shortener.ErrUnauthorized) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrUnauthorized", key, err)
+		}
+	}
+}
+
+// TestListLinks 按 ID 倒序分頁，游標為上一頁最後一條的 ID。
+func TestListLinks(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	const owner = 1
+	for i := range 5 {
+		url := &shortener.URL{ID: int64(100 + i), ShortCode: "link" + string(rune('a'+i)), LongURL: target, OwnerID: owner, CreatedAt: time.Now()}
+		if err := store.Save(ctx, url); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	seed(t, store, 2, "other")
+
+	var ids []int64
+	var cursor int64
+	for page := 0; page < 5; page++ {
+		urls, next, err := shortener.ListLinks(ctx, store, owner, cursor, 2)
+		if err != nil {
+			t.Fatalf("ListLinks(cursor %d) error = %v", cursor, err)
+		}
+		for _, url := range urls {
+			ids = append(ids, url.ID)
+		}
+		if next == 0 {
+			if page != 2 || len(urls) != 1 {
+				t.Errorf("last page = %d with %d links, want page 2 with 1 link", page, len(urls))
+			}
+			break
+		}
+		if next != urls[len(urls)-1].ID {
+			t.Errorf("next cursor = %d, want the last ID %d", next, urls[len(urls)-1].ID)
+		}
+		cursor = next
+	}
+
+	want := []int64{104, 103, 102, 101, 100}
+	if !slices.Equal(ids, want) {
+		t.Errorf("listed %v, want %v", ids, want)
+	}
+
+	// 剛好一頁：多查的一條不存在，沒有下一頁
+	if urls, next, err := shortener.ListLinks(ctx, store, owner, 0, 5); err != nil || len(urls) != 5 || next != 0 {
+		t.Errorf("ListLinks(limit 5) = %d links, next %d, %v; want 5 links and no next page", len(urls), next, err)
+	}
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// localCache 進程內 L1 快取（LRU + TTL，併發安全）
+//
+// 為什麼在 Redis 前面再加一層？
+//   - 熱點鏈接（病毒式傳播）每秒數萬次讀取，全部打到同一個 Redis 節點
+//   - 進程內讀取約 100ns，Redis 往返約 0.5ms，且不佔網絡帶寬
+//
+// 為什麼 TTL 很短（默認 5 秒）？
+//   - 副本 A 修改鏈接時直接清除 A 的 L1，其他副本靠 Redis Pub/Sub 通知清除
+//   - 通知不保證送達（見 RedisCache.SubscribeInvalidations）：TTL 是舊值存活時間的上限
+//   - 對熱點鏈接，5 秒 TTL 仍能吸收絕大部分讀取
+//
+// 值為 nil 表示「不存在」（負快取）
+type localCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	ll       *list.List               // 最近使用的在前
+	items    map[string]*list.Element // 短碼（帶域名）→ 鏈表節點
+}
+
+type localEntry struct {
+	key       string
+	url       *shortener.URL // nil 表示不存在
+	expiresAt time.Time
+}
+
+func newLocalCache(capacity int, ttl time.Duration) *localCache {
+	return &localCache{
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get 讀取條目（ok 為 false 表示未命中或已過期）
+//
+// 返回的 URL 是副本，調用方可以自由修改
+func (c *localCache) get(key string) (url *shortener.URL, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+	entry := e.Value.(*localEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	if entry.url == nil {
+		return nil, true
+	}
+	urlCopy := *entry.url
+	return &urlCopy, true
+}
+
+// set 寫入條目（ttl 不超過 L1 自身的 TTL）
+func (c *localCache) set(key string, url *shortener.URL, ttl time.Duration) {
+	ttl = min(ttl, c.ttl)
+	if url != nil {
+		urlCopy := *url
+		url = &urlCopy
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &localEntry{key: key, url: url, expiresAt: time.Now().Add(ttl)}
+	if e, found := c.items[key]; found {
+		e.Value = entry
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(entry)
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*localEntry).key)
+	}
+}
+
+// del 刪除條目
+func (c *localCache) del(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.items[key]; found {
+		c.ll.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// clear 清空所有條目
+func (c *localCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	clear(c.items)
+}
+
+// len 當前條目數（含尚未被清除的過期條目）
+func (c *localCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
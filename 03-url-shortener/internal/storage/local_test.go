@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalCacheLRU(t *testing.T) {
+	c := newLocalCache(2, time.Minute)
+	c.set("a", newURL(1, "", "a"), time.Minute)
+	c.set("b", newURL(2, "", "b"), time.Minute)
+	c.get("a")                                  // a 變為最近使用
+	c.set("c", newURL(3, "", "c"), time.Minute) // 淘汰最久未使用的 b
+
+	if _, ok := c.get("b"); ok {
+		t.Error("get(b) hit, want b evicted as least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("get(%s) missed", key)
+		}
+	}
+	if c.len() != 2 {
+		t.Errorf("len() = %d, want 2", c.len())
+	}
+
+	c.del("a")
+	if _, ok := c.get("a"); ok || c.len() != 1 {
+		t.Errorf("after del(a): len() = %d, want a removed", c.len())
+	}
+}
+
+func TestLocalCacheTTL(t *testing.T) {
+	c := newLocalCache(10, 50*time.Millisecond)
+	c.set("short", newURL(1, "", "short"), time.Millisecond) // 短於 L1 TTL
+	c.set("long", newURL(2, "", "long"), time.Hour)          // 被截斷到 L1 TTL
+	c.set("missing", nil, time.Hour)                         // 負快取
+
+	if url, ok := c.get("missing"); !ok || url != nil {
+		t.Errorf("get(missing) = %v, %v, want a negative hit", url, ok)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.get("short"); ok {
+		t.Error("get(short) hit after its TTL")
+	}
+	if _, ok := c.get("long"); !ok {
+		t.Error("get(long) missed before the L1 TTL")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.get("long"); ok {
+		t.Error("get(long) hit after the L1 TTL, want entries capped at the L1 TTL")
+	}
+}
+
+func TestLocalCacheCopy(t *testing.T) {
+	c := newLocalCache(10, time.Minute)
+	url := newURL(1, "", "abc")
+	c.set("abc", url, time.Minute)
+	url.LongURL = "https://evil.example" // 寫入後修改原值
+
+	got, _ := c.get("abc")
+	got.Disabled = true // 修改讀到的值
+
+	again, _ := c.get("abc")
+	if again.LongURL != "https://example.com/abc" || again.Disabled {
+		t.Errorf("cached entry = %+v, want it isolated from callers", again)
+	}
+}
+
+// 併發讀寫刪：在 -race 下運行，條目數始終不超過容量
+func TestLocalCacheConcurrent(t *testing.T) {
+	const capacity = 16
+	c := newLocalCache(capacity, time.Minute)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 2000 {
+				key := fmt.Sprintf("k%d", (g*7+i)%40)
+				switch i % 4 {
+				case 0:
+					c.set(key, newURL(int64(i), "", key), time.Minute)
+				case 1:
+					c.set(key, nil, time.Minute)
+				case 2:
+					if url, ok := c.get(key); ok && url != nil {
+						url.Clicks++ // 副本：不影響其他讀者
+					}
+				case 3:
+					c.del(key)
+				}
+				if n := c.len(); n > capacity {
+					t.Errorf("len() = %d, want <= %d", n, capacity)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// AdvisoryLock PostgreSQL 會話級 advisory lock（實現 lifecycle.Locker）
+//
+// 為什麼用 advisory lock 而不是 Redis 分布式鎖？
+//   - 清理任務本身只操作 PostgreSQL，不引入額外依賴
+//   - 會話斷開（副本崩潰、網絡中斷）時資料庫自動釋放鎖，無需 TTL 與續期
+//
+// 注意：會話級鎖綁定在連接上
+//   - 必須從連接池取出專用連接（db.Conn），加鎖與解鎖在同一連接上執行
+//   - 解鎖失敗時丟棄連接：否則帶鎖的連接回到連接池，其他副本永遠拿不到鎖
+type AdvisoryLock struct {
+	db  *sql.DB
+	key int64
+}
+
+// NewAdvisoryLock 創建 advisory lock
+func NewAdvisoryLock(db *sql.DB, key int64) *AdvisoryLock {
+	return &AdvisoryLock{db: db, key: key}
+}
+
+// TryLock 嘗試加鎖（非阻塞，pg_try_advisory_lock）
+func (l *AdvisoryLock) TryLock(ctx context.Context) (func(), bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ok bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	release := func() {
+		// 不使用調用方的 ctx：ctx 可能已取消（關閉流程），但鎖仍需釋放
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+			// 返回 ErrBadConn 讓 database/sql 關閉連接而不是放回連接池
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+	return release, true, nil
+}
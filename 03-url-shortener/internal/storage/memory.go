@@ -10,8 +10,12 @@ package storage
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/koopa0/system-design/03-url-shortener/internal/analytics"
+	"github.com/koopa0/system-design/03-url-shortener/internal/lifecycle"
 	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
 )
 
@@ -39,14 +43,41 @@ import (
 //   - 單元測試：不需要 Mock
 //   - 演示/教學：聚焦系統設計
 type Memory struct {
-	mu   sync.RWMutex
-	urls map[string]*shortener.URL
+	mu         sync.RWMutex
+	urls       map[urlKey]*shortener.URL
+	tombstones map[urlKey]time.Time // (域名, 短碼) → 保留截止時間
+	users      map[int64]*shortener.User
+	domains    map[string]*shortener.Domain // 自定義域名（按名稱）
+	rollups    map[rollupKey]int64          // 點擊匯總（analytics.Store）
+	archive    map[int64]*shortener.URL     // 歸檔的過期鏈接（lifecycle.Store）
+}
+
+// urlKey 短網址主鍵（短碼在域名內唯一）
+type urlKey struct {
+	domain    string
+	shortCode string
+}
+
+// rollupKey 匯總表主鍵
+type rollupKey struct {
+	domain    string
+	shortCode string
+	hour      time.Time
+	referrer  string
+	country   string
+	device    string
+	variant   string
 }
 
 // NewMemory 創建內存存儲實例
 func NewMemory() *Memory {
 	return &Memory{
-		urls: make(map[string]*shortener.URL),
+		urls:       make(map[urlKey]*shortener.URL),
+		tombstones: make(map[urlKey]time.Time),
+		users:      make(map[int64]*shortener.User),
+		domains:    make(map[string]*shortener.Domain),
+		rollups:    make(map[rollupKey]int64),
+		archive:    make(map[int64]*shortener.URL),
 	}
 }
 
@@ -55,15 +86,52 @@ func (m *Memory) Save(ctx context.Context, url *shortener.URL) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	key := urlKey{url.Domain, url.ShortCode}
+
 	// 檢查短碼是否已存在
-	if _, exists := m.urls[url.ShortCode]; exists {
+	if _, exists := m.urls[key]; exists {
 		return shortener.ErrCodeExists
 	}
 
-	m.urls[url.ShortCode] = url
+	// 檢查墓碑（刪除冷卻期）
+	if until, ok := m.tombstones[key]; ok {
+		if time.Now().Before(until) {
+			return shortener.ErrCodeReserved
+		}
+		delete(m.tombstones, key)
+	}
+
+	m.urls[key] = url
 	return nil
 }
 
+// SaveBatch 批量保存短網址
+//
+// 整批持有一次寫鎖：其他讀寫看到的是「整批前」或「整批後」的狀態
+func (m *Memory) SaveBatch(ctx context.Context, urls []*shortener.URL) ([]error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	errs := make([]error, len(urls))
+	for i, url := range urls {
+		key := urlKey{url.Domain, url.ShortCode}
+		if _, exists := m.urls[key]; exists {
+			errs[i] = shortener.ErrCodeExists
+			continue
+		}
+		if until, ok := m.tombstones[key]; ok {
+			if now.Before(until) {
+				errs[i] = shortener.ErrCodeReserved
+				continue
+			}
+			delete(m.tombstones, key)
+		}
+		m.urls[key] = url
+	}
+	return errs, nil
+}
+
 // Load 加載短網址
 //
 // 系統設計考量：
@@ -72,34 +140,285 @@ func (m *Memory) Save(ctx context.Context, url *shortener.URL) error {
 //     → 為什麼返回副本？
 //     → 防止調用者直接修改 Clicks 等字段（繞過 IncrementClicks）
 //     → 避免數據競爭（data race）
-func (m *Memory) Load(ctx context.Context, shortCode string) (*shortener.URL, error) {
+func (m *Memory) Load(ctx context.Context, domain, shortCode string) (*shortener.URL, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	url, exists := m.urls[shortCode]
+	url, exists := m.urls[urlKey{domain, shortCode}]
 	if !exists {
 		return nil, shortener.ErrNotFound
 	}
 
-	if url.IsExpired() {
-		return nil, shortener.ErrExpired
-	}
+	// 過期檢查在業務層（與 Postgres 實現一致）
+	//   - Resolve 對過期鏈接返回 410
+	//   - Stats、Update 仍需讀取過期記錄（查看統計、延長有效期）
 
 	// 返回副本，防止外部修改
 	urlCopy := *url
 	return &urlCopy, nil
 }
 
-// IncrementClicks 增加點擊計數
-func (m *Memory) IncrementClicks(ctx context.Context, shortCode string) error {
+// IncrementClicks 增加點擊計數（maxClicks > 0 時為條件遞增）
+//
+// 檢查與遞增在同一把寫鎖內完成，單機下即為原子操作
+func (m *Memory) IncrementClicks(ctx context.Context, domain, shortCode string, maxClicks int64) (int64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	url, exists := m.urls[shortCode]
+	url, exists := m.urls[urlKey{domain, shortCode}]
 	if !exists {
-		return shortener.ErrNotFound
+		return 0, shortener.ErrNotFound
+	}
+	if maxClicks > 0 && url.Clicks >= maxClicks {
+		return url.Clicks, shortener.ErrClickLimitReached
 	}
 
 	url.Clicks++
+	return url.Clicks, nil
+}
+
+// Update 部分更新短網址的可變字段（在同一把寫鎖內修改，返回副本）
+func (m *Memory) Update(ctx context.Context, domain, shortCode string, changes shortener.URLChanges) (*shortener.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.urls[urlKey{domain, shortCode}]
+	if !exists {
+		return nil, shortener.ErrNotFound
+	}
+
+	changes.Apply(existing)
+	urlCopy := *existing
+	return &urlCopy, nil
+}
+
+// Delete 刪除短網址並寫入墓碑
+func (m *Memory) Delete(ctx context.Context, domain, shortCode string, reservedUntil time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := urlKey{domain, shortCode}
+	if _, exists := m.urls[key]; !exists {
+		return shortener.ErrNotFound
+	}
+
+	delete(m.urls, key)
+	m.tombstones[key] = reservedUntil
 	return nil
 }
+
+// ListExpired 列出過期鏈接（實現 lifecycle.Store）
+//
+// 注意：全表掃描 + 排序，僅適用於開發測試
+func (m *Memory) ListExpired(ctx context.Context, before time.Time, limit int) ([]*shortener.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*shortener.URL
+	for _, url := range m.urls {
+		if url.ExpiresAt != nil && url.ExpiresAt.Before(before) {
+			urlCopy := *url
+			result = append(result, &urlCopy)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExpiresAt.Before(*result[j].ExpiresAt)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// RemoveExpired 刪除（或歸檔）過期鏈接並寫入墓碑（實現 lifecycle.Store）
+func (m *Memory) RemoveExpired(ctx context.Context, items []lifecycle.Expired, before time.Time, archive bool) ([]lifecycle.Expired, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var removed []lifecycle.Expired
+	for _, item := range items {
+		key := urlKey{item.Domain, item.ShortCode}
+		url, ok := m.urls[key]
+		if !ok || url.ExpiresAt == nil || !url.ExpiresAt.Before(before) {
+			continue // 已被刪除或已延期
+		}
+		if archive {
+			m.archive[url.ID] = url
+		}
+		delete(m.urls, key)
+		m.tombstones[key] = item.ReservedUntil
+		removed = append(removed, item)
+	}
+	return removed, nil
+}
+
+// PurgeTombstones 清除已到期的墓碑（實現 lifecycle.Store）
+func (m *Memory) PurgeTombstones(ctx context.Context, now time.Time, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for key, until := range m.tombstones {
+		if purged >= int64(limit) {
+			break
+		}
+		if !until.After(now) {
+			delete(m.tombstones, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ListByOwner 列出用戶的短網址（按 ID 倒序）
+//
+// 注意：全表掃描 + 排序 O(n log n)，僅適用於開發測試
+// PostgreSQL 實現走 (owner_id, id) 索引
+func (m *Memory) ListByOwner(ctx context.Context, ownerID int64, cursor int64, limit int) ([]*shortener.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*shortener.URL
+	for _, url := range m.urls {
+		if url.OwnerID != ownerID {
+			continue
+		}
+		if cursor > 0 && url.ID >= cursor {
+			continue
+		}
+		urlCopy := *url
+		result = append(result, &urlCopy)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// SaveUser 保存用戶
+func (m *Memory) SaveUser(ctx context.Context, user *shortener.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == user.Email || u.APIKeyHash == user.APIKeyHash {
+			return shortener.ErrUserExists
+		}
+	}
+
+	userCopy := *user
+	m.users[user.ID] = &userCopy
+	return nil
+}
+
+// LoadUserByAPIKey 根據 API Key 哈希查詢用戶
+func (m *Memory) LoadUserByAPIKey(ctx context.Context, keyHash string) (*shortener.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.APIKeyHash == keyHash {
+			userCopy := *u
+			return &userCopy, nil
+		}
+	}
+	return nil, shortener.ErrUnauthorized
+}
+
+// SaveDomain 註冊自定義域名（過期的未驗證註冊會被覆蓋）
+func (m *Memory) SaveDomain(ctx context.Context, domain *shortener.Domain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if d, exists := m.domains[domain.Name]; exists {
+		if d.IsVerified() || !d.CreatedAt.Before(domain.CreatedAt.Add(-shortener.DomainClaimTTL)) {
+			return shortener.ErrDomainExists
+		}
+	}
+
+	domainCopy := *domain
+	m.domains[domain.Name] = &domainCopy
+	return nil
+}
+
+// LoadDomain 按名稱查詢域名
+func (m *Memory) LoadDomain(ctx context.Context, name string) (*shortener.Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, exists := m.domains[name]
+	if !exists {
+		return nil, shortener.ErrDomainNotFound
+	}
+	domainCopy := *d
+	return &domainCopy, nil
+}
+
+// ListDomains 列出用戶註冊的域名（按名稱排序）
+func (m *Memory) ListDomains(ctx context.Context, ownerID int64) ([]*shortener.Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*shortener.Domain
+	for _, d := range m.domains {
+		if d.OwnerID == ownerID {
+			domainCopy := *d
+			result = append(result, &domainCopy)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// MarkDomainVerified 標記域名已通過驗證
+func (m *Memory) MarkDomainVerified(ctx context.Context, name, token string, verifiedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, exists := m.domains[name]
+	if !exists || d.Token != token {
+		return shortener.ErrDomainNotFound
+	}
+	d.VerifiedAt = &verifiedAt
+	return nil
+}
+
+// SaveRollups 累加點擊匯總（實現 analytics.Store）
+func (m *Memory) SaveRollups(ctx context.Context, rollups []analytics.Rollup) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range rollups {
+		key := rollupKey{r.Domain, r.ShortCode, r.Hour.UTC(), r.Referrer, r.Country, r.Device, r.Variant}
+		m.rollups[key] += r.Clicks
+	}
+	return nil
+}
+
+// LoadRollups 讀取時間範圍內的點擊匯總 [from, to)
+//
+// 注意：全表掃描 O(n)，僅適用於開發測試
+func (m *Memory) LoadRollups(ctx context.Context, domain, shortCode string, from, to time.Time) ([]analytics.Rollup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []analytics.Rollup
+	for k, clicks := range m.rollups {
+		if k.domain != domain || k.shortCode != shortCode || k.hour.Before(from) || !k.hour.Before(to) {
+			continue
+		}
+		result = append(result, analytics.Rollup{
+			Domain:    k.domain,
+			ShortCode: k.shortCode,
+			Hour:      k.hour,
+			Referrer:  k.referrer,
+			Country:   k.country,
+			Device:    k.device,
+			Variant:   k.variant,
+			Clicks:    clicks,
+		})
+	}
+	return result, nil
+}
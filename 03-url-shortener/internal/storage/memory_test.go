@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/lifecycle"
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+func newURL(id int64, domain, code string) *shortener.URL {
+	return &shortener.URL{ID: id, Domain: domain, ShortCode: code, LongURL: "https://example.com/" + code, CreatedAt: time.Now()}
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	if err := m.Save(ctx, newURL(1, "", "promo")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	newTarget := "https://example.com/new"
+	disabled := true
+	got, err := m.Update(ctx, "", "promo", shortener.URLChanges{LongURL: &newTarget, ExpiresAt: &expires, Disabled: &disabled})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got.LongURL != newTarget || got.ExpiresAt == nil || !got.Disabled {
+		t.Errorf("Update() = %+v", got)
+	}
+
+	// 只修改設置的字段：之前的修改保留
+	maxClicks := int64(5)
+	if _, err := m.Update(ctx, "", "promo", shortener.URLChanges{MaxClicks: &maxClicks}); err != nil {
+		t.Fatalf("Update(MaxClicks) error = %v", err)
+	}
+	got, err = m.Load(ctx, "", "promo")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got.LongURL != newTarget || got.ExpiresAt == nil || !got.Disabled || got.MaxClicks != 5 {
+		t.Errorf("Load() after Update = %+v", got)
+	}
+
+	if _, err := m.Update(ctx, "", "missing", shortener.URLChanges{Disabled: &disabled}); !errors.Is(err, shortener.ErrNotFound) {
+		t.Errorf("Update(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryLoadReturnsCopy(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.Save(ctx, newURL(1, "", "abc"))
+
+	got, _ := m.Load(ctx, "", "abc")
+	got.LongURL = "https://evil.example"
+
+	again, _ := m.Load(ctx, "", "abc")
+	if again.LongURL != "https://example.com/abc" {
+		t.Errorf("modifying a loaded URL changed the stored record: %q", again.LongURL)
+	}
+}
+
+func TestMemoryDeleteTombstone(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.Save(ctx, newURL(1, "", "promo"))
+	m.Save(ctx, newURL(2, "go.brand.com", "promo"))
+
+	if err := m.Delete(ctx, "", "promo", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := m.Load(ctx, "", "promo"); !errors.Is(err, shortener.ErrNotFound) {
+		t.Errorf("Load after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := m.Delete(ctx, "", "promo", time.Now().Add(time.Hour)); !errors.Is(err, shortener.ErrNotFound) {
+		t.Errorf("second Delete error = %v, want ErrNotFound", err)
+	}
+
+	// 冷卻期內不能重新註冊；墓碑只作用於同一域名
+	if err := m.Save(ctx, newURL(3, "", "promo")); !errors.Is(err, shortener.ErrCodeReserved) {
+		t.Errorf("Save during cooldown error = %v, want ErrCodeReserved", err)
+	}
+	errs, err := m.SaveBatch(ctx, []*shortener.URL{newURL(4, "", "promo")})
+	if err != nil || !errors.Is(errs[0], shortener.ErrCodeReserved) {
+		t.Errorf("SaveBatch during cooldown = %v, %v, want ErrCodeReserved", errs, err)
+	}
+	if _, err := m.Load(ctx, "go.brand.com", "promo"); err != nil {
+		t.Errorf("Delete removed the same code on another domain: %v", err)
+	}
+}
+
+func TestMemoryTombstoneExpires(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.Save(ctx, newURL(1, "", "promo"))
+	m.Delete(ctx, "", "promo", time.Now().Add(-time.Second))
+
+	if err := m.Save(ctx, newURL(2, "", "promo")); err != nil {
+		t.Errorf("Save after cooldown error = %v, want nil", err)
+	}
+}
+
+func TestMemorySaveBatch(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.Save(ctx, newURL(1, "", "taken"))
+
+	errs, err := m.SaveBatch(ctx, []*shortener.URL{
+		newURL(2, "", "fresh"),
+		newURL(3, "", "taken"),
+		newURL(4, "go.brand.com", "taken"), // 不同域名：不衝突
+	})
+	if err != nil {
+		t.Fatalf("SaveBatch() error = %v", err)
+	}
+
+	want := []error{nil, shortener.ErrCodeExists, nil}
+	for i, w := range want {
+		if !errors.Is(errs[i], w) {
+			t.Errorf("errs[%d] = %v, want %v", i, errs[i], w)
+		}
+	}
+
+	// 部分成功：衝突的條目不影響其他條目寫入，也不覆蓋存量記錄
+	if got, _ := m.Load(ctx, "", "taken"); got.ID != 1 {
+		t.Errorf("SaveBatch overwrote the existing record: ID = %d", got.ID)
+	}
+	for _, key := range []urlKey{{"", "fresh"}, {"go.brand.com", "taken"}} {
+		if _, err := m.Load(ctx, key.domain, key.shortCode); err != nil {
+			t.Errorf("Load(%+v) error = %v", key, err)
+		}
+	}
+}
+
+func TestMemoryRemoveExpired(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+
+	for i, ago := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour} {
+		url := newURL(int64(i+1), "", []string{"aaa", "bbb", "ccc"}[i])
+		expires := now.Add(-ago)
+		url.ExpiresAt = &expires
+		m.Save(ctx, url)
+	}
+	m.Save(ctx, newURL(4, "", "live"))
+
+	// 按過期時間升序，最多 limit 條；未設過期時間的不列出
+	expired, _ := m.ListExpired(ctx, now, 2)
+	if len(expired) != 2 || expired[0].ShortCode != "aaa" || expired[1].ShortCode != "bbb" {
+		t.Fatalf("ListExpired() = %+v, want [aaa bbb]", expired)
+	}
+
+	// List 與 Remove 之間 bbb 被延期：不應刪除
+	extended := now.Add(time.Hour)
+	m.Update(ctx, "", "bbb", shortener.URLChanges{ExpiresAt: &extended})
+
+	items := []lifecycle.Expired{
+		{ShortCode: "aaa", ReservedUntil: now.Add(time.Hour)},
+		{ShortCode: "bbb", ReservedUntil: now.Add(time.Hour)},
+	}
+	removed, err := m.RemoveExpired(ctx, items, now, true)
+	if err != nil {
+		t.Fatalf("RemoveExpired() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0].ShortCode != "aaa" {
+		t.Fatalf("RemoveExpired() = %+v, want [aaa]", removed)
+	}
+	if _, ok := m.archive[1]; !ok {
+		t.Error("archive = true but the removed link was not archived")
+	}
+	if err := m.Save(ctx, newURL(5, "", "aaa")); !errors.Is(err, shortener.ErrCodeReserved) {
+		t.Errorf("Save(removed code) error = %v, want ErrCodeReserved", err)
+	}
+
+	// 墓碑到期後被清除，短碼可重新註冊
+	purged, _ := m.PurgeTombstones(ctx, now.Add(2*time.Hour), 10)
+	if purged != 1 {
+		t.Errorf("PurgeTombstones() = %d, want 1", purged)
+	}
+	if err := m.Save(ctx, newURL(5, "", "aaa")); err != nil {
+		t.Errorf("Save after purge error = %v", err)
+	}
+}
+
+func TestMemoryIncrementClicksLimit(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.Save(ctx, newURL(1, "", "once"))
+
+	// 併發點擊：恰好 maxClicks 次成功，其餘返回 ErrClickLimitReached
+	const maxClicks, clicks = 5, 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for range clicks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.IncrementClicks(ctx, "", "once", maxClicks)
+			if err != nil && !errors.Is(err, shortener.ErrClickLimitReached) {
+				t.Errorf("IncrementClicks() error = %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != maxClicks {
+		t.Errorf("%d clicks succeeded, want exactly %d", succeeded, maxClicks)
+	}
+	if got, _ := m.Load(ctx, "", "once"); got.Clicks != maxClicks {
+		t.Errorf("Clicks = %d, want %d (rejected clicks must not be counted)", got.Clicks, maxClicks)
+	}
+
+	// maxClicks = 0 不限次數
+	if n, err := m.IncrementClicks(ctx, "", "once", 0); err != nil || n != maxClicks+1 {
+		t.Errorf("IncrementClicks(unlimited) = %d, %v, want %d, nil", n, err, maxClicks+1)
+	}
+	if _, err := m.IncrementClicks(ctx, "", "missing", 1); !errors.Is(err, shortener.ErrNotFound) {
+		t.Errorf("IncrementClicks(missing) error = %v, want ErrNotFound", err)
+	}
+}
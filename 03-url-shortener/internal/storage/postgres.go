@@ -3,8 +3,14 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/koopa0/system-design/03-url-shortener/internal/analytics"
+	"github.com/koopa0/system-design/03-url-shortener/internal/lifecycle"
 	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
 )
 
@@ -14,34 +20,43 @@ import (
 //
 //  1. 表結構設計：
 //     - id：主鍵（Snowflake ID）
-//     - short_code：唯一索引（查詢優化）
+//     - short_code：短碼（域名內唯一）
+//     - domain：自定義域名（默認域名為空字符串）
 //     - long_url：原始 URL
 //     - clicks：點擊計數
 //     - created_at：創建時間
 //     - expires_at：過期時間（可選）
+//     - owner_id：所屬用戶（可選，匿名為 NULL）
+//     - disabled：停用標記
 //
 //  2. 索引策略：
 //     - PRIMARY KEY (id)：聚簇索引
-//     - UNIQUE INDEX (short_code)：查詢加速
+//     - UNIQUE INDEX (domain, short_code)：查詢加速
 //     - INDEX (created_at)：時間範圍查詢
+//     - INDEX (owner_id, id DESC)：用戶鏈接列表（游標分頁）
 //
 //  3. 併發控制：
-//     - short_code UNIQUE 約束：防止重複
+//     - (domain, short_code) UNIQUE 約束：防止重複
 //     - UPDATE ... SET clicks = clicks + 1：原子操作
+//     - url_tombstones：INSERT ... WHERE NOT EXISTS 防止冷卻期內重新註冊
 //
 // 表結構 SQL：
 //
 //	CREATE TABLE urls (
 //	  id         BIGINT PRIMARY KEY,
-//	  short_code VARCHAR(20) UNIQUE NOT NULL,
+//	  short_code VARCHAR(20) NOT NULL,
+//	  domain     VARCHAR(253) NOT NULL DEFAULT '',
 //	  long_url   TEXT NOT NULL,
 //	  clicks     BIGINT DEFAULT 0,
 //	  created_at TIMESTAMP NOT NULL,
-//	  expires_at TIMESTAMP
+//	  expires_at TIMESTAMP,
+//	  owner_id   BIGINT REFERENCES users(id),
+//	  disabled   BOOLEAN NOT NULL DEFAULT FALSE,
+//	  UNIQUE (domain, short_code)
 //	);
 //
-//	CREATE INDEX idx_short_code ON urls(short_code);
 //	CREATE INDEX idx_created_at ON urls(created_at);
+//	CREATE INDEX idx_owner_id ON urls(owner_id, id DESC);
 type Postgres struct {
 	db *sql.DB
 }
@@ -62,23 +77,46 @@ func NewPostgres(db *sql.DB) *Postgres {
 
 // Save 保存短網址
 //
-// SQL：INSERT INTO urls (...) VALUES (...)
+// SQL：
+//
+//	INSERT INTO urls (...)
+//	SELECT ... WHERE NOT EXISTS (未過期的墓碑)
 //
 // 錯誤處理：
 //   - UNIQUE 約束衝突 → ErrCodeExists
+//   - 墓碑存在（影響 0 行）→ ErrCodeReserved
+//
+// 為什麼把墓碑檢查寫進同一條 INSERT？
+//   - 先 SELECT 再 INSERT 有競態窗口（兩步之間狀態可能變化）
+//   - 單條語句由資料庫保證原子性
 func (p *Postgres) Save(ctx context.Context, url *shortener.URL) error {
 	query := `
-		INSERT INTO urls (id, short_code, long_url, clicks, created_at, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO urls (id, short_code, domain, long_url, clicks, created_at, expires_at, owner_id, disabled, rules, password_hash, max_clicks)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		WHERE NOT EXISTS (
+			SELECT 1 FROM url_tombstones
+			WHERE domain = $3 AND short_code = $2 AND reserved_until > NOW()
+		)
 	`
 
-	_, err := p.db.ExecContext(ctx, query,
+	rules, err := rulesJSON(url.Rules)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, query,
 		url.ID,
 		url.ShortCode,
+		url.Domain,
 		url.LongURL,
 		url.Clicks,
 		url.CreatedAt,
-		url.ExpiresAt, // nullable
+		url.ExpiresAt,          // nullable
+		nullInt64(url.OwnerID), // nullable（匿名）
+		url.Disabled,
+		rules,                        // nullable（無規則）
+		nullString(url.PasswordHash), // nullable（公開鏈接）
+		nullInt64(url.MaxClicks),     // nullable（不限次數）
 	)
 
 	if err != nil {
@@ -95,80 +133,577 @@ func (p *Postgres) Save(ctx context.Context, url *shortener.URL) error {
 		return err
 	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return shortener.ErrCodeReserved
+	}
+
 	return nil
 }
 
+// SaveBatch 批量保存短網址
+//
+// SQL：一條語句完成插入與逐條結果判定
+//
+//	WITH input (...) AS (VALUES (...), (...), ...),
+//	inserted AS (
+//	    INSERT INTO urls (...) SELECT ... FROM input
+//	    WHERE NOT EXISTS (墓碑)
+//	    ON CONFLICT DO NOTHING
+//	    RETURNING domain, short_code
+//	)
+//	SELECT domain, short_code, 結果 FROM input LEFT JOIN inserted ...
+//
+// 系統設計考量：
+//   - ON CONFLICT DO NOTHING：衝突行被跳過而不是讓整條語句失敗
+//     （單條 INSERT 遇到 unique_violation 會回滾整批）
+//   - RETURNING + LEFT JOIN：一次往返同時得到「哪些成功、哪些為什麼失敗」
+//   - 第一行 VALUES 顯式類型轉換：VALUES 列表無法從目標表推斷參數類型
+//   - 參數上限：PostgreSQL 單語句最多 65535 個參數，按批次切分
+func (p *Postgres) SaveBatch(ctx context.Context, urls []*shortener.URL) ([]error, error) {
+	const cols = 12
+	const maxRows = 65535 / cols
+
+	errs := make([]error, len(urls))
+	for start := 0; start < len(urls); start += maxRows {
+		end := min(start+maxRows, len(urls))
+		batch := urls[start:end]
+
+		var sb strings.Builder
+		sb.WriteString(`
+			WITH input (id, short_code, domain, long_url, clicks, created_at, expires_at, owner_id, disabled, rules, password_hash, max_clicks) AS (
+				VALUES `)
+
+		args := make([]any, 0, len(batch)*cols)
+		index := make(map[string]int, len(batch))
+		for i, url := range batch {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			n := i * cols
+			if i == 0 {
+				fmt.Fprintf(&sb, "($%d::bigint, $%d::varchar, $%d::varchar, $%d::text, $%d::bigint, $%d::timestamp, $%d::timestamp, $%d::bigint, $%d::boolean, $%d::jsonb, $%d::varchar, $%d::bigint)",
+					n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12)
+			} else {
+				fmt.Fprintf(&sb, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+					n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12)
+			}
+			rules, err := rulesJSON(url.Rules)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, url.ID, url.ShortCode, url.Domain, url.LongURL, url.Clicks,
+				url.CreatedAt, url.ExpiresAt, nullInt64(url.OwnerID), url.Disabled, rules,
+				nullString(url.PasswordHash), nullInt64(url.MaxClicks))
+			index[shortener.QualifiedCode(url.Domain, url.ShortCode)] = start + i
+		}
+
+		sb.WriteString(`
+			),
+			inserted AS (
+				INSERT INTO urls (id, short_code, domain, long_url, clicks, created_at, expires_at, owner_id, disabled, rules, password_hash, max_clicks)
+				SELECT i.* FROM input i
+				WHERE NOT EXISTS (
+					SELECT 1 FROM url_tombstones t
+					WHERE t.domain = i.domain AND t.short_code = i.short_code AND t.reserved_until > NOW()
+				)
+				ON CONFLICT DO NOTHING
+				RETURNING domain, short_code
+			)
+			SELECT i.domain, i.short_code,
+				CASE
+					WHEN ins.short_code IS NOT NULL THEN 'ok'
+					WHEN EXISTS (
+						SELECT 1 FROM url_tombstones t
+						WHERE t.domain = i.domain AND t.short_code = i.short_code AND t.reserved_until > NOW()
+					) THEN 'reserved'
+					ELSE 'exists'
+				END
+			FROM input i
+			LEFT JOIN inserted ins ON ins.domain = i.domain AND ins.short_code = i.short_code`)
+
+		rows, err := p.db.QueryContext(ctx, sb.String(), args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var domain, shortCode, status string
+			if err := rows.Scan(&domain, &shortCode, &status); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			i := index[shortener.QualifiedCode(domain, shortCode)]
+			switch status {
+			case "reserved":
+				errs[i] = shortener.ErrCodeReserved
+			case "exists":
+				errs[i] = shortener.ErrCodeExists
+			}
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rows.Close()
+	}
+
+	return errs, nil
+}
+
 // Load 加載短網址
 //
-// SQL：SELECT * FROM urls WHERE short_code = $1
+// SQL：SELECT * FROM urls WHERE domain = $1 AND short_code = $2
 //
 // 錯誤處理：
 //   - sql.ErrNoRows → ErrNotFound
 //   - 過期檢查在業務層（resolve.go）
-func (p *Postgres) Load(ctx context.Context, shortCode string) (*shortener.URL, error) {
-	query := `
-		SELECT id, short_code, long_url, clicks, created_at, expires_at
-		FROM urls
-		WHERE short_code = $1
-	`
+func (p *Postgres) Load(ctx context.Context, domain, shortCode string) (*shortener.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE domain = $1 AND short_code = $2`
+
+	url, err := scanURL(p.db.QueryRowContext(ctx, query, domain, shortCode))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, shortener.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// urlColumns URL 記錄的查詢字段（與 scanURL 順序一致）
+const urlColumns = `id, short_code, domain, long_url, clicks, created_at, expires_at, owner_id, disabled, rules, password_hash, max_clicks`
+
+// rowScanner 抽象 *sql.Row 與 *sql.Rows 的 Scan 方法
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
+// scanURL 掃描一行 URL 記錄
+//
+// 處理可空字段：
+//   - expires_at → *time.Time（NULL 表示永不過期）
+//   - owner_id → 0（NULL 表示匿名）
+//   - rules → nil（NULL 表示無路由規則）
+//   - password_hash → ""（NULL 表示公開鏈接）
+//   - max_clicks → 0（NULL 表示不限次數）
+func scanURL(row rowScanner) (*shortener.URL, error) {
 	var url shortener.URL
 	var expiresAt sql.NullTime // 處理 NULL 值
+	var ownerID sql.NullInt64
+	var rules []byte
+	var passwordHash sql.NullString
+	var maxClicks sql.NullInt64
 
-	err := p.db.QueryRowContext(ctx, query, shortCode).Scan(
+	err := row.Scan(
 		&url.ID,
 		&url.ShortCode,
+		&url.Domain,
 		&url.LongURL,
 		&url.Clicks,
 		&url.CreatedAt,
 		&expiresAt,
+		&ownerID,
+		&url.Disabled,
+		&rules,
+		&passwordHash,
+		&maxClicks,
 	)
-
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, shortener.ErrNotFound
-		}
 		return nil, err
 	}
 
-	// 處理 expires_at（可能為 NULL）
 	if expiresAt.Valid {
 		url.ExpiresAt = &expiresAt.Time
 	}
+	url.OwnerID = ownerID.Int64
+	url.PasswordHash = passwordHash.String
+	url.MaxClicks = maxClicks.Int64
+	if rules != nil {
+		if err := json.Unmarshal(rules, &url.Rules); err != nil {
+			return nil, fmt.Errorf("decode rules of %s: %w", shortener.QualifiedCode(url.Domain, url.ShortCode), err)
+		}
+	}
 
 	return &url, nil
 }
 
-// IncrementClicks 增加點擊計數
+// rulesJSON 將路由規則編碼為 JSONB 參數（無規則時為 SQL NULL）
 //
-// SQL：UPDATE urls SET clicks = clicks + 1 WHERE short_code = $1
+// 為什麼用 JSONB 而不是單獨的規則表？
+//   - 規則總是隨短碼整體讀寫，從不單獨查詢
+//   - 重定向熱路徑只需一次主鍵查詢，不需要 JOIN
+//   - 規則結構演進（新增條件類型）不需要遷移表結構
+func rulesJSON(rules []shortener.Rule) (any, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// nullInt64 將 0 轉換為 SQL NULL
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+// nullString 將空字符串轉換為 SQL NULL
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// IncrementClicks 增加點擊計數（maxClicks > 0 時為條件遞增）
+//
+// SQL：條件 UPDATE + 存在性檢查，一次往返
+//
+//	WITH target AS (SELECT 1 FROM urls WHERE domain = $1 AND short_code = $2),
+//	updated AS (
+//	    UPDATE urls SET clicks = clicks + 1
+//	    WHERE domain = $1 AND short_code = $2 AND ($3 = 0 OR clicks < $3)
+//	    RETURNING clicks
+//	)
+//	SELECT EXISTS (SELECT 1 FROM target), (SELECT clicks FROM updated)
+//
+// 為什麼條件寫在 WHERE 裡就是原子的？
+//   - UPDATE 對目標行加行鎖，併發的 UPDATE 排隊等待
+//   - 前一個事務提交後，READ COMMITTED 下等待者會在最新版本上重新評估 WHERE
+//   - 所以 clicks = N-1 時兩個副本同時點擊，只有一個能把它變成 N，另一個匹配 0 行
+//
+// 結果判定：
+//   - 行不存在 → ErrNotFound
+//   - 行存在但未更新 → ErrClickLimitReached
 //
 // 系統設計考量：
 //   - 原子操作：clicks = clicks + 1（資料庫保證）
 //   - 性能優化：僅更新一個字段
-//   - 返回值檢查：如果 RowsAffected = 0，說明短碼不存在
-func (p *Postgres) IncrementClicks(ctx context.Context, shortCode string) error {
+func (p *Postgres) IncrementClicks(ctx context.Context, domain, shortCode string, maxClicks int64) (int64, error) {
 	query := `
-		UPDATE urls
-		SET clicks = clicks + 1
-		WHERE short_code = $1
+		WITH target AS (
+			SELECT 1 FROM urls WHERE domain = $1 AND short_code = $2
+		),
+		updated AS (
+			UPDATE urls
+			SET clicks = clicks + 1
+			WHERE domain = $1 AND short_code = $2 AND ($3::bigint = 0 OR clicks < $3::bigint)
+			RETURNING clicks
+		)
+		SELECT EXISTS (SELECT 1 FROM target), (SELECT clicks FROM updated)
 	`
 
-	result, err := p.db.ExecContext(ctx, query, shortCode)
+	var found bool
+	var clicks sql.NullInt64
+	if err := p.db.QueryRowContext(ctx, query, domain, shortCode, maxClicks).Scan(&found, &clicks); err != nil {
+		return 0, err
+	}
+
+	if !found {
+		return 0, shortener.ErrNotFound
+	}
+	if !clicks.Valid {
+		return maxClicks, shortener.ErrClickLimitReached
+	}
+	return clicks.Int64, nil
+}
+
+// Update 部分更新短網址的可變字段
+//
+// SQL：只 SET 修改的列，RETURNING 返回更新後的整行
+//
+//	UPDATE urls SET disabled = $3 WHERE domain = $1 AND short_code = $2 RETURNING ...
+//
+// 為什麼不寫回整條記錄？
+//   - 併發修改不同字段時，整行寫回會用舊值覆蓋另一方的修改（Lost Update）
+//   - 每條 UPDATE 在行鎖下執行，只改自己的列，互不干擾
+//   - 另一種做法是樂觀鎖（version 列 + WHERE version = $n），衝突時需要客戶端重試
+//
+// 注意：不更新 clicks（由 IncrementClicks 原子維護，避免覆蓋併發的計數）
+func (p *Postgres) Update(ctx context.Context, domain, shortCode string, changes shortener.URLChanges) (*shortener.URL, error) {
+	var sets []string
+	args := []any{domain, shortCode}
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if changes.LongURL != nil {
+		set("long_url", *changes.LongURL)
+	}
+	switch {
+	case changes.ClearExpiry:
+		set("expires_at", nil)
+	case changes.ExpiresAt != nil:
+		set("expires_at", *changes.ExpiresAt)
+	}
+	if changes.Disabled != nil {
+		set("disabled", *changes.Disabled)
+	}
+	if changes.Rules != nil {
+		rules, err := rulesJSON(*changes.Rules)
+		if err != nil {
+			return nil, err
+		}
+		set("rules", rules)
+	}
+	if changes.PasswordHash != nil {
+		set("password_hash", nullString(*changes.PasswordHash))
+	}
+	if changes.MaxClicks != nil {
+		set("max_clicks", nullInt64(*changes.MaxClicks))
+	}
+
+	// 沒有修改：返回當前記錄
+	if len(sets) == 0 {
+		return p.Load(ctx, domain, shortCode)
+	}
+
+	query := `UPDATE urls SET ` + strings.Join(sets, ", ") + `
+		WHERE domain = $1 AND short_code = $2
+		RETURNING ` + urlColumns
+
+	url, err := scanURL(p.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, shortener.ErrNotFound
+		}
+		return nil, err
+	}
+	return url, nil
+}
+
+// Delete 刪除短網址並寫入墓碑
+//
+// 事務內執行：
+//  1. DELETE FROM urls WHERE domain = $1 AND short_code = $2
+//  2. INSERT INTO url_tombstones ... ON CONFLICT DO UPDATE
+//
+// 為什麼需要事務？
+//   - 刪除成功但墓碑寫入失敗 → 短碼可被立即搶註
+//   - 事務保證兩步要麼都成功，要麼都回滾
+func (p *Postgres) Delete(ctx context.Context, domain, shortCode string, reservedUntil time.Time) error {
+	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback() // Commit 後調用 Rollback 無副作用
 
-	// 檢查是否有行被更新
+	result, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE domain = $1 AND short_code = $2`, domain, shortCode)
+	if err != nil {
+		return err
+	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-
 	if rowsAffected == 0 {
 		return shortener.ErrNotFound
 	}
 
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO url_tombstones (domain, short_code, deleted_at, reserved_until)
+		VALUES ($1, $2, NOW(), $3)
+		ON CONFLICT (domain, short_code)
+		DO UPDATE SET deleted_at = EXCLUDED.deleted_at, reserved_until = EXCLUDED.reserved_until
+	`, domain, shortCode, reservedUntil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListByOwner 列出用戶的短網址（游標分頁）
+//
+// SQL：
+//
+//	SELECT ... FROM urls
+//	WHERE owner_id = $1 AND id < $2
+//	ORDER BY id DESC
+//	LIMIT $3
+//
+// 索引：idx_owner_id (owner_id, id DESC) → 索引範圍掃描，無需排序
+func (p *Postgres) ListByOwner(ctx context.Context, ownerID int64, cursor int64, limit int) ([]*shortener.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls
+		WHERE owner_id = $1 AND ($2::bigint = 0 OR id < $2::bigint)
+		ORDER BY id DESC
+		LIMIT $3`
+
+	rows, err := p.db.QueryContext(ctx, query, ownerID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*shortener.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, url)
+	}
+	return result, rows.Err()
+}
+
+// SaveUser 保存用戶
+//
+// 錯誤處理：
+//   - email 或 api_key_hash UNIQUE 約束衝突 → ErrUserExists
+func (p *Postgres) SaveUser(ctx context.Context, user *shortener.User) error {
+	query := `
+		INSERT INTO users (id, email, api_key_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err := p.db.ExecContext(ctx, query, user.ID, user.Email, user.APIKeyHash, user.CreatedAt)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return shortener.ErrUserExists
+		}
+		return err
+	}
+	return nil
+}
+
+// LoadUserByAPIKey 根據 API Key 哈希查詢用戶
+//
+// 每個認證請求都會調用，走 api_key_hash 唯一索引
+// 高 QPS 時可在進程內快取（短 TTL，避免撤銷 Key 後長時間有效）
+func (p *Postgres) LoadUserByAPIKey(ctx context.Context, keyHash string) (*shortener.User, error) {
+	query := `
+		SELECT id, email, api_key_hash, created_at
+		FROM users
+		WHERE api_key_hash = $1
+	`
+
+	var user shortener.User
+	err := p.db.QueryRowContext(ctx, query, keyHash).Scan(
+		&user.ID,
+		&user.Email,
+		&user.APIKeyHash,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, shortener.ErrUnauthorized
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SaveDomain 註冊自定義域名
+//
+// SQL：INSERT ... ON CONFLICT DO UPDATE ... WHERE（單語句原子認領）
+//
+//	INSERT INTO domains (...) VALUES (...)
+//	ON CONFLICT (name) DO UPDATE SET owner_id = EXCLUDED.owner_id, ...
+//	WHERE domains.verified_at IS NULL AND domains.created_at < $6
+//
+// 錯誤處理：
+//   - name 已存在且已驗證，或未驗證但尚未超過 DomainClaimTTL → 不更新（0 行）→ ErrDomainExists
+//   - 過期的未驗證記錄被整行覆蓋（新 owner、新 token），兩個用戶同時認領時只有一個成功
+func (p *Postgres) SaveDomain(ctx context.Context, domain *shortener.Domain) error {
+	query := `
+		INSERT INTO domains (name, owner_id, token, created_at, verified_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET
+			owner_id    = EXCLUDED.owner_id,
+			token       = EXCLUDED.token,
+			created_at  = EXCLUDED.created_at,
+			verified_at = EXCLUDED.verified_at
+		WHERE domains.verified_at IS NULL AND domains.created_at < $6
+	`
+
+	staleBefore := domain.CreatedAt.Add(-shortener.DomainClaimTTL)
+	result, err := p.db.ExecContext(ctx, query, domain.Name, domain.OwnerID, domain.Token, domain.CreatedAt, domain.VerifiedAt, staleBefore)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return shortener.ErrDomainExists
+	}
+	return nil
+}
+
+// domainColumns 域名記錄的查詢字段（與 scanDomain 順序一致）
+const domainColumns = `name, owner_id, token, created_at, verified_at`
+
+// scanDomain 掃描一行域名記錄
+func scanDomain(row rowScanner) (*shortener.Domain, error) {
+	var d shortener.Domain
+	var verifiedAt sql.NullTime
+	if err := row.Scan(&d.Name, &d.OwnerID, &d.Token, &d.CreatedAt, &verifiedAt); err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		d.VerifiedAt = &verifiedAt.Time
+	}
+	return &d, nil
+}
+
+// LoadDomain 按名稱查詢域名（主鍵查詢）
+func (p *Postgres) LoadDomain(ctx context.Context, name string) (*shortener.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains WHERE name = $1`
+
+	d, err := scanDomain(p.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, shortener.ErrDomainNotFound
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListDomains 列出用戶註冊的域名
+//
+// 索引：idx_domains_owner_id (owner_id, name)
+func (p *Postgres) ListDomains(ctx context.Context, ownerID int64) ([]*shortener.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains WHERE owner_id = $1 ORDER BY name`
+
+	rows, err := p.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*shortener.Domain
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+// MarkDomainVerified 標記域名已通過驗證
+func (p *Postgres) MarkDomainVerified(ctx context.Context, name, token string, verifiedAt time.Time) error {
+	result, err := p.db.ExecContext(ctx, `UPDATE domains SET verified_at = $3 WHERE name = $1 AND token = $2`, name, token, verifiedAt)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return shortener.ErrDomainNotFound
+	}
 	return nil
 }
 
@@ -203,24 +738,310 @@ func containsInner(s, substr string) bool {
 	return false
 }
 
+// ListExpired 列出過期鏈接（實現 lifecycle.Store）
+//
+// 索引：idx_expires_at（部分索引，只包含設置了過期時間的行）
+//   - 大部分鏈接永不過期，部分索引體積小
+//   - ORDER BY expires_at LIMIT n 是索引範圍掃描，無需排序
+func (p *Postgres) ListExpired(ctx context.Context, before time.Time, limit int) ([]*shortener.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls
+		WHERE expires_at IS NOT NULL AND expires_at < $1
+		ORDER BY expires_at
+		LIMIT $2`
+
+	rows, err := p.db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*shortener.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, url)
+	}
+	return result, rows.Err()
+}
+
+// RemoveExpired 刪除（或歸檔）過期鏈接並寫入墓碑（實現 lifecycle.Store）
+//
+// SQL：一條語句（data-modifying CTE），天然原子
+//
+//	WITH input (domain, short_code, reserved_until) AS (VALUES ...),
+//	removed  AS (DELETE FROM urls ... WHERE expires_at < $before RETURNING ...),
+//	archived AS (INSERT INTO urls_archive SELECT ... FROM removed WHERE $archive),
+//	tomb     AS (INSERT INTO url_tombstones ... FROM removed ON CONFLICT DO UPDATE)
+//	SELECT domain, short_code, reserved_until FROM removed
+//
+// 系統設計考量：
+//   - 刪除時再次檢查 expires_at：List 之後被延期的鏈接不會被誤刪
+//   - 只為實際刪除的行寫墓碑（JOIN removed）
+//   - 歸檔表沒有 short_code 唯一約束：同一短碼被回收再過期，可以歸檔多次
+func (p *Postgres) RemoveExpired(ctx context.Context, items []lifecycle.Expired, before time.Time, archive bool) ([]lifecycle.Expired, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`WITH input (domain, short_code, reserved_until) AS (VALUES `)
+
+	args := make([]any, 0, len(items)*3+2)
+	for i, item := range items {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		n := i * 3
+		if i == 0 {
+			fmt.Fprintf(&sb, "($%d::varchar, $%d::varchar, $%d::timestamp)", n+1, n+2, n+3)
+		} else {
+			fmt.Fprintf(&sb, "($%d, $%d, $%d)", n+1, n+2, n+3)
+		}
+		args = append(args, item.Domain, item.ShortCode, item.ReservedUntil)
+	}
+	beforeArg, archiveArg := len(args)+1, len(args)+2
+	args = append(args, before, archive)
+
+	fmt.Fprintf(&sb, `),
+		removed AS (
+			DELETE FROM urls u USING input i
+			WHERE u.domain = i.domain AND u.short_code = i.short_code AND u.expires_at < $%d
+			RETURNING u.*, i.reserved_until
+		),
+		archived AS (
+			INSERT INTO urls_archive (%s, archived_at)
+			SELECT %s, NOW() FROM removed
+			WHERE $%d::boolean
+		),
+		tomb AS (
+			INSERT INTO url_tombstones (domain, short_code, deleted_at, reserved_until)
+			SELECT domain, short_code, NOW(), reserved_until FROM removed
+			ON CONFLICT (domain, short_code)
+			DO UPDATE SET deleted_at = EXCLUDED.deleted_at, reserved_until = EXCLUDED.reserved_until
+		)
+		SELECT domain, short_code, reserved_until FROM removed`, beforeArg, urlColumns, urlColumns, archiveArg)
+
+	rows, err := p.db.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var removed []lifecycle.Expired
+	for rows.Next() {
+		var item lifecycle.Expired
+		if err := rows.Scan(&item.Domain, &item.ShortCode, &item.ReservedUntil); err != nil {
+			return nil, err
+		}
+		removed = append(removed, item)
+	}
+	return removed, rows.Err()
+}
+
+// PurgeTombstones 清除已到期的墓碑（實現 lifecycle.Store）
+//
+// 分批刪除（子查詢 LIMIT）：避免一次刪除大量行長時間持鎖
+func (p *Postgres) PurgeTombstones(ctx context.Context, now time.Time, limit int) (int64, error) {
+	result, err := p.db.ExecContext(ctx, `
+		DELETE FROM url_tombstones
+		WHERE (domain, short_code) IN (
+			SELECT domain, short_code FROM url_tombstones
+			WHERE reserved_until <= $1
+			LIMIT $2
+		)
+	`, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // CreateTable 創建資料庫表（初始化用）
 //
 // 僅在開發環境使用，生產環境應使用遷移工具（如 migrate）
+//
+// 可重複執行：新表直接按最新結構創建，舊版本的表通過 ADD COLUMN IF NOT EXISTS
+// 與約束替換升級到同一結構
 func (p *Postgres) CreateTable(ctx context.Context) error {
 	query := `
+		CREATE TABLE IF NOT EXISTS users (
+			id           BIGINT PRIMARY KEY,
+			email        VARCHAR(255) UNIQUE NOT NULL,
+			api_key_hash CHAR(64) UNIQUE NOT NULL,
+			created_at   TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS domains (
+			name        VARCHAR(253) PRIMARY KEY,
+			owner_id    BIGINT NOT NULL REFERENCES users(id),
+			token       CHAR(32) NOT NULL,
+			created_at  TIMESTAMP NOT NULL,
+			verified_at TIMESTAMP
+		);
+
 		CREATE TABLE IF NOT EXISTS urls (
 			id         BIGINT PRIMARY KEY,
-			short_code VARCHAR(20) UNIQUE NOT NULL,
+			short_code VARCHAR(20) NOT NULL,
+			domain     VARCHAR(253) NOT NULL DEFAULT '',
 			long_url   TEXT NOT NULL,
 			clicks     BIGINT DEFAULT 0,
 			created_at TIMESTAMP NOT NULL,
-			expires_at TIMESTAMP
+			expires_at TIMESTAMP,
+			owner_id   BIGINT REFERENCES users(id),
+			disabled   BOOLEAN NOT NULL DEFAULT FALSE,
+			rules      JSONB,
+			password_hash VARCHAR(60),
+			max_clicks    BIGINT CHECK (max_clicks > 0),
+			UNIQUE (domain, short_code)
 		);
 
-		CREATE INDEX IF NOT EXISTS idx_short_code ON urls(short_code);
+		CREATE TABLE IF NOT EXISTS url_tombstones (
+			domain         VARCHAR(253) NOT NULL DEFAULT '',
+			short_code     VARCHAR(20) NOT NULL,
+			deleted_at     TIMESTAMP NOT NULL,
+			reserved_until TIMESTAMP NOT NULL,
+			PRIMARY KEY (domain, short_code)
+		);
+
+		-- 舊版本升級：CREATE TABLE IF NOT EXISTS 不會改動已存在的表（見 scripts/init.sql）
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS owner_id BIGINT REFERENCES users(id);
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules JSONB;
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash VARCHAR(60);
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks BIGINT CHECK (max_clicks > 0);
+		ALTER TABLE url_tombstones ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'urls'::regclass AND conname = 'urls_short_code_key') THEN
+				ALTER TABLE urls DROP CONSTRAINT urls_short_code_key;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'urls'::regclass AND conname = 'urls_domain_short_code_key') THEN
+				ALTER TABLE urls ADD CONSTRAINT urls_domain_short_code_key UNIQUE (domain, short_code);
+			END IF;
+			IF (SELECT array_length(conkey, 1) FROM pg_constraint WHERE conrelid = 'url_tombstones'::regclass AND contype = 'p') <> 2 THEN
+				ALTER TABLE url_tombstones DROP CONSTRAINT url_tombstones_pkey, ADD PRIMARY KEY (domain, short_code);
+			END IF;
+		END $$;
+
+		CREATE INDEX IF NOT EXISTS idx_domains_owner_id ON domains(owner_id, name);
 		CREATE INDEX IF NOT EXISTS idx_created_at ON urls(created_at);
+		CREATE INDEX IF NOT EXISTS idx_owner_id ON urls(owner_id, id DESC);
+		CREATE INDEX IF NOT EXISTS idx_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_tombstones_reserved_until ON url_tombstones(reserved_until);
+
+		CREATE TABLE IF NOT EXISTS urls_archive (
+			LIKE urls,
+			archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+		ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS owner_id BIGINT;
+		ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS rules JSONB;
+		ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS password_hash VARCHAR(60);
+		ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS max_clicks BIGINT;
+		CREATE INDEX IF NOT EXISTS idx_archive_short_code ON urls_archive(domain, short_code);
+
+		CREATE TABLE IF NOT EXISTS click_rollups (
+			domain     VARCHAR(253) NOT NULL DEFAULT '',
+			short_code VARCHAR(20) NOT NULL,
+			hour       TIMESTAMP NOT NULL,
+			referrer   VARCHAR(255) NOT NULL,
+			country    VARCHAR(8) NOT NULL,
+			device     VARCHAR(16) NOT NULL,
+			variant    VARCHAR(64) NOT NULL DEFAULT 'default',
+			clicks     BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (domain, short_code, hour, referrer, country, device, variant)
+		);
+
+		ALTER TABLE click_rollups ADD COLUMN IF NOT EXISTS variant VARCHAR(64) NOT NULL DEFAULT 'default';
+		ALTER TABLE click_rollups ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+
+		DO $$
+		BEGIN
+			IF (SELECT array_length(conkey, 1) FROM pg_constraint WHERE conrelid = 'click_rollups'::regclass AND contype = 'p') <> 7 THEN
+				ALTER TABLE click_rollups DROP CONSTRAINT click_rollups_pkey,
+					ADD PRIMARY KEY (domain, short_code, hour, referrer, country, device, variant);
+			END IF;
+		END $$;
 	`
 
 	_, err := p.db.ExecContext(ctx, query)
 	return err
 }
+
+// SaveRollups 累加點擊匯總（實現 analytics.Store）
+//
+// SQL：多行 INSERT ... ON CONFLICT DO UPDATE（UPSERT）
+//
+//	INSERT INTO click_rollups (...) VALUES (...), (...), ...
+//	ON CONFLICT (domain, short_code, hour, referrer, country, device, variant)
+//	DO UPDATE SET clicks = click_rollups.clicks + EXCLUDED.clicks
+//
+// 系統設計考量：
+//   - 一次 flush 一條語句：減少網絡往返（N 行 1 次 RTT）
+//   - 累加而非覆蓋：多副本、多次 flush 寫同一行都正確
+//   - 同一語句內主鍵不能重複（PostgreSQL 限制），由管道聚合保證
+//   - 參數上限：PostgreSQL 單語句最多 65535 個參數，按批次切分
+func (p *Postgres) SaveRollups(ctx context.Context, rollups []analytics.Rollup) error {
+	const cols = 8
+	const maxRows = 65535 / cols
+
+	for start := 0; start < len(rollups); start += maxRows {
+		end := min(start+maxRows, len(rollups))
+		batch := rollups[start:end]
+
+		var sb strings.Builder
+		sb.WriteString(`INSERT INTO click_rollups (domain, short_code, hour, referrer, country, device, variant, clicks) VALUES `)
+
+		args := make([]any, 0, len(batch)*cols)
+		for i, r := range batch {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			n := i * cols
+			fmt.Fprintf(&sb, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+			args = append(args, r.Domain, r.ShortCode, r.Hour.UTC(), r.Referrer, r.Country, r.Device, r.Variant, r.Clicks)
+		}
+
+		sb.WriteString(`
+			ON CONFLICT (domain, short_code, hour, referrer, country, device, variant)
+			DO UPDATE SET clicks = click_rollups.clicks + EXCLUDED.clicks`)
+
+		if _, err := p.db.ExecContext(ctx, sb.String(), args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadRollups 讀取時間範圍內的點擊匯總 [from, to)
+//
+// 查詢走主鍵索引前綴 (domain, short_code, hour)，範圍掃描
+func (p *Postgres) LoadRollups(ctx context.Context, domain, shortCode string, from, to time.Time) ([]analytics.Rollup, error) {
+	query := `
+		SELECT domain, short_code, hour, referrer, country, device, variant, clicks
+		FROM click_rollups
+		WHERE domain = $1 AND short_code = $2 AND hour >= $3 AND hour < $4
+	`
+
+	rows, err := p.db.QueryContext(ctx, query, domain, shortCode, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []analytics.Rollup
+	for rows.Next() {
+		var r analytics.Rollup
+		if err := rows.Scan(&r.Domain, &r.ShortCode, &r.Hour, &r.Referrer, &r.Country, &r.Device, &r.Variant, &r.Clicks); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
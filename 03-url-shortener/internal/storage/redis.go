@@ -3,8 +3,13 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync/atomic"
 	"time"
 
+	"github.com/redis/go-redis/v9"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/lifecycle"
 	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
 )
 
@@ -29,19 +34,19 @@ import (
 //
 // 2. 一致性問題：
 //   - 問題：資料庫更新後，快取可能過時
-//   - 解法：寫入時主動更新快取（Write-Through）
-//   - 備選：寫入時刪除快取（Cache-Invalidation）
+//   - 創建：寫入時主動更新快取（Write-Through）
+//   - 修改/刪除：寫入後刪除快取（Cache-Invalidation + 延遲雙刪）
 //
 // 3. 熱點數據（Hot Key）：
 //   - 問題：某個短碼瞬間大量訪問（如病毒式傳播）
 //   - 現象：單個 Redis 節點過載
 //   - 解法：
-//     → 短期：本地快取（進程內 LRU）
+//     → 短期：本地快取（進程內 LRU）✅ 已實現（L1，見 localCache；跨副本失效見 SubscribeInvalidations）
 //     → 長期：一致性哈希 + 多副本
 //
 // 4. 快取穿透（Cache Penetration）：
-//   - 問題：查詢不存在的短碼，每次都穿透到 DB
-//   - 解法：快取空結果（TTL 較短，如 1 分鐘）
+//   - 問題：查詢不存在的短碼，每次都穿透到 DB（如爬蟲掃描隨機短碼）
+//   - 解法：快取空結果（TTL 較短，默認 1 分鐘）✅ 已實現（Redis 與 L1 都快取）
 //
 // 5. 快取雪崩（Cache Avalanche）：
 //   - 問題：大量快取同時過期，DB 瞬間壓力劇增
@@ -50,13 +55,76 @@ import (
 // 6. 快取擊穿（Cache Breakdown）：
 //   - 問題：熱點數據過期，大量請求同時查 DB
 //   - 解法：互斥鎖（只有一個請求查 DB）或永不過期
+//     ✅ 已實現：進程內請求合併（見 flightGroup），每個副本每個短碼同時只有一次回源
+//
+// 讀取路徑：
+//
+//	L1（進程內，~100ns）→ Redis（~0.5ms）→ 後端（~5ms）
+//	         ↑ 同一短碼的併發未命中在這裡合併
 type RedisCache struct {
 	client    RedisClient     // Redis 客戶端接口（便於測試）
 	backend   shortener.Store // 後端存儲（PostgreSQL）
 	ttl       time.Duration   // 快取 TTL（默認 1 小時）
 	keyPrefix string          // 鍵前綴（避免衝突）
+
+	negativeTTL time.Duration // 空結果的快取時間（默認 1 分鐘）
+	local       *localCache   // 進程內 L1 快取（nil 表示關閉）
+	flights     flightGroup   // 併發未命中合併
+
+	// 統計計數（/health 暴露）
+	localHits    atomic.Int64
+	redisHits    atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+	coalesced    atomic.Int64
 }
 
+// CacheStats 快取運行統計
+//
+// 解讀：
+//   - 命中率 = (local_hits + redis_hits) / (local_hits + redis_hits + misses)
+//   - negative_hits 高：大量請求不存在的短碼（爬蟲或掃描），負快取正在保護資料庫
+//   - coalesced 高：熱點鏈接的併發未命中被合併，否則這些請求都會回源
+type CacheStats struct {
+	LocalHits    int64 `json:"local_hits"`    // L1 命中（含空結果）
+	RedisHits    int64 `json:"redis_hits"`    // Redis 命中（含空結果）
+	NegativeHits int64 `json:"negative_hits"` // 命中空結果（以上兩項的子集）
+	Misses       int64 `json:"misses"`        // 回源到後端的次數
+	Coalesced    int64 `json:"coalesced"`     // 等待其他請求加載結果的次數
+	LocalEntries int   `json:"local_entries"` // L1 當前條目數
+}
+
+// CacheOption RedisCache 的可選配置
+type CacheOption func(*RedisCache)
+
+// WithNegativeTTL 設置空結果（短碼不存在）的快取時間
+//
+// 權衡：
+//   - 越長：掃描流量對資料庫的壓力越小
+//   - 越短：新創建的短碼在其他副本上越快可見
+//     （創建時覆蓋 Redis 並通知各副本清除 L1，只有通知丟失時才需要等空結果過期）
+func WithNegativeTTL(ttl time.Duration) CacheOption {
+	return func(r *RedisCache) {
+		r.negativeTTL = ttl
+	}
+}
+
+// WithLocalCache 設置進程內 L1 快取（size <= 0 或 ttl <= 0 表示關閉）
+func WithLocalCache(size int, ttl time.Duration) CacheOption {
+	return func(r *RedisCache) {
+		if size <= 0 || ttl <= 0 {
+			r.local = nil
+			return
+		}
+		r.local = newLocalCache(size, ttl)
+	}
+}
+
+// loadTimeout 合併加載的超時時間
+//
+// 合併後的加載不隨單個請求取消（見 flightGroup.do），需要自己的超時上限
+const loadTimeout = 5 * time.Second
+
 // RedisClient Redis 客戶端接口
 //
 // 為什麼定義接口？
@@ -68,6 +136,60 @@ type RedisClient interface {
 	Set(ctx context.Context, key string, value string, ttl time.Duration) error
 	Del(ctx context.Context, key string) error
 	Incr(ctx context.Context, key string) (int64, error)
+
+	// Publish 發布消息到頻道（沒有訂閱者時消息直接丟棄）
+	Publish(ctx context.Context, channel, message string) error
+
+	// Subscribe 訂閱頻道，每條消息調用一次 handle
+	//
+	// 阻塞直到 ctx 取消或連線中斷，返回時訂閱已結束（斷線期間的消息不會補發）
+	Subscribe(ctx context.Context, channel string, handle func(message string)) error
+}
+
+// NewGoRedisClient 將 go-redis 客戶端適配為 RedisClient
+//
+// 鍵不存在時 Get 返回 redis.Nil：RedisCache 把所有 Get 錯誤都當作未命中，無需區分
+func NewGoRedisClient(client redis.UniversalClient) RedisClient {
+	return goRedisClient{client: client}
+}
+
+type goRedisClient struct {
+	client redis.UniversalClient
+}
+
+func (c goRedisClient) Get(ctx context.Context, key string) (string, error) {
+	return c.client.Get(ctx, key).Result()
+}
+
+func (c goRedisClient) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c goRedisClient) Del(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+func (c goRedisClient) Incr(ctx context.Context, key string) (int64, error) {
+	return c.client.Incr(ctx, key).Result()
+}
+
+func (c goRedisClient) Publish(ctx context.Context, channel, message string) error {
+	return c.client.Publish(ctx, channel, message).Err()
+}
+
+func (c goRedisClient) Subscribe(ctx context.Context, channel string, handle func(message string)) error {
+	pubsub := c.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	for {
+		// 任何錯誤都結束訂閱：go-redis 會在背後重連，但重連前的消息已經丟失，
+		// 交給調用方處理（見 RedisCache.SubscribeInvalidations）
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+		handle(msg.Payload)
+	}
 }
 
 // NewRedisCache 創建 Redis 快取層
@@ -76,17 +198,39 @@ type RedisClient interface {
 //   - client：Redis 客戶端
 //   - backend：後端存儲（通常是 PostgreSQL）
 //   - ttl：快取過期時間（0 表示使用默認 1 小時）
-func NewRedisCache(client RedisClient, backend shortener.Store, ttl time.Duration) *RedisCache {
+//   - opts：可選配置（默認：空結果快取 1 分鐘，L1 10000 條 / 5 秒）
+func NewRedisCache(client RedisClient, backend shortener.Store, ttl time.Duration, opts ...CacheOption) *RedisCache {
 	if ttl == 0 {
 		ttl = time.Hour // 默認 1 小時
 	}
 
-	return &RedisCache{
-		client:    client,
-		backend:   backend,
-		ttl:       ttl,
-		keyPrefix: "url:",
+	r := &RedisCache{
+		client:      client,
+		backend:     backend,
+		ttl:         ttl,
+		keyPrefix:   "url:",
+		negativeTTL: time.Minute,
+		local:       newLocalCache(10000, 5*time.Second),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Stats 返回快取運行統計
+func (r *RedisCache) Stats() CacheStats {
+	stats := CacheStats{
+		LocalHits:    r.localHits.Load(),
+		RedisHits:    r.redisHits.Load(),
+		NegativeHits: r.negativeHits.Load(),
+		Misses:       r.misses.Load(),
+		Coalesced:    r.coalesced.Load(),
+	}
+	if r.local != nil {
+		stats.LocalEntries = r.local.len()
 	}
+	return stats
 }
 
 // Save 保存短網址
@@ -105,28 +249,88 @@ func (r *RedisCache) Save(ctx context.Context, url *shortener.URL) error {
 	}
 
 	// 2. 寫入 Redis（失敗不影響主流程）
-	key := r.keyPrefix + url.ShortCode
-	data, _ := json.Marshal(url)
-	_ = r.client.Set(ctx, key, string(data), r.ttl)
+	//
+	// 同時覆蓋了可能存在的空結果快取（創建前有人訪問過這個短碼）
+	key := shortener.QualifiedCode(url.Domain, url.ShortCode)
+	_ = r.client.Set(ctx, r.keyPrefix+key, encodeURL(url), r.ttl)
+	r.evictLocal(ctx, key)
 
 	return nil
 }
 
+// SaveBatch 批量保存短網址
+//
+// 先整批寫入後端，再為成功的條目寫入快取（預熱：營銷鏈接通常創建後立即被大量訪問）
+func (r *RedisCache) SaveBatch(ctx context.Context, urls []*shortener.URL) ([]error, error) {
+	errs, err := r.backend.SaveBatch(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, url := range urls {
+		if errs[i] != nil {
+			continue
+		}
+		key := shortener.QualifiedCode(url.Domain, url.ShortCode)
+		_ = r.client.Set(ctx, r.keyPrefix+key, encodeURL(url), r.ttl)
+		r.evictLocal(ctx, key)
+	}
+
+	return errs, nil
+}
+
 // Load 加載短網址（Cache-Aside 模式）
 //
 // 流程：
-//  1. 查詢 Redis
-//  2. Cache Hit：直接返回
-//  3. Cache Miss：查資料庫 → 寫入 Redis → 返回
+//  1. 查詢 L1（進程內）
+//  2. L1 未命中：合併同一短碼的併發請求，只有一個請求繼續往下
+//  3. 查詢 Redis：命中則回填 L1 並返回
+//  4. Redis 未命中：查資料庫 → 寫入 Redis 與 L1 → 返回
+//
+// 快取鍵：默認域名為 "url:<短碼>"，自定義域名為 "url:<域名>/<短碼>"（見 shortener.QualifiedCode）
+//   - 默認域名的鍵與引入自定義域名之前相同，升級時已有快取無需失效
 //
 // 性能優化：
-//   - 熱點數據：< 1ms（Redis 內存訪問）
+//   - 熱點數據：< 1µs（L1）/ < 1ms（Redis 內存訪問）
 //   - 冷數據：< 50ms（資料庫查詢 + Redis 寫入）
 //   - 命中率目標：> 95%（80/20 法則）
-func (r *RedisCache) Load(ctx context.Context, shortCode string) (*shortener.URL, error) {
-	key := r.keyPrefix + shortCode
+func (r *RedisCache) Load(ctx context.Context, domain, shortCode string) (*shortener.URL, error) {
+	key := shortener.QualifiedCode(domain, shortCode)
 
-	// 1. 查詢 Redis
+	// 1. 查詢 L1
+	if r.local != nil {
+		if url, ok := r.local.get(key); ok {
+			r.localHits.Add(1)
+			if url == nil {
+				r.negativeHits.Add(1)
+				return nil, shortener.ErrNotFound
+			}
+			// 過期條目交給下面的回源流程處理（與 Redis 路徑一致）
+			if !url.IsExpired() {
+				return url, nil
+			}
+			r.local.del(key)
+		}
+	}
+
+	// 2. 合併併發未命中
+	url, shared, err := r.flights.do(ctx, key, func(ctx context.Context) (*shortener.URL, error) {
+		ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+		defer cancel()
+		return r.load(ctx, domain, shortCode)
+	})
+	if shared {
+		r.coalesced.Add(1)
+	}
+	return url, err
+}
+
+// load 從 Redis 或後端加載（每個短碼同一時刻只有一個 goroutine 執行）
+func (r *RedisCache) load(ctx context.Context, domain, shortCode string) (*shortener.URL, error) {
+	localKey := shortener.QualifiedCode(domain, shortCode)
+	key := r.keyPrefix + localKey
+
+	// 3. 查詢 Redis
 	data, err := r.client.Get(ctx, key)
 	if err == nil {
 		// Cache Hit：檢查是否為空結果（快取穿透防護）
@@ -135,44 +339,105 @@ func (r *RedisCache) Load(ctx context.Context, shortCode string) (*shortener.URL
 		//   - 為什麼快取 "null"？
 		//     → 防止不存在的短碼重複查詢 DB（快取穿透）
 		//     → 攻擊場景：惡意請求大量不存在的短碼
-		//   - 為什麼 TTL 較短（1 分鐘）？
+		//   - 為什麼 TTL 較短（默認 1 分鐘）？
 		//     → 如果短碼後來被創建，可以快速生效
 		if data == "null" {
+			r.redisHits.Add(1)
+			r.negativeHits.Add(1)
+			r.localSet(localKey, nil, r.negativeTTL)
 			return nil, shortener.ErrNotFound
 		}
 
 		// 解析 JSON 並返回
-		var url shortener.URL
-		if err := json.Unmarshal([]byte(data), &url); err == nil {
+		if url, err := decodeURL(data); err == nil {
 			// 檢查過期（即使在快取中也要檢查）
-			if url.IsExpired() {
-				// 過期：刪除快取
-				_ = r.client.Del(ctx, key)
-				return nil, shortener.ErrExpired
+			//
+			// 過期：刪除快取並回源
+			//   - 過期判斷屬於業務層（Resolve 返回 410）
+			//   - 回源讀取讓 Stats、Update（延長有效期）仍能拿到記錄
+			//   - 快取中不保留過期條目，避免佔用內存
+			if !url.IsExpired() {
+				r.redisHits.Add(1)
+				r.localSet(localKey, url, r.ttl)
+				return url, nil
 			}
-			return &url, nil
+			_ = r.client.Del(ctx, key)
 		}
 	}
 
-	// 2. Cache Miss：查詢後端資料庫
-	url, err := r.backend.Load(ctx, shortCode)
+	// 4. Cache Miss：查詢後端資料庫
+	r.misses.Add(1)
+	url, err := r.backend.Load(ctx, domain, shortCode)
 	if err != nil {
 		// 快取穿透防護：短碼不存在時，也快取空結果（TTL 較短）
-		if err == shortener.ErrNotFound {
-			_ = r.client.Set(ctx, key, "null", time.Minute)
+		if errors.Is(err, shortener.ErrNotFound) {
+			_ = r.client.Set(ctx, key, "null", r.negativeTTL)
+			r.localSet(localKey, nil, r.negativeTTL)
 		}
 		return nil, err
 	}
 
-	// 3. 寫入 Redis（異步，不阻塞返回）
+	// 寫入 Redis（異步，不阻塞返回）
+	//
+	// 已過期的記錄不回填（否則每次訪問都會「寫入 → 命中過期 → 刪除」）
+	if url.IsExpired() {
+		return url, nil
+	}
+	r.localSet(localKey, url, r.ttl)
 	go func() {
-		data, _ := json.Marshal(url)
-		_ = r.client.Set(context.Background(), key, string(data), r.ttl)
+		_ = r.client.Set(context.Background(), key, encodeURL(url), r.ttl)
 	}()
 
 	return url, nil
 }
 
+// cachedURL Redis 中的快取格式
+//
+// shortener.URL 的 PasswordHash 標記為 json:"-"（避免經由 API 響應、日誌洩露），
+// 但快取命中時 Resolve 仍需要它校驗密碼，因此在這裡顯式寫入
+//
+// 字段名與舊格式相同（password_hash）：升級前寫入的快取條目仍能正確讀取
+type cachedURL struct {
+	*shortener.URL
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// encodeURL 序列化快取條目
+func encodeURL(url *shortener.URL) string {
+	data, _ := json.Marshal(cachedURL{URL: url, PasswordHash: url.PasswordHash})
+	return string(data)
+}
+
+// decodeURL 解析快取條目
+func decodeURL(data string) (*shortener.URL, error) {
+	entry := cachedURL{URL: new(shortener.URL)}
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		return nil, err
+	}
+	entry.URL.PasswordHash = entry.PasswordHash
+	return entry.URL, nil
+}
+
+// localSet 寫入 L1（未啟用時忽略）
+//
+// 有過期時間的鏈接，L1 條目不會活過鏈接本身的過期時間
+func (r *RedisCache) localSet(key string, url *shortener.URL, ttl time.Duration) {
+	if r.local == nil {
+		return
+	}
+	if url != nil && url.ExpiresAt != nil {
+		ttl = min(ttl, time.Until(*url.ExpiresAt))
+	}
+	r.local.set(key, url, ttl)
+}
+
+// localDel 刪除 L1 條目（未啟用時忽略）
+func (r *RedisCache) localDel(key string) {
+	if r.local != nil {
+		r.local.del(key)
+	}
+}
+
 // IncrementClicks 增加點擊計數
 //
 // 優化策略：
@@ -188,13 +453,191 @@ func (r *RedisCache) Load(ctx context.Context, shortCode string) (*shortener.URL
 //	A: 1) Redis 持久化（AOF/RDB）
 //	   2) 定期從 DB 恢復計數
 //
+//	Q: 限次鏈接（maxClicks > 0）能用 Redis INCR 計數嗎？
+//	A: 可以（INCR 本身原子），但計數必須與 DB 同源
+//	   Redis 丟失或過期後從 0 重新計數，會讓一次性鏈接被再次打開
+//	   因此限次鏈接的條件遞增始終在後端完成
+//
 // 當前實作：簡化版（直接調用後端）
 // 生產環境：應使用消息隊列批量更新
-func (r *RedisCache) IncrementClicks(ctx context.Context, shortCode string) error {
+func (r *RedisCache) IncrementClicks(ctx context.Context, domain, shortCode string, maxClicks int64) (int64, error) {
 	// 簡化實作：直接調用後端
 	// 生產環境優化：
 	//   1. Redis INCR（快速）
 	//   2. 定期批量同步到 DB（如每 10 秒）
 	//   3. 使用消息隊列（NATS/NSQ）解耦
-	return r.backend.IncrementClicks(ctx, shortCode)
+	clicks, err := r.backend.IncrementClicks(ctx, domain, shortCode, maxClicks)
+
+	// 點擊次數用完：刪除快取條目
+	//
+	// 快取中的 Clicks 是寫入時的舊值，不刪除的話之後每次訪問
+	// 都要走到後端的條件遞增才被拒絕；回源後 Load 直接看到已用完
+	if maxClicks > 0 && (errors.Is(err, shortener.ErrClickLimitReached) || (err == nil && clicks >= maxClicks)) {
+		key := shortener.QualifiedCode(domain, shortCode)
+		_ = r.client.Del(ctx, r.keyPrefix+key)
+		r.evictLocal(ctx, key)
+	}
+	return clicks, err
+}
+
+// invalidateDelay 延遲雙刪的等待時間
+//
+// 需要大於「Load 讀 DB → 回填快取」的最長耗時
+const invalidateDelay = 500 * time.Millisecond
+
+// Update 更新短網址並使快取失效
+//
+// 流程：
+//  1. 更新後端資料庫
+//  2. 刪除 Redis 條目（下次 Load 從 DB 讀取新值）
+//  3. 延遲後再刪一次（延遲雙刪）
+//
+// 為什麼刪除而不是直接覆蓋？
+//   - 覆蓋需要完整的最新記錄（clicks 等字段可能已被併發修改）
+//   - 刪除後由 Load 的 Cache-Aside 流程自然回填
+//
+// 為什麼需要延遲雙刪？
+//
+//	T1 Load：Cache Miss → 讀 DB（舊值）……………… 回填快取（舊值）❌
+//	T2 Update：            寫 DB（新值）→ 刪快取
+//
+//	T1 的回填發生在 T2 刪除之後，舊值會在快取中存活一個 TTL
+//	延遲再刪一次可以清掉這個「遲到」的回填
+func (r *RedisCache) Update(ctx context.Context, domain, shortCode string, changes shortener.URLChanges) (*shortener.URL, error) {
+	url, err := r.backend.Update(ctx, domain, shortCode, changes)
+	if err != nil {
+		return nil, err
+	}
+	r.invalidate(ctx, domain, shortCode)
+	return url, nil
+}
+
+// Delete 刪除短網址並使快取失效
+//
+// 與 Update 相同：先寫 DB，再刪快取（含延遲雙刪）
+// 刪除後下一次 Load 回源得到 ErrNotFound（負快取見 Load 與 WithNegativeTTL）
+func (r *RedisCache) Delete(ctx context.Context, domain, shortCode string, reservedUntil time.Time) error {
+	if err := r.backend.Delete(ctx, domain, shortCode, reservedUntil); err != nil {
+		return err
+	}
+	r.invalidate(ctx, domain, shortCode)
+	return nil
+}
+
+// invalidate 刪除快取條目（立即刪除 + 延遲雙刪）
+//
+// 刪除失敗只能容忍：DB 已經提交，最壞情況是舊值存活到 TTL 過期
+//
+// L1 分佈在每個副本：兩次刪除都廣播給其他副本（見 evictLocal），
+// 延遲的那次清掉其他副本在雙刪之間從 Redis 回填的舊值
+func (r *RedisCache) invalidate(ctx context.Context, domain, shortCode string) {
+	localKey := shortener.QualifiedCode(domain, shortCode)
+	key := r.keyPrefix + localKey
+	_ = r.client.Del(ctx, key)
+	r.evictLocal(ctx, localKey)
+
+	time.AfterFunc(invalidateDelay, func() {
+		ctx := context.Background()
+		_ = r.client.Del(ctx, key)
+		r.evictLocal(ctx, localKey)
+	})
+}
+
+// invalidationChannel L1 失效通知的頻道（加上 keyPrefix）
+const invalidationChannel = "invalidate"
+
+// evictLocal 刪除本副本的 L1 條目，並通知其他副本刪除
+//
+// 發布失敗只能容忍：其他副本的條目最多存活到 L1 的 TTL
+func (r *RedisCache) evictLocal(ctx context.Context, key string) {
+	r.localDel(key)
+	_ = r.client.Publish(ctx, r.keyPrefix+invalidationChannel, key)
+}
+
+// SubscribeInvalidations 接收其他副本的失效通知，刪除本副本的 L1 條目
+//
+// 阻塞直到 ctx 取消（通常在啟動時以 goroutine 運行）
+//
+// 為什麼需要跨副本失效？
+//   - 停用、刪除、修改目標都只在執行請求的副本上清除 L1
+//   - 其他副本的 L1 在 TTL 內繼續返回舊記錄：被停用的釣魚鏈接仍然可以訪問
+//
+// 為什麼用 Pub/Sub 而非縮短 TTL？
+//   - 失效是低頻事件（管理操作），廣播的代價很小
+//   - 縮短 TTL 會降低熱點鏈接的命中率，且仍然有不一致的窗口
+//
+// 可靠性：Pub/Sub 不保證送達（斷線期間的消息直接丟棄）
+//   - 訂閱中斷時清空整個 L1：漏掉的通知對應的條目一併清除
+//   - 重新訂閱之前的窗口退回原來的保證：舊值最多存活一個 L1 TTL
+func (r *RedisCache) SubscribeInvalidations(ctx context.Context) error {
+	const retryDelay = time.Second
+	for {
+		_ = r.client.Subscribe(ctx, r.keyPrefix+invalidationChannel, r.localDel)
+		if r.local != nil {
+			r.local.clear()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// ListByOwner 列出用戶的短網址
+//
+// 不經過快取：
+//   - 列表查詢是低頻管理操作
+//   - 分頁結果難以失效（任意鏈接變更都會影響某一頁）
+func (r *RedisCache) ListByOwner(ctx context.Context, ownerID int64, cursor int64, limit int) ([]*shortener.URL, error) {
+	return r.backend.ListByOwner(ctx, ownerID, cursor, limit)
+}
+
+// SaveUser 保存用戶（直接寫後端）
+func (r *RedisCache) SaveUser(ctx context.Context, user *shortener.User) error {
+	return r.backend.SaveUser(ctx, user)
+}
+
+// LoadUserByAPIKey 根據 API Key 哈希查詢用戶
+//
+// 當前直接查後端；認證 QPS 高時可以在 Redis 快取（Key 撤銷時需同步刪除）
+func (r *RedisCache) LoadUserByAPIKey(ctx context.Context, keyHash string) (*shortener.User, error) {
+	return r.backend.LoadUserByAPIKey(ctx, keyHash)
+}
+
+// SaveDomain 註冊自定義域名（直接寫後端）
+func (r *RedisCache) SaveDomain(ctx context.Context, domain *shortener.Domain) error {
+	return r.backend.SaveDomain(ctx, domain)
+}
+
+// LoadDomain 按名稱查詢域名
+//
+// 不經過 Redis：Host 路由的結果由 handler 在進程內快取，這裡的調用頻率很低
+func (r *RedisCache) LoadDomain(ctx context.Context, name string) (*shortener.Domain, error) {
+	return r.backend.LoadDomain(ctx, name)
+}
+
+// ListDomains 列出用戶註冊的域名（直接查後端）
+func (r *RedisCache) ListDomains(ctx context.Context, ownerID int64) ([]*shortener.Domain, error) {
+	return r.backend.ListDomains(ctx, ownerID)
+}
+
+// MarkDomainVerified 標記域名已通過驗證（直接寫後端）
+func (r *RedisCache) MarkDomainVerified(ctx context.Context, name, token string, verifiedAt time.Time) error {
+	return r.backend.MarkDomainVerified(ctx, name, token, verifiedAt)
+}
+
+// Purge 清除快取條目（實現 lifecycle.Purger）
+//
+// 後台清理任務刪除過期鏈接後調用，無需等待 TTL 到期
+func (r *RedisCache) Purge(ctx context.Context, items []lifecycle.Expired) error {
+	for _, item := range items {
+		key := shortener.QualifiedCode(item.Domain, item.ShortCode)
+		r.evictLocal(ctx, key)
+		if err := r.client.Del(ctx, r.keyPrefix+key); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// errRedisNil 模擬 redis.Nil（鍵不存在）
+var errRedisNil = errors.New("redis: nil")
+
+// fakeRedis 基於 map 的 RedisClient（忽略 TTL；Publish 同步調用訂閱者）
+type fakeRedis struct {
+	mu          sync.Mutex
+	data        map[string]string
+	gets        int
+	subscribers map[string][]func(string)
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{data: make(map[string]string), subscribers: make(map[string][]func(string))}
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gets++
+	v, ok := f.data[key]
+	if !ok {
+		return "", errRedisNil
+	}
+	return v, nil
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = value
+	return nil
+}
+
+func (f *fakeRedis) Del(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.data, key)
+	return nil
+}
+
+func (f *fakeRedis) Incr(ctx context.Context, key string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (f *fakeRedis) Publish(ctx context.Context, channel, message string) error {
+	f.mu.Lock()
+	handlers := slices.Clone(f.subscribers[channel])
+	f.mu.Unlock()
+	for _, handle := range handlers {
+		handle(message)
+	}
+	return nil
+}
+
+func (f *fakeRedis) Subscribe(ctx context.Context, channel string, handle func(message string)) error {
+	f.mu.Lock()
+	f.subscribers[channel] = append(f.subscribers[channel], handle)
+	f.mu.Unlock()
+
+	<-ctx.Done()
+	f.mu.Lock()
+	f.subscribers[channel] = nil
+	f.mu.Unlock()
+	return ctx.Err()
+}
+
+// subscribed 頻道當前的訂閱者數
+func (f *fakeRedis) subscribed(channel string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers[channel])
+}
+
+func (f *fakeRedis) get(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.data[key]
+}
+
+func TestRedisCachePasswordHash(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeRedis()
+	cache := NewRedisCache(client, NewMemory(), 0, WithLocalCache(0, 0))
+
+	url := newURL(1, "", "secret")
+	url.PasswordHash = "$2a$10$abcdefghijklmnopqrstuv"
+	if err := cache.Save(ctx, url); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// 通用序列化不帶出哈希
+	data, _ := json.Marshal(url)
+	if strings.Contains(string(data), url.PasswordHash) {
+		t.Errorf("json.Marshal(URL) leaks the password hash: %s", data)
+	}
+
+	// 快取條目顯式保存哈希，命中快取時密碼校驗仍然有效
+	if !strings.Contains(client.get("url:secret"), url.PasswordHash) {
+		t.Fatalf("cached entry %q has no password hash", client.get("url:secret"))
+	}
+	got, err := cache.Load(ctx, "", "secret")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got.PasswordHash != url.PasswordHash || !got.IsProtected() {
+		t.Errorf("Load() from Redis = %+v, want the password hash preserved", got)
+	}
+	if client.gets != 1 || cache.Stats().RedisHits != 1 {
+		t.Errorf("Load() did not hit Redis: gets=%d stats=%+v", client.gets, cache.Stats())
+	}
+}
+
+// TestRedisCacheInvalidationBroadcast 一個副本停用或刪除鏈接，其他副本的 L1 立即失效。
+func TestRedisCacheInvalidationBroadcast(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, backend := newFakeRedis(), NewMemory()
+	a := NewRedisCache(client, backend, 0, WithLocalCache(100, time.Hour))
+	b := NewRedisCache(client, backend, 0, WithLocalCache(100, time.Hour))
+	go b.SubscribeInvalidations(ctx)
+	for client.subscribed("url:invalidate") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := a.Save(ctx, newURL(1, "", "promo")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := b.Load(ctx, "", "promo"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if b.Stats().LocalEntries != 1 {
+		t.Fatalf("b.Stats() = %+v, want the link in b's L1", b.Stats())
+	}
+
+	// a 停用鏈接：b 的 L1 被清除，下一次讀取看到停用狀態（L1 的 TTL 是 1 小時）
+	disabled := true
+	if _, err := a.Update(ctx, "", "promo", shortener.URLChanges{Disabled: &disabled}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if url, err := b.Load(ctx, "", "promo"); err != nil || !url.Disabled {
+		t.Errorf("b.Load() after a disabled the link = %+v, %v, want disabled", url, err)
+	}
+
+	if err := a.Delete(ctx, "", "promo", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := b.Load(ctx, "", "promo"); !errors.Is(err, shortener.ErrNotFound) {
+		t.Errorf("b.Load() after a deleted the link error = %v, want ErrNotFound", err)
+	}
+
+	// 訂閱結束時清空 L1：中斷期間漏掉的通知不會留下舊值
+	cancel()
+	for client.subscribed("url:invalidate") != 0 || b.Stats().LocalEntries != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
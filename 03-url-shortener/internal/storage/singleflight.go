@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+// flightGroup 合併同一短碼的併發加載（singleflight）
+//
+// 快取擊穿（Cache Breakdown）場景：
+//
+//	熱點鏈接的快取過期瞬間，1000 個併發請求同時未命中
+//	沒有合併：1000 次 Redis 讀取 + 1000 次資料庫查詢
+//	合併後：  1 次 Redis 讀取 + 1 次資料庫查詢，其餘 999 個請求等待結果
+//
+// 為什麼不用 golang.org/x/sync/singleflight？
+//   - 邏輯只有幾十行，自己實現可以直接處理 context 取消（見 do）
+//   - 返回值是具體類型，不需要 interface{} 斷言
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall 一次進行中的加載
+type flightCall struct {
+	done chan struct{} // 加載完成後關閉
+	url  *shortener.URL
+	err  error
+}
+
+// do 執行 fn，同一 key 的併發調用共享同一次執行的結果
+//
+// 返回：
+//   - url：結果的副本（每個調用方各自一份，互相修改不影響）
+//   - shared：是否等待了其他調用方發起的加載（用於統計合併次數）
+//
+// Context 處理：
+//   - fn 收到的 context 不會隨發起者的請求結束而取消（context.WithoutCancel）
+//     否則第一個請求的客戶端斷開，會讓所有等待者一起失敗
+//   - 等待者各自響應自己的 ctx：超時或取消時立即返回，不影響加載本身
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*shortener.URL, error)) (url *shortener.URL, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, inflight := g.calls[key]
+	if !inflight {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+	}
+	g.mu.Unlock()
+
+	if !inflight {
+		go func() {
+			call.url, call.err = fn(context.WithoutCancel(ctx))
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, inflight, ctx.Err()
+	}
+
+	if call.err != nil {
+		return nil, inflight, call.err
+	}
+	urlCopy := *call.url
+	return &urlCopy, inflight, nil
+}
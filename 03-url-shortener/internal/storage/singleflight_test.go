@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/03-url-shortener/internal/shortener"
+)
+
+func TestFlightGroupCoalesce(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*shortener.URL, error) {
+		calls.Add(1)
+		<-release
+		return newURL(1, "", "hot"), nil
+	}
+
+	const callers = 50
+	var wg sync.WaitGroup
+	var shared, started atomic.Int32
+	urls := make([]*shortener.URL, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Add(1)
+			url, s, err := g.do(context.Background(), "hot", load)
+			if err != nil {
+				t.Errorf("do() error = %v", err)
+				return
+			}
+			if s {
+				shared.Add(1)
+			}
+			urls[i] = url
+		}()
+	}
+
+	// 等所有調用方都進入等待後再放行加載
+	for started.Load() < callers {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("load ran %d times, want 1", calls.Load())
+	}
+	if shared.Load() != callers-1 {
+		t.Errorf("shared = %d, want %d", shared.Load(), callers-1)
+	}
+
+	// 每個調用方拿到各自的副本
+	urls[0].LongURL = "https://evil.example"
+	for i, url := range urls[1:] {
+		if url == nil || url.LongURL != "https://example.com/hot" {
+			t.Fatalf("urls[%d] = %+v, want an independent copy", i+1, url)
+		}
+	}
+
+	// 加載完成後不再合併：下一次調用重新執行
+	release = make(chan struct{})
+	close(release)
+	if _, s, _ := g.do(context.Background(), "hot", load); s || calls.Load() != 2 {
+		t.Errorf("do() after completion: shared = %v, calls = %d, want a fresh load", s, calls.Load())
+	}
+}
+
+func TestFlightGroupCallerCancel(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	loadCtx := make(chan context.Context, 1)
+	load := func(ctx context.Context) (*shortener.URL, error) {
+		loadCtx <- ctx
+		<-release
+		return newURL(1, "", "hot"), nil
+	}
+
+	// 發起者的請求被取消：自己立即返回，加載繼續
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, _, err := g.do(ctx, "hot", load)
+		firstErr <- err
+	}()
+	fnCtx := <-loadCtx
+
+	waiter := make(chan *shortener.URL, 1)
+	go func() {
+		url, _, _ := g.do(context.Background(), "hot", load)
+		waiter <- url
+	}()
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller error = %v, want context.Canceled", err)
+	}
+	if fnCtx.Err() != nil {
+		t.Error("load context was canceled with the first caller")
+	}
+
+	close(release)
+	select {
+	case url := <-waiter:
+		if url == nil {
+			t.Error("other waiter got no result after the first caller canceled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("other waiter did not receive the result")
+	}
+}
+
+func TestFlightGroupError(t *testing.T) {
+	var g flightGroup
+	errDown := errors.New("db down")
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*shortener.URL, error) {
+		<-release
+		return nil, errDown
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if url, _, err := g.do(context.Background(), "k", load); !errors.Is(err, errDown) || url != nil {
+				t.Errorf("do() = %v, %v, want errDown", url, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,177 @@
+// Package geoip 提供基於本地資料庫文件的 IP → 國家代碼查詢
+//
+// 資料庫格式（CSV，每行一個網段）：
+//
+//	# 註解行以 # 開頭
+//	1.0.0.0/24,AU
+//	8.8.8.0/24,US
+//	2001:db8::/32,ZZ
+//
+// 為什麼使用本地文件而不是在線 API？
+//   - 延遲：內存查詢 < 1µs，在線 API 需要一次網絡往返（10-100ms）
+//   - 可用性：不依賴第三方服務
+//   - 成本：點擊量大時按次計費的 API 很昂貴
+//   - 隱私：訪客 IP 不離開我們的基礎設施
+//
+// 數據來源：
+//   - 可從 MaxMind GeoLite2 Country CSV、IP2Location LITE 等轉換而來
+//   - 建議每週更新一次（IP 分配會變動）
+//
+// 查詢算法：
+//   - 載入時將所有網段轉換為 [start, end] 區間並排序
+//   - 查詢時二分搜尋：O(log n)
+//   - 百萬條網段約佔 40 MB 內存
+package geoip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidRecord 當資料庫行格式錯誤時返回
+var ErrInvalidRecord = errors.New("invalid geoip record")
+
+// DB 內存中的 GeoIP 資料庫（只讀，併發安全）
+//
+// 設計考量：
+//   - 載入後不可變：查詢無需加鎖
+//   - 熱更新：調用方重新 Open 後原子替換指針即可
+type DB struct {
+	ranges []ipRange
+}
+
+// ipRange 一個連續的 IP 區間
+//
+// 統一使用 16 字節表示（IPv4 映射為 ::ffff:a.b.c.d）
+// 這樣 IPv4 與 IPv6 可以放在同一個有序數組中比較
+type ipRange struct {
+	start   net.IP
+	end     net.IP
+	country string
+}
+
+// Open 從文件載入 GeoIP 資料庫
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Load 從 Reader 解析 GeoIP 資料庫
+//
+// 格式錯誤的行會導致整體失敗（Fail-Fast）
+// 為什麼不跳過錯誤行？
+//   - 錯誤通常意味著文件損壞或格式轉換出錯
+//   - 靜默跳過會導致統計數據悄悄偏差，很難排查
+func Load(r io.Reader) (*DB, error) {
+	var ranges []ipRange
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cidr, country, ok := strings.Cut(line, ",")
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: missing country", ErrInvalidRecord, lineNo)
+		}
+
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidRecord, lineNo, err)
+		}
+
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if len(country) != 2 {
+			return nil, fmt.Errorf("%w: line %d: country must be ISO 3166-1 alpha-2", ErrInvalidRecord, lineNo)
+		}
+
+		start, end := networkBounds(ipNet)
+		ranges = append(ranges, ipRange{start: start, end: end, country: country})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// 按起始地址排序，供二分搜尋使用
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].start, ranges[j].start) < 0
+	})
+
+	return &DB{ranges: ranges}, nil
+}
+
+// Lookup 查詢 IP 所屬國家（ISO 3166-1 alpha-2，如 "TW"）
+//
+// 找不到時返回空字符串
+//
+// 時間複雜度：O(log n)
+func (db *DB) Lookup(ip net.IP) string {
+	if db == nil || ip == nil {
+		return ""
+	}
+	ip = ip.To16()
+	if ip == nil {
+		return ""
+	}
+
+	// 找到第一個 start > ip 的區間，候選者是它的前一個
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, ip) > 0
+	})
+	if i == 0 {
+		return ""
+	}
+
+	candidate := db.ranges[i-1]
+	if bytes.Compare(ip, candidate.end) <= 0 {
+		return candidate.country
+	}
+	return ""
+}
+
+// Country 解析字符串形式的 IP 並查詢國家
+//
+// 方便調用方直接傳入 RemoteAddr 解析後的字符串
+func (db *DB) Country(ip string) string {
+	return db.Lookup(net.ParseIP(ip))
+}
+
+// Len 返回網段數量（用於啟動日誌）
+func (db *DB) Len() int {
+	if db == nil {
+		return 0
+	}
+	return len(db.ranges)
+}
+
+// networkBounds 計算網段的起止地址（16 字節形式）
+func networkBounds(n *net.IPNet) (net.IP, net.IP) {
+	start := n.IP.To16()
+	mask := n.Mask
+	if len(mask) == net.IPv4len {
+		// IPv4 掩碼需要擴展到 16 字節（前 12 字節全 1）
+		mask = append(net.CIDRMask(96, 128)[:12:12], mask...)
+	}
+
+	end := make(net.IP, net.IPv6len)
+	for i := range end {
+		end[i] = start[i] | ^mask[i]
+	}
+	return start, end
+}
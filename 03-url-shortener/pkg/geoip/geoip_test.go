@@ -0,0 +1,85 @@
+package geoip
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testDB = `
+# 測試資料
+1.0.0.0/24,AU
+8.8.8.0/24,us
+203.69.0.0/16,TW
+2001:db8::/32,ZZ
+`
+
+func TestLookup(t *testing.T) {
+	db, err := Load(strings.NewReader(testDB))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		ip       string
+		expected string
+	}{
+		{"range start", "1.0.0.0", "AU"},
+		{"range end", "1.0.0.255", "AU"},
+		{"after range", "1.0.1.0", ""},
+		{"lowercase country normalized", "8.8.8.8", "US"},
+		{"wide range", "203.69.123.45", "TW"},
+		{"ipv6", "2001:db8::1", "ZZ"},
+		{"ipv6 outside", "2001:db9::1", ""},
+		{"before first range", "0.0.0.1", ""},
+		{"invalid ip", "not-an-ip", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.Country(tt.ip); got != tt.expected {
+				t.Errorf("Country(%s) = %q, want %q", tt.ip, got, tt.expected)
+			}
+		})
+	}
+
+	if db.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", db.Len())
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing country", "1.0.0.0/24"},
+		{"invalid cidr", "1.0.0.0/33,AU"},
+		{"invalid country", "1.0.0.0/24,AUS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(tt.input))
+			if !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("Load(%q) error = %v, want ErrInvalidRecord", tt.input, err)
+			}
+		})
+	}
+}
+
+func TestNilDB(t *testing.T) {
+	var db *DB
+	if got := db.Country("8.8.8.8"); got != "" {
+		t.Errorf("nil DB Country() = %q, want empty", got)
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	db, _ := Load(strings.NewReader(testDB))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Country("203.69.123.45")
+	}
+}
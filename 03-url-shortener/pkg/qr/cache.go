@@ -0,0 +1,78 @@
+package qr
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache 渲染結果的 LRU 快取（併發安全）
+//
+// 為什麼需要快取？
+//   - 編碼 + 掩碼評分 + PNG 壓縮約需數毫秒，遠高於一次重定向
+//   - 同一短碼的 QR Code 內容永不變化（短網址不變），天然可快取
+//   - 印刷流程、落地頁會反覆請求同一張圖
+//
+// 容量按條目數限制：單張 PNG 通常 1-10 KB，1000 條約 10 MB 以內
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List               // 最近使用的在前
+	items    map[string]*list.Element // key → 鏈表節點
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+// NewCache 創建快取（capacity <= 0 時默認 1000）
+func NewCache(capacity int) *Cache {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &Cache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get 讀取快取（命中時移到鏈表頭部）
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*cacheEntry).data, true
+	}
+	return nil, false
+}
+
+// Add 寫入快取（超過容量時淘汰最久未使用的條目）
+//
+// 調用方不應在寫入後修改 data（快取直接持有該切片）
+func (c *Cache) Add(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*cacheEntry).data = data
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, data: data})
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len 當前條目數
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,253 @@
+// Package qr 將短網址渲染為 QR Code 圖片（PNG / SVG）
+//
+// 分工：
+//   - 編碼（數據 → 模塊矩陣）：github.com/skip2/go-qrcode（純 Go，無 CGO）
+//   - 渲染（矩陣 → 圖片）：本包自行實現，以支持邊距、顏色、SVG 輸出
+//
+// 為什麼渲染不直接用編碼庫自帶的 PNG 輸出？
+//   - 自帶輸出固定 4 模塊邊距，且不支持 SVG
+//   - 印刷場景需要矢量圖（SVG 任意縮放不失真）和品牌顏色
+//
+// 容錯等級（Error Correction Level）：
+//
+//	L  約 7% 可恢復    數據密度最高，適合屏幕顯示
+//	M  約 15% 可恢復   默認
+//	Q  約 25% 可恢復   印刷品（可能磨損、折疊）
+//	H  約 30% 可恢復   中心需要疊加 Logo 時
+//
+// 等級越高，同樣內容需要的模塊越多（圖案更密）
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Format 輸出格式
+type Format string
+
+const (
+	PNG Format = "png"
+	SVG Format = "svg"
+)
+
+// Level 容錯等級
+type Level string
+
+const (
+	LevelL Level = "L"
+	LevelM Level = "M"
+	LevelQ Level = "Q"
+	LevelH Level = "H"
+)
+
+// 尺寸與邊距限制
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+// 錯誤定義
+var (
+	ErrInvalidFormat = errors.New("invalid qr format")
+	ErrInvalidLevel  = errors.New("invalid error correction level")
+	ErrInvalidColor  = errors.New("invalid color")
+	ErrInvalidSize   = errors.New("invalid qr size")
+	ErrInvalidMargin = errors.New("invalid qr margin")
+)
+
+// Options 渲染參數
+type Options struct {
+	Format     Format
+	Size       int        // 輸出邊長（像素；SVG 為 width/height 屬性）
+	Level      Level      // 容錯等級
+	Margin     int        // 靜區（quiet zone）寬度，單位為模塊；規範建議 4
+	Foreground color.RGBA // 深色模塊
+	Background color.RGBA // 淺色模塊與邊距
+}
+
+// DefaultOptions 默認渲染參數（256px PNG、M 級容錯、4 模塊邊距、黑底白字）
+func DefaultOptions() Options {
+	return Options{
+		Format:     PNG,
+		Size:       256,
+		Level:      LevelM,
+		Margin:     4,
+		Foreground: color.RGBA{0, 0, 0, 255},
+		Background: color.RGBA{255, 255, 255, 255},
+	}
+}
+
+// Validate 檢查參數範圍
+func (o Options) Validate() error {
+	if o.Format != PNG && o.Format != SVG {
+		return ErrInvalidFormat
+	}
+	if _, err := o.Level.recovery(); err != nil {
+		return err
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return ErrInvalidSize
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return ErrInvalidMargin
+	}
+	return nil
+}
+
+// Key 渲染參數的唯一表示（用作快取鍵的一部分）
+func (o Options) Key() string {
+	return fmt.Sprintf("%s|%d|%s|%d|%s|%s", o.Format, o.Size, o.Level, o.Margin, hexColor(o.Foreground), hexColor(o.Background))
+}
+
+// ContentType 輸出格式對應的 MIME 類型
+func (f Format) ContentType() string {
+	if f == SVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// ParseLevel 解析容錯等級（不區分大小寫）
+func ParseLevel(s string) (Level, error) {
+	l := Level(strings.ToUpper(s))
+	if _, err := l.recovery(); err != nil {
+		return "", err
+	}
+	return l, nil
+}
+
+// ParseColor 解析十六進制顏色（"RRGGBB" 或 "#RRGGBB"）
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, ErrInvalidColor
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidColor
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// Render 將內容編碼為 QR Code 並渲染
+func Render(content string, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	modules, err := encode(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Format == SVG {
+		return renderSVG(modules, opts), nil
+	}
+	return renderPNG(modules, opts)
+}
+
+// recovery 映射到編碼庫的容錯等級
+func (l Level) recovery() (qrcode.RecoveryLevel, error) {
+	switch l {
+	case LevelL:
+		return qrcode.Low, nil
+	case LevelM:
+		return qrcode.Medium, nil
+	case LevelQ:
+		return qrcode.High, nil
+	case LevelH:
+		return qrcode.Highest, nil
+	default:
+		return 0, ErrInvalidLevel
+	}
+}
+
+// encode 生成模塊矩陣（不含靜區），modules[y][x] 為 true 表示深色
+func encode(content string, level Level) ([][]bool, error) {
+	recovery, err := level.recovery()
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, recovery)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true // 邊距由渲染器控制
+	return code.Bitmap(), nil
+}
+
+// renderPNG 渲染 PNG
+//
+// 縮放方式：每個模塊佔整數個像素（scale），多餘像素均分到四周作為額外邊距
+//   - 非整數縮放會讓模塊寬窄不一，低分辨率時影響識別
+//   - 調色板圖像（2 色）：PNG 壓縮後通常只有 1-2 KB
+func renderPNG(modules [][]bool, opts Options) ([]byte, error) {
+	total := len(modules) + 2*opts.Margin
+	scale := opts.Size / total
+	if scale < 1 {
+		return nil, fmt.Errorf("%w: %dpx is smaller than %d modules", ErrInvalidSize, opts.Size, total)
+	}
+	offset := (opts.Size-scale*total)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			x0, y0 := offset+x*scale, offset+y*scale
+			for dy := range scale {
+				for dx := range scale {
+					img.SetColorIndex(x0+dx, y0+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG 渲染 SVG
+//
+// 設計考量：
+//   - viewBox 以模塊為單位，width/height 為輸出尺寸：任意縮放不失真
+//   - 所有深色模塊合併為一個 <path>：比每個模塊一個 <rect> 小一個數量級
+//   - shape-rendering="crispEdges"：避免抗鋸齒產生模塊間的細縫
+func renderSVG(modules [][]bool, opts Options) []byte {
+	total := len(modules) + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, total, total, hexColor(opts.Background))
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
+
+// hexColor 格式化為 "#rrggbb"
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
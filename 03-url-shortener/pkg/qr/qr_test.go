@@ -0,0 +1,200 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testURL = "https://sho.rt/8M0kX"
+
+func TestRenderPNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Margin = 0
+	opts.Foreground = color.RGBA{0x11, 0x22, 0x33, 255}
+
+	data, err := Render(testURL, opts)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != opts.Size || b.Dy() != opts.Size {
+		t.Fatalf("image size = %dx%d, want %dx%d", b.Dx(), b.Dy(), opts.Size, opts.Size)
+	}
+
+	// 無邊距時，左上角定位圖案（finder pattern）的外框從縮放餘量處開始
+	modules, _ := encode(testURL, opts.Level)
+	scale := opts.Size / len(modules)
+	offset := (opts.Size - scale*len(modules)) / 2
+
+	r, g, b, _ := img.At(offset, offset).RGBA()
+	if uint8(r>>8) != 0x11 || uint8(g>>8) != 0x22 || uint8(b>>8) != 0x33 {
+		t.Errorf("finder pattern pixel = #%02x%02x%02x, want #112233", r>>8, g>>8, b>>8)
+	}
+	if offset > 0 {
+		r, g, b, _ = img.At(0, 0).RGBA()
+		if r>>8 != 0xff || g>>8 != 0xff || b>>8 != 0xff {
+			t.Errorf("padding pixel = #%02x%02x%02x, want background", r>>8, g>>8, b>>8)
+		}
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Format = SVG
+	opts.Size = 512
+	opts.Background, _ = ParseColor("fafafa")
+
+	data, err := Render(testURL, opts)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	svg := string(data)
+	modules, _ := encode(testURL, opts.Level)
+	total := len(modules) + 2*opts.Margin
+
+	for _, want := range []string{
+		`width="512" height="512"`,
+		`viewBox="0 0 ` + strconv.Itoa(total) + ` ` + strconv.Itoa(total) + `"`,
+		`fill="#fafafa"`,
+		`fill="#000000"`,
+		"M4 4h1v1h-1z", // 左上角定位圖案的第一個模塊（偏移 4 模塊邊距）
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("svg missing %q", want)
+		}
+	}
+}
+
+func TestLevelDensity(t *testing.T) {
+	low, err := encode(testURL, LevelL)
+	if err != nil {
+		t.Fatalf("encode(L) error = %v", err)
+	}
+	high, err := encode(testURL, LevelH)
+	if err != nil {
+		t.Fatalf("encode(H) error = %v", err)
+	}
+	// 容錯等級越高，同樣內容需要的模塊越多（或相同版本）
+	if len(high) < len(low) {
+		t.Errorf("level H modules = %d, want >= level L modules %d", len(high), len(low))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		want   error
+	}{
+		{"default", func(o *Options) {}, nil},
+		{"bad format", func(o *Options) { o.Format = "gif" }, ErrInvalidFormat},
+		{"bad level", func(o *Options) { o.Level = "X" }, ErrInvalidLevel},
+		{"too small", func(o *Options) { o.Size = MinSize - 1 }, ErrInvalidSize},
+		{"too large", func(o *Options) { o.Size = MaxSize + 1 }, ErrInvalidSize},
+		{"negative margin", func(o *Options) { o.Margin = -1 }, ErrInvalidMargin},
+		{"margin too large", func(o *Options) { o.Margin = MaxMargin + 1 }, ErrInvalidMargin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			if err := opts.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTooSmallForModules(t *testing.T) {
+	// 長內容 + H 級容錯 + 最大邊距，64px 不足以讓每個模塊至少佔 1 像素
+	opts := DefaultOptions()
+	opts.Size = MinSize
+	opts.Level = LevelH
+	opts.Margin = MaxMargin
+
+	_, err := Render(testURL+strings.Repeat("x", 100), opts)
+	if !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("Render() error = %v, want ErrInvalidSize", err)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{"000000", color.RGBA{0, 0, 0, 255}, false},
+		{"#FF8000", color.RGBA{255, 128, 0, 255}, false},
+		{"ff8000", color.RGBA{255, 128, 0, 255}, false},
+		{"fff", color.RGBA{}, true},
+		{"gggggg", color.RGBA{}, true},
+		{"", color.RGBA{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseColor(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseColor(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"l", "M", "q", "H"} {
+		if _, err := ParseLevel(s); err != nil {
+			t.Errorf("ParseLevel(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseLevel("Z"); !errors.Is(err, ErrInvalidLevel) {
+		t.Errorf("ParseLevel(Z) error = %v, want ErrInvalidLevel", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	c.Add("a", []byte("A"))
+	c.Add("b", []byte("B"))
+
+	// 訪問 a，使 b 成為最久未使用
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get(a) miss, want hit")
+	}
+	c.Add("c", []byte("C"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) hit, want evicted")
+	}
+	if v, ok := c.Get("a"); !ok || string(v) != "A" {
+		t.Errorf("Get(a) = %q, %v, want A, true", v, ok)
+	}
+	if v, ok := c.Get("c"); !ok || string(v) != "C" {
+		t.Errorf("Get(c) = %q, %v, want C, true", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func BenchmarkRenderPNG(b *testing.B) {
+	opts := DefaultOptions()
+	for i := 0; i < b.N; i++ {
+		Render(testURL, opts)
+	}
+}
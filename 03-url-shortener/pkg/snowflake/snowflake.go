@@ -102,6 +102,38 @@ func (g *Generator) Generate() (int64, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	return g.nextLocked()
+}
+
+// GenerateN 批量生成 n 個 Snowflake ID
+//
+// 與循環調用 Generate 的區別：
+//   - 只加鎖一次：批量場景（如批量創建短網址）減少鎖競爭
+//   - 結果連續遞增：同一批次的 ID 在資料庫索引中相鄰，插入更友好
+//
+// 注意：n 超過 4096 時會跨越多個毫秒（序列號用盡後等待下一毫秒），
+// 期間其他調用方會被阻塞
+func (g *Generator) GenerateN(n int) ([]int64, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ids := make([]int64, n)
+	for i := range ids {
+		id, err := g.nextLocked()
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// nextLocked 生成下一個 ID（調用方必須持有 g.mu）
+func (g *Generator) nextLocked() (int64, error) {
 	// 獲取當前時間戳（毫秒）
 	timestamp := currentMilliseconds()
 
@@ -222,6 +222,43 @@ func TestSequenceOverflow(t *testing.T) {
 	}
 }
 
+func TestGenerateN(t *testing.T) {
+	gen, err := NewGenerator(1)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+
+	// 超過單毫秒容量（4096），驗證跨毫秒時仍然唯一且遞增
+	count := 5000
+	ids, err := gen.GenerateN(count)
+	if err != nil {
+		t.Fatalf("GenerateN() error = %v", err)
+	}
+	if len(ids) != count {
+		t.Fatalf("GenerateN() returned %d IDs, want %d", len(ids), count)
+	}
+
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("IDs not strictly increasing at %d: %d <= %d", i, ids[i], ids[i-1])
+		}
+	}
+
+	// 後續單個生成的 ID 必須大於批量結果
+	next, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if next <= ids[len(ids)-1] {
+		t.Errorf("Generate() after GenerateN = %d, want > %d", next, ids[len(ids)-1])
+	}
+
+	// 邊界：n <= 0
+	if ids, err := gen.GenerateN(0); err != nil || len(ids) != 0 {
+		t.Errorf("GenerateN(0) = %v, %v, want empty, nil", ids, err)
+	}
+}
+
 func TestConstants(t *testing.T) {
 	t.Logf("Max IDs per millisecond: %d", MaxIDsPerMillisecond())
 	t.Logf("Max machines: %d", MaxMachines())
@@ -286,6 +323,14 @@ func BenchmarkGenerateConcurrent(b *testing.B) {
 	})
 }
 
+func BenchmarkGenerateN(b *testing.B) {
+	gen, _ := NewGenerator(1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gen.GenerateN(100)
+	}
+}
+
 func BenchmarkParseID(b *testing.B) {
 	gen, _ := NewGenerator(1)
 	id, _ := gen.Generate()
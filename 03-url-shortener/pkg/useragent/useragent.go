@@ -0,0 +1,105 @@
+// Package useragent 提供輕量級的 User-Agent 設備分類
+//
+// 為什麼不用完整的 UA 解析庫？
+//   - 統計只需要粗粒度分類（桌面 / 手機 / 平板 / 爬蟲）
+//   - 完整解析庫（規則上千條）每次調用需要數十微秒
+//   - 關鍵字匹配足以覆蓋 95%+ 的真實流量
+//
+// 已知限制：
+//   - iPadOS 13+ 預設偽裝成 macOS Safari，會被歸類為桌面
+//   - 自定義 UA 的客戶端（如 curl）歸類為 unknown
+package useragent
+
+import "strings"
+
+// Device 設備分類
+type Device string
+
+const (
+	Desktop Device = "desktop"
+	Mobile  Device = "mobile"
+	Tablet  Device = "tablet"
+	Bot     Device = "bot"
+	Unknown Device = "unknown"
+)
+
+// botKeywords 常見爬蟲與預覽抓取器的 UA 關鍵字
+//
+// 系統設計考量：
+//   - 社交平台分享短鏈時會先抓取預覽（facebookexternalhit、Slackbot）
+//   - 這些請求不是真人點擊，應單獨統計，避免灌水
+var botKeywords = []string{
+	"bot", "crawler", "spider", "slurp",
+	"facebookexternalhit", "embedly", "preview",
+	"curl", "wget", "python-requests", "go-http-client",
+}
+
+// Classify 根據 User-Agent 判斷設備分類
+//
+// 判斷順序很重要：
+//  1. 爬蟲優先（很多爬蟲 UA 也包含 "Mobile"）
+//  2. 平板先於手機（Android 平板 UA 不含 "Mobile"，iPad 含 "Mobile"）
+//  3. 最後是桌面
+func Classify(ua string) Device {
+	if ua == "" {
+		return Unknown
+	}
+	s := strings.ToLower(ua)
+
+	for _, kw := range botKeywords {
+		if strings.Contains(s, kw) {
+			return Bot
+		}
+	}
+
+	switch {
+	case strings.Contains(s, "ipad"), strings.Contains(s, "tablet"),
+		strings.Contains(s, "android") && !strings.Contains(s, "mobile"):
+		return Tablet
+	case strings.Contains(s, "mobi"), strings.Contains(s, "iphone"), strings.Contains(s, "ipod"),
+		strings.Contains(s, "android"):
+		return Mobile
+	case strings.Contains(s, "windows"), strings.Contains(s, "macintosh"),
+		strings.Contains(s, "x11"), strings.Contains(s, "cros"), strings.Contains(s, "linux"):
+		return Desktop
+	}
+
+	return Unknown
+}
+
+// Platform 操作系統平台（用於條件路由，如 App Store / Google Play 分流）
+type Platform string
+
+const (
+	IOS       Platform = "ios"
+	Android   Platform = "android"
+	DesktopOS Platform = "desktop"
+	OtherOS   Platform = "other"
+)
+
+// DetectPlatform 根據 User-Agent 判斷操作系統平台
+//
+// 與 Classify 的區別：
+//   - Classify 關心設備形態（手機 / 平板），用於統計
+//   - DetectPlatform 關心應用商店歸屬（iOS / Android），用於路由
+//   - iPad 與 iPhone 同屬 iOS；Android 手機與平板同屬 Android
+//
+// 爬蟲歸為 other：預覽抓取器應看到默認目標，而不是某個平台的落地頁
+func DetectPlatform(ua string) Platform {
+	if Classify(ua) == Bot {
+		return OtherOS
+	}
+	s := strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(s, "iphone"), strings.Contains(s, "ipad"), strings.Contains(s, "ipod"):
+		return IOS
+	case strings.Contains(s, "android"):
+		return Android
+	case strings.Contains(s, "windows"), strings.Contains(s, "macintosh"),
+		strings.Contains(s, "x11"), strings.Contains(s, "cros"), strings.Contains(s, "linux"):
+		return DesktopOS
+	}
+
+	return OtherOS
+}
@@ -6,6 +6,35 @@
 --   3. 約束：保證數據一致性
 --   4. 擴展性：為未來分片做準備
 
+-- 創建 users 表
+--
+-- 系統設計考量：
+--   - API Key 只存 SHA-256 哈希（64 位十六進制），明文只在註冊時返回一次
+--   - api_key_hash 唯一索引：每個認證請求都按哈希等值查詢
+CREATE TABLE IF NOT EXISTS users (
+    id           BIGINT PRIMARY KEY,          -- Snowflake ID
+    email        VARCHAR(255) UNIQUE NOT NULL,
+    api_key_hash CHAR(64) UNIQUE NOT NULL,    -- SHA-256(api_key)
+    created_at   TIMESTAMP NOT NULL
+);
+
+-- 自定義域名表
+--
+-- 系統設計考量：
+--   - name 為主鍵：域名全局唯一（同一 Host 只能路由到一個用戶的鏈接）
+--   - token：DNS TXT 驗證令牌（_shortener.<name> = "shortener-verification=<token>"）
+--   - verified_at 為 NULL：未驗證，不參與 Host 路由，也不能創建鏈接
+--   - 未驗證超過 7 天（DomainClaimTTL）的註冊可被其他用戶重新認領，防止搶註者永久佔住域名
+CREATE TABLE IF NOT EXISTS domains (
+    name        VARCHAR(253) PRIMARY KEY,   -- 小寫主機名（不含端口）
+    owner_id    BIGINT NOT NULL REFERENCES users(id),
+    token       CHAR(32) NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    verified_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_domains_owner_id ON domains(owner_id, name);
+
 -- 創建 urls 表
 CREATE TABLE IF NOT EXISTS urls (
     -- 主鍵：Snowflake ID（64-bit 整數）
@@ -17,10 +46,16 @@ CREATE TABLE IF NOT EXISTS urls (
 
     -- 短碼：用戶訪問的路徑（如 "8M0kX"）
     -- 系統設計：
-    --   - UNIQUE 約束：防止衝突（原子性保證）
+    --   - UNIQUE (domain, short_code)：同一域名內防止衝突（原子性保證）
     --   - 索引：優化查詢（最高頻操作）
     --   - VARCHAR(20)：足夠長（Base62 編碼最多 11 字符）
-    short_code VARCHAR(20) UNIQUE NOT NULL,
+    short_code VARCHAR(20) NOT NULL,
+
+    -- 自定義域名（如 "go.ourbrand.com"）
+    -- 系統設計：
+    --   - 空字符串表示默認域名（而不是 NULL：UNIQUE 約束中 NULL 互不相等）
+    --   - 不設外鍵：域名記錄被移除後，歷史鏈接仍可查詢統計
+    domain VARCHAR(253) NOT NULL DEFAULT '',
 
     -- 原始 URL
     -- 系統設計：
@@ -47,19 +82,97 @@ CREATE TABLE IF NOT EXISTS urls (
     --   - NULL 表示永不過期
     --   - 惰性刪除：訪問時檢查
     --   - 定期清理：批量刪除過期記錄
-    expires_at TIMESTAMP
+    expires_at TIMESTAMP,
+
+    -- 所屬用戶（可選）
+    -- 系統設計：
+    --   - NULL 表示匿名創建
+    --   - 外鍵約束：防止孤兒數據
+    owner_id BIGINT REFERENCES users(id),
+
+    -- 停用標記
+    -- 系統設計：
+    --   - 可逆下架（與刪除不同）：保留統計數據與短碼佔用
+    --   - 重定向時返回 410 Gone
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+
+    -- 條件路由規則（設備 / 國家 / A/B 分流）
+    -- 系統設計：
+    --   - NULL 表示無規則，直接跳轉 long_url
+    --   - JSONB：規則隨短碼整體讀寫，重定向只需一次主鍵查詢
+    rules JSONB,
+
+    -- 訪問密碼（bcrypt 哈希，固定 60 字符）
+    -- 系統設計：
+    --   - NULL 表示公開鏈接
+    --   - 不存明文：資料庫洩漏也無法直接得到密碼
+    password_hash VARCHAR(60),
+
+    -- 點擊上限（1 即一次性鏈接）
+    -- 系統設計：
+    --   - NULL 表示不限次數
+    --   - 條件遞增：UPDATE ... SET clicks = clicks + 1 WHERE clicks < max_clicks
+    --     行鎖 + 重新評估 WHERE，多副本併發點擊也不會超發
+    max_clicks BIGINT CHECK (max_clicks > 0),
+
+    -- 短碼在域名內唯一（重定向查詢 WHERE domain = ? AND short_code = ? 走此索引）
+    UNIQUE (domain, short_code)
 );
 
+-- 墓碑表（已刪除的短碼）
+--
+-- 系統設計考量：
+--   - 刪除後短碼在 reserved_until 之前不可被重新註冊
+--   - 防止舊鏈接（印在海報、郵件中）的訪客被導向搶註者的目標
+--   - 插入新短碼時：INSERT ... WHERE NOT EXISTS (未過期墓碑)，單語句原子檢查
+--   - 按域名劃分：一個域名下的墓碑不影響其他域名註冊同名短碼
+CREATE TABLE IF NOT EXISTS url_tombstones (
+    domain         VARCHAR(253) NOT NULL DEFAULT '',
+    short_code     VARCHAR(20) NOT NULL,
+    deleted_at     TIMESTAMP NOT NULL,
+    reserved_until TIMESTAMP NOT NULL,
+    PRIMARY KEY (domain, short_code)
+);
+
+-- 舊版本升級（遷移）
+--
+-- 系統設計考量：
+--   - CREATE TABLE IF NOT EXISTS 對已存在的表不做任何事，新增的列和約束要單獨 ALTER
+--   - 每條語句都可重複執行：ADD COLUMN IF NOT EXISTS，約束先查 pg_constraint 再替換
+--   - 舊表的 short_code 全局唯一（urls_short_code_key），換成域名內唯一
+--   - 大表上 ADD CONSTRAINT 會掃表並持鎖，生產環境應在低峰期或用遷移工具分步執行
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS owner_id BIGINT REFERENCES users(id);
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules JSONB;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash VARCHAR(60);
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks BIGINT CHECK (max_clicks > 0);
+ALTER TABLE url_tombstones ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'urls'::regclass AND conname = 'urls_short_code_key') THEN
+        ALTER TABLE urls DROP CONSTRAINT urls_short_code_key;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'urls'::regclass AND conname = 'urls_domain_short_code_key') THEN
+        ALTER TABLE urls ADD CONSTRAINT urls_domain_short_code_key UNIQUE (domain, short_code);
+    END IF;
+    -- 舊墓碑主鍵只有 short_code
+    IF (SELECT array_length(conkey, 1) FROM pg_constraint WHERE conrelid = 'url_tombstones'::regclass AND contype = 'p') <> 2 THEN
+        ALTER TABLE url_tombstones DROP CONSTRAINT url_tombstones_pkey, ADD PRIMARY KEY (domain, short_code);
+    END IF;
+END $$;
+
 -- 索引設計
 --
 -- 系統設計考量：
 --   1. 查詢模式分析：
---      - 最高頻：WHERE short_code = ?（重定向）
+--      - 最高頻：WHERE domain = ? AND short_code = ?（重定向）
 --      - 中頻：WHERE created_at >= ? AND created_at < ?（統計）
 --      - 低頻：WHERE id = ?（主鍵查詢）
 --
 --   2. 索引選擇：
---      - short_code：UNIQUE INDEX（查詢 + 唯一性約束）
+--      - (domain, short_code)：UNIQUE INDEX（查詢 + 唯一性約束）
 --      - created_at：B-Tree INDEX（範圍查詢）
 --      - id：PRIMARY KEY（自動創建聚簇索引）
 --
@@ -68,18 +181,76 @@ CREATE TABLE IF NOT EXISTS urls (
 --      ❌ 缺點：增加寫入開銷、佔用存儲空間
 --      決策：讀多寫少，索引利大於弊
 
--- short_code 唯一索引（已通過 UNIQUE 約束自動創建）
--- CREATE UNIQUE INDEX idx_short_code ON urls(short_code);
+-- (domain, short_code) 唯一索引（已通過 UNIQUE 約束自動創建）
+-- CREATE UNIQUE INDEX idx_domain_short_code ON urls(domain, short_code);
 
 -- created_at 索引（支持時間範圍查詢）
-CREATE INDEX idx_created_at ON urls(created_at);
+CREATE INDEX IF NOT EXISTS idx_created_at ON urls(created_at);
+
+-- owner_id 複合索引（用戶鏈接列表，游標分頁）
+--   - 查詢：WHERE owner_id = ? AND id < ? ORDER BY id DESC LIMIT ?
+--   - (owner_id, id DESC) 使查詢成為索引範圍掃描，無需額外排序
+CREATE INDEX IF NOT EXISTS idx_owner_id ON urls(owner_id, id DESC);
+
+-- expires_at 部分索引（後台過期清理任務）
+--   - 查詢：WHERE expires_at < ? ORDER BY expires_at LIMIT ?（每分鐘一次）
+--   - 部分索引：只包含設置了過期時間的行，大部分永久鏈接不佔索引空間
+CREATE INDEX IF NOT EXISTS idx_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL;
+
+-- 墓碑到期索引（清理任務分批刪除到期墓碑）
+CREATE INDEX IF NOT EXISTS idx_tombstones_reserved_until ON url_tombstones(reserved_until);
+
+-- 過期鏈接歸檔表（ARCHIVE_EXPIRED=true 時使用）
+--
+-- 系統設計考量：
+--   - LIKE urls：複製字段定義，但不複製約束與索引
+--   - short_code 不唯一：短碼被回收後再次過期，可以歸檔多次
+--   - 冷數據：可定期導出到對象存儲後清空
+CREATE TABLE IF NOT EXISTS urls_archive (
+    LIKE urls,
+    archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- LIKE 只在建表時複製一次：之後 urls 新增的列要同步加到歸檔表
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS owner_id BIGINT;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS rules JSONB;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS password_hash VARCHAR(60);
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS max_clicks BIGINT;
+CREATE INDEX IF NOT EXISTS idx_archive_short_code ON urls_archive(domain, short_code);
+
+-- 點擊匯總表（小時粒度）
+--
+-- 系統設計考量：
+--   - 不存點擊明細：行數與點擊量無關，只與 (短碼 × 小時 × 維度組合) 有關
+--   - 主鍵即查詢索引：WHERE domain = ? AND short_code = ? AND hour BETWEEN ? AND ?
+--   - 寫入方式：異步管道批量 UPSERT（clicks = clicks + EXCLUDED.clicks）
+--   - 數據保留：可按 hour 分區（PARTITION BY RANGE），定期 DROP 舊分區
+CREATE TABLE IF NOT EXISTS click_rollups (
+    domain     VARCHAR(253) NOT NULL DEFAULT '', -- 自定義域名，默認域名為 ''
+    short_code VARCHAR(20) NOT NULL,
+    hour       TIMESTAMP NOT NULL,      -- 截斷到整點（UTC）
+    referrer   VARCHAR(255) NOT NULL,   -- 來源域名，直接訪問為 'direct'
+    country    VARCHAR(8) NOT NULL,     -- ISO 國家代碼，未知為 'unknown'
+    device     VARCHAR(16) NOT NULL,    -- desktop / mobile / tablet / bot / unknown
+    variant    VARCHAR(64) NOT NULL DEFAULT 'default', -- 路由規則 / A/B 變體
+    clicks     BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (domain, short_code, hour, referrer, country, device, variant)
+);
+
+-- 舊版本升級：補上 variant / domain 列，主鍵擴展為 7 列
+ALTER TABLE click_rollups ADD COLUMN IF NOT EXISTS variant VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE click_rollups ADD COLUMN IF NOT EXISTS domain VARCHAR(253) NOT NULL DEFAULT '';
+
+DO $$
+BEGIN
+    IF (SELECT array_length(conkey, 1) FROM pg_constraint WHERE conrelid = 'click_rollups'::regclass AND contype = 'p') <> 7 THEN
+        ALTER TABLE click_rollups DROP CONSTRAINT click_rollups_pkey,
+            ADD PRIMARY KEY (domain, short_code, hour, referrer, country, device, variant);
+    END IF;
+END $$;
 
--- expires_at 索引（優化定期清理任務）
--- 設計問題：是否需要？
---   - 場景：定期刪除過期記錄（WHERE expires_at < NOW()）
---   - 權衡：如果過期數據比例低，可能不值得建索引
---   - 決策：先不建，根據實際使用情況調整
--- CREATE INDEX idx_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL;
+COMMENT ON TABLE click_rollups IS '點擊分析小時匯總表';
 
 -- 分片準備（未來擴展）
 --
@@ -87,7 +258,7 @@ CREATE INDEX idx_created_at ON urls(created_at);
 --   當單表數據量達到億級時，需要分片（Sharding）
 --
 --   分片策略選項：
---     1. 按 short_code 哈希分片
+--     1. 按 (domain, short_code) 哈希分片
 --        - 優點：查詢均勻分布
 --        - 缺點：無法做範圍查詢
 --
@@ -100,7 +271,7 @@ CREATE INDEX idx_created_at ON urls(created_at);
 --        - 缺點：實現複雜
 --
 --   當前：單表設計
---   未來：選擇方案 1（按 short_code 哈希）
+--   未來：選擇方案 1（按 (domain, short_code) 哈希）
 
 -- 統計視圖（可選）
 --
@@ -117,16 +288,27 @@ CREATE INDEX idx_created_at ON urls(created_at);
 --
 -- 系統設計考量：
 --   - 最小權限原則
---   - 應用只需 SELECT, INSERT, UPDATE
---   - 不需要 DELETE, DROP（防止誤操作）
+--   - 應用需要 SELECT, INSERT, UPDATE, DELETE（刪除鏈接）
+--   - 不需要 DROP、TRUNCATE（防止誤操作）
 --
 -- 示例（需要根據實際用戶名調整）：
--- GRANT SELECT, INSERT, UPDATE ON urls TO app_user;
+-- GRANT SELECT, INSERT, UPDATE, DELETE ON urls TO app_user;
 
 COMMENT ON TABLE urls IS 'URL 短網址記錄表';
 COMMENT ON COLUMN urls.id IS 'Snowflake ID（分布式唯一）';
-COMMENT ON COLUMN urls.short_code IS '短碼（Base62 編碼）';
+COMMENT ON COLUMN urls.short_code IS '短碼（Base62 編碼，域名內唯一）';
+COMMENT ON COLUMN urls.domain IS '自定義域名（空字符串表示默認域名）';
 COMMENT ON COLUMN urls.long_url IS '原始完整 URL';
 COMMENT ON COLUMN urls.clicks IS '點擊統計（允許最終一致性）';
 COMMENT ON COLUMN urls.created_at IS '創建時間';
 COMMENT ON COLUMN urls.expires_at IS '過期時間（NULL 表示永不過期）';
+COMMENT ON COLUMN urls.owner_id IS '所屬用戶（NULL 表示匿名）';
+COMMENT ON COLUMN urls.disabled IS '停用標記（可逆下架）';
+COMMENT ON COLUMN urls.rules IS '條件路由規則（NULL 表示無規則）';
+COMMENT ON COLUMN urls.password_hash IS '訪問密碼的 bcrypt 哈希（NULL 表示公開）';
+COMMENT ON COLUMN urls.max_clicks IS '點擊上限（NULL 表示不限）';
+COMMENT ON TABLE url_tombstones IS '已刪除短碼的墓碑（冷卻期內不可重新註冊）';
+COMMENT ON TABLE urls_archive IS '後台清理任務歸檔的過期鏈接';
+COMMENT ON TABLE users IS 'API 用戶表';
+COMMENT ON TABLE domains IS '自定義域名（DNS TXT 驗證）';
+COMMENT ON COLUMN users.api_key_hash IS 'API Key 的 SHA-256 哈希（不存明文）';
@@ -7,15 +7,19 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/koopa0/system-design/04-rate-limiter/internal/decision"
 	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
 	"github.com/koopa0/system-design/04-rate-limiter/internal/middleware"
+	"github.com/koopa0/system-design/04-rate-limiter/internal/policy"
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -34,8 +38,28 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		log.Printf("警告：Redis 連線失敗，將使用單機限流器：%v", err)
+	redisErr := redisClient.Ping(ctx).Err()
+
+	// 設定了策略檔案時，限流規則完全由檔案決定
+	//
+	// 為何 Redis 連線失敗仍然傳入客戶端？
+	//   - 啟動時的失敗可能是暫時的（Redis 比服務晚啟動、網路抖動）
+	//   - redis 後端的規則由熔斷器與本地降級限流器接手，配額檢查失敗時放行，Redis 恢復後自動切回
+	//   - 傳入 nil 會讓 redis 後端與配額規則無法載入，服務直接退出
+	if path := getEnv("POLICY_FILE", ""); path != "" {
+		if redisErr != nil {
+			log.Printf("警告：Redis 連線失敗，redis 後端的規則先以本地限流器降級：%v", redisErr)
+		}
+		if getEnv("MODE", "") == "decision" {
+			startDecisionService(path, redisClient)
+			return
+		}
+		startWithPolicy(path, redisClient)
+		return
+	}
+
+	if redisErr != nil {
+		log.Printf("警告：Redis 連線失敗，將使用單機限流器：%v", redisErr)
 		startWithLocalLimiter()
 		return
 	}
@@ -44,92 +68,223 @@ func main() {
 	startWithDistributedLimiter(redisClient)
 }
 
+// startWithPolicy 依策略檔案啟動服務
+//
+// 檔案每 5 秒檢查一次，變更時原子替換；解析失敗保留舊策略
+func startWithPolicy(path string, redisClient *redis.Client) {
+	engine, err := policy.NewEngine(path, redisClient)
+	if err != nil {
+		log.Fatalf("載入限流策略失敗：%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx, 5*time.Second)
+	go engine.Heartbeat(ctx, 5*time.Second)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", handleAPI)
+	if usage := engine.UsageHandler(); usage != nil {
+		mux.Handle("GET /v1/usage", usage)
+	}
+
+	// 監控接口不經過限流（抓取失敗會被誤判為服務異常）
+	root := http.NewServeMux()
+	root.Handle("GET /metrics", engine.MetricsHandler())
+	handleOffenders(root, engine)
+	root.Handle("/", engine.Middleware(mux))
+	startServer(root)
+}
+
+// handleOffenders 註冊 GET /v1/offenders（需要 ADMIN_TOKEN）
+//
+// 被拒絕者的 key 含有 IP、使用者 ID 等個人資料：未設定 ADMIN_TOKEN 時不提供此接口
+func handleOffenders(mux *http.ServeMux, engine *policy.Engine) {
+	token := getEnv("ADMIN_TOKEN", "")
+	if token == "" {
+		log.Println("未設定 ADMIN_TOKEN，停用 /v1/offenders")
+		return
+	}
+	mux.Handle("GET /v1/offenders", middleware.RequireToken(token)(engine.OffendersHandler()))
+}
+
+// startDecisionService 以決策服務模式啟動（MODE=decision）
+//
+// 不代理任何 API，只回答「這次請求是否超限」：
+//   - HTTP：POST /v1/check（PORT，預設 8080），監控接口 GET /metrics、GET /v1/offenders（需要 ADMIN_TOKEN）
+//   - gRPC：Envoy 限流協定（GRPC_PORT，預設 8081）
+//
+// 規則來自策略檔案中設定 match.domain 的規則
+func startDecisionService(path string, redisClient *redis.Client) {
+	engine, err := policy.NewEngine(path, redisClient)
+	if err != nil {
+		log.Fatalf("載入限流策略失敗：%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx, 5*time.Second)
+	go engine.Heartbeat(ctx, 5*time.Second)
+
+	service := decision.NewService(engine)
+
+	grpcPort := getEnv("GRPC_PORT", "8081")
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.Fatalf("gRPC 監聽失敗：%v", err)
+	}
+	grpcServer := grpc.NewServer()
+	service.RegisterGRPC(grpcServer)
+	go func() {
+		log.Printf("gRPC 決策服務啟動於 :%s", grpcPort)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Printf("gRPC 服務錯誤：%v", err)
+		}
+	}()
+	// HTTP 服務關閉後，等處理中的 gRPC 呼叫完成再結束
+	defer grpcServer.GracefulStop()
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/check", service.HTTPHandler())
+	mux.Handle("GET /metrics", engine.MetricsHandler())
+	handleOffenders(mux, engine)
+	startServer(mux)
+}
+
 // startWithLocalLimiter 使用本地限流器啟動服務
+//
+// 單機限流器實作相同的 limiter.Limiter 介面，與分散式版本共用中介軟體
+// 透過 limiter.Keyed 為每個客戶端 IP 各建立一個限流器
 func startWithLocalLimiter() {
 	mux := http.NewServeMux()
 
 	// 範例 1：Token Bucket 限流
-	tokenBucketLimiter := limiter.NewTokenBucket(10, 2) // 容量10，每秒2個
-	mux.Handle("/api/token-bucket", tokenBucketMiddleware(tokenBucketLimiter)(
+	tokenBucketLimiter := limiter.NewKeyed(func() *limiter.TokenBucket {
+		return limiter.NewTokenBucket(10, 2) // 容量10，每秒2個
+	}, limiter.KeyedConfig{})
+	mux.Handle("/api/token-bucket", localRateLimit(tokenBucketLimiter)(
 		http.HandlerFunc(handleAPI),
 	))
 
 	// 範例 2：Leaky Bucket 限流
-	leakyBucketLimiter := limiter.NewLeakyBucket(10, 2) // 容量10，每秒2個
-	mux.Handle("/api/leaky-bucket", leakyBucketMiddleware(leakyBucketLimiter)(
+	leakyBucketLimiter := limiter.NewKeyed(func() *limiter.LeakyBucket {
+		return limiter.NewLeakyBucket(10, 2) // 容量10，每秒2個
+	}, limiter.KeyedConfig{})
+	mux.Handle("/api/leaky-bucket", localRateLimit(leakyBucketLimiter)(
 		http.HandlerFunc(handleAPI),
 	))
 
 	// 範例 3：Sliding Window 限流
-	slidingWindowLimiter := limiter.NewSlidingWindow(10, time.Minute) // 1分鐘10個
-	mux.Handle("/api/sliding-window", slidingWindowMiddleware(slidingWindowLimiter)(
+	slidingWindowLimiter := limiter.NewKeyed(func() *limiter.SlidingWindow {
+		return limiter.NewSlidingWindow(10, time.Minute) // 1分鐘10個
+	}, limiter.KeyedConfig{})
+	mux.Handle("/api/sliding-window", localRateLimit(slidingWindowLimiter)(
 		http.HandlerFunc(handleAPI),
 	))
 
 	// 範例 4：Sliding Window Counter 限流
-	swcLimiter := limiter.NewSlidingWindowCounter(100, time.Minute, 60) // 1分鐘100個，60個桶
-	mux.Handle("/api/sliding-window-counter", slidingWindowCounterMiddleware(swcLimiter)(
+	swcLimiter := limiter.NewKeyed(func() *limiter.SlidingWindowCounter {
+		return limiter.NewSlidingWindowCounter(100, time.Minute, 60) // 1分鐘100個，60個桶
+	}, limiter.KeyedConfig{})
+	mux.Handle("/api/sliding-window-counter", localRateLimit(swcLimiter)(
 		http.HandlerFunc(handleAPI),
 	))
 
+	// 範例 5：並發限制（每個 IP 最多 2 個處理中，另有 5 個排隊，最多等 1 秒）
+	perIP := limiter.NewConcurrency(limiter.ConcurrencyConfig{
+		Limit:        limiter.FixedLimit(2),
+		MaxQueue:     5,
+		QueueTimeout: time.Second,
+	})
+	mux.Handle("/api/concurrency", middleware.ConcurrencyLimit(middleware.ConcurrencyConfig{
+		Limiter: perIP,
+		KeyFunc: func(r *http.Request) string { return "ip:" + middleware.ClientIP(r) },
+	})(http.HandlerFunc(handleSlowAPI)))
+
+	// 範例 6：自適應並發限制（全服務共用，依延遲梯度調整上限）
+	adaptive := limiter.NewConcurrency(limiter.ConcurrencyConfig{
+		Limit:        limiter.NewGradient(limiter.GradientConfig{AdaptiveConfig: limiter.AdaptiveConfig{Initial: 10, Max: 100}}),
+		MaxQueue:     20,
+		QueueTimeout: 500 * time.Millisecond,
+	})
+	mux.Handle("/api/adaptive", middleware.ConcurrencyLimit(middleware.ConcurrencyConfig{
+		Limiter: adaptive,
+	})(http.HandlerFunc(handleSlowAPI)))
+
 	startServer(mux)
 }
 
 // startWithDistributedLimiter 使用分散式限流器啟動服務
+//
+// 所有限流器共用一個熔斷器：Redis 連續失敗後不再呼叫，
+// 背景探測恢復前依各範例的 FailureMode 放行、拒絕或改用本地限流
 func startWithDistributedLimiter(redisClient *redis.Client) {
 	mux := http.NewServeMux()
 
+	breaker := limiter.NewCircuitBreaker(limiter.RedisProbe(redisClient), limiter.BreakerConfig{})
+	nodes := limiter.NewNodeEstimator(redisClient, "ratelimit:nodes", 1)
+	go nodes.Run(context.Background(), 5*time.Second)
+
 	// 建立不同維度的限流器
-	ipLimiter := limiter.NewDistributedTokenBucket(redisClient, 100, 100)       // IP: 100 req/s
-	userLimiter := limiter.NewDistributedTokenBucket(redisClient, 50, 50)       // User: 50 req/s
-	apiLimiter := limiter.NewDistributedTokenBucket(redisClient, 1000, 1000)    // API: 1000 req/s
-	globalLimiter := limiter.NewDistributedTokenBucket(redisClient, 5000, 5000) // Global: 5000 req/s
+	//
+	// IP 限流降級為本地令牌桶，全域配額按節點數平分
+	ipLimiter := limiter.NewResilient(
+		limiter.NewDistributedTokenBucket(redisClient, 100, 100), // IP: 100 req/s
+		breaker, limiter.FailLocal,
+		limiter.NewKeyed(func() *limiter.TokenBucket {
+			n := nodes.Count()
+			return limiter.NewTokenBucket(limiter.Share(100, n), limiter.Share(100, n))
+		}, limiter.KeyedConfig{}),
+	)
+	globalLimiter := limiter.NewResilient(
+		limiter.NewDistributedTokenBucket(redisClient, 5000, 5000), // Global: 5000 req/s
+		breaker, limiter.FailOpen, nil,
+	)
 
 	// 範例 1：單一維度限流（IP）
 	ipRateLimit := middleware.RateLimit(middleware.RateLimitConfig{
 		KeyFunc: func(r *http.Request) string {
-			return "ip:" + r.RemoteAddr
+			return "ip:" + middleware.ClientIP(r)
 		},
-		Limiter: ipLimiter.Allow,
+		Limiter: ipLimiter.AllowN,
 	})
 	mux.Handle("/api/ip-limited", ipRateLimit(http.HandlerFunc(handleAPI)))
 
 	// 範例 2：多維度限流（IP + User + API）
-	multiDimRateLimit := middleware.MultiDimensionRateLimit(middleware.MultiDimensionConfig{
-		Dimensions: []middleware.DimensionConfig{
-			{
-				Name: "ip",
-				KeyFunc: func(r *http.Request) string {
-					return "ip:" + r.RemoteAddr
-				},
-				Limiter: ipLimiter.Allow,
-			},
-			{
-				Name: "user",
-				KeyFunc: func(r *http.Request) string {
-					// 實際應從認證 token 提取
-					return "user:" + r.Header.Get("X-User-ID")
-				},
-				Limiter: userLimiter.Allow,
+	//
+	// 單一 Lua 腳本原子檢查所有維度：被任一維度拒絕的請求不消耗其他維度的配額
+	multiDimLimiter := limiter.NewDistributedMultiDimension(redisClient, "multi",
+		limiter.Dimension{Name: "ip", Capacity: 100, RefillRate: 100},
+		limiter.Dimension{Name: "user", Capacity: 50, RefillRate: 50},
+		limiter.Dimension{Name: "api", Capacity: 1000, RefillRate: 1000},
+	)
+	multiDimRateLimit := middleware.AtomicMultiDimensionRateLimit(middleware.AtomicMultiDimensionConfig{
+		Limiter: limiter.NewResilientMultiDimension(multiDimLimiter, breaker, limiter.FailOpen, nil, nil),
+		KeyFuncs: map[string]func(r *http.Request) string{
+			"ip": middleware.ClientIP,
+			"user": func(r *http.Request) string {
+				// 實際應從認證 token 提取
+				return r.Header.Get("X-User-ID")
 			},
-			{
-				Name: "api",
-				KeyFunc: func(r *http.Request) string {
-					return "api:" + r.URL.Path
-				},
-				Limiter: apiLimiter.Allow,
+			"api": func(r *http.Request) string {
+				return r.URL.Path
 			},
 		},
 	})
 	mux.Handle("/api/multi-dimension", multiDimRateLimit(http.HandlerFunc(handleAPI)))
 
 	// 範例 3：滑動視窗限流
-	swLimiter := limiter.NewDistributedSlidingWindow(redisClient, 100, time.Minute)
+	//
+	// 模擬敏感接口：Redis 故障時寧可拒絕（Fail-Closed）
+	swLimiter := limiter.NewResilient(
+		limiter.NewDistributedSlidingWindow(redisClient, 100, time.Minute),
+		breaker, limiter.FailClosed, nil,
+	)
 	swRateLimit := middleware.RateLimit(middleware.RateLimitConfig{
 		KeyFunc: func(r *http.Request) string {
-			return "sw:" + r.RemoteAddr
+			return "sw:" + middleware.ClientIP(r)
 		},
-		Limiter: middleware.SlidingWindowRateLimitAdapter(swLimiter),
+		Limiter: swLimiter.AllowN,
 	})
 	mux.Handle("/api/sliding-window", swRateLimit(http.HandlerFunc(handleAPI)))
 
@@ -138,10 +293,38 @@ func startWithDistributedLimiter(redisClient *redis.Client) {
 		KeyFunc: func(r *http.Request) string {
 			return "global"
 		},
-		Limiter: globalLimiter.Allow,
+		Limiter: globalLimiter.AllowN,
 	})
 	mux.Handle("/api/global-limited", globalRateLimit(http.HandlerFunc(handleAPI)))
 
+	// 範例 5：加權成本與長週期配額
+	//
+	// 搜尋消耗 10 單位、讀取 1 單位，共用同一個 IP 令牌桶
+	// 帶 X-API-Key 的請求另外扣除每日 / 每月配額，GET /v1/usage 查詢用量
+	cost := middleware.RouteCost(map[string]int64{
+		"/api/search": 10,
+		"/api/read":   1,
+	}, 1)
+	weightedRateLimit := middleware.RateLimit(middleware.RateLimitConfig{
+		KeyFunc: func(r *http.Request) string {
+			return "weighted:" + middleware.ClientIP(r)
+		},
+		Limiter: ipLimiter.AllowN,
+		Cost:    cost,
+	})
+	quota := limiter.NewQuota(redisClient)
+	apiKey := func(r *http.Request) string { return r.Header.Get("X-API-Key") }
+	quotaLimit := middleware.QuotaLimit(middleware.QuotaConfig{
+		Quota:   quota,
+		KeyFunc: apiKey,
+		Limits:  limiter.QuotaLimits{Daily: 1000, Monthly: 20000},
+		Cost:    cost,
+	})
+	weighted := weightedRateLimit(quotaLimit(http.HandlerFunc(handleAPI)))
+	mux.Handle("/api/search", weighted)
+	mux.Handle("/api/read", weighted)
+	mux.Handle("GET /v1/usage", middleware.UsageHandler(quota, apiKey))
+
 	startServer(mux)
 }
 
@@ -154,6 +337,18 @@ func handleAPI(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// handleSlowAPI 模擬較慢的後端（處理時間 200ms）
+//
+// 同時打入的請求越多，排隊與被拒絕的請求越多，可觀察並發限制的效果
+func handleSlowAPI(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-time.After(200 * time.Millisecond):
+	case <-r.Context().Done():
+		return
+	}
+	handleAPI(w, r)
+}
+
 // startServer 啟動 HTTP 服務
 func startServer(handler http.Handler) {
 	port := getEnv("PORT", "8080")
@@ -186,53 +381,14 @@ func startServer(handler http.Handler) {
 	}
 }
 
-// 本地限流器的中介軟體適配器
-func tokenBucketMiddleware(tb *limiter.TokenBucket) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !tb.Allow() {
-				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-func leakyBucketMiddleware(lb *limiter.LeakyBucket) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !lb.Allow() {
-				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-func slidingWindowMiddleware(sw *limiter.SlidingWindow) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !sw.Allow() {
-				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-func slidingWindowCounterMiddleware(swc *limiter.SlidingWindowCounter) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !swc.Allow() {
-				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
+// localRateLimit 單機限流器的中介軟體（按客戶端 IP 限流）
+func localRateLimit(l limiter.Limiter) func(http.Handler) http.Handler {
+	return middleware.RateLimit(middleware.RateLimitConfig{
+		KeyFunc: func(r *http.Request) string {
+			return "ip:" + middleware.ClientIP(r)
+		},
+		Limiter: l.AllowN,
+	})
 }
 
 func getEnv(key, defaultValue string) string {
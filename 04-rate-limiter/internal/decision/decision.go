@@ -0,0 +1,210 @@
+// Package decision 提供限流決策服務。
+//
+// 問題：其他語言撰寫的服務也需要相同的限流規則，但無法嵌入這個 Go 套件。
+//
+// 解決（與 Envoy ratelimit 服務相同的模式）：
+//
+//	呼叫方在處理請求前詢問「這次請求是否超限」：
+//	  - domain：呼叫方的服務名稱（不同服務的規則互不影響）
+//	  - descriptors：描述這次請求的 key / value（如 customer_id=c1）
+//	  - hits：本次消耗的單位數
+//	服務端依策略檔案中的 domain 規則判定，返回結果與應轉發給客戶端的標頭
+//
+// 介面：
+//   - HTTP：POST /v1/check（JSON）
+//   - gRPC：envoy.service.ratelimit.v3.RateLimitService/ShouldRateLimit
+//     與 Envoy 的協定相同，可直接作為 Envoy 限流過濾器的後端
+//
+// 設計考量：
+//   - 限流狀態在 Redis：決策服務本身無狀態，可水平擴展
+//   - 服務不可用時由呼叫方決定放行或拒絕（Envoy 的 failure_mode_deny）
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+	"github.com/koopa0/system-design/04-rate-limiter/internal/middleware"
+	"github.com/koopa0/system-design/04-rate-limiter/internal/policy"
+)
+
+// 判定結果代碼（與 Envoy 的 RateLimitResponse.Code 相同）
+const (
+	CodeOK        = "OK"
+	CodeOverLimit = "OVER_LIMIT"
+)
+
+// CheckRequest POST /v1/check 的請求。
+//
+// 範例：
+//
+//	{"domain":"orders","descriptors":[{"entries":[{"key":"customer_id","value":"c1"}]}],"hits":1}
+type CheckRequest struct {
+	Domain      string              `json:"domain"`
+	Descriptors []policy.Descriptor `json:"descriptors"`
+	Hits        int64               `json:"hits"` // 0 表示 1
+}
+
+// CheckResponse POST /v1/check 的回應。
+//
+// Headers 為呼叫方應轉發給其客戶端的標頭（RateLimit-*、Retry-After），
+// 格式與本服務的 HTTP 中介軟體相同
+type CheckResponse struct {
+	Code     string            `json:"code"`
+	Statuses []Status          `json:"statuses"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// Status 一個描述符的判定結果（順序與請求中的描述符相同）。
+type Status struct {
+	Code         string `json:"code"`
+	Rule         string `json:"rule,omitempty"` // 空字串表示沒有規則匹配，不限流
+	Limit        int64  `json:"limit,omitempty"`
+	Remaining    int64  `json:"remaining"`
+	ResetAfterMs int64  `json:"reset_after_ms"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+// Service 限流決策服務。
+type Service struct {
+	engine *policy.Engine
+}
+
+// NewService 建立決策服務（規則來自策略引擎中 match.domain 的規則）。
+func NewService(engine *policy.Engine) *Service {
+	return &Service{engine: engine}
+}
+
+// result 一次判定的彙總（HTTP 與 gRPC 共用）。
+type result struct {
+	overLimit bool
+	statuses  []policy.DescriptorResult
+	headers   http.Header
+}
+
+// check 判定所有描述符，並彙總出應轉發的標頭。
+//
+// 標頭的選擇與多維度中介軟體相同：
+//   - 有描述符超限：取重試時間最長的（客戶端要等所有超限的配額都恢復）
+//   - 全部允許：取剩餘配額最少的（客戶端依此降速）
+func (s *Service) check(ctx context.Context, domain string, descriptors []policy.Descriptor, hits int64) result {
+	// 與中介軟體相同的逾時：Redis 呼叫過久時由熔斷器決定放行或拒絕
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	res := result{
+		statuses: s.engine.Check(ctx, domain, descriptors, hits),
+		headers:  make(http.Header),
+	}
+
+	var summary limiter.Decision
+	found := false
+	for _, st := range res.statuses {
+		d := st.Decision
+		switch {
+		case !d.Allowed:
+			if !res.overLimit || d.RetryAfter > summary.RetryAfter {
+				summary = d
+			}
+			res.overLimit = true
+			found = true
+		case res.overLimit || d.Limit == 0:
+		case !found || d.Remaining < summary.Remaining:
+			summary = d
+			found = true
+		}
+	}
+	if found {
+		middleware.SetRateLimitHeaders(res.headers, summary)
+	}
+	return res
+}
+
+// validate 驗證請求（HTTP 與 gRPC 共用）。
+func validate(domain string, descriptors []policy.Descriptor, hits int64) error {
+	if domain == "" {
+		return errors.New("domain is required")
+	}
+	if len(descriptors) == 0 {
+		return errors.New("at least one descriptor is required")
+	}
+	if hits < 0 {
+		return errors.New("hits must not be negative")
+	}
+	for i, d := range descriptors {
+		if len(d.Entries) == 0 {
+			return fmt.Errorf("descriptors[%d]: entries are required", i)
+		}
+		if d.Hits < 0 {
+			return fmt.Errorf("descriptors[%d]: hits must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// HTTPHandler POST /v1/check 的處理器。
+//
+// 回應狀態碼（與 Envoy ratelimit 的 /json 接口相同）：
+//   - 200：全部描述符都允許
+//   - 429：至少一個描述符超限
+//   - 400：請求格式錯誤
+func (s *Service) HTTPHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req CheckRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&req)
+		if err == nil {
+			err = validate(req.Domain, req.Descriptors, req.Hits)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		res := s.check(r.Context(), req.Domain, req.Descriptors, req.Hits)
+
+		resp := CheckResponse{Code: CodeOK, Statuses: make([]Status, len(res.statuses))}
+		for i, st := range res.statuses {
+			resp.Statuses[i] = toStatus(st)
+		}
+		if len(res.headers) > 0 {
+			resp.Headers = make(map[string]string, len(res.headers))
+			for name := range res.headers {
+				resp.Headers[name] = res.headers.Get(name)
+			}
+		}
+
+		if res.overLimit {
+			resp.Code = CodeOverLimit
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func toStatus(st policy.DescriptorResult) Status {
+	d := st.Decision
+	s := Status{
+		Code:         CodeOK,
+		Limit:        d.Limit,
+		Remaining:    d.Remaining,
+		ResetAfterMs: d.ResetAfter.Milliseconds(),
+		RetryAfterMs: d.RetryAfter.Milliseconds(),
+	}
+	if !d.Allowed {
+		s.Code = CodeOverLimit
+	}
+	if st.Rule != nil {
+		s.Rule = st.Rule.Name
+	}
+	return s
+}
@@ -0,0 +1,174 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/koopa0/system-design/04-rate-limiter/internal/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testPolicy = `
+policies:
+  - name: per-customer
+    match: {domain: orders, descriptors: {customer_id: "*"}}
+    algorithm: token_bucket
+    capacity: 5
+    rate: 1
+  - name: per-region
+    match: {domain: orders, descriptors: {region: "*"}}
+    algorithm: token_bucket
+    capacity: 2
+    rate: 1
+`
+
+func newService(t *testing.T) *Service {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(testPolicy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := policy.NewEngine(path, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+	return NewService(engine)
+}
+
+// post 送出 POST /v1/check，返回狀態碼與解碼後的回應。
+func post(t *testing.T, s *Service, body string) (int, CheckResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.HTTPHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/check", strings.NewReader(body)))
+	var resp CheckResponse
+	if rec.Code != http.StatusBadRequest {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+// header 以不分大小寫的名稱查詢回應中的標頭（與 http.Header 相同，回應使用正規化名稱）。
+func header(resp CheckResponse, name string) string {
+	return resp.Headers[http.CanonicalHeaderKey(name)]
+}
+
+func TestHTTPHandler(t *testing.T) {
+	s := newService(t)
+	const both = `{"domain":"orders","descriptors":[` +
+		`{"entries":[{"key":"customer_id","value":"c1"}]},` +
+		`{"entries":[{"key":"region","value":"eu"}]},` +
+		`{"entries":[{"key":"unknown","value":"x"}]}]}`
+
+	// 全部允許：標頭取剩餘配額最少的描述符（region 剩 1），沒有規則的描述符不參與
+	code, resp := post(t, s, both)
+	if code != http.StatusOK || resp.Code != CodeOK || len(resp.Statuses) != 3 {
+		t.Fatalf("first check = %d %+v, want 200 OK with 3 statuses", code, resp)
+	}
+	if st := resp.Statuses[0]; st.Rule != "per-customer" || st.Limit != 5 || st.Remaining != 4 {
+		t.Errorf("customer status = %+v, want per-customer with 4 remaining", st)
+	}
+	if st := resp.Statuses[2]; st.Code != CodeOK || st.Rule != "" || st.Limit != 0 {
+		t.Errorf("unmatched status = %+v, want OK without a rule", st)
+	}
+	if header(resp, "RateLimit-Limit") != "2" || header(resp, "RateLimit-Remaining") != "1" {
+		t.Errorf("headers = %v, want the tightest descriptor (region)", resp.Headers)
+	}
+
+	// region 超限：整體 OVER_LIMIT，customer 仍被扣除（描述符各自獨立）
+	post(t, s, both)
+	code, resp = post(t, s, both)
+	if code != http.StatusTooManyRequests || resp.Code != CodeOverLimit {
+		t.Fatalf("third check = %d %s, want 429 OVER_LIMIT", code, resp.Code)
+	}
+	if resp.Statuses[0].Code != CodeOK || resp.Statuses[0].Remaining != 2 {
+		t.Errorf("customer status = %+v, want OK with 2 remaining", resp.Statuses[0])
+	}
+	if st := resp.Statuses[1]; st.Code != CodeOverLimit || st.RetryAfterMs <= 0 {
+		t.Errorf("region status = %+v, want OVER_LIMIT with a retry time", st)
+	}
+	if header(resp, "Retry-After") == "" || header(resp, "RateLimit-Limit") != "2" {
+		t.Errorf("headers = %v, want the over-limit descriptor's Retry-After", resp.Headers)
+	}
+}
+
+func TestHTTPHandlerHits(t *testing.T) {
+	s := newService(t)
+	_, resp := post(t, s, `{"domain":"orders","hits":2,"descriptors":[`+
+		`{"entries":[{"key":"customer_id","value":"c1"}]},`+
+		`{"entries":[{"key":"customer_id","value":"c2"}],"hits":4}]}`)
+	if resp.Statuses[0].Remaining != 3 || resp.Statuses[1].Remaining != 1 {
+		t.Errorf("remaining = %d, %d, want 3 (request hits) and 1 (descriptor hits)",
+			resp.Statuses[0].Remaining, resp.Statuses[1].Remaining)
+	}
+}
+
+func TestHTTPHandlerInvalid(t *testing.T) {
+	s := newService(t)
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", `{"domain":`},
+		{"unknown field", `{"domain":"orders","descriptor":[]}`},
+		{"missing domain", `{"descriptors":[{"entries":[{"key":"a","value":"b"}]}]}`},
+		{"no descriptors", `{"domain":"orders"}`},
+		{"empty entries", `{"domain":"orders","descriptors":[{"entries":[]}]}`},
+		{"negative hits", `{"domain":"orders","hits":-1,"descriptors":[{"entries":[{"key":"a","value":"b"}]}]}`},
+		{"negative descriptor hits", `{"domain":"orders","descriptors":[{"entries":[{"key":"a","value":"b"}],"hits":-1}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := post(t, s, tt.body); code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", code)
+			}
+		})
+	}
+}
+
+func TestShouldRateLimit(t *testing.T) {
+	g := &rlsServer{service: newService(t)}
+	req := &rlsv3.RateLimitRequest{
+		Domain: "orders",
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{{
+			Entries: []*ratelimitv3.RateLimitDescriptor_Entry{{Key: "region", Value: "eu"}},
+		}},
+		HitsAddend: 2,
+	}
+
+	resp, err := g.ShouldRateLimit(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ShouldRateLimit() error: %v", err)
+	}
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OK {
+		t.Fatalf("OverallCode = %v, want OK", resp.GetOverallCode())
+	}
+	st := resp.GetStatuses()[0]
+	if st.GetCurrentLimit().GetName() != "per-region" || st.GetCurrentLimit().GetRequestsPerUnit() != 1 ||
+		st.GetCurrentLimit().GetUnit() != rlsv3.RateLimitResponse_RateLimit_SECOND || st.GetLimitRemaining() != 0 {
+		t.Errorf("status = %v, want per-region 1/SECOND with 0 remaining", st)
+	}
+	if len(resp.GetResponseHeadersToAdd()) == 0 {
+		t.Error("no response headers to add")
+	}
+
+	resp, err = g.ShouldRateLimit(context.Background(), req)
+	if err != nil || resp.GetOverallCode() != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Errorf("second call = %v, %v, want OVER_LIMIT", resp.GetOverallCode(), err)
+	}
+
+	_, err = g.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{Domain: "orders"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("empty descriptors error = %v, want InvalidArgument", err)
+	}
+}
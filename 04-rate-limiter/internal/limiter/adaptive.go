@@ -0,0 +1,226 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AdaptiveConfig 自適應並發上限的設定。
+type AdaptiveConfig struct {
+	// Initial 初始上限（預設 20）
+	Initial int
+
+	// Min / Max 上限的調整範圍（預設 1 / 1000）
+	Min int
+	Max int
+}
+
+func (c AdaptiveConfig) withDefaults() AdaptiveConfig {
+	if c.Initial <= 0 {
+		c.Initial = 20
+	}
+	if c.Min <= 0 {
+		c.Min = 1
+	}
+	if c.Max <= 0 {
+		c.Max = 1000
+	}
+	if c.Initial < c.Min {
+		c.Initial = c.Min
+	}
+	if c.Initial > c.Max {
+		c.Initial = c.Max
+	}
+	return c
+}
+
+// AIMD 加法增、乘法減（Additive Increase Multiplicative Decrease）的並發上限。
+//
+// 演算法原理（與 TCP 壅塞控制相同）：
+//
+//	成功：limit += 1 / limit（每處理完約一整輪請求，上限加 1）
+//	失敗：limit *= Backoff（如 0.9，立即退讓）
+//
+//	「失敗」包括請求失敗（dropped）與延遲超過 Timeout
+//
+// 為何加法增、乘法減？
+//   - 過載的代價（逾時、崩潰）遠大於少用一點容量，所以退得快、進得慢
+//   - 多個客戶端共用後端時，AIMD 會收斂到公平分配
+//
+// 優點：
+//   - 簡單，只需要一個延遲門檻
+//
+// 缺點：
+//   - 需要事先知道「多慢算太慢」（Timeout）
+//   - 只在過載發生後才退讓，上限會在臨界點附近來回鋸齒
+type AIMD struct {
+	min, max float64
+	backoff  float64
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	limit float64
+}
+
+// AIMDConfig AIMD 的設定。
+type AIMDConfig struct {
+	AdaptiveConfig
+
+	// Backoff 失敗時的乘數（預設 0.9）
+	Backoff float64
+
+	// Timeout 延遲超過此值視為失敗（0 表示只看 dropped）
+	Timeout time.Duration
+}
+
+// NewAIMD 建立 AIMD 並發上限。
+//
+// 範例：
+//
+//	// 初始 20，超過 500ms 視為過載
+//	limit := NewAIMD(AIMDConfig{AdaptiveConfig: AdaptiveConfig{Initial: 20}, Timeout: 500 * time.Millisecond})
+func NewAIMD(cfg AIMDConfig) *AIMD {
+	cfg.AdaptiveConfig = cfg.AdaptiveConfig.withDefaults()
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.9
+	}
+	return &AIMD{
+		min:     float64(cfg.Min),
+		max:     float64(cfg.Max),
+		backoff: cfg.Backoff,
+		timeout: cfg.Timeout,
+		limit:   float64(cfg.Initial),
+	}
+}
+
+// Limit 返回當前上限。
+func (a *AIMD) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.limit)
+}
+
+// Observe 依請求結果調整上限。
+func (a *AIMD) Observe(rtt time.Duration, inflight int, dropped bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if dropped || (a.timeout > 0 && rtt > a.timeout) {
+		a.limit = math.Max(a.min, a.limit*a.backoff)
+		return
+	}
+	// 處理中遠低於上限時，成功不代表更高的上限也撐得住（不增加，避免上限無限膨脹）
+	if float64(inflight)*2 >= a.limit {
+		a.limit = math.Min(a.max, a.limit+1/a.limit)
+	}
+}
+
+// Gradient 依延遲梯度調整的並發上限（Vegas / Netflix gradient 風格）。
+//
+// 演算法原理：
+//
+//	排隊理論：未過載時延遲穩定；接近飽和時請求開始在後端排隊，延遲上升
+//	→ 延遲上升就是「即將過載」的訊號，不需要等到逾時或失敗
+//
+//	longRTT：長期延遲的指數移動平均（基準）
+//	gradient = clamp(Tolerance × longRTT / rtt, 0.5, 1.0)
+//	  - 延遲沒有超過基準的 Tolerance 倍 → gradient = 1，不減少
+//	  - 延遲變成基準的 2 倍（Tolerance 1） → gradient = 0.5，上限減半
+//	newLimit = limit × gradient + √limit（√limit 是允許的排隊量，讓上限能持續往上探）
+//	limit = limit × (1 - Smoothing) + newLimit × Smoothing
+//
+// 優點：
+//   - 不需要設定延遲門檻，基準從觀察中學習
+//   - 在延遲開始上升時就退讓，比 AIMD 更早、更平滑
+//
+// 缺點：
+//   - 後端延遲本身波動大時（如依請求內容差異很大），梯度訊號雜訊多
+//   - 長期持續變慢會被學進基準（longRTT 跟著上升），只能偵測「相對」變慢
+type Gradient struct {
+	min, max  float64
+	tolerance float64
+	smoothing float64
+	alpha     float64 // longRTT 的 EWMA 權重
+
+	mu      sync.Mutex
+	limit   float64
+	longRTT float64 // 奈秒
+}
+
+// GradientConfig Gradient 的設定。
+type GradientConfig struct {
+	AdaptiveConfig
+
+	// Tolerance 延遲超過基準多少倍才開始減少上限（預設 1.5）
+	Tolerance float64
+
+	// Smoothing 每次調整的幅度（預設 0.2）
+	Smoothing float64
+
+	// Window 長期基準的樣本數（預設 600，約為最近 600 個請求的平均）
+	Window int
+}
+
+// NewGradient 建立延遲梯度並發上限。
+//
+// 範例：
+//
+//	limit := NewGradient(GradientConfig{AdaptiveConfig: AdaptiveConfig{Initial: 20, Max: 200}})
+func NewGradient(cfg GradientConfig) *Gradient {
+	cfg.AdaptiveConfig = cfg.AdaptiveConfig.withDefaults()
+	if cfg.Tolerance < 1 {
+		cfg.Tolerance = 1.5
+	}
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 0.2
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 600
+	}
+	return &Gradient{
+		min:       float64(cfg.Min),
+		max:       float64(cfg.Max),
+		tolerance: cfg.Tolerance,
+		smoothing: cfg.Smoothing,
+		alpha:     2 / float64(cfg.Window+1),
+		limit:     float64(cfg.Initial),
+	}
+}
+
+// Limit 返回當前上限。
+func (g *Gradient) Limit() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return int(g.limit)
+}
+
+// Observe 依請求延遲調整上限。
+func (g *Gradient) Observe(rtt time.Duration, inflight int, dropped bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	short := float64(max(rtt, time.Microsecond))
+	if g.longRTT == 0 {
+		g.longRTT = short
+	} else {
+		g.longRTT += (short - g.longRTT) * g.alpha
+	}
+
+	// 延遲已經恢復（遠低於基準）：讓基準快速回落，否則下次變慢時要很久才偵測得到
+	if g.longRTT/short > 2 {
+		g.longRTT *= 0.95
+	}
+
+	// 處理中遠低於上限時，延遲資訊說明不了上限是否合適
+	if !dropped && float64(inflight)*2 < g.limit {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, g.tolerance*g.longRTT/short))
+	if dropped {
+		gradient = 0.5
+	}
+	newLimit := g.limit*gradient + math.Sqrt(g.limit)
+	g.limit = math.Max(g.min, math.Min(g.max, g.limit*(1-g.smoothing)+newLimit*g.smoothing))
+}
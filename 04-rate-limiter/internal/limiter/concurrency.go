@@ -0,0 +1,216 @@
+package limiter
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrConcurrencyLimit 處理中的請求已達上限，且佇列已滿（或未設定佇列）
+	ErrConcurrencyLimit = errors.New("concurrency limit exceeded")
+
+	// ErrQueueTimeout 在佇列中等待超過 QueueTimeout
+	ErrQueueTimeout = errors.New("concurrency queue timeout")
+)
+
+// ConcurrencyLimit 決定同時處理中的請求上限。
+//
+// 固定上限用 FixedLimit；依延遲自動調整用 AIMD 或 Gradient
+type ConcurrencyLimit interface {
+	// Limit 當前的上限
+	Limit() int
+
+	// Observe 回報一個請求的結果
+	//   - rtt: 處理耗時（不含排隊時間）
+	//   - inflight: 請求開始時處理中的數量（含自己）
+	//   - dropped: 請求是否因過載失敗（逾時、5xx）
+	Observe(rtt time.Duration, inflight int, dropped bool)
+}
+
+// FixedLimit 固定的並發上限。
+type FixedLimit int
+
+// Limit 返回固定上限。
+func (f FixedLimit) Limit() int { return int(f) }
+
+// Observe 固定上限不依結果調整。
+func (f FixedLimit) Observe(time.Duration, int, bool) {}
+
+// ConcurrencyConfig Concurrency 的設定。
+type ConcurrencyConfig struct {
+	// Limit 每個 key 的處理中上限（所有 key 共用同一個 ConcurrencyLimit）
+	Limit ConcurrencyLimit
+
+	// MaxQueue 每個 key 最多排隊的請求數（0 表示不排隊，超過上限直接拒絕）
+	MaxQueue int
+
+	// QueueTimeout 排隊的最長等待時間（0 表示只受請求 context 限制）
+	QueueTimeout time.Duration
+}
+
+// Concurrency 按 key 限制處理中（in-flight）的請求數。
+//
+// 問題：限流演算法限制的是「速率」而非「處理中的工作量」。
+// 後端變慢時，同樣 100 req/s 的流量，處理中的請求從 10 個堆積到 1000 個，
+// 連線、記憶體、執行緒被耗盡，後端越來越慢（正回饋），最後整個崩潰。
+//
+// 解決（Little's Law：處理中數量 = 到達速率 × 處理時間）：
+//   - 直接限制處理中的數量，後端變慢時自動降低吞吐量
+//   - 超過上限的請求排隊等待（吸收短暫突發），排太久或佇列滿則拒絕
+//
+// 設計考量：
+//   - FIFO 佇列：先到先服務，避免請求餓死
+//   - 直接交接：釋放時名額直接交給佇列最前面的請求，不會被新來的請求插隊，
+//     也不會喚醒所有等待者（驚群）
+//   - 沒有處理中與排隊請求的 key 立即刪除，記憶體只與活躍 key 數量有關
+//
+// 注意：並發數是本機狀態，多實例時每個實例各自限制
+type Concurrency struct {
+	cfg ConcurrencyConfig
+
+	mu   sync.Mutex
+	keys map[string]*concurrencyState
+}
+
+type concurrencyState struct {
+	inflight int
+	queue    *list.List // 元素為 chan struct{}（容量 1），收到值表示輪到自己
+}
+
+// NewConcurrency 建立並發限制器。
+//
+// 範例：
+//
+//	// 每個 IP 最多 10 個處理中，另有 20 個排隊，最多等 1 秒
+//	c := NewConcurrency(ConcurrencyConfig{Limit: FixedLimit(10), MaxQueue: 20, QueueTimeout: time.Second})
+//	release, err := c.Acquire(ctx, "ip:1.2.3.4")
+//	if err != nil { ... }
+//	defer release(false)
+func NewConcurrency(cfg ConcurrencyConfig) *Concurrency {
+	if cfg.Limit == nil {
+		cfg.Limit = FixedLimit(100)
+	}
+	return &Concurrency{cfg: cfg, keys: make(map[string]*concurrencyState)}
+}
+
+// Acquire 取得 key 的一個處理名額，名額不足時排隊等待。
+//
+// 成功時返回 release，請求結束時必須呼叫一次（dropped 表示因過載失敗，供自適應上限使用）
+// 失敗時返回 ErrConcurrencyLimit、ErrQueueTimeout 或 ctx 的錯誤
+func (c *Concurrency) Acquire(ctx context.Context, key string) (release func(dropped bool), err error) {
+	c.mu.Lock()
+	s, ok := c.keys[key]
+	if !ok {
+		s = &concurrencyState{queue: list.New()}
+		c.keys[key] = s
+	}
+
+	// 佇列非空時新請求也要排隊，不能插隊
+	if s.inflight < c.cfg.Limit.Limit() && s.queue.Len() == 0 {
+		s.inflight++
+		inflight := s.inflight
+		c.mu.Unlock()
+		return c.releaser(key, inflight), nil
+	}
+	if s.queue.Len() >= c.cfg.MaxQueue {
+		c.cleanup(key, s)
+		c.mu.Unlock()
+		return nil, ErrConcurrencyLimit
+	}
+
+	ready := make(chan struct{}, 1)
+	el := s.queue.PushBack(ready)
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if c.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(c.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		return c.releaser(key, c.InFlight(key)), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrQueueTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-ready:
+		// 逾時的同時剛好輪到自己：名額已經交接過來，直接使用
+		return c.releaser(key, s.inflight), nil
+	default:
+		s.queue.Remove(el)
+		c.cleanup(key, s)
+		return nil, err
+	}
+}
+
+// InFlight 返回 key 處理中的請求數（用於監控）。
+func (c *Concurrency) InFlight(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.keys[key]; ok {
+		return s.inflight
+	}
+	return 0
+}
+
+// Queued 返回 key 排隊中的請求數（用於監控）。
+func (c *Concurrency) Queued(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.keys[key]; ok {
+		return s.queue.Len()
+	}
+	return 0
+}
+
+// Limit 返回當前的上限（自適應上限會隨時間變化）。
+func (c *Concurrency) Limit() int {
+	return c.cfg.Limit.Limit()
+}
+
+// releaser 建立釋放函數（重複呼叫只生效一次）。
+func (c *Concurrency) releaser(key string, inflight int) func(dropped bool) {
+	start := time.Now()
+	var once sync.Once
+	return func(dropped bool) {
+		once.Do(func() {
+			c.cfg.Limit.Observe(time.Since(start), inflight, dropped)
+			c.release(key)
+		})
+	}
+}
+
+// release 歸還名額：上限允許時直接交給佇列最前面的請求，否則減少處理中數量。
+//
+// 自適應上限降低後，處理中的數量可能超過新上限，此時不交接，讓數量自然回落
+func (c *Concurrency) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.keys[key]
+	if front := s.queue.Front(); front != nil && s.inflight <= c.cfg.Limit.Limit() {
+		s.queue.Remove(front)
+		front.Value.(chan struct{}) <- struct{}{}
+		return
+	}
+	s.inflight--
+	c.cleanup(key, s)
+}
+
+// cleanup 沒有處理中與排隊的請求時刪除 key（呼叫方持有鎖）。
+func (c *Concurrency) cleanup(key string, s *concurrencyState) {
+	if s.inflight == 0 && s.queue.Len() == 0 {
+		delete(c.keys, key)
+	}
+}
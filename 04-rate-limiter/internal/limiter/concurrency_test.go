@@ -0,0 +1,137 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustAcquire(t *testing.T, c *Concurrency, key string) func(bool) {
+	t.Helper()
+	release, err := c.Acquire(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Acquire(%q) error: %v", key, err)
+	}
+	return release
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	c := NewConcurrency(ConcurrencyConfig{Limit: FixedLimit(2)})
+
+	release := mustAcquire(t, c, "k")
+	mustAcquire(t, c, "k")
+	if _, err := c.Acquire(context.Background(), "k"); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("third Acquire error = %v, want ErrConcurrencyLimit", err)
+	}
+	mustAcquire(t, c, "other")
+
+	// 重複釋放只生效一次
+	release(false)
+	release(false)
+	if got := c.InFlight("k"); got != 1 {
+		t.Fatalf("InFlight after release = %d, want 1", got)
+	}
+	mustAcquire(t, c, "k")
+}
+
+func TestConcurrencyQueueHandoff(t *testing.T) {
+	c := NewConcurrency(ConcurrencyConfig{Limit: FixedLimit(1), MaxQueue: 1})
+	release := mustAcquire(t, c, "k")
+
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := c.Acquire(context.Background(), "k")
+		acquired <- err
+	}()
+
+	// 等待 goroutine 進入佇列
+	for c.Queued("k") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := c.Acquire(context.Background(), "k"); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("Acquire with full queue error = %v, want ErrConcurrencyLimit", err)
+	}
+
+	release(false)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("queued Acquire error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued request not woken after release")
+	}
+	if got := c.InFlight("k"); got != 1 {
+		t.Fatalf("InFlight after handoff = %d, want 1", got)
+	}
+}
+
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	c := NewConcurrency(ConcurrencyConfig{Limit: FixedLimit(1), MaxQueue: 1, QueueTimeout: 20 * time.Millisecond})
+	release := mustAcquire(t, c, "k")
+
+	if _, err := c.Acquire(context.Background(), "k"); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("Acquire error = %v, want ErrQueueTimeout", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Acquire(ctx, "k"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire with canceled context error = %v, want context.Canceled", err)
+	}
+
+	// 逾時的請求已離開佇列：釋放後 key 被刪除
+	release(false)
+	if n := len(c.keys); n != 0 {
+		t.Fatalf("%d keys left after all requests finished", n)
+	}
+}
+
+func TestAIMD(t *testing.T) {
+	a := NewAIMD(AIMDConfig{AdaptiveConfig: AdaptiveConfig{Initial: 10}, Timeout: 100 * time.Millisecond})
+
+	// 滿載且成功：上限逐步增加
+	for range 100 {
+		a.Observe(10*time.Millisecond, a.Limit(), false)
+	}
+	if got := a.Limit(); got <= 10 {
+		t.Fatalf("Limit after successes = %d, want > 10", got)
+	}
+
+	// 低負載：成功不增加上限
+	before := a.Limit()
+	for range 100 {
+		a.Observe(10*time.Millisecond, 1, false)
+	}
+	if got := a.Limit(); got != before {
+		t.Fatalf("Limit changed under low load: %d -> %d", before, got)
+	}
+
+	// 逾時：乘法減少
+	a.Observe(200*time.Millisecond, a.Limit(), false)
+	if got := a.Limit(); got >= before {
+		t.Fatalf("Limit after timeout = %d, want < %d", got, before)
+	}
+}
+
+func TestGradient(t *testing.T) {
+	g := NewGradient(GradientConfig{AdaptiveConfig: AdaptiveConfig{Initial: 10, Max: 100}})
+
+	// 延遲穩定、滿載：上限往上探
+	for range 50 {
+		g.Observe(10*time.Millisecond, g.Limit(), false)
+	}
+	grown := g.Limit()
+	if grown <= 10 {
+		t.Fatalf("Limit with stable latency = %d, want > 10", grown)
+	}
+
+	// 延遲上升為基準的 5 倍：上限減少
+	for range 10 {
+		g.Observe(50*time.Millisecond, g.Limit(), false)
+	}
+	if got := g.Limit(); got >= grown {
+		t.Fatalf("Limit after latency spike = %d, want < %d", got, grown)
+	}
+}
@@ -11,14 +11,15 @@
 //   - Lua：保證操作原子性，避免 race condition
 //
 // Lua 腳本的必要性：
-//   若不使用 Lua，需要多次 Redis 操作：
-//     1. GET 計數器
-//     2. 檢查限制
-//     3. INCR 計數器
-//   問題：步驟 1-3 之間可能有其他請求，導致超過限制
 //
-//   使用 Lua 後：
-//     單次執行完整邏輯，Redis 保證原子性
+//	若不使用 Lua，需要多次 Redis 操作：
+//	  1. GET 計數器
+//	  2. 檢查限制
+//	  3. INCR 計數器
+//	問題：步驟 1-3 之間可能有其他請求，導致超過限制
+//
+//	使用 Lua 後：
+//	  單次執行完整邏輯，Redis 保證原子性
 //
 // 效能考量：
 //   - 網路延遲：每次限流需要一次 Redis 呼叫（約 1-2ms）
@@ -31,22 +32,28 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 // DistributedTokenBucket 分散式令牌桶限流器。
 //
 // 實作策略：
-//   使用 Redis 儲存桶狀態：
-//     - {key}:tokens - 當前令牌數
-//     - {key}:last_refill - 上次填充時間（Unix 時間戳記）
+//
+//	使用 Redis Hash 儲存桶狀態（單一 key）：
+//	  - tokens - 當前令牌數
+//	  - ts - 上次填充時間（毫秒時間戳記）
+//
+//	為何用一個 Hash 而非兩個 key？
+//	  - 腳本存取的 key 必須全部在 KEYS 中宣告，Redis Cluster 才能路由
+//	  - 兩個不同的 key 可能落在不同 slot，Cluster 下腳本直接報錯
 //
 // Lua 腳本邏輯：
-//   1. 讀取當前令牌數和上次填充時間
-//   2. 計算需要填充的令牌數
-//   3. 更新令牌數和時間
-//   4. 嘗試扣除令牌
-//   5. 返回是否成功
+//  1. 讀取當前令牌數和上次填充時間
+//  2. 計算需要填充的令牌數
+//  3. 更新令牌數和時間
+//  4. 嘗試扣除 n 個令牌（不足則不扣）
+//  5. 返回判定結果（是否允許、剩餘令牌、重置與重試時間）
 type DistributedTokenBucket struct {
 	client     *redis.Client
 	capacity   int64
@@ -59,48 +66,69 @@ type DistributedTokenBucket struct {
 // KEYS[1]: 令牌計數器的 key
 // ARGV[1]: 容量
 // ARGV[2]: 填充速率（每秒）
-// ARGV[3]: 當前時間（Unix timestamp）
+// ARGV[3]: 當前時間（毫秒時間戳記）
+// ARGV[4]: 本次消耗的令牌數
 //
-// 返回值：
-//   1: 允許請求
-//   0: 拒絕請求
+// 返回值（陣列）：
+//
+//	[1] 1 允許 / 0 拒絕
+//	[2] 剩餘令牌數（向下取整）
+//	[3] 令牌填滿所需毫秒數
+//	[4] 被拒絕時，湊足所需令牌的毫秒數（超過容量時為 0）
+//
+// 為何使用毫秒？
+//   - 秒級時間戳記下，同一秒內的填充進度全部丟失
+//   - 令牌數以小數儲存，零頭保留到下次計算
+//
+// 注意：Lua number 轉為 Redis 回覆時會截斷為整數，
+// 因此小數在腳本內自行取整（剩餘向下、等待時間向上）
 var tokenBucketScript = `
 local key = KEYS[1]
 local capacity = tonumber(ARGV[1])
 local refill_rate = tonumber(ARGV[2])
 local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
 
 -- 取得當前狀態
-local tokens = tonumber(redis.call('GET', key .. ':tokens') or capacity)
-local last_refill = tonumber(redis.call('GET', key .. ':last_refill') or now)
+local state = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local last_refill = tonumber(state[2]) or now
 
 -- 計算需要填充的令牌
 local elapsed = math.max(0, now - last_refill)
-local tokens_to_add = elapsed * refill_rate
+local tokens_to_add = elapsed * refill_rate / 1000
 tokens = math.min(capacity, tokens + tokens_to_add)
 
--- 嘗試扣除令牌
-if tokens >= 1 then
-    tokens = tokens - 1
+-- 嘗試扣除令牌（cost 必須在 1 到容量之間，負數會反向增加令牌）
+local allowed = 0
+if cost > 0 and cost <= capacity and tokens >= cost then
+    tokens = tokens - cost
+    allowed = 1
+end
 
-    -- 更新 Redis
-    redis.call('SET', key .. ':tokens', tokens)
-    redis.call('SET', key .. ':last_refill', now)
-    redis.call('EXPIRE', key .. ':tokens', 3600)
-    redis.call('EXPIRE', key .. ':last_refill', 3600)
+-- 計算重置與重試時間
+local reset_ms = math.ceil((capacity - tokens) * 1000 / refill_rate)
 
-    return 1
-else
-    return 0
+-- 更新 Redis（拒絕時也寫回，填充進度不會丟失）
+-- 過期時間取桶填滿所需時間：過期後重新建立的滿桶與原狀態等價
+redis.call('HSET', key, 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', key, reset_ms + 1000)
+
+local retry_ms = 0
+if allowed == 0 and cost > 0 and cost <= capacity then
+    retry_ms = math.ceil((cost - tokens) * 1000 / refill_rate)
 end
+
+return {allowed, math.floor(tokens), reset_ms, retry_ms}
 `
 
 // NewDistributedTokenBucket 建立分散式令牌桶。
 //
 // 參數：
-//   client: Redis 客戶端
-//   capacity: 桶容量
-//   refillRate: 填充速率（每秒）
+//
+//	client: Redis 客戶端
+//	capacity: 桶容量
+//	refillRate: 填充速率（每秒）
 //
 // Redis 連線設定建議：
 //   - PoolSize: 10-50（根據 QPS 調整）
@@ -117,10 +145,17 @@ func NewDistributedTokenBucket(client *redis.Client, capacity, refillRate int64)
 }
 
 // Allow 檢查是否允許請求。
+func (dtb *DistributedTokenBucket) Allow(ctx context.Context, key string) (Decision, error) {
+	return dtb.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否可以一次取出 n 個令牌。
 //
 // 參數：
-//   ctx: 上下文（用於逾時控制）
-//   key: 限流 key（如 "api:/users", "ip:1.2.3.4", "user:123"）
+//
+//	ctx: 上下文（用於逾時控制）
+//	key: 限流 key（如 "api:/users", "ip:1.2.3.4", "user:123"）
+//	n: 本次消耗的令牌數
 //
 // 錯誤處理策略：
 //   - Redis 不可用時：建議降級允許請求（避免服務完全不可用）
@@ -130,8 +165,8 @@ func NewDistributedTokenBucket(client *redis.Client, capacity, refillRate int64)
 //   - Redis 延遲
 //   - 限流拒絕率
 //   - Redis 錯誤率
-func (dtb *DistributedTokenBucket) Allow(ctx context.Context, key string) (bool, error) {
-	now := time.Now().Unix()
+func (dtb *DistributedTokenBucket) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
+	now := time.Now().UnixMilli()
 
 	result, err := dtb.script.Run(
 		ctx,
@@ -140,24 +175,42 @@ func (dtb *DistributedTokenBucket) Allow(ctx context.Context, key string) (bool,
 		dtb.capacity,
 		dtb.refillRate,
 		now,
-	).Int()
+		n,
+	).Int64Slice()
 
 	if err != nil {
 		// 降級策略：Redis 錯誤時允許請求
 		// Trade-off: 可用性 > 精確限流
-		return true, fmt.Errorf("redis error: %w", err)
+		return Decision{Allowed: true, Limit: dtb.capacity}, fmt.Errorf("redis error: %w", err)
 	}
 
-	return result == 1, nil
+	return scriptDecision(dtb.capacity, result)
+}
+
+// scriptDecision 將 Lua 腳本返回的陣列轉換為 Decision。
+//
+// 陣列格式：{allowed, remaining, reset_ms, retry_ms}（令牌桶、滑動視窗、GCRA 腳本共用）
+func scriptDecision(limit int64, result []int64) (Decision, error) {
+	if len(result) != 4 {
+		return Decision{Allowed: true, Limit: limit}, fmt.Errorf("unexpected script result: %v", result)
+	}
+	return Decision{
+		Allowed:    result[0] == 1,
+		Limit:      limit,
+		Remaining:  result[1],
+		ResetAfter: time.Duration(result[2]) * time.Millisecond,
+		RetryAfter: time.Duration(result[3]) * time.Millisecond,
+	}, nil
 }
 
 // DistributedSlidingWindow 分散式滑動視窗限流器。
 //
 // 實作策略：
-//   使用 Redis Sorted Set 儲存請求時間：
-//     ZADD key score member
-//     score: 請求時間戳記（毫秒）
-//     member: 請求 ID（可用 UUID 或時間戳記）
+//
+//	使用 Redis Sorted Set 儲存請求時間：
+//	  ZADD key score member
+//	  score: 請求時間戳記（毫秒）
+//	  member: 請求 ID（可用 UUID 或時間戳記）
 //
 // 優點：
 //   - Sorted Set 天然支援時間範圍查詢
@@ -165,8 +218,9 @@ func (dtb *DistributedTokenBucket) Allow(ctx context.Context, key string) (bool,
 //   - ZCARD 快速計數
 //
 // 記憶體優化：
-//   設定 TTL 自動過期
-//   定期清理舊資料
+//
+//	設定 TTL 自動過期
+//	定期清理舊資料
 type DistributedSlidingWindow struct {
 	client *redis.Client
 	limit  int64
@@ -177,25 +231,34 @@ type DistributedSlidingWindow struct {
 // Lua 腳本：滑動視窗演算法
 //
 // KEYS[1]: Sorted Set 的 key
-// ARGV[1]: 視窗大小（秒）
+// ARGV[1]: 視窗大小（毫秒）
 // ARGV[2]: 限制數量
 // ARGV[3]: 當前時間（毫秒時間戳記）
 // ARGV[4]: 請求 ID
+// ARGV[5]: 本次消耗的單位數
 //
 // 邏輯：
-//   1. 移除視窗外的請求
-//   2. 統計視窗內的請求數
-//   3. 檢查是否超過限制
-//   4. 未超過則新增當前請求
+//  1. 移除視窗外的請求
+//  2. 統計視窗內的單位數
+//  3. 加上本次是否超過限制
+//  4. 未超過則新增 n 個 member（request_id:1 ~ request_id:n）
+//  5. 最早的若干單位滑出視窗、容得下本次時可重試，最晚的單位滑出時配額完全恢復
+//
+// 為何每個單位一個 member？
+//   - ZCARD 直接就是單位數（O(1)），不必加總每筆請求的權重
+//   - Trade-off：記憶體與成本成正比，適合成本為個位數到數十的場景
+//
+// 返回值：與令牌桶腳本相同的陣列 {allowed, remaining, reset_ms, retry_ms}
 var slidingWindowScript = `
 local key = KEYS[1]
 local window = tonumber(ARGV[1])
 local limit = tonumber(ARGV[2])
 local now = tonumber(ARGV[3])
 local request_id = ARGV[4]
+local cost = tonumber(ARGV[5])
 
 -- 計算視窗起始時間
-local window_start = now - (window * 1000)
+local window_start = now - window
 
 -- 移除過期請求
 redis.call('ZREMRANGEBYSCORE', key, 0, window_start)
@@ -204,15 +267,33 @@ redis.call('ZREMRANGEBYSCORE', key, 0, window_start)
 local count = redis.call('ZCARD', key)
 
 -- 檢查限制
-if count < limit then
+local allowed = 0
+if cost > 0 and count + cost <= limit then
     -- 新增請求記錄
-    redis.call('ZADD', key, now, request_id)
+    for i = 1, cost do
+        redis.call('ZADD', key, now, request_id .. ':' .. i)
+    end
     -- 設定過期時間（視窗大小 + 緩衝）
-    redis.call('EXPIRE', key, window + 60)
-    return 1
-else
-    return 0
+    redis.call('PEXPIRE', key, window + 60000)
+    count = count + cost
+    allowed = 1
+end
+
+-- 計算重置與重試時間
+local reset_ms = 0
+local retry_ms = 0
+if count > 0 then
+    local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+    reset_ms = math.max(0, tonumber(newest[2]) + window - now)
+    if allowed == 0 and cost > 0 and cost <= limit then
+        -- 第 (count + cost - limit) 舊的單位滑出後容得下本次
+        local idx = count + cost - limit - 1
+        local oldest = redis.call('ZRANGE', key, idx, idx, 'WITHSCORES')
+        retry_ms = math.max(0, tonumber(oldest[2]) + window - now)
+    end
 end
+
+return {allowed, limit - count, reset_ms, retry_ms}
 `
 
 // NewDistributedSlidingWindow 建立分散式滑動視窗限流器。
@@ -226,110 +307,360 @@ func NewDistributedSlidingWindow(client *redis.Client, limit int64, window time.
 }
 
 // Allow 檢查是否允許請求。
+func (dsw *DistributedSlidingWindow) Allow(ctx context.Context, key string) (Decision, error) {
+	return dsw.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否允許消耗 n 個單位。
 //
 // 參數：
-//   ctx: 上下文
-//   key: 限流 key
-//   requestID: 請求唯一識別（建議使用 UUID）
 //
-// 為何需要 requestID？
+//	ctx: 上下文
+//	key: 限流 key
+//	n: 本次消耗的單位數
+//
+// 每次呼叫自動產生 UUID 作為 Sorted Set 的 member 前綴
+//
+// 為何需要唯一的 member？
 //   - Sorted Set 的 member 必須唯一
 //   - 避免同一毫秒內的請求覆蓋
-func (dsw *DistributedSlidingWindow) Allow(ctx context.Context, key, requestID string) (bool, error) {
+func (dsw *DistributedSlidingWindow) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
 	now := time.Now().UnixMilli()
-	windowSeconds := int64(dsw.window.Seconds())
 
 	result, err := dsw.script.Run(
 		ctx,
 		dsw.client,
 		[]string{key},
-		windowSeconds,
+		dsw.window.Milliseconds(),
 		dsw.limit,
 		now,
-		requestID,
-	).Int()
+		uuid.NewString(),
+		n,
+	).Int64Slice()
 
 	if err != nil {
-		return true, fmt.Errorf("redis error: %w", err)
+		return Decision{Allowed: true, Limit: dsw.limit}, fmt.Errorf("redis error: %w", err)
 	}
 
-	return result == 1, nil
+	return scriptDecision(dsw.limit, result)
+}
+
+// DistributedGCRA 分散式 GCRA 限流器（演算法見 GCRA）。
+//
+// 實作策略：
+//
+//	使用 Redis String 儲存理論到達時間（TAT，毫秒時間戳記）
+//
+// 與 DistributedTokenBucket 的比較：
+//   - 狀態：一個 String vs 一個 Hash（兩個欄位），大量 key 時記憶體明顯較少
+//   - 指令：GET + SET PX vs HMGET + HSET + PEXPIRE
+//   - 被拒絕的請求不寫入（TAT 不變），只有一次讀取
+//   - API 與參數相同，可直接替換
+type DistributedGCRA struct {
+	client   *redis.Client
+	capacity int64
+	rate     int64
+	script   *redis.Script
+}
+
+// Lua 腳本：GCRA
+//
+// KEYS[1]: TAT 的 key
+// ARGV[1]: 發射間隔（毫秒，可為小數）
+// ARGV[2]: 突發容量
+// ARGV[3]: 當前時間（毫秒時間戳記）
+// ARGV[4]: 本次消耗的單位數
+//
+// 返回值：與令牌桶腳本相同的陣列 {allowed, remaining, reset_ms, retry_ms}
+//
+// 為何以 string.format 寫入 TAT？
+//   - 速率超過 1000/s 時發射間隔小於 1 毫秒，TAT 帶有小數
+//   - Lua number 轉字串只保留 14 位有效數字，毫秒時間戳記已佔 13 位，小數幾乎全部丟失
+//   - 固定保留 3 位小數（微秒），高速率下也不會累積誤差
+var gcraScript = `
+local key = KEYS[1]
+local emission = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local tolerance = emission * capacity
+
+local tat = tonumber(redis.call('GET', key)) or now
+tat = math.max(tat, now)
+local new_tat = tat + emission * cost
+local allow_at = new_tat - tolerance
+
+-- 拒絕：TAT 不變，不寫入（cost 超出 1 到容量的範圍時永遠無法滿足）
+if cost <= 0 or cost > capacity or now < allow_at then
+    local remaining = math.max(0, math.floor((tolerance - (tat - now)) / emission))
+    local retry_ms = 0
+    if cost > 0 and cost <= capacity then
+        retry_ms = math.ceil(allow_at - now)
+    end
+    return {0, remaining, math.ceil(tat - now), retry_ms}
+end
+
+-- 允許：過期時間取 TAT 回到現在所需時間，過期後重新開始與原狀態等價
+local reset_ms = math.ceil(new_tat - now)
+redis.call('SET', key, string.format('%.3f', new_tat), 'PX', reset_ms + 1000)
+
+local remaining = math.floor((tolerance - (new_tat - now)) / emission)
+return {1, remaining, reset_ms, 0}
+`
+
+// NewDistributedGCRA 建立分散式 GCRA 限流器。
+//
+// 參數：
+//
+//	client: Redis 客戶端
+//	capacity: 突發容量
+//	rate: 每秒允許的請求數
+func NewDistributedGCRA(client *redis.Client, capacity, rate int64) *DistributedGCRA {
+	return &DistributedGCRA{
+		client:   client,
+		capacity: capacity,
+		rate:     rate,
+		script:   redis.NewScript(gcraScript),
+	}
+}
+
+// Allow 檢查是否允許請求。
+func (dg *DistributedGCRA) Allow(ctx context.Context, key string) (Decision, error) {
+	return dg.AllowN(ctx, key, 1)
 }
 
-// DistributedMultiDimension 多維度限流器。
+// AllowN 檢查是否允許消耗 n 個單位。
+//
+// 錯誤處理與 DistributedTokenBucket 相同：返回錯誤，由呼叫方決定降級方式
+func (dg *DistributedGCRA) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
+	now := time.Now().UnixMilli()
+
+	result, err := dg.script.Run(
+		ctx,
+		dg.client,
+		[]string{key},
+		1000/float64(dg.rate),
+		dg.capacity,
+		now,
+		n,
+	).Int64Slice()
+
+	if err != nil {
+		return Decision{Allowed: true, Limit: dg.capacity}, fmt.Errorf("redis error: %w", err)
+	}
+
+	return scriptDecision(dg.capacity, result)
+}
+
+// DistributedMultiDimension 多維度限流器（單一 Lua 腳本，全有或全無）。
 //
 // 設計場景：
-//   同時限制：
-//     - IP 維度：每個 IP 100 req/s
-//     - User 維度：每個使用者 50 req/s
-//     - API 維度：整個 API 1000 req/s
+//
+//	同時限制：
+//	  - IP 維度：每個 IP 100 req/s
+//	  - User 維度：每個使用者 50 req/s
+//	  - API 維度：整個 API 1000 req/s
+//
+// 為何不串聯多個 DistributedTokenBucket？
+//   - 逐個檢查時，前面的維度已經扣了令牌，後面的維度才拒絕，
+//     被拒絕的請求仍消耗了 IP 配額（重試越多，IP 配額被吃得越快）
+//   - 每個維度一次 Redis 往返，延遲隨維度數線性增加
 //
 // 實作策略：
-//   串聯多個限流器，全部通過才允許請求
 //
-// 範例：
-//   dimensions := []string{
-//       fmt.Sprintf("ip:%s", clientIP),
-//       fmt.Sprintf("user:%s", userID),
-//       fmt.Sprintf("api:%s", apiPath),
-//   }
-//   limiter.Allow(ctx, dimensions)
+//	一個腳本完成所有維度：
+//	  1. 依宣告順序計算每個維度填充後的令牌數
+//	  2. 任一維度不足 → 不扣除任何維度，返回拒絕的維度
+//	  3. 全部足夠 → 所有維度各扣一個令牌
+//
+// Redis Cluster：
+//
+//	同一腳本存取的 key 必須在同一個 slot，因此所有 key 使用相同的 hash tag：
+//	  ratelimit:{tag}:ip:1.2.3.4
+//	  ratelimit:{tag}:user:123
+//
+//	Trade-off：同一個 tag 的所有狀態集中在一個節點上
+//	  - 不同用途的限流器使用不同 tag，分散到不同節點
+//	  - 單一 tag 的吞吐量上限約為單個 Redis 節點（50K-100K ops/s）
 type DistributedMultiDimension struct {
-	limiters map[string]*DistributedTokenBucket
+	client     *redis.Client
+	tag        string
+	dimensions []Dimension
+	script     *redis.Script
+}
+
+// Dimension 多維度限流中一個維度的令牌桶參數。
+type Dimension struct {
+	Name       string // 維度名稱（如 "ip"、"user"）
+	Capacity   int64  // 桶容量
+	RefillRate int64  // 每秒填充速率
 }
 
+// MultiDecision 多維度限流的判定結果。
+//
+//   - 拒絕時：Decision 為拒絕的維度的判定，Dimension 為其名稱
+//   - 允許時：Decision 為剩餘配額最少（最接近超限）的維度的判定
+type MultiDecision struct {
+	Decision
+	Dimension string
+}
+
+// Lua 腳本：多維度令牌桶
+//
+// KEYS[i]: 第 i 個維度的桶（Hash：tokens、ts，與 tokenBucketScript 相同）
+// ARGV[1]: 當前時間（毫秒時間戳記）
+// ARGV[2]: 本次消耗的令牌數（每個維度都扣同樣的數量）
+// ARGV[2i+1], ARGV[2i+2]: 第 i 個維度的容量與填充速率（每秒）
+//
+// 返回值（陣列）：
+//
+//	[1] 1 允許 / 0 拒絕
+//	[2] 代表維度的下標（從 1 開始；拒絕時為拒絕的維度，允許時為剩餘最少的維度）
+//	[3] 剩餘令牌數
+//	[4] 令牌填滿所需毫秒數
+//	[5] 被拒絕時，湊足所需令牌的毫秒數（超過容量時為 0）
+var multiDimensionScript = `
+local now = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local n = #KEYS
+local tokens = {}
+local capacity = {}
+local rate = {}
+
+-- 第一階段：只計算，不寫入
+local rejected = 0
+for i = 1, n do
+    capacity[i] = tonumber(ARGV[2 * i + 1])
+    rate[i] = tonumber(ARGV[2 * i + 2])
+
+    local state = redis.call('HMGET', KEYS[i], 'tokens', 'ts')
+    local t = tonumber(state[1]) or capacity[i]
+    local ts = tonumber(state[2]) or now
+    t = math.min(capacity[i], t + math.max(0, now - ts) * rate[i] / 1000)
+    tokens[i] = t
+
+    if rejected == 0 and (cost <= 0 or cost > capacity[i] or t < cost) then
+        rejected = i
+    end
+end
+
+-- 任一維度不足：不扣除任何維度
+if rejected > 0 then
+    local t = tokens[rejected]
+    local reset_ms = math.ceil((capacity[rejected] - t) * 1000 / rate[rejected])
+    local retry_ms = 0
+    if cost > 0 and cost <= capacity[rejected] then
+        retry_ms = math.ceil((cost - t) * 1000 / rate[rejected])
+    end
+    return {0, rejected, math.floor(t), reset_ms, retry_ms}
+end
+
+-- 第二階段：所有維度各扣 cost 個令牌
+local tightest = 1
+for i = 1, n do
+    tokens[i] = tokens[i] - cost
+    local reset_ms = math.ceil((capacity[i] - tokens[i]) * 1000 / rate[i])
+    redis.call('HSET', KEYS[i], 'tokens', tokens[i], 'ts', now)
+    redis.call('PEXPIRE', KEYS[i], reset_ms + 1000)
+    if tokens[i] < tokens[tightest] then
+        tightest = i
+    end
+end
+
+local t = tokens[tightest]
+local reset_ms = math.ceil((capacity[tightest] - t) * 1000 / rate[tightest])
+return {1, tightest, math.floor(t), reset_ms, 0}
+`
+
 // NewDistributedMultiDimension 建立多維度限流器。
 //
 // 參數：
-//   limiters: key 為維度名稱，value 為限流器
+//
+//	client: Redis 客戶端
+//	tag: hash tag（同一個限流器的所有 key 落在同一個 Cluster slot）
+//	dimensions: 各維度的參數，依此順序檢查（拒絕時返回第一個不足的維度）
 //
 // 範例：
-//   limiters := map[string]*DistributedTokenBucket{
-//       "ip":   NewDistributedTokenBucket(client, 100, 100),
-//       "user": NewDistributedTokenBucket(client, 50, 50),
-//       "api":  NewDistributedTokenBucket(client, 1000, 1000),
-//   }
-func NewDistributedMultiDimension(limiters map[string]*DistributedTokenBucket) *DistributedMultiDimension {
+//
+//	limiter := NewDistributedMultiDimension(client, "api",
+//	    Dimension{Name: "ip", Capacity: 100, RefillRate: 100},
+//	    Dimension{Name: "user", Capacity: 50, RefillRate: 50},
+//	    Dimension{Name: "api", Capacity: 1000, RefillRate: 1000},
+//	)
+func NewDistributedMultiDimension(client *redis.Client, tag string, dimensions ...Dimension) *DistributedMultiDimension {
 	return &DistributedMultiDimension{
-		limiters: limiters,
+		client:     client,
+		tag:        tag,
+		dimensions: dimensions,
+		script:     redis.NewScript(multiDimensionScript),
 	}
 }
 
-// Allow 檢查多維度限流。
+// Allow 原子地檢查並扣除所有維度。
+func (dmd *DistributedMultiDimension) Allow(ctx context.Context, keys map[string]string) (MultiDecision, error) {
+	return dmd.AllowN(ctx, keys, 1)
+}
+
+// AllowN 原子地檢查並從所有維度各扣除 n 個令牌。
 //
 // 參數：
-//   ctx: 上下文
-//   keys: map[維度名稱]具體key
+//
+//	ctx: 上下文
+//	keys: map[維度名稱]具體key
+//	n: 本次消耗的令牌數
 //
 // 範例：
-//   keys := map[string]string{
-//       "ip":   "192.168.1.1",
-//       "user": "user123",
-//       "api":  "/api/users",
-//   }
-//
-// 執行流程：
-//   依序檢查每個維度，任一維度超限則拒絕
-//
-// 優化考量：
-//   可並行檢查所有維度（使用 goroutine）
-//   但需要處理部分成功的回滾問題
-func (dmd *DistributedMultiDimension) Allow(ctx context.Context, keys map[string]string) (bool, error) {
-	for dimension, limiter := range dmd.limiters {
-		key, ok := keys[dimension]
-		if !ok {
+//
+//	keys := map[string]string{
+//	    "ip":   "192.168.1.1",
+//	    "user": "user123",
+//	    "api":  "/api/users",
+//	}
+//
+// keys 中缺少（或值為空）的維度不參與本次判定（如匿名請求沒有 user）
+func (dmd *DistributedMultiDimension) AllowN(ctx context.Context, keys map[string]string, n int64) (MultiDecision, error) {
+	redisKeys := make([]string, 0, len(dmd.dimensions))
+	args := make([]any, 2, 2+2*len(dmd.dimensions))
+	args[0] = time.Now().UnixMilli()
+	args[1] = n
+	dims := make([]Dimension, 0, len(dmd.dimensions))
+	for _, dim := range dmd.dimensions {
+		key := keys[dim.Name]
+		if key == "" {
 			continue
 		}
+		redisKeys = append(redisKeys, dmd.redisKey(dim.Name, key))
+		args = append(args, dim.Capacity, dim.RefillRate)
+		dims = append(dims, dim)
+	}
+	if len(dims) == 0 {
+		return MultiDecision{Decision: Decision{Allowed: true}}, nil
+	}
 
-		allowed, err := limiter.Allow(ctx, key)
-		if err != nil {
-			return false, err
-		}
-
-		if !allowed {
-			return false, nil
-		}
+	result, err := dmd.script.Run(ctx, dmd.client, redisKeys, args...).Int64Slice()
+	if err != nil {
+		return MultiDecision{Decision: Decision{Allowed: true}}, fmt.Errorf("redis error: %w", err)
+	}
+	if len(result) != 5 || result[1] < 1 || int(result[1]) > len(dims) {
+		return MultiDecision{Decision: Decision{Allowed: true}}, fmt.Errorf("unexpected script result: %v", result)
 	}
 
-	return true, nil
+	dim := dims[result[1]-1]
+	return MultiDecision{
+		Decision: Decision{
+			Allowed:    result[0] == 1,
+			Limit:      dim.Capacity,
+			Remaining:  result[2],
+			ResetAfter: time.Duration(result[3]) * time.Millisecond,
+			RetryAfter: time.Duration(result[4]) * time.Millisecond,
+		},
+		Dimension: dim.Name,
+	}, nil
+}
+
+// redisKey 組出帶 hash tag 的 key：ratelimit:{tag}:維度:值
+//
+// Redis Cluster 只對 {} 內的部分計算 slot，tag 相同的 key 必定在同一個 slot
+func (dmd *DistributedMultiDimension) redisKey(dimension, key string) string {
+	return "ratelimit:{" + dmd.tag + "}:" + dimension + ":" + key
 }
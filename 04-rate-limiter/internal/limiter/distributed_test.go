@@ -0,0 +1,141 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newMultiDimension(t *testing.T) *DistributedMultiDimension {
+	return NewDistributedMultiDimension(newRedis(t), "api",
+		Dimension{Name: "ip", Capacity: 10, RefillRate: 1},
+		Dimension{Name: "user", Capacity: 2, RefillRate: 1},
+	)
+}
+
+func mustAllowMulti(t *testing.T, l MultiLimiter, keys map[string]string, n int64) MultiDecision {
+	t.Helper()
+	d, err := l.AllowN(context.Background(), keys, n)
+	if err != nil {
+		t.Fatalf("AllowN(%v, %d) error: %v", keys, n, err)
+	}
+	return d
+}
+
+// TestMultiDimensionAllOrNothing 任一維度拒絕時，其他維度不扣除配額。
+func TestMultiDimensionAllOrNothing(t *testing.T) {
+	l := newMultiDimension(t)
+	keys := map[string]string{"ip": "1.2.3.4", "user": "alice"}
+
+	for i := range 2 {
+		d := mustAllowMulti(t, l, keys, 1)
+		// 允許時回報剩餘最少的維度
+		if !d.Allowed || d.Dimension != "user" || d.Remaining != int64(1-i) || d.Limit != 2 {
+			t.Fatalf("request %d = %+v, want allowed with user the tightest dimension", i, d)
+		}
+	}
+
+	for range 5 {
+		d := mustAllowMulti(t, l, keys, 1)
+		if d.Allowed || d.Dimension != "user" || d.RetryAfter <= 0 {
+			t.Fatalf("request beyond user limit = %+v, want denied by user with a retry time", d)
+		}
+	}
+
+	// 被拒絕的 5 個請求沒有消耗 IP 配額：10 - 2 - 1
+	d := mustAllowMulti(t, l, map[string]string{"ip": "1.2.3.4"}, 1)
+	if !d.Allowed || d.Dimension != "ip" || d.Remaining != 7 {
+		t.Errorf("ip-only request = %+v, want 7 ip tokens left", d)
+	}
+}
+
+func TestMultiDimensionCost(t *testing.T) {
+	l := newMultiDimension(t)
+	keys := map[string]string{"ip": "1.2.3.4"}
+
+	if d := mustAllowMulti(t, l, keys, 8); !d.Allowed || d.Remaining != 2 {
+		t.Fatalf("AllowN(8) = %+v, want allowed with 2 remaining", d)
+	}
+	if d := mustAllowMulti(t, l, keys, 3); d.Allowed || d.Remaining != 2 || d.RetryAfter <= 0 {
+		t.Fatalf("AllowN(3) = %+v, want denied with 2 remaining and a retry time", d)
+	}
+	// 超過容量的成本永遠無法滿足
+	if d := mustAllowMulti(t, l, keys, 11); d.Allowed || d.RetryAfter != 0 {
+		t.Fatalf("AllowN(11) = %+v, want denied without retry time", d)
+	}
+	// 負數與 0 同樣拒絕，不會反向增加令牌
+	for _, n := range []int64{0, -5, math.MaxInt64} {
+		if d := mustAllowMulti(t, l, keys, n); d.Allowed || d.RetryAfter != 0 {
+			t.Fatalf("AllowN(%d) = %+v, want denied without retry time", n, d)
+		}
+	}
+	if d := mustAllowMulti(t, l, keys, 3); d.Allowed || d.Remaining != 2 {
+		t.Errorf("AllowN(3) = %+v, want still denied with 2 remaining", d)
+	}
+}
+
+func TestMultiDimensionKeys(t *testing.T) {
+	client := newRedis(t)
+	l := NewDistributedMultiDimension(client, "api",
+		Dimension{Name: "ip", Capacity: 10, RefillRate: 1},
+		Dimension{Name: "user", Capacity: 2, RefillRate: 1},
+	)
+	ctx := context.Background()
+
+	// 沒有任何維度的 key：直接允許，不存取 Redis
+	if d := mustAllowMulti(t, l, map[string]string{"user": ""}, 1); !d.Allowed || d.Dimension != "" {
+		t.Errorf("AllowN without keys = %+v, want allowed", d)
+	}
+
+	mustAllowMulti(t, l, map[string]string{"ip": "1.2.3.4", "user": "alice", "unknown": "x"}, 1)
+	keys, err := client.Keys(ctx, "*").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	want := []string{"ratelimit:{api}:ip:1.2.3.4", "ratelimit:{api}:user:alice"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("redis keys = %v, want %v (same hash tag, undeclared dimensions ignored)", keys, want)
+	}
+	for _, key := range keys {
+		if ttl := client.PTTL(ctx, key).Val(); ttl <= 0 {
+			t.Errorf("PTTL(%s) = %v, want an expiry", key, ttl)
+		}
+	}
+}
+
+func TestMultiDimensionConcurrent(t *testing.T) {
+	l := NewDistributedMultiDimension(newRedis(t), "api",
+		Dimension{Name: "ip", Capacity: 100, RefillRate: 1},
+		Dimension{Name: "user", Capacity: 20, RefillRate: 1},
+	)
+	keys := map[string]string{"ip": "1.2.3.4", "user": "alice"}
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := l.Allow(context.Background(), keys)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if d.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 20 {
+		t.Fatalf("allowed %d of 50 concurrent requests, want 20", got)
+	}
+	if d := mustAllowMulti(t, l, map[string]string{"ip": "1.2.3.4"}, 1); d.Remaining != 79 {
+		t.Errorf("ip remaining = %d, want 79 (only allowed requests consume ip tokens)", d.Remaining)
+	}
+}
@@ -0,0 +1,111 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// GCRA 實作通用信元速率演算法（Generic Cell Rate Algorithm）。
+//
+// 演算法原理：
+//
+//	不計數令牌，只記錄「理論到達時間」（TAT, Theoretical Arrival Time）：
+//	  - 請求以固定間隔 T（= 1 / rate）到達時，下一個請求「應該」在 TAT 到達
+//	  - 每允許一個請求，TAT 往後推 T
+//	  - 允許提前到達，但最多提前 τ（= capacity × T，即突發容量）
+//
+//	判定：newTAT = max(TAT, now) + n × T（n 為本次消耗的單位數）
+//	  - newTAT - now ≤ τ → 允許，TAT = newTAT
+//	  - 否則拒絕，最早可在 newTAT - τ 重試
+//
+// 與令牌桶的關係：
+//   - 行為等價於容量 capacity、速率 rate 的令牌桶（TAT - now 就是「欠下的令牌 × T」）
+//   - 但只需儲存一個時間戳記，不需要令牌數 + 上次填充時間兩個欄位
+//
+// 優點：
+//   - 狀態最小：每個 key 一個時間戳記（Redis 中是一個 String，而非 Hash）
+//   - 重試時間精確：newTAT - τ - now 直接算出，不需要從令牌零頭推算
+//   - 沒有「填充」步驟，不會有零頭時間被丟棄的問題
+//
+// 缺點：
+//   - 概念較不直觀（「理論到達時間」不如「桶裡有幾個令牌」好理解）
+//
+// 適用場景：
+//   - 大量 key 的分散式限流（記憶體與 Redis 指令數都最少）
+//   - 需要精確 Retry-After 的 API
+type GCRA struct {
+	capacity int64         // 突發容量
+	emission time.Duration // 發射間隔 T（每個請求佔用的時間）
+	tat      time.Time     // 理論到達時間（零值表示尚無請求）
+	mu       sync.Mutex
+}
+
+// NewGCRA 建立 GCRA 限流器。
+//
+// 參數與令牌桶相同，可直接替換：
+//
+//	capacity: 突發容量（連續請求的最大數量）
+//	rate: 每秒允許的請求數
+//
+// 範例：
+//
+//	limiter := NewGCRA(100, 10)  // 突發100，每秒10個
+//	d, _ := limiter.Allow(ctx, "")
+func NewGCRA(capacity, rate int64) *GCRA {
+	return &GCRA{
+		capacity: capacity,
+		emission: interval(rate),
+	}
+}
+
+// Allow 檢查是否允許請求通過（key 被忽略，實例本身就是一個桶）。
+func (g *GCRA) Allow(ctx context.Context, key string) (Decision, error) {
+	return g.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否允許消耗 n 個單位。
+//
+// 加權成本在 GCRA 中只是把 TAT 往後推 n × T，判定公式不變
+//
+// 時間複雜度：O(1)
+// 空間複雜度：O(1)
+func (g *GCRA) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	tolerance := time.Duration(g.capacity) * g.emission
+
+	// TAT 已經過去：閒置期間累積的配額最多一整桶（與令牌桶的容量上限相同）
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	// n 超過容量時永遠無法滿足；先檢查範圍，n × T 才不會溢位
+	d := Decision{Limit: g.capacity}
+	if validN(n, g.capacity) {
+		newTAT := tat.Add(time.Duration(n) * g.emission)
+		if allowAt := newTAT.Add(-tolerance); now.Before(allowAt) {
+			d.RetryAfter = allowAt.Sub(now)
+		} else {
+			g.tat = newTAT
+			tat = newTAT
+			d.Allowed = true
+		}
+	}
+
+	// TAT 距離現在越遠，已用掉的配額越多；TAT 回到現在時配額完全恢復
+	used := tat.Sub(now)
+	d.ResetAfter = used
+	d.Remaining = int64((tolerance - used) / g.emission)
+	return d, nil
+}
+
+// TAT 返回理論到達時間（用於監控）。
+func (g *GCRA) TAT() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.tat
+}
@@ -0,0 +1,202 @@
+package limiter
+
+import (
+	"container/list"
+	"context"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Keyed 按 key 分別限流的單機限流器集合。
+//
+// 問題：TokenBucket 等單機演算法是單一實例，直接用在中介軟體上等於全域一個桶，
+// 一個客戶端打滿配額，所有客戶端一起被拒絕。
+//
+// 解決：每個 key（IP、使用者、API Key）第一次出現時建立自己的限流器。
+//
+// 設計考量：
+//   - 分片（shard）：每片獨立加鎖，不同 key 的請求不會互相競爭同一把鎖
+//   - 容量上限（LRU）：key 由客戶端控制（偽造 IP、隨機 API Key），
+//     不設上限會被撐爆記憶體；超過上限淘汰最久未使用的 key
+//   - 閒置淘汰：長時間沒有請求的 key 不再佔用記憶體
+//
+// 為何使用泛型？
+//   - 呼叫方可以透過 Get 取回具體型別，讀取監控資訊（如 TokenBucket.Tokens）
+//   - 工廠函數返回具體型別，不需要型別斷言
+type Keyed[L Limiter] struct {
+	newLimiter  func() L
+	shards      []*keyedShard[L]
+	seed        maphash.Seed
+	maxPerShard int
+	idleTimeout time.Duration
+}
+
+// KeyedConfig Keyed 的設定。
+type KeyedConfig struct {
+	// Shards 分片數量（向上取為 2 的冪，預設 32）
+	//
+	// 經驗值：CPU 核數的數倍，讓同時持有同一把鎖的機率足夠低
+	Shards int
+
+	// MaxKeys 最多保留的 key 數量（預設 100,000）
+	//
+	// 平均分配到各分片，每片各自做 LRU 淘汰
+	// 記憶體估算：TokenBucket 約 100 bytes + 索引開銷，10 萬個 key 約 20 MB
+	MaxKeys int
+
+	// IdleTimeout 閒置多久後可以淘汰（預設 10 分鐘，0 表示使用預設值）
+	IdleTimeout time.Duration
+}
+
+type keyedShard[L Limiter] struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // 前端為最近使用
+}
+
+type keyedEntry[L Limiter] struct {
+	key      string
+	limiter  L
+	lastSeen time.Time
+	resetAt  atomic.Int64 // 配額完全恢復的時間（UnixNano），在分片鎖外更新
+}
+
+// NewKeyed 建立按 key 限流的集合。
+//
+// 參數：
+//
+//	newLimiter: 為新 key 建立限流器的工廠函數
+//	cfg: 分片、容量與閒置設定（零值使用預設值）
+//
+// 範例：
+//
+//	perIP := NewKeyed(func() *TokenBucket { return NewTokenBucket(10, 2) }, KeyedConfig{})
+//	d, _ := perIP.Allow(ctx, "ip:1.2.3.4")
+func NewKeyed[L Limiter](newLimiter func() L, cfg KeyedConfig) *Keyed[L] {
+	if cfg.Shards <= 0 {
+		cfg.Shards = 32
+	}
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = 100_000
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 10 * time.Minute
+	}
+
+	// 分片數取 2 的冪，用位元運算取代取模
+	shards := 1
+	for shards < cfg.Shards {
+		shards <<= 1
+	}
+
+	k := &Keyed[L]{
+		newLimiter:  newLimiter,
+		shards:      make([]*keyedShard[L], shards),
+		seed:        maphash.MakeSeed(),
+		maxPerShard: max(1, (cfg.MaxKeys+shards-1)/shards),
+		idleTimeout: cfg.IdleTimeout,
+	}
+	for i := range k.shards {
+		k.shards[i] = &keyedShard[L]{
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+		}
+	}
+	return k
+}
+
+// Allow 取得（或建立）key 對應的限流器並判定。
+//
+// 鎖的範圍：
+//   - 分片鎖只保護索引（查找、建立、調整 LRU 順序）
+//   - 限流器本身有自己的鎖，在分片鎖外呼叫，同分片的其他 key 不必等待
+func (k *Keyed[L]) Allow(ctx context.Context, key string) (Decision, error) {
+	return k.AllowN(ctx, key, 1)
+}
+
+// AllowN 取得（或建立）key 對應的限流器，並判定是否可以消耗 n 個單位。
+func (k *Keyed[L]) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
+	e := k.entry(key, time.Now())
+
+	d, err := e.limiter.AllowN(ctx, key, n)
+	if err != nil {
+		return d, err
+	}
+	e.resetAt.Store(time.Now().Add(d.ResetAfter).UnixNano())
+	return d, nil
+}
+
+// Get 返回 key 對應的限流器（不存在時建立），用於監控或測試。
+func (k *Keyed[L]) Get(key string) L {
+	return k.entry(key, time.Now()).limiter
+}
+
+// Len 返回目前保留的 key 數量（用於監控）。
+func (k *Keyed[L]) Len() int {
+	n := 0
+	for _, s := range k.shards {
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// entry 查找或建立 key 的項目，並順帶淘汰閒置與超量的 key。
+func (k *Keyed[L]) entry(key string, now time.Time) *keyedEntry[L] {
+	s := k.shards[maphash.String(k.seed, key)&uint64(len(k.shards)-1)]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*keyedEntry[L])
+		e.lastSeen = now
+		s.lru.MoveToFront(el)
+		return e
+	}
+
+	s.evictIdle(now, k.idleTimeout)
+	if len(s.entries) >= k.maxPerShard {
+		s.remove(s.lru.Back())
+	}
+
+	e := &keyedEntry[L]{key: key, limiter: k.newLimiter(), lastSeen: now}
+	s.entries[key] = s.lru.PushFront(e)
+	return e
+}
+
+// evictIdle 從 LRU 尾端淘汰閒置的 key。
+//
+// 淘汰條件：閒置超過 idleTimeout，且配額已經完全恢復
+//
+// 為何要等配額恢復？
+//   - 淘汰後再次出現的 key 會拿到全新的（滿的）限流器
+//   - 若淘汰一個剛被打空的桶，等於免費送出一整桶配額
+//   - 配額已恢復的限流器與新建的沒有差別，淘汰不影響限流結果
+//
+// 尾端的 key 不符合條件就停止：越往前越新，只在建立新 key 時檢查，攤銷 O(1)
+func (s *keyedShard[L]) evictIdle(now time.Time, idleTimeout time.Duration) {
+	for el := s.lru.Back(); el != nil; el = s.lru.Back() {
+		e := el.Value.(*keyedEntry[L])
+		if now.Sub(e.lastSeen) < idleTimeout || now.UnixNano() < e.resetAt.Load() {
+			return
+		}
+		s.remove(el)
+	}
+}
+
+// remove 刪除一個項目。
+//
+// 容量淘汰不檢查配額是否恢復（上限優先於精確度）：
+// 攻擊者用大量 key 擠掉正常 key 時，被擠掉的 key 會重新拿到滿配額，
+// MaxKeys 應設為正常情況下活躍 key 數量的數倍
+func (s *keyedShard[L]) remove(el *list.Element) {
+	if el == nil {
+		return
+	}
+	e := s.lru.Remove(el).(*keyedEntry[L])
+	delete(s.entries, e.key)
+}
@@ -0,0 +1,63 @@
+package limiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestKeyedLRU(t *testing.T) {
+	k := NewKeyed(func() *TokenBucket { return NewTokenBucket(1, 1) }, KeyedConfig{Shards: 1, MaxKeys: 2})
+
+	exhaust(t, k, "a", 1)
+	exhaust(t, k, "b", 1)
+	mustAllow(t, k, "a") // a 變為最近使用（被拒絕也算使用）
+	mustAllow(t, k, "c") // 超過上限：淘汰最久未使用的 b
+	if k.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", k.Len())
+	}
+
+	// a 保留原來的（已打空的）桶，b 被淘汰後重新建立
+	if d := mustAllow(t, k, "a"); d.Allowed {
+		t.Errorf("a allowed after eviction of another key: %+v", d)
+	}
+	if d := mustAllow(t, k, "b"); !d.Allowed {
+		t.Errorf("b denied, want a fresh limiter after LRU eviction: %+v", d)
+	}
+}
+
+func TestKeyedMaxKeys(t *testing.T) {
+	k := NewKeyed(func() *TokenBucket { return NewTokenBucket(10, 1) }, KeyedConfig{Shards: 4, MaxKeys: 16})
+	for i := range 1000 {
+		mustAllow(t, k, fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256))
+	}
+	if n := k.Len(); n > 16 {
+		t.Errorf("Len() = %d after 1000 distinct keys, want <= 16", n)
+	}
+}
+
+// TestKeyedIdleEviction 閒置的 key 只有在配額完全恢復後才被淘汰。
+func TestKeyedIdleEviction(t *testing.T) {
+	const idle = 20 * time.Millisecond
+
+	// 每秒恢復 1 個：閒置期過後配額仍未恢復，不能淘汰（否則等於免費送出一整桶）
+	slow := NewKeyed(func() *TokenBucket { return NewTokenBucket(2, 1) }, KeyedConfig{Shards: 1, IdleTimeout: idle})
+	exhaust(t, slow, "a", 2)
+	time.Sleep(2 * idle)
+	mustAllow(t, slow, "b") // 建立新 key 時檢查閒置淘汰
+	if slow.Len() != 2 {
+		t.Errorf("Len() = %d, want the drained key kept until its quota resets", slow.Len())
+	}
+	if d := mustAllow(t, slow, "a"); d.Allowed {
+		t.Errorf("a allowed after idle timeout, want its drained bucket kept: %+v", d)
+	}
+
+	// 每秒恢復 1000 個：閒置期過後配額已恢復，可以淘汰
+	fast := NewKeyed(func() *TokenBucket { return NewTokenBucket(2, 1000) }, KeyedConfig{Shards: 1, IdleTimeout: idle})
+	exhaust(t, fast, "a", 2)
+	time.Sleep(2 * idle)
+	mustAllow(t, fast, "b")
+	if fast.Len() != 1 {
+		t.Errorf("Len() = %d, want the idle, fully reset key evicted", fast.Len())
+	}
+}
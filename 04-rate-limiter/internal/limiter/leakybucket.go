@@ -1,6 +1,7 @@
 package limiter
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -8,9 +9,9 @@ import (
 // LeakyBucket 實作漏桶演算法。
 //
 // 演算法原理：
-//   1. 固定容量的桶，請求進入桶中排隊
-//   2. 桶以固定速率漏出請求（處理請求）
-//   3. 桶滿時拒絕新請求
+//  1. 固定容量的桶，請求進入桶中排隊
+//  2. 桶以固定速率漏出請求（處理請求）
+//  3. 桶滿時拒絕新請求
 //
 // 與 Token Bucket 的差異：
 //   - Token Bucket: 令牌以固定速率產生，請求消耗令牌
@@ -29,18 +30,19 @@ import (
 //   - 保護脆弱的下游服務
 //   - 訊息佇列消費限流
 type LeakyBucket struct {
-	capacity  int64         // 桶容量（最多排隊多少請求）
-	water     int64         // 當前桶中的水量（排隊的請求數）
-	leakRate  int64         // 漏出速率（每秒處理多少請求）
-	lastLeak  time.Time     // 上次漏水時間
-	mu        sync.Mutex
+	capacity int64     // 桶容量（最多排隊多少請求）
+	water    int64     // 當前桶中的水量（排隊的請求數）
+	leakRate int64     // 漏出速率（每秒處理多少請求）
+	lastLeak time.Time // 上次漏水時間
+	mu       sync.Mutex
 }
 
 // NewLeakyBucket 建立新的漏桶限流器。
 //
 // 參數：
-//   capacity: 桶容量，決定最大排隊數
-//   leakRate: 漏出速率，決定處理速率（QPS）
+//
+//	capacity: 桶容量，決定最大排隊數
+//	leakRate: 漏出速率，決定處理速率（QPS）
 //
 // 設計選擇：
 //   - 與 Token Bucket 參數類似，但語意不同
@@ -49,45 +51,72 @@ type LeakyBucket struct {
 func NewLeakyBucket(capacity, leakRate int64) *LeakyBucket {
 	return &LeakyBucket{
 		capacity: capacity,
-		water:    0,  // 初始化時桶是空的
+		water:    0, // 初始化時桶是空的
 		leakRate: leakRate,
 		lastLeak: time.Now(),
 	}
 }
 
-// Allow 檢查是否允許請求通過。
+// Allow 檢查是否允許請求通過（key 被忽略，實例本身就是一個桶）。
+func (lb *LeakyBucket) Allow(ctx context.Context, key string) (Decision, error) {
+	return lb.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否可以一次加入 n 單位的水。
 //
 // 執行流程：
-//   1. 計算距離上次漏水的時間
-//   2. 根據時間和速率，計算已漏出的水量
-//   3. 更新桶中水量
-//   4. 檢查是否還有空間接受新請求
+//  1. 計算距離上次漏水的時間
+//  2. 根據時間和速率，計算已漏出的水量
+//  3. 更新桶中水量
+//  4. 剩餘空間足夠 n 單位才加入，否則一滴都不加
+//  5. 根據水量與漏水進度計算重置與重試時間
 //
 // 實作細節：
 //   - 使用 "懶惰計算" 模式，只在需要時計算漏水
 //   - 避免使用背景 goroutine（節省資源）
-func (lb *LeakyBucket) Allow() bool {
+//   - lastLeak 只前進「已漏出」的時間，零頭保留到下次（同 TokenBucket.refill）
+func (lb *LeakyBucket) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
 	// 計算已漏出的水量
 	now := time.Now()
+	if lb.water == 0 {
+		lb.lastLeak = now
+	}
 	elapsed := now.Sub(lb.lastLeak)
 	leaked := int64(elapsed.Seconds() * float64(lb.leakRate))
 
 	if leaked > 0 {
 		// 減少水量（但不能為負）
-		lb.water = max(0, lb.water-leaked)
-		lb.lastLeak = now
+		if leaked >= lb.water {
+			lb.water = 0
+			lb.lastLeak = now
+		} else {
+			lb.water -= leaked
+			lb.lastLeak = lb.lastLeak.Add(time.Duration(leaked) * interval(lb.leakRate))
+		}
 	}
 
 	// 檢查是否有空間
-	if lb.water < lb.capacity {
-		lb.water++
-		return true
+	d := Decision{Limit: lb.capacity}
+	if validN(n, lb.capacity) && n <= lb.capacity-lb.water {
+		lb.water += n
+		d.Allowed = true
 	}
+	d.Remaining = lb.capacity - lb.water
 
-	return false
+	// 下一滴漏出後騰出一個空間，再漏出 n-1 滴後容得下本次請求；全部漏完後配額完全恢復
+	if lb.water > 0 {
+		step := interval(lb.leakRate)
+		next := step - now.Sub(lb.lastLeak)
+		d.ResetAfter = next + time.Duration(lb.water-1)*step
+		if !d.Allowed && validN(n, lb.capacity) {
+			d.RetryAfter = next + time.Duration(lb.water+n-lb.capacity-1)*step
+		}
+	}
+
+	return d, nil
 }
 
 // Water 返回當前水量（用於監控）。
@@ -96,10 +125,3 @@ func (lb *LeakyBucket) Water() int64 {
 	defer lb.mu.Unlock()
 	return lb.water
 }
-
-func max(a, b int64) int64 {
-	if a > b {
-		return a
-	}
-	return b
-}
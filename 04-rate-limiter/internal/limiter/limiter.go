@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limiter 統一的限流器介面。
+//
+// 所有演算法（單機與分散式）都實作此介面，
+// 中介軟體只依賴介面，切換演算法不需要修改呼叫方。
+//
+// 參數 key 為限流維度（如 "ip:1.2.3.4"）：
+//   - 分散式限流器：每個 key 對應 Redis 中獨立的狀態
+//   - 單機限流器：實例本身就是一個桶，key 被忽略
+//
+// 加權成本（AllowN）：
+//   - 不同操作的成本不同（如搜尋 10 單位、讀取 1 單位），一次消耗 n 個單位
+//   - 全有或全無：配額不足 n 時不消耗任何配額
+//   - n 必須在 1 到上限之間，否則拒絕且 RetryAfter 為 0（永遠無法滿足）：
+//     負數會反向增加配額，過大的 n 會讓「已用 + n」溢位成負數而通過檢查；
+//     成本為 0 的請求不需要限流，由呼叫方略過（見 middleware.CostFunc）
+//   - Allow 等同於 AllowN(ctx, key, 1)
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Decision, error)
+	AllowN(ctx context.Context, key string, n int64) (Decision, error)
+}
+
+// Decision 一次限流判定的結果。
+//
+// 為何不只返回 bool？
+//   - 客戶端需要知道還剩多少配額、何時可以重試
+//   - 沒有這些資訊，客戶端只能盲目重試，反而加重負載
+//   - 中介軟體據此輸出 RateLimit-* 與 Retry-After 標頭
+//
+// 為何用 Duration 而非絕對時間？
+//   - HTTP 標頭使用相對秒數（delta-seconds）
+//   - 分散式場景下各實例時鐘不一致，相對時間不受時鐘偏差影響
+type Decision struct {
+	Allowed    bool          // 是否允許請求
+	Limit      int64         // 配額上限（桶容量或視窗內最大請求數）
+	Remaining  int64         // 本次判定後剩餘的配額
+	ResetAfter time.Duration // 配額完全恢復（Remaining 回到 Limit）所需時間
+	RetryAfter time.Duration // 被拒絕時，最早可重試的等待時間（允許時為 0）
+}
+
+// Seconds 將時間長度無條件進位為秒數（HTTP 標頭使用整數秒）。
+//
+// 為何進位而非捨去？
+//   - 捨去會讓客戶端提早重試，再次被拒絕
+func Seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// interval 每產生（或消耗）一個單位所需時間。
+//
+// 速率為 0 時返回 0，呼叫方需自行處理「永不恢復」的情況
+//
+// 速率超過 MaxRate 時整數除法會截斷為 0（GCRA 以發射間隔作除數會除以零），
+// 因此至少返回 1 奈秒
+func interval(rate int64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return max(time.Second/time.Duration(rate), time.Nanosecond)
+}
+
+// validN n 是否為可能滿足的單位數（1 ≤ n ≤ limit）。
+//
+// 先檢查 n 的範圍，再以減法比較剩餘配額（n <= limit-used），避免 used+n 溢位
+func validN(n, limit int64) bool {
+	return n > 0 && n <= limit
+}
+
+// MaxRate 每秒速率上限：time.Duration 的解析度是奈秒，更高的速率無法表示發射間隔。
+const MaxRate = int64(time.Second)
+
+// 編譯期檢查：所有演算法都實作對應的介面
+var (
+	_ Limiter = (*TokenBucket)(nil)
+	_ Limiter = (*LeakyBucket)(nil)
+	_ Limiter = (*SlidingWindow)(nil)
+	_ Limiter = (*SlidingWindowCounter)(nil)
+	_ Limiter = (*GCRA)(nil)
+	_ Limiter = (*DistributedTokenBucket)(nil)
+	_ Limiter = (*DistributedSlidingWindow)(nil)
+	_ Limiter = (*DistributedGCRA)(nil)
+	_ Limiter = (*Keyed[*TokenBucket])(nil)
+	_ Limiter = (*Resilient)(nil)
+
+	_ MultiLimiter = (*DistributedMultiDimension)(nil)
+	_ MultiLimiter = (*ResilientMultiDimension)(nil)
+
+	_ ConcurrencyLimit = FixedLimit(0)
+	_ ConcurrencyLimit = (*AIMD)(nil)
+	_ ConcurrencyLimit = (*Gradient)(nil)
+)
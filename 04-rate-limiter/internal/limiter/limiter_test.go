@@ -0,0 +1,372 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+)
+
+// algorithm 測試與基準共用的演算法清單。
+//
+// 所有演算法以相同的方式建立：配額 limit，約 period 完全恢復
+// 單機版以 Keyed 包裝（與實際部署相同，且 key 的語意與分散式版本一致）
+type algorithm struct {
+	name  string
+	local bool
+	new   func(tb testing.TB, limit int64, period time.Duration) Limiter
+}
+
+var algorithms = []algorithm{
+	{"TokenBucket", true, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		rate := perSecond(limit, period)
+		return NewKeyed(func() *TokenBucket { return NewTokenBucket(limit, rate) }, KeyedConfig{})
+	}},
+	{"LeakyBucket", true, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		rate := perSecond(limit, period)
+		return NewKeyed(func() *LeakyBucket { return NewLeakyBucket(limit, rate) }, KeyedConfig{})
+	}},
+	{"SlidingWindow", true, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		return NewKeyed(func() *SlidingWindow { return NewSlidingWindow(limit, period) }, KeyedConfig{})
+	}},
+	{"SlidingWindowCounter", true, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		// 分桶以整秒計算：2 個桶，視窗至少 2 秒
+		window := max(period, 2*time.Second)
+		return NewKeyed(func() *SlidingWindowCounter { return NewSlidingWindowCounter(limit, window, 2) }, KeyedConfig{})
+	}},
+	{"GCRA", true, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		rate := perSecond(limit, period)
+		return NewKeyed(func() *GCRA { return NewGCRA(limit, rate) }, KeyedConfig{})
+	}},
+	{"DistributedTokenBucket", false, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		return NewDistributedTokenBucket(newRedis(tb), limit, perSecond(limit, period))
+	}},
+	{"DistributedSlidingWindow", false, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		return NewDistributedSlidingWindow(newRedis(tb), limit, period)
+	}},
+	{"DistributedGCRA", false, func(tb testing.TB, limit int64, period time.Duration) Limiter {
+		return NewDistributedGCRA(newRedis(tb), limit, perSecond(limit, period))
+	}},
+}
+
+// perSecond 換算每秒速率（period 內恢復 limit 個配額）。
+func perSecond(limit int64, period time.Duration) int64 {
+	return max(1, int64(time.Duration(limit)*time.Second/period))
+}
+
+// newRedis 啟動記憶體中的 Redis（miniredis 支援 Lua 腳本），測試結束時關閉。
+func newRedis(tb testing.TB) *redis.Client {
+	s := miniredis.RunT(tb)
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+		// miniredis 不支援 CLIENT MAINT_NOTIFICATIONS，關閉以免握手時輸出警告
+		MaintNotificationsConfig: &maintnotifications.Config{Mode: maintnotifications.ModeDisabled},
+	})
+	tb.Cleanup(func() { client.Close() })
+	return client
+}
+
+func mustAllow(t *testing.T, l Limiter, key string) Decision {
+	t.Helper()
+	d, err := l.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Allow(%q) error: %v", key, err)
+	}
+	return d
+}
+
+// exhaust 用完 key 的配額，返回第一次被拒絕的判定。
+func exhaust(t *testing.T, l Limiter, key string, limit int64) Decision {
+	t.Helper()
+	for i := range limit {
+		if d := mustAllow(t, l, key); !d.Allowed {
+			t.Fatalf("request %d denied before reaching limit %d: %+v", i, limit, d)
+		}
+	}
+	d := mustAllow(t, l, key)
+	if d.Allowed {
+		t.Fatalf("request %d allowed beyond limit: %+v", limit, d)
+	}
+	return d
+}
+
+func TestBurst(t *testing.T) {
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			t.Parallel()
+			l := a.new(t, 5, 250*time.Millisecond)
+
+			for i := range int64(5) {
+				d := mustAllow(t, l, "k")
+				if !d.Allowed {
+					t.Fatalf("request %d denied: %+v", i, d)
+				}
+				if d.Limit != 5 || d.Remaining != 4-i {
+					t.Errorf("request %d: Limit=%d Remaining=%d, want 5 and %d", i, d.Limit, d.Remaining, 4-i)
+				}
+				if d.RetryAfter != 0 || d.ResetAfter <= 0 {
+					t.Errorf("request %d: RetryAfter=%v ResetAfter=%v", i, d.RetryAfter, d.ResetAfter)
+				}
+			}
+
+			d := mustAllow(t, l, "k")
+			if d.Allowed || d.Remaining != 0 {
+				t.Fatalf("request beyond limit: %+v", d)
+			}
+			if d.RetryAfter <= 0 || d.RetryAfter > d.ResetAfter {
+				t.Errorf("denied: want 0 < RetryAfter (%v) <= ResetAfter (%v)", d.RetryAfter, d.ResetAfter)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			t.Parallel()
+			l := a.new(t, 5, 250*time.Millisecond)
+
+			d := exhaust(t, l, "k", 5)
+			time.Sleep(d.RetryAfter + 20*time.Millisecond)
+			if d := mustAllow(t, l, "k"); !d.Allowed {
+				t.Fatalf("denied after waiting RetryAfter (%v): %+v", d.RetryAfter, d)
+			}
+		})
+	}
+}
+
+func TestResetAfter(t *testing.T) {
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			t.Parallel()
+			l := a.new(t, 5, 250*time.Millisecond)
+
+			d := exhaust(t, l, "k", 5)
+			time.Sleep(d.ResetAfter + 20*time.Millisecond)
+			exhaust(t, l, "k", 5)
+		})
+	}
+}
+
+func TestKeysAreIndependent(t *testing.T) {
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			t.Parallel()
+			l := a.new(t, 3, time.Minute)
+
+			exhaust(t, l, "a", 3)
+			if d := mustAllow(t, l, "b"); !d.Allowed || d.Remaining != 2 {
+				t.Fatalf("key b affected by key a: %+v", d)
+			}
+		})
+	}
+}
+
+func TestConcurrentAllowNeverExceedsLimit(t *testing.T) {
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			t.Parallel()
+			l := a.new(t, 20, 20*time.Second)
+
+			var allowed atomic.Int64
+			var wg sync.WaitGroup
+			for range 100 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					d, err := l.Allow(context.Background(), "k")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if d.Allowed {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := allowed.Load(); got != 20 {
+				t.Fatalf("allowed %d of 100 concurrent requests, want 20", got)
+			}
+		})
+	}
+}
+
+func TestAllowN(t *testing.T) {
+	ctx := context.Background()
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			t.Parallel()
+			l := a.new(t, 10, time.Minute)
+
+			d, err := l.AllowN(ctx, "k", 4)
+			if err != nil || !d.Allowed || d.Remaining != 6 {
+				t.Fatalf("AllowN(4) = %+v, %v; want allowed with 6 remaining", d, err)
+			}
+
+			// 配額不足時全有或全無：不消耗任何單位
+			d, err = l.AllowN(ctx, "k", 7)
+			if err != nil || d.Allowed || d.Remaining != 6 || d.RetryAfter <= 0 {
+				t.Fatalf("AllowN(7) = %+v, %v; want denied with 6 remaining and a retry time", d, err)
+			}
+
+			d, err = l.AllowN(ctx, "k", 6)
+			if err != nil || !d.Allowed || d.Remaining != 0 {
+				t.Fatalf("AllowN(6) = %+v, %v; want allowed with 0 remaining", d, err)
+			}
+
+			// 超過上限的成本永遠無法滿足
+			d, err = l.AllowN(ctx, "k", 11)
+			if err != nil || d.Allowed || d.RetryAfter != 0 {
+				t.Fatalf("AllowN(11) = %+v, %v; want denied without retry time", d, err)
+			}
+		})
+	}
+}
+
+// TestAllowNOutOfRange n 不在 1 到上限之間時拒絕，且不改變狀態。
+//
+// 負數會反向增加配額，math.MaxInt64 會讓「已用 + n」溢位成負數而通過檢查
+func TestAllowNOutOfRange(t *testing.T) {
+	ctx := context.Background()
+	for _, a := range algorithms {
+		t.Run(a.name, func(t *testing.T) {
+			t.Parallel()
+			l := a.new(t, 10, time.Minute)
+			mustAllow(t, l, "k")
+
+			for _, n := range []int64{0, -5, 11, math.MaxInt64} {
+				d, err := l.AllowN(ctx, "k", n)
+				if err != nil || d.Allowed || d.RetryAfter != 0 {
+					t.Fatalf("AllowN(%d) = %+v, %v; want denied without retry time", n, d, err)
+				}
+			}
+
+			// 狀態不變：剩下的 9 個單位剛好可以一次用完
+			d, err := l.AllowN(ctx, "k", 9)
+			if err != nil || !d.Allowed || d.Remaining != 0 {
+				t.Fatalf("AllowN(9) = %+v, %v; want allowed with 0 remaining", d, err)
+			}
+			if d, _ := l.Allow(ctx, "k"); d.Allowed {
+				t.Errorf("Allow after the quota is used = %+v, want denied", d)
+			}
+		})
+	}
+}
+
+// TestGCRARetryAfterIsExact GCRA 的重試時間恰好是一個發射間隔（不受令牌零頭影響）。
+func TestGCRARetryAfterIsExact(t *testing.T) {
+	g := NewGCRA(1, 10) // 每 100ms 一個
+	ctx := context.Background()
+
+	if d, _ := g.Allow(ctx, ""); !d.Allowed {
+		t.Fatalf("first request denied: %+v", d)
+	}
+	d, _ := g.Allow(ctx, "")
+	if d.Allowed {
+		t.Fatalf("second request allowed: %+v", d)
+	}
+	if d.RetryAfter <= 90*time.Millisecond || d.RetryAfter > 100*time.Millisecond {
+		t.Fatalf("RetryAfter = %v, want just under 100ms", d.RetryAfter)
+	}
+}
+
+// TestGCRAHugeRate 速率超過每秒 1e9 時發射間隔不會截斷為 0（否則計算剩餘配額時除以零）。
+func TestGCRAHugeRate(t *testing.T) {
+	g := NewGCRA(5, 2*MaxRate)
+	ctx := context.Background()
+
+	for i := range 5 {
+		d, err := g.Allow(ctx, "")
+		if err != nil || !d.Allowed {
+			t.Fatalf("request %d = %+v, %v, want allowed", i, d, err)
+		}
+		if d.Remaining < 0 || d.Remaining > 5 {
+			t.Fatalf("request %d: Remaining = %d, want within [0, 5]", i, d.Remaining)
+		}
+	}
+}
+
+// BenchmarkAllow 單一 key 的判定延遲。
+//
+// 配額 1000、每秒恢復 1000：基準迴圈遠快於恢復速度，混合了允許與拒絕
+// Distributed* 使用 miniredis，反映腳本與指令數的相對成本，而非真實網路延遲
+func BenchmarkAllow(b *testing.B) {
+	ctx := context.Background()
+	for _, a := range algorithms {
+		b.Run(a.name, func(b *testing.B) {
+			l := a.new(b, 1000, time.Second)
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := l.Allow(ctx, "k"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAllowParallel 多個 goroutine、各自不同 key 的判定延遲（Keyed 分片的效果）。
+func BenchmarkAllowParallel(b *testing.B) {
+	ctx := context.Background()
+	for _, a := range algorithms {
+		if !a.local {
+			continue
+		}
+		b.Run(a.name, func(b *testing.B) {
+			l := a.new(b, 1000, time.Second)
+			var id atomic.Int64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				key := fmt.Sprintf("k%d", id.Add(1))
+				for pb.Next() {
+					if _, err := l.Allow(ctx, key); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMemoryPerKey 每個 key 的常駐記憶體（含 Keyed 的索引開銷）。
+//
+// 每個 key 只請求一次：SlidingWindow 的記憶體隨視窗內請求數成長，實際會更多
+func BenchmarkMemoryPerKey(b *testing.B) {
+	const keys = 10_000
+	ctx := context.Background()
+	for _, a := range algorithms {
+		if !a.local {
+			continue
+		}
+		b.Run(a.name, func(b *testing.B) {
+			var perKey float64
+			for b.Loop() {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				l := a.new(b, 100, time.Second)
+				for i := range keys {
+					l.Allow(ctx, fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256))
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				perKey = float64(after.HeapAlloc-before.HeapAlloc) / keys
+				runtime.KeepAlive(l)
+			}
+			b.ReportMetric(perKey, "B/key")
+		})
+	}
+}
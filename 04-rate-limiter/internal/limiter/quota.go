@@ -0,0 +1,239 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 配額週期
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// QuotaLimits 一個方案的長週期配額（0 表示該週期不限）。
+type QuotaLimits struct {
+	Daily   int64
+	Monthly int64
+}
+
+// QuotaDecision 配額判定結果。
+//
+//   - 拒絕時：Decision 為用完的週期的判定，Period 為其名稱
+//   - 允許時：Decision 為剩餘比例較少（較接近用完）的週期
+//
+// ResetAfter 與 RetryAfter 都是週期結束的時間：配額在週期邊界一次歸零，而非逐步恢復
+type QuotaDecision struct {
+	Decision
+	Period string
+}
+
+// QuotaUsage 一個週期的用量（用量查詢接口的回應）。
+type QuotaUsage struct {
+	Period    string    `json:"period"`
+	Used      int64     `json:"used"`
+	Limit     int64     `json:"limit"` // 0 表示本週期尚未有請求（還不知道適用哪個方案）
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// Quota 長週期配額（每日 / 每月），用於按用量計費的 API。
+//
+// 與限流的差異：
+//   - 限流保護系統：秒級、平滑恢復（令牌桶、滑動視窗）
+//   - 配額對應商業方案：日 / 月級、週期邊界一次歸零（免費方案每日 1000 次）
+//
+// 實作策略：
+//
+//	每個 key、每個週期一個 Redis Hash：
+//	  quota:{key}:daily:20261018  → used、limit
+//	  quota:{key}:monthly:202610  → used、limit
+//
+//	為何 key 中帶有日期？
+//	  - 週期切換時自然換到新 key，不需要定時任務歸零
+//	  - 舊 key 以 EXPIREAT 在週期結束後自動刪除
+//
+//	為何儲存 limit？
+//	  - 用量查詢接口不經過策略匹配，無從得知請求適用哪個方案
+//	  - 記錄最近一次檢查時的上限（包含被拒絕的請求），查詢時直接返回「已用 / 上限」
+//
+// 週期以 UTC 計算：所有節點、所有時區的客戶看到同一個邊界
+type Quota struct {
+	client *redis.Client
+	script *redis.Script
+}
+
+// Lua 腳本：多週期配額
+//
+// KEYS[1], KEYS[2]: 每日、每月的 Hash（同一個 hash tag，可在 Cluster 上執行）
+// ARGV[1]: 本次消耗的單位數
+// ARGV[2], ARGV[3]: 每日上限、每日 key 的過期時間（Unix 秒）
+// ARGV[4], ARGV[5]: 每月上限、每月 key 的過期時間（Unix 秒）
+// 上限為 0 的週期不檢查、不寫入
+// 被拒絕時也更新上限：換方案後第一個請求就被拒絕，用量查詢仍顯示新方案的上限
+//
+// 返回值（陣列）：
+//
+//	[1] 1 允許 / 0 拒絕
+//	[2] 拒絕的週期下標（1 每日 / 2 每月；允許時為 0）
+//	[3], [4] 每日、每月的已用量（拒絕時為扣除前的值；未檢查的週期為 0）
+//
+// 與多維度限流相同的兩階段：全部週期都足夠才扣除
+var quotaScript = `
+local cost = tonumber(ARGV[1])
+local used = {0, 0}
+local rejected = 0
+
+-- 第一階段：讀取用量、記錄上限，不扣除
+for i = 1, 2 do
+    local limit = tonumber(ARGV[2 * i])
+    if limit > 0 then
+        used[i] = tonumber(redis.call('HGET', KEYS[i], 'used')) or 0
+        redis.call('HSET', KEYS[i], 'limit', limit)
+        redis.call('EXPIREAT', KEYS[i], tonumber(ARGV[2 * i + 1]))
+        if rejected == 0 and used[i] + cost > limit then
+            rejected = i
+        end
+    end
+end
+
+if rejected > 0 then
+    return {0, rejected, used[1], used[2]}
+end
+
+-- 第二階段：所有週期一起扣除
+for i = 1, 2 do
+    if tonumber(ARGV[2 * i]) > 0 then
+        used[i] = redis.call('HINCRBY', KEYS[i], 'used', cost)
+    end
+end
+
+return {1, 0, used[1], used[2]}
+`
+
+// NewQuota 建立長週期配額。
+func NewQuota(client *redis.Client) *Quota {
+	return &Quota{
+		client: client,
+		script: redis.NewScript(quotaScript),
+	}
+}
+
+// AllowN 檢查並扣除 key（通常是 API Key）的每日與每月配額。
+//
+// 參數：
+//
+//	ctx: 上下文
+//	key: 配額歸屬（如 API Key）
+//	limits: 適用方案的上限（換方案時用量延續，只有上限改變）
+//	n: 本次消耗的單位數
+func (q *Quota) AllowN(ctx context.Context, key string, limits QuotaLimits, n int64) (QuotaDecision, error) {
+	now := time.Now().UTC()
+	dayEnd, monthEnd := periodEnds(now)
+
+	result, err := q.script.Run(ctx, q.client,
+		[]string{q.redisKey(key, PeriodDaily, now), q.redisKey(key, PeriodMonthly, now)},
+		n,
+		limits.Daily, expireAt(dayEnd),
+		limits.Monthly, expireAt(monthEnd),
+	).Int64Slice()
+	if err != nil {
+		return QuotaDecision{Decision: Decision{Allowed: true}}, fmt.Errorf("redis error: %w", err)
+	}
+	if len(result) != 4 {
+		return QuotaDecision{Decision: Decision{Allowed: true}}, fmt.Errorf("unexpected script result: %v", result)
+	}
+
+	daily := quotaDecision(PeriodDaily, limits.Daily, result[2], dayEnd.Sub(now))
+	monthly := quotaDecision(PeriodMonthly, limits.Monthly, result[3], monthEnd.Sub(now))
+
+	switch {
+	case result[0] == 0 && result[1] == 1:
+		daily.Allowed, daily.RetryAfter = false, daily.ResetAfter
+		return daily, nil
+	case result[0] == 0:
+		monthly.Allowed, monthly.RetryAfter = false, monthly.ResetAfter
+		return monthly, nil
+	case limits.Monthly == 0:
+		return daily, nil
+	case limits.Daily == 0:
+		return monthly, nil
+	}
+
+	// 兩個週期都有上限：返回剩餘比例較少的週期
+	if float64(daily.Remaining)/float64(daily.Limit) <= float64(monthly.Remaining)/float64(monthly.Limit) {
+		return daily, nil
+	}
+	return monthly, nil
+}
+
+// Usage 查詢 key 在當前每日與每月週期的用量。
+func (q *Quota) Usage(ctx context.Context, key string) ([]QuotaUsage, error) {
+	now := time.Now().UTC()
+	dayEnd, monthEnd := periodEnds(now)
+
+	pipe := q.client.Pipeline()
+	daily := pipe.HMGet(ctx, q.redisKey(key, PeriodDaily, now), "used", "limit")
+	monthly := pipe.HMGet(ctx, q.redisKey(key, PeriodMonthly, now), "used", "limit")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("redis error: %w", err)
+	}
+
+	return []QuotaUsage{
+		quotaUsage(PeriodDaily, daily.Val(), dayEnd),
+		quotaUsage(PeriodMonthly, monthly.Val(), monthEnd),
+	}, nil
+}
+
+// redisKey 組出帶 hash tag 的 key：quota:{key}:週期:日期
+func (q *Quota) redisKey(key, period string, now time.Time) string {
+	layout := "20060102"
+	if period == PeriodMonthly {
+		layout = "200601"
+	}
+	return "quota:{" + key + "}:" + period + ":" + now.Format(layout)
+}
+
+// periodEnds 返回當前每日與每月週期的結束時間（UTC）。
+func periodEnds(now time.Time) (day, month time.Time) {
+	y, m, d := now.Date()
+	day = time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+	month = time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+	return day, month
+}
+
+// expireAt 週期 key 的過期時間：週期結束後再保留一小時
+//
+// 各節點時鐘不完全一致，時鐘較慢的節點在邊界之後仍會寫入舊週期的 key；
+// 沒有緩衝時 EXPIREAT 的時間已經過去，key 會被立即刪除，剛扣除的用量也一起消失
+func expireAt(end time.Time) int64 {
+	return end.Add(time.Hour).Unix()
+}
+
+func quotaDecision(period string, limit, used int64, resetAfter time.Duration) QuotaDecision {
+	return QuotaDecision{
+		Decision: Decision{
+			Allowed:    true,
+			Limit:      limit,
+			Remaining:  max(0, limit-used),
+			ResetAfter: resetAfter,
+		},
+		Period: period,
+	}
+}
+
+func quotaUsage(period string, vals []any, resetAt time.Time) QuotaUsage {
+	u := QuotaUsage{Period: period, ResetAt: resetAt}
+	if s, ok := vals[0].(string); ok {
+		u.Used, _ = strconv.ParseInt(s, 10, 64)
+	}
+	if s, ok := vals[1].(string); ok {
+		u.Limit, _ = strconv.ParseInt(s, 10, 64)
+		u.Remaining = max(0, u.Limit-u.Used)
+	}
+	return u
+}
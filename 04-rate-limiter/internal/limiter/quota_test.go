@@ -0,0 +1,47 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	q := NewQuota(newRedis(t))
+	limits := QuotaLimits{Daily: 10, Monthly: 15}
+
+	d, err := q.AllowN(ctx, "key", limits, 8)
+	if err != nil || !d.Allowed || d.Period != PeriodDaily || d.Remaining != 2 {
+		t.Fatalf("AllowN(8) = %+v, %v; want allowed, daily with 2 remaining", d, err)
+	}
+
+	// 每日不足：拒絕，且每月也不扣除
+	d, err = q.AllowN(ctx, "key", limits, 3)
+	if err != nil || d.Allowed || d.Period != PeriodDaily || d.RetryAfter <= 0 {
+		t.Fatalf("AllowN(3) = %+v, %v; want denied by daily quota", d, err)
+	}
+
+	// 換方案（每日上限提高）：用量延續，改由每月上限拒絕
+	limits.Daily = 100
+	d, err = q.AllowN(ctx, "key", limits, 8)
+	if err != nil || d.Allowed || d.Period != PeriodMonthly || d.Remaining != 7 {
+		t.Fatalf("AllowN(8) after upgrade = %+v, %v; want denied by monthly quota with 7 remaining", d, err)
+	}
+
+	usage, err := q.Usage(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int64{PeriodDaily: {8, 100}, PeriodMonthly: {8, 15}}
+	for _, u := range usage {
+		if w := want[u.Period]; u.Used != w[0] || u.Limit != w[1] {
+			t.Errorf("%s usage = %d/%d, want %d/%d", u.Period, u.Used, u.Limit, w[0], w[1])
+		}
+	}
+
+	// 其他 key 不受影響，沒有用量的 key 不知道上限
+	usage, err = q.Usage(ctx, "other")
+	if err != nil || usage[0].Used != 0 || usage[0].Limit != 0 {
+		t.Fatalf("Usage(other) = %+v, %v", usage, err)
+	}
+}
@@ -0,0 +1,374 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen 熔斷器開啟，沒有呼叫 Redis（fail-open 模式下返回，呼叫方應放行請求）
+var ErrCircuitOpen = errors.New("rate limiter circuit open")
+
+// FailureMode Redis 不可用時的處理方式。
+//
+// Trade-off：
+//   - FailOpen：可用性優先，但 Redis 故障期間完全沒有保護（惡意流量直接打到後端）
+//   - FailClosed：保護優先，但 Redis 故障等於整個服務不可用
+//   - FailLocal：折衷，各節點用本地限流器頂替，總配額按節點數平分（近似值）
+type FailureMode string
+
+const (
+	FailOpen   FailureMode = "open"   // 放行所有請求
+	FailClosed FailureMode = "closed" // 拒絕所有請求
+	FailLocal  FailureMode = "local"  // 改用本地限流器
+)
+
+// BreakerConfig 熔斷器設定（零值使用預設值）。
+type BreakerConfig struct {
+	FailureThreshold int           // 連續失敗多少次後開啟（預設 5）
+	SuccessThreshold int           // 開啟後連續探測成功多少次才關閉（預設 3）
+	ProbeInterval    time.Duration // 開啟期間的探測間隔（預設 2 秒）
+	ProbeTimeout     time.Duration // 單次探測逾時（預設 100ms）
+
+	// OnError 每次 Redis 呼叫失敗時呼叫（用於監控，可為 nil）
+	// 熔斷開啟後不再呼叫 Redis，也就不再觸發
+	OnError func(err error)
+}
+
+// CircuitBreaker Redis 限流器的熔斷器。
+//
+// 為何需要熔斷？
+//   - Redis 故障時，每個請求都要等到逾時（如 100ms）才知道失敗
+//   - 大量請求同時卡在逾時上，連線池耗盡，故障擴散到整個服務
+//   - 熔斷後直接走降級路徑，不再呼叫 Redis
+//
+// 狀態：
+//   - 關閉（closed）：正常呼叫 Redis，統計連續失敗次數
+//   - 開啟（open）：不呼叫 Redis，背景定期探測（PING）
+//   - 探測連續成功達到門檻後關閉
+//
+// 為何用背景探測而非放行一個真實請求（half-open）？
+//   - 探測失敗不會讓真實請求付出逾時的代價
+//   - 連續多次成功才恢復，避免 Redis 抖動時反覆開關
+//
+// 同一個 Redis 的所有限流器應共用一個熔斷器：故障是 Redis 層級的
+type CircuitBreaker struct {
+	probe func(ctx context.Context) error
+	cfg   BreakerConfig
+
+	mu        sync.Mutex
+	open      bool
+	failures  int       // 關閉狀態下的連續失敗次數
+	successes int       // 開啟狀態下的連續探測成功次數
+	nextProbe time.Time // 下次探測時間
+	probing   bool      // 是否有探測正在進行
+}
+
+// NewCircuitBreaker 建立熔斷器。
+//
+// probe 為健康探測函數（如 Redis PING），見 RedisProbe
+func NewCircuitBreaker(probe func(ctx context.Context) error, cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = 3
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 2 * time.Second
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = 100 * time.Millisecond
+	}
+	return &CircuitBreaker{probe: probe, cfg: cfg}
+}
+
+// RedisProbe 以 PING 作為健康探測。
+func RedisProbe(client *redis.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// Ready 是否可以呼叫 Redis（熔斷器關閉）。
+//
+// 開啟狀態下，到了探測時間會啟動一個背景探測（同一時間最多一個）
+func (b *CircuitBreaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+	if !b.probing && !time.Now().Before(b.nextProbe) {
+		b.probing = true
+		go b.runProbe()
+	}
+	return false
+}
+
+// Record 記錄一次 Redis 呼叫的結果（只在 Ready 返回 true 後呼叫）。
+func (b *CircuitBreaker) Record(err error) {
+	if err != nil && b.cfg.OnError != nil {
+		b.cfg.OnError(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		return // 開啟前已經在途的呼叫，結果不影響探測
+	}
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.cfg.FailureThreshold {
+		b.open = true
+		b.successes = 0
+		b.nextProbe = time.Now().Add(b.cfg.ProbeInterval)
+	}
+}
+
+// Open 熔斷器是否開啟（用於監控）。
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// RetryAfter 開啟期間，距離下次探測的時間（fail-closed 模式的 Retry-After）。
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return max(b.cfg.ProbeInterval, time.Until(b.nextProbe))
+}
+
+func (b *CircuitBreaker) runProbe() {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.ProbeTimeout)
+	err := b.probe(ctx)
+	cancel()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.nextProbe = time.Now().Add(b.cfg.ProbeInterval)
+	if err != nil {
+		b.successes = 0
+		return
+	}
+
+	b.successes++
+	if b.successes >= b.cfg.SuccessThreshold {
+		b.open = false
+		b.failures = 0
+	}
+}
+
+// Resilient 為分散式限流器加上熔斷與降級。
+//
+// 執行流程：
+//  1. 熔斷器關閉：呼叫 Redis 限流器，記錄結果
+//  2. 熔斷器開啟，或本次呼叫失敗：依 FailureMode 處理
+type Resilient struct {
+	primary  Limiter
+	breaker  *CircuitBreaker
+	mode     FailureMode
+	fallback Limiter // FailLocal 模式的本地限流器
+}
+
+// NewResilient 建立帶熔斷的限流器。
+//
+// 參數：
+//
+//	primary: 分散式限流器
+//	breaker: 熔斷器（同一個 Redis 的限流器共用）
+//	mode: 降級方式
+//	fallback: 本地限流器（只有 FailLocal 使用，通常是按節點數平分配額的 Keyed）
+func NewResilient(primary Limiter, breaker *CircuitBreaker, mode FailureMode, fallback Limiter) *Resilient {
+	return &Resilient{primary: primary, breaker: breaker, mode: mode, fallback: fallback}
+}
+
+// Allow 檢查是否允許請求。
+func (r *Resilient) Allow(ctx context.Context, key string) (Decision, error) {
+	return r.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否允許消耗 n 個單位。
+func (r *Resilient) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
+	if r.breaker.Ready() {
+		d, err := r.primary.AllowN(ctx, key, n)
+		r.breaker.Record(err)
+		if err == nil {
+			return d, nil
+		}
+	}
+	return r.degrade(ctx, key, n)
+}
+
+func (r *Resilient) degrade(ctx context.Context, key string, n int64) (Decision, error) {
+	switch r.mode {
+	case FailClosed:
+		return Decision{RetryAfter: r.breaker.RetryAfter()}, nil
+	case FailLocal:
+		if r.fallback != nil {
+			return r.fallback.AllowN(ctx, key, n)
+		}
+	}
+	return Decision{Allowed: true}, ErrCircuitOpen
+}
+
+// MultiLimiter 多維度限流器介面（DistributedMultiDimension 與其熔斷包裝）。
+type MultiLimiter interface {
+	Allow(ctx context.Context, keys map[string]string) (MultiDecision, error)
+	AllowN(ctx context.Context, keys map[string]string, n int64) (MultiDecision, error)
+}
+
+// ResilientMultiDimension 為多維度限流器加上熔斷與降級。
+//
+// FailLocal 模式下，各維度改用各自的本地限流器依序檢查
+// （本地降級期間不保證全有或全無，配額本來就是近似值）
+type ResilientMultiDimension struct {
+	primary   MultiLimiter
+	breaker   *CircuitBreaker
+	mode      FailureMode
+	order     []string           // 維度檢查順序
+	fallbacks map[string]Limiter // 維度 → 本地限流器
+}
+
+// NewResilientMultiDimension 建立帶熔斷的多維度限流器。
+//
+// fallbacks 的維度依 order 順序檢查；order 中沒有本地限流器的維度在降級期間不限流
+func NewResilientMultiDimension(primary MultiLimiter, breaker *CircuitBreaker, mode FailureMode, order []string, fallbacks map[string]Limiter) *ResilientMultiDimension {
+	return &ResilientMultiDimension{primary: primary, breaker: breaker, mode: mode, order: order, fallbacks: fallbacks}
+}
+
+// Allow 檢查是否允許請求。
+func (r *ResilientMultiDimension) Allow(ctx context.Context, keys map[string]string) (MultiDecision, error) {
+	return r.AllowN(ctx, keys, 1)
+}
+
+// AllowN 檢查是否允許從所有維度各消耗 n 個單位。
+func (r *ResilientMultiDimension) AllowN(ctx context.Context, keys map[string]string, n int64) (MultiDecision, error) {
+	if r.breaker.Ready() {
+		d, err := r.primary.AllowN(ctx, keys, n)
+		r.breaker.Record(err)
+		if err == nil {
+			return d, nil
+		}
+	}
+
+	switch r.mode {
+	case FailClosed:
+		return MultiDecision{Decision: Decision{RetryAfter: r.breaker.RetryAfter()}}, nil
+	case FailLocal:
+		return r.local(ctx, keys, n)
+	}
+	return MultiDecision{Decision: Decision{Allowed: true}}, ErrCircuitOpen
+}
+
+// local 依序檢查各維度的本地限流器（與 middleware.MultiDimensionRateLimit 相同的語意）。
+func (r *ResilientMultiDimension) local(ctx context.Context, keys map[string]string, n int64) (MultiDecision, error) {
+	var tightest MultiDecision
+	checked := false
+	for _, name := range r.order {
+		l, ok := r.fallbacks[name]
+		key := keys[name]
+		if !ok || key == "" {
+			continue
+		}
+
+		d, err := l.AllowN(ctx, name+":"+key, n)
+		if err != nil {
+			continue
+		}
+		if !d.Allowed {
+			return MultiDecision{Decision: d, Dimension: name}, nil
+		}
+		if !checked || d.Remaining < tightest.Remaining {
+			tightest = MultiDecision{Decision: d, Dimension: name}
+			checked = true
+		}
+	}
+	tightest.Allowed = true
+	return tightest, nil
+}
+
+// NodeEstimator 估算叢集中的限流器節點數。
+//
+// 為何需要？
+//   - 降級為本地限流時，每個節點只能各自計數
+//   - 全域 1000 req/s，10 個節點各自 1000 → 實際 10000 req/s
+//   - 每個節點改用 1000 / 10 = 100，總量仍接近原本的限制
+//
+// 實作：Redis 正常時，各節點定期在 Sorted Set 中寫入心跳（score 為時間戳記），
+// 統計最近仍有心跳的節點數；Redis 故障時沿用最後一次的估算值
+type NodeEstimator struct {
+	client *redis.Client
+	key    string
+	id     string
+	count  atomic.Int64
+}
+
+// NewNodeEstimator 建立節點數估算器。
+//
+// initial 為尚未取得心跳資料前的估算值（如部署的副本數）
+func NewNodeEstimator(client *redis.Client, key string, initial int) *NodeEstimator {
+	n := &NodeEstimator{client: client, key: key, id: uuid.NewString()}
+	n.count.Store(int64(max(1, initial)))
+	return n
+}
+
+// Count 返回估算的節點數（至少為 1）。
+func (n *NodeEstimator) Count() int {
+	return int(n.count.Load())
+}
+
+// Run 定期寫入心跳並更新估算值（阻塞，直到 ctx 取消）。
+//
+// 超過 3 個間隔沒有心跳的節點視為已下線
+func (n *NodeEstimator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n.heartbeat(ctx, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (n *NodeEstimator) heartbeat(ctx context.Context, interval time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, interval)
+	defer cancel()
+
+	now := time.Now().UnixMilli()
+	expired := now - 3*interval.Milliseconds()
+
+	pipe := n.client.TxPipeline()
+	pipe.ZAdd(ctx, n.key, redis.Z{Score: float64(now), Member: n.id})
+	pipe.ZRemRangeByScore(ctx, n.key, "-inf", strconv.FormatInt(expired, 10))
+	card := pipe.ZCard(ctx, n.key)
+	pipe.PExpire(ctx, n.key, 3*interval)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return // Redis 故障：沿用最後的估算值
+	}
+	n.count.Store(max(1, card.Val()))
+}
+
+// Share 將全域配額按節點數平分（至少為 1，避免完全拒絕）。
+func Share(total int64, nodes int) int64 {
+	return max(1, total/int64(max(1, nodes)))
+}
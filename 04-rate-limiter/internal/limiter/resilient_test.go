@@ -0,0 +1,165 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errRedisDown = errors.New("redis down")
+
+// waitFor 輪詢直到 cond 成立，逾時則測試失敗。
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var probeErr atomic.Pointer[error]
+	probeErr.Store(&errRedisDown)
+	var probes, reported atomic.Int64
+	b := NewCircuitBreaker(func(ctx context.Context) error {
+		probes.Add(1)
+		return *probeErr.Load()
+	}, BreakerConfig{
+		FailureThreshold: 3,
+		SuccessThreshold: 2,
+		ProbeInterval:    10 * time.Millisecond,
+		OnError:          func(error) { reported.Add(1) },
+	})
+
+	// 關閉：成功會重置連續失敗次數
+	for _, err := range []error{errRedisDown, errRedisDown, nil, errRedisDown, errRedisDown} {
+		if !b.Ready() {
+			t.Fatal("Ready() = false before reaching the failure threshold")
+		}
+		b.Record(err)
+	}
+	if b.Open() {
+		t.Fatal("breaker opened without 3 consecutive failures")
+	}
+
+	// 連續第 3 次失敗：開啟
+	b.Record(errRedisDown)
+	if !b.Open() || b.Ready() {
+		t.Fatal("breaker not open after 3 consecutive failures")
+	}
+	if got := reported.Load(); got != 5 {
+		t.Errorf("OnError called %d times, want 5", got)
+	}
+	if ra := b.RetryAfter(); ra <= 0 || ra > 10*time.Millisecond {
+		t.Errorf("RetryAfter() = %v, want the time until the next probe", ra)
+	}
+
+	// 開啟期間在途呼叫的結果不影響狀態
+	b.Record(nil)
+	if !b.Open() {
+		t.Fatal("in-flight success closed the breaker")
+	}
+
+	// 探測失敗：保持開啟
+	waitFor(t, "failed probes", func() bool { b.Ready(); return probes.Load() >= 3 })
+	if !b.Open() {
+		t.Fatal("breaker closed while probes fail")
+	}
+
+	// 探測連續成功 2 次：關閉
+	var ok error
+	probeErr.Store(&ok)
+	before := probes.Load()
+	waitFor(t, "breaker to close", func() bool { return b.Ready() })
+	if got := probes.Load() - before; got < 2 {
+		t.Errorf("breaker closed after %d successful probes, want 2", got)
+	}
+
+	// 關閉後失敗計數從零開始
+	b.Record(errRedisDown)
+	b.Record(errRedisDown)
+	if b.Open() {
+		t.Error("breaker reopened before reaching the failure threshold again")
+	}
+}
+
+// TestCircuitBreakerSingleProbe 開啟期間同一時間最多一個探測。
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	release := make(chan struct{})
+	var probes atomic.Int64
+	b := NewCircuitBreaker(func(ctx context.Context) error {
+		probes.Add(1)
+		<-release
+		return nil
+	}, BreakerConfig{FailureThreshold: 1, SuccessThreshold: 1, ProbeInterval: time.Millisecond, ProbeTimeout: time.Second})
+
+	b.Record(errRedisDown)
+	waitFor(t, "a probe to start", func() bool { b.Ready(); return probes.Load() > 0 })
+	for range 100 {
+		if b.Ready() {
+			t.Fatal("Ready() = true while the probe is in flight")
+		}
+	}
+	if got := probes.Load(); got != 1 {
+		t.Errorf("%d probes started, want 1", got)
+	}
+
+	close(release)
+	waitFor(t, "breaker to close", func() bool { return b.Ready() })
+}
+
+// failingLimiter 總是返回錯誤的限流器（模擬 Redis 故障），記錄呼叫次數。
+type failingLimiter struct{ calls atomic.Int64 }
+
+func (f *failingLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	return f.AllowN(ctx, key, 1)
+}
+
+func (f *failingLimiter) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
+	f.calls.Add(1)
+	return Decision{Allowed: true}, errRedisDown
+}
+
+func TestResilient(t *testing.T) {
+	tests := []struct {
+		mode        FailureMode
+		wantAllowed bool
+		wantErr     error
+	}{
+		{FailOpen, true, ErrCircuitOpen},
+		{FailClosed, false, nil},
+		{FailLocal, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			primary := &failingLimiter{}
+			breaker := NewCircuitBreaker(func(ctx context.Context) error { return errRedisDown }, BreakerConfig{FailureThreshold: 2, ProbeInterval: time.Hour})
+			fallback := NewKeyed(func() *TokenBucket { return NewTokenBucket(10, 1) }, KeyedConfig{})
+			r := NewResilient(primary, breaker, tt.mode, fallback)
+
+			for i := range 5 {
+				d, err := r.Allow(context.Background(), "k")
+				if d.Allowed != tt.wantAllowed || !errors.Is(err, tt.wantErr) {
+					t.Fatalf("request %d = %+v, %v, want allowed=%v err=%v", i, d, err, tt.wantAllowed, tt.wantErr)
+				}
+				if tt.mode == FailClosed && d.RetryAfter <= 0 {
+					t.Errorf("request %d: fail-closed RetryAfter = %v, want > 0", i, d.RetryAfter)
+				}
+				if tt.mode == FailLocal && d.Limit != 10 {
+					t.Errorf("request %d: Limit = %d, want the fallback limiter's decision", i, d.Limit)
+				}
+			}
+
+			// 熔斷開啟後不再呼叫 Redis
+			if got := primary.calls.Load(); got != 2 {
+				t.Errorf("primary called %d times, want 2 (until the breaker opens)", got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package limiter
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -8,24 +9,26 @@ import (
 // SlidingWindow 實作滑動視窗演算法。
 //
 // 演算法原理：
-//   1. 記錄每個請求的時間戳記
-//   2. 統計滑動視窗內的請求數
-//   3. 超過限制則拒絕請求
+//  1. 記錄每個請求的時間戳記
+//  2. 統計滑動視窗內的請求數
+//  3. 超過限制則拒絕請求
 //
 // 與固定視窗的差異：
 //   - 固定視窗：每分鐘重置計數器，存在邊界問題
 //   - 滑動視窗：視窗隨時間滑動，精確控制
 //
 // 邊界問題範例（固定視窗）：
-//   限制 100 req/min
-//   00:59 收到 100 個請求（允許）
-//   01:00 計數器重置
-//   01:01 收到 100 個請求（允許）
-//   結果：2 秒內處理 200 個請求（超過限制！）
+//
+//	限制 100 req/min
+//	00:59 收到 100 個請求（允許）
+//	01:00 計數器重置
+//	01:01 收到 100 個請求（允許）
+//	結果：2 秒內處理 200 個請求（超過限制！）
 //
 // 滑動視窗解決方案：
-//   任意 1 分鐘內最多 100 個請求
-//   從當前時間往回推 1 分鐘計算
+//
+//	任意 1 分鐘內最多 100 個請求
+//	從當前時間往回推 1 分鐘計算
 //
 // 優點：
 //   - 精確控制流量
@@ -40,22 +43,34 @@ import (
 //   - 需要精確限流
 //   - QPS 不是特別高的場景
 type SlidingWindow struct {
-	limit      int64           // 視窗內最大請求數
-	window     time.Duration   // 視窗大小
-	requests   []time.Time     // 請求時間記錄
-	mu         sync.Mutex
+	limit    int64         // 視窗內最大單位數
+	window   time.Duration // 視窗大小
+	requests []windowEntry // 請求記錄（按時間排序）
+	count    int64         // 視窗內的單位總數（requests 的 n 之和）
+	mu       sync.Mutex
+}
+
+// windowEntry 一次請求的記錄。
+//
+// 為何記錄 n 而非每個單位一筆？
+//   - 成本 100 的請求只佔一筆記錄，記憶體與清理成本和成本無關
+type windowEntry struct {
+	at time.Time
+	n  int64
 }
 
 // NewSlidingWindow 建立新的滑動視窗限流器。
 //
 // 參數：
-//   limit: 視窗內允許的最大請求數
-//   window: 視窗大小（如 1 分鐘、1 秒）
+//
+//	limit: 視窗內允許的最大請求數（加權時為單位數）
+//	window: 視窗大小（如 1 分鐘、1 秒）
 //
 // 記憶體估算：
-//   假設限制 1000 req/s，視窗 1 秒
-//   每個 time.Time 約 24 bytes
-//   記憶體占用：1000 * 24 = 24 KB
+//
+//	假設限制 1000 req/s，視窗 1 秒
+//	每筆記錄（time.Time + 單位數）約 32 bytes
+//	記憶體占用：1000 * 32 = 32 KB
 //
 // 優化建議：
 //   - 若 QPS 極高，考慮使用計數器 + 分段視窗
@@ -64,16 +79,22 @@ func NewSlidingWindow(limit int64, window time.Duration) *SlidingWindow {
 	return &SlidingWindow{
 		limit:    limit,
 		window:   window,
-		requests: make([]time.Time, 0, limit),
+		requests: make([]windowEntry, 0, limit),
 	}
 }
 
-// Allow 檢查是否允許請求通過。
+// Allow 檢查是否允許請求通過（key 被忽略，實例本身就是一個視窗）。
+func (sw *SlidingWindow) Allow(ctx context.Context, key string) (Decision, error) {
+	return sw.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否允許消耗 n 個單位。
 //
 // 執行流程：
-//   1. 清理過期請求（視窗外的請求）
-//   2. 檢查當前視窗內的請求數
-//   3. 未超過限制則記錄新請求
+//  1. 清理過期請求（視窗外的請求）
+//  2. 檢查當前視窗內的單位數
+//  3. 加上 n 不超過限制則記錄新請求
+//  4. 從最早的請求開始，滑出視窗的單位足夠容下 n 時可重試；最晚的請求滑出時配額完全恢復
 //
 // 時間複雜度：
 //   - 最壞情況：O(n)，需遍歷所有請求
@@ -82,7 +103,7 @@ func NewSlidingWindow(limit int64, window time.Duration) *SlidingWindow {
 // 優化策略：
 //   - 使用環形緩衝區避免頻繁記憶體分配
 //   - 使用二分搜尋加速過期請求清理
-func (sw *SlidingWindow) Allow() bool {
+func (sw *SlidingWindow) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
@@ -90,53 +111,65 @@ func (sw *SlidingWindow) Allow() bool {
 	windowStart := now.Add(-sw.window)
 
 	// 清理過期請求
-	// 實作說明：找到第一個未過期的請求位置
-	validIdx := -1  // -1 表示所有請求都過期
-	for i, reqTime := range sw.requests {
-		if reqTime.After(windowStart) {
-			validIdx = i
+	// 實作說明：找到第一個未過期的請求位置，同時扣除過期的單位數
+	expired := 0
+	for _, e := range sw.requests {
+		if e.at.After(windowStart) {
 			break
 		}
+		sw.count -= e.n
+		expired++
 	}
+	// 全部過期時 expired == len，結果為空 slice
+	sw.requests = sw.requests[expired:]
 
-	// 移除過期請求
-	// 修復：當所有請求都過期時（validIdx == -1），也要清空 slice
-	if validIdx == -1 {
-		// 所有請求都過期，清空 slice
-		sw.requests = sw.requests[:0]
-	} else if validIdx > 0 {
-		// 部分請求過期，保留未過期的部分
-		sw.requests = sw.requests[validIdx:]
+	// 檢查是否超過限制
+	d := Decision{Limit: sw.limit}
+	if validN(n, sw.limit) && n <= sw.limit-sw.count {
+		sw.requests = append(sw.requests, windowEntry{at: now, n: n})
+		sw.count += n
+		d.Allowed = true
 	}
-	// validIdx == 0 時，第一個請求就未過期，無需處理
+	d.Remaining = sw.limit - sw.count
 
-	// 檢查是否超過限制
-	if int64(len(sw.requests)) < sw.limit {
-		sw.requests = append(sw.requests, now)
-		return true
+	if len(sw.requests) > 0 {
+		d.ResetAfter = sw.requests[len(sw.requests)-1].at.Add(sw.window).Sub(now)
+		if !d.Allowed && validN(n, sw.limit) {
+			// 需要滑出的單位數：視窗內已用 + 本次 - 上限
+			need := sw.count + n - sw.limit
+			for _, e := range sw.requests {
+				need -= e.n
+				if need <= 0 {
+					d.RetryAfter = e.at.Add(sw.window).Sub(now)
+					break
+				}
+			}
+		}
 	}
 
-	return false
+	return d, nil
 }
 
-// Count 返回當前視窗內的請求數（用於監控）。
+// Count 返回當前視窗內的單位數（用於監控）。
 func (sw *SlidingWindow) Count() int {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
-	return len(sw.requests)
+	return int(sw.count)
 }
 
 // SlidingWindowCounter 使用計數器優化的滑動視窗。
 //
 // 實作原理：
-//   將視窗分為多個小區間，記錄每個區間的計數
-//   計算時根據當前時間的位置，加權平均兩個區間
+//
+//	將視窗分為多個小區間，記錄每個區間的計數
+//	計算時根據當前時間的位置，加權平均兩個區間
 //
 // 範例：視窗 1 分鐘，分為 60 個區間（每秒一個）
-//   當前時間：10:00:30.5
-//   前一個完整分鐘（09:59:31 - 10:00:30）的請求數：80
-//   當前秒（10:00:30 - 10:00:31）的請求數：10
-//   加權計算：80 * 0.5 + 10 = 45
+//
+//	當前時間：10:00:30.5
+//	前一個完整分鐘（09:59:31 - 10:00:30）的請求數：80
+//	當前秒（10:00:30 - 10:00:31）的請求數：10
+//	加權計算：80 * 0.5 + 10 = 45
 //
 // 優點：
 //   - 記憶體占用固定（只存 N 個計數器）
@@ -147,28 +180,31 @@ func (sw *SlidingWindow) Count() int {
 //   - 實作較複雜
 //
 // Trade-off：
-//   精確度 vs 效能與記憶體
-//   大部分場景下，近似演算法已足夠
+//
+//	精確度 vs 效能與記憶體
+//	大部分場景下，近似演算法已足夠
 type SlidingWindowCounter struct {
 	limit      int64
 	window     time.Duration
-	buckets    int           // 分桶數量
-	counts     []int64       // 每個桶的計數
-	timestamps []time.Time   // 每個桶的時間戳記
+	buckets    int         // 分桶數量
+	counts     []int64     // 每個桶的計數
+	timestamps []time.Time // 每個桶的時間戳記
 	mu         sync.Mutex
 }
 
 // NewSlidingWindowCounter 建立計數器優化的滑動視窗。
 //
 // 參數：
-//   limit: 限制
-//   window: 視窗大小
-//   buckets: 分桶數量（建議：視窗秒數）
+//
+//	limit: 限制
+//	window: 視窗大小
+//	buckets: 分桶數量（建議：視窗秒數）
 //
 // 範例：
-//   限制 1000 req/min，分 60 桶
-//   每桶代表 1 秒
-//   記憶體：60 * (8 + 24) = 1920 bytes
+//
+//	限制 1000 req/min，分 60 桶
+//	每桶代表 1 秒
+//	記憶體：60 * (8 + 24) = 1920 bytes
 func NewSlidingWindowCounter(limit int64, window time.Duration, buckets int) *SlidingWindowCounter {
 	return &SlidingWindowCounter{
 		limit:      limit,
@@ -179,20 +215,26 @@ func NewSlidingWindowCounter(limit int64, window time.Duration, buckets int) *Sl
 	}
 }
 
-// Allow 檢查是否允許請求。
+// Allow 檢查是否允許請求（key 被忽略，實例本身就是一個視窗）。
+func (swc *SlidingWindowCounter) Allow(ctx context.Context, key string) (Decision, error) {
+	return swc.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否允許消耗 n 個單位。
 //
 // 實作細節：
-//   1. 計算當前時間所在的桶索引
-//   2. 清理過期的桶
-//   3. 統計視窗內的總請求數
-//   4. 判斷是否超過限制
-func (swc *SlidingWindowCounter) Allow() bool {
+//  1. 計算當前時間所在的桶索引
+//  2. 清理過期的桶
+//  3. 統計視窗內的總單位數
+//  4. 加上 n 是否超過限制
+//  5. 以桶的時間戳記估算重置與重試時間（近似值，與計數本身的精度一致）
+func (swc *SlidingWindowCounter) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
 	swc.mu.Lock()
 	defer swc.mu.Unlock()
 
 	now := time.Now()
 	bucketDuration := swc.window / time.Duration(swc.buckets)
-	currentBucket := int(now.Unix() / int64(bucketDuration.Seconds())) % swc.buckets
+	currentBucket := int(now.Unix()/int64(bucketDuration.Seconds())) % swc.buckets
 
 	// 清理過期桶
 	if !swc.timestamps[currentBucket].IsZero() {
@@ -202,21 +244,41 @@ func (swc *SlidingWindowCounter) Allow() bool {
 		}
 	}
 
-	// 統計視窗內的總請求數
+	// 統計視窗內的總請求數，同時記錄最早與最晚的有效桶
 	var total int64
+	var oldest, newest time.Time
 	windowStart := now.Add(-swc.window)
 	for i := 0; i < swc.buckets; i++ {
-		if !swc.timestamps[i].IsZero() && swc.timestamps[i].After(windowStart) {
-			total += swc.counts[i]
+		ts := swc.timestamps[i]
+		if ts.IsZero() || !ts.After(windowStart) || swc.counts[i] == 0 {
+			continue
+		}
+		total += swc.counts[i]
+		if oldest.IsZero() || ts.Before(oldest) {
+			oldest = ts
+		}
+		if ts.After(newest) {
+			newest = ts
 		}
 	}
 
 	// 檢查限制
-	if total < swc.limit {
-		swc.counts[currentBucket]++
+	d := Decision{Limit: swc.limit}
+	if validN(n, swc.limit) && n <= swc.limit-total {
+		swc.counts[currentBucket] += n
 		swc.timestamps[currentBucket] = now
-		return true
+		total += n
+		newest = now
+		d.Allowed = true
+	}
+	d.Remaining = max(0, swc.limit-total)
+
+	if !newest.IsZero() {
+		d.ResetAfter = newest.Add(swc.window).Sub(now)
+	}
+	if !d.Allowed && validN(n, swc.limit) && !oldest.IsZero() {
+		d.RetryAfter = oldest.Add(swc.window).Sub(now)
 	}
 
-	return false
+	return d, nil
 }
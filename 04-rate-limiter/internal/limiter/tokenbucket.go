@@ -1,9 +1,10 @@
 // Package limiter 實作多種限流演算法。
 //
-// 本包提供三種經典限流演算法的實作：
+// 本包提供以下經典限流演算法的實作：
 //   - Token Bucket: 支援突發流量
 //   - Leaky Bucket: 平滑輸出
 //   - Sliding Window: 精確計數
+//   - GCRA: 與令牌桶等價，只需儲存一個時間戳記
 //
 // 設計考量：
 //   - 單機版使用本地記憶體（適合學習與單實例場景）
@@ -12,6 +13,7 @@
 package limiter
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -19,9 +21,9 @@ import (
 // TokenBucket 實作令牌桶演算法。
 //
 // 演算法原理：
-//   1. 固定容量的桶，以固定速率填充令牌
-//   2. 請求到達時，嘗試從桶中取出令牌
-//   3. 有令牌則允許請求，無令牌則拒絕
+//  1. 固定容量的桶，以固定速率填充令牌
+//  2. 請求到達時，嘗試從桶中取出令牌
+//  3. 有令牌則允許請求，無令牌則拒絕
 //
 // 優點：
 //   - 支援突發流量（桶內可累積令牌）
@@ -35,72 +37,110 @@ import (
 //   - API Gateway 限流
 //   - 需要容忍短時突發的場景
 type TokenBucket struct {
-	capacity   int64         // 桶容量（最多存放多少令牌）
-	tokens     int64         // 當前令牌數
-	refillRate int64         // 填充速率（每秒填充多少令牌）
-	lastRefill time.Time     // 上次填充時間
-	mu         sync.Mutex    // 保護並發存取
+	capacity   int64      // 桶容量（最多存放多少令牌）
+	tokens     int64      // 當前令牌數
+	refillRate int64      // 填充速率（每秒填充多少令牌）
+	lastRefill time.Time  // 上次填充時間
+	mu         sync.Mutex // 保護並發存取
 }
 
 // NewTokenBucket 建立新的令牌桶限流器。
 //
 // 參數：
-//   capacity: 桶容量，決定最大突發流量
-//   refillRate: 每秒填充速率，決定平均 QPS
+//
+//	capacity: 桶容量，決定最大突發流量
+//	refillRate: 每秒填充速率，決定平均 QPS
 //
 // 範例：
-//   limiter := NewTokenBucket(100, 10)  // 容量100，每秒填充10個
-//   limiter.Allow()  // 檢查是否允許請求
+//
+//	limiter := NewTokenBucket(100, 10)  // 容量100，每秒填充10個
+//	d, _ := limiter.Allow(ctx, "")       // 檢查是否允許請求（d.Allowed）
 func NewTokenBucket(capacity, refillRate int64) *TokenBucket {
 	return &TokenBucket{
 		capacity:   capacity,
-		tokens:     capacity,  // 初始化時桶是滿的
+		tokens:     capacity, // 初始化時桶是滿的
 		refillRate: refillRate,
 		lastRefill: time.Now(),
 	}
 }
 
-// Allow 檢查是否允許請求通過。
+// Allow 檢查是否允許請求通過（key 被忽略，實例本身就是一個桶）。
+func (tb *TokenBucket) Allow(ctx context.Context, key string) (Decision, error) {
+	return tb.AllowN(ctx, key, 1)
+}
+
+// AllowN 檢查是否可以一次取出 n 個令牌。
 //
 // 執行流程：
-//   1. 計算距離上次填充的時間
-//   2. 根據時間和速率，計算應填充的令牌數
-//   3. 更新桶內令牌數（不超過容量）
-//   4. 嘗試取出一個令牌
+//  1. 計算距離上次填充的時間
+//  2. 根據時間和速率，計算應填充的令牌數
+//  3. 更新桶內令牌數（不超過容量）
+//  4. 令牌足夠則取出 n 個，不足則一個都不取
+//  5. 根據剩餘令牌與填充進度計算重置與重試時間
 //
 // 時間複雜度：O(1)
 // 空間複雜度：O(1)
 //
 // 執行緒安全：使用 mutex 保護
-func (tb *TokenBucket) Allow() bool {
+func (tb *TokenBucket) AllowN(ctx context.Context, key string, n int64) (Decision, error) {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
-	// 計算需要填充的令牌數
 	now := time.Now()
-	elapsed := now.Sub(tb.lastRefill)
-	tokensToAdd := int64(elapsed.Seconds() * float64(tb.refillRate))
+	tb.refill(now)
+
+	d := Decision{Limit: tb.capacity}
+	if validN(n, tb.capacity) && n <= tb.tokens {
+		tb.tokens -= n
+		d.Allowed = true
+	}
+	d.Remaining = tb.tokens
 
-	if tokensToAdd > 0 {
-		// 填充令牌，但不超過容量
-		tb.tokens = min(tb.capacity, tb.tokens+tokensToAdd)
+	// 令牌未滿時才有「下一個令牌」的概念
+	//   - 下一個令牌：一個填充間隔減去已經累積的進度
+	//   - 湊滿 n 個：下一個令牌 + 其餘缺口 × 填充間隔
+	//   - 完全恢復：湊滿到容量
+	if tb.tokens < tb.capacity {
+		step := interval(tb.refillRate)
+		next := step - now.Sub(tb.lastRefill)
+		d.ResetAfter = next + time.Duration(tb.capacity-tb.tokens-1)*step
+		if !d.Allowed && validN(n, tb.capacity) {
+			d.RetryAfter = next + time.Duration(n-tb.tokens-1)*step
+		}
 	}
 
-	// 修復：始終更新 lastRefill，避免時間漂移
-	//
-	// 問題：當 tokensToAdd == 0 時（高頻請求，elapsed < 1秒），
-	// 如果不更新 lastRefill，fractional seconds 會累積丟失
-	//
-	// 解決：每次都更新 lastRefill，保證時間連續性
-	tb.lastRefill = now
+	return d, nil
+}
 
-	// 嘗試取出令牌
-	if tb.tokens > 0 {
-		tb.tokens--
-		return true
+// refill 根據經過時間填充令牌。
+//
+// 修復：lastRefill 只前進「已兌換成令牌」的時間
+//
+// 問題：若每次都把 lastRefill 設為 now，
+// 高頻請求下（間隔 < 填充間隔）tokensToAdd 永遠為 0，零頭時間不斷被丟棄，桶永遠填不回來
+//
+// 解決：
+//   - 填入 n 個令牌，lastRefill 前進 n 個填充間隔，零頭保留到下次
+//   - 桶滿時 lastRefill 直接設為 now（滿桶期間不累積進度）
+func (tb *TokenBucket) refill(now time.Time) {
+	if tb.tokens >= tb.capacity {
+		tb.lastRefill = now
+		return
+	}
+
+	elapsed := now.Sub(tb.lastRefill)
+	tokensToAdd := int64(elapsed.Seconds() * float64(tb.refillRate))
+	if tokensToAdd <= 0 {
+		return
 	}
 
-	return false
+	// 填充令牌，但不超過容量
+	tb.tokens = min(tb.capacity, tb.tokens+tokensToAdd)
+	if tb.tokens == tb.capacity {
+		tb.lastRefill = now
+	} else {
+		tb.lastRefill = tb.lastRefill.Add(time.Duration(tokensToAdd) * interval(tb.refillRate))
+	}
 }
 
 // Tokens 返回當前令牌數（用於監控）。
@@ -0,0 +1,113 @@
+// Package metrics 提供限流的監控指標與高頻被拒絕者（top offenders）統計。
+//
+// 指標（Prometheus）：
+//
+//	ratelimit_decisions_total{policy, dimension, result, mode}
+//	  result: allowed / rejected / error（限流器錯誤，依降級策略處理）
+//	  mode:   enforce / shadow（影子模式的 rejected 表示「如果生效會被拒絕」）
+//	ratelimit_limiter_duration_seconds{policy, backend}   限流器呼叫耗時
+//	ratelimit_redis_errors_total                          Redis 呼叫失敗次數
+//	ratelimit_circuit_open                                熔斷器是否開啟（1 / 0）
+//
+// 標籤基數：
+//
+//	policy 與 dimension 來自策略檔案（數量有限），不使用 key（IP、使用者）作為標籤：
+//	每個 IP 一條時間序列會讓 Prometheus 記憶體爆炸。
+//	「誰被擋下」改由 Offenders 以固定記憶體統計
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 判定結果（result 標籤）
+const (
+	ResultAllowed  = "allowed"
+	ResultRejected = "rejected"
+	ResultError    = "error"
+)
+
+// Metrics 限流指標。
+//
+// 使用獨立的 Registry 而非全域的 DefaultRegisterer：
+// 測試或同一程序中建立多個引擎時不會重複註冊而 panic
+type Metrics struct {
+	registry    *prometheus.Registry
+	decisions   *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	redisErrors prometheus.Counter
+}
+
+// New 建立限流指標。
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ratelimit_decisions_total",
+			Help: "Rate limit decisions by policy, dimension, result and mode.",
+		}, []string{"policy", "dimension", "result", "mode"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "ratelimit_limiter_duration_seconds",
+			Help: "Time spent in the limiter per decision.",
+			// 100µs ~ 200ms：本地限流器在最低的桶，Redis 往返在中間，逾時（100ms）在最高的桶
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 12),
+		}, []string{"policy", "backend"}),
+		redisErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ratelimit_redis_errors_total",
+			Help: "Failed Redis calls made by rate limiters.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.decisions,
+		m.latency,
+		m.redisErrors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// ObserveDecision 記錄一次判定。
+func (m *Metrics) ObserveDecision(policy, dimension, backend string, allowed, shadow bool, err error, latency time.Duration) {
+	result := ResultAllowed
+	switch {
+	case err != nil:
+		result = ResultError
+	case !allowed:
+		result = ResultRejected
+	}
+	mode := "enforce"
+	if shadow {
+		mode = "shadow"
+	}
+	m.decisions.WithLabelValues(policy, dimension, result, mode).Inc()
+	m.latency.WithLabelValues(policy, backend).Observe(latency.Seconds())
+}
+
+// RedisError 記錄一次 Redis 呼叫失敗（作為 limiter.BreakerConfig.OnError）。
+func (m *Metrics) RedisError(error) {
+	m.redisErrors.Inc()
+}
+
+// CircuitOpen 註冊熔斷器狀態指標（open 在每次抓取時呼叫）。
+func (m *Metrics) CircuitOpen(open func() bool) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ratelimit_circuit_open",
+		Help: "Whether the Redis circuit breaker is open (1) or closed (0).",
+	}, func() float64 {
+		if open() {
+			return 1
+		}
+		return 0
+	}))
+}
+
+// Handler Prometheus 抓取接口（GET /metrics）。
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"cmp"
+	"encoding/json"
+	"hash/maphash"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Offender 一個高頻被拒絕的 key 與其（估計的）被拒絕次數。
+type Offender struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// Offenders 以 Count-Min Sketch 統計被拒絕最多的 key（heavy hitters）。
+//
+// 問題：攻擊期間被拒絕的 key（IP、API Key）可能有數百萬個，
+// 為每個 key 維護計數器的記憶體與 key 數量成正比。
+//
+// Count-Min Sketch 原理：
+//
+//	depth 列、每列 width 個計數器，每列使用不同的雜湊函數
+//	記錄：每列把 hash_i(key) 位置的計數器加一
+//	估計：取各列對應計數器的最小值
+//
+//	  列 0: [0][3][0][7][1]...   ← hash_0(key) = 3 → 7
+//	  列 1: [2][0][5][0][0]...   ← hash_1(key) = 2 → 5
+//	  估計值 = min(7, 5) = 5
+//
+//	  - 只會高估（其他 key 碰撞到同一個計數器），不會低估
+//	  - 誤差上限約為 總次數 × e / width（width 2048 時約 0.13%）
+//	  - 記憶體固定：depth × width 個計數器，與 key 數量無關
+//
+// 保守更新（conservative update）：
+//
+//	只增加等於當前最小值的計數器，其他計數器已經被碰撞高估，不再加
+//	→ 在不影響「不低估」保證的前提下，大幅降低高估
+//
+// Top-K：
+//
+//	Sketch 只能回答「某個 key 的次數」，不能列舉 key。
+//	另外維護 k 個候選 key：新 key 的估計值超過候選中的最小值時取而代之
+//
+// 時間視窗：
+//
+//	兩代 sketch 輪替（current / previous），每個 window 輪替一次
+//	估計值 = 兩代相加，反映最近一到兩個 window 的情況；攻擊結束後自然淡出
+type Offenders struct {
+	k      int
+	width  uint64
+	window time.Duration
+	seeds  []maphash.Seed
+
+	mu        sync.Mutex
+	current   [][]uint32
+	previous  [][]uint32
+	top       map[string]struct{} // 候選 key（最多 k 個）
+	rotatedAt time.Time
+}
+
+const (
+	sketchDepth = 4
+	sketchWidth = 2048
+)
+
+// NewOffenders 建立高頻被拒絕者統計。
+//
+// 參數：
+//
+//	k: 保留的 key 數量
+//	window: 時間視窗（統計最近一到兩個 window 內的拒絕）
+//
+// 記憶體：2 代 × 4 列 × 2048 個 uint32 ≈ 64 KB，與 key 數量無關
+func NewOffenders(k int, window time.Duration) *Offenders {
+	o := &Offenders{
+		k:         k,
+		width:     sketchWidth,
+		window:    window,
+		seeds:     make([]maphash.Seed, sketchDepth),
+		current:   newSketch(),
+		previous:  newSketch(),
+		top:       make(map[string]struct{}, k),
+		rotatedAt: time.Now(),
+	}
+	for i := range o.seeds {
+		o.seeds[i] = maphash.MakeSeed()
+	}
+	return o
+}
+
+func newSketch() [][]uint32 {
+	rows := make([][]uint32, sketchDepth)
+	for i := range rows {
+		rows[i] = make([]uint32, sketchWidth)
+	}
+	return rows
+}
+
+// Record 記錄 key 被拒絕一次。
+//
+// 時間複雜度：O(depth)；key 不在候選中且候選已滿時 O(k × depth)（k 通常為數十）
+func (o *Offenders) Record(key string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.rotate()
+
+	// 保守更新：先找出最小值，只增加等於最小值的計數器
+	var idx [sketchDepth]uint64
+	least := uint32(0)
+	for i := range o.current {
+		idx[i] = maphash.String(o.seeds[i], key) % o.width
+		if c := o.current[i][idx[i]]; i == 0 || c < least {
+			least = c
+		}
+	}
+	for i := range o.current {
+		if o.current[i][idx[i]] == least {
+			o.current[i][idx[i]]++
+		}
+	}
+
+	if _, ok := o.top[key]; ok || len(o.top) < o.k {
+		o.top[key] = struct{}{}
+		return
+	}
+
+	// 取代估計值最小的候選
+	count := o.estimate(key)
+	var weakest string
+	weakestCount := count
+	for candidate := range o.top {
+		if c := o.estimate(candidate); c < weakestCount {
+			weakest, weakestCount = candidate, c
+		}
+	}
+	if weakestCount < count {
+		delete(o.top, weakest)
+		o.top[key] = struct{}{}
+	}
+}
+
+// Top 返回被拒絕最多的 key（由多到少）。
+func (o *Offenders) Top() []Offender {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.rotate()
+
+	top := make([]Offender, 0, len(o.top))
+	for key := range o.top {
+		if c := o.estimate(key); c > 0 {
+			top = append(top, Offender{Key: key, Count: c})
+		}
+	}
+	slices.SortFunc(top, func(a, b Offender) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Key, b.Key))
+	})
+	return top
+}
+
+// Handler 高頻被拒絕者查詢接口。
+//
+// 回應範例：
+//
+//	{"window":"1m0s","offenders":[{"key":"login:ip:203.0.113.7","count":1520}, ...]}
+//
+// key 的格式為 {規則}:{維度}:{值}：影子模式的規則也會出現，用於評估新規則會擋下誰
+func (o *Offenders) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"window":    o.window.String(),
+			"offenders": o.Top(),
+		})
+	}
+}
+
+// estimate 兩代 sketch 的估計值之和（呼叫方持有鎖）。
+func (o *Offenders) estimate(key string) uint64 {
+	var cur, prev uint32
+	for i := range o.current {
+		j := maphash.String(o.seeds[i], key) % o.width
+		if i == 0 || o.current[i][j] < cur {
+			cur = o.current[i][j]
+		}
+		if i == 0 || o.previous[i][j] < prev {
+			prev = o.previous[i][j]
+		}
+	}
+	return uint64(cur) + uint64(prev)
+}
+
+// rotate 視窗到期時輪替 sketch（呼叫方持有鎖）。
+//
+// 超過兩個視窗沒有輪替（期間沒有任何拒絕），兩代都已過期，一併清空
+func (o *Offenders) rotate() {
+	elapsed := time.Since(o.rotatedAt)
+	if elapsed < o.window {
+		return
+	}
+	if elapsed >= 2*o.window {
+		clearSketch(o.previous)
+	} else {
+		o.previous, o.current = o.current, o.previous
+	}
+	clearSketch(o.current)
+	o.rotatedAt = time.Now()
+
+	// 候選中已經淡出的 key 騰出位置
+	for key := range o.top {
+		if o.estimate(key) == 0 {
+			delete(o.top, key)
+		}
+	}
+}
+
+func clearSketch(rows [][]uint32) {
+	for _, row := range rows {
+		clear(row)
+	}
+}
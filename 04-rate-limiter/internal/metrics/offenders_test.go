@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func record(o *Offenders, key string, n int) {
+	for range n {
+		o.Record(key)
+	}
+}
+
+func TestOffendersTop(t *testing.T) {
+	o := NewOffenders(3, time.Hour)
+	record(o, "b", 5)
+	record(o, "a", 5)
+	record(o, "c", 10)
+
+	top := o.Top()
+	// 由多到少；次數相同時依 key 排序
+	want := []Offender{{"c", 10}, {"a", 5}, {"b", 5}}
+	if fmt.Sprint(top) != fmt.Sprint(want) {
+		t.Errorf("Top() = %v, want %v", top, want)
+	}
+}
+
+// TestOffendersHeavyHitter 候選已滿時，次數更多的 key 取代最少的候選。
+func TestOffendersHeavyHitter(t *testing.T) {
+	o := NewOffenders(2, time.Hour)
+	record(o, "a", 3)
+	record(o, "b", 1)
+	record(o, "c", 1) // 與最少的候選同數：不取代
+	if top := o.Top(); len(top) != 2 || top[1].Key != "b" {
+		t.Fatalf("Top() = %v, want a and b kept", top)
+	}
+
+	record(o, "c", 1)
+	top := o.Top()
+	if len(top) != 2 || top[0].Key != "a" || top[1] != (Offender{"c", 2}) {
+		t.Errorf("Top() = %v, want c to replace b", top)
+	}
+}
+
+// TestOffendersNoiseDoesNotEvict 大量只出現一次的 key 不會擠掉真正的高頻 key。
+func TestOffendersNoiseDoesNotEvict(t *testing.T) {
+	o := NewOffenders(5, time.Hour)
+	record(o, "attacker", 100)
+	for i := range 10000 {
+		o.Record(fmt.Sprintf("ip:%d", i))
+	}
+
+	top := o.Top()
+	if len(top) > 5 {
+		t.Fatalf("Top() returned %d keys, want at most 5", len(top))
+	}
+	// Count-Min Sketch 只會高估
+	if top[0].Key != "attacker" || top[0].Count < 100 {
+		t.Errorf("Top()[0] = %v, want attacker with at least 100", top[0])
+	}
+}
+
+func TestOffendersWindow(t *testing.T) {
+	const window = 20 * time.Millisecond
+	o := NewOffenders(5, window)
+	record(o, "a", 3)
+
+	// 一個視窗後：舊一代仍計入
+	time.Sleep(window)
+	record(o, "b", 1)
+	if top := o.Top(); len(top) != 2 || top[0] != (Offender{"a", 3}) {
+		t.Fatalf("Top() after one window = %v, want a still counted", top)
+	}
+
+	// 兩個視窗沒有新的拒絕：全部淡出
+	time.Sleep(2 * window)
+	if top := o.Top(); len(top) != 0 {
+		t.Errorf("Top() after two idle windows = %v, want empty", top)
+	}
+}
+
+func TestOffendersHandler(t *testing.T) {
+	o := NewOffenders(5, time.Minute)
+	record(o, "login:ip:203.0.113.7", 2)
+
+	rec := httptest.NewRecorder()
+	o.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/offenders", nil))
+
+	var body struct {
+		Window    string     `json:"window"`
+		Offenders []Offender `json:"offenders"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Window != "1m0s" || len(body.Offenders) != 1 || body.Offenders[0] != (Offender{"login:ip:203.0.113.7", 2}) {
+		t.Errorf("response = %+v", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}
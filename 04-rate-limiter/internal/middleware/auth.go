@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireToken 建立管理接口的認證中介軟體：請求須帶 Authorization: Bearer <token>。
+//
+// 用於 /v1/offenders 等內部接口：
+//   - 被拒絕者的 key 含有 IP、使用者 ID，不應公開給一般客戶端
+//   - 與限流接口共用同一個埠，以權杖區分而非另開監聽埠（部署設定較簡單）
+//
+// 為何比較雜湊而非直接比較字串？
+//   - subtle.ConstantTimeCompare 在長度不同時立即返回，會洩漏權杖長度
+//   - 先取 SHA-256 後長度固定，比較時間與權杖內容無關
+//
+// 認證失敗返回 401，並帶 WWW-Authenticate 標頭
+func RequireToken(token string) func(http.Handler) http.Handler {
+	want := sha256.Sum256([]byte(token))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			sum := sha256.Sum256([]byte(got))
+			if !ok || subtle.ConstantTimeCompare(sum[:], want[:]) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+)
+
+// ConcurrencyConfig 並發限制中介軟體設定。
+type ConcurrencyConfig struct {
+	// Limiter 並發限制器（上限、佇列長度與等待時間在其中設定）
+	Limiter *limiter.Concurrency
+
+	// KeyFunc 並發數的歸屬（nil 表示整個服務共用一個上限）
+	// 範例：
+	//   - 保護後端：nil（所有請求合計）
+	//   - 避免單一客戶端佔滿：按 IP 或 API Key
+	KeyFunc func(r *http.Request) string
+
+	// OnLimited 佇列已滿或等待逾時時的處理
+	// 預設：返回 503 Service Unavailable
+	OnLimited http.HandlerFunc
+}
+
+// ConcurrencyLimit 建立並發限制中介軟體。
+//
+// 與 RateLimit 的差異：
+//   - RateLimit 限制每秒進來多少請求，不管它們處理多久
+//   - ConcurrencyLimit 限制同時處理中的請求數，後端變慢時吞吐量自動下降
+//
+// 兩者可以疊加：RateLimit 在外層擋掉濫用，ConcurrencyLimit 在內層保護後端
+//
+// 使用範例：
+//
+//	// 自適應上限：延遲上升時自動降低並發數
+//	c := limiter.NewConcurrency(limiter.ConcurrencyConfig{
+//	    Limit:        limiter.NewGradient(limiter.GradientConfig{}),
+//	    MaxQueue:     50,
+//	    QueueTimeout: 500 * time.Millisecond,
+//	})
+//	http.Handle("/api/", ConcurrencyLimit(ConcurrencyConfig{Limiter: c})(apiHandler))
+//
+// 為何拒絕時返回 503 而非 429？
+//   - 429 表示「你」太頻繁，503 表示「服務」目前忙不過來
+//   - 客戶端與負載平衡器對 503 的處理是換一個實例重試
+//
+// 請求的結果回報給上限（自適應上限據此調整）：回應 5xx 視為因過載失敗
+func ConcurrencyLimit(config ConcurrencyConfig) func(http.Handler) http.Handler {
+	if config.OnLimited == nil {
+		config.OnLimited = defaultConcurrencyLimitedHandler
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var key string
+			if config.KeyFunc != nil {
+				key = config.KeyFunc(r)
+			}
+
+			// 排隊等待受請求 context 限制：客戶端斷線時立即離開佇列
+			release, err := config.Limiter.Acquire(r.Context(), key)
+			if err != nil {
+				if r.Context().Err() != nil {
+					return
+				}
+				config.OnLimited(w, r)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() { release(sw.status >= http.StatusInternalServerError) }()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// statusWriter 記錄回應狀態碼的 ResponseWriter。
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap 讓 http.ResponseController 能取得底層的 ResponseWriter（Flush 等）
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// defaultConcurrencyLimitedHandler 預設的並發限制回應。
+func defaultConcurrencyLimitedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"error":"server busy"}`))
+}
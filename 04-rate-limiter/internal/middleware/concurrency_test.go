@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+)
+
+// recordLimit 固定上限，記錄每個請求回報的 dropped。
+type recordLimit struct {
+	limiter.FixedLimit
+	mu      sync.Mutex
+	dropped []bool
+}
+
+func (l *recordLimit) Observe(rtt time.Duration, inflight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dropped = append(l.dropped, dropped)
+}
+
+func (l *recordLimit) observed() []bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.dropped)
+}
+
+// waitFor 輪詢直到 cond 成立（等待另一個 goroutine 中的請求進入處理或佇列）。
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestConcurrencyLimit 處理中的請求達到上限時，不排隊的請求立即返回 503。
+func TestConcurrencyLimit(t *testing.T) {
+	c := limiter.NewConcurrency(limiter.ConcurrencyConfig{Limit: limiter.FixedLimit(1)})
+	unblock := make(chan struct{})
+	handler := ConcurrencyLimit(ConcurrencyConfig{Limiter: c})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		done <- rec.Code
+	}()
+	waitFor(t, "the first request to start", func() bool { return c.InFlight("") == 1 })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("over the limit: status = %d, Retry-After = %q; want 503 with Retry-After 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if got := rec.Body.String(); got != `{"error":"server busy"}` {
+		t.Errorf("over the limit: body = %s", got)
+	}
+
+	close(unblock)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("first request status = %d, want 200", code)
+	}
+	if n := c.InFlight(""); n != 0 {
+		t.Errorf("InFlight() = %d after the request finished, want 0", n)
+	}
+}
+
+// TestConcurrencyLimitReportsDropped 回應 5xx 的請求回報為因過載失敗，其他狀態碼（含未呼叫 WriteHeader）不算。
+func TestConcurrencyLimitReportsDropped(t *testing.T) {
+	limit := &recordLimit{FixedLimit: 10}
+	c := limiter.NewConcurrency(limiter.ConcurrencyConfig{Limit: limit})
+	handler := ConcurrencyLimit(ConcurrencyConfig{Limiter: c})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/implicit":
+			w.Write([]byte("ok")) // 隱含 200
+		case "/flush":
+			// Unwrap 讓 ResponseController 取得底層的 Flusher
+			if err := http.NewResponseController(w).Flush(); err != nil {
+				t.Errorf("Flush() error = %v", err)
+			}
+		case "/not-found":
+			w.WriteHeader(http.StatusNotFound)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	paths := []string{"/implicit", "/flush", "/not-found", "/error", "/unavailable"}
+	for _, path := range paths {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	want := []bool{false, false, false, true, true}
+	if got := limit.observed(); !slices.Equal(got, want) {
+		t.Errorf("dropped reported for %v = %v, want %v", paths, got, want)
+	}
+}
+
+// TestConcurrencyLimitClientGone 排隊中的客戶端斷線：離開佇列，不寫回應、不呼叫 OnLimited。
+func TestConcurrencyLimitClientGone(t *testing.T) {
+	c := limiter.NewConcurrency(limiter.ConcurrencyConfig{
+		Limit:        limiter.FixedLimit(1),
+		MaxQueue:     1,
+		QueueTimeout: time.Minute,
+	})
+	unblock := make(chan struct{})
+	var limited bool
+	handler := ConcurrencyLimit(ConcurrencyConfig{
+		Limiter:   c,
+		OnLimited: func(w http.ResponseWriter, r *http.Request) { limited = true },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	waitFor(t, "the first request to start", func() bool { return c.InFlight("") == 1 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := httptest.NewRecorder()
+	second := make(chan struct{})
+	go func() {
+		defer close(second)
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	}()
+	waitFor(t, "the second request to queue", func() bool { return c.Queued("") == 1 })
+
+	cancel()
+	<-second
+	if limited || rec.Body.Len() != 0 || rec.Header().Get("Retry-After") != "" {
+		t.Errorf("client gone: OnLimited called = %v, body = %q, headers = %v; want nothing written", limited, rec.Body.String(), rec.Header())
+	}
+	if n := c.Queued(""); n != 0 {
+		t.Errorf("Queued() = %d after the client left, want 0", n)
+	}
+
+	close(unblock)
+	<-first
+}
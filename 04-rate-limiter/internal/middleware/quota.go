@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+)
+
+// QuotaConfig 長週期配額中介軟體設定。
+type QuotaConfig struct {
+	// Quota 配額儲存（Redis）
+	Quota *limiter.Quota
+
+	// KeyFunc 配額歸屬（通常是 API Key），返回空字串時不檢查配額
+	KeyFunc func(r *http.Request) string
+
+	// Limits 適用方案的每日與每月上限
+	// 不同方案使用不同的中介軟體實例（如策略檔案中每條規則各自一個）
+	Limits limiter.QuotaLimits
+
+	// Cost 請求的成本（nil 表示每個請求 1 單位）
+	Cost CostFunc
+
+	// OnQuotaExceeded 配額用完時的處理
+	// 預設：返回 429，並指出用完的週期
+	OnQuotaExceeded http.HandlerFunc
+}
+
+// QuotaLimit 建立長週期配額中介軟體。
+//
+// 與 RateLimit 搭配使用時，RateLimit 應在外層：
+// 被短期限流拒絕的請求不會消耗長期配額
+//
+// 標頭：
+//   - X-Quota-Limit / X-Quota-Remaining / X-Quota-Reset：最接近用完的週期
+//   - X-Quota-Period：上述數值所屬的週期（daily / monthly）
+//
+// 不使用 RateLimit-* 標頭：兩者同時存在時會互相覆蓋，客戶端也需要分辨
+// 「稍後重試」（限流）與「升級方案或等到明天」（配額）
+func QuotaLimit(config QuotaConfig) func(http.Handler) http.Handler {
+	if config.OnQuotaExceeded == nil {
+		config.OnQuotaExceeded = defaultQuotaExceededHandler
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := config.KeyFunc(r)
+			cost := requestCost(config.Cost, r)
+			if key == "" || cost == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
+			defer cancel()
+
+			d, err := config.Quota.AllowN(ctx, key, config.Limits, cost)
+			if err != nil {
+				// 降級：允許請求（與限流中介軟體相同，可用性優先）
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if d.Limit > 0 {
+				h := w.Header()
+				h.Set("X-Quota-Period", d.Period)
+				h.Set("X-Quota-Limit", strconv.FormatInt(d.Limit, 10))
+				h.Set("X-Quota-Remaining", strconv.FormatInt(d.Remaining, 10))
+				h.Set("X-Quota-Reset", strconv.FormatInt(limiter.Seconds(d.ResetAfter), 10))
+			}
+			if !d.Allowed {
+				w.Header().Set("Retry-After", strconv.FormatInt(max(1, limiter.Seconds(d.RetryAfter)), 10))
+				config.OnQuotaExceeded(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// defaultQuotaExceededHandler 預設的配額用完回應。
+//
+// 週期由中介軟體寫入 X-Quota-Period 標頭
+func defaultQuotaExceededHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":  "quota exceeded",
+		"period": w.Header().Get("X-Quota-Period"),
+	})
+}
+
+// UsageHandler 用量查詢接口：返回呼叫方在當前每日與每月週期的已用量與上限。
+//
+// 呼叫方以 keyFunc 識別（與 QuotaConfig.KeyFunc 相同），只能查詢自己的用量
+//
+// 回應範例：
+//
+//	{"usage":[
+//	  {"period":"daily","used":120,"limit":1000,"remaining":880,"reset_at":"2026-10-19T00:00:00Z"},
+//	  {"period":"monthly","used":3400,"limit":20000,"remaining":16600,"reset_at":"2026-11-01T00:00:00Z"}
+//	]}
+func UsageHandler(quota *limiter.Quota, keyFunc func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		key := keyFunc(r)
+		if key == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"missing api key"}`))
+			return
+		}
+
+		usage, err := quota.Usage(r.Context(), key)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"usage unavailable"}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"usage": usage})
+	}
+}
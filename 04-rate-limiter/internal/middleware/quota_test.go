@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+)
+
+// newQuota 以記憶體中的 Redis 建立配額，測試結束時關閉。
+func newQuota(t *testing.T) (*limiter.Quota, *miniredis.Miniredis) {
+	t.Helper()
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+		// miniredis 不支援 CLIENT MAINT_NOTIFICATIONS，關閉以免握手時輸出警告
+		MaintNotificationsConfig: &maintnotifications.Config{Mode: maintnotifications.ModeDisabled},
+	})
+	t.Cleanup(func() { client.Close() })
+	return limiter.NewQuota(client), s
+}
+
+// apiKey 測試用的 KeyFunc
+func apiKey(r *http.Request) string { return r.Header.Get("X-API-Key") }
+
+func TestQuotaLimit(t *testing.T) {
+	quota, _ := newQuota(t)
+	handler := QuotaLimit(QuotaConfig{
+		Quota:   quota,
+		KeyFunc: apiKey,
+		Limits:  limiter.QuotaLimits{Daily: 5, Monthly: 100},
+		Cost:    RouteCost(map[string]int64{"/export": 3, "/healthz": 0}, 1),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 3 + 1 + 1 = 5：剛好用完每日配額
+	for i, path := range []string{"/export", "/search", "/search"} {
+		rec := serve(path, "team")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d (%s): status = %d, want 200", i, path, rec.Code)
+		}
+		if rec.Header().Get("X-Quota-Period") != limiter.PeriodDaily {
+			t.Errorf("request %d: X-Quota-Period = %q, want the daily period (closer to exhaustion)", i, rec.Header().Get("X-Quota-Period"))
+		}
+	}
+
+	rec := serve("/search", "team")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over quota: status = %d, want 429", rec.Code)
+	}
+	h := rec.Header()
+	if h.Get("X-Quota-Limit") != "5" || h.Get("X-Quota-Remaining") != "0" || h.Get("X-Quota-Reset") == "" || h.Get("Retry-After") == "" {
+		t.Errorf("over quota headers = %v, want limit 5, remaining 0, a reset time and Retry-After", h)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["error"] != "quota exceeded" || body["period"] != limiter.PeriodDaily {
+		t.Errorf("over quota body = %v, %v, want the exhausted daily period", body, err)
+	}
+	// 限流的標頭留給 RateLimit：兩者同時存在時不互相覆蓋
+	if h.Get("RateLimit-Limit") != "" {
+		t.Errorf("RateLimit-Limit = %q, want no rate limit headers from QuotaLimit", h.Get("RateLimit-Limit"))
+	}
+
+	// 免費路由、沒有 key 的請求與其他 key 不受影響
+	for _, tt := range []struct{ path, key string }{{"/healthz", "team"}, {"/search", ""}, {"/search", "other"}} {
+		if rec := serve(tt.path, tt.key); rec.Code != http.StatusOK {
+			t.Errorf("GET %s with key %q: status = %d, want 200", tt.path, tt.key, rec.Code)
+		}
+	}
+}
+
+// TestQuotaLimitFailOpen Redis 不可用時放行請求，不輸出配額標頭。
+func TestQuotaLimitFailOpen(t *testing.T) {
+	quota, s := newQuota(t)
+	s.Close()
+	handler := QuotaLimit(QuotaConfig{
+		Quota:   quota,
+		KeyFunc: apiKey,
+		Limits:  limiter.QuotaLimits{Daily: 1, Monthly: 1},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/search", nil)
+	req.Header.Set("X-API-Key", "team")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Limit") != "" {
+		t.Errorf("status = %d, X-Quota-Limit = %q; want 200 without quota headers", rec.Code, rec.Header().Get("X-Quota-Limit"))
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	quota, s := newQuota(t)
+	if _, err := quota.AllowN(context.Background(), "team", limiter.QuotaLimits{Daily: 1000, Monthly: 20000}, 120); err != nil {
+		t.Fatalf("AllowN() error = %v", err)
+	}
+	handler := UsageHandler(quota, apiKey)
+
+	req := httptest.NewRequest("GET", "/usage", nil)
+	req.Header.Set("X-API-Key", "team")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status = %d, Content-Type = %q, want 200 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var body struct {
+		Usage []limiter.QuotaUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]int64{limiter.PeriodDaily: 1000, limiter.PeriodMonthly: 20000}
+	if len(body.Usage) != len(want) {
+		t.Fatalf("usage = %+v, want daily and monthly", body.Usage)
+	}
+	for _, u := range body.Usage {
+		if u.Used != 120 || u.Limit != want[u.Period] || u.Remaining != want[u.Period]-120 || u.ResetAt.IsZero() {
+			t.Errorf("usage %+v, want 120 of %d used and a reset time", u, want[u.Period])
+		}
+	}
+
+	// 其他 key 沒有用量：只能看到自己的
+	req = httptest.NewRequest("GET", "/usage", nil)
+	req.Header.Set("X-API-Key", "other")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Usage[0].Used != 0 {
+		t.Errorf("other key usage = %+v, %v, want nothing used", body.Usage, err)
+	}
+
+	// 缺少 key：401；Redis 不可用：503
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/usage", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: status = %d, want 401", rec.Code)
+	}
+	s.Close()
+	req = httptest.NewRequest("GET", "/usage", nil)
+	req.Header.Set("X-API-Key", "team")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("redis down: status = %d, want 503", rec.Code)
+	}
+}
@@ -1,25 +1,98 @@
 // Package middleware 提供 HTTP 限流中介軟體。
 //
 // 設計目標：
-//   將限流邏輯整合到 HTTP 請求處理流程
-//   支援多種限流策略和維度
+//
+//	將限流邏輯整合到 HTTP 請求處理流程
+//	支援多種限流策略和維度
 package middleware
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
-	"github.com/google/uuid"
 )
 
 // RateLimiterFunc 定義限流函數介面。
 //
 // 設計考量：
-//   使用函數介面而非具體型別
-//   提供彈性支援不同的限流器實作
-type RateLimiterFunc func(ctx context.Context, key string) (bool, error)
+//
+//	使用函數介面而非具體型別
+//	提供彈性支援不同的限流器實作
+//	任何 limiter.Limiter 的 AllowN 方法都可直接傳入（如 ipLimiter.AllowN）
+//	cost 為本次請求消耗的單位數（見 RateLimitConfig.Cost）
+type RateLimiterFunc func(ctx context.Context, key string, cost int64) (limiter.Decision, error)
+
+// CostFunc 計算請求的成本（消耗的配額單位數）。
+//
+// 範例：搜尋 10 單位、讀取 1 單位；返回 0 表示免費，直接放行，不經過限流器
+// （限流器拒絕 n <= 0，見 limiter.Limiter）
+type CostFunc func(r *http.Request) int64
+
+// RouteCost 依路由決定成本的 CostFunc。
+//
+// routes 的 key 為 "METHOD /path" 或 "/path"，以 * 結尾為前綴匹配：
+//
+//	RouteCost(map[string]int64{
+//	    "GET /api/search": 10,
+//	    "/api/export/*":   50,
+//	}, 1)
+//
+// 匹配順序：方法 + 路徑 → 路徑 → 最長的前綴（同長度時指定方法的優先）→ defaultCost
+func RouteCost(routes map[string]int64, defaultCost int64) CostFunc {
+	exact := make(map[string]int64)
+	type prefixRoute struct {
+		method, prefix string
+		cost           int64
+	}
+	var prefixes []prefixRoute
+	for route, cost := range routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok {
+			method, path = "", route
+		}
+		if p, ok := strings.CutSuffix(path, "*"); ok {
+			prefixes = append(prefixes, prefixRoute{method, p, cost})
+		} else {
+			exact[route] = cost
+		}
+	}
+	// 最長前綴優先；長度相同時指定方法的優先（與精確匹配的順序一致，不受 map 迭代順序影響）
+	slices.SortFunc(prefixes, func(a, b prefixRoute) int {
+		if n := len(b.prefix) - len(a.prefix); n != 0 {
+			return n
+		}
+		return len(b.method) - len(a.method)
+	})
+
+	return func(r *http.Request) int64 {
+		if cost, ok := exact[r.Method+" "+r.URL.Path]; ok {
+			return cost
+		}
+		if cost, ok := exact[r.URL.Path]; ok {
+			return cost
+		}
+		for _, p := range prefixes {
+			if (p.method == "" || p.method == r.Method) && strings.HasPrefix(r.URL.Path, p.prefix) {
+				return p.cost
+			}
+		}
+		return defaultCost
+	}
+}
+
+// requestCost 計算成本（未設定為 1，負數視為 0）。
+func requestCost(cost CostFunc, r *http.Request) int64 {
+	if cost == nil {
+		return 1
+	}
+	return max(0, cost(r))
+}
 
 // RateLimitConfig 限流中介軟體設定。
 type RateLimitConfig struct {
@@ -33,6 +106,9 @@ type RateLimitConfig struct {
 	// Limiter 限流器函數
 	Limiter RateLimiterFunc
 
+	// Cost 請求的成本（nil 表示每個請求 1 單位）
+	Cost CostFunc
+
 	// OnRateLimited 限流觸發時的處理
 	// 預設：返回 429 Too Many Requests
 	OnRateLimited http.HandlerFunc
@@ -48,7 +124,8 @@ type RateLimitConfig struct {
 //	    KeyFunc: func(r *http.Request) string {
 //	        return "ip:" + r.RemoteAddr
 //	    },
-//	    Limiter: ipLimiter.Allow,
+//	    Limiter: ipLimiter.AllowN,
+//	    Cost:    RouteCost(map[string]int64{"/api/search": 10}, 1),
 //	})
 //
 //	http.Handle("/api/", middleware(apiHandler))
@@ -63,12 +140,18 @@ func RateLimit(config RateLimitConfig) func(http.Handler) http.Handler {
 			// 提取限流 key
 			key := config.KeyFunc(r)
 
+			cost := requestCost(config.Cost, r)
+			if cost == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// 設定逾時上下文（避免 Redis 呼叫過久）
 			ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
 			defer cancel()
 
 			// 檢查限流
-			allowed, err := config.Limiter(ctx, key)
+			d, err := config.Limiter(ctx, key, cost)
 			if err != nil {
 				// 錯誤處理：記錄日誌但允許請求通過
 				// Trade-off: 可用性優先
@@ -77,7 +160,8 @@ func RateLimit(config RateLimitConfig) func(http.Handler) http.Handler {
 				return
 			}
 
-			if !allowed {
+			SetRateLimitHeaders(w.Header(), d)
+			if !d.Allowed {
 				config.OnRateLimited(w, r)
 				return
 			}
@@ -87,10 +171,53 @@ func RateLimit(config RateLimitConfig) func(http.Handler) http.Handler {
 	}
 }
 
+// SetRateLimitHeaders 根據判定結果輸出限流標頭。
+//
+// 標頭格式（IETF draft-ietf-httpapi-ratelimit-headers）：
+//   - RateLimit-Limit: 配額上限
+//   - RateLimit-Remaining: 剩餘配額
+//   - RateLimit-Reset: 配額完全恢復的秒數
+//   - Retry-After: 被拒絕時才輸出（RFC 9110），至少 1 秒
+//
+// 為何允許的請求也輸出？
+//   - 客戶端可以在被拒絕之前主動降速，而不是撞牆後才重試
+//
+// 標頭在 OnRateLimited 之前寫入，自訂的限流回應也會帶上
+// Limit 為 0 表示沒有配額資訊（如熔斷時 fail-closed 的拒絕），只輸出 Retry-After
+//
+// 決策服務也以此產生呼叫方應轉發的標頭，與中介軟體輸出的格式一致
+func SetRateLimitHeaders(h http.Header, d limiter.Decision) {
+	if d.Limit > 0 {
+		h.Set("RateLimit-Limit", strconv.FormatInt(d.Limit, 10))
+		h.Set("RateLimit-Remaining", strconv.FormatInt(d.Remaining, 10))
+		h.Set("RateLimit-Reset", strconv.FormatInt(limiter.Seconds(d.ResetAfter), 10))
+	}
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.FormatInt(max(1, limiter.Seconds(d.RetryAfter)), 10))
+	}
+}
+
+// ClientIP 返回請求來源的 IP（不含埠號）。
+//
+// 為何不直接用 r.RemoteAddr？
+//   - RemoteAddr 格式為 "IP:port"，同一客戶端的每條連線埠號都不同
+//   - 以 RemoteAddr 為 key 等於按連線限流，客戶端換條連線就拿到新配額
+//
+// 注意：位於反向代理之後時，RemoteAddr 是代理的位址，
+// 需改從 X-Forwarded-For 取得（且只信任已知代理附加的部分）
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // defaultRateLimitedHandler 預設的限流回應。
+//
+// Retry-After 等標頭已由中介軟體設定
 func defaultRateLimitedHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-RateLimit-Retry-After", "1")
 	w.WriteHeader(http.StatusTooManyRequests)
 	w.Write([]byte(`{"error":"rate limit exceeded"}`))
 }
@@ -98,7 +225,11 @@ func defaultRateLimitedHandler(w http.ResponseWriter, r *http.Request) {
 // MultiDimensionRateLimit 多維度限流中介軟體。
 //
 // 設計場景：
-//   同時限制 IP、User、API 三個維度
+//
+//	同時限制 IP、User、API 三個維度
+//
+// 注意：各維度依序獨立檢查，後面的維度拒絕時，前面的維度已經扣了配額
+// 維度都在 Redis 上時，改用 AtomicMultiDimensionRateLimit
 //
 // 使用範例：
 //
@@ -107,23 +238,57 @@ func defaultRateLimitedHandler(w http.ResponseWriter, r *http.Request) {
 //	        {
 //	            Name: "ip",
 //	            KeyFunc: func(r *http.Request) string { return r.RemoteAddr },
-//	            Limiter: ipLimiter.Allow,
+//	            Limiter: ipLimiter.AllowN,
 //	        },
 //	        {
 //	            Name: "user",
 //	            KeyFunc: getUserID,
-//	            Limiter: userLimiter.Allow,
+//	            Limiter: userLimiter.AllowN,
 //	        },
 //	    },
 //	})
 type MultiDimensionConfig struct {
-	Dimensions    []DimensionConfig
+	Dimensions []DimensionConfig
+
+	// Cost 請求的成本，每個維度扣除相同的單位數（nil 表示 1）
+	Cost CostFunc
+
+	// Shadow 影子模式：照常判定並回報，但不拒絕請求（見 DecisionHook）
+	Shadow bool
+
+	// OnDecision 每個維度判定後的回呼（用於指標，可為 nil）
+	OnDecision DecisionHook
+
 	OnRateLimited http.HandlerFunc
 }
 
+// DecisionEvent 一次限流判定（DecisionHook 的參數）。
+type DecisionEvent struct {
+	Dimension string
+	Key       string // 傳給限流器的 key
+	Decision  limiter.Decision
+	Latency   time.Duration // 限流器呼叫耗時
+	Err       error         // 限流器錯誤（請求已依降級策略放行）
+	Shadow    bool          // 影子模式：Decision 拒絕時請求實際上仍被放行
+}
+
+// DecisionHook 限流判定的回呼。
+//
+// 影子模式（dry-run）：
+//
+//	上線新規則前，先以影子模式觀察「如果生效，會擋下誰」：
+//	  - 限流器照常計數（否則觀察到的拒絕數不準），判定透過 DecisionHook 回報
+//	  - 不拒絕請求，也不輸出限流標頭（客戶端看不出規則存在）
+//	確認影響範圍後，關閉影子模式即可生效
+type DecisionHook func(r *http.Request, e DecisionEvent)
+
 type DimensionConfig struct {
-	Name    string
+	Name string
+
+	// KeyFunc 返回空字串時跳過此維度
+	// 範例：匿名請求沒有使用者 ID，不應全部共用同一個 "user:" 配額
 	KeyFunc func(r *http.Request) string
+
 	Limiter RateLimiterFunc
 }
 
@@ -134,39 +299,143 @@ func MultiDimensionRateLimit(config MultiDimensionConfig) func(http.Handler) htt
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cost := requestCost(config.Cost, r)
+			if cost == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
 			ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
 			defer cancel()
 
 			// 依序檢查每個維度
+			//
+			// 標頭反映最接近超限的維度（剩餘配額最少），
+			// 客戶端依此降速，就不會觸發任何一個維度
+			var tightest limiter.Decision
+			checked := false
 			for _, dim := range config.Dimensions {
 				key := dim.KeyFunc(r)
-				allowed, err := dim.Limiter(ctx, key)
+				if key == "" {
+					continue
+				}
+				start := time.Now()
+				d, err := dim.Limiter(ctx, key, cost)
+				if config.OnDecision != nil {
+					config.OnDecision(r, DecisionEvent{
+						Dimension: dim.Name,
+						Key:       key,
+						Decision:  d,
+						Latency:   time.Since(start),
+						Err:       err,
+						Shadow:    config.Shadow,
+					})
+				}
 
 				if err != nil {
 					// 降級：允許請求
 					continue
 				}
+				if config.Shadow {
+					// 影子模式：繼續檢查其他維度，每個維度的判定都回報
+					continue
+				}
 
-				if !allowed {
+				if !d.Allowed {
 					// 任一維度超限則拒絕
 					w.Header().Set("X-RateLimit-Dimension", dim.Name)
+					SetRateLimitHeaders(w.Header(), d)
 					config.OnRateLimited(w, r)
 					return
 				}
+
+				if !checked || d.Remaining < tightest.Remaining {
+					tightest = d
+					checked = true
+				}
 			}
 
+			if checked {
+				SetRateLimitHeaders(w.Header(), tightest)
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// SlidingWindowRateLimitAdapter 滑動視窗限流適配器。
+// AtomicMultiDimensionConfig 原子多維度限流中介軟體設定。
+type AtomicMultiDimensionConfig struct {
+	// Limiter 在單一 Lua 腳本中檢查並扣除所有維度
+	// （limiter.DistributedMultiDimension，或其熔斷包裝 limiter.ResilientMultiDimension）
+	Limiter limiter.MultiLimiter
+
+	// KeyFuncs 維度名稱 → key 提取函數（返回空字串時跳過此維度）
+	KeyFuncs map[string]func(r *http.Request) string
+
+	// Cost 請求的成本，每個維度扣除相同的單位數（nil 表示 1）
+	Cost CostFunc
+
+	// Shadow 影子模式：照常判定並回報，但不拒絕請求
+	Shadow bool
+
+	// OnDecision 判定後的回呼（每個請求一次，維度為拒絕或最接近超限的維度）
+	OnDecision DecisionHook
+
+	OnRateLimited http.HandlerFunc
+}
+
+// AtomicMultiDimensionRateLimit 原子多維度限流中介軟體。
 //
-// 問題：滑動視窗需要 requestID，但 RateLimiterFunc 只接受 key
-// 解決：建立適配器自動產生 requestID
-func SlidingWindowRateLimitAdapter(sw *limiter.DistributedSlidingWindow) RateLimiterFunc {
-	return func(ctx context.Context, key string) (bool, error) {
-		requestID := uuid.New().String()
-		return sw.Allow(ctx, key, requestID)
+// 與 MultiDimensionRateLimit 的差異：
+//   - 所有維度一次 Redis 往返，全部通過才扣除（被拒絕的請求不消耗任何配額）
+//   - 維度檢查順序固定（依 limiter 建立時的宣告順序）
+func AtomicMultiDimensionRateLimit(config AtomicMultiDimensionConfig) func(http.Handler) http.Handler {
+	if config.OnRateLimited == nil {
+		config.OnRateLimited = defaultRateLimitedHandler
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cost := requestCost(config.Cost, r)
+			if cost == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
+			defer cancel()
+
+			keys := make(map[string]string, len(config.KeyFuncs))
+			for name, keyFunc := range config.KeyFuncs {
+				keys[name] = keyFunc(r)
+			}
+
+			start := time.Now()
+			d, err := config.Limiter.AllowN(ctx, keys, cost)
+			if config.OnDecision != nil {
+				config.OnDecision(r, DecisionEvent{
+					Dimension: d.Dimension,
+					Key:       keys[d.Dimension],
+					Decision:  d.Decision,
+					Latency:   time.Since(start),
+					Err:       err,
+					Shadow:    config.Shadow,
+				})
+			}
+			if err != nil || config.Shadow {
+				// 降級或影子模式：允許請求
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			SetRateLimitHeaders(w.Header(), d.Decision)
+			if !d.Allowed {
+				if d.Dimension != "" {
+					w.Header().Set("X-RateLimit-Dimension", d.Dimension)
+				}
+				config.OnRateLimited(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
 	}
 }
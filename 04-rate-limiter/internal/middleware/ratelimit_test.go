@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+)
+
+func TestSetRateLimitHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		d    limiter.Decision
+		want map[string]string // 空字串表示不應輸出
+	}{
+		{
+			name: "allowed",
+			d:    limiter.Decision{Allowed: true, Limit: 10, Remaining: 7, ResetAfter: 1500 * time.Millisecond},
+			want: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "7", "RateLimit-Reset": "2", "Retry-After": ""},
+		},
+		{
+			name: "denied",
+			d:    limiter.Decision{Limit: 10, ResetAfter: 3 * time.Second, RetryAfter: 200 * time.Millisecond},
+			want: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "0", "RateLimit-Reset": "3", "Retry-After": "1"},
+		},
+		{
+			name: "denied without retry time",
+			d:    limiter.Decision{Limit: 10, Remaining: 10},
+			want: map[string]string{"RateLimit-Reset": "0", "Retry-After": "1"},
+		},
+		{
+			name: "denied without quota information",
+			d:    limiter.Decision{RetryAfter: 5 * time.Second},
+			want: map[string]string{"RateLimit-Limit": "", "RateLimit-Remaining": "", "RateLimit-Reset": "", "Retry-After": "5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			SetRateLimitHeaders(h, tt.d)
+			for name, want := range tt.want {
+				if got := h.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// fixedLimiter 返回固定判定的 RateLimiterFunc，記錄收到的 key 與成本。
+func fixedLimiter(d limiter.Decision, err error, gotKey *string, gotCost *int64) RateLimiterFunc {
+	return func(ctx context.Context, key string, cost int64) (limiter.Decision, error) {
+		*gotKey, *gotCost = key, cost
+		return d, err
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		d           limiter.Decision
+		err         error
+		wantStatus  int
+		wantHeaders bool
+	}{
+		{"allowed", limiter.Decision{Allowed: true, Limit: 5, Remaining: 4, ResetAfter: time.Second}, nil, http.StatusOK, true},
+		{"denied", limiter.Decision{Limit: 5, ResetAfter: time.Second, RetryAfter: time.Second}, nil, http.StatusTooManyRequests, true},
+		{"limiter error fails open", limiter.Decision{}, errors.New("redis down"), http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var key string
+			var cost int64
+			handler := RateLimit(RateLimitConfig{
+				KeyFunc: func(r *http.Request) string { return "ip:" + ClientIP(r) },
+				Limiter: fixedLimiter(tt.d, tt.err, &key, &cost),
+				Cost:    RouteCost(map[string]int64{"GET /search": 10}, 1),
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/search", nil)
+			req.RemoteAddr = "203.0.113.7:51234"
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if key != "ip:203.0.113.7" || cost != 10 {
+				t.Errorf("limiter called with key %q cost %d, want ip:203.0.113.7 and 10", key, cost)
+			}
+			if got := rec.Header().Get("RateLimit-Limit") != ""; got != tt.wantHeaders {
+				t.Errorf("RateLimit-Limit present = %v, want %v", got, tt.wantHeaders)
+			}
+			if got := rec.Header().Get("Retry-After") != ""; got != (tt.wantStatus == http.StatusTooManyRequests) {
+				t.Errorf("Retry-After = %q on status %d", rec.Header().Get("Retry-After"), rec.Code)
+			}
+		})
+	}
+}
+
+// TestRateLimitFreeRoute 成本為 0（或負數）的請求直接放行，不呼叫限流器。
+func TestRateLimitFreeRoute(t *testing.T) {
+	called := false
+	handler := RateLimit(RateLimitConfig{
+		KeyFunc: func(r *http.Request) string { return "ip:" + ClientIP(r) },
+		Limiter: func(ctx context.Context, key string, cost int64) (limiter.Decision, error) {
+			called = true
+			return limiter.Decision{Limit: 5}, nil
+		},
+		Cost: RouteCost(map[string]int64{"/healthz": 0, "/debug/*": -1}, 1),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, path := range []string{"/healthz", "/debug/vars"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK || called {
+			t.Errorf("GET %s: status = %d, limiter called = %v; want 200 without the limiter", path, rec.Code, called)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("GET %s: RateLimit-Limit = %q, want no headers", path, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
+
+func TestRouteCost(t *testing.T) {
+	cost := RouteCost(map[string]int64{
+		"GET /api/search": 10,
+		"/api/search":     5,
+		"/api/*":          2,
+		"/api/export/*":   50,
+		"POST /api/*":     3,
+	}, 1)
+
+	tests := []struct {
+		method, path string
+		want         int64
+	}{
+		{"GET", "/api/search", 10},     // 方法 + 路徑優先
+		{"POST", "/api/search", 5},     // 其他方法退回只有路徑的規則
+		{"GET", "/api/export/csv", 50}, // 最長的前綴
+		{"GET", "/api/users", 2},
+		{"POST", "/api/users", 3}, // 同長度的前綴：只匹配對應方法的那一條
+		{"GET", "/healthz", 1},    // 都不匹配：預設成本
+	}
+	for _, tt := range tests {
+		if got := cost(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("RouteCost(%s %s) = %d, want %d", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"203.0.113.7:51234", "203.0.113.7"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"203.0.113.7", "203.0.113.7"}, // 無埠號時原樣返回
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("ClientIP(%q) = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
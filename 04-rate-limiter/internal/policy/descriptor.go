@@ -0,0 +1,175 @@
+package policy
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+)
+
+// descriptorLimiter domain 規則在 compiledRule.limiters 中的 key（domain 規則沒有維度，只有一個限流器）
+const descriptorLimiter = "descriptor"
+
+// DescriptorEntry 描述符中的一個 key / value。
+type DescriptorEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Descriptor 決策服務的描述符：一組 key / value，對應一個配額。
+//
+// 與 Envoy ratelimit 相同的概念：呼叫方描述「這次請求是誰、做什麼」，
+// 例如 [{customer_id, c1}, {method, POST}]，由服務端的規則決定配額
+type Descriptor struct {
+	Entries []DescriptorEntry `json:"entries"`
+
+	// Hits 此描述符消耗的單位數（0 表示沿用請求層級的 hits）
+	Hits int64 `json:"hits,omitempty"`
+}
+
+// DescriptorResult 一個描述符的判定結果。
+type DescriptorResult struct {
+	// Rule 匹配的生效規則（nil 表示只有影子模式的規則匹配或沒有規則匹配，不限流）
+	Rule *Rule
+
+	// Decision 限流判定（沒有規則匹配時為允許、Limit 為 0）
+	Decision limiter.Decision
+}
+
+// Check 決策服務：依 domain 規則逐一判定描述符。
+//
+// 每個描述符由第一條匹配的生效規則判定（按 priority 由高到低），
+// 消耗 hits × 規則的 cost 個單位（hits 為 0 時視為 1，與 Envoy 的 hits_addend 相同）
+//
+// 為何逐一判定而非全有或全無？
+//   - 與 Envoy ratelimit 的語意相同：每個描述符是獨立的配額，回應中各自有狀態
+//   - 代價：某個描述符超限時，其他描述符仍會被扣除
+//
+// 限流器錯誤（如 Redis 熔斷時 fail-open）視為允許，與中介軟體相同；
+// 影子模式的規則照常扣除與記錄，但不影響結果，並繼續尋找生效的規則（與中介軟體相同）
+func (e *Engine) Check(ctx context.Context, domain string, descriptors []Descriptor, hits int64) []DescriptorResult {
+	if hits <= 0 {
+		hits = 1
+	}
+
+	c := e.current.Load()
+	results := make([]DescriptorResult, len(descriptors))
+	for i, d := range descriptors {
+		results[i].Decision = limiter.Decision{Allowed: true}
+
+		n := hits
+		if d.Hits > 0 {
+			n = d.Hits
+		}
+		for _, cr := range c.domains {
+			if cr.rule.Match.Domain != domain || !matchDescriptor(cr.rule.Match.Descriptors, d) {
+				continue
+			}
+			key := descriptorKey(cr.rule.Name, d)
+			start := time.Now()
+			dec, err := cr.limiters[descriptorLimiter].AllowN(ctx, key, units(n, cr.rule.Cost))
+			e.metrics.ObserveDecision(cr.rule.Name, descriptorLimiter, cr.rule.Backend, dec.Allowed, cr.rule.Shadow, err, time.Since(start))
+			if err == nil && !dec.Allowed && dec.Limit > 0 {
+				e.offenders.Record(key)
+			}
+
+			// 影子模式：呼叫方看不出規則存在（與中介軟體不輸出標頭一致），繼續往下找
+			if cr.rule.Shadow {
+				continue
+			}
+			results[i].Rule = &cr.rule
+			if err == nil {
+				results[i].Decision = dec
+			}
+			break
+		}
+	}
+	return results
+}
+
+// units 消耗的單位數 n × cost，溢位時取 math.MaxInt64。
+//
+// hits 由呼叫方決定（gRPC 的 hits_addend 最大到 MaxInt64）：
+// 直接相乘會溢位成負數，令牌桶扣除負數等於加滿，之後卻因令牌數溢位而永遠拒絕；
+// 取最大值時超過任何規則的上限，限流器直接拒絕
+func units(n, cost int64) int64 {
+	if n > math.MaxInt64/cost {
+		return math.MaxInt64
+	}
+	return n * cost
+}
+
+// compileDomain 編譯決策服務的規則（沒有中介軟體，只有一個限流器）。
+func (e *Engine) compileDomain(rule Rule, old *compiledRule) *compiledRule {
+	l, ok := old.reusable(&rule)
+	if !ok {
+		l = e.newLimiter(&rule)
+	}
+	return &compiledRule{
+		rule:     rule,
+		limiters: map[string]limiter.Limiter{descriptorLimiter: l},
+	}
+}
+
+// reusable 返回可沿用的 domain 規則限流器（舊規則不存在、不是 domain 規則或參數改變時返回 false）。
+func (cr *compiledRule) reusable(r *Rule) (limiter.Limiter, bool) {
+	if cr == nil || !cr.rule.sameLimiter(r) {
+		return nil, false
+	}
+	l, ok := cr.limiters[descriptorLimiter]
+	return l, ok
+}
+
+// matchDescriptor 描述符的 key 集合與規則完全相同，且每個值都匹配（* 匹配任意值）。
+//
+// 為何要求 key 集合完全相同？
+//   - [customer_id] 與 [customer_id, method] 是不同的配額
+//   - 若 key 較少的規則也匹配 key 較多的描述符，同一次呼叫會被兩條規則重複扣除
+func matchDescriptor(want map[string]string, d Descriptor) bool {
+	if len(d.Entries) != len(want) {
+		return false
+	}
+	for i, entry := range d.Entries {
+		v, ok := want[entry.Key]
+		if !ok || (v != "*" && v != entry.Value) {
+			return false
+		}
+		// 重複的 key 會讓數量相同但缺少某個 key 的描述符通過
+		if slices.ContainsFunc(d.Entries[:i], func(prev DescriptorEntry) bool { return prev.Key == entry.Key }) {
+			return false
+		}
+	}
+	return true
+}
+
+// descriptorKey 限流 key：{規則名稱}:{key}={value}:...（按 key 排序，與呼叫方給的順序無關）
+func descriptorKey(rule string, d Descriptor) string {
+	entries := slices.Clone(d.Entries)
+	slices.SortFunc(entries, func(a, b DescriptorEntry) int { return strings.Compare(a.Key, b.Key) })
+
+	var b strings.Builder
+	b.WriteString(rule)
+	for _, entry := range entries {
+		b.WriteString(":")
+		b.WriteString(entry.Key)
+		b.WriteString("=")
+		b.WriteString(entry.Value)
+	}
+	return b.String()
+}
+
+// Unit 規則配額的表示方式：每 unit 時間 requests 個請求（用於回應中的 current_limit）。
+//
+//   - token_bucket / leaky_bucket / gcra：rate 個 / 秒
+//   - sliding_window / sliding_window_counter：limit 個 / window
+func (r *Rule) Unit() (requests int64, unit time.Duration) {
+	switch r.Algorithm {
+	case AlgorithmSlidingWindow, AlgorithmSlidingWindowCounter:
+		return r.Limit, r.Window
+	default:
+		return r.Rate, time.Second
+	}
+}
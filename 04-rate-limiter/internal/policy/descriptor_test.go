@@ -0,0 +1,227 @@
+package policy
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/metrics"
+)
+
+// desc 由 key, value, key, value... 建立描述符。
+func desc(kv ...string) Descriptor {
+	var d Descriptor
+	for i := 0; i < len(kv); i += 2 {
+		d.Entries = append(d.Entries, DescriptorEntry{Key: kv[i], Value: kv[i+1]})
+	}
+	return d
+}
+
+func TestMatchDescriptor(t *testing.T) {
+	want := map[string]string{"customer_id": "*", "method": "POST"}
+
+	tests := []struct {
+		name string
+		d    Descriptor
+		want bool
+	}{
+		{"exact", desc("customer_id", "c1", "method", "POST"), true},
+		{"any order", desc("method", "POST", "customer_id", "c2"), true},
+		{"value mismatch", desc("customer_id", "c1", "method", "GET"), false},
+		{"fewer keys", desc("customer_id", "c1"), false},
+		{"extra key", desc("customer_id", "c1", "method", "POST", "region", "eu"), false},
+		{"unknown key", desc("customer_id", "c1", "path", "POST"), false},
+		// 數量相同但缺少 method：重複的 key 不能湊數
+		{"duplicate key", desc("customer_id", "c1", "customer_id", "c2"), false},
+		{"empty", desc(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchDescriptor(want, tt.d); got != tt.want {
+				t.Errorf("matchDescriptor(%v) = %v, want %v", tt.d.Entries, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescriptorKey(t *testing.T) {
+	a := descriptorKey("r", desc("method", "POST", "customer_id", "c1"))
+	b := descriptorKey("r", desc("customer_id", "c1", "method", "POST"))
+	if a != "r:customer_id=c1:method=POST" || a != b {
+		t.Errorf("descriptorKey = %q and %q, want r:customer_id=c1:method=POST regardless of order", a, b)
+	}
+}
+
+// newCheckEngine 建立只有 domain 規則的引擎。
+func newCheckEngine(t *testing.T, content string) *Engine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, content, 0)
+	e, err := NewEngine(path, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+	return e
+}
+
+func TestEngineCheck(t *testing.T) {
+	e := newCheckEngine(t, `
+policies:
+  - name: per-customer
+    match: {domain: orders, descriptors: {customer_id: "*"}}
+    algorithm: token_bucket
+    capacity: 3
+    rate: 1
+  - name: vip
+    priority: 10
+    match: {domain: orders, descriptors: {customer_id: vip}}
+    algorithm: token_bucket
+    capacity: 100
+    rate: 1
+  - name: expensive
+    match: {domain: orders, descriptors: {method: POST}}
+    algorithm: token_bucket
+    capacity: 10
+    rate: 1
+    cost: 5
+`)
+	ctx := context.Background()
+
+	// 每個描述符獨立判定：c1 超限不影響同一次呼叫中的 c2
+	e.Check(ctx, "orders", []Descriptor{desc("customer_id", "c1")}, 3)
+	res := e.Check(ctx, "orders", []Descriptor{desc("customer_id", "c1"), desc("customer_id", "c2")}, 0)
+	if len(res) != 2 {
+		t.Fatalf("Check returned %d results, want 2", len(res))
+	}
+	if res[0].Decision.Allowed || res[0].Rule == nil || res[0].Rule.Name != "per-customer" {
+		t.Errorf("c1 = %+v, want denied by per-customer", res[0])
+	}
+	if !res[1].Decision.Allowed || res[1].Decision.Remaining != 2 {
+		t.Errorf("c2 = %+v, want allowed with 2 remaining (hits 0 counts as 1)", res[1].Decision)
+	}
+
+	// 優先權高的規則先匹配
+	if res := e.Check(ctx, "orders", []Descriptor{desc("customer_id", "vip")}, 1); res[0].Rule == nil || res[0].Rule.Name != "vip" {
+		t.Errorf("vip matched %+v, want the higher-priority vip rule", res[0].Rule)
+	}
+
+	// 消耗 = hits × cost；描述符層級的 hits 優先於請求層級
+	d := desc("method", "POST")
+	d.Hits = 1
+	if res := e.Check(ctx, "orders", []Descriptor{d}, 3); res[0].Decision.Remaining != 5 {
+		t.Errorf("POST remaining = %d, want 5 (descriptor hits 1 × cost 5)", res[0].Decision.Remaining)
+	}
+
+	// 沒有規則匹配（其他 domain 或 key 集合不同）：允許、沒有配額資訊
+	for _, tt := range []struct {
+		domain string
+		d      Descriptor
+	}{
+		{"payments", desc("customer_id", "c1")},
+		{"orders", desc("customer_id", "c1", "method", "POST")},
+	} {
+		res := e.Check(ctx, tt.domain, []Descriptor{tt.d}, 1)
+		if !res[0].Decision.Allowed || res[0].Rule != nil || res[0].Decision.Limit != 0 {
+			t.Errorf("Check(%s, %v) = %+v, want allowed without a rule", tt.domain, tt.d.Entries, res[0])
+		}
+	}
+}
+
+// TestEngineCheckHugeHits hits × cost 溢位時拒絕本次，不影響之後的請求。
+func TestEngineCheckHugeHits(t *testing.T) {
+	for _, algorithm := range []string{"token_bucket", "gcra"} {
+		t.Run(algorithm, func(t *testing.T) {
+			e := newCheckEngine(t, `
+policies:
+  - name: per-customer
+    match: {domain: orders, descriptors: {customer_id: "*"}}
+    algorithm: `+algorithm+`
+    capacity: 3
+    rate: 1
+    cost: 2
+`)
+			ctx := context.Background()
+			d := []Descriptor{desc("customer_id", "c1")}
+
+			// 1<<62 × 2 溢位成 math.MinInt64：直接相乘時扣除負數，令牌桶被加滿
+			if res := e.Check(ctx, "orders", d, 1<<62); res[0].Decision.Allowed || res[0].Decision.RetryAfter != 0 {
+				t.Fatalf("hits 1<<62 = %+v, want denied without retry time", res[0].Decision)
+			}
+			if res := e.Check(ctx, "orders", d, 1); !res[0].Decision.Allowed || res[0].Decision.Remaining != 1 {
+				t.Errorf("hits 1 = %+v, want allowed with 1 remaining", res[0].Decision)
+			}
+		})
+	}
+}
+
+func TestUnits(t *testing.T) {
+	tests := []struct {
+		n, cost, want int64
+	}{
+		{3, 5, 15},
+		{math.MaxInt64, 1, math.MaxInt64},
+		{1 << 62, 2, math.MaxInt64},
+		{math.MaxInt64/3 + 1, 3, math.MaxInt64},
+		{math.MaxInt64 / 3, 3, math.MaxInt64 / 3 * 3},
+	}
+	for _, tt := range tests {
+		if got := units(tt.n, tt.cost); got != tt.want {
+			t.Errorf("units(%d, %d) = %d, want %d", tt.n, tt.cost, got, tt.want)
+		}
+	}
+}
+
+// TestEngineCheckShadow 影子模式的規則照常扣除，但結果與沒有規則匹配相同。
+func TestEngineCheckShadow(t *testing.T) {
+	e := newCheckEngine(t, `
+policies:
+  - name: trial
+    shadow: true
+    match: {domain: orders, descriptors: {customer_id: "*"}}
+    algorithm: token_bucket
+    capacity: 1
+    rate: 1
+`)
+	ctx := context.Background()
+	for i := range 3 {
+		res := e.Check(ctx, "orders", []Descriptor{desc("customer_id", "c1")}, 1)
+		if !res[0].Decision.Allowed || res[0].Rule != nil {
+			t.Fatalf("request %d = %+v, want allowed without a rule", i, res[0])
+		}
+	}
+	if top := e.offenders.Top(); len(top) != 1 || top[0].Key != "trial:customer_id=c1" {
+		t.Errorf("offenders = %+v, want the shadow rule's denials recorded", top)
+	}
+}
+
+// TestEngineCheckShadowAboveEnforcing 影子規則匹配後繼續尋找生效的規則。
+func TestEngineCheckShadowAboveEnforcing(t *testing.T) {
+	e := newCheckEngine(t, `
+policies:
+  - name: trial
+    priority: 10
+    shadow: true
+    match: {domain: orders, descriptors: {customer_id: "*"}}
+    algorithm: token_bucket
+    capacity: 2
+    rate: 1
+  - name: per-customer
+    match: {domain: orders, descriptors: {customer_id: "*"}}
+    algorithm: token_bucket
+    capacity: 1
+    rate: 1
+`)
+	ctx := context.Background()
+	for i, want := range []bool{true, false, false} {
+		res := e.Check(ctx, "orders", []Descriptor{desc("customer_id", "c1")}, 1)
+		if res[0].Decision.Allowed != want || res[0].Rule == nil || res[0].Rule.Name != "per-customer" {
+			t.Errorf("request %d = %+v, want allowed %v by per-customer", i, res[0], want)
+		}
+	}
+	// 影子規則也照常判定（容量 2：第 3 次記錄為被拒絕者）
+	if top := e.offenders.Top(); len(top) != 2 || top[1] != (metrics.Offender{Key: "trial:customer_id=c1", Count: 1}) {
+		t.Errorf("offenders = %+v, want one shadow denial", top)
+	}
+}
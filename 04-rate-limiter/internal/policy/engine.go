@@ -0,0 +1,496 @@
+package policy
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+	"github.com/koopa0/system-design/04-rate-limiter/internal/metrics"
+	"github.com/koopa0/system-design/04-rate-limiter/internal/middleware"
+	"github.com/redis/go-redis/v9"
+)
+
+// Engine 策略引擎：載入策略檔案，編譯成中介軟體，並在檔案變更時熱更新。
+//
+// 熱更新設計：
+//   - 編譯後的策略放在 atomic.Pointer 中，請求處理只做一次原子讀取，不加鎖
+//   - 新策略完整編譯成功後才替換；解析或驗證失敗保留舊策略
+//   - 處理中的請求繼續使用舊策略（持有舊指標），不受替換影響
+//
+// 限流器狀態保留：
+//   - 同名且演算法參數不變的規則，沿用舊的限流器（單機桶的計數不會歸零）
+//   - Redis 後端的狀態以規則名稱為前綴存在 Redis，同名規則自然延續
+//
+// Redis 故障處理：
+//   - 所有 redis 後端規則共用一個熔斷器（故障是 Redis 層級的，不是規則層級的）
+//   - 熔斷後各規則依 on_failure 放行、拒絕或改用本地限流
+//
+// 監控：
+//   - 每次判定記錄到 Prometheus 指標（按規則與維度），影子模式的規則以 mode="shadow" 區分
+//   - 被拒絕的 key 記錄到 Offenders（固定記憶體），不作為指標標籤
+type Engine struct {
+	path    string
+	client  *redis.Client // 可為 nil（此時不允許 redis 後端）
+	breaker *limiter.CircuitBreaker
+	nodes   *limiter.NodeEstimator
+	quota   *limiter.Quota
+
+	metrics   *metrics.Metrics
+	offenders *metrics.Offenders
+
+	current atomic.Pointer[compiled]
+
+	// 只有 Watch 所在的 goroutine 呼叫 Reload，無需加鎖
+	modTime time.Time
+	size    int64
+}
+
+// compiled 編譯後的策略（不可變，整體替換）。
+type compiled struct {
+	rules   []*compiledRule // 按 priority 由高到低排序
+	domains []*compiledRule // 決策服務的規則（match.domain），同樣按 priority 排序
+}
+
+type compiledRule struct {
+	rule     Rule
+	matcher  *matcher
+	limiters map[string]limiter.Limiter      // 維度 → 限流器
+	limit    func(http.Handler) http.Handler // 編譯好的多維度限流中介軟體
+}
+
+// NewEngine 載入策略檔案並建立引擎。
+//
+// 參數：
+//
+//	path: 策略檔案路徑（YAML 或 JSON）
+//	client: Redis 客戶端，nil 表示只允許 local 後端
+//
+// 啟動時載入失敗直接返回錯誤（Fail-Fast）；之後的重新載入失敗只記錄日誌
+func NewEngine(path string, client *redis.Client) (*Engine, error) {
+	e := &Engine{
+		path:      path,
+		client:    client,
+		metrics:   metrics.New(),
+		offenders: metrics.NewOffenders(20, time.Minute),
+	}
+	if client != nil {
+		e.breaker = limiter.NewCircuitBreaker(limiter.RedisProbe(client), limiter.BreakerConfig{
+			OnError: e.metrics.RedisError,
+		})
+		e.metrics.CircuitOpen(e.breaker.Open)
+		e.nodes = limiter.NewNodeEstimator(client, "ratelimit:nodes", 1)
+		e.quota = limiter.NewQuota(client)
+	}
+	if _, err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload 檢查檔案是否變更，變更則重新編譯並替換。
+//
+// 返回 true 表示策略已替換
+// 解析、驗證或編譯失敗時保留舊策略並返回錯誤
+func (e *Engine) Reload() (bool, error) {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(e.modTime) && info.Size() == e.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return false, err
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return false, err
+	}
+	c, err := e.compile(f, e.current.Load())
+	if err != nil {
+		return false, err
+	}
+
+	e.current.Store(c)
+	e.modTime = info.ModTime()
+	e.size = info.Size()
+	log.Printf("限流策略已載入：%s（%d 條規則）", e.path, len(c.rules)+len(c.domains))
+	return true, nil
+}
+
+// Watch 定期檢查檔案變更（阻塞，直到 ctx 取消）。
+//
+// 為何輪詢而非 fsnotify？
+//   - 沒有額外依賴，行為在各平台一致
+//   - Kubernetes ConfigMap 以 symlink 替換方式更新，fsnotify 容易漏掉事件
+//   - 策略變更不頻繁，數秒的延遲可以接受
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.Reload(); err != nil {
+				log.Printf("限流策略重新載入失敗，保留舊策略：%v", err)
+			}
+		}
+	}
+}
+
+// Heartbeat 定期回報本節點存活，用於估算節點數（阻塞，直到 ctx 取消）。
+//
+// on_failure: local 的規則降級時，全域配額按估算的節點數平分
+// 沒有 Redis 連線時直接返回
+func (e *Engine) Heartbeat(ctx context.Context, interval time.Duration) {
+	if e.nodes == nil {
+		return
+	}
+	e.nodes.Run(ctx, interval)
+}
+
+// UsageHandler 長週期配額的用量查詢接口（以 X-API-Key 識別呼叫方）。
+//
+// 沒有 Redis 連線時返回 nil（配額只存在 Redis）
+func (e *Engine) UsageHandler() http.HandlerFunc {
+	if e.quota == nil {
+		return nil
+	}
+	return middleware.UsageHandler(e.quota, dimensionValue(DimensionAPIKey))
+}
+
+// MetricsHandler Prometheus 抓取接口（GET /metrics）。
+func (e *Engine) MetricsHandler() http.Handler {
+	return e.metrics.Handler()
+}
+
+// OffendersHandler 最近被拒絕最多的 key（GET /v1/offenders）。
+//
+// key 中的 API Key 與自訂標頭已遮蔽（見 redact），但 IP、使用者 ID 仍是原文，
+// 呼叫方應以 middleware.RequireToken 保護此接口
+func (e *Engine) OffendersHandler() http.HandlerFunc {
+	return e.offenders.Handler()
+}
+
+// Middleware 依當前策略限流的中介軟體。
+//
+// 執行流程：
+//  1. 原子讀取當前策略
+//  2. 按優先級找到第一條匹配的生效規則（shadow: false）
+//  3. 交給該規則編譯好的多維度限流中介軟體
+//  4. 沒有匹配的規則則直接放行
+//
+// 影子模式的規則只觀察：匹配時照常判定與記錄，但不佔用「第一條匹配」，
+// 繼續往下找生效的規則（否則在生效規則之上加一條影子規則，等於關閉了限流）
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := e.current.Load()
+		clientIP := middleware.ClientIP(r)
+		var shadows []*compiledRule
+		h := next
+		for _, cr := range c.rules {
+			if !cr.matcher.match(r, clientIP) {
+				continue
+			}
+			if cr.rule.Shadow {
+				shadows = append(shadows, cr)
+				continue
+			}
+			h = cr.limit(next)
+			break
+		}
+		// 影子規則包在外層，依優先級先判定；影子模式的中介軟體一律交給下一層
+		for _, cr := range slices.Backward(shadows) {
+			h = cr.limit(h)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// compile 將策略檔案編譯為可執行的規則。
+//
+// prev 為目前生效的策略，用於沿用限流器（可為 nil）
+func (e *Engine) compile(f *File, prev *compiled) (*compiled, error) {
+	old := make(map[string]*compiledRule)
+	if prev != nil {
+		for _, cr := range slices.Concat(prev.rules, prev.domains) {
+			old[cr.rule.Name] = cr
+		}
+	}
+
+	c := &compiled{rules: make([]*compiledRule, 0, len(f.Policies))}
+	for _, rule := range f.Policies {
+		if e.client == nil && (rule.Backend == BackendRedis || rule.Quota != nil) {
+			return nil, fmt.Errorf("policy %q: redis backend and quota require a redis connection", rule.Name)
+		}
+
+		if rule.Match.Domain != "" {
+			c.domains = append(c.domains, e.compileDomain(rule, old[rule.Name]))
+			continue
+		}
+
+		cr := &compiledRule{
+			rule:     rule,
+			matcher:  newMatcher(rule.Match),
+			limiters: make(map[string]limiter.Limiter, len(rule.Dimensions)),
+		}
+
+		if rule.Backend == BackendRedis && rule.Algorithm == AlgorithmTokenBucket {
+			// Redis 令牌桶：所有維度在一個 Lua 腳本中原子檢查（hash tag 為規則名稱）
+			// 狀態全在 Redis，沒有需要沿用的本地限流器
+			cr.limit = e.atomicLimit(&rule)
+		} else {
+			var reuse map[string]limiter.Limiter
+			if o, ok := old[rule.Name]; ok && o.rule.sameLimiter(&rule) {
+				reuse = o.limiters
+			}
+			cr.limit = e.multiDimensionLimit(&rule, cr.limiters, reuse)
+		}
+
+		// 長週期配額在限流之內：被限流拒絕的請求不消耗配額
+		if rule.Quota != nil {
+			rateLimit := cr.limit
+			quota := middleware.QuotaLimit(middleware.QuotaConfig{
+				Quota:   e.quota,
+				KeyFunc: dimensionValue(DimensionAPIKey),
+				Limits:  limiter.QuotaLimits{Daily: rule.Quota.Daily, Monthly: rule.Quota.Monthly},
+				Cost:    fixedCost(rule.Cost),
+			})
+			cr.limit = func(next http.Handler) http.Handler { return rateLimit(quota(next)) }
+		}
+
+		c.rules = append(c.rules, cr)
+	}
+
+	// 穩定排序：同優先級保持檔案中的順序
+	byPriority := func(a, b *compiledRule) int {
+		return cmp.Compare(b.rule.Priority, a.rule.Priority)
+	}
+	slices.SortStableFunc(c.rules, byPriority)
+	slices.SortStableFunc(c.domains, byPriority)
+	return c, nil
+}
+
+// multiDimensionLimit 建立逐維度檢查的限流中介軟體。
+//
+// 建立的限流器寫入 limiters；reuse 中已有的維度沿用舊的限流器
+func (e *Engine) multiDimensionLimit(r *Rule, limiters, reuse map[string]limiter.Limiter) func(http.Handler) http.Handler {
+	dims := make([]middleware.DimensionConfig, 0, len(r.Dimensions))
+	for _, dim := range r.Dimensions {
+		l, ok := reuse[dim]
+		if !ok {
+			l = e.newLimiter(r)
+		}
+		limiters[dim] = l
+		dims = append(dims, middleware.DimensionConfig{
+			Name:    dim,
+			KeyFunc: keyFunc(r.Name, dim),
+			Limiter: l.AllowN,
+		})
+	}
+	return middleware.MultiDimensionRateLimit(middleware.MultiDimensionConfig{
+		Dimensions: dims,
+		Cost:       fixedCost(r.Cost),
+		Shadow:     r.Shadow,
+		OnDecision: e.observer(r, ""),
+	})
+}
+
+// atomicLimit 建立 Redis 令牌桶規則的原子多維度限流中介軟體（帶熔斷）。
+func (e *Engine) atomicLimit(r *Rule) func(http.Handler) http.Handler {
+	dims := make([]limiter.Dimension, 0, len(r.Dimensions))
+	keyFuncs := make(map[string]func(r *http.Request) string, len(r.Dimensions))
+	var fallbacks map[string]limiter.Limiter
+	if r.OnFailure == FailureLocal {
+		fallbacks = make(map[string]limiter.Limiter, len(r.Dimensions))
+	}
+	for _, dim := range r.Dimensions {
+		dims = append(dims, limiter.Dimension{Name: dim, Capacity: r.Capacity, RefillRate: r.Rate})
+		keyFuncs[dim] = dimensionValue(dim)
+		if fallbacks != nil {
+			fallbacks[dim] = e.fallbackLimiter(r)
+		}
+	}
+	return middleware.AtomicMultiDimensionRateLimit(middleware.AtomicMultiDimensionConfig{
+		Limiter: limiter.NewResilientMultiDimension(
+			limiter.NewDistributedMultiDimension(e.client, r.Name, dims...),
+			e.breaker, limiter.FailureMode(r.OnFailure), r.Dimensions, fallbacks,
+		),
+		KeyFuncs:   keyFuncs,
+		Cost:       fixedCost(r.Cost),
+		Shadow:     r.Shadow,
+		OnDecision: e.observer(r, r.Name+":"),
+	})
+}
+
+// observer 建立記錄指標與被拒絕者的判定回呼。
+//
+// prefix 加在 key 之前：原子多維度限流器的 key 只有維度的值（hash tag 已區分規則），
+// 補上 {規則}:{維度}: 後與逐維度檢查的 key 格式一致
+//
+// 記錄前以 redact 遮蔽憑證類維度的值：/v1/offenders 會原樣輸出 key
+func (e *Engine) observer(r *Rule, prefix string) middleware.DecisionHook {
+	name, backend, shadow := r.Name, r.Backend, r.Shadow
+	return func(_ *http.Request, ev middleware.DecisionEvent) {
+		e.metrics.ObserveDecision(name, ev.Dimension, backend, ev.Decision.Allowed, shadow, ev.Err, ev.Latency)
+		// Limit 為 0 表示沒有實際判定（如熔斷時 fail-closed 的拒絕），不算在 key 頭上
+		if ev.Err == nil && !ev.Decision.Allowed && ev.Decision.Limit > 0 {
+			value := ev.Key
+			if prefix == "" {
+				value = strings.TrimPrefix(value, name+":"+ev.Dimension+":")
+			}
+			e.offenders.Record(name + ":" + ev.Dimension + ":" + redact(ev.Dimension, value))
+		}
+	}
+}
+
+// redact 遮蔽憑證類維度的值（api_key 與 header:*），其他維度原樣返回。
+//
+// 為何需要遮蔽？
+//   - /v1/offenders 列出被拒絕最多的 key，API Key 原文等於把憑證公開給能讀取監控接口的人
+//   - 自訂標頭常用於傳遞權杖（如 Authorization），同樣視為憑證
+//
+// 為何用雜湊而非直接隱藏？
+//   - 仍需要知道「是不是同一個呼叫方」：相同的值得到相同的雜湊
+//   - 維運人員可以對已知的 API Key 計算雜湊，比對出是哪個客戶
+//     echo -n "$KEY" | sha256sum | cut -c1-16
+func redact(dim, value string) string {
+	if dim != DimensionAPIKey && !strings.HasPrefix(dim, "header:") {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// newLimiter 依規則建立限流器。
+//
+// local 後端以 limiter.Keyed 包裝，每個 key 各自一個桶
+// redis 後端以 limiter.Resilient 包裝，Redis 故障時依 on_failure 處理
+//
+// redis 後端的 key 以演算法名稱開頭（如 gcra:api:ip:203.0.113.7）：
+// 三種演算法的狀態分別是 Hash、Sorted Set 與字串，重新載入時改了演算法，
+// 沿用舊 key 會得到 WRONGTYPE 錯誤，這些錯誤還會讓所有 redis 規則共用的熔斷器跳閘
+func (e *Engine) newLimiter(r *Rule) limiter.Limiter {
+	if r.Backend == BackendRedis {
+		var primary limiter.Limiter
+		switch r.Algorithm {
+		case AlgorithmSlidingWindow:
+			primary = limiter.NewDistributedSlidingWindow(e.client, r.Limit, r.Window)
+		case AlgorithmGCRA:
+			primary = limiter.NewDistributedGCRA(e.client, r.Capacity, r.Rate)
+		default:
+			primary = limiter.NewDistributedTokenBucket(e.client, r.Capacity, r.Rate)
+		}
+		primary = prefixed{primary, r.Algorithm + ":"}
+
+		var fallback limiter.Limiter
+		if r.OnFailure == FailureLocal {
+			fallback = e.fallbackLimiter(r)
+		}
+		return limiter.NewResilient(primary, e.breaker, limiter.FailureMode(r.OnFailure), fallback)
+	}
+
+	return limiter.NewKeyed(localFactory(r, func(n int64) int64 { return n }), limiter.KeyedConfig{})
+}
+
+// prefixed 在 key 之前加上固定前綴的限流器。
+type prefixed struct {
+	limiter.Limiter
+	prefix string
+}
+
+func (p prefixed) Allow(ctx context.Context, key string) (limiter.Decision, error) {
+	return p.Limiter.Allow(ctx, p.prefix+key)
+}
+
+func (p prefixed) AllowN(ctx context.Context, key string, n int64) (limiter.Decision, error) {
+	return p.Limiter.AllowN(ctx, p.prefix+key, n)
+}
+
+// fallbackLimiter 建立 redis 規則降級用的本地限流器。
+//
+// 規則中的配額是全域的，每個節點只分到 1/N（N 為估算的節點數）
+// 節點數在建立每個 key 的限流器時讀取：降級期間節點數變化，新出現的 key 會用新的值
+func (e *Engine) fallbackLimiter(r *Rule) limiter.Limiter {
+	share := func(n int64) int64 { return limiter.Share(n, e.nodes.Count()) }
+	return limiter.NewKeyed(localFactory(r, share), limiter.KeyedConfig{})
+}
+
+// localFactory 依規則建立單機限流器的工廠函數。
+//
+// share 換算配額（容量、速率、上限），本地後端原樣返回，降級時按節點數平分
+func localFactory(r *Rule, share func(int64) int64) func() limiter.Limiter {
+	// 複製參數，避免閉包持有整條規則
+	capacity, rate, limit, window, buckets := r.Capacity, r.Rate, r.Limit, r.Window, r.Buckets
+	switch r.Algorithm {
+	case AlgorithmTokenBucket:
+		return func() limiter.Limiter { return limiter.NewTokenBucket(share(capacity), share(rate)) }
+	case AlgorithmLeakyBucket:
+		return func() limiter.Limiter { return limiter.NewLeakyBucket(share(capacity), share(rate)) }
+	case AlgorithmSlidingWindow:
+		return func() limiter.Limiter { return limiter.NewSlidingWindow(share(limit), window) }
+	case AlgorithmSlidingWindowCounter:
+		return func() limiter.Limiter { return limiter.NewSlidingWindowCounter(share(limit), window, buckets) }
+	case AlgorithmGCRA:
+		return func() limiter.Limiter { return limiter.NewGCRA(share(capacity), share(rate)) }
+	default:
+		panic(errors.New("policy: unvalidated algorithm " + r.Algorithm))
+	}
+}
+
+// fixedCost 規則的成本（規則本身就對應特定路由，成本固定）。
+func fixedCost(cost int64) middleware.CostFunc {
+	return func(r *http.Request) int64 { return cost }
+}
+
+// keyFunc 建立維度的 key 提取函數。
+//
+// key 格式：{規則名稱}:{維度}:{值}
+//   - 規則名稱前綴：不同規則的相同維度互不影響（Redis 中也不會衝突）
+//   - 值為空時返回空字串，該維度被跳過（如匿名請求的 user 維度）
+func keyFunc(rule, dim string) func(r *http.Request) string {
+	prefix := rule + ":" + dim + ":"
+	value := dimensionValue(dim)
+
+	return func(r *http.Request) string {
+		v := value(r)
+		if v == "" {
+			return ""
+		}
+		return prefix + v
+	}
+}
+
+// dimensionValue 返回維度在請求中的值（不含前綴）。
+func dimensionValue(dim string) func(r *http.Request) string {
+	switch dim {
+	case DimensionIP:
+		return middleware.ClientIP
+	case DimensionUser:
+		return func(r *http.Request) string { return r.Header.Get("X-User-ID") }
+	case DimensionAPIKey:
+		return func(r *http.Request) string { return r.Header.Get("X-API-Key") }
+	case DimensionPath:
+		return func(r *http.Request) string { return r.URL.Path }
+	case DimensionGlobal:
+		return func(r *http.Request) string { return "*" }
+	default:
+		header := strings.TrimPrefix(dim, "header:")
+		return func(r *http.Request) string { return r.Header.Get(header) }
+	}
+}
@@ -0,0 +1,410 @@
+// Package policy 實作宣告式限流策略。
+//
+// 問題：限流規則寫死在 Go 程式碼裡，調整一個數字就要重新編譯、部署。
+//
+// 解決：規則寫在 YAML（或 JSON）檔案中，由策略引擎編譯成中介軟體，
+// 檔案變更時自動重新載入。
+//
+// 檔案格式：
+//
+//	policies:
+//	  - name: login
+//	    priority: 100              # 數字越大越先匹配
+//	    match:
+//	      path: /api/login         # 精確匹配；以 * 結尾為前綴匹配（/api/*）
+//	      methods: [POST]
+//	      headers: {X-Plan: free}  # 值為 * 表示只要求標頭存在
+//	      clients: [10.0.0.0/8]    # 客戶端 IP 或 CIDR
+//	    algorithm: token_bucket
+//	    capacity: 5
+//	    rate: 1
+//	    dimensions: [ip]
+//	    cost: 1                    # 每個請求消耗的單位數（預設 1）
+//	    quota: {daily: 1000}       # 每個 API Key 的長週期配額（需要 Redis）
+//	    on_failure: local          # redis 後端：Redis 故障時改用本地限流（open / closed / local）
+//	    shadow: true               # 影子模式：只記錄、不拒絕（上線新規則前觀察影響範圍）
+//
+//	  - name: orders-per-customer  # 決策服務的規則（見 Engine.Check）
+//	    match:
+//	      domain: orders           # 以 domain 與描述符匹配，不匹配 HTTP 請求
+//	      descriptors: {customer_id: "*"}
+//	    algorithm: token_bucket
+//	    backend: redis
+//	    capacity: 100
+//	    rate: 10
+//
+// 設計考量：
+//   - 第一條匹配的規則生效（按 priority 由高到低），與防火牆規則相同
+//   - 同一規則的多個維度全部通過才允許請求（見 middleware.MultiDimensionRateLimit）
+//   - 未匹配任何規則的請求不限流
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/koopa0/system-design/04-rate-limiter/internal/limiter"
+	"gopkg.in/yaml.v3"
+)
+
+// 演算法名稱
+const (
+	AlgorithmTokenBucket          = "token_bucket"
+	AlgorithmLeakyBucket          = "leaky_bucket"
+	AlgorithmSlidingWindow        = "sliding_window"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	AlgorithmGCRA                 = "gcra"
+)
+
+// 狀態儲存位置
+const (
+	BackendLocal = "local" // 每個實例各自計數（limiter.Keyed）
+	BackendRedis = "redis" // 所有實例共享（Redis + Lua）
+)
+
+// Redis 故障時的處理方式（見 limiter.FailureMode）
+const (
+	FailureOpen   = "open"   // 放行（預設）
+	FailureClosed = "closed" // 拒絕
+	FailureLocal  = "local"  // 本地限流，配額按節點數平分
+)
+
+// 維度名稱
+//
+// 除了以下固定維度，"header:<Name>" 以指定標頭的值為 key
+const (
+	DimensionIP     = "ip"      // 客戶端 IP
+	DimensionUser   = "user"    // X-User-ID 標頭
+	DimensionAPIKey = "api_key" // X-API-Key 標頭
+	DimensionPath   = "path"    // 請求路徑
+	DimensionGlobal = "global"  // 所有請求共用一個配額
+)
+
+// File 策略檔案。
+type File struct {
+	Policies []Rule `yaml:"policies"`
+}
+
+// Rule 一條限流規則。
+//
+// 演算法參數：
+//   - token_bucket / leaky_bucket / gcra：capacity（容量）、rate（每秒速率）
+//   - sliding_window：limit（視窗內上限）、window（視窗大小，如 "1m"）
+//   - sliding_window_counter：limit、window、buckets（分桶數）
+type Rule struct {
+	Name     string `yaml:"name"`
+	Priority int    `yaml:"priority"`
+	Match    Match  `yaml:"match"`
+
+	Algorithm string `yaml:"algorithm"`
+	Backend   string `yaml:"backend"` // local（預設）或 redis
+
+	Capacity int64         `yaml:"capacity"`
+	Rate     int64         `yaml:"rate"`
+	Limit    int64         `yaml:"limit"`
+	Window   time.Duration `yaml:"window"`
+	Buckets  int           `yaml:"buckets"`
+
+	Dimensions []string `yaml:"dimensions"` // 預設 [ip]
+
+	// OnFailure Redis 故障（或熔斷）時的處理方式，只適用於 redis 後端
+	//
+	// 依規則性質選擇：登入接口寧可拒絕（closed），一般 API 寧可放行（open）
+	OnFailure string `yaml:"on_failure"`
+
+	// Cost 每個匹配的請求消耗的單位數（預設 1），限流與配額都按此扣除
+	//
+	// 規則以路由匹配，成本即是路由的成本：搜尋接口一條規則 cost: 10，讀取接口 cost: 1
+	Cost int64 `yaml:"cost"`
+
+	// Quota 每個 API Key（X-API-Key）的每日 / 每月配額，nil 表示不限
+	//
+	// 不同方案以不同規則表達（如以 X-Plan 標頭匹配），同一個 API Key 換方案時用量延續
+	Quota *Quota `yaml:"quota"`
+
+	// Shadow 影子模式：照常判定並記錄指標與高頻被拒絕者，但不拒絕請求
+	//
+	// 上線新規則的流程：shadow: true 觀察 ratelimit_decisions_total{mode="shadow"}
+	// 與 /v1/offenders，確認會擋下的對象符合預期後，改為 false 即可生效（計數沿用）
+	Shadow bool `yaml:"shadow"`
+}
+
+// Quota 長週期配額（0 表示該週期不限）。
+type Quota struct {
+	Daily   int64 `yaml:"daily"`
+	Monthly int64 `yaml:"monthly"`
+}
+
+// Match 規則的匹配條件（全部條件都滿足才匹配，空條件匹配所有請求）。
+//
+// 設定 Domain 的規則只用於決策服務：以 domain 與描述符匹配，
+// Path、Methods、Headers、Clients 與 dimensions 都不適用
+type Match struct {
+	Path    string            `yaml:"path"`
+	Methods []string          `yaml:"methods"`
+	Headers map[string]string `yaml:"headers"`
+	Clients []string          `yaml:"clients"`
+
+	// Domain 決策服務請求的 domain（通常是呼叫方的服務名稱）
+	Domain string `yaml:"domain"`
+
+	// Descriptors 描述符的 key 與值（值為 * 表示任意值）
+	// 描述符的 key 集合必須與此完全相同才匹配，每個不同的值各自一個配額
+	Descriptors map[string]string `yaml:"descriptors"`
+}
+
+// Parse 解析並驗證策略檔案內容。
+//
+// 使用 yaml.v3 解析：JSON 是 YAML 的子集，兩種格式都能讀
+// 未知欄位視為錯誤：拼錯的欄位名（如 "capcity"）不會被默默忽略
+func Parse(data []byte) (*File, error) {
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// validate 驗證所有規則，並填入預設值。
+//
+// 一次返回所有錯誤（errors.Join），修改檔案時不必逐個試錯
+func (f *File) validate() error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i := range f.Policies {
+		r := &f.Policies[i]
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("policies[%d]: name is required", i))
+			continue
+		}
+		if seen[r.Name] {
+			errs = append(errs, fmt.Errorf("policy %q: duplicate name", r.Name))
+		}
+		seen[r.Name] = true
+
+		if err := r.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("policy %q: %w", r.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Rule) validate() error {
+	if err := r.Match.validateDomain(); err != nil {
+		return err
+	}
+	if r.Match.Domain != "" && (len(r.Dimensions) > 0 || r.Quota != nil) {
+		return errors.New("dimensions and quota do not apply to domain rules")
+	}
+
+	if r.Backend == "" {
+		r.Backend = BackendLocal
+	}
+	if len(r.Dimensions) == 0 && r.Match.Domain == "" {
+		r.Dimensions = []string{DimensionIP}
+	}
+	if r.Cost == 0 {
+		r.Cost = 1
+	}
+
+	switch r.Algorithm {
+	case AlgorithmTokenBucket, AlgorithmLeakyBucket, AlgorithmGCRA:
+		if r.Capacity <= 0 || r.Rate <= 0 {
+			return errors.New("capacity and rate must be positive")
+		}
+		if r.Rate > limiter.MaxRate {
+			return fmt.Errorf("rate exceeds %d per second", limiter.MaxRate)
+		}
+		// 成本超過容量的請求永遠無法通過
+		if r.Cost > r.Capacity {
+			return errors.New("cost exceeds capacity")
+		}
+	case AlgorithmSlidingWindow, AlgorithmSlidingWindowCounter:
+		if r.Limit <= 0 || r.Window <= 0 {
+			return errors.New("limit and window must be positive")
+		}
+		if r.Cost > r.Limit {
+			return errors.New("cost exceeds limit")
+		}
+		if r.Algorithm == AlgorithmSlidingWindowCounter && r.Buckets <= 0 {
+			return errors.New("buckets must be positive")
+		}
+	case "":
+		return errors.New("algorithm is required")
+	default:
+		return fmt.Errorf("unknown algorithm %q", r.Algorithm)
+	}
+
+	switch r.Backend {
+	case BackendLocal:
+		if r.OnFailure != "" {
+			return errors.New("on_failure only applies to the redis backend")
+		}
+	case BackendRedis:
+		// 分散式版本只實作了令牌桶、滑動視窗與 GCRA
+		if r.Algorithm == AlgorithmLeakyBucket || r.Algorithm == AlgorithmSlidingWindowCounter {
+			return fmt.Errorf("algorithm %q is not supported by the redis backend", r.Algorithm)
+		}
+		switch r.OnFailure {
+		case "":
+			r.OnFailure = FailureOpen
+		case FailureOpen, FailureClosed, FailureLocal:
+		default:
+			return fmt.Errorf("unknown on_failure %q", r.OnFailure)
+		}
+	default:
+		return fmt.Errorf("unknown backend %q", r.Backend)
+	}
+
+	if r.Cost < 0 {
+		return errors.New("cost must not be negative")
+	}
+	if q := r.Quota; q != nil {
+		if q.Daily < 0 || q.Monthly < 0 || q.Daily == 0 && q.Monthly == 0 {
+			return errors.New("quota needs a positive daily or monthly limit")
+		}
+		// 配額用量是帳務資料：影子模式下照常扣除會影響真實用量
+		if r.Shadow {
+			return errors.New("quota cannot be used in shadow mode")
+		}
+	}
+
+	for _, dim := range r.Dimensions {
+		if !isValidDimension(dim) {
+			return fmt.Errorf("unknown dimension %q", dim)
+		}
+	}
+	if slices.Contains(r.Match.Methods, "") {
+		return errors.New("empty method in match")
+	}
+	for _, c := range r.Match.Clients {
+		if _, err := parseClient(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDomain 檢查決策服務的匹配條件不與 HTTP 匹配條件混用。
+func (m *Match) validateDomain() error {
+	if m.Domain == "" {
+		if len(m.Descriptors) > 0 {
+			return errors.New("descriptors require a domain")
+		}
+		return nil
+	}
+	if m.Path != "" || len(m.Methods) > 0 || len(m.Headers) > 0 || len(m.Clients) > 0 {
+		return errors.New("domain rules cannot match HTTP requests")
+	}
+	if len(m.Descriptors) == 0 {
+		return errors.New("domain rules need descriptors")
+	}
+	for key, value := range m.Descriptors {
+		if key == "" || value == "" {
+			return errors.New("empty descriptor key or value")
+		}
+	}
+	return nil
+}
+
+// sameLimiter 兩條規則的限流器是否可以共用（演算法與參數相同）。
+//
+// 重新載入時，只改了匹配條件或優先級的規則保留原有的限流器狀態
+func (r *Rule) sameLimiter(o *Rule) bool {
+	return r.Algorithm == o.Algorithm &&
+		r.Backend == o.Backend &&
+		r.Capacity == o.Capacity &&
+		r.Rate == o.Rate &&
+		r.Limit == o.Limit &&
+		r.Window == o.Window &&
+		r.Buckets == o.Buckets &&
+		r.OnFailure == o.OnFailure
+}
+
+func isValidDimension(dim string) bool {
+	switch dim {
+	case DimensionIP, DimensionUser, DimensionAPIKey, DimensionPath, DimensionGlobal:
+		return true
+	}
+	name, ok := strings.CutPrefix(dim, "header:")
+	return ok && name != ""
+}
+
+// parseClient 將 IP 或 CIDR 解析為網段（單一 IP 視為 /32 或 /128）。
+func parseClient(s string) (*net.IPNet, error) {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid client %q (want IP or CIDR)", s)
+	}
+	bits := 8 * len(ip)
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// matcher 編譯後的匹配條件。
+type matcher struct {
+	path    string
+	prefix  bool
+	methods []string
+	headers map[string]string
+	clients []*net.IPNet
+}
+
+func newMatcher(m Match) *matcher {
+	mt := &matcher{headers: m.Headers}
+	mt.path, mt.prefix = strings.CutSuffix(m.Path, "*")
+	for _, method := range m.Methods {
+		mt.methods = append(mt.methods, strings.ToUpper(method))
+	}
+	for _, c := range m.Clients {
+		n, _ := parseClient(c) // 已在 validate 檢查過
+		mt.clients = append(mt.clients, n)
+	}
+	return mt
+}
+
+// match 請求是否滿足所有條件。
+func (m *matcher) match(r *http.Request, clientIP string) bool {
+	if m.prefix {
+		if !strings.HasPrefix(r.URL.Path, m.path) {
+			return false
+		}
+	} else if m.path != "" && r.URL.Path != m.path {
+		return false
+	}
+
+	if len(m.methods) > 0 && !slices.Contains(m.methods, r.Method) {
+		return false
+	}
+
+	for name, want := range m.headers {
+		got := r.Header.Get(name)
+		if got == "" || (want != "*" && got != want) {
+			return false
+		}
+	}
+
+	if len(m.clients) > 0 {
+		ip := net.ParseIP(clientIP)
+		if ip == nil || !slices.ContainsFunc(m.clients, func(n *net.IPNet) bool { return n.Contains(ip) }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,411 @@
+package policy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+)
+
+func TestParseExample(t *testing.T) {
+	data, err := os.ReadFile("../../policy.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse(policy.example.yaml) error: %v", err)
+	}
+	if len(f.Policies) == 0 {
+		t.Fatal("Parse(policy.example.yaml) returned no policies")
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	f, err := Parse([]byte(`
+policies:
+  - name: api
+    algorithm: token_bucket
+    capacity: 10
+    rate: 5
+  - name: shared
+    algorithm: gcra
+    backend: redis
+    capacity: 10
+    rate: 5
+  - name: orders
+    match:
+      domain: orders
+      descriptors: {customer_id: "*"}
+    algorithm: sliding_window
+    limit: 10
+    window: 1m
+`))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	api, shared, orders := f.Policies[0], f.Policies[1], f.Policies[2]
+	if api.Backend != BackendLocal || len(api.Dimensions) != 1 || api.Dimensions[0] != DimensionIP || api.Cost != 1 {
+		t.Errorf("api = %+v, want local backend, [ip] dimensions and cost 1", api)
+	}
+	if shared.OnFailure != FailureOpen {
+		t.Errorf("shared.OnFailure = %q, want %q", shared.OnFailure, FailureOpen)
+	}
+	if len(orders.Dimensions) != 0 || orders.Window != time.Minute {
+		t.Errorf("orders = %+v, want no dimensions and a 1m window", orders)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string // 錯誤訊息應包含的片段
+	}{
+		{"unknown field", "policies:\n  - name: a\n    algorithm: token_bucket\n    capcity: 5\n    rate: 1", "capcity"},
+		{"missing name", "policies:\n  - algorithm: token_bucket\n    capacity: 5\n    rate: 1", "name is required"},
+		{"duplicate name", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1}\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1}", "duplicate name"},
+		{"missing algorithm", "policies:\n  - {name: a, capacity: 5, rate: 1}", "algorithm is required"},
+		{"unknown algorithm", "policies:\n  - {name: a, algorithm: fixed_window, limit: 5, window: 1m}", "unknown algorithm"},
+		{"zero rate", "policies:\n  - {name: a, algorithm: token_bucket, capacity: 5}", "capacity and rate must be positive"},
+		{"rate too high", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 2000000000}", "rate exceeds"},
+		{"missing window", "policies:\n  - {name: a, algorithm: sliding_window, limit: 5}", "limit and window must be positive"},
+		{"missing buckets", "policies:\n  - {name: a, algorithm: sliding_window_counter, limit: 5, window: 1m}", "buckets must be positive"},
+		{"cost exceeds capacity", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, cost: 6}", "cost exceeds capacity"},
+		{"negative cost", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, cost: -1}", "cost must not be negative"},
+		{"unknown backend", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, backend: memcached}", "unknown backend"},
+		{"redis leaky bucket", "policies:\n  - {name: a, algorithm: leaky_bucket, capacity: 5, rate: 1, backend: redis}", "not supported by the redis backend"},
+		{"on_failure on local", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, on_failure: closed}", "only applies to the redis backend"},
+		{"unknown on_failure", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, backend: redis, on_failure: retry}", "unknown on_failure"},
+		{"unknown dimension", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, dimensions: [cookie]}", "unknown dimension"},
+		{"empty header dimension", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, dimensions: ['header:']}", "unknown dimension"},
+		{"invalid client", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, match: {clients: [10.0.0.0/33]}}", "invalid client"},
+		{"empty quota", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, quota: {}}", "positive daily or monthly"},
+		{"shadow quota", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, shadow: true, quota: {daily: 10}}", "shadow mode"},
+		{"descriptors without domain", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, match: {descriptors: {k: v}}}", "require a domain"},
+		{"domain with path", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, match: {domain: d, path: /x, descriptors: {k: v}}}", "cannot match HTTP requests"},
+		{"domain without descriptors", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, match: {domain: d}}", "need descriptors"},
+		{"domain with dimensions", "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, dimensions: [ip], match: {domain: d, descriptors: {k: v}}}", "do not apply to domain rules"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseReportsAllErrors 一次返回所有規則的錯誤。
+func TestParseReportsAllErrors(t *testing.T) {
+	_, err := Parse([]byte(`
+policies:
+  - {name: a, algorithm: gcra, capacity: 0, rate: 1}
+  - {name: b, algorithm: gcra, capacity: 5, rate: 1, dimensions: [cookie]}
+`))
+	if err == nil || !strings.Contains(err.Error(), `policy "a"`) || !strings.Contains(err.Error(), `policy "b"`) {
+		t.Errorf("Parse() error = %v, want errors for both policies", err)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	m := newMatcher(Match{
+		Path:    "/api/*",
+		Methods: []string{"post", "PUT"},
+		Headers: map[string]string{"X-Plan": "free", "X-API-Key": "*"},
+		Clients: []string{"10.0.0.0/8", "192.0.2.1"},
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		headers  map[string]string
+		clientIP string
+		want     bool
+	}{
+		{"all conditions", "POST", "/api/orders", map[string]string{"X-Plan": "free", "X-API-Key": "k"}, "10.1.2.3", true},
+		{"single client IP", "PUT", "/api/orders", map[string]string{"X-Plan": "free", "X-API-Key": "k"}, "192.0.2.1", true},
+		{"path outside prefix", "POST", "/health", map[string]string{"X-Plan": "free", "X-API-Key": "k"}, "10.1.2.3", false},
+		{"method", "GET", "/api/orders", map[string]string{"X-Plan": "free", "X-API-Key": "k"}, "10.1.2.3", false},
+		{"header value", "POST", "/api/orders", map[string]string{"X-Plan": "paid", "X-API-Key": "k"}, "10.1.2.3", false},
+		{"wildcard header missing", "POST", "/api/orders", map[string]string{"X-Plan": "free"}, "10.1.2.3", false},
+		{"client outside range", "POST", "/api/orders", map[string]string{"X-Plan": "free", "X-API-Key": "k"}, "192.0.2.2", false},
+		{"unparsable client", "POST", "/api/orders", map[string]string{"X-Plan": "free", "X-API-Key": "k"}, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := m.match(r, tt.clientIP); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	exact := newMatcher(Match{Path: "/api/login"})
+	if !exact.match(httptest.NewRequest("GET", "/api/login", nil), "") || exact.match(httptest.NewRequest("GET", "/api/login/2fa", nil), "") {
+		t.Error("exact path matcher matched the wrong paths")
+	}
+}
+
+// writePolicy 寫入策略檔案，並將修改時間設為 version 秒之後（確保 Reload 看得到變更）。
+func writePolicy(t *testing.T, path, content string, version int) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Duration(version) * time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve 以引擎的中介軟體處理一個請求，返回狀態碼。
+func serve(e *Engine, path string) int {
+	handler := e.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("GET", path, nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec.Code
+}
+
+func TestEngineReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	const policy = `
+policies:
+  - name: api
+    priority: %d
+    match: {path: /api/*}
+    algorithm: token_bucket
+    capacity: %d
+    rate: 1
+`
+	writePolicy(t, path, fmt.Sprintf(policy, 0, 2), 0)
+	e, err := NewEngine(path, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+
+	for i := range 2 {
+		if code := serve(e, "/api/x"); code != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200", i, code)
+		}
+	}
+	if code := serve(e, "/api/x"); code != http.StatusTooManyRequests {
+		t.Fatalf("request beyond capacity = %d, want 429", code)
+	}
+	if code := serve(e, "/health"); code != http.StatusOK {
+		t.Errorf("unmatched request = %d, want 200", code)
+	}
+
+	// 未變更：不重新載入
+	if changed, err := e.Reload(); changed || err != nil {
+		t.Errorf("Reload() without changes = %v, %v", changed, err)
+	}
+
+	// 無效的檔案：保留舊策略（及其計數）
+	writePolicy(t, path, "policies:\n  - {name: api, algorithm: token_bucket}", 1)
+	if changed, err := e.Reload(); changed || err == nil {
+		t.Errorf("Reload() of an invalid file = %v, %v, want an error", changed, err)
+	}
+	if code := serve(e, "/api/x"); code != http.StatusTooManyRequests {
+		t.Errorf("after failed reload = %d, want the old policy still enforced", code)
+	}
+
+	// 只改優先級：沿用限流器，計數不歸零
+	writePolicy(t, path, fmt.Sprintf(policy, 10, 2), 2)
+	if changed, err := e.Reload(); !changed || err != nil {
+		t.Fatalf("Reload() = %v, %v, want the policy replaced", changed, err)
+	}
+	if code := serve(e, "/api/x"); code != http.StatusTooManyRequests {
+		t.Errorf("after priority change = %d, want the drained bucket kept", code)
+	}
+
+	// 改容量：建立新的限流器
+	writePolicy(t, path, fmt.Sprintf(policy, 10, 5), 3)
+	if changed, err := e.Reload(); !changed || err != nil {
+		t.Fatalf("Reload() = %v, %v, want the policy replaced", changed, err)
+	}
+	if code := serve(e, "/api/x"); code != http.StatusOK {
+		t.Errorf("after capacity change = %d, want a fresh limiter", code)
+	}
+}
+
+// TestEngineShadowAboveEnforcing 優先級較高的影子規則只觀察，不會讓下方的生效規則失效。
+func TestEngineShadowAboveEnforcing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, `
+policies:
+  - name: trial
+    priority: 10
+    shadow: true
+    match: {path: /api/*}
+    algorithm: token_bucket
+    capacity: 1
+    rate: 1
+  - name: api
+    match: {path: /api/*}
+    algorithm: token_bucket
+    capacity: 2
+    rate: 1
+`, 0)
+	e, err := NewEngine(path, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+
+	var codes []int
+	for range 5 {
+		codes = append(codes, serve(e, "/api/orders"))
+	}
+	want := []int{200, 200, 429, 429, 429}
+	if fmt.Sprint(codes) != fmt.Sprint(want) {
+		t.Errorf("status codes = %v, want %v (the enforcing rule applies under the shadow rule)", codes, want)
+	}
+
+	// 影子規則照常判定：超過它的容量的請求記錄為被拒絕者（容量 1 → 4 次，生效規則容量 2 → 3 次）
+	top := e.offenders.Top()
+	if len(top) != 2 || top[0].Key != "trial:ip:192.0.2.1" || top[0].Count != 4 || top[1].Key != "api:ip:192.0.2.1" || top[1].Count != 3 {
+		t.Errorf("offenders = %+v, want 4 shadow and 3 enforced denials", top)
+	}
+}
+
+func TestEngineRequiresRedis(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "policies:\n  - {name: a, algorithm: gcra, capacity: 5, rate: 1, backend: redis}", 0)
+	if _, err := NewEngine(path, nil); err == nil || !strings.Contains(err.Error(), "require a redis connection") {
+		t.Errorf("NewEngine() error = %v, want a missing redis error", err)
+	}
+}
+
+// TestEngineReloadAlgorithm redis 規則改了演算法：新的 key 與舊狀態的資料型別不衝突。
+//
+// 沿用同一個 key 時，滑動視窗對 GCRA 的字串執行 ZCARD 得到 WRONGTYPE，
+// 請求因 fail-open 全部放行，限流形同失效
+func TestEngineReloadAlgorithm(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{
+		Addr:                     s.Addr(),
+		MaintNotificationsConfig: &maintnotifications.Config{Mode: maintnotifications.ModeDisabled},
+	})
+	t.Cleanup(func() { client.Close() })
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "policies:\n  - {name: api, algorithm: gcra, capacity: 5, rate: 1, backend: redis}", 0)
+	e, err := NewEngine(path, client)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+	if code := serve(e, "/api/x"); code != http.StatusOK {
+		t.Fatalf("gcra request = %d, want 200", code)
+	}
+
+	writePolicy(t, path, "policies:\n  - {name: api, algorithm: sliding_window, limit: 2, window: 1m, backend: redis}", 1)
+	if changed, err := e.Reload(); !changed || err != nil {
+		t.Fatalf("Reload() = %v, %v, want the policy replaced", changed, err)
+	}
+	var codes []int
+	for range 3 {
+		codes = append(codes, serve(e, "/api/x"))
+	}
+	if want := []int{200, 200, 429}; fmt.Sprint(codes) != fmt.Sprint(want) {
+		t.Errorf("status codes after the algorithm change = %v, want %v", codes, want)
+	}
+
+	keys := s.Keys()
+	for _, key := range []string{"gcra:api:ip:192.0.2.1", "sliding_window:api:ip:192.0.2.1"} {
+		if !slices.Contains(keys, key) {
+			t.Errorf("redis keys = %v, want %s", keys, key)
+		}
+	}
+}
+
+func TestEngineWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "policies: []", 0)
+	e, err := NewEngine(path, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Watch(ctx, 5*time.Millisecond)
+
+	writePolicy(t, path, "policies:\n  - {name: all, algorithm: token_bucket, capacity: 1, rate: 1}", 1)
+	deadline := time.Now().Add(time.Second)
+	for serve(e, "/") != http.StatusTooManyRequests {
+		if time.Now().After(deadline) {
+			t.Fatal("policy change not picked up by Watch")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		dim, value, want string
+	}{
+		{DimensionIP, "203.0.113.7", "203.0.113.7"},
+		{DimensionUser, "alice", "alice"},
+		{DimensionAPIKey, "sk_live_abc", "sha256:" + sha256Prefix("sk_live_abc")},
+		{"header:Authorization", "Bearer t0ken", "sha256:" + sha256Prefix("Bearer t0ken")},
+	}
+	for _, tt := range tests {
+		if got := redact(tt.dim, tt.value); got != tt.want {
+			t.Errorf("redact(%s, %q) = %q, want %q", tt.dim, tt.value, got, tt.want)
+		}
+	}
+}
+
+// sha256Prefix 與 README 中的 echo -n "$KEY" | sha256sum | cut -c1-16 相同。
+func sha256Prefix(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// TestEngineOffendersRedacted 被拒絕的 API Key 以雜湊記錄，/v1/offenders 不輸出原文。
+func TestEngineOffendersRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "policies:\n  - {name: partner, algorithm: token_bucket, capacity: 1, rate: 1, dimensions: [api_key]}", 0)
+	e, err := NewEngine(path, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+
+	handler := e.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for range 3 {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-API-Key", "sk_live_abc")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	rec := httptest.NewRecorder()
+	e.OffendersHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/offenders", nil))
+	body := rec.Body.String()
+	if strings.Contains(body, "sk_live_abc") {
+		t.Fatalf("offenders exposes the raw API key: %s", body)
+	}
+	if want := "partner:api_key:sha256:" + sha256Prefix("sk_live_abc"); !strings.Contains(body, want) {
+		t.Errorf("offenders = %s, want %s", body, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Cache Node 快取節點程序
+//
+// 每個程序持有一部分資料，DistributedCache 以一致性雜湊決定 key 存放在哪個節點：
+//
+//	NODE_ADDR=:7001 go run ./cmd/node
+//	NODE_ADDR=:7002 go run ./cmd/node
+//	CACHE_NODES=localhost:7001,localhost:7002 go run ./cmd/server
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/koopa0/system-design/05-distributed-cache/internal/cache"
+	"github.com/koopa0/system-design/05-distributed-cache/internal/node"
+)
+
+func main() {
+	addr := getEnv("NODE_ADDR", ":7001")
+	capacity, err := strconv.Atoi(getEnv("NODE_CAPACITY", "100000"))
+	if err != nil || capacity <= 0 {
+		log.Fatalf("NODE_CAPACITY 必須是正整數：%q", os.Getenv("NODE_CAPACITY"))
+	}
+
+	// 值大小差異大時以位元組數限制容量（0 表示只限制項目數）
+	maxBytes, err := strconv.ParseInt(getEnv("NODE_MAX_BYTES", "0"), 10, 64)
+	if err != nil || maxBytes < 0 {
+		log.Fatalf("NODE_MAX_BYTES 必須是非負整數：%q", os.Getenv("NODE_MAX_BYTES"))
+	}
+
+	// 多核心時分片以減少鎖競爭（1 表示不分片），讀取緩衝見 cache.Sharded
+	shards, err := strconv.Atoi(getEnv("NODE_SHARDS", "1"))
+	if err != nil || shards <= 0 {
+		log.Fatalf("NODE_SHARDS 必須是正整數：%q", os.Getenv("NODE_SHARDS"))
+	}
+	readBuffer, err := strconv.Atoi(getEnv("NODE_READ_BUFFER", "0"))
+	if err != nil || readBuffer < 0 {
+		log.Fatalf("NODE_READ_BUFFER 必須是非負整數：%q", os.Getenv("NODE_READ_BUFFER"))
+	}
+
+	policy := getEnv("NODE_POLICY", "lru")
+	var newCache func(config cache.Config) cache.Cache
+	switch policy {
+	case "lru":
+		newCache = func(config cache.Config) cache.Cache { return cache.NewLRUWithConfig(config) }
+	case "lfu":
+		newCache = func(config cache.Config) cache.Cache { return cache.NewLFUWithConfig(config) }
+	case "tinylfu":
+		newCache = func(config cache.Config) cache.Cache { return cache.NewWTinyLFU(config.Capacity) }
+	case "arc":
+		newCache = func(config cache.Config) cache.Cache { return cache.NewARC(config.Capacity) }
+	default:
+		log.Fatalf("不支援的淘汰策略：%s（lru / lfu / tinylfu / arc）", policy)
+	}
+
+	// W-TinyLFU 與 ARC 的區段比例以項目數計算，不支援位元組上限
+	if (policy == "tinylfu" || policy == "arc") && maxBytes > 0 {
+		log.Fatalf("淘汰策略 %s 不支援 NODE_MAX_BYTES", policy)
+	}
+
+	config := cache.Config{Capacity: capacity, MaxBytes: maxBytes}
+	var c cache.Cache
+	if shards > 1 {
+		c = cache.NewSharded(cache.ShardedConfig{
+			Config:     config,
+			Shards:     shards,
+			NewShard:   newCache,
+			ReadBuffer: readBuffer,
+		})
+	} else {
+		c = newCache(config)
+	}
+
+	server := node.NewServer(c)
+
+	// 優雅關閉
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		<-sigChan
+
+		log.Println("正在關閉快取節點...")
+		server.Close()
+	}()
+
+	log.Printf("快取節點啟動於 %s（策略 %s，容量 %d，位元組上限 %d，分片 %d）", addr, policy, capacity, maxBytes, shards)
+	if err := server.ListenAndServe(addr); err != nil && !errors.Is(err, node.ErrServerClosed) {
+		log.Fatalf("快取節點啟動失敗：%v", err)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -66,9 +67,17 @@ func main() {
 	// 示範 2：LFU 快取
 	demonstrateLFU()
 
+	// 示範 2b：過期與位元組容量
+	demonstrateExpiry()
+
 	// 示範 3：分散式快取
 	demonstrateDistributed()
 
+	// 示範 3b：跨程序的分散式快取（需先啟動 cmd/node）
+	if addrs := getEnv("CACHE_NODES", ""); addrs != "" {
+		demonstrateRemote(strings.Split(addrs, ","))
+	}
+
 	// 示範 4：快取策略
 	demonstrateStrategies()
 
@@ -126,6 +135,25 @@ func demonstrateLFU() {
 	log.Printf("寫入 'd' 後，頻率分布=%v (淘汰了頻率最低的 'c')", stats.FreqDist)
 }
 
+// demonstrateExpiry 展示 TTL 與位元組容量上限。
+func demonstrateExpiry() {
+	log.Println("\n=== 過期與容量示範 ===")
+
+	lru := cache.NewLRUWithConfig(cache.Config{MaxBytes: 1024})
+
+	lru.Set("page:home", make([]byte, 600))
+	lru.Set("page:about", make([]byte, 600)) // 超過 1 KB，淘汰 page:home
+	lru.Delete("page:about")
+	lru.SetWithTTL("session:1", "token", 50*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok := lru.Get("session:1")
+	log.Printf("session:1 過期後讀取，命中：%v", ok)
+
+	stats := lru.Evictions()
+	log.Printf("移除次數：容量=%d, 過期=%d, 刪除=%d", stats.Capacity, stats.Expired, stats.Deleted)
+}
+
 // demonstrateDistributed 展示分散式快取。
 func demonstrateDistributed() {
 	log.Println("\n=== 分散式快取示範 ===")
@@ -160,6 +188,28 @@ func demonstrateDistributed() {
 	log.Printf("當前節點：%v", dc.Nodes())
 }
 
+// demonstrateRemote 展示跨程序的分散式快取。
+//
+// 每個位址是一個快取節點程序（cmd/node），資料真正分散在不同程序中
+func demonstrateRemote(addrs []string) {
+	log.Println("\n=== 跨程序分散式快取示範 ===")
+
+	dc := cache.NewRemoteDistributedCache(addrs, cache.RemoteConfig{})
+
+	for i := 1; i <= 10; i++ {
+		key := fmt.Sprintf("user:%d", 1000+i)
+		dc.Set(key, fmt.Sprintf("data_%s", key))
+	}
+
+	value, ok := dc.Get("user:1001")
+	log.Printf("讀取 user:1001：%v（命中：%v）", value, ok)
+
+	log.Println("資料分布：")
+	for _, stat := range dc.GetStats() {
+		log.Printf("  %s: %d 筆資料", stat.Node, stat.Size)
+	}
+}
+
 // demonstrateStrategies 展示快取策略。
 func demonstrateStrategies() {
 	log.Println("\n=== 快取策略示範 ===")
@@ -0,0 +1,374 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ARC 的四個鏈表
+const (
+	arcT1 = iota // 最近只被存取一次（保存值）
+	arcT2        // 最近被存取至少兩次（保存值）
+	arcB1        // 從 T1 淘汰的 key（幽靈，只保存 key）
+	arcB2        // 從 T2 淘汰的 key（幽靈，只保存 key）
+)
+
+// ARC 實作 Adaptive Replacement Cache（Megiddo & Modha, 2003）。
+//
+// 問題：LRU 與 LFU 各有擅長的存取模式，但存取模式會變
+//
+//	偏重最近性（新資料很快被再次讀取）：LRU 較好
+//	偏重頻率（少數熱點反覆讀取）：LFU 較好
+//
+// ARC 的想法：同時維護兩邊，並依實際命中情況自動調整兩邊的大小
+//
+//	        ◀── p ──▶
+//	  B1 ··· [ T1 ][ T2 ] ··· B2
+//	  幽靈    最近性  頻率    幽靈
+//
+//	T1 + T2 = 快取容量 c（保存值）
+//	B1、B2 只保存 key，記錄「剛被淘汰的是誰」
+//
+// 自我調整：
+//   - 新寫入的 key 在 B1 中：T1 太小（如果 T1 大一點就命中了）→ p 增加
+//   - 新寫入的 key 在 B2 中：T2 太小 → p 減少
+//   - 淘汰時依 p 決定從 T1 還是 T2 淘汰
+//
+// 抵抗掃描：
+//
+//	掃描的資料只被存取一次，停留在 T1；T2 中被存取兩次以上的熱點不受影響
+//
+// 時間複雜度：Get / Set 皆為 O(1)
+//
+// 記憶體：幽靈鏈表最多再保存 c 個 key（不含值）
+//
+// 注意：Cache 介面中 Get 未命中之後才 Set，ARC 的「幽靈命中」在 Set 時判斷
+type ARC struct {
+	capacity int
+	p        int // T1 的目標大小（0 ~ capacity）
+
+	cache map[string]*list.Element
+	lists [4]*list.List
+
+	expiring expiring
+	writes   int
+	stats    EvictionStats
+	mu       sync.RWMutex
+}
+
+// arcEntry 是 ARC 的節點（幽靈節點的 value 為 nil）。
+type arcEntry struct {
+	meta
+	value interface{}
+	where int
+}
+
+// NewARC 建立 ARC 快取。
+func NewARC(capacity int) *ARC {
+	c := &ARC{
+		capacity: max(capacity, 0),
+		cache:    make(map[string]*list.Element),
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+// Get 取得快取值。
+//
+// 行為：
+//   - 命中 T1 或 T2：移到 T2 頭部（被存取至少兩次）
+//   - 幽靈命中或未命中：返回未命中（由之後的 Set 處理）
+func (c *ARC) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	ent := elem.Value.(*arcEntry)
+	if ent.where != arcT1 && ent.where != arcT2 {
+		return nil, false
+	}
+	if !ent.expireAt.IsZero() && ent.expired(time.Now()) {
+		c.removeElement(elem, EvictExpired)
+		return nil, false
+	}
+
+	c.move(elem, arcT2)
+	return ent.value, true
+}
+
+// peek 以讀鎖查詢，不移動節點（Sharded 的讀取緩衝使用）。
+func (c *ARC) peek(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if elem, ok := c.cache[key]; ok {
+		ent := elem.Value.(*arcEntry)
+		if (ent.where == arcT1 || ent.where == arcT2) && (ent.expireAt.IsZero() || !ent.expired(time.Now())) {
+			return ent.value, true
+		}
+	}
+	return nil, false
+}
+
+// touch 批次將讀取過的項目移到 T2（Sharded 的讀取緩衝使用）。
+//
+// 幽靈與不存在的 key 忽略（幽靈命中在 Set 時處理）
+func (c *ARC) touch(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		elem, ok := c.cache[key]
+		if !ok {
+			continue
+		}
+		ent := elem.Value.(*arcEntry)
+		if ent.where != arcT1 && ent.where != arcT2 {
+			continue
+		}
+		if !ent.expireAt.IsZero() && ent.expired(now) {
+			c.removeElement(elem, EvictExpired)
+			continue
+		}
+		c.move(elem, arcT2)
+	}
+}
+
+// Set 設定快取值（覆寫會清除原本的 TTL）。
+func (c *ARC) Set(key string, value interface{}) {
+	c.set(key, value, time.Time{})
+}
+
+// SetWithTTL 設定快取值與存活時間（ttl <= 0 表示永不過期）。
+func (c *ARC) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	c.set(key, value, expireAt(ttl))
+}
+
+// set 寫入快取值。
+//
+// 依論文的四種情況：
+//
+//  1. 在 T1 / T2 中：更新值，移到 T2
+//  2. 在 B1 中：p 增加，淘汰一個項目後放入 T2
+//  3. 在 B2 中：p 減少，淘汰一個項目後放入 T2
+//  4. 都不在：必要時修剪幽靈鏈表、淘汰一個項目，放入 T1
+func (c *ARC) set(key string, value interface{}, expireAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity == 0 {
+		return
+	}
+
+	c.writes++
+	if c.writes%activeExpireEvery == 0 {
+		c.expiring.sweep(time.Now(), expireMaxRounds, c.expire)
+	}
+
+	t1, t2, b1, b2 := c.lists[arcT1], c.lists[arcT2], c.lists[arcB1], c.lists[arcB2]
+
+	if elem, ok := c.cache[key]; ok {
+		ent := elem.Value.(*arcEntry)
+		switch ent.where {
+		case arcT1, arcT2:
+			ent.value = value
+			c.setExpiry(&ent.meta, expireAt)
+			c.move(elem, arcT2)
+			return
+
+		case arcB1:
+			// 最近性那一邊的幽靈命中：擴大 T1 的目標
+			// 調整幅度為 |B2| / |B1|：B1 越小，每次命中越珍貴
+			c.p = min(c.p+max(b2.Len()/b1.Len(), 1), c.capacity)
+			c.replace(false)
+
+		case arcB2:
+			// 頻率那一邊的幽靈命中：縮小 T1 的目標
+			c.p = max(c.p-max(b1.Len()/b2.Len(), 1), 0)
+			c.replace(true)
+		}
+
+		// 幽靈復活：放回 T2（曾經被存取過，這是第二次）
+		ent.value = value
+		c.setExpiry(&ent.meta, expireAt)
+		c.move(elem, arcT2)
+		return
+	}
+
+	// 全新的 key
+	switch {
+	case t1.Len()+b1.Len() == c.capacity:
+		if t1.Len() < c.capacity {
+			c.removeElement(b1.Back(), EvictCapacity)
+			c.replace(false)
+		} else {
+			// B1 為空、T1 已滿：直接淘汰 T1 的 LRU（不留幽靈）
+			c.removeElement(t1.Back(), EvictCapacity)
+		}
+	case t1.Len()+t2.Len()+b1.Len()+b2.Len() >= c.capacity:
+		if t1.Len()+t2.Len()+b1.Len()+b2.Len() == 2*c.capacity {
+			c.removeElement(b2.Back(), EvictCapacity)
+		}
+		c.replace(false)
+	}
+
+	ent := &arcEntry{meta: meta{key: key, expIdx: -1}, value: value, where: arcT1}
+	c.setExpiry(&ent.meta, expireAt)
+	c.cache[key] = t1.PushFront(ent)
+}
+
+// replace 淘汰一個項目到幽靈鏈表，騰出一個位置。
+//
+// T1 超過目標大小 p 時從 T1 淘汰，否則從 T2 淘汰
+// inB2 表示觸發的 key 在 B2 中（此時 T1 等於 p 也從 T1 淘汰，論文中的邊界條件）
+//
+// 與論文的差異：論文沒有刪除操作，呼叫時快取必定已滿；
+// 這裡 Delete 與過期會留下空位，有空位時不淘汰
+func (c *ARC) replace(inB2 bool) {
+	t1, t2 := c.lists[arcT1], c.lists[arcT2]
+	if t1.Len()+t2.Len() < c.capacity {
+		return
+	}
+	if t1.Len() > 0 && (t1.Len() > c.p || inB2 && t1.Len() == c.p) {
+		c.demote(t1.Back(), arcB1)
+	} else if t2.Len() > 0 {
+		c.demote(t2.Back(), arcB2)
+	} else if t1.Len() > 0 {
+		c.demote(t1.Back(), arcB1)
+	}
+}
+
+// demote 將項目淘汰為幽靈（丟棄值，保留 key）。
+func (c *ARC) demote(elem *list.Element, ghost int) {
+	ent := elem.Value.(*arcEntry)
+	ent.value = nil
+	c.expiring.remove(&ent.meta)
+	ent.expireAt = time.Time{}
+	c.move(elem, ghost)
+	c.stats.record(EvictCapacity)
+}
+
+// move 將節點移到指定鏈表的頭部。
+func (c *ARC) move(elem *list.Element, where int) {
+	ent := elem.Value.(*arcEntry)
+	if ent.where == where {
+		c.lists[where].MoveToFront(elem)
+		return
+	}
+	c.lists[ent.where].Remove(elem)
+	ent.where = where
+	c.cache[ent.key] = c.lists[where].PushFront(ent)
+}
+
+// removeElement 完全移除節點（不留幽靈）。
+//
+// 幽靈節點的移除不計入統計：值早在成為幽靈時就已經被淘汰
+func (c *ARC) removeElement(elem *list.Element, reason EvictionReason) {
+	ent := elem.Value.(*arcEntry)
+	c.lists[ent.where].Remove(elem)
+	delete(c.cache, ent.key)
+	if ent.where == arcT1 || ent.where == arcT2 {
+		c.expiring.remove(&ent.meta)
+		c.stats.record(reason)
+	}
+}
+
+// setExpiry 更新項目的過期時間，並維護有 TTL 的項目集合。
+func (c *ARC) setExpiry(m *meta, expireAt time.Time) {
+	m.expireAt = expireAt
+	if expireAt.IsZero() {
+		c.expiring.remove(m)
+	} else {
+		c.expiring.add(m)
+	}
+}
+
+// expire 移除過期項目（主動過期的回呼）。
+//
+// 過期不是淘汰決策，不放入幽靈鏈表（否則會誤導 p 的調整）
+func (c *ARC) expire(m *meta) {
+	c.removeElement(c.cache[m.key], EvictExpired)
+}
+
+// Delete 刪除快取項目（連同幽靈記錄）。
+func (c *ARC) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.cache[key]; ok {
+		c.removeElement(elem, EvictDeleted)
+	}
+}
+
+// Expire 只修改 key 的存活時間（ttl <= 0 表示永不過期），返回 key 是否存在（見 LRU.Expire）。
+//
+// 幽靈記錄沒有值，視為不存在；不在鏈表間移動（修改 TTL 不算一次命中）
+func (c *ARC) Expire(key string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	ent := elem.Value.(*arcEntry)
+	if ent.where != arcT1 && ent.where != arcT2 {
+		return false
+	}
+	if ent.expired(time.Now()) {
+		c.removeElement(elem, EvictExpired)
+		return false
+	}
+	c.setExpiry(&ent.meta, expireAt(ttl))
+	return true
+}
+
+// Remove 刪除 key（連同幽靈記錄），返回刪除前是否存在（見 LRU.Remove）。
+func (c *ARC) Remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	ent := elem.Value.(*arcEntry)
+	switch {
+	case ent.where != arcT1 && ent.where != arcT2:
+		c.removeElement(elem, EvictDeleted) // 幽靈不計入統計
+		return false
+	case ent.expired(time.Now()):
+		c.removeElement(elem, EvictExpired)
+		return false
+	}
+	c.removeElement(elem, EvictDeleted)
+	return true
+}
+
+// Len 返回當前快取項目數量（T1 + T2，不含幽靈）。
+func (c *ARC) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lists[arcT1].Len() + c.lists[arcT2].Len()
+}
+
+// RemoveExpired 立即清理過期項目，返回清理的數量（見 LRU.RemoveExpired）。
+func (c *ARC) RemoveExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expiring.sweep(time.Now(), 0, c.expire)
+}
+
+// Evictions 返回按原因分類的移除次數（累計值）。
+func (c *ARC) Evictions() EvictionStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// checkARC 檢查 ARC 的不變量（論文中的 I1 ~ I4）。
+//
+//	|T1| + |T2| ≤ c       保存值的項目不超過容量
+//	|T1| + |B1| ≤ c       最近性那一邊（含幽靈）不超過容量
+//	|T1|+|T2|+|B1|+|B2| ≤ 2c
+//	0 ≤ p ≤ c
+func checkARC(t *testing.T, c *ARC) {
+	t.Helper()
+	t1, t2 := c.lists[arcT1].Len(), c.lists[arcT2].Len()
+	b1, b2 := c.lists[arcB1].Len(), c.lists[arcB2].Len()
+
+	if t1+t2 > c.capacity {
+		t.Fatalf("|T1|+|T2| = %d+%d > c = %d", t1, t2, c.capacity)
+	}
+	if t1+b1 > c.capacity {
+		t.Fatalf("|T1|+|B1| = %d+%d > c = %d", t1, b1, c.capacity)
+	}
+	if t1+t2+b1+b2 > 2*c.capacity {
+		t.Fatalf("|T1|+|T2|+|B1|+|B2| = %d > 2c = %d", t1+t2+b1+b2, 2*c.capacity)
+	}
+	if c.p < 0 || c.p > c.capacity {
+		t.Fatalf("p = %d, want 0 ≤ p ≤ %d", c.p, c.capacity)
+	}
+
+	// map 與鏈表一致；幽靈不保存值與 TTL
+	if len(c.cache) != t1+t2+b1+b2 {
+		t.Fatalf("%d keys in the map, %d in the lists", len(c.cache), t1+t2+b1+b2)
+	}
+	for where, l := range c.lists {
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			ent := elem.Value.(*arcEntry)
+			if ent.where != where || c.cache[ent.key] != elem {
+				t.Fatalf("key %q: where = %d, found in list %d", ent.key, ent.where, where)
+			}
+			if (where == arcB1 || where == arcB2) && (ent.value != nil || ent.expIdx >= 0) {
+				t.Fatalf("ghost %q keeps a value or a TTL", ent.key)
+			}
+		}
+	}
+}
+
+// TestARCInvariants 隨機的讀寫刪除之後，不變量始終成立。
+func TestARCInvariants(t *testing.T) {
+	for _, capacity := range []int{1, 2, 10, 100} {
+		t.Run(strconv.Itoa(capacity), func(t *testing.T) {
+			c := NewARC(capacity)
+			r := rand.New(rand.NewSource(int64(capacity)))
+			z := rand.NewZipf(r, 1.1, 1, uint64(4*capacity))
+
+			for range 20_000 {
+				// 一半 Zipf 熱點、一半均勻分佈（混合頻率與最近性的工作負載）
+				var key string
+				if r.Intn(2) == 0 {
+					key = strconv.FormatUint(z.Uint64(), 10)
+				} else {
+					key = strconv.Itoa(r.Intn(4 * capacity))
+				}
+				switch n := r.Intn(100); {
+				case n < 50:
+					if _, ok := c.Get(key); !ok {
+						c.Set(key, key)
+					}
+				case n < 90:
+					c.Set(key, key)
+				case n < 95:
+					c.SetWithTTL(key, key, time.Duration(r.Intn(2))*time.Nanosecond)
+				default:
+					c.Delete(key)
+				}
+				checkARC(t, c)
+			}
+		})
+	}
+}
+
+// TestARCGhostHit 剛被淘汰的 key 再次寫入：放回 T2，並調整 p。
+func TestARCGhostHit(t *testing.T) {
+	c := NewARC(2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("b")    // b 移到 T2
+	c.Set("c", 3) // T1 超過 p = 0：a 淘汰到 B1
+	checkARC(t, c)
+	if where := c.cache["a"].Value.(*arcEntry).where; where != arcB1 {
+		t.Fatalf("a in list %d, want B1", where)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get(a) hit a ghost")
+	}
+
+	// B1 幽靈命中：T1 太小，p 增加；a 直接進入 T2
+	c.Set("a", 1)
+	checkARC(t, c)
+	if c.p != 1 {
+		t.Errorf("p = %d after a B1 ghost hit, want 1", c.p)
+	}
+	if where := c.cache["a"].Value.(*arcEntry).where; where != arcT2 {
+		t.Errorf("a in list %d, want T2", where)
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v, want 1", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+// TestARCScanResistance 只被存取一次的掃描停留在 T1，不會擠掉 T2 中的熱點。
+func TestARCScanResistance(t *testing.T) {
+	const capacity = 100
+	c := NewARC(capacity)
+	for i := range capacity / 2 {
+		key := "hot:" + strconv.Itoa(i)
+		c.Set(key, i)
+		c.Get(key) // 第二次存取：進入 T2
+	}
+	for i := range 10 * capacity {
+		c.Set("scan:"+strconv.Itoa(i), i)
+		checkARC(t, c)
+	}
+
+	for i := range capacity / 2 {
+		if _, ok := c.peek("hot:" + strconv.Itoa(i)); !ok {
+			t.Errorf("hot:%d evicted by a one-time scan", i)
+		}
+	}
+}
+
+// TestARCDelete 刪除保存值的項目與幽靈，刪除後不變量仍成立。
+func TestARCDelete(t *testing.T) {
+	c := NewARC(2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3) // a 淘汰到 B1
+
+	c.Delete("a") // 幽靈
+	c.Delete("b")
+	checkARC(t, c)
+	if _, ok := c.cache["a"]; ok {
+		t.Error("ghost a still recorded after Delete")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", c.Len())
+	}
+	// 幽靈的移除不計入統計（值在淘汰時已經計入 Capacity）
+	if got := c.Evictions(); got != (EvictionStats{Capacity: 1, Deleted: 1}) {
+		t.Errorf("Evictions() = %+v, want one capacity eviction and one delete", got)
+	}
+
+	// 有空位時寫入不淘汰
+	c.Set("d", 4)
+	if c.Len() != 2 || c.Evictions().Capacity != 1 {
+		t.Errorf("Len() = %d, Evictions() = %+v, want d added without eviction", c.Len(), c.Evictions())
+	}
+	checkARC(t, c)
+}
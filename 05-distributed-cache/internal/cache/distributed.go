@@ -2,7 +2,9 @@ package cache
 
 import (
 	"fmt"
+	"io"
 	"sync"
+	"time"
 
 	"github.com/koopa0/system-design/05-distributed-cache/pkg/consistent"
 )
@@ -57,6 +59,32 @@ func NewDistributedCache(nodeAddrs []string, cacheFactory func() Cache) *Distrib
 	return dc
 }
 
+// NewRemoteDistributedCache 建立分散到多個快取節點程序的分散式快取。
+//
+// 參數：
+//   nodeAddrs: 節點位址列表（每個位址執行一個 node.Server，如 ["10.0.0.1:7001", "10.0.0.2:7001"]）
+//   config: 連線池與逾時設定（所有節點共用）
+//
+// 與 NewDistributedCache 的差異：
+//   每個節點是一個 RemoteCache，資料真正存在不同的程序（或機器）上
+//   節點故障時，落在該節點的 key 全部未命中（RemoteCache 把錯誤視為未命中）
+//
+// 動態新增節點：
+//   dc.AddNode(addr, func() Cache { return NewRemoteCache(addr, config) })
+func NewRemoteDistributedCache(nodeAddrs []string, config RemoteConfig) *DistributedCache {
+	dc := &DistributedCache{
+		nodes: make(map[string]Cache),
+		hash:  consistent.New(150, nil),
+	}
+
+	for _, addr := range nodeAddrs {
+		dc.nodes[addr] = NewRemoteCache(addr, config)
+	}
+	dc.hash.Add(nodeAddrs...)
+
+	return dc
+}
+
 // Get 取得快取值。
 //
 // 執行流程：
@@ -102,6 +130,21 @@ func (dc *DistributedCache) Set(key string, value interface{}) {
 	}
 }
 
+// SetWithTTL 設定快取值與存活時間（由負責該 key 的節點處理過期）。
+func (dc *DistributedCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+
+	node := dc.hash.Get(key)
+	if node == "" {
+		return
+	}
+
+	if cache, ok := dc.nodes[node]; ok {
+		cache.SetWithTTL(key, value, ttl)
+	}
+}
+
 // Delete 刪除快取值。
 func (dc *DistributedCache) Delete(key string) {
 	dc.mu.RLock()
@@ -146,7 +189,7 @@ func (dc *DistributedCache) AddNode(addr string, cacheFactory func() Cache) {
 //
 // 執行流程：
 //   1. 從一致性雜湊環移除
-//   2. 刪除節點的本地快取
+//   2. 刪除節點的本地快取（遠端節點則關閉連線池）
 //
 // 資料遷移：
 //   移除節點後，其資料會映射到下一個節點
@@ -159,6 +202,9 @@ func (dc *DistributedCache) RemoveNode(addr string) {
 	dc.hash.Remove(addr)
 
 	// 刪除節點
+	if closer, ok := dc.nodes[addr].(io.Closer); ok {
+		closer.Close()
+	}
 	delete(dc.nodes, addr)
 }
 
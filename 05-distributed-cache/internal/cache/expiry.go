@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Config 本地快取（LRU、LFU）的容量設定。
+//
+// 兩種容量上限可以同時設定，任一超過就淘汰：
+//
+//	Capacity: 項目數上限，適合值大小相近的場景
+//	MaxBytes: 位元組上限，適合值大小差異大的場景
+//	          （容量 1000 的快取存 1000 個 1 MB 的值就是 1 GB，項目數上限擋不住）
+//
+// 兩者皆為 0 時快取不保存任何項目（與 NewLRU(0) 的行為相同）
+type Config struct {
+	Capacity int   // 項目數上限（0 表示不限）
+	MaxBytes int64 // 位元組上限（0 表示不限）
+
+	// SizeFunc 計算項目佔用的位元組數（nil 使用 DefaultSize）
+	//
+	// 只在 MaxBytes > 0 時使用；值為自訂型別時應提供，否則只能粗估
+	SizeFunc func(key string, value interface{}) int64
+}
+
+// DefaultSize 預設的項目大小估算。
+//
+// 只精確計算 string 與 []byte 的內容長度，其他型別一律以 16 位元組估算
+// （interface 本身的大小，不含指向的資料），存放 struct 時應自行提供 SizeFunc
+func DefaultSize(key string, value interface{}) int64 {
+	size := int64(len(key))
+	switch v := value.(type) {
+	case string:
+		size += int64(len(v))
+	case []byte:
+		size += int64(len(v))
+	default:
+		size += 16
+	}
+	return size
+}
+
+func (c Config) size(key string, value interface{}) int64 {
+	if c.MaxBytes <= 0 {
+		return 0
+	}
+	if c.SizeFunc != nil {
+		return c.SizeFunc(key, value)
+	}
+	return DefaultSize(key, value)
+}
+
+// exceeded 項目數或位元組數是否超過上限。
+func (c Config) exceeded(n int, bytes int64) bool {
+	if c.Capacity <= 0 && c.MaxBytes <= 0 {
+		return n > 0
+	}
+	return c.Capacity > 0 && n > c.Capacity || c.MaxBytes > 0 && bytes > c.MaxBytes
+}
+
+// EvictionReason 項目被移除的原因。
+type EvictionReason int
+
+const (
+	EvictCapacity EvictionReason = iota // 超過項目數或位元組上限
+	EvictExpired                        // TTL 到期
+	EvictDeleted                        // 呼叫 Delete
+)
+
+// EvictionStats 按原因分類的移除次數。
+//
+// 監控用途：
+//   - Capacity 偏高：快取太小，熱資料被擠出（命中率下降的主因）
+//   - Expired 偏高：TTL 太短，或資料本來就是短期的
+//   - Deleted：應用層主動失效（如 Cache-Aside 的寫入）
+type EvictionStats struct {
+	Capacity uint64
+	Expired  uint64
+	Deleted  uint64
+}
+
+func (s *EvictionStats) record(reason EvictionReason) {
+	switch reason {
+	case EvictCapacity:
+		s.Capacity++
+	case EvictExpired:
+		s.Expired++
+	case EvictDeleted:
+		s.Deleted++
+	}
+}
+
+// meta 項目的過期與大小資訊（LRU、LFU 的節點共用）。
+type meta struct {
+	key      string
+	expireAt time.Time // 零值表示永不過期
+	size     int64     // 只在設定 MaxBytes 時計算
+	expIdx   int       // 在 expiring 中的位置（-1 表示不在其中）
+}
+
+func (m *meta) expired(now time.Time) bool {
+	return !m.expireAt.IsZero() && !now.Before(m.expireAt)
+}
+
+// expiry 的主動過期參數（與 Redis 相同的取樣演算法）
+const (
+	expireSampleSize  = 20 // 每輪取樣數
+	expireMaxRounds   = 4  // 每次最多幾輪（限制單次耗時）
+	activeExpireEvery = 32 // 每幾次寫入執行一次主動過期
+)
+
+// expiring 設定了 TTL 的項目集合，支援 O(1) 加入、移除與隨機取樣。
+//
+// 過期的兩種方式：
+//
+//	惰性過期：Get 讀到過期項目時才刪除
+//	  問題：過期後不再被讀取的項目會一直佔用記憶體（直到被容量淘汰）
+//
+//	主動過期：定期隨機取樣有 TTL 的項目，刪除其中過期的
+//	  Redis 的演算法：每輪取樣 20 個，過期比例超過 25% 就再來一輪
+//	  → 過期項目多時多清一些，少時很快停止，不需要掃描全部項目
+//
+// 為何取樣而非排序（如按過期時間排序的 heap）？
+//   - heap 每次 Set 都是 O(log n)，取樣只在清理時花費固定成本
+//   - 代價：過期項目不會準時刪除，但惰性過期保證讀不到
+type expiring []*meta
+
+func (e *expiring) add(m *meta) {
+	if m.expIdx >= 0 {
+		return
+	}
+	m.expIdx = len(*e)
+	*e = append(*e, m)
+}
+
+// remove 以最後一個元素填補空位（O(1)，順序不重要）。
+func (e *expiring) remove(m *meta) {
+	if m.expIdx < 0 {
+		return
+	}
+	s := *e
+	last := len(s) - 1
+	s[m.expIdx] = s[last]
+	s[m.expIdx].expIdx = m.expIdx
+	s[last] = nil
+	*e = s[:last]
+	m.expIdx = -1
+}
+
+// sweep 取樣刪除過期項目，返回刪除的數量。
+//
+// del 刪除一個項目（呼叫方持有鎖，del 內部需要呼叫 remove）
+// maxRounds 為 0 表示不限輪數（手動清理時使用）
+func (e *expiring) sweep(now time.Time, maxRounds int, del func(m *meta)) int {
+	removed := 0
+	for round := 0; maxRounds == 0 || round < maxRounds; round++ {
+		n := min(expireSampleSize, len(*e))
+		if n == 0 {
+			return removed
+		}
+		expired := 0
+		for i := 0; i < n && len(*e) > 0; i++ {
+			m := (*e)[rand.IntN(len(*e))]
+			if m.expired(now) {
+				del(m)
+				expired++
+			}
+		}
+		removed += expired
+		// 過期比例不超過 25%：剩下的過期項目不多，交給惰性過期
+		if expired*4 <= n {
+			return removed
+		}
+	}
+	return removed
+}
+
+// expireAt 將 TTL 換算為過期時間（ttl <= 0 表示永不過期）。
+func expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
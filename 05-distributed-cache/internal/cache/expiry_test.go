@@ -0,0 +1,337 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ttlCache 支援 TTL 的本地快取（四種淘汰策略共用的方法）。
+type ttlCache interface {
+	Cache
+	Expire(key string, ttl time.Duration) bool
+	Remove(key string) bool
+	RemoveExpired() int
+	Evictions() EvictionStats
+}
+
+// ttlCaches 參與 TTL 測試的快取（容量足夠，不會因容量淘汰）。
+func ttlCaches() []struct {
+	name string
+	new  func(capacity int) ttlCache
+} {
+	return []struct {
+		name string
+		new  func(capacity int) ttlCache
+	}{
+		{"LRU", func(n int) ttlCache { return NewLRU(n) }},
+		{"LFU", func(n int) ttlCache { return NewLFU(n) }},
+		{"WTinyLFU", func(n int) ttlCache { return NewWTinyLFU(n) }},
+		{"ARC", func(n int) ttlCache { return NewARC(n) }},
+	}
+}
+
+// TestTTLLazyExpiry 過期項目讀不到，並在 Get 時刪除。
+func TestTTLLazyExpiry(t *testing.T) {
+	for _, tc := range ttlCaches() {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new(100)
+			c.SetWithTTL("short", 1, 20*time.Millisecond)
+			c.SetWithTTL("long", 2, time.Hour)
+			c.SetWithTTL("forever", 3, 0) // ttl <= 0 表示永不過期
+
+			if v, ok := c.Get("short"); !ok || v != 1 {
+				t.Fatalf("Get(short) before expiry = %v, %v", v, ok)
+			}
+			time.Sleep(30 * time.Millisecond)
+
+			if _, ok := c.Get("short"); ok {
+				t.Error("Get(short) hit after expiry")
+			}
+			for _, key := range []string{"long", "forever"} {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("Get(%s) missed", key)
+				}
+			}
+			if c.Len() != 2 {
+				t.Errorf("Len() = %d, want 2 (the expired item removed by Get)", c.Len())
+			}
+			if got := c.Evictions(); got != (EvictionStats{Expired: 1}) {
+				t.Errorf("Evictions() = %+v, want one expired", got)
+			}
+		})
+	}
+}
+
+// TestTTLOverwrite 覆寫會清除原本的 TTL（與 Redis 的 SET 相同）。
+func TestTTLOverwrite(t *testing.T) {
+	for _, tc := range ttlCaches() {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new(100)
+			c.SetWithTTL("k", 1, 20*time.Millisecond)
+			c.Set("k", 2)
+			time.Sleep(30 * time.Millisecond)
+			if v, ok := c.Get("k"); !ok || v != 2 {
+				t.Errorf("Get(k) = %v, %v, want 2 without TTL", v, ok)
+			}
+		})
+	}
+}
+
+// TestTTLSampledExpiry 不再被讀取的過期項目由寫入時攤提的主動過期刪除。
+func TestTTLSampledExpiry(t *testing.T) {
+	const expiring = 200
+	for _, tc := range ttlCaches() {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new(1000)
+			for i := range expiring {
+				c.SetWithTTL("ttl:"+strconv.Itoa(i), i, 10*time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			// 只寫入其他 key，從不讀取過期的項目
+			for i := range 10 * activeExpireEvery {
+				c.Set("k:"+strconv.Itoa(i), i)
+			}
+			expired := c.Evictions().Expired
+			if expired == 0 {
+				t.Fatal("no expired items removed by writes")
+			}
+			if c.Len() != expiring+10*activeExpireEvery-int(expired) {
+				t.Errorf("Len() = %d, want %d", c.Len(), expiring+10*activeExpireEvery-int(expired))
+			}
+
+			// 手動清理不限輪數：全部過期時清到一個不剩
+			if n := c.RemoveExpired(); int(expired)+n != expiring {
+				t.Errorf("RemoveExpired() = %d, want the remaining %d", n, expiring-int(expired))
+			}
+			if c.Len() != 10*activeExpireEvery {
+				t.Errorf("Len() = %d after RemoveExpired, want %d", c.Len(), 10*activeExpireEvery)
+			}
+			if n := c.RemoveExpired(); n != 0 {
+				t.Errorf("second RemoveExpired() = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	for _, tc := range ttlCaches() {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new(100)
+			c.Set("k", 1)
+			c.SetWithTTL("old", 2, 10*time.Millisecond)
+
+			if !c.Expire("k", 20*time.Millisecond) {
+				t.Fatal("Expire(k) = false, want true")
+			}
+			if c.Expire("missing", time.Second) {
+				t.Error("Expire(missing) = true")
+			}
+			time.Sleep(30 * time.Millisecond)
+			if _, ok := c.Get("k"); ok {
+				t.Error("Get(k) hit after the new TTL")
+			}
+			// 已過期的項目視為不存在
+			if c.Expire("old", time.Hour) {
+				t.Error("Expire(old) = true for an expired item")
+			}
+
+			// ttl <= 0 清除 TTL
+			c.SetWithTTL("p", 3, 20*time.Millisecond)
+			c.Expire("p", 0)
+			time.Sleep(30 * time.Millisecond)
+			if _, ok := c.Get("p"); !ok {
+				t.Error("Get(p) missed after Expire(p, 0) removed the TTL")
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	for _, tc := range ttlCaches() {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new(100)
+			c.Set("k", 1)
+			c.SetWithTTL("old", 2, 10*time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+
+			if !c.Remove("k") {
+				t.Error("Remove(k) = false, want true")
+			}
+			if c.Remove("k") {
+				t.Error("second Remove(k) = true")
+			}
+			if c.Remove("old") {
+				t.Error("Remove(old) = true for an expired item")
+			}
+			if c.Len() != 0 {
+				t.Errorf("Len() = %d, want 0", c.Len())
+			}
+			if got := c.Evictions(); got != (EvictionStats{Expired: 1, Deleted: 1}) {
+				t.Errorf("Evictions() = %+v, want one expired and one deleted", got)
+			}
+		})
+	}
+}
+
+// byteCache 支援位元組上限的快取。
+type byteCache interface {
+	Cache
+	Bytes() int64
+	Evictions() EvictionStats
+}
+
+func byteCaches(config Config) []struct {
+	name string
+	c    byteCache
+} {
+	return []struct {
+		name string
+		c    byteCache
+	}{
+		{"LRU", NewLRUWithConfig(config)},
+		{"LFU", NewLFUWithConfig(config)},
+	}
+}
+
+// TestMaxBytes 以位元組數限制容量：新增、覆寫、刪除都維護 Bytes，超過上限時淘汰。
+func TestMaxBytes(t *testing.T) {
+	for _, tc := range byteCaches(Config{MaxBytes: 100}) {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.c
+			c.Set("a", strings.Repeat("x", 39)) // 1 + 39 = 40
+			c.Set("b", strings.Repeat("x", 39)) // 80
+			if c.Bytes() != 80 {
+				t.Fatalf("Bytes() = %d, want 80", c.Bytes())
+			}
+
+			// 覆寫只計算差額
+			c.Set("a", strings.Repeat("x", 9)) // 10 + 40 = 50
+			if c.Bytes() != 50 {
+				t.Errorf("Bytes() after overwrite = %d, want 50", c.Bytes())
+			}
+
+			// 超過上限：淘汰直到放得下（可能不只一個）
+			c.Set("c", strings.Repeat("x", 90)) // 141：淘汰 b 之後 101 仍超過，再淘汰 a
+			if c.Bytes() > 100 || c.Len() != 1 {
+				t.Errorf("Bytes() = %d, Len() = %d, want only c within 100 bytes", c.Bytes(), c.Len())
+			}
+			if _, ok := c.Get("c"); !ok {
+				t.Error("Get(c) missed")
+			}
+			if got := c.Evictions().Capacity; got != 2 {
+				t.Errorf("Evictions().Capacity = %d, want 2", got)
+			}
+
+			c.Delete("c")
+			if c.Bytes() != 0 {
+				t.Errorf("Bytes() after Delete = %d, want 0", c.Bytes())
+			}
+		})
+	}
+}
+
+// TestMaxBytesOversize 單一項目超過上限時不寫入，舊值一併刪除。
+func TestMaxBytesOversize(t *testing.T) {
+	for _, tc := range byteCaches(Config{MaxBytes: 100}) {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.c
+			c.Set("a", "small")
+			c.Set("k", "old")
+			c.Set("k", strings.Repeat("x", 100)) // 101 位元組
+
+			if _, ok := c.Get("k"); ok {
+				t.Error("Get(k) hit, want the oversize value rejected and the old value removed")
+			}
+			if _, ok := c.Get("a"); !ok {
+				t.Error("Get(a) missed, want other items untouched")
+			}
+			if c.Bytes() != 6 {
+				t.Errorf("Bytes() = %d, want 6", c.Bytes())
+			}
+		})
+	}
+}
+
+// TestMaxBytesWithCapacity 兩種上限同時設定時，任一超過就淘汰。
+func TestMaxBytesWithCapacity(t *testing.T) {
+	for _, tc := range byteCaches(Config{Capacity: 2, MaxBytes: 1000}) {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.c
+			for _, key := range []string{"a", "b", "c"} {
+				c.Set(key, "v")
+			}
+			if c.Len() != 2 || c.Bytes() != 4 {
+				t.Errorf("Len() = %d, Bytes() = %d, want 2 items and 4 bytes", c.Len(), c.Bytes())
+			}
+		})
+	}
+}
+
+// TestSizeFunc 自訂大小估算（存放 struct 等 DefaultSize 無法估算的值）。
+func TestSizeFunc(t *testing.T) {
+	c := NewLRUWithConfig(Config{
+		MaxBytes: 10,
+		SizeFunc: func(key string, value interface{}) int64 { return int64(value.(int)) },
+	})
+	c.Set("a", 4)
+	c.Set("b", 4)
+	c.Set("c", 4) // 12 > 10：淘汰 a
+	if _, ok := c.Get("a"); ok || c.Bytes() != 8 {
+		t.Errorf("Get(a) hit = %v, Bytes() = %d, want a evicted and 8 bytes", ok, c.Bytes())
+	}
+}
+
+func TestDefaultSize(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int64
+	}{
+		{"hello", 8},
+		{[]byte("hi"), 5},
+		{42, 19}, // 其他型別以 16 位元組估算
+	}
+	for _, tt := range tests {
+		if got := DefaultSize("key", tt.value); got != tt.want {
+			t.Errorf("DefaultSize(key, %#v) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestEvictionStats 每種移除原因分別計數。
+func TestEvictionStats(t *testing.T) {
+	for _, tc := range ttlCaches() {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new(2)
+			c.Set("a", 1)
+			c.Delete("a") // Deleted
+			c.Delete("a") // 不存在：不計
+			c.SetWithTTL("b", 2, 10*time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+			c.Get("b") // Expired
+
+			for i := range 5 {
+				c.Set(strconv.Itoa(i), i)
+			}
+			want := EvictionStats{Capacity: 3, Expired: 1, Deleted: 1}
+			if got := c.Evictions(); got != want {
+				t.Errorf("Evictions() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestZeroCapacity 容量為 0 的快取不保存任何項目。
+func TestZeroCapacity(t *testing.T) {
+	for _, tc := range ttlCaches() {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new(0)
+			c.Set("k", 1)
+			if _, ok := c.Get("k"); ok || c.Len() != 0 {
+				t.Errorf("Get(k) hit = %v, Len() = %d, want an empty cache", ok, c.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// 命中率比較：以合成的存取序列（trace）重播，比較各淘汰策略的命中率
+//
+// 執行方式（-benchtime 1x 讓每個 trace 只重播一次）：
+//
+//	go test ./internal/cache -run '^$' -bench HitRatio -benchtime 1x
+//
+// 工作負載：
+//   - zipf：少數熱點佔大部分存取（真實世界最常見的分佈）
+//   - scan：zipf 熱點中週期性插入一次性的循序掃描（如報表、備份、爬蟲）
+//   - shift：zipf 熱點每隔一段時間整批換成新的 key（如新聞、熱搜）
+//
+// 為何用 benchmark 而非 test？
+//   - 命中率沒有「正確答案」，只有相對好壞，不適合寫成斷言
+//   - b.ReportMetric 讓結果與 benchstat 等工具相容
+
+const (
+	traceCapacity = 1000    // 快取容量
+	traceKeySpace = 100_000 // zipf 的 key 空間
+	traceLength   = 500_000 // 每個 trace 的存取次數
+)
+
+// trace 是一段存取序列（key 以整數表示，重播時轉為字串）。
+type trace []uint64
+
+// zipfTrace 產生 Zipf 分佈的存取序列（s 越大越集中在少數熱點）。
+func zipfTrace(seed int64, s float64, n int) trace {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, s, 1, traceKeySpace-1)
+	t := make(trace, n)
+	for i := range t {
+		t[i] = z.Uint64()
+	}
+	return t
+}
+
+// scanTrace 在 Zipf 存取中週期性插入循序掃描。
+//
+// 每 every 次存取之後插入一段長度 scanLen 的掃描；
+// 掃描的 key 不在 Zipf 的 key 空間內且不重複，只會被存取一次
+func scanTrace(seed int64, n, every, scanLen int) trace {
+	base := zipfTrace(seed, 1.1, n)
+	t := make(trace, 0, n+n/every*scanLen)
+	next := uint64(traceKeySpace)
+	for i, k := range base {
+		t = append(t, k)
+		if (i+1)%every == 0 {
+			for range scanLen {
+				t = append(t, next)
+				next++
+			}
+		}
+	}
+	return t
+}
+
+// shiftTrace 產生熱點會轉移的 Zipf 存取序列。
+//
+// 序列分為 phases 段，每段的 key 加上不同的偏移量：
+// 上一段的熱點在下一段完全不再被存取（LFU 的累積頻率會讓舊熱點佔著快取）
+func shiftTrace(seed int64, n, phases int) trace {
+	t := zipfTrace(seed, 1.1, n)
+	phaseLen := n / phases
+	for i := range t {
+		t[i] += uint64(i/phaseLen) * traceKeySpace
+	}
+	return t
+}
+
+// replay 重播存取序列，返回命中率。
+//
+// 模擬 Cache-Aside：Get 未命中時從「資料庫」載入並 Set
+func replay(c Cache, t trace) float64 {
+	keys := make([]string, len(t))
+	for i, k := range t {
+		keys[i] = strconv.FormatUint(k, 10)
+	}
+
+	hits := 0
+	for _, key := range keys {
+		if _, ok := c.Get(key); ok {
+			hits++
+			continue
+		}
+		c.Set(key, key)
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+func BenchmarkHitRatio(b *testing.B) {
+	workloads := []struct {
+		name  string
+		trace trace
+	}{
+		{"zipf-1.01", zipfTrace(1, 1.01, traceLength)}, // rand.Zipf 要求 s > 1
+		{"zipf-1.2", zipfTrace(1, 1.2, traceLength)},
+		{"scan", scanTrace(1, traceLength, 10_000, 2*traceCapacity)},
+		{"shift", shiftTrace(1, traceLength, 5)},
+	}
+
+	policies := []struct {
+		name string
+		new  func(capacity int) Cache
+	}{
+		{"LRU", func(n int) Cache { return NewLRU(n) }},
+		{"LFU", func(n int) Cache { return NewLFU(n) }},
+		{"WTinyLFU", func(n int) Cache { return NewWTinyLFU(n) }},
+		{"ARC", func(n int) Cache { return NewARC(n) }},
+	}
+
+	for _, w := range workloads {
+		for _, p := range policies {
+			b.Run(w.name+"/"+p.name, func(b *testing.B) {
+				var ratio float64
+				for range b.N {
+					ratio = replay(p.new(traceCapacity), w.trace)
+				}
+				b.ReportMetric(ratio*100, "hit%")
+			})
+		}
+	}
+}
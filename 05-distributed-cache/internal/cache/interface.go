@@ -1,14 +1,20 @@
 package cache
 
+import "time"
+
 // Cache 是快取介面，定義了基本的快取操作。
 //
 // 此介面由以下實作：
 //   - LRU（Least Recently Used）
 //   - LFU（Least Frequently Used）
+//   - WTinyLFU（Window TinyLFU，頻率准入 + 分段 LRU）
+//   - ARC（Adaptive Replacement Cache，自動平衡最近性與頻率）
+//   - Sharded（分片加鎖，包裝上述任一實作以提升並發）
 //   - DistributedCache（分散式快取）
+//   - RemoteCache（透過網路存取快取節點）
 //
 // 設計考量：
-//   - 簡單介面：只包含核心操作（Get/Set/Delete）
+//   - 簡單介面：只包含核心操作（Get/Set/Delete）與過期（SetWithTTL）
 //   - 無 context：本地快取不需要上下文（與遠端快取/資料庫區分）
 //   - 無 error：記憶體操作通常不會失敗
 //
@@ -28,6 +34,11 @@ type Cache interface {
 	// 注意：如果快取已滿，根據驅逐策略移除舊資料
 	Set(key string, value interface{})
 
+	// SetWithTTL 設定快取值，ttl 後過期（ttl <= 0 表示永不過期）
+	//
+	// 注意：過期的項目保證讀不到，但不保證立即釋放記憶體（見 expiring）
+	SetWithTTL(key string, value interface{}, ttl time.Duration)
+
 	// Delete 刪除快取值
 	//
 	// 注意：刪除不存在的 key 不會報錯（冪等操作）
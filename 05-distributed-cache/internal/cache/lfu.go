@@ -3,6 +3,7 @@ package cache
 import (
 	"container/list"
 	"sync"
+	"time"
 )
 
 // LFU 實作 Least Frequently Used 快取淘汰演算法。
@@ -42,17 +43,23 @@ import (
 //   - 存取模式多變：LRU 更好
 //   - 防止突發流量：LFU 更好
 //   - 實作簡單：LRU 更好
+//
+// 過期與容量：與 LRU 相同（SetWithTTL、Config.MaxBytes）
 type LFU struct {
-	capacity int                       // 容量
+	config   Config                    // 容量設定
 	minFreq  int                       // 當前最小頻率
 	cache    map[string]*lfuNode       // key -> 節點
 	freqMap  map[int]*list.List        // 頻率 -> LRU 鏈表
+	bytes    int64                     // 目前佔用的位元組數（只在設定 MaxBytes 時計算）
+	expiring expiring                  // 設定了 TTL 的項目
+	writes   int                       // 寫入次數（每 activeExpireEvery 次執行一次主動過期）
+	stats    EvictionStats             // 按原因分類的移除次數
 	mu       sync.RWMutex
 }
 
 // lfuNode 是 LFU 快取節點。
 type lfuNode struct {
-	key   string
+	meta
 	value interface{}
 	freq  int            // 存取頻率
 	elem  *list.Element  // 在頻率鏈表中的位置
@@ -71,11 +78,16 @@ type lfuNode struct {
 //   freq=2: [key4, key5]        // 存取 2 次的項目
 //   freq=5: [key6]              // 存取 5 次的項目
 func NewLFU(capacity int) *LFU {
+	return NewLFUWithConfig(Config{Capacity: capacity})
+}
+
+// NewLFUWithConfig 以容量設定建立 LFU 快取（可設定位元組上限）。
+func NewLFUWithConfig(config Config) *LFU {
 	return &LFU{
-		capacity: capacity,
-		minFreq:  0,
-		cache:    make(map[string]*lfuNode),
-		freqMap:  make(map[int]*list.List),
+		config:  config,
+		minFreq: 0,
+		cache:   make(map[string]*lfuNode),
+		freqMap: make(map[int]*list.List),
 	}
 }
 
@@ -85,6 +97,8 @@ func NewLFU(capacity int) *LFU {
 //   1. 查找項目
 //   2. 增加頻率（從舊頻率鏈表移到新頻率鏈表）
 //   3. 更新 minFreq
+//
+// 項目已過期時刪除並視為未命中（惰性過期）
 func (lfu *LFU) Get(key string) (interface{}, bool) {
 	lfu.mu.Lock()
 	defer lfu.mu.Unlock()
@@ -93,12 +107,50 @@ func (lfu *LFU) Get(key string) (interface{}, bool) {
 	if !ok {
 		return nil, false
 	}
+	if !node.expireAt.IsZero() && node.expired(time.Now()) {
+		lfu.removeNode(node, EvictExpired)
+		return nil, false
+	}
 
 	// 增加頻率
 	lfu.increaseFreq(node)
 	return node.value, true
 }
 
+// peek 以讀鎖查詢，不增加頻率（Sharded 的讀取緩衝使用）。
+//
+// 過期項目視為未命中，但不刪除（刪除需要寫鎖，留給 touch 與主動過期）
+func (lfu *LFU) peek(key string) (interface{}, bool) {
+	lfu.mu.RLock()
+	defer lfu.mu.RUnlock()
+
+	if node, ok := lfu.cache[key]; ok {
+		if node.expireAt.IsZero() || !node.expired(time.Now()) {
+			return node.value, true
+		}
+	}
+	return nil, false
+}
+
+// touch 批次增加讀取過的項目的頻率（Sharded 的讀取緩衝使用）。
+func (lfu *LFU) touch(keys []string) {
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		node, ok := lfu.cache[key]
+		if !ok {
+			continue
+		}
+		if !node.expireAt.IsZero() && node.expired(now) {
+			lfu.removeNode(node, EvictExpired)
+			continue
+		}
+		lfu.increaseFreq(node)
+	}
+}
+
 // Put 設定快取值。
 //
 // 行為：
@@ -108,32 +160,69 @@ func (lfu *LFU) Get(key string) (interface{}, bool) {
 //   2. 如果 key 不存在：
 //      - 容量已滿：淘汰頻率最低且最久未使用的項目
 //      - 新增項目（頻率=1）
+//
+// 注意：覆寫會清除原本的 TTL（與 Redis 的 SET 相同）
 func (lfu *LFU) Set(key string, value interface{}) {
+	lfu.set(key, value, time.Time{})
+}
+
+// SetWithTTL 設定快取值與存活時間（ttl <= 0 表示永不過期）。
+func (lfu *LFU) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	lfu.set(key, value, expireAt(ttl))
+}
+
+func (lfu *LFU) set(key string, value interface{}, expireAt time.Time) {
 	lfu.mu.Lock()
 	defer lfu.mu.Unlock()
 
-	if lfu.capacity <= 0 {
+	if lfu.config.Capacity <= 0 && lfu.config.MaxBytes <= 0 {
+		return
+	}
+
+	// 主動過期：攤提在寫入中執行，不需要背景 goroutine
+	lfu.writes++
+	if lfu.writes%activeExpireEvery == 0 {
+		lfu.expiring.sweep(time.Now(), expireMaxRounds, lfu.expire)
+	}
+
+	size := lfu.config.size(key, value)
+
+	// 單一項目超過位元組上限：不寫入，舊值一併刪除（同 LRU）
+	if lfu.config.MaxBytes > 0 && size > lfu.config.MaxBytes {
+		if node, ok := lfu.cache[key]; ok {
+			lfu.removeNode(node, EvictCapacity)
+		}
 		return
 	}
 
 	// 如果 key 已存在，更新值並增加頻率
 	if node, ok := lfu.cache[key]; ok {
 		node.value = value
+		lfu.bytes += size - node.size
+		node.size = size
+		lfu.setExpiry(&node.meta, expireAt)
 		lfu.increaseFreq(node)
+
+		// 值變大可能超過位元組上限
+		for lfu.config.exceeded(len(lfu.cache), lfu.bytes) {
+			lfu.evict()
+		}
 		return
 	}
 
-	// 容量已滿，淘汰
-	if len(lfu.cache) >= lfu.capacity {
+	// 容量已滿，淘汰（先淘汰再新增：新項目頻率為 1，否則會立刻被自己淘汰）
+	for len(lfu.cache) > 0 && lfu.config.exceeded(len(lfu.cache)+1, lfu.bytes+size) {
 		lfu.evict()
 	}
 
 	// 新增項目（頻率=1）
 	node := &lfuNode{
-		key:   key,
+		meta:  meta{key: key, size: size, expIdx: -1},
 		value: value,
 		freq:  1,
 	}
+	lfu.setExpiry(&node.meta, expireAt)
+	lfu.bytes += size
 
 	// 加入頻率=1 的鏈表
 	if lfu.freqMap[1] == nil {
@@ -175,6 +264,16 @@ func (lfu *LFU) increaseFreq(node *lfuNode) {
 	node.elem = lfu.freqMap[node.freq].PushFront(node)
 }
 
+// setExpiry 更新項目的過期時間，並維護有 TTL 的項目集合。
+func (lfu *LFU) setExpiry(m *meta, expireAt time.Time) {
+	m.expireAt = expireAt
+	if expireAt.IsZero() {
+		lfu.expiring.remove(m)
+	} else {
+		lfu.expiring.add(m)
+	}
+}
+
 // evict 淘汰頻率最低且最久未使用的項目。
 //
 // 執行流程：
@@ -188,7 +287,17 @@ func (lfu *LFU) increaseFreq(node *lfuNode) {
 func (lfu *LFU) evict() {
 	minFreqList := lfu.freqMap[lfu.minFreq]
 	if minFreqList == nil || minFreqList.Len() == 0 {
-		return
+		// Delete 與過期刪除不更新 minFreq，可能指向已不存在的頻率：
+		// 重新找出最小頻率（O(不同頻率數)，只在這種情況發生）
+		lfu.minFreq = 0
+		for freq := range lfu.freqMap {
+			if lfu.minFreq == 0 || freq < lfu.minFreq {
+				lfu.minFreq = freq
+			}
+		}
+		if minFreqList = lfu.freqMap[lfu.minFreq]; minFreqList == nil {
+			return
+		}
 	}
 
 	// 移除尾部項目（最久未使用）
@@ -197,6 +306,9 @@ func (lfu *LFU) evict() {
 		node := elem.Value.(*lfuNode)
 		minFreqList.Remove(elem)
 		delete(lfu.cache, node.key)
+		lfu.bytes -= node.size
+		lfu.expiring.remove(&node.meta)
+		lfu.stats.record(EvictCapacity)
 
 		// 清理空鏈表
 		if minFreqList.Len() == 0 {
@@ -221,17 +333,87 @@ func (lfu *LFU) Delete(key string) {
 	defer lfu.mu.Unlock()
 
 	if node, ok := lfu.cache[key]; ok {
-		lfu.freqMap[node.freq].Remove(node.elem)
-		delete(lfu.cache, key)
+		lfu.removeNode(node, EvictDeleted)
+	}
+}
 
-		// 清理空鏈表
-		if lfu.freqMap[node.freq].Len() == 0 {
-			delete(lfu.freqMap, node.freq)
-		}
+// Expire 只修改 key 的存活時間（ttl <= 0 表示永不過期），返回 key 是否存在（見 LRU.Expire）。
+//
+// 不增加存取頻率
+func (lfu *LFU) Expire(key string, ttl time.Duration) bool {
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+
+	node, ok := lfu.cache[key]
+	if !ok {
+		return false
+	}
+	if node.expired(time.Now()) {
+		lfu.removeNode(node, EvictExpired)
+		return false
+	}
+	lfu.setExpiry(&node.meta, expireAt(ttl))
+	return true
+}
+
+// Remove 刪除 key，返回刪除前是否存在（見 LRU.Remove）。
+func (lfu *LFU) Remove(key string) bool {
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+
+	node, ok := lfu.cache[key]
+	if !ok {
+		return false
+	}
+	if node.expired(time.Now()) {
+		lfu.removeNode(node, EvictExpired)
+		return false
+	}
+	lfu.removeNode(node, EvictDeleted)
+	return true
+}
+
+// expire 移除過期項目（主動過期的回呼）。
+func (lfu *LFU) expire(m *meta) {
+	lfu.removeNode(lfu.cache[m.key], EvictExpired)
+}
+
+// removeNode 移除項目並記錄原因（不更新 minFreq，由 evict 修正）。
+func (lfu *LFU) removeNode(node *lfuNode, reason EvictionReason) {
+	lfu.freqMap[node.freq].Remove(node.elem)
+	delete(lfu.cache, node.key)
+	lfu.bytes -= node.size
+	lfu.expiring.remove(&node.meta)
+	lfu.stats.record(reason)
+
+	// 清理空鏈表
+	if lfu.freqMap[node.freq].Len() == 0 {
+		delete(lfu.freqMap, node.freq)
 	}
 }
 
-// Len 返回當前快取項目數量。
+// RemoveExpired 立即清理過期項目，返回清理的數量（見 LRU.RemoveExpired）。
+func (lfu *LFU) RemoveExpired() int {
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+	return lfu.expiring.sweep(time.Now(), 0, lfu.expire)
+}
+
+// Evictions 返回按原因分類的移除次數（累計值）。
+func (lfu *LFU) Evictions() EvictionStats {
+	lfu.mu.RLock()
+	defer lfu.mu.RUnlock()
+	return lfu.stats
+}
+
+// Bytes 返回目前佔用的位元組數（未設定 MaxBytes 時為 0）。
+func (lfu *LFU) Bytes() int64 {
+	lfu.mu.RLock()
+	defer lfu.mu.RUnlock()
+	return lfu.bytes
+}
+
+// Len 返回當前快取項目數量（包含已過期但尚未移除的項目）。
 func (lfu *LFU) Len() int {
 	lfu.mu.RLock()
 	defer lfu.mu.RUnlock()
@@ -246,6 +428,8 @@ func (lfu *LFU) Clear() {
 	lfu.cache = make(map[string]*lfuNode)
 	lfu.freqMap = make(map[int]*list.List)
 	lfu.minFreq = 0
+	lfu.bytes = 0
+	lfu.expiring = nil
 }
 
 // Stats 返回快取統計資訊（用於監控）。
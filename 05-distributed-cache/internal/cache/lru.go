@@ -4,6 +4,7 @@ package cache
 import (
 	"container/list"
 	"sync"
+	"time"
 )
 
 // LRU 實作 Least Recently Used 快取淘汰演算法。
@@ -36,16 +37,24 @@ import (
 // 缺點：
 //   - 無法處理突發流量（一次性大量存取會污染快取）
 //   - 不考慮存取頻率（只看最近性）
+//
+// 過期與容量：
+//   - SetWithTTL 設定存活時間，過期項目由惰性過期與主動過期移除（見 expiring）
+//   - Config.MaxBytes 以位元組數限制容量，避免少數大值佔滿記憶體
 type LRU struct {
-	capacity int                        // 容量
+	config   Config                     // 容量設定
 	cache    map[string]*list.Element   // key -> 鏈表節點
 	list     *list.List                 // 雙向鏈結串列
+	bytes    int64                      // 目前佔用的位元組數（只在設定 MaxBytes 時計算）
+	expiring expiring                   // 設定了 TTL 的項目
+	writes   int                        // 寫入次數（每 activeExpireEvery 次執行一次主動過期）
+	stats    EvictionStats              // 按原因分類的移除次數
 	mu       sync.RWMutex              // 讀寫鎖
 }
 
 // entry 是鏈表節點儲存的資料。
 type entry struct {
-	key   string
+	meta
 	value interface{}
 }
 
@@ -59,10 +68,18 @@ type entry struct {
 //   - 鏈表頭部是最近使用的項目
 //   - 鏈表尾部是最久未使用的項目
 func NewLRU(capacity int) *LRU {
+	return NewLRUWithConfig(Config{Capacity: capacity})
+}
+
+// NewLRUWithConfig 以容量設定建立 LRU 快取（可設定位元組上限）。
+//
+// 範例：最多 64 MB，值為 []byte
+//   lru := cache.NewLRUWithConfig(cache.Config{MaxBytes: 64 << 20})
+func NewLRUWithConfig(config Config) *LRU {
 	return &LRU{
-		capacity: capacity,
-		cache:    make(map[string]*list.Element),
-		list:     list.New(),
+		config: config,
+		cache:  make(map[string]*list.Element),
+		list:   list.New(),
 	}
 }
 
@@ -77,19 +94,61 @@ func NewLRU(capacity int) *LRU {
 //
 // 行為：
 //   命中時，將該項目移到鏈表頭部（標記為最近使用）
+//   項目已過期時刪除並視為未命中（惰性過期）
 func (lru *LRU) Get(key string) (interface{}, bool) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
 	if elem, ok := lru.cache[key]; ok {
+		ent := elem.Value.(*entry)
+		if !ent.expireAt.IsZero() && ent.expired(time.Now()) {
+			lru.removeElement(elem, EvictExpired)
+			return nil, false
+		}
+
 		// 移到鏈表頭部（最近使用）
 		lru.list.MoveToFront(elem)
-		return elem.Value.(*entry).value, true
+		return ent.value, true
 	}
 
 	return nil, false
 }
 
+// peek 以讀鎖查詢，不移動鏈表節點（Sharded 的讀取緩衝使用）。
+//
+// 過期項目視為未命中，但不刪除（刪除需要寫鎖，留給 touch 與主動過期）
+func (lru *LRU) peek(key string) (interface{}, bool) {
+	lru.mu.RLock()
+	defer lru.mu.RUnlock()
+
+	if elem, ok := lru.cache[key]; ok {
+		ent := elem.Value.(*entry)
+		if ent.expireAt.IsZero() || !ent.expired(time.Now()) {
+			return ent.value, true
+		}
+	}
+	return nil, false
+}
+
+// touch 批次將讀取過的項目移到鏈表頭部（Sharded 的讀取緩衝使用）。
+func (lru *LRU) touch(keys []string) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		elem, ok := lru.cache[key]
+		if !ok {
+			continue
+		}
+		if ent := elem.Value.(*entry); !ent.expireAt.IsZero() && ent.expired(now) {
+			lru.removeElement(elem, EvictExpired)
+			continue
+		}
+		lru.list.MoveToFront(elem)
+	}
+}
+
 // Put 設定快取值。
 //
 // 參數：
@@ -104,25 +163,68 @@ func (lru *LRU) Get(key string) (interface{}, bool) {
 //
 // 淘汰策略：
 //   當容量滿時，淘汰鏈表尾部的項目（最久未使用）
+//
+// 注意：覆寫會清除原本的 TTL（與 Redis 的 SET 相同）
 func (lru *LRU) Set(key string, value interface{}) {
+	lru.set(key, value, time.Time{})
+}
+
+// SetWithTTL 設定快取值與存活時間（ttl <= 0 表示永不過期）。
+func (lru *LRU) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	lru.set(key, value, expireAt(ttl))
+}
+
+func (lru *LRU) set(key string, value interface{}, expireAt time.Time) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
+	size := lru.config.size(key, value)
+
+	// 單一項目超過位元組上限：不寫入（否則會把其他項目全部擠出後再淘汰自己）
+	// 舊值一併刪除，避免之後讀到過時的資料
+	if lru.config.MaxBytes > 0 && size > lru.config.MaxBytes {
+		if elem, ok := lru.cache[key]; ok {
+			lru.removeElement(elem, EvictCapacity)
+		}
+		return
+	}
+
 	// 如果 key 已存在，更新值
 	if elem, ok := lru.cache[key]; ok {
 		lru.list.MoveToFront(elem)
-		elem.Value.(*entry).value = value
-		return
+		ent := elem.Value.(*entry)
+		ent.value = value
+		lru.bytes += size - ent.size
+		ent.size = size
+		lru.setExpiry(&ent.meta, expireAt)
+	} else {
+		// 新增項目
+		ent := &entry{meta: meta{key: key, size: size, expIdx: -1}, value: value}
+		lru.setExpiry(&ent.meta, expireAt)
+		lru.cache[key] = lru.list.PushFront(ent)
+		lru.bytes += size
 	}
 
-	// 新增項目
-	elem := lru.list.PushFront(&entry{key: key, value: value})
-	lru.cache[key] = elem
-
-	// 檢查容量，超過則淘汰
-	if lru.list.Len() > lru.capacity {
+	// 檢查容量，超過則淘汰（位元組上限可能需要淘汰多個項目）
+	for lru.config.exceeded(lru.list.Len(), lru.bytes) {
 		lru.evict()
 	}
+
+	// 主動過期：攤提在寫入中執行，不需要背景 goroutine
+	lru.writes++
+	if lru.writes%activeExpireEvery == 0 {
+		lru.expiring.sweep(time.Now(), expireMaxRounds, lru.expire)
+	}
+}
+
+// setExpiry 更新項目的過期時間，並維護有 TTL 的項目集合。
+func (lru *LRU) setExpiry(m *meta, expireAt time.Time) {
+	m.expireAt = expireAt
+	if expireAt.IsZero() {
+		lru.expiring.remove(m)
+	} else {
+		lru.expiring.add(m)
+	}
 }
 
 // evict 淘汰最久未使用的項目。
@@ -133,23 +235,99 @@ func (lru *LRU) Set(key string, value interface{}) {
 func (lru *LRU) evict() {
 	elem := lru.list.Back()
 	if elem != nil {
-		lru.list.Remove(elem)
-		delete(lru.cache, elem.Value.(*entry).key)
+		lru.removeElement(elem, EvictCapacity)
 	}
 }
 
+// expire 移除過期項目（主動過期的回呼）。
+func (lru *LRU) expire(m *meta) {
+	lru.removeElement(lru.cache[m.key], EvictExpired)
+}
+
+// removeElement 移除項目並記錄原因。
+func (lru *LRU) removeElement(elem *list.Element, reason EvictionReason) {
+	ent := elem.Value.(*entry)
+	lru.list.Remove(elem)
+	delete(lru.cache, ent.key)
+	lru.bytes -= ent.size
+	lru.expiring.remove(&ent.meta)
+	lru.stats.record(reason)
+}
+
 // Delete 刪除快取項目。
 func (lru *LRU) Delete(key string) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
 	if elem, ok := lru.cache[key]; ok {
-		lru.list.Remove(elem)
-		delete(lru.cache, key)
+		lru.removeElement(elem, EvictDeleted)
+	}
+}
+
+// Expire 只修改 key 的存活時間（ttl <= 0 表示永不過期），返回 key 是否存在。
+//
+// 與「Get 後以 SetWithTTL 寫回」的差異：
+//   - 檢查與修改在同一把鎖內完成，不會以舊值覆蓋其間其他 goroutine 寫入的新值
+//   - 不改變值、大小與最近性（修改 TTL 不算一次存取）
+func (lru *LRU) Expire(key string, ttl time.Duration) bool {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	elem, ok := lru.cache[key]
+	if !ok {
+		return false
+	}
+	ent := elem.Value.(*entry)
+	if ent.expired(time.Now()) {
+		lru.removeElement(elem, EvictExpired)
+		return false
+	}
+	lru.setExpiry(&ent.meta, expireAt(ttl))
+	return true
+}
+
+// Remove 刪除 key，返回刪除前是否存在（已過期的項目視為不存在，計入 Expired）。
+func (lru *LRU) Remove(key string) bool {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	elem, ok := lru.cache[key]
+	if !ok {
+		return false
 	}
+	if elem.Value.(*entry).expired(time.Now()) {
+		lru.removeElement(elem, EvictExpired)
+		return false
+	}
+	lru.removeElement(elem, EvictDeleted)
+	return true
+}
+
+// RemoveExpired 立即清理過期項目，返回清理的數量。
+//
+// 寫入時已會攤提執行主動過期；寫入很少但有大量項目過期時，
+// 可以用 time.Ticker 定期呼叫，儘早釋放記憶體
+func (lru *LRU) RemoveExpired() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.expiring.sweep(time.Now(), 0, lru.expire)
+}
+
+// Evictions 返回按原因分類的移除次數（累計值）。
+func (lru *LRU) Evictions() EvictionStats {
+	lru.mu.RLock()
+	defer lru.mu.RUnlock()
+	return lru.stats
+}
+
+// Bytes 返回目前佔用的位元組數（未設定 MaxBytes 時為 0）。
+func (lru *LRU) Bytes() int64 {
+	lru.mu.RLock()
+	defer lru.mu.RUnlock()
+	return lru.bytes
 }
 
-// Len 返回當前快取項目數量。
+// Len 返回當前快取項目數量（包含已過期但尚未移除的項目）。
 func (lru *LRU) Len() int {
 	lru.mu.RLock()
 	defer lru.mu.RUnlock()
@@ -163,9 +341,11 @@ func (lru *LRU) Clear() {
 
 	lru.cache = make(map[string]*list.Element)
 	lru.list = list.New()
+	lru.bytes = 0
+	lru.expiring = nil
 }
 
-// Keys 返回所有快取鍵（從最近到最久）。
+// Keys 返回所有未過期的快取鍵（從最近到最久）。
 //
 // 用途：
 //   監控、除錯、測試
@@ -173,9 +353,12 @@ func (lru *LRU) Keys() []string {
 	lru.mu.RLock()
 	defer lru.mu.RUnlock()
 
+	now := time.Now()
 	keys := make([]string, 0, lru.list.Len())
 	for elem := lru.list.Front(); elem != nil; elem = elem.Next() {
-		keys = append(keys, elem.Value.(*entry).key)
+		if ent := elem.Value.(*entry); !ent.expired(now) {
+			keys = append(keys, ent.key)
+		}
 	}
 	return keys
 }
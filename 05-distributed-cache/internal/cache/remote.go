@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koopa0/system-design/05-distributed-cache/pkg/resp"
+)
+
+// ErrRemoteClosed RemoteCache 已關閉。
+var ErrRemoteClosed = errors.New("cache: remote cache closed")
+
+// Codec 值的序列化方式（Cache 的值是 interface{}，網路上傳的是位元組）。
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// GobCodec 以 encoding/gob 序列化（預設）。
+//
+// 為何選 gob？
+//   - 保留型別：Get 返回的值與 Set 時的型別相同（JSON 會把數字變成 float64）
+//   - 標準庫，不需要額外依賴
+//
+// 注意：自訂型別（struct、map[string]string 等）需要先 gob.Register，
+// 否則 Set 時序列化失敗（計入 Errors）
+type GobCodec struct{}
+
+// Marshal 序列化（連同型別資訊）。
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal 反序列化。
+func (GobCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// RemoteConfig 遠端快取客戶端設定（零值使用預設值）。
+type RemoteConfig struct {
+	PoolSize    int           // 最多保留的閒置連線數（預設 8）
+	DialTimeout time.Duration // 建立連線逾時（預設 1 秒）
+	Timeout     time.Duration // 單一命令的讀寫逾時（預設 100ms）
+	Codec       Codec         // 值的序列化方式（預設 GobCodec）
+}
+
+// RemoteCache 透過網路存取快取節點（node.Server）的客戶端，實作 Cache 介面。
+//
+// 讓 DistributedCache 分散到多個程序：
+//
+//	dc := cache.NewRemoteDistributedCache([]string{"10.0.0.1:7001", "10.0.0.2:7001"}, cache.RemoteConfig{})
+//
+// 錯誤處理：
+//
+//	Cache 介面沒有 error（本地快取不會失敗），但網路會。
+//	透過 Cache 介面呼叫時，錯誤視為未命中（Get）或忽略（Set / Delete）：
+//	快取失敗不應讓請求失敗，呼叫方會回到資料庫讀取。
+//	錯誤次數由 Errors 返回供監控；需要區分錯誤的呼叫方使用 GetBytes 等方法
+//
+// 連線池：
+//
+//	每個命令從池中取一條連線，完成後歸還；池中沒有閒置連線時建立新連線。
+//	同時使用的連線數不設上限（由呼叫方的並發度決定），歸還時超過 PoolSize 的連線直接關閉。
+//	出錯的連線不歸還：讀寫到一半逾時，連線上可能還有未讀的回覆
+type RemoteCache struct {
+	addr   string
+	config RemoteConfig
+
+	mu     sync.Mutex
+	idle   []*remoteConn
+	closed bool
+
+	errors atomic.Int64
+}
+
+// remoteConn 一條到節點的連線。
+type remoteConn struct {
+	conn net.Conn
+	r    *resp.Reader
+	w    *resp.Writer
+}
+
+// NewRemoteCache 建立遠端快取客戶端（不會立即連線，第一個命令時才建立連線）。
+//
+// 參數：
+//
+//	addr: 節點位址（如 "10.0.0.1:7001"）
+//	config: 連線池與逾時設定
+func NewRemoteCache(addr string, config RemoteConfig) *RemoteCache {
+	if config.PoolSize <= 0 {
+		config.PoolSize = 8
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 100 * time.Millisecond
+	}
+	if config.Codec == nil {
+		config.Codec = GobCodec{}
+	}
+	return &RemoteCache{addr: addr, config: config}
+}
+
+// Get 取得快取值（網路或反序列化錯誤視為未命中）。
+func (rc *RemoteCache) Get(key string) (interface{}, bool) {
+	data, ok, err := rc.GetBytes(key)
+	if err != nil || !ok {
+		return nil, false
+	}
+	v, err := rc.config.Codec.Unmarshal(data)
+	if err != nil {
+		rc.errors.Add(1)
+		return nil, false
+	}
+	return v, true
+}
+
+// Set 設定快取值（錯誤只計入 Errors）。
+func (rc *RemoteCache) Set(key string, value interface{}) {
+	rc.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL 設定快取值與存活時間（SET ... PX，錯誤只計入 Errors）。
+func (rc *RemoteCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	data, err := rc.config.Codec.Marshal(value)
+	if err != nil {
+		rc.errors.Add(1)
+		return
+	}
+	rc.SetBytes(key, data, ttl)
+}
+
+// Delete 刪除快取值（錯誤只計入 Errors）。
+func (rc *RemoteCache) Delete(key string) {
+	rc.Del(key)
+}
+
+// Len 返回節點中的項目數量（錯誤時返回 0）。
+func (rc *RemoteCache) Len() int {
+	v, err := rc.do([]byte("DBSIZE"))
+	if err != nil {
+		return 0
+	}
+	return int(v.Int)
+}
+
+// GetBytes 讀取原始位元組（GET）。
+func (rc *RemoteCache) GetBytes(key string) ([]byte, bool, error) {
+	v, err := rc.do([]byte("GET"), []byte(key))
+	if err != nil {
+		return nil, false, err
+	}
+	if v.Null {
+		return nil, false, nil
+	}
+	return v.Str, true, nil
+}
+
+// SetBytes 寫入原始位元組（SET），ttl 為 0 表示永不過期。
+func (rc *RemoteCache) SetBytes(key string, value []byte, ttl time.Duration) error {
+	args := [][]byte{[]byte("SET"), []byte(key), value}
+	if ttl > 0 {
+		// 不足 1ms 的 TTL 進位為 1ms（PX 0 是錯誤）
+		ms := max(ttl.Milliseconds(), 1)
+		args = append(args, []byte("PX"), []byte(strconv.FormatInt(ms, 10)))
+	}
+	_, err := rc.do(args...)
+	return err
+}
+
+// Del 刪除多個 key（DEL），返回實際刪除的數量。
+func (rc *RemoteCache) Del(keys ...string) (int64, error) {
+	args := make([][]byte, 0, len(keys)+1)
+	args = append(args, []byte("DEL"))
+	for _, k := range keys {
+		args = append(args, []byte(k))
+	}
+	v, err := rc.do(args...)
+	return v.Int, err
+}
+
+// Expire 設定 key 的存活時間（EXPIRE，秒為單位，不足一秒進位），返回 key 是否存在。
+func (rc *RemoteCache) Expire(key string, ttl time.Duration) (bool, error) {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	v, err := rc.do([]byte("EXPIRE"), []byte(key), []byte(strconv.FormatInt(seconds, 10)))
+	return v.Int == 1, err
+}
+
+// Ping 檢查節點是否可用（PING）。
+func (rc *RemoteCache) Ping() error {
+	_, err := rc.do([]byte("PING"))
+	return err
+}
+
+// Errors 返回累計的錯誤次數（網路、逾時、序列化）。
+func (rc *RemoteCache) Errors() int64 {
+	return rc.errors.Load()
+}
+
+// Close 關閉所有閒置連線；使用中的連線在歸還時關閉。
+func (rc *RemoteCache) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.closed = true
+	for _, c := range rc.idle {
+		c.conn.Close()
+	}
+	rc.idle = nil
+	return nil
+}
+
+// do 執行一個命令並返回回覆。
+//
+// 從池中取出的閒置連線可能已經失效（節點重啟、閒置逾時被關閉），
+// 此時以新連線重試一次：支援的命令都是冪等的，重送不會造成副作用
+// 逾時不重試：節點變慢時重試只會讓等待時間加倍
+func (rc *RemoteCache) do(args ...[]byte) (resp.Value, error) {
+	c, reused, err := rc.get()
+	if err != nil {
+		rc.errors.Add(1)
+		return resp.Value{}, err
+	}
+
+	v, err := rc.roundTrip(c, args)
+	if err != nil && reused && !isReplyError(err) && !isTimeout(err) {
+		if c, err = rc.dial(); err == nil {
+			v, err = rc.roundTrip(c, args)
+		}
+	}
+	if err != nil {
+		rc.errors.Add(1)
+	}
+	return v, err
+}
+
+// roundTrip 在一條連線上送出命令並讀取回覆，完成後歸還或關閉連線。
+func (rc *RemoteCache) roundTrip(c *remoteConn, args [][]byte) (resp.Value, error) {
+	c.conn.SetDeadline(time.Now().Add(rc.config.Timeout))
+
+	v, err := func() (resp.Value, error) {
+		if err := c.w.WriteCommand(args...); err != nil {
+			return resp.Value{}, err
+		}
+		if err := c.w.Flush(); err != nil {
+			return resp.Value{}, err
+		}
+		return c.r.ReadValue()
+	}()
+	if err != nil {
+		c.conn.Close()
+		return resp.Value{}, err
+	}
+
+	// 錯誤回覆之後連線仍然可用
+	rc.put(c)
+	if v.Type == resp.TypeError {
+		return resp.Value{}, resp.Error(v.Str)
+	}
+	return v, nil
+}
+
+// get 從池中取出連線（reused 表示是閒置連線而非新建立的）。
+func (rc *RemoteCache) get() (c *remoteConn, reused bool, err error) {
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return nil, false, ErrRemoteClosed
+	}
+	if n := len(rc.idle); n > 0 {
+		// 取最近歸還的連線（LIFO）：閒置時間最短，最不可能已被對方關閉
+		c = rc.idle[n-1]
+		rc.idle = rc.idle[:n-1]
+		rc.mu.Unlock()
+		return c, true, nil
+	}
+	rc.mu.Unlock()
+
+	c, err = rc.dial()
+	return c, false, err
+}
+
+// put 歸還連線。
+func (rc *RemoteCache) put(c *remoteConn) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed || len(rc.idle) >= rc.config.PoolSize {
+		c.conn.Close()
+		return
+	}
+	rc.idle = append(rc.idle, c)
+}
+
+func (rc *RemoteCache) dial() (*remoteConn, error) {
+	conn, err := net.DialTimeout("tcp", rc.addr, rc.config.DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cache: dial %s: %w", rc.addr, err)
+	}
+	return &remoteConn{conn: conn, r: resp.NewReader(conn), w: resp.NewWriter(conn)}, nil
+}
+
+func isReplyError(err error) bool {
+	var e resp.Error
+	return errors.As(err, &e)
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
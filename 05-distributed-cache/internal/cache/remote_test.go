@@ -0,0 +1,228 @@
+package cache_test
+
+import (
+	"encoding/gob"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/05-distributed-cache/internal/cache"
+	"github.com/koopa0/system-design/05-distributed-cache/internal/node"
+)
+
+// 外部測試套件：node 匯入 cache，RemoteCache 的測試需要真正的 node.Server
+
+// countingListener 記錄接受的連線數（用於驗證連線重用）。
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+// startNode 在 loopback 上啟動快取節點，返回位址與連線計數。
+func startNode(t *testing.T, config node.ServerConfig) (string, *countingListener) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &countingListener{Listener: lis}
+	s := node.NewServerWithConfig(cache.NewLRU(100), config)
+	go s.Serve(cl)
+	t.Cleanup(func() { s.Close() })
+	return lis.Addr().String(), cl
+}
+
+// remoteUser 自訂型別的值（GobCodec 需要先 gob.Register）。
+type remoteUser struct{ Name string }
+
+func newRemote(t *testing.T, addr string, config cache.RemoteConfig) *cache.RemoteCache {
+	t.Helper()
+	rc := cache.NewRemoteCache(addr, config)
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
+
+func TestRemoteCache(t *testing.T) {
+	addr, _ := startNode(t, node.ServerConfig{})
+	rc := newRemote(t, addr, cache.RemoteConfig{Timeout: time.Second})
+
+	// 透過 Cache 介面：值以 GobCodec 序列化，型別保留
+	gob.Register(remoteUser{})
+	rc.Set("user:1", remoteUser{"alice"})
+	if v, ok := rc.Get("user:1"); !ok || v.(remoteUser).Name != "alice" {
+		t.Fatalf("Get(user:1) = %v, %v, want alice", v, ok)
+	}
+	// 未註冊的型別序列化失敗：不寫入，計入 Errors
+	type unregistered struct{ Name string }
+	rc.Set("user:2", unregistered{"bob"})
+	if _, ok := rc.Get("user:2"); ok || rc.Errors() != 1 {
+		t.Errorf("unregistered type: hit = %v, Errors() = %d, want a miss and 1 error", ok, rc.Errors())
+	}
+	if _, ok := rc.Get("missing"); ok {
+		t.Error("Get(missing) hit")
+	}
+	rc.SetWithTTL("ttl", 1, 20*time.Millisecond)
+	if rc.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", rc.Len())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := rc.Get("ttl"); ok {
+		t.Error("Get(ttl) hit after expiry")
+	}
+	rc.Delete("user:1")
+	if _, ok := rc.Get("user:1"); ok {
+		t.Error("Get(user:1) hit after Delete")
+	}
+
+	// 原始位元組與其他命令
+	if err := rc.SetBytes("raw", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := rc.GetBytes("raw"); err != nil || !ok || string(v) != "v" {
+		t.Errorf("GetBytes(raw) = %q, %v, %v", v, ok, err)
+	}
+	if ok, err := rc.Expire("raw", 1500*time.Millisecond); err != nil || !ok {
+		t.Errorf("Expire(raw) = %v, %v, want true", ok, err)
+	}
+	if ok, err := rc.Expire("missing", time.Second); err != nil || ok {
+		t.Errorf("Expire(missing) = %v, %v, want false", ok, err)
+	}
+	if n, err := rc.Del("raw", "missing"); err != nil || n != 1 {
+		t.Errorf("Del = %d, %v, want 1", n, err)
+	}
+	if err := rc.Ping(); err != nil {
+		t.Errorf("Ping() = %v", err)
+	}
+	if rc.Errors() != 1 {
+		t.Errorf("Errors() = %d, want only the serialization error", rc.Errors())
+	}
+}
+
+// TestRemoteCachePooling 依序執行的命令重用同一條連線；Close 之後命令失敗。
+func TestRemoteCachePooling(t *testing.T) {
+	addr, lis := startNode(t, node.ServerConfig{})
+	rc := newRemote(t, addr, cache.RemoteConfig{PoolSize: 2, Timeout: time.Second})
+
+	for range 20 {
+		if err := rc.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := lis.accepted.Load(); n != 1 {
+		t.Errorf("accepted %d connections for 20 sequential commands, want 1", n)
+	}
+
+	rc.Close()
+	if err := rc.Ping(); !errors.Is(err, cache.ErrRemoteClosed) {
+		t.Errorf("Ping after Close = %v, want ErrRemoteClosed", err)
+	}
+}
+
+// TestRemoteCacheStaleConnection 池中的連線被節點關閉（閒置逾時）後，以新連線重試一次。
+func TestRemoteCacheStaleConnection(t *testing.T) {
+	addr, lis := startNode(t, node.ServerConfig{IdleTimeout: 20 * time.Millisecond})
+	rc := newRemote(t, addr, cache.RemoteConfig{Timeout: time.Second})
+
+	if err := rc.SetBytes("k", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // 節點關閉閒置的連線
+
+	v, ok, err := rc.GetBytes("k")
+	if err != nil || !ok || string(v) != "v" {
+		t.Fatalf("GetBytes after idle close = %q, %v, %v, want v", v, ok, err)
+	}
+	if n := lis.accepted.Load(); n != 2 {
+		t.Errorf("accepted %d connections, want 2 (the retry dials a new one)", n)
+	}
+	if rc.Errors() != 0 {
+		t.Errorf("Errors() = %d, want 0 (a successful retry is not an error)", rc.Errors())
+	}
+}
+
+// TestRemoteCacheTimeout 節點不回應時在 Timeout 後失敗，且不重試。
+func TestRemoteCacheTimeout(t *testing.T) {
+	// 接受連線但從不回應
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &countingListener{Listener: lis}
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		cl.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := cl.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	rc := newRemote(t, lis.Addr().String(), cache.RemoteConfig{Timeout: 30 * time.Millisecond})
+
+	for range 2 {
+		start := time.Now()
+		_, _, err := rc.GetBytes("k")
+		var ne net.Error
+		if !errors.As(err, &ne) || !ne.Timeout() {
+			t.Fatalf("GetBytes() error = %v, want a timeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("GetBytes() took %v, want about the 30ms timeout", elapsed)
+		}
+	}
+	if _, ok := rc.Get("k"); ok {
+		t.Error("Get() hit on a timeout")
+	}
+	if n := cl.accepted.Load(); n != 3 {
+		t.Errorf("accepted %d connections for 3 timed-out commands, want 3 (timed-out connections are discarded, never retried)", n)
+	}
+	if rc.Errors() != 3 {
+		t.Errorf("Errors() = %d, want 3", rc.Errors())
+	}
+}
+
+// TestRemoteCacheDialError 節點無法連線時錯誤計入 Errors，透過 Cache 介面視為未命中。
+func TestRemoteCacheDialError(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	rc := newRemote(t, addr, cache.RemoteConfig{DialTimeout: 100 * time.Millisecond})
+	if _, ok := rc.Get("k"); ok {
+		t.Error("Get() hit without a node")
+	}
+	rc.Set("k", "v")
+	if err := rc.Ping(); err == nil {
+		t.Error("Ping() succeeded without a node")
+	}
+	if rc.Errors() != 3 {
+		t.Errorf("Errors() = %d, want 3", rc.Errors())
+	}
+}
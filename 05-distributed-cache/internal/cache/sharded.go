@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShardedConfig 分片快取設定（零值使用預設值）。
+type ShardedConfig struct {
+	// Config 整體的容量設定，Capacity 與 MaxBytes 平均分配給各分片
+	Config
+
+	// Shards 分片數（預設 GOMAXPROCS × 4），向上取 2 的冪次；
+	// 分配後每個分片的上限不足 1 時減少分片數
+	Shards int
+
+	// NewShard 以分片的容量設定建立單一分片（預設 NewLRUWithConfig）
+	NewShard func(config Config) Cache
+
+	// ReadBuffer 每個分片的讀取緩衝大小（0 表示不緩衝）
+	//
+	// 只對支援延遲記錄存取的淘汰策略生效（LRU、LFU、WTinyLFU、ARC），其他實作照常呼叫 Get
+	ReadBuffer int
+}
+
+// Sharded 以 key 的雜湊分片、每個分片獨立加鎖的並發快取（lock striping）。
+//
+// 問題：LRU 的 Get 會移動鏈表節點（更新最近性），必須持有寫鎖
+//
+//	→ 讀取也互相排隊，核心數越多，越多時間花在等鎖
+//	→ RWMutex 救不了：需要寫鎖的正是最頻繁的 Get
+//
+// 解法一：分片（lock striping）
+//
+//	key ──hash──▶ shard[hash & mask] ──▶ 各自的 LRU 與鎖
+//
+//	N 個分片 → 同一把鎖的競爭者約為 1/N
+//	代價：淘汰只在分片內進行，整體不是嚴格的 LRU（熱點集中在某分片時，該分片的容量較吃緊）
+//
+// 解法二：讀取緩衝（Caffeine、Ristretto 的做法，ReadBuffer > 0 時啟用）
+//
+//	Get：讀鎖查詢（peek，不更新最近性）→ key 放入緩衝 → 返回
+//	緩衝滿：一次取得寫鎖，批次套用所有存取紀錄（touch）
+//
+//	讀鎖可以並行，寫鎖的次數降為 1/ReadBuffer
+//
+// 讀取緩衝的取捨：
+//   - 緩衝以 sync.Pool 實作，每個 P 有自己的緩衝，寫入緩衝不需要鎖
+//   - 有損（lossy）：同一分片已有 goroutine 在套用紀錄時，直接丟棄這批，GC 也可能回收緩衝
+//     → 最近性與頻率只是近似值，少數紀錄遺失對命中率的影響很小，
+//     但每個分片最多一個讀取者等待寫鎖，其他讀取者不會排隊
+//   - 過期項目在讀鎖下無法刪除：peek 視為未命中，由 touch 或主動過期刪除
+//
+// 為何不用 TryLock 取得寫鎖？
+//
+//	讀取為主時讀鎖幾乎總是被持有，TryLock 幾乎總是失敗，紀錄會全部遺失
+//
+// 何時使用：
+//   - 多核心、讀取為主的單機快取（如 cmd/node 的快取節點）
+//   - 單核心或寫入為主時沒有好處，反而多了雜湊與緩衝的成本
+type Sharded struct {
+	shards []*shard
+	mask   uint64
+	seed   maphash.Seed
+}
+
+// shard 是一個分片：底層快取與（可選的）讀取緩衝。
+type shard struct {
+	cache    Cache
+	buffered bufferedCache // 底層快取支援讀取緩衝且 ReadBuffer > 0 時非 nil
+	size     int           // 讀取緩衝大小
+	pool     sync.Pool     // *[]string，每個 P 一份緩衝
+	draining atomic.Bool   // 是否有 goroutine 正在套用紀錄
+}
+
+// bufferedCache 支援延遲記錄存取的快取（讀取緩衝使用）。
+type bufferedCache interface {
+	Cache
+
+	// peek 以讀鎖查詢，不更新最近性或頻率；過期項目視為未命中
+	peek(key string) (interface{}, bool)
+
+	// touch 以寫鎖批次套用存取紀錄（與 Get 的副作用相同）
+	touch(keys []string)
+}
+
+// NewSharded 建立分片快取。
+//
+// 範例：16 個分片的 W-TinyLFU，每個分片緩衝 64 次讀取
+//
+//	c := cache.NewSharded(cache.ShardedConfig{
+//		Config:     cache.Config{Capacity: 100000},
+//		Shards:     16,
+//		NewShard:   func(c cache.Config) cache.Cache { return cache.NewWTinyLFU(c.Capacity) },
+//		ReadBuffer: 64,
+//	})
+func NewSharded(config ShardedConfig) *Sharded {
+	if config.Shards <= 0 {
+		config.Shards = runtime.GOMAXPROCS(0) * 4
+	}
+	if config.NewShard == nil {
+		config.NewShard = func(c Config) Cache { return NewLRUWithConfig(c) }
+	}
+
+	// 分片數取 2 的冪次（以位元遮罩取代取餘數）
+	n := 1 << bits.Len(uint(config.Shards-1))
+	for n > 1 && !splittable(config.Config, n) {
+		n >>= 1
+	}
+
+	s := &Sharded{
+		shards: make([]*shard, n),
+		mask:   uint64(n - 1),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range s.shards {
+		// 無法整除時，前面的分片各多分 1
+		c := config.Config
+		c.Capacity = config.Capacity / n
+		if i < config.Capacity%n {
+			c.Capacity++
+		}
+		c.MaxBytes = config.MaxBytes / int64(n)
+		if int64(i) < config.MaxBytes%int64(n) {
+			c.MaxBytes++
+		}
+
+		sh := &shard{cache: config.NewShard(c), size: config.ReadBuffer}
+		if bc, ok := sh.cache.(bufferedCache); ok && config.ReadBuffer > 0 {
+			sh.buffered = bc
+			sh.pool.New = func() any {
+				buf := make([]string, 0, config.ReadBuffer)
+				return &buf
+			}
+		}
+		s.shards[i] = sh
+	}
+	return s
+}
+
+// splittable 容量設定能否分給 n 個分片。
+//
+// 有設定的上限分配後至少要是 1：分片的上限為 0 會變成「不限」
+func splittable(c Config, n int) bool {
+	if c.Capacity <= 0 && c.MaxBytes <= 0 {
+		return false // 不保存任何項目，分片沒有意義
+	}
+	if c.Capacity > 0 && c.Capacity < n {
+		return false
+	}
+	return c.MaxBytes <= 0 || c.MaxBytes >= int64(n)
+}
+
+// shard 返回 key 所屬的分片。
+func (s *Sharded) shard(key string) *shard {
+	return s.shards[maphash.String(s.seed, key)&s.mask]
+}
+
+// Get 取得快取值。
+//
+// 啟用讀取緩衝時只取得分片的讀鎖，存取紀錄延遲套用（見 Sharded）
+func (s *Sharded) Get(key string) (interface{}, bool) {
+	sh := s.shard(key)
+	if sh.buffered == nil {
+		return sh.cache.Get(key)
+	}
+
+	value, ok := sh.buffered.peek(key)
+	sh.record(key)
+	return value, ok
+}
+
+// record 將一次讀取放入緩衝，緩衝滿時批次套用。
+//
+// 未命中也記錄：W-TinyLFU 的准入需要 key 被請求的次數，其他策略會忽略不存在的 key
+func (sh *shard) record(key string) {
+	bufp := sh.pool.Get().(*[]string)
+	buf := append(*bufp, key)
+	if len(buf) >= sh.size {
+		// 已有 goroutine 在套用時丟棄這批紀錄，避免多個讀取者一起等寫鎖
+		if sh.draining.CompareAndSwap(false, true) {
+			sh.buffered.touch(buf)
+			sh.draining.Store(false)
+		}
+		clear(buf) // 釋放 key 的參考
+		buf = buf[:0]
+	}
+	*bufp = buf
+	sh.pool.Put(bufp)
+}
+
+// Set 設定快取值。
+func (s *Sharded) Set(key string, value interface{}) {
+	s.shard(key).cache.Set(key, value)
+}
+
+// SetWithTTL 設定快取值與存活時間（ttl <= 0 表示永不過期）。
+func (s *Sharded) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	s.shard(key).cache.SetWithTTL(key, value, ttl)
+}
+
+// Delete 刪除快取項目。
+func (s *Sharded) Delete(key string) {
+	s.shard(key).cache.Delete(key)
+}
+
+// Expire 只修改 key 的存活時間，返回 key 是否存在（見 LRU.Expire）。
+//
+// 底層快取沒有 Expire 方法時返回 false
+func (s *Sharded) Expire(key string, ttl time.Duration) bool {
+	if c, ok := s.shard(key).cache.(interface {
+		Expire(key string, ttl time.Duration) bool
+	}); ok {
+		return c.Expire(key, ttl)
+	}
+	return false
+}
+
+// Remove 刪除 key，返回刪除前是否存在（見 LRU.Remove）。
+//
+// 底層快取沒有 Remove 方法時退回 Delete，返回 false
+func (s *Sharded) Remove(key string) bool {
+	c := s.shard(key).cache
+	if r, ok := c.(interface{ Remove(key string) bool }); ok {
+		return r.Remove(key)
+	}
+	c.Delete(key)
+	return false
+}
+
+// Len 返回所有分片的項目數總和（逐一加鎖，不是同一時間點的快照）。
+func (s *Sharded) Len() int {
+	total := 0
+	for _, sh := range s.shards {
+		total += sh.cache.Len()
+	}
+	return total
+}
+
+// Shards 返回分片數。
+func (s *Sharded) Shards() int {
+	return len(s.shards)
+}
+
+// RemoveExpired 清理所有分片的過期項目，返回清理的數量。
+//
+// 底層快取沒有 RemoveExpired 方法時略過
+func (s *Sharded) RemoveExpired() int {
+	removed := 0
+	for _, sh := range s.shards {
+		if c, ok := sh.cache.(interface{ RemoveExpired() int }); ok {
+			removed += c.RemoveExpired()
+		}
+	}
+	return removed
+}
+
+// Evictions 返回所有分片按原因分類的移除次數總和。
+//
+// 底層快取沒有 Evictions 方法時略過
+func (s *Sharded) Evictions() EvictionStats {
+	var total EvictionStats
+	for _, sh := range s.shards {
+		if c, ok := sh.cache.(interface{ Evictions() EvictionStats }); ok {
+			stats := c.Evictions()
+			total.Capacity += stats.Capacity
+			total.Expired += stats.Expired
+			total.Deleted += stats.Deleted
+		}
+	}
+	return total
+}
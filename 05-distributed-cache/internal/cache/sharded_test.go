@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 並發效能比較：單一鎖的快取 vs 分片快取（有無讀取緩衝）
+//
+// 執行方式（-cpu 指定不同的 GOMAXPROCS，觀察核心數增加時的擴展性）：
+//
+//	go test ./internal/cache -run '^$' -bench Parallel -cpu 1,4,16
+//
+// 預期：
+//   - 單一鎖的快取：核心數增加時 ns/op 不降反升（鎖競爭與快取行在核心間搬移）
+//   - 分片：競爭分散到各分片，ns/op 隨核心數下降
+//   - 分片 + 讀取緩衝：Get 只取讀鎖，讀取為主時擴展性最好
+
+const (
+	parallelCapacity = 10_000
+	parallelKeys     = 1 << 16 // 預先產生的存取序列長度（每個 goroutine 從隨機位置開始循環）
+)
+
+// parallelTrace 預先產生 Zipf 分佈的 key，避免在計時範圍內格式化字串。
+func parallelTrace() []string {
+	t := zipfTrace(1, 1.1, parallelKeys)
+	keys := make([]string, len(t))
+	for i, k := range t {
+		keys[i] = strconv.FormatUint(k, 10)
+	}
+	return keys
+}
+
+// parallelCaches 參與比較的快取。
+func parallelCaches() []struct {
+	name string
+	new  func() Cache
+} {
+	sharded := func(newShard func(Config) Cache, readBuffer int) func() Cache {
+		return func() Cache {
+			return NewSharded(ShardedConfig{
+				Config:     Config{Capacity: parallelCapacity},
+				NewShard:   newShard,
+				ReadBuffer: readBuffer,
+			})
+		}
+	}
+	lru := func(c Config) Cache { return NewLRUWithConfig(c) }
+	tinyLFU := func(c Config) Cache { return NewWTinyLFU(c.Capacity) }
+
+	return []struct {
+		name string
+		new  func() Cache
+	}{
+		{"LRU", func() Cache { return NewLRU(parallelCapacity) }},
+		{"LFU", func() Cache { return NewLFU(parallelCapacity) }},
+		{"WTinyLFU", func() Cache { return NewWTinyLFU(parallelCapacity) }},
+		{"ARC", func() Cache { return NewARC(parallelCapacity) }},
+		{"Sharded-LRU", sharded(lru, 0)},
+		{"Sharded-LRU-Buffered", sharded(lru, 64)},
+		{"Sharded-WTinyLFU", sharded(tinyLFU, 0)},
+		{"Sharded-WTinyLFU-Buffered", sharded(tinyLFU, 64)},
+	}
+}
+
+// BenchmarkParallelGet 只讀取（快取已預熱）。
+func BenchmarkParallelGet(b *testing.B) {
+	keys := parallelTrace()
+	for _, tc := range parallelCaches() {
+		b.Run(tc.name, func(b *testing.B) {
+			c := tc.new()
+			for _, key := range keys {
+				c.Set(key, key)
+			}
+
+			var seed atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.New(rand.NewSource(seed.Add(1))).Intn(len(keys))
+				for pb.Next() {
+					c.Get(keys[i])
+					i = (i + 1) % len(keys)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkParallelCacheAside 讀取未命中時寫入（Cache-Aside），同時報告命中率。
+//
+// 讀取緩衝會遺失部分存取紀錄，命中率可以看出近似的代價
+func BenchmarkParallelCacheAside(b *testing.B) {
+	keys := parallelTrace()
+	for _, tc := range parallelCaches() {
+		b.Run(tc.name, func(b *testing.B) {
+			c := tc.new()
+
+			var seed, hits, total atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.New(rand.NewSource(seed.Add(1))).Intn(len(keys))
+				var h, n int64
+				for pb.Next() {
+					key := keys[i]
+					if _, ok := c.Get(key); ok {
+						h++
+					} else {
+						c.Set(key, key)
+					}
+					n++
+					i = (i + 1) % len(keys)
+				}
+				hits.Add(h)
+				total.Add(n)
+			})
+			b.ReportMetric(float64(hits.Load())/float64(max(total.Load(), 1))*100, "hit%")
+		})
+	}
+}
+
+// shardConfigs 建立分片快取，返回各分片收到的容量設定。
+func shardConfigs(config ShardedConfig) (*Sharded, []Config) {
+	var configs []Config
+	config.NewShard = func(c Config) Cache {
+		configs = append(configs, c)
+		return NewLRUWithConfig(c)
+	}
+	return NewSharded(config), configs
+}
+
+// TestShardedCapacitySplit 容量平均分給各分片，無法整除時前面的分片各多分 1。
+func TestShardedCapacitySplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ShardedConfig
+		want   []Config
+	}{
+		{"even", ShardedConfig{Config: Config{Capacity: 8}, Shards: 4},
+			[]Config{{Capacity: 2}, {Capacity: 2}, {Capacity: 2}, {Capacity: 2}}},
+		{"remainder", ShardedConfig{Config: Config{Capacity: 10}, Shards: 4},
+			[]Config{{Capacity: 3}, {Capacity: 3}, {Capacity: 2}, {Capacity: 2}}},
+		{"power of two", ShardedConfig{Config: Config{Capacity: 100}, Shards: 3},
+			[]Config{{Capacity: 25}, {Capacity: 25}, {Capacity: 25}, {Capacity: 25}}},
+		{"bytes", ShardedConfig{Config: Config{Capacity: 4, MaxBytes: 7}, Shards: 2},
+			[]Config{{Capacity: 2, MaxBytes: 4}, {Capacity: 2, MaxBytes: 3}}},
+		// 分配後上限不足 1（0 會變成不限）：減少分片數
+		{"fewer shards", ShardedConfig{Config: Config{Capacity: 3}, Shards: 8},
+			[]Config{{Capacity: 2}, {Capacity: 1}}},
+		{"bytes only", ShardedConfig{Config: Config{MaxBytes: 2}, Shards: 16},
+			[]Config{{MaxBytes: 1}, {MaxBytes: 1}}},
+		{"zero", ShardedConfig{Shards: 4}, []Config{{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, configs := shardConfigs(tt.config)
+			if s.Shards() != len(tt.want) || len(configs) != len(tt.want) {
+				t.Fatalf("Shards() = %d, want %d", s.Shards(), len(tt.want))
+			}
+			for i, c := range configs {
+				if c.Capacity != tt.want[i].Capacity || c.MaxBytes != tt.want[i].MaxBytes {
+					t.Errorf("shard %d: Capacity %d, MaxBytes %d; want %d, %d",
+						i, c.Capacity, c.MaxBytes, tt.want[i].Capacity, tt.want[i].MaxBytes)
+				}
+			}
+		})
+	}
+}
+
+// TestShardedDefaultShards 預設分片數為 GOMAXPROCS × 4 向上取 2 的冪次。
+func TestShardedDefaultShards(t *testing.T) {
+	s := NewSharded(ShardedConfig{Config: Config{Capacity: 1 << 20}})
+	n := s.Shards()
+	if n < runtime.GOMAXPROCS(0)*4 || n&(n-1) != 0 {
+		t.Errorf("Shards() = %d, want a power of two ≥ GOMAXPROCS×4", n)
+	}
+}
+
+func TestSharded(t *testing.T) {
+	for _, readBuffer := range []int{0, 4} {
+		t.Run("ReadBuffer="+strconv.Itoa(readBuffer), func(t *testing.T) {
+			s := NewSharded(ShardedConfig{Config: Config{Capacity: 100}, Shards: 4, ReadBuffer: readBuffer})
+			for i := range 50 {
+				s.Set(strconv.Itoa(i), i)
+			}
+			for i := range 50 {
+				if v, ok := s.Get(strconv.Itoa(i)); !ok || v != i {
+					t.Fatalf("Get(%d) = %v, %v", i, v, ok)
+				}
+			}
+			if s.Len() != 50 {
+				t.Errorf("Len() = %d, want 50", s.Len())
+			}
+
+			s.Delete("0")
+			if !s.Remove("1") || s.Remove("1") {
+				t.Error("Remove(1) twice, want true then false")
+			}
+			if !s.Expire("2", time.Nanosecond) || s.Expire("missing", time.Second) {
+				t.Error("Expire returned the wrong existence")
+			}
+			time.Sleep(time.Millisecond)
+			if _, ok := s.Get("2"); ok {
+				t.Error("Get(2) hit after expiry")
+			}
+			// 讀取緩衝下 Get 只以讀鎖查詢，過期項目可能還在：由 RemoveExpired 清理
+			s.RemoveExpired()
+			if s.Len() != 47 {
+				t.Errorf("Len() = %d, want 47", s.Len())
+			}
+			if got := s.Evictions(); got != (EvictionStats{Expired: 1, Deleted: 2}) {
+				t.Errorf("Evictions() = %+v, want the sum over all shards", got)
+			}
+		})
+	}
+}
+
+// TestShardedReadBuffer 讀取緩衝滿時批次套用存取紀錄（touch），更新最近性。
+func TestShardedReadBuffer(t *testing.T) {
+	s := NewSharded(ShardedConfig{Config: Config{Capacity: 2}, Shards: 1, ReadBuffer: 2})
+	s.Set("a", 1)
+	s.Set("b", 2)
+
+	// 緩衝有損（-race 下 sync.Pool 會隨機丟棄），多讀幾次確保至少套用一批
+	for range 100 {
+		if v, ok := s.Get("a"); !ok || v != 1 {
+			t.Fatalf("Get(a) = %v, %v", v, ok)
+		}
+	}
+	s.Set("c", 3) // a 已是最近使用：淘汰 b
+
+	lru := s.shards[0].cache.(*LRU)
+	if _, ok := lru.peek("a"); !ok {
+		t.Error("a evicted, want the buffered reads applied to the LRU order")
+	}
+	if _, ok := lru.peek("b"); ok {
+		t.Error("b kept, want it evicted as the least recently used")
+	}
+}
+
+// TestShardedPeekSkipsRecency 緩衝尚未滿時 Get 不更新最近性（peek 只取讀鎖）。
+func TestShardedPeekSkipsRecency(t *testing.T) {
+	s := NewSharded(ShardedConfig{Config: Config{Capacity: 2}, Shards: 1, ReadBuffer: 1 << 10})
+	s.Set("a", 1)
+	s.Set("b", 2)
+	s.Get("a")    // 只放入緩衝
+	s.Set("c", 3) // LRU 順序未變：淘汰 a
+
+	if _, ok := s.Get("a"); ok {
+		t.Error("Get(a) hit, want the unapplied read to leave a least recently used")
+	}
+}
+
+// TestShardedFallback 底層快取不支援讀取緩衝、Expire、Remove 時照常運作。
+func TestShardedFallback(t *testing.T) {
+	type plain struct{ Cache } // 只有 Cache 介面的方法
+	s := NewSharded(ShardedConfig{
+		Config:     Config{Capacity: 10},
+		Shards:     2,
+		NewShard:   func(c Config) Cache { return plain{NewLRUWithConfig(c)} },
+		ReadBuffer: 4,
+	})
+	if s.shards[0].buffered != nil {
+		t.Fatal("read buffer enabled for a cache without peek and touch")
+	}
+
+	s.Set("k", 1)
+	if v, ok := s.Get("k"); !ok || v != 1 {
+		t.Errorf("Get(k) = %v, %v", v, ok)
+	}
+	if s.Expire("k", time.Second) {
+		t.Error("Expire() = true without an Expire method")
+	}
+	if s.Remove("k") {
+		t.Error("Remove() = true without a Remove method")
+	}
+	if _, ok := s.Get("k"); ok {
+		t.Error("Get(k) hit after Remove fell back to Delete")
+	}
+	if s.RemoveExpired() != 0 || s.Evictions() != (EvictionStats{}) {
+		t.Error("RemoveExpired or Evictions counted shards without the method")
+	}
+}
+
+// TestShardedConcurrent 並發讀寫（以 -race 執行）：總項目數不超過容量。
+func TestShardedConcurrent(t *testing.T) {
+	const capacity = 100
+	s := NewSharded(ShardedConfig{
+		Config:     Config{Capacity: capacity},
+		Shards:     4,
+		NewShard:   func(c Config) Cache { return NewWTinyLFU(c.Capacity) },
+		ReadBuffer: 8,
+	})
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for range 5000 {
+				key := strconv.Itoa(r.Intn(4 * capacity))
+				if _, ok := s.Get(key); !ok {
+					s.SetWithTTL(key, key, time.Duration(r.Intn(2))*time.Millisecond)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s.Len() > capacity {
+		t.Errorf("Len() = %d, want at most %d", s.Len(), capacity)
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+// frequencySketch 以 Count-Min Sketch 估算 key 的存取頻率（W-TinyLFU 的准入過濾器）。
+//
+// 為何不用精確計數（如 LFU 的 map）？
+//   - 精確計數要記住所有出現過的 key，包括已經不在快取中的（否則新 key 永遠比不過舊 key）
+//   - Sketch 的記憶體固定：depth × width 個計數器，與 key 數量無關
+//
+// 原理：
+//
+//	4 列計數器，每列以不同的雜湊位置記錄；估計值取 4 個計數器的最小值
+//	碰撞只會讓計數器偏高，取最小值可以排除大部分碰撞的影響
+//
+// 老化（aging）：
+//
+//	問題：只增不減的頻率無法反映近期熱度（過去的熱點永遠佔著快取）
+//	解法：總增加次數達到取樣數（容量的 10 倍）時，所有計數器減半
+//	→ 頻率代表「最近一段時間」的熱度，這正是 LFU 缺少的
+//
+// 計數器上限為 15（Caffeine 使用 4 位元計數器）：准入只需要比較相對大小，
+// 高頻 key 之間的差異不重要
+type frequencySketch struct {
+	table      [sketchDepth][]uint8
+	mask       uint64
+	seed       maphash.Seed
+	additions  int
+	sampleSize int
+}
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+)
+
+// newFrequencySketch 建立頻率估計器（capacity 為快取容量）。
+func newFrequencySketch(capacity int) *frequencySketch {
+	// 寬度取不小於容量的 2 的冪次，以位元遮罩取代取餘數
+	width := 1 << bits.Len(uint(max(capacity, 16)-1))
+	s := &frequencySketch{
+		mask:       uint64(width - 1),
+		seed:       maphash.MakeSeed(),
+		sampleSize: 10 * max(capacity, 1),
+	}
+	for i := range s.table {
+		s.table[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes 計算 key 在各列的位置。
+//
+// 只計算一次雜湊：以 h1 + i×h2 產生各列的位置（double hashing），
+// 效果接近 4 個獨立的雜湊函數
+func (s *frequencySketch) indexes(key string) [sketchDepth]uint64 {
+	h := maphash.String(s.seed, key)
+	h1, h2 := h&0xffffffff, h>>32|1
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+// increment 記錄一次存取。
+func (s *frequencySketch) increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.table[i][j] < sketchMaxCounter {
+			s.table[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate 估計 key 的存取頻率。
+func (s *frequencySketch) estimate(key string) uint8 {
+	freq := uint8(sketchMaxCounter)
+	for i, j := range s.indexes(key) {
+		freq = min(freq, s.table[i][j])
+	}
+	return freq
+}
+
+// reset 所有計數器減半（老化）。
+func (s *frequencySketch) reset() {
+	for i := range s.table {
+		for j := range s.table[i] {
+			s.table[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFrequencySketch(t *testing.T) {
+	s := newFrequencySketch(1000)
+	for range 5 {
+		s.increment("a")
+	}
+	s.increment("b")
+
+	// 只會高估：碰撞讓計數器偏高，不會偏低
+	if got := s.estimate("a"); got < 5 {
+		t.Errorf("estimate(a) = %d, want at least 5", got)
+	}
+	if got := s.estimate("b"); got < 1 || got >= s.estimate("a") {
+		t.Errorf("estimate(b) = %d, want at least 1 and below a", got)
+	}
+
+	// 計數器上限
+	for range 100 {
+		s.increment("a")
+	}
+	if got := s.estimate("a"); got != sketchMaxCounter {
+		t.Errorf("estimate(a) = %d, want the %d cap", got, sketchMaxCounter)
+	}
+}
+
+// TestFrequencySketchAging 增加次數達到取樣數時所有計數器減半。
+func TestFrequencySketchAging(t *testing.T) {
+	s := newFrequencySketch(10) // 取樣數 100
+	for range 12 {
+		s.increment("hot")
+	}
+	// 其他 key 補到取樣數的前一次
+	for i := range s.sampleSize - 13 {
+		s.increment(strconv.Itoa(i))
+	}
+	before := s.estimate("hot")
+
+	s.increment("last") // 第 100 次：減半
+	if got := s.estimate("hot"); got > before/2+1 {
+		t.Errorf("estimate(hot) = %d after aging, want about half of %d", got, before)
+	}
+	if s.additions != s.sampleSize/2 {
+		t.Errorf("additions = %d after reset, want %d", s.additions, s.sampleSize/2)
+	}
+}
@@ -0,0 +1,358 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// W-TinyLFU 的三個區段
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+// WTinyLFU 實作 W-TinyLFU 快取淘汰演算法（Caffeine 的預設策略）。
+//
+// 要解決的問題：
+//   - LRU：一次掃描（如報表查詢全表）就把熱點資料全部擠出
+//   - LFU：頻率只增不減，過去的熱點永遠佔著快取；新資料頻率為 1，很難留下
+//
+// 結構：
+//
+//	新資料 ──▶ Window LRU（容量 1%）
+//	             │ Window 滿時，尾端成為候選者
+//	             ▼
+//	           TinyLFU 准入過濾器：頻率(候選者) > 頻率(受害者)？
+//	             │ 是：淘汰受害者，候選者進入主區
+//	             │ 否：淘汰候選者
+//	             ▼
+//	           主區：Segmented LRU（容量 99%）
+//	             Probation（20%）：新進入主區的資料，受害者從這裡的尾端選出
+//	             Protected（80%）：在 Probation 中再次被存取的資料
+//
+// 各部分的作用：
+//   - Window：新資料先進入小型 LRU，有機會累積頻率（解決 LFU 的新資料問題）
+//   - 准入過濾器：只有比受害者更常被存取的資料才能進入主區（抵抗掃描）
+//   - 頻率估計：Count-Min Sketch 定期減半（解決 LFU 不會老化的問題，見 frequencySketch）
+//   - Segmented LRU：只被存取一次的資料留在 Probation，不會擠掉 Protected 中的熱點
+//
+// 時間複雜度：
+//   - Get: O(1)（Sketch 固定 4 列）
+//   - Set: O(1)；每 10×容量 次存取有一次 O(容量) 的減半
+//
+// 與 Caffeine 的差異（教學簡化）：
+//   - Window 大小固定為 1%（Caffeine 以爬山法動態調整）
+//   - 沒有 Doorkeeper（Bloom Filter 過濾只出現一次的 key）
+//   - 沒有防雜湊碰撞攻擊的隨機准入
+//
+// 只支援項目數上限（Window 與主區的比例以項目數計算）
+type WTinyLFU struct {
+	windowCap    int
+	mainCap      int
+	protectedCap int
+
+	cache     map[string]*list.Element
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	sketch    *frequencySketch
+
+	expiring expiring
+	writes   int
+	stats    EvictionStats
+	mu       sync.RWMutex
+}
+
+// tinyLFUEntry 是 W-TinyLFU 的節點。
+type tinyLFUEntry struct {
+	meta
+	value   interface{}
+	segment int
+}
+
+// NewWTinyLFU 建立 W-TinyLFU 快取。
+//
+// 參數：
+//
+//	capacity: 快取容量（Window 佔 1%，至少 1 個；主區中 Protected 佔 80%）
+func NewWTinyLFU(capacity int) *WTinyLFU {
+	capacity = max(capacity, 0)
+	windowCap := min(max(capacity/100, 1), capacity)
+	mainCap := capacity - windowCap
+	return &WTinyLFU{
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: mainCap * 8 / 10,
+		cache:        make(map[string]*list.Element),
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		sketch:       newFrequencySketch(capacity),
+	}
+}
+
+// Get 取得快取值。
+//
+// 行為：
+//   - 不論是否命中都記錄頻率（准入比較的是 key 被請求的次數，而非在快取中被讀取的次數）
+//   - Window / Protected 中的項目移到頭部
+//   - Probation 中的項目晉升到 Protected（第二次存取，證明不是一次性資料）
+func (c *WTinyLFU) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sketch.increment(key)
+
+	elem, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	ent := elem.Value.(*tinyLFUEntry)
+	if !ent.expireAt.IsZero() && ent.expired(time.Now()) {
+		c.removeElement(elem, EvictExpired)
+		return nil, false
+	}
+
+	c.onHit(elem)
+	return ent.value, true
+}
+
+// peek 以讀鎖查詢，不記錄頻率也不調整區段（Sharded 的讀取緩衝使用）。
+func (c *WTinyLFU) peek(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if elem, ok := c.cache[key]; ok {
+		ent := elem.Value.(*tinyLFUEntry)
+		if ent.expireAt.IsZero() || !ent.expired(time.Now()) {
+			return ent.value, true
+		}
+	}
+	return nil, false
+}
+
+// touch 批次套用讀取紀錄（Sharded 的讀取緩衝使用）。
+//
+// 與 Get 相同：不論是否命中都記錄頻率，命中的項目調整區段
+func (c *WTinyLFU) touch(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		c.sketch.increment(key)
+		elem, ok := c.cache[key]
+		if !ok {
+			continue
+		}
+		if ent := elem.Value.(*tinyLFUEntry); !ent.expireAt.IsZero() && ent.expired(now) {
+			c.removeElement(elem, EvictExpired)
+			continue
+		}
+		c.onHit(elem)
+	}
+}
+
+// Set 設定快取值（覆寫會清除原本的 TTL）。
+func (c *WTinyLFU) Set(key string, value interface{}) {
+	c.set(key, value, time.Time{})
+}
+
+// SetWithTTL 設定快取值與存活時間（ttl <= 0 表示永不過期）。
+func (c *WTinyLFU) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	c.set(key, value, expireAt(ttl))
+}
+
+func (c *WTinyLFU) set(key string, value interface{}, expireAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.windowCap == 0 {
+		return
+	}
+
+	c.writes++
+	if c.writes%activeExpireEvery == 0 {
+		c.expiring.sweep(time.Now(), expireMaxRounds, c.expire)
+	}
+
+	// 已存在：更新值，視為一次存取
+	if elem, ok := c.cache[key]; ok {
+		ent := elem.Value.(*tinyLFUEntry)
+		ent.value = value
+		c.setExpiry(&ent.meta, expireAt)
+		c.sketch.increment(key)
+		c.onHit(elem)
+		return
+	}
+
+	// 新資料進入 Window
+	c.sketch.increment(key)
+	ent := &tinyLFUEntry{meta: meta{key: key, expIdx: -1}, value: value, segment: segmentWindow}
+	c.setExpiry(&ent.meta, expireAt)
+	c.cache[key] = c.window.PushFront(ent)
+
+	if c.window.Len() > c.windowCap {
+		// Window 的 LRU 尾端成為候選者，先放入 Probation，再決定誰留下
+		candidate := c.move(c.window.Back(), c.probation, segmentProbation)
+		c.admit(candidate)
+	}
+}
+
+// admit 主區超過容量時，比較候選者與受害者的頻率，淘汰其中之一。
+//
+// 受害者：Probation 的 LRU 尾端（候選者剛放在頭部）；Probation 只有候選者時改從 Protected 選
+func (c *WTinyLFU) admit(candidate *list.Element) {
+	if c.probation.Len()+c.protected.Len() <= c.mainCap {
+		return
+	}
+
+	victim := c.probation.Back()
+	if victim == candidate {
+		victim = c.protected.Back()
+	}
+	if victim == nil {
+		c.removeElement(candidate, EvictCapacity)
+		return
+	}
+
+	// 頻率相同時淘汰候選者：已在主區的資料優先（抵抗掃描）
+	candidateKey := candidate.Value.(*tinyLFUEntry).key
+	victimKey := victim.Value.(*tinyLFUEntry).key
+	if c.sketch.estimate(candidateKey) > c.sketch.estimate(victimKey) {
+		c.removeElement(victim, EvictCapacity)
+	} else {
+		c.removeElement(candidate, EvictCapacity)
+	}
+}
+
+// onHit 命中時調整項目所在的區段。
+func (c *WTinyLFU) onHit(elem *list.Element) {
+	switch elem.Value.(*tinyLFUEntry).segment {
+	case segmentWindow:
+		c.window.MoveToFront(elem)
+	case segmentProtected:
+		c.protected.MoveToFront(elem)
+	case segmentProbation:
+		c.move(elem, c.protected, segmentProtected)
+		// Protected 超過容量：尾端降級回 Probation（仍在主區，不淘汰）
+		if c.protected.Len() > c.protectedCap {
+			c.move(c.protected.Back(), c.probation, segmentProbation)
+		}
+	}
+}
+
+// move 將項目移到另一個區段的頭部，返回新的鏈表節點。
+func (c *WTinyLFU) move(elem *list.Element, to *list.List, segment int) *list.Element {
+	ent := elem.Value.(*tinyLFUEntry)
+	c.list(ent.segment).Remove(elem)
+	ent.segment = segment
+	elem = to.PushFront(ent)
+	c.cache[ent.key] = elem
+	return elem
+}
+
+func (c *WTinyLFU) list(segment int) *list.List {
+	switch segment {
+	case segmentWindow:
+		return c.window
+	case segmentProbation:
+		return c.probation
+	default:
+		return c.protected
+	}
+}
+
+// setExpiry 更新項目的過期時間，並維護有 TTL 的項目集合。
+func (c *WTinyLFU) setExpiry(m *meta, expireAt time.Time) {
+	m.expireAt = expireAt
+	if expireAt.IsZero() {
+		c.expiring.remove(m)
+	} else {
+		c.expiring.add(m)
+	}
+}
+
+// expire 移除過期項目（主動過期的回呼）。
+func (c *WTinyLFU) expire(m *meta) {
+	c.removeElement(c.cache[m.key], EvictExpired)
+}
+
+// removeElement 移除項目並記錄原因。
+func (c *WTinyLFU) removeElement(elem *list.Element, reason EvictionReason) {
+	ent := elem.Value.(*tinyLFUEntry)
+	c.list(ent.segment).Remove(elem)
+	delete(c.cache, ent.key)
+	c.expiring.remove(&ent.meta)
+	c.stats.record(reason)
+}
+
+// Delete 刪除快取項目。
+func (c *WTinyLFU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.cache[key]; ok {
+		c.removeElement(elem, EvictDeleted)
+	}
+}
+
+// Expire 只修改 key 的存活時間（ttl <= 0 表示永不過期），返回 key 是否存在（見 LRU.Expire）。
+//
+// 不記入頻率草圖、不在區段間移動（修改 TTL 不算一次存取）
+func (c *WTinyLFU) Expire(key string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	ent := elem.Value.(*tinyLFUEntry)
+	if ent.expired(time.Now()) {
+		c.removeElement(elem, EvictExpired)
+		return false
+	}
+	c.setExpiry(&ent.meta, expireAt(ttl))
+	return true
+}
+
+// Remove 刪除 key，返回刪除前是否存在（見 LRU.Remove）。
+func (c *WTinyLFU) Remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	if elem.Value.(*tinyLFUEntry).expired(time.Now()) {
+		c.removeElement(elem, EvictExpired)
+		return false
+	}
+	c.removeElement(elem, EvictDeleted)
+	return true
+}
+
+// Len 返回當前快取項目數量（包含已過期但尚未移除的項目）。
+func (c *WTinyLFU) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.cache)
+}
+
+// RemoveExpired 立即清理過期項目，返回清理的數量（見 LRU.RemoveExpired）。
+func (c *WTinyLFU) RemoveExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expiring.sweep(time.Now(), 0, c.expire)
+}
+
+// Evictions 返回按原因分類的移除次數（累計值）。
+func (c *WTinyLFU) Evictions() EvictionStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats
+}
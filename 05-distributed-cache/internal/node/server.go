@@ -0,0 +1,399 @@
+// Package node 實作快取節點伺服器：以 RESP 協定（Redis 協定的子集）對外提供本地快取。
+//
+// 架構：
+//
+//	DistributedCache ──(一致性雜湊)──▶ RemoteCache ──TCP/RESP──▶ node.Server ──▶ LRU / LFU
+//
+// 支援的命令：
+//
+//	PING [message]
+//	GET key
+//	SET key value [EX seconds | PX milliseconds]
+//	DEL key [key ...]
+//	EXPIRE key seconds
+//	DBSIZE（項目數量，供 RemoteCache.Len 使用）
+//
+// 因為是 Redis 協定的子集，可以直接用 redis-cli 連線除錯：
+//
+//	redis-cli -p 7001 SET user:1001 alice EX 60
+package node
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koopa0/system-design/05-distributed-cache/internal/cache"
+	"github.com/koopa0/system-design/05-distributed-cache/pkg/resp"
+)
+
+// ErrServerClosed Serve 在 Close 之後返回的錯誤。
+var ErrServerClosed = errors.New("node: server closed")
+
+// Server 快取節點伺服器。
+//
+// 並發模型：
+//   - 每個連線一個 goroutine，依序處理該連線的命令（回覆順序與命令順序一致）
+//   - 快取本身是並發安全的，多個連線之間不需要額外加鎖
+//
+// 管線化（pipelining）：
+//
+//	客戶端可以連續送出多個命令再讀取回覆。讀取緩衝區還有資料時先不 Flush，
+//	多個回覆合併成一次 write 系統呼叫
+type Server struct {
+	cache  cache.Cache
+	atomic atomicCache // cache 支援原子操作時非 nil
+	config ServerConfig
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// ServerConfig 快取節點伺服器設定（零值使用預設值）。
+type ServerConfig struct {
+	// IdleTimeout 等待下一個命令（含讀完整個命令）的時間上限（預設 5 分鐘）
+	//
+	// 防止閒置或只送出半個命令的連線永久佔用 goroutine 與讀取緩衝
+	// RemoteCache 的閒置連線被關閉後，下一個命令會以新連線重試
+	IdleTimeout time.Duration
+
+	// WriteTimeout 寫出回覆的時間上限（預設 10 秒）
+	//
+	// 防止不讀取回覆的客戶端讓連線卡在寫入
+	WriteTimeout time.Duration
+}
+
+// atomicCache 能在快取的鎖內完成「檢查存在 + 修改」的快取。
+//
+// 為何需要？
+//
+//	EXPIRE 若以 Get 讀出後再 SetWithTTL 寫回，兩步之間其他連線的 SET 會被舊值覆蓋，
+//	寫回也會更新最近性（只是修改 TTL，卻讓項目變成最近使用）；
+//	DEL 若以 Get 判斷存在再 Delete，兩步之間的寫入或刪除會讓計數錯誤
+//
+// cache 套件的本地快取（LRU、LFU、WTinyLFU、ARC、Sharded）皆實作此介面；
+// 其他 Cache 實作退回讀後寫（非原子）
+type atomicCache interface {
+	Expire(key string, ttl time.Duration) bool
+	Remove(key string) bool
+}
+
+// NewServer 建立快取節點伺服器（使用預設逾時）。
+//
+// 參數：
+//
+//	c: 實際儲存資料的本地快取（如 cache.NewLRU(100000)），過期由快取本身處理
+//
+// 值以 []byte 存入快取：搭配 cache.Config.MaxBytes 時，DefaultSize 可以精確計算大小
+func NewServer(c cache.Cache) *Server {
+	return NewServerWithConfig(c, ServerConfig{})
+}
+
+// NewServerWithConfig 以逾時設定建立快取節點伺服器。
+func NewServerWithConfig(c cache.Cache, config ServerConfig) *Server {
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 5 * time.Minute
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+	s := &Server{
+		cache:  c,
+		config: config,
+		conns:  make(map[net.Conn]struct{}),
+	}
+	s.atomic, _ = c.(atomicCache)
+	return s
+}
+
+// ListenAndServe 監聽 TCP 位址並處理連線（阻塞，直到 Close）。
+func (s *Server) ListenAndServe(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
+
+// Serve 接受連線並處理（阻塞，直到 Close）。
+func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		lis.Close()
+		return ErrServerClosed
+	}
+	s.listener = lis
+	s.mu.Unlock()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// Addr 監聽的位址（Serve 之前為 nil）。
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close 停止接受新連線，關閉所有連線並等待處理中的命令結束。
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// handle 處理一個連線上的所有命令。
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := resp.NewReader(conn)
+	w := resp.NewWriter(conn)
+	for {
+		// 每個命令重設期限：管線化的命令已在緩衝區中，不會等待
+		conn.SetReadDeadline(time.Now().Add(s.config.IdleTimeout))
+		args, err := r.ReadCommand()
+		if err != nil {
+			if errors.Is(err, resp.ErrProtocol) {
+				// 協定錯誤之後無法確定下一個命令從哪裡開始，回覆錯誤後關閉連線
+				conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+				w.WriteError("ERR " + err.Error())
+				w.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Printf("節點連線讀取失敗（%s）：%v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		s.execute(w, args)
+
+		// 沒有更多管線化的命令時才寫出
+		if r.Buffered() == 0 {
+			conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// execute 執行一個命令並寫入回覆。
+func (s *Server) execute(w *resp.Writer, args [][]byte) {
+	name := string(bytes.ToUpper(args[0]))
+	args = args[1:]
+
+	switch name {
+	case "PING":
+		switch len(args) {
+		case 0:
+			w.WriteSimpleString("PONG")
+		case 1:
+			w.WriteBulk(args[0])
+		default:
+			wrongArgs(w, name)
+		}
+
+	case "GET":
+		if len(args) != 1 {
+			wrongArgs(w, name)
+			return
+		}
+		value, ok := s.get(string(args[0]))
+		if !ok {
+			w.WriteNull()
+			return
+		}
+		w.WriteBulk(value)
+
+	case "SET":
+		s.set(w, args)
+
+	case "DEL":
+		if len(args) == 0 {
+			wrongArgs(w, name)
+			return
+		}
+		var deleted int64
+		for _, key := range args {
+			if s.remove(string(key)) {
+				deleted++
+			}
+		}
+		w.WriteInteger(deleted)
+
+	case "EXPIRE":
+		if len(args) != 2 {
+			wrongArgs(w, name)
+			return
+		}
+		seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			w.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		ttl, ok := duration(seconds, time.Second)
+		if !ok {
+			w.WriteError("ERR invalid expire time in 'expire' command")
+			return
+		}
+		w.WriteInteger(boolInt(s.expire(string(args[0]), ttl)))
+
+	case "DBSIZE":
+		if len(args) != 0 {
+			wrongArgs(w, name)
+			return
+		}
+		// 包含已過期但尚未移除的項目
+		w.WriteInteger(int64(s.cache.Len()))
+
+	default:
+		w.WriteError("ERR unknown command '" + name + "'")
+	}
+}
+
+// set 處理 SET key value [EX seconds | PX milliseconds]。
+func (s *Server) set(w *resp.Writer, args [][]byte) {
+	if len(args) != 2 && len(args) != 4 {
+		wrongArgs(w, "SET")
+		return
+	}
+
+	var ttl time.Duration
+	if len(args) == 4 {
+		var unit time.Duration
+		switch string(bytes.ToUpper(args[2])) {
+		case "EX":
+			unit = time.Second
+		case "PX":
+			unit = time.Millisecond
+		default:
+			w.WriteError("ERR syntax error")
+			return
+		}
+		n, err := strconv.ParseInt(string(args[3]), 10, 64)
+		var ok bool
+		if ttl, ok = duration(n, unit); err != nil || n <= 0 || !ok {
+			w.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+	}
+
+	s.cache.SetWithTTL(string(args[0]), args[1], ttl)
+	w.WriteSimpleString("OK")
+}
+
+// expire 修改 key 的存活時間，返回 key 是否存在。
+//
+// 與 Redis 相同：非正數的存活時間直接刪除
+func (s *Server) expire(key string, ttl time.Duration) bool {
+	if ttl <= 0 {
+		return s.remove(key)
+	}
+	if s.atomic != nil {
+		return s.atomic.Expire(key, ttl)
+	}
+	// Cache 介面沒有單獨修改 TTL 的操作，以原值重新寫入（非原子）
+	value, ok := s.get(key)
+	if ok {
+		s.cache.SetWithTTL(key, value, ttl)
+	}
+	return ok
+}
+
+// remove 刪除 key，返回刪除前是否存在。
+func (s *Server) remove(key string) bool {
+	if s.atomic != nil {
+		return s.atomic.Remove(key)
+	}
+	_, ok := s.get(key)
+	s.cache.Delete(key)
+	return ok
+}
+
+// duration 將 n 個 unit 換算為 time.Duration，溢位時返回 false。
+//
+// 為何需要檢查？time.Duration 以奈秒計，約 292 年就溢位：
+// EXPIRE key 9999999999 乘上 time.Second 會變成負數，項目立即被刪除
+func duration(n int64, unit time.Duration) (time.Duration, bool) {
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// get 讀取 key 的值（過期的項目由快取的惰性過期處理，讀不到）。
+func (s *Server) get(key string) ([]byte, bool) {
+	v, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	value, ok := v.([]byte)
+	return value, ok
+}
+
+func wrongArgs(w *resp.Writer, name string) {
+	w.WriteError("ERR wrong number of arguments for '" + name + "' command")
+}
@@ -0,0 +1,300 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koopa0/system-design/05-distributed-cache/internal/cache"
+	"github.com/koopa0/system-design/05-distributed-cache/pkg/resp"
+)
+
+// startServer 在 loopback 上啟動節點，返回節點與位址，測試結束時關閉。
+//
+// 位址取自 listener：Serve 在另一個 goroutine 中執行，Addr 此時可能還是 nil
+func startServer(t *testing.T, c cache.Cache, config ServerConfig) (*Server, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServerWithConfig(c, config)
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(lis) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve() = %v, want ErrServerClosed", err)
+		}
+	})
+	return s, lis.Addr().String()
+}
+
+// client 以 RESP 直接與節點對話的測試客戶端。
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *resp.Reader
+	w    *resp.Writer
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &client{t: t, conn: conn, r: resp.NewReader(conn), w: resp.NewWriter(conn)}
+}
+
+// do 送出以空白分隔的命令，返回回覆的文字形式（如 "+OK"、":1"、"$v"、"$nil"、"-ERR ..."）。
+func (c *client) do(cmd string) string {
+	c.t.Helper()
+	var args [][]byte
+	for _, f := range strings.Fields(cmd) {
+		args = append(args, []byte(f))
+	}
+	c.w.WriteCommand(args...)
+	if err := c.w.Flush(); err != nil {
+		c.t.Fatalf("%s: %v", cmd, err)
+	}
+	return c.read()
+}
+
+func (c *client) read() string {
+	c.t.Helper()
+	v, err := c.r.ReadValue()
+	if err != nil {
+		c.t.Fatalf("read reply: %v", err)
+	}
+	switch {
+	case v.Null:
+		return "$nil"
+	case v.Type == resp.TypeInteger:
+		return fmt.Sprintf(":%d", v.Int)
+	default:
+		return string(v.Type) + string(v.Str)
+	}
+}
+
+func TestServerCommands(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(100), ServerConfig{})
+	c := dial(t, addr)
+
+	steps := []struct {
+		cmd, want string
+	}{
+		{"PING", "+PONG"},
+		{"PING hello", "$hello"},
+		{"GET k", "$nil"},
+		{"SET k v", "+OK"},
+		{"get k", "$v"}, // 命令名稱不分大小寫
+		{"SET k v2 EX 60", "+OK"},
+		{"GET k", "$v2"},
+		{"SET p v PX 60000", "+OK"},
+		{"DBSIZE", ":2"},
+		{"DEL k k missing", ":1"}, // 重複的 key 只計一次
+		{"DEL p", ":1"},
+		{"DBSIZE", ":0"},
+
+		{"SET e v", "+OK"},
+		{"EXPIRE e 60", ":1"},
+		{"EXPIRE missing 60", ":0"},
+		{"EXPIRE e 0", ":1"}, // 非正數直接刪除
+		{"GET e", "$nil"},
+		{"EXPIRE e 0", ":0"},
+
+		{"SET k v EX 0", "-ERR invalid expire time in 'set' command"},
+		{"SET k v EX x", "-ERR invalid expire time in 'set' command"},
+		{"SET k v EX 9223372036854775807", "-ERR invalid expire time in 'set' command"},
+		{"SET k v XX 1", "-ERR syntax error"},
+		{"SET k", "-ERR wrong number of arguments for 'SET' command"},
+		{"EXPIRE k x", "-ERR value is not an integer or out of range"},
+		{"EXPIRE k 9999999999", "-ERR invalid expire time in 'expire' command"},
+		{"GET", "-ERR wrong number of arguments for 'GET' command"},
+		{"DEL", "-ERR wrong number of arguments for 'DEL' command"},
+		{"FLUSHALL", "-ERR unknown command 'FLUSHALL'"},
+		{"PING", "+PONG"}, // 錯誤回覆之後連線仍可用
+	}
+	for _, step := range steps {
+		if got := c.do(step.cmd); got != step.want {
+			t.Errorf("%s = %q, want %q", step.cmd, got, step.want)
+		}
+	}
+}
+
+func TestServerTTL(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(100), ServerConfig{})
+	c := dial(t, addr)
+
+	c.do("SET px v PX 20")
+	c.do("SET ex v")
+	c.do("EXPIRE ex 1")
+	time.Sleep(30 * time.Millisecond)
+	if got := c.do("GET px"); got != "$nil" {
+		t.Errorf("GET px after expiry = %q, want nil", got)
+	}
+	if got := c.do("GET ex"); got != "$v" {
+		t.Errorf("GET ex before expiry = %q, want v", got)
+	}
+	// SET 覆寫會清除 TTL
+	c.do("SET ex v2")
+	c.do("SET px v PX 20")
+	c.do("SET px v3")
+	time.Sleep(30 * time.Millisecond)
+	if got := c.do("GET px"); got != "$v3" {
+		t.Errorf("GET px after overwrite = %q, want v3 without TTL", got)
+	}
+}
+
+// TestServerExpireKeepsRecency EXPIRE 不算一次存取：不會讓項目變成最近使用。
+func TestServerExpireKeepsRecency(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(2), ServerConfig{})
+	c := dial(t, addr)
+
+	c.do("SET a 1")
+	c.do("SET b 2")
+	c.do("EXPIRE a 60")
+	c.do("SET c 3") // 淘汰最久未使用的 a
+	if got := c.do("GET a"); got != "$nil" {
+		t.Errorf("GET a = %q, want a evicted (EXPIRE must not refresh recency)", got)
+	}
+	if got := c.do("GET b"); got != "$2" {
+		t.Errorf("GET b = %q, want 2", got)
+	}
+}
+
+// TestServerExpireConcurrentSet EXPIRE 與 SET 並發：EXPIRE 不會以舊值覆蓋新寫入的值。
+func TestServerExpireConcurrentSet(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(100), ServerConfig{})
+	setter, expirer := dial(t, addr), dial(t, addr)
+
+	const n = 500
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range n {
+			setter.do(fmt.Sprintf("SET k %d", i))
+		}
+	}()
+	for range n {
+		expirer.do("EXPIRE k 60")
+	}
+	wg.Wait()
+
+	if got := setter.do("GET k"); got != fmt.Sprintf("$%d", n-1) {
+		t.Errorf("GET k = %q, want the last SET value %d", got, n-1)
+	}
+}
+
+// TestServerFallback 不支援原子操作的 Cache 實作退回讀後寫。
+func TestServerFallback(t *testing.T) {
+	type plain struct{ cache.Cache } // 隱藏 Expire 與 Remove
+	s, addr := startServer(t, plain{cache.NewLRU(10)}, ServerConfig{})
+	if s.atomic != nil {
+		t.Fatal("plain cache detected as atomic")
+	}
+	c := dial(t, addr)
+
+	c.do("SET k v")
+	for _, step := range []struct{ cmd, want string }{
+		{"EXPIRE k 60", ":1"},
+		{"GET k", "$v"},
+		{"EXPIRE missing 60", ":0"},
+		{"DEL k missing", ":1"},
+	} {
+		if got := c.do(step.cmd); got != step.want {
+			t.Errorf("%s = %q, want %q", step.cmd, got, step.want)
+		}
+	}
+}
+
+// TestServerPipelining 連續送出多個命令再讀取回覆，回覆順序與命令順序一致。
+func TestServerPipelining(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(100), ServerConfig{})
+	c := dial(t, addr)
+
+	c.w.WriteCommand([]byte("SET"), []byte("k"), []byte("v"))
+	c.w.WriteCommand([]byte("GET"), []byte("k"))
+	c.w.WriteCommand([]byte("DEL"), []byte("k"))
+	c.w.Flush()
+	for _, want := range []string{"+OK", "$v", ":1"} {
+		if got := c.read(); got != want {
+			t.Errorf("reply = %q, want %q", got, want)
+		}
+	}
+}
+
+// TestServerProtocolError 協定錯誤回覆錯誤後關閉連線。
+func TestServerProtocolError(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(100), ServerConfig{})
+	c := dial(t, addr)
+
+	c.conn.Write([]byte("GET k\r\n")) // inline 命令不支援
+	if got := c.read(); !strings.HasPrefix(got, "-ERR resp: protocol error") {
+		t.Errorf("reply = %q, want a protocol error", got)
+	}
+	if _, err := c.r.ReadValue(); err == nil {
+		t.Error("connection still open after a protocol error")
+	}
+}
+
+// TestServerNestedCommand 深層巢狀的陣列不會讓節點崩潰：回覆協定錯誤，其他連線不受影響。
+func TestServerNestedCommand(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(100), ServerConfig{})
+	c := dial(t, addr)
+
+	go c.conn.Write([]byte(strings.Repeat("*1\r\n", 1_000_000))) // 節點可能在寫完之前關閉連線
+	if got := c.read(); !strings.HasPrefix(got, "-ERR resp: protocol error") {
+		t.Errorf("reply = %q, want a protocol error", got)
+	}
+	if got := dial(t, addr).do("PING"); got != "+PONG" {
+		t.Errorf("PING on a new connection = %q, want PONG", got)
+	}
+}
+
+// TestServerIdleTimeout 閒置或只送出半個命令的連線在 IdleTimeout 後被關閉。
+func TestServerIdleTimeout(t *testing.T) {
+	_, addr := startServer(t, cache.NewLRU(100), ServerConfig{IdleTimeout: 30 * time.Millisecond})
+
+	idle := dial(t, addr)
+	partial := dial(t, addr)
+	partial.conn.Write([]byte("*2\r\n$3\r\nGET\r\n$1000\r\nab"))
+
+	for name, c := range map[string]*client{"idle": idle, "partial": partial} {
+		start := time.Now()
+		if _, err := c.r.ReadValue(); err == nil {
+			t.Errorf("%s connection: read succeeded, want closed", name)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s connection closed after %v, want about the idle timeout", name, elapsed)
+		}
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s, addr := startServer(t, cache.NewLRU(100), ServerConfig{})
+	c := dial(t, addr)
+	c.do("PING")
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := c.r.ReadValue(); err == nil {
+		t.Error("connection still open after Close")
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(lis); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve after Close = %v, want ErrServerClosed", err)
+	}
+}
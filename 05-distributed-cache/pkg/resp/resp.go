@@ -0,0 +1,325 @@
+// Package resp 實作 Redis 序列化協定（RESP2）的編碼與解碼。
+//
+// 為何使用 RESP 而非自訂協定？
+//   - 格式簡單：以類型字元開頭、\r\n 結尾，一個下午就能實作
+//   - 生態現成：redis-cli、redis-benchmark 可以直接連線測試快取節點
+//   - 二進位安全：Bulk String 帶長度前綴，值中可以包含任意位元組
+//
+// 格式：
+//
+//	+OK\r\n                         Simple String（狀態回覆）
+//	-ERR unknown command\r\n        Error
+//	:1\r\n                          Integer
+//	$5\r\nhello\r\n                 Bulk String（$-1\r\n 表示 null）
+//	*2\r\n$3\r\nGET\r\n$1\r\nk\r\n  Array（客戶端的命令一律以 Bulk String 陣列送出）
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// 類型字元
+const (
+	TypeSimpleString = '+'
+	TypeError        = '-'
+	TypeInteger      = ':'
+	TypeBulkString   = '$'
+	TypeArray        = '*'
+)
+
+// 長度上限：防止惡意或損壞的長度前綴讓節點一次配置過多記憶體
+const (
+	MaxBulkLen  = 64 << 20 // 單一值 64 MB（Redis 為 512 MB）
+	MaxArrayLen = 1 << 20  // 單一命令最多 1M 個參數
+	MaxDepth    = 32       // 巢狀陣列的層數（命令本身不允許巢狀）
+)
+
+// ErrProtocol 協定格式錯誤（連線狀態未知，應關閉連線）。
+var ErrProtocol = errors.New("resp: protocol error")
+
+// Error 伺服器返回的錯誤回覆（-ERR ...）。
+//
+// 與網路錯誤不同：錯誤回覆之後連線仍然可用
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Value 一個 RESP 值。
+type Value struct {
+	Type  byte
+	Str   []byte  // Simple String、Error、Bulk String 的內容
+	Int   int64   // Integer
+	Array []Value // Array 的元素
+	Null  bool    // null Bulk String 或 null Array
+}
+
+// Reader 從串流讀取 RESP 值。
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader 建立 Reader。
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Buffered 緩衝區中尚未讀取的位元組數。
+//
+// 伺服器據此判斷客戶端是否還有管線化（pipelining）的命令：
+// 有則先不 Flush，把多個回覆合併成一次寫入
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// ReadValue 讀取一個完整的值。
+//
+// 巢狀陣列最多 MaxDepth 層：每一層都是一次遞迴，
+// 不限制時對方只要送出數百萬個 "*1\r\n" 就能耗盡 goroutine 的堆疊（無法 recover 的 fatal error）
+func (r *Reader) ReadValue() (Value, error) {
+	return r.readValue(0)
+}
+
+func (r *Reader) readValue(depth int) (Value, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) == 0 {
+		return Value{}, fmt.Errorf("%w: empty line", ErrProtocol)
+	}
+
+	v := Value{Type: line[0]}
+	switch line[0] {
+	case TypeSimpleString, TypeError:
+		v.Str = line[1:]
+	case TypeInteger:
+		v.Int, err = parseInt(line[1:])
+	case TypeBulkString:
+		var n int64
+		if n, err = parseLen(line[1:], MaxBulkLen); err != nil || n < 0 {
+			v.Null = n < 0
+			break
+		}
+		v.Str, err = r.readBulk(n)
+	case TypeArray:
+		if depth >= MaxDepth {
+			return Value{}, fmt.Errorf("%w: arrays nested deeper than %d", ErrProtocol, MaxDepth)
+		}
+		var n int64
+		if n, err = parseLen(line[1:], MaxArrayLen); err != nil || n < 0 {
+			v.Null = n < 0
+			break
+		}
+		// 與 readBulk 相同：容量隨元素到達擴充，不依長度前綴預先配置
+		v.Array = make([]Value, 0, min(n, preallocElems))
+		for range n {
+			var elem Value
+			if elem, err = r.readValue(depth + 1); err != nil {
+				break
+			}
+			v.Array = append(v.Array, elem)
+		}
+	default:
+		return Value{}, fmt.Errorf("%w: unknown type %q", ErrProtocol, line[0])
+	}
+	if err != nil {
+		return Value{}, err
+	}
+	return v, nil
+}
+
+// ReadCommand 讀取一個命令（Bulk String 陣列），返回命令名稱與參數。
+//
+// 不經過 ReadValue：命令只有一層，逐一讀取 Bulk String，
+// 遇到其他類型（包括巢狀陣列）立即返回協定錯誤，不遞迴、不為元素配置 Value
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != TypeArray {
+		return nil, fmt.Errorf("%w: command must be a non-empty array", ErrProtocol)
+	}
+	n, err := parseLen(line[1:], MaxArrayLen)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: command must be a non-empty array", ErrProtocol)
+	}
+
+	args := make([][]byte, 0, min(n, preallocElems))
+	for range n {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != TypeBulkString {
+			return nil, fmt.Errorf("%w: command arguments must be bulk strings", ErrProtocol)
+		}
+		size, err := parseLen(line[1:], MaxBulkLen)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, fmt.Errorf("%w: command arguments must be bulk strings", ErrProtocol)
+		}
+		arg, err := r.readBulk(size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// 依長度前綴預先配置的上限
+//
+// 元素的上限較小：一個 Value 佔 72 位元組，4096 個元素約 290 KB，
+// 而長度前綴只需要約 11 位元組的輸入；命令的參數通常只有幾個
+const (
+	preallocMax   = 4 << 10 // Bulk String 的位元組數
+	preallocElems = 64      // Array 的元素數、命令的參數數
+)
+
+// readBulk 讀取 n 位元組的內容與結尾的 \r\n。
+//
+// 為何不直接 make([]byte, n+2)？
+//
+//	長度前綴由對方決定，在任何內容到達之前就配置：
+//	惡意客戶端每條連線只送出 "$67108864\r\n" 就能讓節點配置 64 MB，
+//	幾十條連線就耗盡記憶體（MaxBulkLen 只限制單一值，擋不住這種放大）
+//
+//	改為分段讀取、隨資料到達擴充：配置量與實際收到的資料量成正比（最多約兩倍）
+//
+// 返回的切片容量等於長度：值會直接存入快取，而 MaxBytes 以 len 計算，
+// 擴充留下的多餘容量會讓實際記憶體最多是帳面的兩倍
+func (r *Reader) readBulk(n int64) ([]byte, error) {
+	total := int(n) + 2 // 內容之後還有 \r\n
+	buf := make([]byte, 0, min(total, preallocMax))
+	for len(buf) < total {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)] // 依 append 的倍增策略擴充
+		}
+		m, err := io.ReadFull(r.r, buf[len(buf):min(cap(buf), total)])
+		buf = buf[:len(buf)+m]
+		if err != nil {
+			return nil, err
+		}
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", ErrProtocol)
+	}
+	if cap(buf) > total {
+		return append(make([]byte, 0, n), buf[:n]...), nil // 擴充過：複製到剛好的大小
+	}
+	return buf[:n:n], nil
+}
+
+// readLine 讀取一行（不含 \r\n）。
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("%w: line too long", ErrProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: line not terminated by CRLF", ErrProtocol)
+	}
+	// ReadSlice 返回的切片在下次讀取時會被覆寫，複製一份
+	return append([]byte(nil), line[:len(line)-2]...), nil
+}
+
+func parseInt(b []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid integer %q", ErrProtocol, b)
+	}
+	return n, nil
+}
+
+// parseLen 解析長度前綴（-1 表示 null）。
+func parseLen(b []byte, limit int64) (int64, error) {
+	n, err := parseInt(b)
+	if err != nil {
+		return 0, err
+	}
+	if n < -1 || n > limit {
+		return 0, fmt.Errorf("%w: invalid length %d", ErrProtocol, n)
+	}
+	return n, nil
+}
+
+// Writer 將 RESP 值寫入串流（帶緩衝，寫完一批後呼叫 Flush）。
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter 建立 Writer。
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteSimpleString 寫入狀態回覆（如 OK、PONG）。
+func (w *Writer) WriteSimpleString(s string) error {
+	w.w.WriteByte(TypeSimpleString)
+	w.w.WriteString(s)
+	_, err := w.w.WriteString("\r\n")
+	return err
+}
+
+// WriteError 寫入錯誤回覆（慣例以 ERR、WRONGTYPE 等大寫單字開頭）。
+func (w *Writer) WriteError(msg string) error {
+	w.w.WriteByte(TypeError)
+	w.w.WriteString(msg)
+	_, err := w.w.WriteString("\r\n")
+	return err
+}
+
+// WriteInteger 寫入整數回覆。
+func (w *Writer) WriteInteger(n int64) error {
+	w.w.WriteByte(TypeInteger)
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	_, err := w.w.WriteString("\r\n")
+	return err
+}
+
+// WriteBulk 寫入 Bulk String。
+func (w *Writer) WriteBulk(b []byte) error {
+	w.w.WriteByte(TypeBulkString)
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	_, err := w.w.WriteString("\r\n")
+	return err
+}
+
+// WriteNull 寫入 null Bulk String（GET 未命中）。
+func (w *Writer) WriteNull() error {
+	_, err := w.w.WriteString("$-1\r\n")
+	return err
+}
+
+// WriteCommand 寫入命令（Bulk String 陣列）。
+func (w *Writer) WriteCommand(args ...[]byte) error {
+	w.w.WriteByte(TypeArray)
+	w.w.WriteString(strconv.Itoa(len(args)))
+	w.w.WriteString("\r\n")
+	for _, a := range args {
+		if err := w.WriteBulk(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush 將緩衝的資料寫出。
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,254 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadValue(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Value
+	}{
+		{"simple string", "+OK\r\n", Value{Type: TypeSimpleString, Str: []byte("OK")}},
+		{"error", "-ERR boom\r\n", Value{Type: TypeError, Str: []byte("ERR boom")}},
+		{"integer", ":-42\r\n", Value{Type: TypeInteger, Int: -42}},
+		{"bulk string", "$5\r\nhello\r\n", Value{Type: TypeBulkString, Str: []byte("hello")}},
+		{"binary bulk string", "$4\r\na\r\nb\r\n", Value{Type: TypeBulkString, Str: []byte("a\r\nb")}},
+		{"empty bulk string", "$0\r\n\r\n", Value{Type: TypeBulkString, Str: []byte{}}},
+		{"null bulk string", "$-1\r\n", Value{Type: TypeBulkString, Null: true}},
+		{"null array", "*-1\r\n", Value{Type: TypeArray, Null: true}},
+		{"array", "*2\r\n:1\r\n$1\r\nk\r\n", Value{Type: TypeArray, Array: []Value{
+			{Type: TypeInteger, Int: 1},
+			{Type: TypeBulkString, Str: []byte("k")},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewReader(strings.NewReader(tt.in)).ReadValue()
+			if err != nil {
+				t.Fatalf("ReadValue(%q) error: %v", tt.in, err)
+			}
+			if !equal(got, tt.want) {
+				t.Errorf("ReadValue(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func equal(a, b Value) bool {
+	if a.Type != b.Type || !bytes.Equal(a.Str, b.Str) || a.Int != b.Int || a.Null != b.Null || len(a.Array) != len(b.Array) {
+		return false
+	}
+	for i := range a.Array {
+		if !equal(a.Array[i], b.Array[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReadValueProtocolError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty line", "\r\n"},
+		{"unknown type", "!x\r\n"},
+		{"missing CR", "+OK\n"},
+		{"invalid integer", ":abc\r\n"},
+		{"invalid length", "$-2\r\n"},
+		{"bulk too long", "$67108865\r\n"},
+		{"array too long", "*1048577\r\n"},
+		{"bulk not terminated", "$2\r\nhixx"},
+		{"nested error", "*2\r\n:1\r\n?\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReader(strings.NewReader(tt.in)).ReadValue(); !errors.Is(err, ErrProtocol) {
+				t.Errorf("ReadValue(%q) error = %v, want ErrProtocol", tt.in, err)
+			}
+		})
+	}
+}
+
+// TestReadValueTruncated 連線在值的中途關閉：返回 I/O 錯誤而非協定錯誤。
+func TestReadValueTruncated(t *testing.T) {
+	for _, in := range []string{"$5\r\nhel", "*3\r\n:1\r\n", "$100000\r\nabc"} {
+		_, err := NewReader(strings.NewReader(in)).ReadValue()
+		if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			t.Errorf("ReadValue(%q) error = %v, want EOF", in, err)
+		}
+	}
+}
+
+// TestReadValueLargeBulk 超過預先配置上限的值分段讀取後內容完整。
+func TestReadValueLargeBulk(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 100_000) // 1 MB
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteBulk(payload)
+	w.Flush()
+
+	v, err := NewReader(&buf).ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v.Str, payload) {
+		t.Errorf("ReadValue returned %d bytes, want the %d-byte payload", len(v.Str), len(payload))
+	}
+}
+
+// TestReadValueLengthPrefixAllocation 只送出長度前綴時，配置量與實際收到的資料成正比。
+func TestReadValueLengthPrefixAllocation(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"bulk", "$67108864\r\nabc"},
+		{"array", "*1048576\r\n:1\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				for range b.N {
+					NewReader(strings.NewReader(tt.in)).ReadValue()
+				}
+			})
+			if perOp := res.AllocedBytesPerOp(); perOp > 1<<20 {
+				t.Errorf("%q allocated %d bytes per read, want far less than the advertised length", tt.in, perOp)
+			}
+		})
+	}
+}
+
+// TestReadValueDeeplyNested 巢狀陣列超過 MaxDepth 時返回協定錯誤，而非耗盡堆疊。
+func TestReadValueDeeplyNested(t *testing.T) {
+	ok := strings.Repeat("*1\r\n", MaxDepth) + ":1\r\n"
+	if _, err := NewReader(strings.NewReader(ok)).ReadValue(); err != nil {
+		t.Errorf("ReadValue with %d levels: %v", MaxDepth, err)
+	}
+
+	deep := strings.Repeat("*1\r\n", 1_000_000)
+	if _, err := NewReader(strings.NewReader(deep)).ReadValue(); !errors.Is(err, ErrProtocol) {
+		t.Errorf("ReadValue with 1M levels error = %v, want ErrProtocol", err)
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteCommand([]byte("SET"), []byte("k"), []byte("v"))
+	w.Flush()
+	buf.WriteString("+OK\r\n")       // 不是陣列
+	buf.WriteString("*1\r\n:1\r\n")  // 參數不是 Bulk String
+	buf.WriteString("*0\r\n")        // 空陣列
+	buf.WriteString("*1\r\n$-1\r\n") // null 參數
+
+	r := NewReader(&buf)
+	args, err := r.ReadCommand()
+	if err != nil || len(args) != 3 || string(args[0]) != "SET" || string(args[2]) != "v" {
+		t.Fatalf("ReadCommand() = %q, %v, want SET k v", args, err)
+	}
+	for range 4 {
+		if _, err := r.ReadCommand(); !errors.Is(err, ErrProtocol) {
+			t.Errorf("ReadCommand() error = %v, want ErrProtocol", err)
+		}
+	}
+}
+
+// TestReadCommandNested 命令的參數不可以是陣列：第一個巢狀標頭就返回錯誤，不遞迴。
+func TestReadCommandNested(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"nested", "*2\r\n$3\r\nGET\r\n*1\r\n$1\r\nk\r\n"},
+		{"deeply nested", strings.Repeat("*1\r\n", 8_000_000)},
+		{"nested length prefixes", strings.Repeat("*1048576\r\n", 100_000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.in))
+			if _, err := r.ReadCommand(); !errors.Is(err, ErrProtocol) {
+				t.Errorf("ReadCommand() error = %v, want ErrProtocol", err)
+			}
+		})
+	}
+
+	// 配置量與命令長度無關：巢狀標頭在第一個元素就被拒絕
+	in := strings.Repeat("*1048576\r\n", 1000)
+	res := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			NewReader(strings.NewReader(in)).ReadCommand()
+		}
+	})
+	if perOp := res.AllocedBytesPerOp(); perOp > 64<<10 {
+		t.Errorf("nested headers allocated %d bytes per command", perOp)
+	}
+}
+
+// TestReadBulkExactCapacity 讀出的值容量等於長度（快取以 len 計算 MaxBytes）。
+func TestReadBulkExactCapacity(t *testing.T) {
+	for _, size := range []int{0, 10, preallocMax, preallocMax + 1, 1 << 20} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.WriteCommand([]byte("SET"), []byte("k"), bytes.Repeat([]byte("x"), size))
+		w.Flush()
+
+		args, err := NewReader(&buf).ReadCommand()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := args[2]; len(v) != size || cap(v) != size {
+			t.Errorf("size %d: len %d, cap %d, want both %d", size, len(v), cap(v), size)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteSimpleString("OK")
+	w.WriteError("ERR boom")
+	w.WriteInteger(-7)
+	w.WriteBulk([]byte("hi"))
+	w.WriteNull()
+	w.WriteCommand([]byte("GET"), []byte("k"))
+	if buf.Len() != 0 {
+		t.Fatal("Writer wrote before Flush")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "+OK\r\n-ERR boom\r\n:-7\r\n$2\r\nhi\r\n$-1\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("written = %q, want %q", got, want)
+	}
+}
+
+// TestBuffered 管線化的命令在緩衝區中（伺服器據此延後 Flush）。
+func TestBuffered(t *testing.T) {
+	r := NewReader(strings.NewReader("*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPING\r\n"))
+	if _, err := r.ReadCommand(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Buffered() == 0 {
+		t.Error("Buffered() = 0 with a pipelined command pending")
+	}
+	if _, err := r.ReadCommand(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Buffered() != 0 {
+		t.Errorf("Buffered() = %d after reading everything", r.Buffered())
+	}
+}